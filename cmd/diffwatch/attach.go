@@ -0,0 +1,178 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/deemkeen/diffwatch/internal/config"
+	"github.com/deemkeen/diffwatch/internal/daemon"
+	"github.com/deemkeen/diffwatch/internal/generated"
+	"github.com/deemkeen/diffwatch/internal/migration"
+	"github.com/deemkeen/diffwatch/internal/rate"
+	"github.com/deemkeen/diffwatch/internal/redact"
+	"github.com/deemkeen/diffwatch/internal/severity"
+	"github.com/deemkeen/diffwatch/internal/suppress"
+	"github.com/deemkeen/diffwatch/internal/ui"
+)
+
+// runAttach implements the "attach" subcommand, opening the UI against a
+// running daemon
+func runAttach(args []string) int {
+	fs := flag.NewFlagSet("attach", flag.ContinueOnError)
+
+	var pid, maxHistory int
+	var digestWindow time.Duration
+	var configPath string
+	var light, dark, ascii bool
+
+	fs.IntVar(&pid, "pid", 0, "")
+	fs.StringVar(&configPath, "config", "", "")
+	fs.StringVar(&configPath, "c", "", "")
+	fs.IntVar(&maxHistory, "max-history", 0, "")
+	fs.BoolVar(&light, "light", false, "")
+	fs.BoolVar(&dark, "dark", false, "")
+	fs.BoolVar(&ascii, "ascii", false, "")
+	fs.DurationVar(&digestWindow, "digest-window", 0, "")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage of %s attach:\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  -pid int\n")
+		fmt.Fprintf(os.Stderr, "    \tDaemon to attach to (default: the only running instance)\n")
+		fmt.Fprintf(os.Stderr, "  -c, -config string\n")
+		fmt.Fprintf(os.Stderr, "    \tPath to config file for levels and alerts (default: %s in the watched path, then user config dir)\n", config.FileName)
+		fmt.Fprintf(os.Stderr, "  -max-history int\n")
+		fmt.Fprintf(os.Stderr, "    \tEvent log entries kept in memory, filled from the daemon's recorded events (default: 100)\n")
+		fmt.Fprintf(os.Stderr, "  -light, -dark\n")
+		fmt.Fprintf(os.Stderr, "    \tUse colors for a light or dark terminal background (default: detected)\n")
+		fmt.Fprintf(os.Stderr, "  -ascii\n")
+		fmt.Fprintf(os.Stderr, "    \tDraw only ASCII, for terminals or fonts without emoji and box drawing characters\n")
+		fmt.Fprintf(os.Stderr, "  -digest-window duration\n")
+		fmt.Fprintf(os.Stderr, "    \tTime window summarized by the digest pane ('D') (default: 15m)\n")
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	socket, err := findSocket(pid)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	client, err := daemon.Attach(socket)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer client.Close()
+
+	if configPath == "" {
+		configPath = config.Find(client.WatchPath())
+	}
+	cfg := config.Default()
+	if configPath != "" {
+		cfg, err = config.Load(configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+	}
+	if maxHistory > 0 {
+		cfg.MaxHistory = maxHistory
+	}
+
+	classifier, err := severity.New(cfg.Rules)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in config rules: %v\n", err)
+		return 1
+	}
+
+	suppressor, err := suppress.New(cfg.Suppress)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in config suppress rules: %v\n", err)
+		return 1
+	}
+
+	detector, err := generated.New(cfg.Generated)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in config: %v\n", err)
+		return 1
+	}
+
+	redactor, err := redact.New(cfg.Redact)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in config redact rules: %v\n", err)
+		return 1
+	}
+
+	migrations, err := migration.New(client.WatchPath(), cfg.Migrations)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in config: %v\n", err)
+		return 1
+	}
+
+	alarms, err := rate.New(cfg.RateAlarms)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in config: %v\n", err)
+		return 1
+	}
+
+	notifyHours, _, err := schedules(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	// Show what happened while no UI was attached
+	history, err := client.History(cfg.MaxHistory)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: reading daemon history: %v\n", err)
+		return 1
+	}
+
+	if !light && !dark {
+		light = !lipgloss.HasDarkBackground()
+	}
+
+	program := ui.New(client, ui.Options{
+		Classifier:   classifier,
+		Levels:       cfg.Levels,
+		MaxDirs:      cfg.MaxDirs,
+		MaxHistory:   cfg.MaxHistory,
+		LogLines:     cfg.LogLines,
+		Suppressor:   suppressor,
+		Generated:    detector,
+		Migrations:   migrations,
+		DocumentText: cfg.DocumentText,
+		Redactor:     redactor,
+		RateAlarms:   alarms,
+		NotifyHours:  notifyHours,
+		Config:       cfg,
+		Ops:          cfg.Ops,
+		Light:        light,
+		ASCII:        ascii,
+		History:      history,
+		NoControl:    true,
+		Digest:       digestWindow,
+	})
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-sigChan
+		program.Quit()
+	}()
+
+	if err := program.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/deemkeen/diffwatch/internal/diff"
+	"github.com/deemkeen/diffwatch/internal/lang"
+	"github.com/deemkeen/diffwatch/internal/pathname"
+	"github.com/deemkeen/diffwatch/internal/state"
+	"github.com/deemkeen/diffwatch/internal/watcher"
+)
+
+// awaitMaxSize is the largest file size await diffs; larger files are
+// reported without a diff
+const awaitMaxSize = 1 * 1024 * 1024 // 1MB
+
+// awaitMask replaces the values of .env files in printed diffs, as in the
+// diff pane
+const awaitMask = "••••••"
+
+// runAwait implements the "await" subcommand, which waits for the next
+// change to a file or directory, prints its diff and exits
+func runAwait(args []string) int {
+	fs := flag.NewFlagSet("await", flag.ContinueOnError)
+
+	var recursive, reveal bool
+	var timeout time.Duration
+	var algorithmName string
+	var logOpts options
+
+	fs.BoolVar(&recursive, "recursive", false, "")
+	fs.BoolVar(&recursive, "r", false, "")
+	fs.DurationVar(&timeout, "timeout", 0, "")
+	fs.BoolVar(&reveal, "reveal-values", false, "")
+	fs.StringVar(&algorithmName, "algorithm", "", "")
+	fs.BoolVar(&logOpts.verbose, "verbose", false, "")
+	fs.BoolVar(&logOpts.debug, "debug", false, "")
+	fs.StringVar(&logOpts.logPath, "log", "", "")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage of %s await [flags] PATH:\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  Waits for the next change to the file PATH, or to a file in the directory\n")
+		fmt.Fprintf(os.Stderr, "  PATH, prints its unified diff to stdout and exits\n")
+		fmt.Fprintf(os.Stderr, "  -r, -recursive\n")
+		fmt.Fprintf(os.Stderr, "    \tAlso wait for changes in subdirectories of a directory\n")
+		fmt.Fprintf(os.Stderr, "  -timeout duration\n")
+		fmt.Fprintf(os.Stderr, "    \tGive up after this long, e.g. 5m (exit status %d) (default: wait forever)\n", exitTimeout)
+		fmt.Fprintf(os.Stderr, "  -reveal-values\n")
+		fmt.Fprintf(os.Stderr, "    \tPrint the values of .env files, masked by default\n")
+		fmt.Fprintf(os.Stderr, "  -algorithm name\n")
+		fmt.Fprintf(os.Stderr, "    \tHow lines are matched between versions: %s (default: histogram for code, patience for Markdown, myers otherwise)\n", strings.Join(algorithmNames(), ", "))
+		fmt.Fprintf(os.Stderr, "  -verbose\n")
+		fmt.Fprintf(os.Stderr, "    \tLog watcher activity to stderr\n")
+		fmt.Fprintf(os.Stderr, "  -debug\n")
+		fmt.Fprintf(os.Stderr, "    \tLike -verbose, and also log every raw event and why it was ignored\n")
+		fmt.Fprintf(os.Stderr, "  -log file\n")
+		fmt.Fprintf(os.Stderr, "    \tLog to this file instead of stderr\n")
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	algorithm, err := diff.ParseAlgorithm(algorithmName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: -algorithm: %v\n", err)
+		return 1
+	}
+
+	// A file is awaited by watching its directory, so it may not exist yet
+	target, err := filepath.Abs(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	target = pathname.Normalize(target)
+	dir := target
+	if info, err := os.Stat(target); err != nil || !info.IsDir() {
+		dir = filepath.Dir(target)
+		recursive = false
+	} else {
+		target = ""
+	}
+
+	logger, logFile, err := logOpts.openLogger(true)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if logFile != nil {
+		defer logFile.Close()
+	}
+
+	fw, err := watcher.New(dir, recursive, watcher.Options{Logger: logger})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating watcher: %v\n", err)
+		return 1
+	}
+	defer fw.Close()
+
+	// Snapshot the awaited files, so the change is diffed against them
+	stateManager := state.New()
+	walk := fw.WalkFiles
+	if target != "" {
+		walk = func(fn func(path string) error) error { return fn(target) }
+	}
+	if err := stateManager.Prescan(walk, runtime.NumCPU(), awaitMaxSize, &state.Progress{}); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		deadline = time.After(timeout)
+	}
+
+	engine := diff.New(fw.WatchPath(), algorithm)
+	for {
+		select {
+		case event, ok := <-fw.Events():
+			if !ok {
+				return 1
+			}
+			if target != "" && event.Path != target {
+				continue
+			}
+
+			result, err := awaitDiff(stateManager, engine, event)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				return 1
+			}
+			if result != nil && !result.HasDiff && !result.TooLarge && !result.IsNew && !result.IsDeleted {
+				// Written without changing the content, or a directory
+				continue
+			}
+
+			fmt.Fprintf(os.Stderr, "%s: %s\n", event.Op, pathname.Display(event.Path))
+			if result != nil {
+				fmt.Print(awaitPatch(result, reveal))
+			}
+			return 0
+
+		case err, ok := <-fw.Errors():
+			if !ok {
+				return 1
+			}
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+
+		case <-deadline:
+			return exitTimeout
+
+		case <-sigChan:
+			return exitInterrupted
+		}
+	}
+}
+
+// awaitPatch returns the unified diff of a result to print, with the
+// values of .env files masked unless reveal is set
+func awaitPatch(result *diff.Result, reveal bool) string {
+	if result.Language == lang.Dotenv && !reveal {
+		return diff.MaskEnvPatch(result.Unified, awaitMask)
+	}
+	return result.Unified
+}
+
+// awaitDiff reads the file of an event and diffs it against its snapshot.
+// Files too large to diff get a result marked TooLarge, directories one
+// without changes.
+func awaitDiff(stateManager *state.Manager, engine *diff.Engine, event watcher.Event) (*diff.Result, error) {
+	info, err := state.Stat(event.Path)
+	switch {
+	case err != nil && !os.IsNotExist(err):
+		return nil, fmt.Errorf("stat %s: %w", event.Path, err)
+	case err != nil:
+		// Removed or renamed away: diffed against nothing below
+	case info.IsDir():
+		return &diff.Result{Path: event.Path}, nil
+	case info.Size() > awaitMaxSize:
+		return &diff.Result{Path: event.Path, TooLarge: true}, nil
+	}
+
+	oldState, newState, err := stateManager.Update(event.Path)
+	if errors.Is(err, state.ErrLocked) {
+		return nil, fmt.Errorf("%s is locked by another process", event.Path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", event.Path, err)
+	}
+
+	result, err := engine.Compute(oldState, newState)
+	if err != nil {
+		return nil, fmt.Errorf("computing diff: %w", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/deemkeen/diffwatch/internal/diff"
+	"github.com/deemkeen/diffwatch/internal/state"
+)
+
+// awaitResult diffs two versions of the file at path as await does
+func awaitResult(t *testing.T, path, old, new string) *diff.Result {
+	t.Helper()
+	file := func(content string) *state.FileState {
+		return &state.FileState{Path: path, Content: []byte(content), Exists: true, Hash: state.HashContent([]byte(content))}
+	}
+	result, err := diff.New("/srv/app", "").Compute(file(old), file(new))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestAwaitPatchMasksEnvValues(t *testing.T) {
+	result := awaitResult(t, "/srv/app/.env", "DB_HOST=localhost\nSECRET=abc\n", "DB_HOST=localhost\nSECRET=xyz\n")
+
+	patch := awaitPatch(result, false)
+	for _, secret := range []string{"abc", "xyz", "localhost"} {
+		if strings.Contains(patch, secret) {
+			t.Errorf("patch shows the value %q:\n%s", secret, patch)
+		}
+	}
+	for _, line := range []string{"--- a/.env\n", "-SECRET=" + awaitMask + "\n", "+SECRET=" + awaitMask + "\n"} {
+		if !strings.Contains(patch, line) {
+			t.Errorf("patch misses %q:\n%s", line, patch)
+		}
+	}
+
+	if patch := awaitPatch(result, true); patch != result.Unified {
+		t.Errorf("revealed patch %q, want %q", patch, result.Unified)
+	}
+}
+
+func TestAwaitPatchKeepsOtherValues(t *testing.T) {
+	result := awaitResult(t, "/srv/app/settings.conf", "SECRET=abc\n", "SECRET=xyz\n")
+	if patch := awaitPatch(result, false); patch != result.Unified {
+		t.Errorf("patch %q, want %q", patch, result.Unified)
+	}
+}
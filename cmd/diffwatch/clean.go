@@ -0,0 +1,141 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deemkeen/diffwatch/internal/dirs"
+)
+
+// runClean implements the "clean" subcommand, which removes old logs,
+// change databases, saved patches, crash reports and snapshots
+func runClean(args []string) int {
+	flags := flag.NewFlagSet("clean", flag.ContinueOnError)
+
+	var olderThan string
+	var dryRun bool
+
+	flags.StringVar(&olderThan, "older-than", "7d", "")
+	flags.BoolVar(&dryRun, "n", false, "")
+
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage of %s clean [flags]:\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  Removes files last changed before a cutoff from %s\n", dirs.State())
+		fmt.Fprintf(os.Stderr, "  (logs, change databases, patches, crash reports) and %s (snapshots).\n", dirs.Cache())
+		fmt.Fprintf(os.Stderr, "  Files of running instances are kept.\n")
+		fmt.Fprintf(os.Stderr, "  -older-than age\n")
+		fmt.Fprintf(os.Stderr, "    \tRemove files unchanged for this long, e.g. 12h or 30d (default: 7d)\n")
+		fmt.Fprintf(os.Stderr, "  -n\n")
+		fmt.Fprintf(os.Stderr, "    \tOnly list the files that would be removed\n")
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return 2
+	}
+
+	age, err := parseAge(olderThan)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: -older-than: %v\n", err)
+		return 2
+	}
+	cutoff := time.Now().Add(-age)
+
+	// The cache directory also holds the logs, databases and patches of
+	// versions that kept everything there
+	var removed int
+	var size int64
+	for _, dir := range []string{dirs.Snapshots(), dirs.Logs(), dirs.Databases(), dirs.Patches(), dirs.Crashes(), dirs.Cache()} {
+		entries, err := os.ReadDir(dir)
+		if err != nil && !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+
+		for _, entry := range entries {
+			path := filepath.Join(dir, entry.Name())
+			if dir == dirs.Cache() && path == dirs.Snapshots() {
+				continue
+			}
+			if pid, ok := ownerPID(entry.Name()); ok && processAlive(pid) {
+				continue
+			}
+
+			info, err := entry.Info()
+			if err != nil || info.ModTime().After(cutoff) {
+				continue
+			}
+
+			n := treeSize(path)
+			if dryRun {
+				fmt.Printf("%s (%s)\n", path, formatSize(n))
+			} else if err := os.RemoveAll(path); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				continue
+			}
+			removed++
+			size += n
+		}
+	}
+
+	verb := "Removed"
+	if dryRun {
+		verb = "Would remove"
+	}
+	fmt.Printf("%s %d files (%s) last changed before %s\n", verb, removed, formatSize(size), cutoff.Format("2006-01-02 15:04"))
+	return 0
+}
+
+// parseAge parses a duration like "90m" or "12h", or a number of days
+// like "7d"
+func parseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.ParseFloat(days, 64)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid age %q (use e.g. 12h or 7d)", s)
+		}
+		return time.Duration(n * float64(24*time.Hour)), nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age %q (use e.g. 12h or 7d)", s)
+	}
+	return d, nil
+}
+
+// ownerPID returns the process a file or directory belongs to, for names
+// starting with a PID like snapshot directories ("PID-*") or daemon
+// databases ("daemon-PID.sqlite")
+func ownerPID(name string) (int, bool) {
+	name = strings.TrimPrefix(name, "daemon-")
+	end := strings.IndexFunc(name, func(r rune) bool { return r < '0' || r > '9' })
+	if end <= 0 || name[end] != '-' && name[end] != '.' {
+		return 0, false
+	}
+	pid, err := strconv.Atoi(name[:end])
+	return pid, err == nil
+}
+
+// treeSize returns the total size of the files at or below path
+func treeSize(path string) int64 {
+	var size int64
+	filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
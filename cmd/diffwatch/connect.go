@@ -0,0 +1,156 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/deemkeen/diffwatch/internal/config"
+	"github.com/deemkeen/diffwatch/internal/generated"
+	"github.com/deemkeen/diffwatch/internal/rate"
+	"github.com/deemkeen/diffwatch/internal/redact"
+	"github.com/deemkeen/diffwatch/internal/severity"
+	"github.com/deemkeen/diffwatch/internal/share"
+	"github.com/deemkeen/diffwatch/internal/suppress"
+	"github.com/deemkeen/diffwatch/internal/ui"
+)
+
+// runConnect implements the "connect" subcommand, mirroring a session
+// shared with -share read-only in the UI
+func runConnect(args []string) int {
+	fs := flag.NewFlagSet("connect", flag.ContinueOnError)
+
+	var maxHistory int
+	var digestWindow time.Duration
+	var token, configPath string
+	var light, dark, ascii, follow bool
+
+	fs.StringVar(&token, "token", "", "")
+	fs.StringVar(&configPath, "config", "", "")
+	fs.StringVar(&configPath, "c", "", "")
+	fs.IntVar(&maxHistory, "max-history", 0, "")
+	fs.BoolVar(&light, "light", false, "")
+	fs.BoolVar(&dark, "dark", false, "")
+	fs.BoolVar(&ascii, "ascii", false, "")
+	fs.BoolVar(&follow, "follow", false, "")
+	fs.DurationVar(&digestWindow, "digest-window", 0, "")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage of %s connect [flags] HOST:PORT:\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  -token string\n")
+		fmt.Fprintf(os.Stderr, "    \tSecret set with -share-token by the shared session\n")
+		fmt.Fprintf(os.Stderr, "  -c, -config string\n")
+		fmt.Fprintf(os.Stderr, "    \tPath to config file for levels and alerts (default: %s in the user config dir)\n", config.FileName)
+		fmt.Fprintf(os.Stderr, "  -max-history int\n")
+		fmt.Fprintf(os.Stderr, "    \tEvent log entries kept in memory (default: 100)\n")
+		fmt.Fprintf(os.Stderr, "  -light, -dark\n")
+		fmt.Fprintf(os.Stderr, "    \tUse colors for a light or dark terminal background (default: detected)\n")
+		fmt.Fprintf(os.Stderr, "  -ascii\n")
+		fmt.Fprintf(os.Stderr, "    \tDraw only ASCII, for terminals or fonts without emoji and box drawing characters\n")
+		fmt.Fprintf(os.Stderr, "  -follow\n")
+		fmt.Fprintf(os.Stderr, "    \tShow the diff the shared session shows, scrolled like it, for guided walkthroughs ('F' toggles)\n")
+		fmt.Fprintf(os.Stderr, "  -digest-window duration\n")
+		fmt.Fprintf(os.Stderr, "    \tTime window summarized by the digest pane ('D') (default: 15m)\n")
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	client, err := share.Connect(fs.Arg(0), token)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer client.Close()
+
+	// The watched path is on the other machine: only the user config applies
+	if configPath == "" {
+		configPath = config.Find(client.WatchPath())
+	}
+	cfg := config.Default()
+	if configPath != "" {
+		cfg, err = config.Load(configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+	}
+	if maxHistory > 0 {
+		cfg.MaxHistory = maxHistory
+	}
+
+	classifier, err := severity.New(cfg.Rules)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in config rules: %v\n", err)
+		return 1
+	}
+
+	suppressor, err := suppress.New(cfg.Suppress)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in config suppress rules: %v\n", err)
+		return 1
+	}
+
+	detector, err := generated.New(cfg.Generated)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in config: %v\n", err)
+		return 1
+	}
+
+	redactor, err := redact.New(cfg.Redact)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in config redact rules: %v\n", err)
+		return 1
+	}
+
+	alarms, err := rate.New(cfg.RateAlarms)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in config: %v\n", err)
+		return 1
+	}
+
+	if !light && !dark {
+		light = !lipgloss.HasDarkBackground()
+	}
+
+	program := ui.New(client, ui.Options{
+		Classifier: classifier,
+		Levels:     cfg.Levels,
+		MaxDirs:    cfg.MaxDirs,
+		MaxHistory: cfg.MaxHistory,
+		LogLines:   cfg.LogLines,
+		Suppressor: suppressor,
+		Generated:  detector,
+		Redactor:   redactor,
+		RateAlarms: alarms,
+		Config:     cfg,
+		Light:      light,
+		ASCII:      ascii,
+		NoControl:  true,
+		Digest:     digestWindow,
+		Follow:     follow,
+	})
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-sigChan
+		program.Quit()
+	}()
+
+	if err := program.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/deemkeen/diffwatch/internal/control"
+)
+
+// runCtl implements the "ctl" subcommand, changing the watch set of a
+// running instance
+func runCtl(args []string) int {
+	fs := flag.NewFlagSet("ctl", flag.ContinueOnError)
+
+	var pid int
+	fs.IntVar(&pid, "pid", 0, "")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage of %s ctl:\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s ctl [-pid PID] add PATH\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    \tStart watching another directory or file\n")
+		fmt.Fprintf(os.Stderr, "  %s ctl [-pid PID] remove PATH\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    \tStop watching a root\n")
+		fmt.Fprintf(os.Stderr, "  %s ctl [-pid PID] list\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    \tList the watched roots\n\n")
+		fmt.Fprintf(os.Stderr, "Flags:\n")
+		fmt.Fprintf(os.Stderr, "  -pid int\n")
+		fmt.Fprintf(os.Stderr, "    \tInstance to control (default: the only running instance)\n")
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	req := control.Request{Cmd: fs.Arg(0)}
+	switch {
+	case (req.Cmd == "add" || req.Cmd == "remove") && fs.NArg() == 2:
+		// Paths are relative to our working directory, not the instance's
+		path, err := filepath.Abs(fs.Arg(1))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		req.Path = path
+	case req.Cmd == "list" && fs.NArg() == 1:
+	default:
+		fs.Usage()
+		return 2
+	}
+
+	socket, err := findSocket(pid)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	resp, err := control.Send(socket, req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if resp.Error != "" {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", resp.Error)
+		return 1
+	}
+
+	for _, root := range resp.Roots {
+		fmt.Println(root)
+	}
+	return 0
+}
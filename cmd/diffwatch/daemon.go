@@ -0,0 +1,430 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/deemkeen/diffwatch/internal/control"
+	"github.com/deemkeen/diffwatch/internal/daemon"
+	"github.com/deemkeen/diffwatch/internal/diff"
+	"github.com/deemkeen/diffwatch/internal/dirs"
+	"github.com/deemkeen/diffwatch/internal/migration"
+	"github.com/deemkeen/diffwatch/internal/redact"
+	"github.com/deemkeen/diffwatch/internal/severity"
+	"github.com/deemkeen/diffwatch/internal/state"
+	"github.com/deemkeen/diffwatch/internal/store"
+	"github.com/deemkeen/diffwatch/internal/suppress"
+	"github.com/deemkeen/diffwatch/internal/watcher"
+)
+
+// startTimeout bounds how long "daemon start" waits for the daemon's
+// socket to come up
+const startTimeout = 5 * time.Second
+
+// runDaemon implements the "daemon" subcommand, which watches in the
+// background without a UI
+func runDaemon(args []string) int {
+	usage := func() {
+		fmt.Fprintf(os.Stderr, "Usage of %s daemon:\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s daemon start [flags]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    \tStart watching in the background, recording to a change database\n")
+		fmt.Fprintf(os.Stderr, "  %s daemon run [flags]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    \tLike start, but stay in the foreground (e.g. under a service manager)\n")
+		fmt.Fprintf(os.Stderr, "  %s daemon stop [-pid PID]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    \tStop a running daemon\n")
+		fmt.Fprintf(os.Stderr, "  %s daemon status [-pid PID]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    \tShow what a running daemon watches\n\n")
+		fmt.Fprintf(os.Stderr, "Flags for start and run are those of %s itself, except -auto-commit,\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "-protect, -light and -dark. Without -db, events are recorded to\n")
+		fmt.Fprintf(os.Stderr, "%s.\n", filepath.Join(dirs.Databases(), "daemon-PID.sqlite"))
+	}
+
+	if len(args) == 0 {
+		usage()
+		return 2
+	}
+
+	switch args[0] {
+	case "start":
+		return runDaemonStart(args[1:])
+	case "run":
+		return runDaemonRun(args[1:])
+	case "stop", "status":
+		return runDaemonCtl(args[0], args[1:])
+	case "-h", "-help", "--help":
+		usage()
+		return 0
+	default:
+		usage()
+		return 2
+	}
+}
+
+// parseDaemonFlags parses the watch flags of "daemon start" and "daemon
+// run", rejecting those that need the UI
+func parseDaemonFlags(name string, args []string) (*options, error) {
+	fs := flag.NewFlagSet("daemon "+name, flag.ContinueOnError)
+
+	var opts options
+	opts.register(fs)
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage of %s daemon %s:\n", os.Args[0], name)
+		printFlags(os.Stderr)
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return nil, fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+	if opts.autoCommit || len(opts.protectPaths) > 0 || opts.protectRestore {
+		return nil, errors.New("-auto-commit and -protect need the UI and are not supported by the daemon")
+	}
+	if len(opts.tabs) > 0 {
+		return nil, errors.New("-tab is not supported by the daemon, start one daemon per path")
+	}
+	if opts.share != "" {
+		return nil, errors.New("-share needs the UI and is not supported by the daemon")
+	}
+	if opts.bench || opts.a11y || opts.ascii {
+		return nil, errors.New("-bench, -a11y and -ascii need the UI and are not supported by the daemon")
+	}
+	if opts.until != "" || opts.timeout > 0 {
+		return nil, errors.New("-until and -timeout need the UI and are not supported by the daemon")
+	}
+	if opts.alarmFiles != "" || opts.alarmChanges != "" {
+		return nil, errors.New("-alarm-files and -alarm-changes need the UI and are not supported by the daemon")
+	}
+	if opts.bell != "" || opts.bellSound != "" {
+		return nil, errors.New("-bell and -bell-sound need the UI and are not supported by the daemon")
+	}
+	if opts.who || len(opts.byPID) > 0 || len(opts.byProcess) > 0 {
+		return nil, errors.New("-who, -by-pid and -by-process need the UI and are not supported by the daemon")
+	}
+	backend, path, err := opts.source()
+	if err != nil {
+		return nil, err
+	}
+	if !watcher.IsLocal(backend, path) {
+		return nil, errors.New("the daemon only supports local backends")
+	}
+	return &opts, nil
+}
+
+// runDaemonStart starts "daemon run" as a detached process and waits until
+// it accepts clients
+func runDaemonStart(args []string) int {
+	opts, err := parseDaemonFlags("start", args)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+
+	// Report config errors here rather than in the daemon's log
+	if _, err := opts.loadConfig(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	// The daemon's stderr goes to a log file, as the terminal may close
+	logPath := filepath.Join(dirs.Logs(), "daemon.log")
+	if err := os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: creating log directory: %v\n", err)
+		return 1
+	}
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: opening log file: %v\n", err)
+		return 1
+	}
+	defer logFile.Close()
+
+	cmd := exec.Command(exe, append([]string{"daemon", "run"}, args...)...)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	detach(cmd)
+
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: starting daemon: %v\n", err)
+		return 1
+	}
+
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	pid := cmd.Process.Pid
+	socket := control.SocketPath(pid)
+	deadline := time.After(startTimeout)
+	for {
+		select {
+		case err := <-exited:
+			fmt.Fprintf(os.Stderr, "Error: daemon exited during startup (%v), see %s\n", err, logPath)
+			return 1
+		case <-deadline:
+			fmt.Fprintf(os.Stderr, "Error: daemon (PID %d) did not start within %s, see %s\n", pid, startTimeout, logPath)
+			return 1
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		if _, err := control.Send(socket, control.Request{Cmd: "list"}); err == nil {
+			break
+		}
+	}
+
+	fmt.Printf("diffwatch daemon started (PID %d)\n", pid)
+	fmt.Printf("Attach with: %s attach -pid %d\n", os.Args[0], pid)
+	return 0
+}
+
+// runDaemonRun watches in the foreground until stopped by a signal or
+// "daemon stop"
+func runDaemonRun(args []string) int {
+	opts, err := parseDaemonFlags("run", args)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+
+	cfg, err := opts.loadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	classifier, err := severity.New(cfg.Rules)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in config rules: %v\n", err)
+		return 1
+	}
+
+	suppressor, err := suppress.New(cfg.Suppress)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in config suppress rules: %v\n", err)
+		return 1
+	}
+
+	redactor, err := redact.New(cfg.Redact)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in config redact rules: %v\n", err)
+		return 1
+	}
+
+	migrations, err := migration.New(opts.watchPath, cfg.Migrations)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in config: %v\n", err)
+		return 1
+	}
+
+	algorithm, err := diff.ParseAlgorithm(opts.algorithm)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: -algorithm: %v\n", err)
+		return 1
+	}
+
+	notifyHours, recordHours, err := schedules(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	// Without a terminal to draw on, the daemon logs to stderr by default
+	logger, logFile, err := opts.openLogger(true)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if logFile != nil {
+		defer logFile.Close()
+	}
+	if logger == nil {
+		logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+	}
+
+	dbPath := opts.dbPath
+	if dbPath == "" {
+		dbPath = filepath.Join(dirs.Databases(), fmt.Sprintf("daemon-%d.sqlite", os.Getpid()))
+		if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: creating database directory: %v\n", err)
+			return 1
+		}
+	}
+	if abs, err := filepath.Abs(dbPath); err == nil {
+		dbPath = abs
+	}
+
+	db, err := store.Open(dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	debounce, err := watcher.ParseDebounce(cfg.Debounce)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in config: %v\n", err)
+		return 1
+	}
+
+	fw, err := watcher.New(opts.watchPath, opts.recursive, watcher.Options{
+		Ops:         cfg.Ops,
+		IgnoreFiles: cfg.IgnoreFiles,
+		Debounce:    debounce,
+		Logger:      logger,
+		Backend:     opts.backend,
+		Interval:    opts.pollInterval,
+		WaitRoot:    opts.waitRoot,
+		WatchDirs:   cfg.WatchDirs,
+		WatchDepth:  cfg.WatchDepth,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating watcher: %v\n", err)
+		return 1
+	}
+	defer fw.Close()
+
+	d := daemon.New(fw, db, daemon.Options{
+		Classifier:   classifier,
+		Suppressor:   suppressor,
+		Redactor:     redactor,
+		Migrations:   migrations,
+		Algorithm:    algorithm,
+		DocumentText: cfg.DocumentText,
+		Limits: state.Limits{
+			MaxFiles: cfg.MaxTrackedFiles,
+			MaxBytes: cfg.MaxTotalBytes,
+		},
+		DiffCache: diff.CacheLimits{
+			MaxEntries: cfg.DiffCacheEntries,
+			MaxBytes:   cfg.DiffCacheBytes,
+		},
+		Prescan:     opts.prescan,
+		DBPath:      dbPath,
+		Logger:      logger,
+		Levels:      cfg.Levels,
+		NotifyHours: notifyHours,
+		RecordHours: recordHours,
+	})
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigChan
+		d.Stop()
+	}()
+
+	if err := d.Run(control.SocketPath(os.Getpid())); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// runDaemonCtl implements "daemon stop" and "daemon status"
+func runDaemonCtl(cmd string, args []string) int {
+	fs := flag.NewFlagSet("daemon "+cmd, flag.ContinueOnError)
+
+	var pid int
+	fs.IntVar(&pid, "pid", 0, "")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage of %s daemon %s:\n", os.Args[0], cmd)
+		fmt.Fprintf(os.Stderr, "  -pid int\n")
+		fmt.Fprintf(os.Stderr, "    \tDaemon to %s (default: the only running instance)\n", cmd)
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	socket, err := findSocket(pid)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	resp, err := control.Send(socket, control.Request{Cmd: "status"})
+	if err == nil && resp.Error != "" {
+		err = errors.New(resp.Error)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v (is it a daemon?)\n", err)
+		return 1
+	}
+
+	var status daemon.Status
+	if err := json.Unmarshal(resp.Data, &status); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: decoding status: %v\n", err)
+		return 1
+	}
+
+	if cmd == "stop" {
+		resp, err := control.Send(socket, control.Request{Cmd: "stop"})
+		if err == nil && resp.Error != "" {
+			err = errors.New(resp.Error)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: stopping daemon: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Stopped diffwatch daemon (PID %d)\n", status.PID)
+		return 0
+	}
+
+	mode := "non-recursive"
+	if status.Recursive {
+		mode = "recursive"
+	}
+	fmt.Printf("PID:       %d\n", status.PID)
+	fmt.Printf("Watching:  %s (%s)\n", strings.Join(status.Roots, ", "), mode)
+	fmt.Printf("Database:  %s\n", status.DB)
+	fmt.Printf("Started:   %s (%s ago)\n", status.Started.Format("2006-01-02 15:04:05"),
+		time.Since(status.Started).Round(time.Second))
+	fmt.Printf("Events:    %d\n", status.Events)
+	fmt.Printf("Attached:  %d\n", status.Clients)
+	if cache := status.DiffCache; cache.Hits+cache.Misses > 0 {
+		fmt.Printf("Cache:     %d%% diff hits (%d of %d), %d diffs (%s)\n", cache.HitRate(), cache.Hits,
+			cache.Hits+cache.Misses, cache.Entries, formatSize(cache.Bytes))
+	}
+	now := map[bool]string{true: "now", false: "not now"}
+	if status.NotifyHours != "" {
+		fmt.Printf("Notify:    %s (%s)\n", status.NotifyHours, now[status.Notifying])
+	}
+	if status.RecordHours != "" {
+		fmt.Printf("Record:    %s (%s)\n", status.RecordHours, now[status.Recording])
+	}
+	return 0
+}
+
+// findSocket returns the socket of the instance with the given PID, or of
+// the only running instance if pid is 0
+func findSocket(pid int) (string, error) {
+	if pid != 0 {
+		return control.SocketPath(pid), nil
+	}
+	return control.Find()
+}
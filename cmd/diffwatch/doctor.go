@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/deemkeen/diffwatch/internal/config"
+	"github.com/deemkeen/diffwatch/internal/doctor"
+)
+
+// runDoctor implements the "doctor" subcommand, which checks the limits
+// and filesystem a session would run into before starting it. Exits with
+// 1 if any check warns.
+func runDoctor(args []string) int {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+
+	var opts options
+	fs.StringVar(&opts.watchPath, "path", ".", "")
+	fs.StringVar(&opts.watchPath, "p", ".", "")
+	fs.BoolVar(&opts.recursive, "recursive", false, "")
+	fs.BoolVar(&opts.recursive, "r", false, "")
+	fs.StringVar(&opts.configPath, "config", "", "")
+	fs.StringVar(&opts.configPath, "c", "", "")
+	fs.IntVar(&opts.maxDirs, "max-dirs", 0, "")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage of %s doctor:\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  -p, -path string\n")
+		fmt.Fprintf(os.Stderr, "    \tDirectory or file to check (default: .)\n")
+		fmt.Fprintf(os.Stderr, "  -r, -recursive\n")
+		fmt.Fprintf(os.Stderr, "    \tCheck a recursive watch\n")
+		fmt.Fprintf(os.Stderr, "  -c, -config string\n")
+		fmt.Fprintf(os.Stderr, "    \tPath to config file (default: %s in checked path, then user config dir)\n", config.FileName)
+		fmt.Fprintf(os.Stderr, "  -max-dirs int\n")
+		fmt.Fprintf(os.Stderr, "    \tDirectory count to warn about (default: max_dirs from the config)\n")
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := opts.loadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	absPath, err := filepath.Abs(opts.watchPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	mode := "not recursive"
+	if opts.recursive {
+		mode = "recursive"
+	}
+	fmt.Printf("diffwatch doctor: %s (%s)\n\n", absPath, mode)
+
+	checks := doctor.Run(absPath, doctor.Options{Recursive: opts.recursive, MaxDirs: cfg.MaxDirs})
+	warnings := 0
+	for _, c := range checks {
+		fmt.Printf("%-4s  %-10s  %s\n", c.Status, c.Name, c.Value)
+		if c.Hint != "" {
+			fmt.Printf("      %-10s  %s\n", "", c.Hint)
+		}
+		if c.Status == doctor.Warn {
+			warnings++
+		}
+	}
+
+	if warnings > 0 {
+		fmt.Printf("\n%d warning(s)\n", warnings)
+		return 1
+	}
+	fmt.Printf("\nNo problems found\n")
+	return 0
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/deemkeen/diffwatch/internal/export"
+	"github.com/deemkeen/diffwatch/internal/store"
+)
+
+// runExport implements the "export" subcommand, rendering recorded
+// changes into a report for sharing
+func runExport(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+
+	var htmlPath, dbPath, since, until, path, title string
+	var pid int
+	var reveal bool
+
+	fs.StringVar(&htmlPath, "html", "", "")
+	fs.StringVar(&dbPath, "db", "", "")
+	fs.IntVar(&pid, "pid", 0, "")
+	fs.StringVar(&since, "since", "", "")
+	fs.StringVar(&until, "until", "", "")
+	fs.StringVar(&path, "path", "", "")
+	fs.StringVar(&title, "title", "", "")
+	fs.BoolVar(&reveal, "reveal-values", false, "")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage of %s export:\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  -html file\n")
+		fmt.Fprintf(os.Stderr, "    \tWrite a self-contained HTML report with a timeline and the diffs of every file ('-' for stdout)\n")
+		fmt.Fprintf(os.Stderr, "  -db string\n")
+		fmt.Fprintf(os.Stderr, "    \tChange database to export (default: the running daemon's)\n")
+		fmt.Fprintf(os.Stderr, "  -pid int\n")
+		fmt.Fprintf(os.Stderr, "    \tDaemon whose database to use without -db (default: the only running instance)\n")
+		fmt.Fprintf(os.Stderr, "  -since time\n")
+		fmt.Fprintf(os.Stderr, "    \tOnly changes at or after this time (e.g. 1h, 14:00, 2006-01-02 15:04) (default: all)\n")
+		fmt.Fprintf(os.Stderr, "  -until time\n")
+		fmt.Fprintf(os.Stderr, "    \tOnly changes at or before this time\n")
+		fmt.Fprintf(os.Stderr, "  -path string\n")
+		fmt.Fprintf(os.Stderr, "    \tOnly paths containing this substring\n")
+		fmt.Fprintf(os.Stderr, "  -title string\n")
+		fmt.Fprintf(os.Stderr, "    \tReport title (default: diffwatch session)\n")
+		fmt.Fprintf(os.Stderr, "  -reveal-values\n")
+		fmt.Fprintf(os.Stderr, "    \tShow the values of .env files, masked by default\n")
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if htmlPath == "" {
+		fmt.Fprintf(os.Stderr, "Error: -html is required\n")
+		fs.Usage()
+		return 2
+	}
+
+	now := time.Now()
+	filter := store.Filter{Path: path}
+
+	if since != "" {
+		t, err := parseTime(since, now)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: -since: %v\n", err)
+			return 2
+		}
+		filter.Since = t
+	}
+
+	if until != "" {
+		t, err := parseTime(until, now)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: -until: %v\n", err)
+			return 2
+		}
+		filter.Until = t
+	}
+
+	db, err := openRecorded(dbPath, pid)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	records, err := db.Events(filter)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	out := os.Stdout
+	if htmlPath != "-" {
+		out, err = os.Create(htmlPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+	}
+
+	err = export.HTML(out, records, export.Options{
+		Title: title,
+		Since: filter.Since,
+		Until: filter.Until,
+
+		RevealValues: reveal,
+	})
+	if out != os.Stdout {
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	if htmlPath != "-" {
+		fmt.Fprintf(os.Stderr, "Exported %d changes to %s\n", len(records), htmlPath)
+	}
+	return 0
+}
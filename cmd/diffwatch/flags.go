@@ -0,0 +1,17 @@
+package main
+
+import "strings"
+
+// stringList is a flag that can be given multiple times
+type stringList []string
+
+// String returns the values joined by commas
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+// Set appends a value
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/deemkeen/diffwatch/internal/pathname"
+	"github.com/deemkeen/diffwatch/internal/store"
+	"github.com/deemkeen/diffwatch/internal/ui"
+)
+
+// runHistory implements the "history" subcommand, which browses the
+// recorded changes of a path in the UI without watching anything
+func runHistory(args []string) int {
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+
+	var dbPath, since, until string
+	var pid int
+	var light, dark, ascii bool
+
+	fs.StringVar(&dbPath, "db", "", "")
+	fs.IntVar(&pid, "pid", 0, "")
+	fs.StringVar(&since, "since", "", "")
+	fs.StringVar(&until, "until", "", "")
+	fs.BoolVar(&light, "light", false, "")
+	fs.BoolVar(&dark, "dark", false, "")
+	fs.BoolVar(&ascii, "ascii", false, "")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage of %s history [flags] PATH:\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  -db string\n")
+		fmt.Fprintf(os.Stderr, "    \tChange database to browse (default: the running daemon's)\n")
+		fmt.Fprintf(os.Stderr, "  -pid int\n")
+		fmt.Fprintf(os.Stderr, "    \tDaemon whose database to use without -db (default: the only running instance)\n")
+		fmt.Fprintf(os.Stderr, "  -since time\n")
+		fmt.Fprintf(os.Stderr, "    \tOnly changes at or after this time (e.g. 1h, 14:00, 2006-01-02 15:04) (default: all)\n")
+		fmt.Fprintf(os.Stderr, "  -until time\n")
+		fmt.Fprintf(os.Stderr, "    \tOnly changes at or before this time\n")
+		fmt.Fprintf(os.Stderr, "  -light, -dark\n")
+		fmt.Fprintf(os.Stderr, "    \tUse colors for a light or dark terminal background (default: detected)\n")
+		fmt.Fprintf(os.Stderr, "  -ascii\n")
+		fmt.Fprintf(os.Stderr, "    \tDraw only ASCII, for terminals or fonts without emoji and box drawing characters\n")
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	// The path may no longer exist: it is only matched against records
+	absPath, err := filepath.Abs(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	absPath = pathname.Normalize(absPath)
+
+	now := time.Now()
+	filter := store.Filter{Path: absPath}
+
+	if since != "" {
+		t, err := parseTime(since, now)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: -since: %v\n", err)
+			return 2
+		}
+		filter.Since = t
+	}
+	if until != "" {
+		t, err := parseTime(until, now)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: -until: %v\n", err)
+			return 2
+		}
+		filter.Until = t
+	}
+
+	if dbPath == "" {
+		dbPath, err = daemonDB(pid)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v (or choose a database with -db)\n", err)
+			return 1
+		}
+	}
+	db, err := openRecorded(dbPath, pid)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	records, err := db.Events(filter)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	records = recordsUnder(records, absPath)
+	if len(records) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: no changes of %s recorded in %s\n", pathname.Display(absPath), dbPath)
+		return 1
+	}
+
+	if !light && !dark {
+		light = !lipgloss.HasDarkBackground()
+	}
+
+	browser := ui.NewHistory(records, ui.HistoryOptions{
+		Path:   absPath,
+		Source: dbPath,
+		Light:  light,
+		ASCII:  ascii,
+	})
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-sigChan
+		browser.Quit()
+	}()
+
+	if err := browser.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// recordsUnder keeps the records of path itself and, for a directory, of
+// the files below it. The database only filters by substring.
+func recordsUnder(records []store.Record, path string) []store.Record {
+	var kept []store.Record
+	for _, r := range records {
+		if r.Path == path || strings.HasPrefix(r.Path, path+string(filepath.Separator)) {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
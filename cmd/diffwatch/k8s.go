@@ -0,0 +1,177 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/deemkeen/diffwatch/internal/config"
+	"github.com/deemkeen/diffwatch/internal/generated"
+	"github.com/deemkeen/diffwatch/internal/kube"
+	"github.com/deemkeen/diffwatch/internal/rate"
+	"github.com/deemkeen/diffwatch/internal/redact"
+	"github.com/deemkeen/diffwatch/internal/severity"
+	"github.com/deemkeen/diffwatch/internal/suppress"
+	"github.com/deemkeen/diffwatch/internal/ui"
+)
+
+// runK8s implements the "k8s" subcommand, watching ConfigMaps and Secrets
+// in a cluster and showing key-by-key diffs of their changes
+func runK8s(args []string) int {
+	fs := flag.NewFlagSet("k8s", flag.ContinueOnError)
+
+	var maxHistory int
+	var digestWindow time.Duration
+	var namespace, kubeContext, configPath string
+	var reveal, light, dark, ascii bool
+
+	fs.StringVar(&namespace, "namespace", "", "")
+	fs.StringVar(&namespace, "n", "", "")
+	fs.StringVar(&kubeContext, "context", "", "")
+	fs.BoolVar(&reveal, "reveal-secrets", false, "")
+	fs.StringVar(&configPath, "config", "", "")
+	fs.StringVar(&configPath, "c", "", "")
+	fs.IntVar(&maxHistory, "max-history", 0, "")
+	fs.BoolVar(&light, "light", false, "")
+	fs.BoolVar(&dark, "dark", false, "")
+	fs.BoolVar(&ascii, "ascii", false, "")
+	fs.DurationVar(&digestWindow, "digest-window", 0, "")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage of %s k8s [flags] KIND/NAME...:\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  KIND is configmap (cm) or secret\n")
+		fmt.Fprintf(os.Stderr, "  -n, -namespace string\n")
+		fmt.Fprintf(os.Stderr, "    \tNamespace of the resources (default: the context's)\n")
+		fmt.Fprintf(os.Stderr, "  -context string\n")
+		fmt.Fprintf(os.Stderr, "    \tkubeconfig context to use (default: the current one)\n")
+		fmt.Fprintf(os.Stderr, "  -reveal-secrets\n")
+		fmt.Fprintf(os.Stderr, "    \tShow Secret values instead of their sizes and digests\n")
+		fmt.Fprintf(os.Stderr, "  -c, -config string\n")
+		fmt.Fprintf(os.Stderr, "    \tPath to config file (default: %s in the current directory or the user config dir)\n", config.FileName)
+		fmt.Fprintf(os.Stderr, "  -max-history int\n")
+		fmt.Fprintf(os.Stderr, "    \tEvent log entries kept in memory (default: 100)\n")
+		fmt.Fprintf(os.Stderr, "  -light, -dark\n")
+		fmt.Fprintf(os.Stderr, "    \tUse colors for a light or dark terminal background (default: detected)\n")
+		fmt.Fprintf(os.Stderr, "  -ascii\n")
+		fmt.Fprintf(os.Stderr, "    \tDraw only ASCII, for terminals or fonts without emoji and box drawing characters\n")
+		fmt.Fprintf(os.Stderr, "  -digest-window duration\n")
+		fmt.Fprintf(os.Stderr, "    \tTime window summarized by the digest pane ('D') (default: 15m)\n")
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	var resources []kube.Resource
+	for _, arg := range fs.Args() {
+		r, err := kube.ParseResource(arg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 2
+		}
+		resources = append(resources, r)
+	}
+
+	// The resources are in the cluster: the config is looked up locally
+	if configPath == "" {
+		configPath = config.Find(".")
+	}
+	cfg := config.Default()
+	if configPath != "" {
+		var err error
+		cfg, err = config.Load(configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+	}
+	if maxHistory > 0 {
+		cfg.MaxHistory = maxHistory
+	}
+
+	classifier, err := severity.New(cfg.Rules)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in config rules: %v\n", err)
+		return 1
+	}
+
+	suppressor, err := suppress.New(cfg.Suppress)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in config suppress rules: %v\n", err)
+		return 1
+	}
+
+	detector, err := generated.New(cfg.Generated)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in config: %v\n", err)
+		return 1
+	}
+
+	redactor, err := redact.New(cfg.Redact)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in config redact rules: %v\n", err)
+		return 1
+	}
+
+	alarms, err := rate.New(cfg.RateAlarms)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in config: %v\n", err)
+		return 1
+	}
+
+	kw, err := kube.Watch(resources, kube.Options{
+		Namespace:     namespace,
+		Context:       kubeContext,
+		RevealSecrets: reveal,
+		Ops:           cfg.Ops,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer kw.Close()
+
+	if !light && !dark {
+		light = !lipgloss.HasDarkBackground()
+	}
+
+	program := ui.New(kw, ui.Options{
+		Classifier: classifier,
+		Levels:     cfg.Levels,
+		MaxDirs:    cfg.MaxDirs,
+		MaxHistory: cfg.MaxHistory,
+		LogLines:   cfg.LogLines,
+		Suppressor: suppressor,
+		Generated:  detector,
+		Redactor:   redactor,
+		RateAlarms: alarms,
+		Config:     cfg,
+		Ops:        cfg.Ops,
+		Light:      light,
+		ASCII:      ascii,
+		NoControl:  true,
+		Digest:     digestWindow,
+	})
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-sigChan
+		program.Quit()
+	}()
+
+	if err := program.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/deemkeen/diffwatch/internal/dirs"
+)
+
+// defaultLogPath returns where logs are written unless -log is given
+func defaultLogPath() string {
+	return filepath.Join(dirs.Logs(), "diffwatch.log")
+}
+
+// openLog opens the log file at path for appending and returns a logger
+// writing structured records at or above level to it, for modes whose
+// terminal belongs to the UI.
+func openLog(path string, level slog.Level) (*slog.Logger, *os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, nil, fmt.Errorf("creating log directory: %w", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, nil, fmt.Errorf("opening log file: %w", err)
+	}
+
+	logger := slog.New(slog.NewTextHandler(f, &slog.HandlerOptions{Level: level}))
+	return logger, f, nil
+}
@@ -1,54 +1,201 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"log/slog"
 	"os"
 	"os/signal"
+	"path"
+	"slices"
+	"strings"
 	"syscall"
 
+	"github.com/charmbracelet/lipgloss"
+	"github.com/deemkeen/diffwatch/internal/attrib"
+	"github.com/deemkeen/diffwatch/internal/config"
+	_ "github.com/deemkeen/diffwatch/internal/container" // docker backend
+	"github.com/deemkeen/diffwatch/internal/diff"
+	"github.com/deemkeen/diffwatch/internal/dirs"
+	"github.com/deemkeen/diffwatch/internal/extdiff"
+	"github.com/deemkeen/diffwatch/internal/generated"
+	"github.com/deemkeen/diffwatch/internal/git"
+	"github.com/deemkeen/diffwatch/internal/migration"
+	"github.com/deemkeen/diffwatch/internal/plugin"
+	"github.com/deemkeen/diffwatch/internal/protect"
+	"github.com/deemkeen/diffwatch/internal/rate"
+	"github.com/deemkeen/diffwatch/internal/redact"
+	_ "github.com/deemkeen/diffwatch/internal/s3" // s3 backend
+	"github.com/deemkeen/diffwatch/internal/severity"
+	"github.com/deemkeen/diffwatch/internal/share"
+	"github.com/deemkeen/diffwatch/internal/state"
+	"github.com/deemkeen/diffwatch/internal/store"
+	"github.com/deemkeen/diffwatch/internal/suppress"
 	"github.com/deemkeen/diffwatch/internal/ui"
 	"github.com/deemkeen/diffwatch/internal/watcher"
 )
 
 func main() {
-	// Parse command line arguments
-	var watchPath string
-	var recursive bool
-
-	flag.StringVar(&watchPath, "path", ".", "")
-	flag.StringVar(&watchPath, "p", ".", "")
+	// Dispatch subcommands
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "query":
+			os.Exit(runQuery(os.Args[2:]))
+		case "report":
+			os.Exit(runReport(os.Args[2:]))
+		case "export":
+			os.Exit(runExport(os.Args[2:]))
+		case "ctl":
+			os.Exit(runCtl(os.Args[2:]))
+		case "daemon":
+			os.Exit(runDaemon(os.Args[2:]))
+		case "attach":
+			os.Exit(runAttach(os.Args[2:]))
+		case "doctor":
+			os.Exit(runDoctor(os.Args[2:]))
+		case "connect":
+			os.Exit(runConnect(os.Args[2:]))
+		case "history":
+			os.Exit(runHistory(os.Args[2:]))
+		case "k8s":
+			os.Exit(runK8s(os.Args[2:]))
+		case "view":
+			os.Exit(runView(os.Args[2:]))
+		case "await":
+			os.Exit(runAwait(os.Args[2:]))
+		case "clean":
+			os.Exit(runClean(os.Args[2:]))
+		}
+	}
 
-	flag.BoolVar(&recursive, "recursive", false, "")
-	flag.BoolVar(&recursive, "r", false, "")
+	// Parse command line arguments
+	var opts options
+	opts.register(flag.CommandLine)
 
 	// Custom usage function
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage of %s:\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "  -p, -path string\n")
-		fmt.Fprintf(os.Stderr, "    \tPath to watch for changes (default: current directory)\n")
-		fmt.Fprintf(os.Stderr, "  -r, -recursive\n")
-		fmt.Fprintf(os.Stderr, "    \tWatch all subdirectories recursively\n")
+		fmt.Fprintf(os.Stderr, "  %s [flags]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -tab NAME=PATH -tab NAME=PATH... [flags]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s query -db FILE [flags]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s report [-db FILE] [-since TIME]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s export -html FILE [-db FILE] [-since TIME]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s history [-db FILE] [-since TIME] PATH\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s ctl add|remove|list [PATH]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s daemon start|stop|status [flags]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s attach [-pid PID]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s connect [-token TOKEN] HOST:PORT\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s k8s [-namespace NS] KIND/NAME...\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s view [FILE.patch]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s await [-r] [-timeout DURATION] PATH\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s clean [-older-than AGE] [-n]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s doctor [-p PATH] [-r]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Flags:\n")
+		printFlags(os.Stderr)
 	}
 
 	flag.Parse()
 
-	// Validate path
-	if _, err := os.Stat(watchPath); os.IsNotExist(err) {
-		fmt.Fprintf(os.Stderr, "Error: path does not exist: %s\n", watchPath)
-		os.Exit(1)
+	// Open change database
+	var db *store.DB
+	var err error
+	if opts.dbPath != "" {
+		db, err = store.Open(opts.dbPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		defer db.Close()
 	}
 
-	// Create file watcher
-	fw, err := watcher.New(watchPath, recursive)
+	// Set up logging; -a11y prints to stdout, leaving stderr to the log
+	logger, logFile, err := opts.openLogger(opts.a11y)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error creating watcher: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
-	defer fw.Close()
+	if logFile != nil {
+		defer logFile.Close()
+	}
+
+	// With stdout redirected, e.g. to save the diff printed by -until, the
+	// screen is drawn on the terminal of stderr. -a11y prints no screen.
+	screen := os.Stdout
+	if !opts.a11y && !isTerminal(os.Stdout) && isTerminal(os.Stderr) {
+		screen = os.Stderr
+		lipgloss.SetDefaultRenderer(lipgloss.NewRenderer(screen))
+	}
+
+	// Pick colors for the terminal background unless forced
+	light := opts.light
+	if !opts.light && !opts.dark && !opts.a11y {
+		light = !lipgloss.HasDarkBackground()
+	}
 
-	// Create UI
-	program := ui.New(fw)
+	// Create UI: one session, or one tab per -tab
+	var program interface {
+		Start() error
+		Quit()
+	}
+	var names []string
+	var models []*ui.Model
+	if len(opts.tabs) == 0 {
+		src, uiOpts, err := newSession(&opts, db, logger, light)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		defer src.Close()
+		defer uiOpts.Attributor.Close()
+
+		if opts.share != "" {
+			srv, err := shareSession(src, opts.share, opts.shareToken)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			defer srv.Close()
+			uiOpts.Share = srv
+		}
+		uiOpts.Output = screen
+		models = append(models, ui.New(src, uiOpts))
+		program = models[0]
+	} else {
+		if opts.share != "" {
+			fmt.Fprintf(os.Stderr, "Error: -share can't be combined with -tab\n")
+			os.Exit(2)
+		}
+		if opts.container != "" || opts.s3 != "" {
+			fmt.Fprintf(os.Stderr, "Error: -container and -s3 can't be combined with -tab\n")
+			os.Exit(2)
+		}
+		if opts.a11y {
+			fmt.Fprintf(os.Stderr, "Error: -a11y can't be combined with -tab\n")
+			os.Exit(2)
+		}
+
+		for i, tab := range opts.tabs {
+			name, path := parseTab(tab)
+
+			tabOpts := opts
+			tabOpts.watchPath = path
+			fw, uiOpts, err := newSession(&tabOpts, db, logger, light)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: tab %s: %v\n", name, err)
+				os.Exit(1)
+			}
+			defer fw.Close()
+			defer uiOpts.Attributor.Close()
+
+			// "diffwatch ctl" changes the first tab
+			uiOpts.NoControl = i > 0
+			uiOpts.Output = screen
+			names = append(names, name)
+			models = append(models, ui.New(fw, uiOpts))
+		}
+		program = ui.NewTabs(names, models)
+	}
 
 	// Handle graceful shutdown
 	sigChan := make(chan os.Signal, 1)
@@ -64,4 +211,226 @@ func main() {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
+
+	// Latency measured with -bench is summarized once the screen is gone
+	for i, m := range models {
+		if report := m.BenchReport(); report != "" {
+			if len(names) > 0 {
+				fmt.Printf("%s: ", names[i])
+			}
+			fmt.Print(report)
+		}
+	}
+
+	if opts.until != "" || opts.timeout > 0 {
+		os.Exit(untilStatus(models, opts.until != ""))
+	}
+}
+
+// newSession creates the watcher and UI options of a watch session of
+// opts. Sessions share the change database and logger.
+func newSession(opts *options, db *store.DB, logger *slog.Logger, light bool) (watcher.Backend, ui.Options, error) {
+	cfg, err := opts.loadConfig()
+	if err != nil {
+		return nil, ui.Options{}, err
+	}
+
+	classifier, err := severity.New(cfg.Rules)
+	if err != nil {
+		return nil, ui.Options{}, fmt.Errorf("config rules: %w", err)
+	}
+
+	// Auto-commit requires a git repository
+	var gitRoot string
+	if opts.autoCommit {
+		gitRoot, err = git.Root(opts.watchPath)
+		if err != nil {
+			return nil, ui.Options{}, fmt.Errorf("-auto-commit: %w", err)
+		}
+	}
+
+	suppressor, err := suppress.New(cfg.Suppress)
+	if err != nil {
+		return nil, ui.Options{}, fmt.Errorf("config suppress rules: %w", err)
+	}
+
+	redactor, err := redact.New(cfg.Redact)
+	if err != nil {
+		return nil, ui.Options{}, fmt.Errorf("config redact rules: %w", err)
+	}
+
+	detector, err := generated.New(cfg.Generated)
+	if err != nil {
+		return nil, ui.Options{}, fmt.Errorf("config: %w", err)
+	}
+
+	migrations, err := migration.New(opts.watchPath, cfg.Migrations)
+	if err != nil {
+		return nil, ui.Options{}, fmt.Errorf("config: %w", err)
+	}
+
+	algorithm, err := diff.ParseAlgorithm(opts.algorithm)
+	if err != nil {
+		return nil, ui.Options{}, fmt.Errorf("-algorithm: %w", err)
+	}
+
+	plugins, err := plugin.New(cfg.Plugins)
+	if err != nil {
+		return nil, ui.Options{}, fmt.Errorf("config: %w", err)
+	}
+
+	differs, err := extdiff.New(cfg.Differs)
+	if err != nil {
+		return nil, ui.Options{}, fmt.Errorf("config: %w", err)
+	}
+
+	alarms, err := rate.New(cfg.RateAlarms)
+	if err != nil {
+		return nil, ui.Options{}, fmt.Errorf("config: %w", err)
+	}
+
+	filter, err := attrib.ParseFilter(opts.byPID, opts.byProcess)
+	if err != nil {
+		return nil, ui.Options{}, fmt.Errorf("-by-pid/-by-process: %w", err)
+	}
+
+	if _, err := path.Match(opts.until, ""); err != nil {
+		return nil, ui.Options{}, fmt.Errorf("-until: %w", err)
+	}
+	notifyHours, recordHours, err := schedules(cfg)
+	if err != nil {
+		return nil, ui.Options{}, err
+	}
+
+	for _, glob := range slices.Concat(cfg.Include, cfg.Exclude) {
+		if _, err := path.Match(glob, ""); err != nil {
+			return nil, ui.Options{}, fmt.Errorf("config include/exclude %q: %w", glob, err)
+		}
+	}
+
+	src, err := newSource(opts, cfg, logger)
+	if err != nil {
+		return nil, ui.Options{}, err
+	}
+
+	// Processes can only be seen changing local files
+	var attributor *attrib.Attributor
+	if opts.who || filter != nil {
+		backend, path, _ := opts.source()
+		if !watcher.IsLocal(backend, path) {
+			src.Close()
+			return nil, ui.Options{}, errors.New("-who needs a local backend")
+		}
+		attributor, err = attrib.New(src.Roots(), logger)
+		if err != nil {
+			src.Close()
+			return nil, ui.Options{}, fmt.Errorf("-who: %w", err)
+		}
+		if logger != nil {
+			logger.Info("attributing changes", "method", attributor.Method())
+		}
+	}
+
+	return src, ui.Options{
+		Classifier: classifier,
+		Levels:     cfg.Levels,
+		Store:      db,
+		MaxDirs:    cfg.MaxDirs,
+		MaxHistory: cfg.MaxHistory,
+		LogLines:   cfg.LogLines,
+		Limits: state.Limits{
+			MaxFiles: cfg.MaxTrackedFiles,
+			MaxBytes: cfg.MaxTotalBytes,
+		},
+		DiffCache: diff.CacheLimits{
+			MaxEntries: cfg.DiffCacheEntries,
+			MaxBytes:   cfg.DiffCacheBytes,
+		},
+		AutoCommit:    opts.autoCommit,
+		GitRoot:       gitRoot,
+		Guard:         protect.New(cfg.Protect, cfg.ProtectRestore, dirs.Patches()),
+		Suppressor:    suppressor,
+		Generated:     detector,
+		Migrations:    migrations,
+		Algorithm:     algorithm,
+		DocumentText:  cfg.DocumentText,
+		Redactor:      redactor,
+		Plugins:       plugins,
+		Differs:       differs,
+		Attributor:    attributor,
+		ProcessFilter: filter,
+		Ops:           cfg.Ops,
+		Prescan:       opts.prescan,
+		Lazy:          opts.lazy,
+		Light:         light,
+		Logger:        logger,
+		Digest:        opts.digestWindow,
+		Bench:         opts.bench,
+		Until:         opts.until,
+		Timeout:       opts.timeout,
+		RateAlarms:    alarms,
+		NotifyHours:   notifyHours,
+		RecordHours:   recordHours,
+		Config:        cfg,
+		ConfigPath:    opts.configPath,
+		Include:       cfg.Include,
+		Exclude:       cfg.Exclude,
+		WatchDirs:     cfg.WatchDirs,
+		A11y:          opts.a11y,
+		ASCII:         opts.ascii,
+	}, nil
+}
+
+// newSource opens the backend of a session: the local file system by
+// default, or the one chosen with -backend or its shortcuts
+func newSource(opts *options, cfg *config.Config, logger *slog.Logger) (watcher.Backend, error) {
+	backend, path, err := opts.source()
+	if err != nil {
+		return nil, err
+	}
+	// Files elsewhere can't be committed, restored or read locally
+	if !watcher.IsLocal(backend, path) && (opts.autoCommit || opts.prescan || cfg.ProtectRestore) {
+		return nil, errors.New("-auto-commit, -prescan and -protect-restore need a local backend")
+	}
+	if logger != nil {
+		logger.Info("starting", "path", path, "backend", backend, "recursive", opts.recursive)
+	}
+
+	debounce, err := watcher.ParseDebounce(cfg.Debounce)
+	if err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+
+	src, err := watcher.Open(backend, path, opts.recursive, watcher.Options{
+		Ops:         cfg.Ops,
+		IgnoreFiles: cfg.IgnoreFiles,
+		Debounce:    debounce,
+		Logger:      logger,
+		Interval:    opts.pollInterval,
+		WaitRoot:    opts.waitRoot,
+		WatchDirs:   cfg.WatchDirs,
+		WatchDepth:  cfg.WatchDepth,
+		Endpoint:    opts.s3Endpoint,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating watcher: %w", err)
+	}
+	return src, nil
+}
+
+// shareSession lets viewers connect to the session of fw on addr
+func shareSession(fw ui.Source, addr, token string) (*share.Server, error) {
+	return share.Listen(addr, token, func() share.Message {
+		stats := fw.Stats()
+		return share.Message{Roots: fw.Roots(), Recursive: fw.IsRecursive(), Stats: &stats}
+	})
+}
+
+// parseTab splits a -tab value of the form [NAME=]PATH. The name defaults
+// to the path.
+func parseTab(value string) (name, path string) {
+	if name, path, ok := strings.Cut(value, "="); ok && name != "" {
+		return name, path
+	}
+	return value, value
 }
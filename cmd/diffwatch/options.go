@@ -0,0 +1,399 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deemkeen/diffwatch/internal/config"
+	"github.com/deemkeen/diffwatch/internal/diff"
+	"github.com/deemkeen/diffwatch/internal/schedule"
+	"github.com/deemkeen/diffwatch/internal/watcher"
+)
+
+// blankLine matches lines that are empty or only hold whitespace, for
+// -ignore-blank-lines
+const blankLine = `^\s*$`
+
+// options holds the flags of a watch session, shared by the interactive
+// UI and the daemon
+type options struct {
+	watchPath       string
+	recursive       bool
+	configPath      string
+	dbPath          string
+	maxDirs         int
+	watchDepth      int
+	maxHistory      int
+	logLines        int
+	maxTrackedFiles int
+	maxTotalBytes   string
+	autoCommit      bool
+	protectPaths    stringList
+	protectRestore  bool
+	prescan         bool
+	lazy            bool
+	ops             string
+	light, dark     bool
+	a11y            bool
+	ascii           bool
+	verbose, debug  bool
+	logPath         string
+	digestWindow    time.Duration
+	tabs            stringList
+	share           string
+	shareToken      string
+	backend         string
+	who             bool
+	byPID           stringList
+	byProcess       stringList
+	container       string
+	pollInterval    time.Duration
+	waitRoot        bool
+	s3              string
+	s3Endpoint      string
+	bench           bool
+	until           string
+	alarmFiles      string
+	alarmChanges    string
+	timeout         time.Duration
+	algorithm       string
+	ignoreBlank     bool
+	bell            string
+	bellSound       string
+}
+
+// register defines the flags on fs
+func (o *options) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.watchPath, "path", ".", "")
+	fs.StringVar(&o.watchPath, "p", ".", "")
+
+	fs.BoolVar(&o.recursive, "recursive", false, "")
+	fs.BoolVar(&o.recursive, "r", false, "")
+
+	fs.StringVar(&o.configPath, "config", "", "")
+	fs.StringVar(&o.configPath, "c", "", "")
+
+	fs.StringVar(&o.dbPath, "db", "", "")
+
+	fs.IntVar(&o.maxDirs, "max-dirs", 0, "")
+	fs.IntVar(&o.watchDepth, "watch-depth", 0, "")
+	fs.IntVar(&o.maxHistory, "max-history", 0, "")
+	fs.IntVar(&o.logLines, "log-lines", 0, "")
+	fs.IntVar(&o.maxTrackedFiles, "max-tracked-files", 0, "")
+	fs.StringVar(&o.maxTotalBytes, "max-total-bytes", "", "")
+
+	fs.BoolVar(&o.autoCommit, "auto-commit", false, "")
+
+	fs.Var(&o.protectPaths, "protect", "")
+	fs.BoolVar(&o.protectRestore, "protect-restore", false, "")
+
+	fs.BoolVar(&o.prescan, "prescan", false, "")
+	fs.BoolVar(&o.lazy, "lazy", false, "")
+
+	fs.StringVar(&o.ops, "ops", "", "")
+
+	fs.BoolVar(&o.light, "light", false, "")
+	fs.BoolVar(&o.dark, "dark", false, "")
+	fs.BoolVar(&o.a11y, "a11y", false, "")
+	fs.BoolVar(&o.ascii, "ascii", false, "")
+
+	fs.BoolVar(&o.verbose, "verbose", false, "")
+	fs.BoolVar(&o.debug, "debug", false, "")
+	fs.StringVar(&o.logPath, "log", "", "")
+
+	fs.DurationVar(&o.digestWindow, "digest-window", 0, "")
+
+	fs.Var(&o.tabs, "tab", "")
+
+	fs.StringVar(&o.share, "share", "", "")
+	fs.StringVar(&o.shareToken, "share-token", "", "")
+
+	fs.StringVar(&o.backend, "backend", "", "")
+	fs.BoolVar(&o.who, "who", false, "")
+	fs.Var(&o.byPID, "by-pid", "")
+	fs.Var(&o.byProcess, "by-process", "")
+	fs.StringVar(&o.container, "container", "", "")
+	fs.DurationVar(&o.pollInterval, "poll-interval", 0, "")
+	fs.BoolVar(&o.waitRoot, "wait-root", false, "")
+	fs.StringVar(&o.s3, "s3", "", "")
+	fs.StringVar(&o.s3Endpoint, "s3-endpoint", "", "")
+	fs.BoolVar(&o.bench, "bench", false, "")
+	fs.StringVar(&o.until, "until", "", "")
+	fs.DurationVar(&o.timeout, "timeout", 0, "")
+	fs.StringVar(&o.alarmFiles, "alarm-files", "", "")
+	fs.StringVar(&o.alarmChanges, "alarm-changes", "", "")
+	fs.StringVar(&o.algorithm, "algorithm", "", "")
+	fs.BoolVar(&o.ignoreBlank, "ignore-blank-lines", false, "")
+	fs.StringVar(&o.bell, "bell", "", "")
+	fs.StringVar(&o.bellSound, "bell-sound", "", "")
+}
+
+// printFlags prints the descriptions of the flags defined by register
+func printFlags(w io.Writer) {
+	fmt.Fprintf(w, "  -p, -path string\n")
+	fmt.Fprintf(w, "    \tPath to watch for changes (default: current directory)\n")
+	fmt.Fprintf(w, "  -r, -recursive\n")
+	fmt.Fprintf(w, "    \tWatch all subdirectories recursively\n")
+	fmt.Fprintf(w, "  -c, -config string\n")
+	fmt.Fprintf(w, "    \tPath to config file (default: %s in watched path, then user config dir)\n", config.FileName)
+	fmt.Fprintf(w, "  -db string\n")
+	fmt.Fprintf(w, "    \tRecord every event, snapshot hash, diff stats and diff in a SQLite database\n")
+	fmt.Fprintf(w, "  -max-dirs int\n")
+	fmt.Fprintf(w, "    \tWarn when more directories are watched (default: 10000, 0 in config disables)\n")
+	fmt.Fprintf(w, "  -watch-depth int\n")
+	fmt.Fprintf(w, "    \tWith -r, watch this many directory levels right away, deeper ones on nearby changes and then in the background (default: all)\n")
+	fmt.Fprintf(w, "  -max-history int\n")
+	fmt.Fprintf(w, "    \tEvent log entries and their diffs kept in memory (default: 100)\n")
+	fmt.Fprintf(w, "  -log-lines int\n")
+	fmt.Fprintf(w, "    \tEvent log entries shown above the diff; 'L' shows all kept entries (default: 5)\n")
+	fmt.Fprintf(w, "  -max-tracked-files int\n")
+	fmt.Fprintf(w, "    \tFiles whose contents are kept for diffing, least recently changed are evicted (default: unlimited)\n")
+	fmt.Fprintf(w, "  -max-total-bytes size\n")
+	fmt.Fprintf(w, "    \tTotal size of kept file contents, e.g. 512MB (default: unlimited)\n")
+	fmt.Fprintf(w, "  -auto-commit\n")
+	fmt.Fprintf(w, "    \tCommit every change to git with a generated message (git repositories only)\n")
+	fmt.Fprintf(w, "  -protect pattern\n")
+	fmt.Fprintf(w, "    \tAlert on changes to paths matching the glob (repeatable, e.g. 'config/prod/**')\n")
+	fmt.Fprintf(w, "  -protect-restore\n")
+	fmt.Fprintf(w, "    \tRevert changes to protected paths, saving them as patches\n")
+	fmt.Fprintf(w, "  -prescan\n")
+	fmt.Fprintf(w, "    \tSnapshot all files at startup so the first change to a file shows a proper diff\n")
+	fmt.Fprintf(w, "  -lazy\n")
+	fmt.Fprintf(w, "    \tOnly hash changed files while the digest, heatmap or full log covers the diff; read and diff them once shown\n")
+	fmt.Fprintf(w, "  -ops list\n")
+	fmt.Fprintf(w, "    \tOnly report these operations, comma-separated (create, write, remove, rename, chmod)\n")
+	fmt.Fprintf(w, "  -light, -dark\n")
+	fmt.Fprintf(w, "    \tUse colors for a light or dark terminal background (default: detected)\n")
+	fmt.Fprintf(w, "  -ascii\n")
+	fmt.Fprintf(w, "    \tDraw only ASCII, for terminals or fonts without emoji and box drawing characters\n")
+	fmt.Fprintf(w, "  -a11y\n")
+	fmt.Fprintf(w, "    \tPrint changes as plain lines for screen readers and braille displays instead of drawing the screen\n")
+	fmt.Fprintf(w, "  -verbose\n")
+	fmt.Fprintf(w, "    \tLog watcher activity, dropped events and read errors\n")
+	fmt.Fprintf(w, "  -debug\n")
+	fmt.Fprintf(w, "    \tAlso log every raw event and filtering or debounce decision\n")
+	fmt.Fprintf(w, "  -log file\n")
+	fmt.Fprintf(w, "    \tLog file for -verbose and -debug (default: %s)\n", defaultLogPath())
+	fmt.Fprintf(w, "  -digest-window duration\n")
+	fmt.Fprintf(w, "    \tTime window summarized by the digest pane ('D') (default: 15m)\n")
+	fmt.Fprintf(w, "  -tab [name=]path\n")
+	fmt.Fprintf(w, "    \tWatch path in its own tab with its own config (repeatable, replaces -path)\n")
+	fmt.Fprintf(w, "  -share address\n")
+	fmt.Fprintf(w, "    \tLet other instances mirror the session read-only with 'connect', e.g. :9000\n")
+	fmt.Fprintf(w, "  -share-token string\n")
+	fmt.Fprintf(w, "    \tSecret viewers must pass to 'connect -token' (default: none)\n")
+	fmt.Fprintf(w, "  -backend name\n")
+	fmt.Fprintf(w, "    \tHow to watch the path: %s (default: the platform's event API, s3 for s3:// paths)\n", strings.Join(watcher.Backends(), ", "))
+	fmt.Fprintf(w, "  -who\n")
+	fmt.Fprintf(w, "    \tShow the process that made each change (Linux; fanotify as root, else processes holding the file open)\n")
+	fmt.Fprintf(w, "  -by-pid [!]pid\n")
+	fmt.Fprintf(w, "    \tOnly show changes made by the process, or hide them with '!' (repeatable, implies -who)\n")
+	fmt.Fprintf(w, "  -by-process [!]name\n")
+	fmt.Fprintf(w, "    \tOnly show changes made by processes of that name, or hide them with '!' (repeatable, implies -who)\n")
+	fmt.Fprintf(w, "  -container name:/path\n")
+	fmt.Fprintf(w, "    \tWatch a directory inside a running Docker container by polling it (replaces -path)\n")
+	fmt.Fprintf(w, "  -poll-interval duration\n")
+	fmt.Fprintf(w, "    \tHow often the poll, docker and s3 backends list the files (default: 2s, 10s for buckets)\n")
+	fmt.Fprintf(w, "  -wait-root\n")
+	fmt.Fprintf(w, "    \tWhen a watched path is deleted or moved away, wait for it to reappear and watch it again\n")
+	fmt.Fprintf(w, "  -s3 s3://bucket/prefix\n")
+	fmt.Fprintf(w, "    \tWatch the objects below a prefix of an S3 bucket by polling it (replaces -path)\n")
+	fmt.Fprintf(w, "  -s3-endpoint url\n")
+	fmt.Fprintf(w, "    \tS3-compatible endpoint for -s3, e.g. http://localhost:9000 for MinIO (default: AWS)\n")
+	fmt.Fprintf(w, "  -bench\n")
+	fmt.Fprintf(w, "    \tMeasure the latency from file event to rendered diff by stage, shown live and summarized on exit\n")
+	fmt.Fprintf(w, "  -until pattern\n")
+	fmt.Fprintf(w, "    \tQuit once a file matching the glob changes and print its diff (exit status 0)\n")
+	fmt.Fprintf(w, "  -timeout duration\n")
+	fmt.Fprintf(w, "    \tQuit once this much time has passed, e.g. 5m (exit status %d)\n", exitTimeout)
+	fmt.Fprintf(w, "  -alarm-files count/window\n")
+	fmt.Fprintf(w, "    \tAlarm when more files change within the window, e.g. 100/10s\n")
+	fmt.Fprintf(w, "  -alarm-changes count/window\n")
+	fmt.Fprintf(w, "    \tAlarm when a file changes more often within the window, e.g. 5/1m\n")
+	fmt.Fprintf(w, "  -bell pattern\n")
+	fmt.Fprintf(w, "    \tRing the terminal bell when a file matching the glob changes, e.g. '*' for every change\n")
+	fmt.Fprintf(w, "  -bell-sound file\n")
+	fmt.Fprintf(w, "    \tPlay the sound file instead of ringing the bell for -bell\n")
+	fmt.Fprintf(w, "  -ignore-blank-lines\n")
+	fmt.Fprintf(w, "    \tSuppress changes that only add or remove blank lines, like a formatter's\n")
+	fmt.Fprintf(w, "  -algorithm name\n")
+	fmt.Fprintf(w, "    \tHow lines are matched between versions: %s (default: histogram for code, patience for Markdown, myers otherwise)\n", strings.Join(algorithmNames(), ", "))
+}
+
+// algorithmNames returns the names of the diff algorithms
+func algorithmNames() []string {
+	names := make([]string, len(diff.Algorithms))
+	for i, alg := range diff.Algorithms {
+		names[i] = string(alg)
+	}
+	return names
+}
+
+// source returns the backend and path of the watch. -container and -s3
+// are shortcuts for their backends.
+func (o *options) source() (backend, path string, err error) {
+	switch {
+	case o.container != "" && o.s3 != "", o.backend != "" && (o.container != "" || o.s3 != ""):
+		return "", "", errors.New("-backend, -container and -s3 can't be combined")
+	case o.container != "":
+		return "docker", o.container, nil
+	case o.s3 != "":
+		return "s3", o.s3, nil
+	}
+	return o.backend, o.watchPath, nil
+}
+
+// schedules parses when notifications fire and when changes are recorded
+func schedules(cfg *config.Config) (notifyHours, recordHours *schedule.Schedule, err error) {
+	if notifyHours, err = schedule.Parse(cfg.Schedule.Notify); err != nil {
+		return nil, nil, fmt.Errorf("config schedule.notify: %w", err)
+	}
+	if recordHours, err = schedule.Parse(cfg.Schedule.Record); err != nil {
+		return nil, nil, fmt.Errorf("config schedule.record: %w", err)
+	}
+	return notifyHours, recordHours, nil
+}
+
+// loadConfig validates the watch path, loads the config file and applies
+// the flag overrides. The config of a watch outside the local file system
+// is looked up in the current directory.
+func (o *options) loadConfig() (*config.Config, error) {
+	backend, path, err := o.source()
+	if err != nil {
+		return nil, err
+	}
+	if !watcher.IsLocal(backend, path) {
+		path = "."
+	} else if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, fmt.Errorf("path does not exist: %s", path)
+	}
+
+	configPath := o.configPath
+	if configPath == "" {
+		// Also where the filter editor saves to
+		configPath = config.Find(path)
+		o.configPath = configPath
+	}
+	cfg := config.Default()
+	if configPath != "" {
+		loaded, err := config.Load(configPath)
+		if err != nil {
+			return nil, err
+		}
+		cfg = loaded
+	}
+
+	if o.maxDirs > 0 {
+		cfg.MaxDirs = o.maxDirs
+	}
+	if o.watchDepth > 0 {
+		cfg.WatchDepth = o.watchDepth
+	}
+	if o.maxHistory > 0 {
+		cfg.MaxHistory = o.maxHistory
+	}
+	if o.logLines > 0 {
+		cfg.LogLines = o.logLines
+	}
+	if o.maxTrackedFiles > 0 {
+		cfg.MaxTrackedFiles = o.maxTrackedFiles
+	}
+	if o.maxTotalBytes != "" {
+		n, err := parseSize(o.maxTotalBytes)
+		if err != nil {
+			return nil, fmt.Errorf("-max-total-bytes: %w", err)
+		}
+		cfg.MaxTotalBytes = n
+	}
+
+	if o.alarmFiles != "" {
+		count, window, err := parseRate(o.alarmFiles)
+		if err != nil {
+			return nil, fmt.Errorf("-alarm-files: %w", err)
+		}
+		cfg.RateAlarms = append(cfg.RateAlarms, config.RateAlarm{Files: count, Window: window})
+	}
+	if o.alarmChanges != "" {
+		count, window, err := parseRate(o.alarmChanges)
+		if err != nil {
+			return nil, fmt.Errorf("-alarm-changes: %w", err)
+		}
+		cfg.RateAlarms = append(cfg.RateAlarms, config.RateAlarm{Changes: count, Window: window})
+	}
+
+	if o.ops != "" {
+		cfg.Ops = strings.Split(o.ops, ",")
+	}
+	parsedOps, err := watcher.ParseOps(strings.Join(cfg.Ops, ","))
+	if err != nil {
+		return nil, fmt.Errorf("invalid ops: %w", err)
+	}
+	cfg.Ops = parsedOps
+
+	if o.ignoreBlank {
+		cfg.Suppress = append(cfg.Suppress, config.SuppressRule{Ignore: []string{blankLine}})
+	}
+
+	if o.bellSound != "" && o.bell == "" {
+		return nil, errors.New("-bell-sound needs -bell")
+	}
+	if o.bell != "" {
+		cfg.Rules = append(cfg.Rules, config.Rule{Pattern: o.bell, Bell: true, Sound: o.bellSound})
+	}
+
+	cfg.Protect = append(cfg.Protect, o.protectPaths...)
+	if o.protectRestore {
+		cfg.ProtectRestore = true
+	}
+
+	return cfg, nil
+}
+
+// openLogger opens the log for -verbose, -debug and -log. Modes that draw
+// no screen (plain) log to stderr unless -log names a file, the others to
+// the default log file. Returns a nil logger if logging is disabled, and
+// a nil closer unless a file was opened.
+func (o *options) openLogger(plain bool) (*slog.Logger, io.Closer, error) {
+	if !o.verbose && !o.debug && o.logPath == "" {
+		return nil, nil, nil
+	}
+
+	level := slog.LevelInfo
+	if o.debug {
+		level = slog.LevelDebug
+	}
+	if plain && o.logPath == "" {
+		return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})), nil, nil
+	}
+	path := o.logPath
+	if path == "" {
+		path = defaultLogPath()
+	}
+
+	logger, f, err := openLog(path, level)
+	if err != nil {
+		return nil, nil, err
+	}
+	return logger, f, nil
+}
+
+// parseRate parses a rate alarm limit like "100/10s" into its count and
+// window
+func parseRate(s string) (count int, window string, err error) {
+	n, window, ok := strings.Cut(s, "/")
+	count, err = strconv.Atoi(n)
+	if !ok || err != nil || count <= 0 {
+		return 0, "", fmt.Errorf("invalid limit %q, want count/window like 100/10s", s)
+	}
+	if d, err := time.ParseDuration(window); err != nil || d <= 0 {
+		return 0, "", fmt.Errorf("invalid window %q", window)
+	}
+	return count, window, nil
+}
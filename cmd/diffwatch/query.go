@@ -0,0 +1,118 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/deemkeen/diffwatch/internal/pathname"
+	"github.com/deemkeen/diffwatch/internal/store"
+)
+
+// runQuery implements the "query" subcommand, answering questions about
+// recorded changes in a change database
+func runQuery(args []string) int {
+	fs := flag.NewFlagSet("query", flag.ContinueOnError)
+
+	var dbPath, since, until, path, op string
+	var listEvents bool
+
+	fs.StringVar(&dbPath, "db", "", "")
+	fs.StringVar(&since, "since", "", "")
+	fs.StringVar(&until, "until", "", "")
+	fs.StringVar(&path, "path", "", "")
+	fs.StringVar(&op, "op", "", "")
+	fs.BoolVar(&listEvents, "events", false, "")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage of %s query:\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  -db string\n")
+		fmt.Fprintf(os.Stderr, "    \tChange database to query (required)\n")
+		fmt.Fprintf(os.Stderr, "  -since time\n")
+		fmt.Fprintf(os.Stderr, "    \tOnly changes at or after time (e.g. 14:00, 1h, 2006-01-02 15:04)\n")
+		fmt.Fprintf(os.Stderr, "  -until time\n")
+		fmt.Fprintf(os.Stderr, "    \tOnly changes at or before time\n")
+		fmt.Fprintf(os.Stderr, "  -path string\n")
+		fmt.Fprintf(os.Stderr, "    \tOnly paths containing this substring\n")
+		fmt.Fprintf(os.Stderr, "  -op string\n")
+		fmt.Fprintf(os.Stderr, "    \tOnly events of this operation (create, write, remove, rename, chmod)\n")
+		fmt.Fprintf(os.Stderr, "  -events\n")
+		fmt.Fprintf(os.Stderr, "    \tList individual events instead of a per-file summary\n")
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if dbPath == "" {
+		fmt.Fprintf(os.Stderr, "Error: -db is required\n")
+		fs.Usage()
+		return 2
+	}
+
+	filter := store.Filter{Path: path, Op: op}
+	now := time.Now()
+
+	if since != "" {
+		t, err := parseTime(since, now)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: -since: %v\n", err)
+			return 2
+		}
+		filter.Since = t
+	}
+	if until != "" {
+		t, err := parseTime(until, now)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: -until: %v\n", err)
+			return 2
+		}
+		filter.Until = t
+	}
+
+	if _, err := os.Stat(dbPath); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	db, err := store.Open(dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	if listEvents {
+		records, err := db.Events(filter)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		for _, r := range records {
+			// Events recorded by older versions have no sequence number
+			seq := "-"
+			if r.Seq > 0 {
+				seq = fmt.Sprintf("#%d", r.Seq)
+			}
+			fmt.Printf("%s  %7s  %-6s  %-8s  +%d -%d  %s\n",
+				r.Time.Format("2006-01-02 15:04:05"), seq, r.Op, r.Level, r.Added, r.Deleted, pathname.Display(r.Path))
+			if r.Note != "" {
+				fmt.Printf("    note: %s\n", pathname.Display(r.Note))
+			}
+		}
+		return 0
+	}
+
+	summaries, err := db.Files(filter)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	for _, s := range summaries {
+		fmt.Printf("%s - %s  %3d changes  +%d -%d  %s\n",
+			s.First.Format("15:04:05"), s.Last.Format("15:04:05"),
+			s.Changes, s.Added, s.Deleted, pathname.Display(s.Path))
+	}
+	return 0
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/deemkeen/diffwatch/internal/control"
+	"github.com/deemkeen/diffwatch/internal/daemon"
+	"github.com/deemkeen/diffwatch/internal/pathname"
+	"github.com/deemkeen/diffwatch/internal/store"
+)
+
+// runReport implements the "report" subcommand, a digest of the activity
+// per file over a time window
+func runReport(args []string) int {
+	fs := flag.NewFlagSet("report", flag.ContinueOnError)
+
+	var dbPath, since, until, path string
+	var pid int
+
+	fs.StringVar(&dbPath, "db", "", "")
+	fs.IntVar(&pid, "pid", 0, "")
+	fs.StringVar(&since, "since", "1h", "")
+	fs.StringVar(&until, "until", "", "")
+	fs.StringVar(&path, "path", "", "")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage of %s report:\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  -db string\n")
+		fmt.Fprintf(os.Stderr, "    \tChange database to report on (default: the running daemon's)\n")
+		fmt.Fprintf(os.Stderr, "  -pid int\n")
+		fmt.Fprintf(os.Stderr, "    \tDaemon whose database to use without -db (default: the only running instance)\n")
+		fmt.Fprintf(os.Stderr, "  -since time\n")
+		fmt.Fprintf(os.Stderr, "    \tStart of the window (e.g. 1h, 14:00, 2006-01-02 15:04) (default: 1h)\n")
+		fmt.Fprintf(os.Stderr, "  -until time\n")
+		fmt.Fprintf(os.Stderr, "    \tEnd of the window (default: now)\n")
+		fmt.Fprintf(os.Stderr, "  -path string\n")
+		fmt.Fprintf(os.Stderr, "    \tOnly paths containing this substring\n")
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	now := time.Now()
+	filter := store.Filter{Path: path, Until: now}
+
+	t, err := parseTime(since, now)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: -since: %v\n", err)
+		return 2
+	}
+	filter.Since = t
+
+	if until != "" {
+		t, err := parseTime(until, now)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: -until: %v\n", err)
+			return 2
+		}
+		filter.Until = t
+	}
+
+	db, err := openRecorded(dbPath, pid)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	summaries, err := db.Files(filter)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	// Busiest files first
+	sort.SliceStable(summaries, func(i, j int) bool {
+		return summaries[i].Changes > summaries[j].Changes
+	})
+
+	var changes int
+	for _, s := range summaries {
+		changes += s.Changes
+	}
+
+	fmt.Printf("Activity from %s to %s: %d changes in %d files\n",
+		filter.Since.Format("2006-01-02 15:04:05"), filter.Until.Format("2006-01-02 15:04:05"),
+		changes, len(summaries))
+	if len(summaries) == 0 {
+		return 0
+	}
+
+	fmt.Printf("\n%7s  %6s  %-13s  %-7s  %-8s  %s\n", "CHANGES", "NET", "LINES", "LAST OP", "LAST", "PATH")
+	for _, s := range summaries {
+		fmt.Printf("%7d  %+6d  %-13s  %-7s  %-8s  %s\n",
+			s.Changes, s.Added-s.Deleted, fmt.Sprintf("+%d -%d", s.Added, s.Deleted),
+			s.LastOp, s.Last.Format("15:04:05"), pathname.Display(s.Path))
+	}
+	return 0
+}
+
+// openRecorded opens an existing change database, or the database of the
+// running daemon pid if path is empty
+func openRecorded(path string, pid int) (*store.DB, error) {
+	if path == "" {
+		var err error
+		path, err = daemonDB(pid)
+		if err != nil {
+			return nil, fmt.Errorf("%w (or choose a database with -db)", err)
+		}
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	return store.Open(path)
+}
+
+// daemonDB returns the change database of a running daemon
+func daemonDB(pid int) (string, error) {
+	socket, err := findSocket(pid)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := control.Send(socket, control.Request{Cmd: "status"})
+	if err != nil {
+		return "", err
+	}
+	if resp.Error != "" {
+		return "", fmt.Errorf("%s (is it a daemon?)", resp.Error)
+	}
+
+	var status daemon.Status
+	if err := json.Unmarshal(resp.Data, &status); err != nil {
+		return "", fmt.Errorf("decoding status: %w", err)
+	}
+	return status.DB, nil
+}
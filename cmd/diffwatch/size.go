@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// sizeUnits maps size suffixes to their multipliers
+var sizeUnits = []struct {
+	suffix string
+	factor int64
+}{
+	{"GB", 1 << 30}, {"G", 1 << 30},
+	{"MB", 1 << 20}, {"M", 1 << 20},
+	{"KB", 1 << 10}, {"K", 1 << 10},
+	{"B", 1},
+}
+
+// parseSize parses a byte size like "512MB", "2G" or "1048576"
+func parseSize(s string) (int64, error) {
+	text := strings.ToUpper(strings.TrimSpace(s))
+
+	factor := int64(1)
+	for _, unit := range sizeUnits {
+		if rest, ok := strings.CutSuffix(text, unit.suffix); ok {
+			text, factor = strings.TrimSpace(rest), unit.factor
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(text, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q (use e.g. 512MB, 2G or a number of bytes)", s)
+	}
+	return int64(n * float64(factor)), nil
+}
+
+// formatSize formats a byte count in human readable units
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/deemkeen/diffwatch/internal/ui"
+)
+
+// Exit statuses of sessions with -until or -timeout
+const (
+	exitTimeout     = 3   // -timeout passed before -until matched
+	exitInterrupted = 130 // Quit before -until matched
+)
+
+// untilStatus prints the change that matched -until, if any, and returns
+// the exit status of the session: 0 after a match, or after quitting
+// without -until
+func untilStatus(models []*ui.Model, until bool) int {
+	for _, m := range models {
+		event, result, ok := m.Matched()
+		if !ok {
+			continue
+		}
+
+		// The diff goes to stdout on its own, so it can be saved as a patch
+		fmt.Fprintf(os.Stderr, "%s: %s\n", event.Op, event.Path)
+		if result != nil {
+			fmt.Print(result.Unified)
+		}
+		return 0
+	}
+
+	for _, m := range models {
+		if m.TimedOut() {
+			return exitTimeout
+		}
+	}
+	if until {
+		return exitInterrupted
+	}
+	return 0
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/deemkeen/diffwatch/internal/diff"
+	"github.com/deemkeen/diffwatch/internal/ui"
+)
+
+// runView implements the "view" subcommand, which shows an existing
+// unified diff in the UI, like a diff pager
+func runView(args []string) int {
+	fs := flag.NewFlagSet("view", flag.ContinueOnError)
+
+	var light, dark, ascii bool
+
+	fs.BoolVar(&light, "light", false, "")
+	fs.BoolVar(&dark, "dark", false, "")
+	fs.BoolVar(&ascii, "ascii", false, "")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage of %s view [flags] [FILE]:\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  Shows a unified diff (diff -u, git diff, git format-patch) from FILE, or\n")
+		fmt.Fprintf(os.Stderr, "  from stdin without FILE or with -\n")
+		fmt.Fprintf(os.Stderr, "  -light, -dark\n")
+		fmt.Fprintf(os.Stderr, "    \tUse colors for a light or dark terminal background (default: detected)\n")
+		fmt.Fprintf(os.Stderr, "  -ascii\n")
+		fmt.Fprintf(os.Stderr, "    \tDraw only ASCII, for terminals or fonts without emoji and box drawing characters\n")
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return 2
+	}
+
+	// Without a file the patch is piped in, and keys come from the terminal
+	path := fs.Arg(0)
+	fromStdin := path == "" || path == "-"
+	if fromStdin && isTerminal(os.Stdin) {
+		fs.Usage()
+		return 2
+	}
+
+	var data []byte
+	var err error
+	source := path
+	if fromStdin {
+		source = "stdin"
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: reading patch: %v\n", err)
+		return 1
+	}
+
+	// Colored output of git diff --color=always would not parse
+	files, err := diff.ParseDiff(ansi.Strip(string(data)))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s: %v\n", source, err)
+		return 1
+	}
+	if len(files) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: %s contains no file changes\n", source)
+		return 1
+	}
+
+	if !light && !dark {
+		light = !lipgloss.HasDarkBackground()
+	}
+
+	pager := ui.NewPager(files, ui.PagerOptions{
+		Source:   source,
+		Light:    light,
+		ASCII:    ascii,
+		InputTTY: fromStdin,
+	})
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-sigChan
+		pager.Quit()
+	}()
+
+	if err := pager.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// isTerminal reports whether f is a terminal rather than a pipe or file
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
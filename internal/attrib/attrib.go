@@ -0,0 +1,111 @@
+package attrib
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// recentTTL is how long a write seen as it happened attributes changes
+const recentTTL = time.Minute
+
+// maxRecent bounds the writes remembered before old ones are pruned
+const maxRecent = 10000
+
+// Process is a process that changed a file
+type Process struct {
+	PID  int
+	Name string
+}
+
+// String formats the process as "name (pid N)"
+func (p Process) String() string {
+	return fmt.Sprintf("%s (pid %d)", p.Name, p.PID)
+}
+
+// write is a write to a file seen as it happened
+type write struct {
+	process Process
+	at      time.Time
+}
+
+// Attributor finds the processes that change files below a set of roots.
+// Methods are nil-safe, so a nil Attributor attributes nothing.
+type Attributor struct {
+	roots  []string
+	self   int
+	log    *slog.Logger
+	file   *os.File // fanotify, nil if not permitted
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+	recent map[string]write // Latest write by path
+}
+
+// covers reports whether path lies in or below a root
+func (a *Attributor) covers(path string) bool {
+	for _, root := range a.roots {
+		if path == root || strings.HasPrefix(path, root+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// remember records a write seen as it happened, pruning old ones once too
+// many are remembered
+func (a *Attributor) remember(path string, p Process) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+	a.recent[path] = write{process: p, at: now}
+	if len(a.recent) > maxRecent {
+		for path, w := range a.recent {
+			if now.Sub(w.at) > recentTTL {
+				delete(a.recent, path)
+			}
+		}
+	}
+}
+
+// Lookup returns the process that most recently changed path. Writes seen
+// as they happened are used first; otherwise a process that still has
+// the file open for writing is searched.
+func (a *Attributor) Lookup(path string) (Process, bool) {
+	if a == nil {
+		return Process{}, false
+	}
+
+	a.mu.Lock()
+	w, ok := a.recent[path]
+	a.mu.Unlock()
+	if ok && time.Since(w.at) < recentTTL {
+		return w.process, true
+	}
+	return a.scan(path)
+}
+
+// Method returns how changes are attributed, for display
+func (a *Attributor) Method() string {
+	if a == nil {
+		return "off"
+	}
+	if a.file != nil {
+		return "fanotify"
+	}
+	return "open files"
+}
+
+// Close stops watching writes
+func (a *Attributor) Close() error {
+	if a == nil || a.file == nil {
+		return nil
+	}
+	err := a.file.Close()
+	a.wg.Wait()
+	return err
+}
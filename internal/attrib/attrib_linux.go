@@ -0,0 +1,143 @@
+package attrib
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// metadataLen is the size of a fanotify event header
+const metadataLen = 24
+
+// New starts attributing changes below roots. With fanotify, which needs
+// root or CAP_SYS_ADMIN, every write on the roots' mounts is seen as it
+// happens. Without it, a change is attributed to a process that still has
+// the file open for writing when the change is looked up, so writers that
+// already closed the file go unattributed.
+func New(roots []string, log *slog.Logger) (*Attributor, error) {
+	if log == nil {
+		log = slog.New(slog.DiscardHandler)
+	}
+	a := &Attributor{
+		roots:  roots,
+		self:   os.Getpid(),
+		log:    log,
+		recent: make(map[string]write),
+	}
+
+	fd, err := unix.FanotifyInit(unix.FAN_CLASS_NOTIF|unix.FAN_CLOEXEC|unix.FAN_NONBLOCK,
+		unix.O_RDONLY|unix.O_LARGEFILE|unix.O_CLOEXEC)
+	if err != nil {
+		log.Info("fanotify not available, attributing changes by open files", "error", err)
+		return a, nil
+	}
+	for _, root := range roots {
+		err := unix.FanotifyMark(fd, unix.FAN_MARK_ADD|unix.FAN_MARK_MOUNT,
+			unix.FAN_MODIFY|unix.FAN_CLOSE_WRITE, unix.AT_FDCWD, root)
+		if err != nil {
+			unix.Close(fd)
+			log.Info("fanotify mark failed, attributing changes by open files", "path", root, "error", err)
+			return a, nil
+		}
+	}
+
+	a.file = os.NewFile(uintptr(fd), "fanotify")
+	a.wg.Add(1)
+	go a.read()
+	return a, nil
+}
+
+// read records the writes reported by fanotify until the file is closed
+func (a *Attributor) read() {
+	defer a.wg.Done()
+
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := a.file.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				a.log.Warn("reading fanotify events failed", "error", err)
+			}
+			return
+		}
+
+		for off := 0; off+metadataLen <= n; {
+			eventLen := int(binary.NativeEndian.Uint32(buf[off:]))
+			fd := int32(binary.NativeEndian.Uint32(buf[off+16:]))
+			pid := int(int32(binary.NativeEndian.Uint32(buf[off+20:])))
+			if eventLen < metadataLen {
+				break
+			}
+			off += eventLen
+
+			if fd < 0 {
+				continue
+			}
+			path, err := os.Readlink("/proc/self/fd/" + strconv.Itoa(int(fd)))
+			unix.Close(int(fd))
+			if err == nil && a.covers(path) {
+				a.remember(path, process(pid))
+			}
+		}
+	}
+}
+
+// process returns the name of a process, "?" if it is gone
+func process(pid int) Process {
+	name := "?"
+	if comm, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/comm"); err == nil {
+		name = strings.TrimSpace(string(comm))
+	}
+	return Process{PID: pid, Name: name}
+}
+
+// scan searches the processes for one that has path open for writing,
+// like lsof. Processes of other users can't be inspected without root.
+func (a *Attributor) scan(path string) (Process, bool) {
+	procs, err := os.ReadDir("/proc")
+	if err != nil {
+		return Process{}, false
+	}
+
+	for _, p := range procs {
+		pid, err := strconv.Atoi(p.Name())
+		if err != nil || pid == a.self {
+			continue
+		}
+		fdDir := "/proc/" + p.Name() + "/fd/"
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			if target, err := os.Readlink(fdDir + fd.Name()); err == nil && target == path && writable(pid, fd.Name()) {
+				return process(pid), true
+			}
+		}
+	}
+	return Process{}, false
+}
+
+// writable reports whether a process opened a file descriptor for writing
+func writable(pid int, fd string) bool {
+	f, err := os.Open("/proc/" + strconv.Itoa(pid) + "/fdinfo/" + fd)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), "flags:"); ok {
+			flags, err := strconv.ParseInt(strings.TrimSpace(value), 8, 64)
+			return err == nil && flags&unix.O_ACCMODE != unix.O_RDONLY
+		}
+	}
+	return false
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+
+package attrib
+
+import (
+	"errors"
+	"log/slog"
+)
+
+// New fails: attributing changes to processes needs Linux's fanotify or
+// /proc
+func New(roots []string, log *slog.Logger) (*Attributor, error) {
+	return nil, errors.New("attributing changes to processes is only supported on Linux")
+}
+
+// scan finds nothing: there is no /proc to search
+func (a *Attributor) scan(path string) (Process, bool) {
+	return Process{}, false
+}
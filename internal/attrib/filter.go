@@ -0,0 +1,73 @@
+package attrib
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// commLen is the longest process name the kernel keeps; longer names are
+// truncated
+const commLen = 15
+
+// Filter selects changes by the process that made them. A leading "!"
+// excludes a process instead of including it.
+type Filter struct {
+	pids, names               []string
+	excludePIDs, excludeNames []string
+}
+
+// ParseFilter builds a filter from PIDs and process names, each optionally
+// prefixed with "!" to exclude it. It returns nil if both are empty.
+func ParseFilter(pids, names []string) (*Filter, error) {
+	if len(pids) == 0 && len(names) == 0 {
+		return nil, nil
+	}
+
+	f := &Filter{}
+	for _, pid := range pids {
+		value, exclude := strings.CutPrefix(pid, "!")
+		if n, err := strconv.Atoi(value); err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid pid %q", pid)
+		}
+		if exclude {
+			f.excludePIDs = append(f.excludePIDs, value)
+		} else {
+			f.pids = append(f.pids, value)
+		}
+	}
+	for _, name := range names {
+		value, exclude := strings.CutPrefix(name, "!")
+		if value == "" {
+			return nil, fmt.Errorf("invalid process name %q", name)
+		}
+		if len(value) > commLen {
+			value = value[:commLen]
+		}
+		if exclude {
+			f.excludeNames = append(f.excludeNames, value)
+		} else {
+			f.names = append(f.names, value)
+		}
+	}
+	return f, nil
+}
+
+// Match reports whether a change made by p passes the filter; ok is false
+// if the change couldn't be attributed. Excluded processes never pass.
+// With processes to include, only their changes pass, so unattributed
+// ones are dropped; otherwise every change not excluded passes.
+func (f *Filter) Match(p Process, ok bool) bool {
+	if f == nil {
+		return true
+	}
+	pid := strconv.Itoa(p.PID)
+	if ok && (slices.Contains(f.excludePIDs, pid) || slices.Contains(f.excludeNames, p.Name)) {
+		return false
+	}
+	if len(f.pids) == 0 && len(f.names) == 0 {
+		return true
+	}
+	return ok && (slices.Contains(f.pids, pid) || slices.Contains(f.names, p.Name))
+}
@@ -0,0 +1,274 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// FileName is the name of the per-directory config file
+const FileName = ".diffwatch.json"
+
+// Config holds user configuration loaded from a config file
+type Config struct {
+	Rules   []Rule                 `json:"rules"`
+	Levels  map[string]LevelAction `json:"levels"`
+	MaxDirs int                    `json:"max_dirs"` // Warn when more directories are watched (0: never)
+
+	WatchDepth int `json:"watch_depth"` // Directory levels below a root watched right away, deeper ones later (0: all)
+
+	Protect        []string `json:"protect"`         // Globs of protected paths
+	ProtectRestore bool     `json:"protect_restore"` // Revert changes to protected paths
+
+	Suppress []SuppressRule `json:"suppress"`
+
+	Redact []RedactRule `json:"redact"`
+
+	Ops []string `json:"ops"` // Operations to report (create, write, remove, rename, chmod); empty: all
+
+	IgnoreFiles []string `json:"ignore_files"` // Globs of file names to ignore (default: DefaultIgnoreFiles)
+
+	Include   []string `json:"include"`    // Globs of the paths whose changes are shown, relative to the watch root; empty: all
+	Exclude   []string `json:"exclude"`    // Globs of the paths whose changes are hidden, even if included
+	WatchDirs []string `json:"watch_dirs"` // Directories skipped by default to watch anyway, e.g. "build"
+
+	Debounce map[string]string `json:"debounce"` // Debounce delay by glob, e.g. "*.log": "2s"
+
+	Plugins []Plugin `json:"plugins"`
+
+	Differs []Differ `json:"differs"`
+
+	RateAlarms []RateAlarm `json:"rate_alarms"`
+
+	Schedule Schedule `json:"schedule"`
+
+	Generated Generated `json:"generated"`
+
+	Migrations Migrations `json:"migrations"`
+
+	DocumentText bool `json:"document_text"` // Compare the text of PDF and office documents, not only their metadata
+
+	MaxHistory      int   `json:"max_history"`       // Event log entries (with their diffs) kept in memory
+	LogLines        int   `json:"log_lines"`         // Event log entries shown above the diff
+	MaxTrackedFiles int   `json:"max_tracked_files"` // Files whose contents are kept for diffing (0: unlimited)
+	MaxTotalBytes   int64 `json:"max_total_bytes"`   // Total size of kept file contents (0: unlimited)
+
+	DiffCacheEntries int   `json:"diff_cache_entries"` // Computed diffs kept for reuse (0: no cache)
+	DiffCacheBytes   int64 `json:"diff_cache_bytes"`   // Total size of kept diffs (0: unlimited)
+}
+
+// Rule classifies events into a severity level. A rule matches when the
+// path matches Pattern (if set) and a changed line matches Contains (if set).
+// Bell and Sound alert on matching changes whatever their level.
+type Rule struct {
+	Pattern  string `json:"pattern"`  // Glob matched against the path relative to the watch root
+	Contains string `json:"contains"` // Regular expression matched against added/deleted lines
+	Level    string `json:"level"`    // "info", "warn" or "critical"
+	Bell     bool   `json:"bell"`     // Ring the terminal bell
+	Sound    string `json:"sound"`    // Sound file to play instead of ringing the bell
+}
+
+// SuppressRule hides changes that only touch noise lines. A change to a
+// file matching Pattern (or any file if empty) is suppressed when every
+// added and deleted line matches one of the Ignore expressions.
+type SuppressRule struct {
+	Pattern string   `json:"pattern"` // Glob matched against the path relative to the watch root
+	Ignore  []string `json:"ignore"`  // Regular expressions for noise lines
+}
+
+// RedactRule masks secrets in diff content before it is shown, recorded
+// or shared. In files matching Pattern (or any file if empty), every match
+// of Match is replaced with Mask.
+type RedactRule struct {
+	Pattern string `json:"pattern"` // Glob matched against the path relative to the watch root
+	Match   string `json:"match"`   // Regular expression for the secret
+	Mask    string `json:"mask"`    // Replacement, may refer to groups as ${1} (default: DefaultMask)
+}
+
+// Plugin runs an external analyzer on changes of files matching Pattern
+// (or any file if empty) and of Language (or any language if empty). The
+// change is passed on the command's stdin as JSON; the annotations and
+// verdict it prints are shown with the diff.
+type Plugin struct {
+	Name     string   `json:"name"`     // Shown with the results (default: the program name)
+	Command  []string `json:"command"`  // Program and arguments
+	Pattern  string   `json:"pattern"`  // Glob matched against the path relative to the watch root
+	Language string   `json:"language"` // Detected language ID, e.g. "go" or "python"
+	Timeout  string   `json:"timeout"`  // Longest run, e.g. "5s" (default: 10s)
+}
+
+// Differ shows the changes of files matching Pattern with an external
+// program, e.g. an image differ for *.png, whose output replaces the diff
+type Differ struct {
+	Name    string   `json:"name"`    // Shown with the output (default: the program name)
+	Pattern string   `json:"pattern"` // Glob matched against the path relative to the watch root
+	Command []string `json:"command"` // Program and arguments; {old}, {new} and {path} are replaced
+	Timeout string   `json:"timeout"` // Longest run, e.g. "5s" (default: 10s)
+}
+
+// RateAlarm raises an alarm when files matching Pattern (or any file if
+// empty) change too often: more than Files different files, or one file
+// more than Changes times, within Window. Set Files, Changes or both.
+type RateAlarm struct {
+	Pattern string `json:"pattern"` // Glob matched against the path relative to the watch root
+	Files   int    `json:"files"`   // Most different files changing within the window (0: not checked)
+	Changes int    `json:"changes"` // Most changes of one file within the window (0: not checked)
+	Window  string `json:"window"`  // e.g. "10s" (default: 1m)
+	Level   string `json:"level"`   // Level whose bell and notification actions the alarm triggers (default: warn)
+}
+
+// Schedule limits when notifications fire and changes are recorded, e.g.
+// to business hours, with cron-like expressions of the minutes they are
+// allowed in: "minute hour day-of-month month day-of-week", several
+// separated by ";". Times are local.
+type Schedule struct {
+	Notify string `json:"notify"` // When bells, sounds and desktop notifications fire, e.g. "* 9-17 * * mon-fri" ("": always)
+	Record string `json:"record"` // When changes are recorded to the change database ("": always)
+}
+
+// Generated recognizes generated and huge files, whose changes are only
+// summarized: drawing thousands of lines, or a minified line of megabytes,
+// would freeze the screen. Set a field to its zero value to turn its
+// heuristic off.
+type Generated struct {
+	Patterns      []string `json:"patterns"`        // Globs of generated files (default: DefaultGenerated)
+	Markers       bool     `json:"markers"`         // Recognize "Code generated ... DO NOT EDIT" and "@generated" headers (default: true)
+	MaxSize       int64    `json:"max_size"`        // Files larger than this many bytes (default: 5 MB)
+	MaxLineLength int      `json:"max_line_length"` // Files with longer lines in bytes, like minified code (default: 1000)
+}
+
+// DefaultGenerated are the globs of generated files unless the config sets
+// generated.patterns: minified code, source maps and lockfiles
+var DefaultGenerated = []string{
+	"*.min.*", "*.map",
+	"package-lock.json", "yarn.lock", "pnpm-lock.yaml", "go.sum", "Cargo.lock",
+	"poetry.lock", "Pipfile.lock", "Gemfile.lock", "composer.lock",
+}
+
+// Migrations recognizes changes to database migrations that were already
+// applied, which are flagged as critical
+type Migrations struct {
+	Patterns []string `json:"patterns"` // Globs of migration files (default: DefaultMigrations)
+	Applied  string   `json:"applied"`  // File listing the applied migrations, relative to the watch root ("": all but the newest)
+}
+
+// DefaultMigrations are the globs of migration files unless the config sets
+// migrations.patterns: SQL files in migration directories
+var DefaultMigrations = []string{
+	"**/migrations/*.sql", "**/migration/*.sql", "**/migrate/*.sql", "**/db/changelog/*.sql",
+}
+
+// DefaultMask replaces secrets matched by redaction rules without a mask
+const DefaultMask = "[REDACTED]"
+
+// LevelAction configures what happens when an event of a level is observed
+type LevelAction struct {
+	Bell   bool   `json:"bell"`   // Ring the terminal bell
+	Sound  string `json:"sound"`  // Sound file to play instead of ringing the bell
+	Notify bool   `json:"notify"` // Send a desktop notification
+}
+
+// DefaultIgnoreFiles are the file names ignored unless the config sets
+// ignore_files: editor swap, backup and lock files, vim's write test file
+// and OS metadata
+var DefaultIgnoreFiles = []string{
+	"*.swp", "*.swo", "*~", ".#*",
+	"4913",
+	".DS_Store", "Thumbs.db",
+}
+
+// Default returns the default configuration
+func Default() *Config {
+	return &Config{
+		Levels:           make(map[string]LevelAction),
+		MaxDirs:          10000,
+		MaxHistory:       100,
+		LogLines:         5,
+		IgnoreFiles:      slices.Clone(DefaultIgnoreFiles),
+		DiffCacheEntries: 256,
+		DiffCacheBytes:   64 * 1024 * 1024,
+		Generated: Generated{
+			Patterns:      slices.Clone(DefaultGenerated),
+			Markers:       true,
+			MaxSize:       5 * 1024 * 1024,
+			MaxLineLength: 1000,
+		},
+		Migrations: Migrations{
+			Patterns: slices.Clone(DefaultMigrations),
+		},
+	}
+}
+
+// Load reads a config file from path
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config %s: %w", path, err)
+	}
+
+	cfg := Default()
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("parsing config %s: %w", path, err)
+	}
+	if cfg.Levels == nil {
+		cfg.Levels = make(map[string]LevelAction)
+	}
+
+	return cfg, nil
+}
+
+// Find returns the config file to use for the given watch path.
+// It looks for FileName in the watch directory first, then in the user
+// config directory. Returns an empty string if no config file exists.
+func Find(watchPath string) string {
+	candidates := []string{filepath.Join(watchPath, FileName)}
+	if dir, err := os.UserConfigDir(); err == nil {
+		candidates = append(candidates, filepath.Join(dir, "diffwatch", "config.json"))
+	}
+
+	for _, candidate := range candidates {
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// SaveFilters writes the include and exclude globs and the watched skip
+// directories to the config file at path, keeping its other settings.
+// Empty lists are removed. The file is created if it doesn't exist.
+func SaveFilters(path string, include, exclude, watchDirs []string) error {
+	settings := make(map[string]json.RawMessage)
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &settings); err != nil {
+			return fmt.Errorf("parsing config %s: %w", path, err)
+		}
+	case !os.IsNotExist(err):
+		return fmt.Errorf("reading config %s: %w", path, err)
+	}
+
+	for key, values := range map[string][]string{"include": include, "exclude": exclude, "watch_dirs": watchDirs} {
+		if len(values) == 0 {
+			delete(settings, key)
+			continue
+		}
+		raw, err := json.Marshal(values)
+		if err != nil {
+			return err
+		}
+		settings[key] = raw
+	}
+
+	data, err = json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("writing config %s: %w", path, err)
+	}
+	return nil
+}
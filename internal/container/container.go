@@ -0,0 +1,405 @@
+package container
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/deemkeen/diffwatch/internal/mirror"
+	"github.com/deemkeen/diffwatch/internal/state"
+	"github.com/deemkeen/diffwatch/internal/watcher"
+)
+
+// DefaultInterval is how often the files in a container are listed
+const DefaultInterval = 2 * time.Second
+
+// maxContent is the largest file read from a container for diffing
+const maxContent = 1024 * 1024
+
+// commandTimeout bounds a single docker invocation
+const commandTimeout = 30 * time.Second
+
+// Options configures a container watcher
+type Options struct {
+	Interval    time.Duration // Between listings (default: DefaultInterval)
+	Ops         []string      // Operations to report (see watcher.ParseOps); empty reports all
+	IgnoreFiles []string      // Globs of file names to ignore
+	Logger      *slog.Logger  // Receives watcher internals (nil: discard)
+}
+
+// ParseSpec splits a container watch of the form NAME:/path
+func ParseSpec(spec string) (name, dir string, err error) {
+	name, dir, ok := strings.Cut(spec, ":")
+	if !ok || name == "" || !strings.HasPrefix(dir, "/") {
+		return "", "", fmt.Errorf("invalid container %q, want NAME:/path", spec)
+	}
+	return name, path.Clean(dir), nil
+}
+
+// The docker backend watches paths of the form NAME:/path
+func init() {
+	watcher.Register("docker", "", func(spec string, recursive bool, opts watcher.Options) (watcher.Backend, error) {
+		name, dir, err := ParseSpec(spec)
+		if err != nil {
+			return nil, err
+		}
+		w, err := Watch(name, dir, recursive, Options{
+			Interval:    opts.Interval,
+			Ops:         opts.Ops,
+			IgnoreFiles: opts.IgnoreFiles,
+			Logger:      opts.Logger,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return w, nil
+	})
+}
+
+// fileInfo is a file as listed in the container
+type fileInfo struct {
+	mtime int64 // Seconds
+	size  int64
+}
+
+// Watcher polls the files below a directory inside a running container
+// and delivers their changes like a local watcher, since the host can't
+// reliably watch a container's overlay filesystem. Files are listed with
+// find and stat through docker exec and read with docker cp, so the
+// container needs find and stat (busybox is enough). Changes within the
+// same second that keep a file's size are seen with its next change.
+//
+// Paths are reported as NAME:/path. The UI can't read them, so the
+// watcher supplies the state of a file after its event.
+type Watcher struct {
+	name      string
+	dir       string
+	recursive bool
+	opts      Options
+	log       *slog.Logger
+	states    *mirror.Files
+	errors    chan error
+	wg        sync.WaitGroup
+
+	mu    sync.Mutex
+	files map[string]fileInfo // Last listing by container path
+	dirs  int                 // Directories in the last listing
+}
+
+// Watch starts polling dir in the named container. The first listing and
+// snapshot are taken before Watch returns, so the first change to any
+// file shows a proper diff.
+func Watch(name, dir string, recursive bool, opts Options) (*Watcher, error) {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultInterval
+	}
+	log := opts.Logger
+	if log == nil {
+		log = slog.New(slog.DiscardHandler)
+	}
+
+	w := &Watcher{
+		name:      name,
+		dir:       dir,
+		recursive: recursive,
+		opts:      opts,
+		log:       log,
+		states:    mirror.New(opts.Ops, log),
+		errors:    make(chan error, 10),
+	}
+
+	out, err := docker("inspect", "-f", "{{.State.Running}}", name)
+	if err != nil {
+		return nil, fmt.Errorf("inspecting container %s: %w", name, err)
+	}
+	if strings.TrimSpace(string(out)) != "true" {
+		return nil, fmt.Errorf("container %s is not running", name)
+	}
+
+	files, dirs, err := w.list()
+	if err != nil {
+		return nil, err
+	}
+	w.files, w.dirs = files, dirs
+
+	if err := w.snapshot(); err != nil {
+		// Without it, first changes show whole files as new
+		log.Warn("container snapshot failed", "container", name, "dir", dir, "error", err)
+	}
+
+	w.wg.Add(1)
+	go w.poll()
+	return w, nil
+}
+
+// docker runs a docker command and returns its stdout
+func docker(args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "docker", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, errors.New(msg)
+		}
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
+
+// path returns the reported path of a file in the container
+func (w *Watcher) path(p string) string {
+	return w.name + ":" + p
+}
+
+// ignored reports whether a file's name matches an ignore pattern
+func (w *Watcher) ignored(p string) bool {
+	base := path.Base(p)
+	for _, pattern := range w.opts.IgnoreFiles {
+		if ok, _ := path.Match(pattern, base); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// list lists the files below the watched directory with their modification
+// times and sizes, skipping the directories a local recursive watch skips
+func (w *Watcher) list() (map[string]fileInfo, int, error) {
+	args := []string{"exec", w.name, "find", w.dir}
+	if !w.recursive {
+		args = append(args, "-maxdepth", "1")
+	} else {
+		args = append(args, "(")
+		for i, skip := range watcher.SkipDirs() {
+			if i > 0 {
+				args = append(args, "-o")
+			}
+			args = append(args, "-name", skip)
+		}
+		args = append(args, ")", "-prune", "-o")
+	}
+	args = append(args, "-type", "f", "-exec", "stat", "-c", "%Y %s %n", "{}", "+")
+
+	out, err := docker(args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("listing %s in container %s: %w", w.dir, w.name, err)
+	}
+
+	files := make(map[string]fileInfo)
+	dirs := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), " ", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		mtime, err1 := strconv.ParseInt(fields[0], 10, 64)
+		size, err2 := strconv.ParseInt(fields[1], 10, 64)
+		if err1 != nil || err2 != nil || w.ignored(fields[2]) {
+			continue
+		}
+		files[fields[2]] = fileInfo{mtime: mtime, size: size}
+		dirs[path.Dir(fields[2])] = true
+	}
+	return files, len(dirs), nil
+}
+
+// snapshot reads the contents of the listed files in one archive, as the
+// baseline of the session
+func (w *Watcher) snapshot() error {
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "docker", "cp", w.name+":"+w.dir, "-")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	// Archive entries are named after the directory's base name
+	parent := path.Dir(w.dir)
+	tr := tar.NewReader(stdout)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			cmd.Process.Kill()
+			cmd.Wait()
+			return fmt.Errorf("reading snapshot: %w", err)
+		}
+
+		p := path.Join(parent, hdr.Name)
+		if _, listed := w.files[p]; !listed || hdr.Typeflag != tar.TypeReg || hdr.Size > maxContent {
+			continue
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			cmd.Process.Kill()
+			cmd.Wait()
+			return fmt.Errorf("reading snapshot: %w", err)
+		}
+		w.states.Seed(&state.FileState{Path: w.path(p), Content: content, Exists: true, Hash: state.HashContent(content)})
+	}
+	return cmd.Wait()
+}
+
+// read reads a file from the container. ok is false for files too large
+// to diff.
+func (w *Watcher) read(p string, size int64) (s *state.FileState, ok bool, err error) {
+	if size > maxContent {
+		return nil, false, nil
+	}
+
+	out, err := docker("cp", w.name+":"+p, "-")
+	if err != nil {
+		return nil, false, fmt.Errorf("reading %s from container %s: %w", p, w.name, err)
+	}
+	tr := tar.NewReader(bytes.NewReader(out))
+	if _, err := tr.Next(); err != nil {
+		return nil, false, fmt.Errorf("reading %s from container %s: %w", p, w.name, err)
+	}
+	content, err := io.ReadAll(io.LimitReader(tr, maxContent+1))
+	if err != nil {
+		return nil, false, fmt.Errorf("reading %s from container %s: %w", p, w.name, err)
+	}
+	if len(content) > maxContent {
+		return nil, false, nil
+	}
+	return &state.FileState{Path: w.path(p), Content: content, Exists: true, Hash: state.HashContent(content)}, true, nil
+}
+
+// poll lists the files every interval until the watcher is closed
+func (w *Watcher) poll() {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(w.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.states.Done():
+			return
+		case <-ticker.C:
+			w.scan()
+		}
+	}
+}
+
+// scan compares a new listing with the previous one and reports the
+// created, changed and removed files
+func (w *Watcher) scan() {
+	files, dirs, err := w.list()
+	if err != nil {
+		watcher.SendError(w.errors, err, w.log)
+		return
+	}
+
+	w.mu.Lock()
+	old := w.files
+	w.mu.Unlock()
+
+	files = mirror.Scan(w.states, old, files, mirror.Source[fileInfo]{
+		Path:    w.path,
+		Changed: func(before, now fileInfo) bool { return before != now },
+		Read: func(p string, now fileInfo) (*state.FileState, bool, error) {
+			return w.read(p, now.size)
+		},
+	})
+	if files == nil {
+		return
+	}
+
+	w.mu.Lock()
+	w.files, w.dirs = files, dirs
+	w.mu.Unlock()
+}
+
+// Events returns the channel of file events
+func (w *Watcher) Events() <-chan watcher.Event {
+	return w.states.Events()
+}
+
+// Errors returns the channel of errors
+func (w *Watcher) Errors() <-chan error {
+	return w.errors
+}
+
+// Stats returns the directories and files of the last listing
+func (w *Watcher) Stats() watcher.Stats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return watcher.Stats{Dirs: w.dirs, Files: len(w.files)}
+}
+
+// WatchPath returns the watched directory as NAME:/path
+func (w *Watcher) WatchPath() string {
+	return w.path(w.dir)
+}
+
+// Roots returns the watched directory
+func (w *Watcher) Roots() []string {
+	return []string{w.WatchPath()}
+}
+
+// IsRecursive returns whether subdirectories are watched
+func (w *Watcher) IsRecursive() bool {
+	return w.recursive
+}
+
+// AddRoot is not supported: a container watch has a single root
+func (w *Watcher) AddRoot(path string) (string, error) {
+	return "", errors.New("a container watch can't add roots")
+}
+
+// RemoveRoot is not supported: a container watch has a single root
+func (w *Watcher) RemoveRoot(path string) (string, error) {
+	return "", errors.New("a container watch can't remove roots")
+}
+
+// WalkFiles is not supported: the files are snapshotted at startup instead
+func (w *Watcher) WalkFiles(fn func(path string) error) error {
+	return errors.New("prescan is not available for a container; files are snapshotted at startup")
+}
+
+// PriorState returns the baseline and the state before the first
+// unclaimed event of path, and forgets the latter
+func (w *Watcher) PriorState(p string) (baseline, previous *state.FileState, ok bool) {
+	return w.states.PriorState(p)
+}
+
+// CurrentState returns the state of path after its latest event. ok is
+// false if the content is unknown, e.g. for files too large to diff.
+func (w *Watcher) CurrentState(p string) (*state.FileState, bool) {
+	return w.states.CurrentState(p)
+}
+
+// Close stops polling
+func (w *Watcher) Close() error {
+	if !w.states.Stop() {
+		return nil
+	}
+	w.wg.Wait()
+	w.states.Close()
+	close(w.errors)
+	return nil
+}
@@ -0,0 +1,239 @@
+package control
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// dialTimeout bounds how long clients wait for a running instance
+const dialTimeout = 2 * time.Second
+
+// Request is a command sent to a running instance
+type Request struct {
+	Cmd  string `json:"cmd"` // e.g. "add", "remove" or "list"
+	Path string `json:"path,omitempty"`
+	N    int    `json:"n,omitempty"` // Count for commands returning lists
+}
+
+// Response is the reply to a Request
+type Response struct {
+	Error string          `json:"error,omitempty"`
+	Roots []string        `json:"roots,omitempty"`
+	Data  json.RawMessage `json:"data,omitempty"` // Command specific payload
+}
+
+// Handler executes a request
+type Handler func(req Request) Response
+
+// StreamHandler serves a long-lived request, calling send for every
+// message until it returns. Returning an error ends the stream.
+type StreamHandler func(req Request, send func(v any) error) error
+
+// Server accepts control connections on a unix socket
+type Server struct {
+	listener net.Listener
+	path     string
+	mu       sync.Mutex
+	streams  map[string]StreamHandler
+}
+
+// Listen creates the socket at path and serves requests with h in the
+// background until Close is called
+func Listen(path string, h Handler) (*Server, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("creating socket directory: %w", err)
+	}
+
+	// A socket left behind by a crashed instance with our PID is stale
+	os.Remove(path)
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("creating control socket: %w", err)
+	}
+
+	s := &Server{listener: listener, path: path, streams: make(map[string]StreamHandler)}
+	go s.serve(h)
+	return s, nil
+}
+
+// Path returns the socket path
+func (s *Server) Path() string {
+	return s.path
+}
+
+// HandleStream serves requests for cmd with a stream handler
+func (s *Server) HandleStream(cmd string, h StreamHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.streams[cmd] = h
+}
+
+// Close stops accepting connections and removes the socket
+func (s *Server) Close() error {
+	err := s.listener.Close()
+	os.Remove(s.path)
+	return err
+}
+
+// serve accepts connections until the listener is closed
+func (s *Server) serve(h Handler) {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handleConn(conn, h)
+	}
+}
+
+// handleConn answers a single request, or streams messages for stream
+// commands
+func (s *Server) handleConn(conn net.Conn, h Handler) {
+	defer conn.Close()
+
+	enc := json.NewEncoder(conn)
+
+	var req Request
+	if err := json.NewDecoder(bufio.NewReader(conn)).Decode(&req); err != nil {
+		enc.Encode(Response{Error: fmt.Sprintf("invalid request: %v", err)})
+		return
+	}
+
+	s.mu.Lock()
+	stream, ok := s.streams[req.Cmd]
+	s.mu.Unlock()
+
+	if !ok {
+		enc.Encode(h(req))
+		return
+	}
+
+	// Confirm the stream before the first message
+	if err := enc.Encode(Response{}); err != nil {
+		return
+	}
+	stream(req, func(v any) error { return enc.Encode(v) })
+}
+
+// Send sends a request to the instance listening on the socket at path
+func Send(path string, req Request) (Response, error) {
+	conn, err := net.DialTimeout("unix", path, dialTimeout)
+	if err != nil {
+		return Response{}, fmt.Errorf("connecting to %s: %w", path, err)
+	}
+	defer conn.Close()
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return Response{}, fmt.Errorf("sending request: %w", err)
+	}
+
+	var resp Response
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return Response{}, fmt.Errorf("reading response: %w", err)
+	}
+	return resp, nil
+}
+
+// Stream receives the messages of a stream command
+type Stream struct {
+	conn net.Conn
+	dec  *json.Decoder
+}
+
+// Subscribe sends a stream request to the instance listening on the
+// socket at path
+func Subscribe(path string, req Request) (*Stream, error) {
+	conn, err := net.DialTimeout("unix", path, dialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to %s: %w", path, err)
+	}
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("sending request: %w", err)
+	}
+
+	dec := json.NewDecoder(conn)
+
+	var resp Response
+	if err := dec.Decode(&resp); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("reading response: %w", err)
+	}
+	if resp.Error != "" {
+		conn.Close()
+		return nil, errors.New(resp.Error)
+	}
+
+	return &Stream{conn: conn, dec: dec}, nil
+}
+
+// Receive decodes the next message into v
+func (s *Stream) Receive(v any) error {
+	return s.dec.Decode(v)
+}
+
+// Close ends the stream
+func (s *Stream) Close() error {
+	return s.conn.Close()
+}
+
+// Dir returns the directory holding the sockets of running instances
+func Dir() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "diffwatch")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("diffwatch-%d", os.Getuid()))
+}
+
+// SocketPath returns the socket path for the instance with the given PID
+func SocketPath(pid int) string {
+	return filepath.Join(Dir(), strconv.Itoa(pid)+".sock")
+}
+
+// Find returns the socket of the only running instance. Stale sockets
+// of instances that are gone are removed.
+func Find() (string, error) {
+	matches, err := filepath.Glob(filepath.Join(Dir(), "*.sock"))
+	if err != nil {
+		return "", err
+	}
+
+	var live []string
+	for _, path := range matches {
+		conn, err := net.DialTimeout("unix", path, dialTimeout)
+		if err != nil {
+			if errors.Is(err, syscall.ECONNREFUSED) {
+				os.Remove(path)
+			}
+			continue
+		}
+		conn.Close()
+		live = append(live, path)
+	}
+
+	switch len(live) {
+	case 0:
+		return "", errors.New("no running diffwatch instance found")
+	case 1:
+		return live[0], nil
+	default:
+		pids := make([]string, len(live))
+		for i, path := range live {
+			pids[i] = strings.TrimSuffix(filepath.Base(path), ".sock")
+		}
+		return "", fmt.Errorf("several diffwatch instances are running (PIDs %s), choose one with -pid",
+			strings.Join(pids, ", "))
+	}
+}
@@ -0,0 +1,94 @@
+package crash
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/deemkeen/diffwatch/internal/dirs"
+)
+
+// Panic is a recovered panic with the stack of the goroutine that panicked
+type Panic struct {
+	Value any
+	Stack []byte
+}
+
+// New captures the stack of a panic recovered with value r. Must be called
+// from the deferred function that recovered it. A *Panic passed on from
+// another goroutine is returned as is, keeping its original stack.
+func New(r any) *Panic {
+	if p, ok := r.(*Panic); ok {
+		return p
+	}
+	return &Panic{Value: r, Stack: debug.Stack()}
+}
+
+// Error returns the panic value
+func (p *Panic) Error() string {
+	return fmt.Sprintf("panic: %v", p.Value)
+}
+
+// Section is a part of a crash report, like the recent events
+type Section struct {
+	Title string
+	Lines []string
+}
+
+// Write writes a crash report of p with the given sections to the crash
+// directory. Returns the path of the report.
+func Write(p *Panic, sections ...Section) (string, error) {
+	if err := os.MkdirAll(dirs.Crashes(), 0755); err != nil {
+		return "", fmt.Errorf("creating crash directory: %w", err)
+	}
+
+	now := time.Now()
+	var b strings.Builder
+	fmt.Fprintf(&b, "diffwatch crashed at %s\n\n", now.Format(time.RFC3339))
+	fmt.Fprintf(&b, "Command:  %s\n", command())
+	fmt.Fprintf(&b, "Platform: %s/%s, %s\n", runtime.GOOS, runtime.GOARCH, runtime.Version())
+	if info, ok := debug.ReadBuildInfo(); ok {
+		fmt.Fprintf(&b, "Version:  %s\n", info.Main.Version)
+	}
+	fmt.Fprintf(&b, "\n%s\n\n%s", p.Error(), p.Stack)
+
+	for _, s := range sections {
+		fmt.Fprintf(&b, "\n== %s ==\n", s.Title)
+		for _, line := range s.Lines {
+			fmt.Fprintln(&b, line)
+		}
+	}
+
+	path := filepath.Join(dirs.Crashes(), fmt.Sprintf("crash-%s.txt", now.Format("20060102-150405.000")))
+	if err := os.WriteFile(path, []byte(b.String()), 0600); err != nil {
+		return "", fmt.Errorf("writing crash report: %w", err)
+	}
+	return path, nil
+}
+
+// command returns the command line with the values of token flags, like
+// -share-token, masked
+func command() string {
+	args := slices.Clone(os.Args)
+	for i := 1; i < len(args); i++ {
+		if !strings.HasPrefix(args[i], "-") {
+			continue
+		}
+		name, _, hasValue := strings.Cut(strings.TrimLeft(args[i], "-"), "=")
+		if !strings.HasSuffix(name, "token") {
+			continue
+		}
+		if hasValue {
+			args[i] = args[i][:strings.Index(args[i], "=")+1] + "***"
+		} else if i+1 < len(args) {
+			i++
+			args[i] = "***"
+		}
+	}
+	return strings.Join(args, " ")
+}
@@ -0,0 +1,217 @@
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/deemkeen/diffwatch/internal/control"
+	"github.com/deemkeen/diffwatch/internal/state"
+	"github.com/deemkeen/diffwatch/internal/store"
+	"github.com/deemkeen/diffwatch/internal/watcher"
+)
+
+// prior is the state of a file before an event, as known by the daemon
+type prior struct {
+	baseline *state.FileState
+	previous *state.FileState
+}
+
+// Client is attached to a running daemon and delivers its events like a
+// local watcher
+type Client struct {
+	socket string
+	stream *control.Stream
+	events chan watcher.Event
+	errors chan error
+
+	mu        sync.RWMutex
+	roots     []string
+	recursive bool
+	stats     watcher.Stats
+	priors    map[string]prior // First unclaimed prior state per path
+}
+
+// Attach connects to the daemon listening on the socket at path
+func Attach(path string) (*Client, error) {
+	stream, err := control.Subscribe(path, control.Request{Cmd: "subscribe"})
+	if err != nil {
+		return nil, fmt.Errorf("attaching to daemon: %w", err)
+	}
+
+	var hello Message
+	if err := stream.Receive(&hello); err != nil {
+		stream.Close()
+		return nil, fmt.Errorf("attaching to daemon: %w", err)
+	}
+
+	c := &Client{
+		socket:    path,
+		stream:    stream,
+		events:    make(chan watcher.Event, 100),
+		errors:    make(chan error, 10),
+		roots:     hello.Roots,
+		recursive: hello.Recursive,
+		priors:    make(map[string]prior),
+	}
+	if hello.Stats != nil {
+		c.stats = *hello.Stats
+	}
+
+	go c.receive()
+	return c, nil
+}
+
+// receive reads messages from the daemon until the stream ends
+func (c *Client) receive() {
+	defer close(c.events)
+	defer close(c.errors)
+
+	for {
+		var msg Message
+		if err := c.stream.Receive(&msg); err != nil {
+			watcher.SendError(c.errors, fmt.Errorf("lost connection to daemon: %w", err), nil)
+			return
+		}
+
+		c.mu.Lock()
+		if msg.Stats != nil {
+			c.stats = *msg.Stats
+		}
+		if msg.Roots != nil {
+			c.roots = msg.Roots
+		}
+		if msg.Event != nil {
+			// Coalesced events need the state before the first of them
+			if _, ok := c.priors[msg.Event.Path]; !ok {
+				c.priors[msg.Event.Path] = prior{baseline: msg.Baseline, previous: msg.Previous}
+			}
+		}
+		c.mu.Unlock()
+
+		if msg.Error != "" {
+			watcher.SendError(c.errors, errors.New(msg.Error), nil)
+		}
+		if msg.Event != nil {
+			c.events <- *msg.Event
+		}
+	}
+}
+
+// Events returns the channel of file events
+func (c *Client) Events() <-chan watcher.Event {
+	return c.events
+}
+
+// Errors returns the channel of errors, including losing the connection
+func (c *Client) Errors() <-chan error {
+	return c.errors
+}
+
+// Stats returns the daemon's latest watcher counters
+func (c *Client) Stats() watcher.Stats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.stats
+}
+
+// WatchPath returns the daemon's primary watch root
+func (c *Client) WatchPath() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.roots[0]
+}
+
+// Roots returns the roots watched by the daemon
+func (c *Client) Roots() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return slices.Clone(c.roots)
+}
+
+// IsRecursive returns whether the daemon watches recursively
+func (c *Client) IsRecursive() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.recursive
+}
+
+// AddRoot makes the daemon watch another path
+func (c *Client) AddRoot(path string) (string, error) {
+	return c.changeRoots("add", path)
+}
+
+// RemoveRoot makes the daemon stop watching a root
+func (c *Client) RemoveRoot(path string) (string, error) {
+	return c.changeRoots("remove", path)
+}
+
+// changeRoots sends a watch set change and returns the affected root
+func (c *Client) changeRoots(cmd, path string) (string, error) {
+	before := c.Roots()
+
+	resp, err := control.Send(c.socket, control.Request{Cmd: cmd, Path: path})
+	if err != nil {
+		return "", err
+	}
+	if resp.Error != "" {
+		return "", errors.New(resp.Error)
+	}
+
+	c.mu.Lock()
+	c.roots = resp.Roots
+	c.mu.Unlock()
+
+	// Report the root that was added or removed as the daemon resolved it
+	changed, gone := resp.Roots, before
+	if cmd == "remove" {
+		changed, gone = before, resp.Roots
+	}
+	for _, root := range changed {
+		if !slices.Contains(gone, root) {
+			return root, nil
+		}
+	}
+	return path, nil
+}
+
+// WalkFiles is not supported: the daemon keeps its own snapshots
+func (c *Client) WalkFiles(fn func(path string) error) error {
+	return errors.New("prescan is not available when attached to a daemon")
+}
+
+// PriorState returns the daemon's baseline and previous state of path
+// from before its first unclaimed event, and forgets them
+func (c *Client) PriorState(path string) (baseline, previous *state.FileState, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p, ok := c.priors[path]
+	delete(c.priors, path)
+	return p.baseline, p.previous, ok
+}
+
+// History returns the n most recent events recorded by the daemon, oldest
+// first
+func (c *Client) History(n int) ([]store.Record, error) {
+	resp, err := control.Send(c.socket, control.Request{Cmd: "history", N: n})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+
+	var records []store.Record
+	if err := json.Unmarshal(resp.Data, &records); err != nil {
+		return nil, fmt.Errorf("decoding history: %w", err)
+	}
+	return records, nil
+}
+
+// Close detaches from the daemon, which keeps running
+func (c *Client) Close() error {
+	return c.stream.Close()
+}
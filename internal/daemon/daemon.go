@@ -0,0 +1,445 @@
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/deemkeen/diffwatch/internal/config"
+	"github.com/deemkeen/diffwatch/internal/control"
+	"github.com/deemkeen/diffwatch/internal/diff"
+	"github.com/deemkeen/diffwatch/internal/largefile"
+	"github.com/deemkeen/diffwatch/internal/migration"
+	"github.com/deemkeen/diffwatch/internal/notify"
+	"github.com/deemkeen/diffwatch/internal/pipeline"
+	"github.com/deemkeen/diffwatch/internal/redact"
+	"github.com/deemkeen/diffwatch/internal/schedule"
+	"github.com/deemkeen/diffwatch/internal/severity"
+	"github.com/deemkeen/diffwatch/internal/state"
+	"github.com/deemkeen/diffwatch/internal/store"
+	"github.com/deemkeen/diffwatch/internal/suppress"
+	"github.com/deemkeen/diffwatch/internal/watcher"
+)
+
+// statsInterval is how often attached clients receive watcher counters
+const statsInterval = time.Second
+
+// clientBuffer is the number of messages queued per client. Clients that
+// fall further behind are disconnected rather than slowing the daemon.
+const clientBuffer = 256
+
+// Message is streamed to attached clients. The first message describes
+// the session (Roots, Recursive and Stats); later ones carry a single
+// event, error, counter update or watch set change.
+type Message struct {
+	Event     *watcher.Event   `json:"event,omitempty"`
+	Baseline  *state.FileState `json:"baseline,omitempty"` // State of the event's file at session start
+	Previous  *state.FileState `json:"previous,omitempty"` // State of the event's file before the event
+	Error     string           `json:"error,omitempty"`
+	Stats     *watcher.Stats   `json:"stats,omitempty"`
+	Roots     []string         `json:"roots,omitempty"`
+	Recursive bool             `json:"recursive,omitempty"`
+}
+
+// Status describes a running daemon
+type Status struct {
+	PID       int       `json:"pid"`
+	Roots     []string  `json:"roots"`
+	Recursive bool      `json:"recursive"`
+	DB        string    `json:"db"`
+	Started   time.Time `json:"started"`
+	Events    int       `json:"events"`
+	Clients   int       `json:"clients"`
+
+	DiffCache diff.CacheStats `json:"diff_cache"`
+
+	NotifyHours string `json:"notify_hours,omitempty"` // Schedule of notifications ("": always)
+	RecordHours string `json:"record_hours,omitempty"` // Schedule of recording ("": always)
+	Notifying   bool   `json:"notifying"`              // Notifications fire now
+	Recording   bool   `json:"recording"`              // Changes are recorded now
+}
+
+// Options configures a daemon
+type Options struct {
+	Classifier   *severity.Classifier // Assigns severity levels to recorded events (nil: everything is info)
+	Suppressor   *suppress.Suppressor // Records noise-only changes as info
+	Redactor     *redact.Redactor     // Masks secrets in recorded diffs
+	Migrations   *migration.Checker   // Records changes to applied database migrations as critical
+	Limits       state.Limits         // Bounds the memory used for tracked file contents
+	DiffCache    diff.CacheLimits     // Bounds the computed diffs kept for reuse (zero: no cache)
+	Algorithm    diff.Algorithm       // Matches the lines of old and new versions ("": by language)
+	DocumentText bool                 // Compares the text of PDF and office documents besides their metadata
+	Prescan      bool                 // Snapshot all files at startup as the baseline
+	DBPath       string               // Path of the store, reported by status
+	Logger       *slog.Logger         // Receives processing details (nil: discard)
+
+	Levels      map[string]config.LevelAction // Desktop notifications and sounds by level; there is no terminal bell to ring
+	NotifyHours *schedule.Schedule            // When notifications fire (nil: always)
+	RecordHours *schedule.Schedule            // When changes are recorded to the store (nil: always)
+}
+
+// Daemon watches files without a UI, recording every event to a store
+// and streaming it to attached clients
+type Daemon struct {
+	watcher      *watcher.FileWatcher
+	db           *store.DB
+	stateManager *state.Manager
+	largeFiles   *largefile.Tracker // Snapshots of files over pipeline.MaxDiffSize (nil: unavailable)
+	diffEngine   *diff.Engine
+	processor    *pipeline.Processor
+	opts         Options
+	log          *slog.Logger
+	started      time.Time
+
+	mu      sync.Mutex
+	clients map[chan Message]struct{}
+	events  int
+
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// New creates a daemon recording the events of fw to db
+func New(fw *watcher.FileWatcher, db *store.DB, opts Options) *Daemon {
+	log := opts.Logger
+	if log == nil {
+		log = slog.New(slog.DiscardHandler)
+	}
+
+	stateManager := state.New()
+	stateManager.SetLimits(opts.Limits)
+	diffEngine := diff.New(fw.WatchPath(), opts.Algorithm)
+	diffEngine.SetCacheLimits(opts.DiffCache)
+	diffEngine.SetDocumentText(opts.DocumentText)
+
+	largeFiles, err := largefile.NewTracker(largefile.Limits{}, opts.Algorithm)
+	if err != nil {
+		log.Warn("large file diffs unavailable", "error", err)
+	}
+
+	return &Daemon{
+		watcher:      fw,
+		db:           db,
+		stateManager: stateManager,
+		largeFiles:   largeFiles,
+		diffEngine:   diffEngine,
+		processor:    pipeline.New(stateManager, diffEngine, pipeline.Options{LargeFiles: largeFiles, Logger: log}),
+		opts:         opts,
+		log:          log,
+		started:      time.Now(),
+		clients:      make(map[chan Message]struct{}),
+		done:         make(chan struct{}),
+	}
+}
+
+// Run serves clients on the socket at socketPath and processes events
+// until Stop is called or the watcher is closed
+func (d *Daemon) Run(socketPath string) error {
+	if d.largeFiles != nil {
+		defer d.largeFiles.Close()
+	}
+
+	srv, err := control.Listen(socketPath, d.handle)
+	if err != nil {
+		return err
+	}
+	defer srv.Close()
+	srv.HandleStream("subscribe", d.subscribe)
+
+	d.log.Info("daemon started", "socket", socketPath, "roots", d.watcher.Roots())
+	defer d.disconnectAll()
+
+	if d.opts.Prescan {
+		go d.runPrescan()
+	}
+
+	ticker := time.NewTicker(statsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case event, ok := <-d.watcher.Events():
+			if !ok {
+				return nil
+			}
+			d.handleEvent(event)
+
+		case err, ok := <-d.watcher.Errors():
+			if !ok {
+				return nil
+			}
+			d.log.Error("watcher error", "error", err)
+			d.broadcast(Message{Error: err.Error()})
+
+		case <-ticker.C:
+			stats := d.watcher.Stats()
+			d.broadcast(Message{Stats: &stats})
+
+		case <-d.done:
+			d.log.Info("daemon stopped")
+			return nil
+		}
+	}
+}
+
+// runPrescan prescans the watched files, logging how many it read
+func (d *Daemon) runPrescan() {
+	progress := &state.Progress{}
+	if err := d.processor.Prescan(d.watcher.WalkFiles, progress); err != nil {
+		d.log.Error("prescan failed", "error", err)
+		return
+	}
+	d.log.Info("prescan finished", "files", progress.Scanned.Load())
+}
+
+// Stop makes Run return. Safe to call more than once.
+func (d *Daemon) Stop() {
+	d.stopOnce.Do(func() { close(d.done) })
+}
+
+// handleEvent updates the state of the event's file, records the event
+// and forwards it to clients together with the file's prior state
+func (d *Daemon) handleEvent(event watcher.Event) {
+	alias := d.processor.Canonical(&event)
+	result, _ := d.processor.Process(&event)
+	if alias != "" {
+		if result == nil || !result.HasDiff {
+			d.log.Debug("event of a linked path dropped, its file is unchanged", "path", alias, "file", event.Path)
+			return
+		}
+		d.log.Debug("event of a linked path recorded for its file", "path", alias, "file", event.Path)
+	}
+
+	msg := Message{Event: &event}
+	rec := store.Record{
+		Time:  event.Timestamp,
+		Path:  event.Path,
+		Op:    event.Op,
+		Level: severity.Info.String(),
+		Seq:   event.Seq,
+	}
+
+	if result != nil {
+		msg.Previous = result.OldState
+		msg.Baseline, _ = d.stateManager.Baseline(event.Path)
+
+		if result.OldState != nil {
+			rec.OldHash = result.OldState.Hash
+		}
+		if result.NewState != nil {
+			rec.NewHash = result.NewState.Hash
+		}
+		rec.Added, rec.Deleted = result.Stats()
+		rec.Binary = result.IsBinary
+
+		relPath := d.relPath(event.Path)
+		rec.Patch = d.opts.Redactor.Patch(relPath, result.Unified)
+		if d.opts.Classifier != nil && !d.opts.Suppressor.Noise(relPath, result) {
+			rec.Level = d.opts.Classifier.Classify(relPath, result).String()
+		}
+		d.opts.Migrations.Mark(relPath, result)
+		if result.Dangerous != "" {
+			rec.Level = severity.Critical.String()
+		}
+	}
+
+	if !d.opts.RecordHours.Active(time.Now()) {
+		d.log.Debug("event not recorded", "path", event.Path, "reason", "outside the record schedule")
+	} else if err := d.db.Record(rec); err != nil {
+		d.log.Error("recording event failed", "path", event.Path, "error", err)
+		d.broadcast(Message{Error: err.Error()})
+	}
+	d.alert(event, rec.Level)
+
+	d.mu.Lock()
+	d.events++
+	d.mu.Unlock()
+
+	d.broadcast(msg)
+}
+
+// alert plays the sound and sends the desktop notification configured for
+// the level of an event, if within the notify schedule. Attached clients
+// notify themselves, so the daemon only does while none is.
+func (d *Daemon) alert(event watcher.Event, level string) {
+	action := d.opts.Levels[level]
+	if action.Sound == "" && !action.Notify {
+		return
+	}
+	d.mu.Lock()
+	attached := len(d.clients) > 0
+	d.mu.Unlock()
+	if attached {
+		return
+	}
+	if !d.opts.NotifyHours.Active(time.Now()) {
+		d.log.Debug("notification held back", "path", event.Path, "reason", "outside the notify schedule")
+		return
+	}
+
+	if action.Sound != "" {
+		if err := notify.Play(action.Sound); err != nil {
+			d.log.Warn("playing sound failed", "sound", action.Sound, "error", err)
+		}
+	}
+	if action.Notify {
+		message := fmt.Sprintf("%s: %s", event.Op, d.relPath(event.Path))
+		if err := notify.Desktop("diffwatch: "+level, message); err != nil {
+			d.log.Warn("desktop notification failed", "error", err)
+		}
+	}
+}
+
+// relPath returns path relative to the primary watch root, or path itself
+// if it is outside the root
+func (d *Daemon) relPath(path string) string {
+	rel, err := filepath.Rel(d.watcher.WatchPath(), path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return path
+	}
+	return rel
+}
+
+// handle answers control requests: watch set changes as for "diffwatch
+// ctl", plus status, history and stop
+func (d *Daemon) handle(req control.Request) control.Response {
+	switch req.Cmd {
+	case "add", "remove":
+		var err error
+		if req.Cmd == "add" {
+			_, err = d.watcher.AddRoot(req.Path)
+		} else {
+			_, err = d.watcher.RemoveRoot(req.Path)
+		}
+		if err != nil {
+			return control.Response{Error: err.Error()}
+		}
+		roots := d.watcher.Roots()
+		d.log.Info("watch set changed", "cmd", req.Cmd, "path", req.Path)
+		d.broadcast(Message{Roots: roots})
+		return control.Response{Roots: roots}
+
+	case "list":
+		return control.Response{Roots: d.watcher.Roots()}
+
+	case "status":
+		now := time.Now()
+		d.mu.Lock()
+		status := Status{
+			PID:       os.Getpid(),
+			Roots:     d.watcher.Roots(),
+			Recursive: d.watcher.IsRecursive(),
+			DB:        d.opts.DBPath,
+			Started:   d.started,
+			Events:    d.events,
+			Clients:   len(d.clients),
+			DiffCache: d.diffEngine.CacheStats(),
+
+			NotifyHours: d.opts.NotifyHours.String(),
+			RecordHours: d.opts.RecordHours.String(),
+			Notifying:   d.opts.NotifyHours.Active(now),
+			Recording:   d.opts.RecordHours.Active(now),
+		}
+		d.mu.Unlock()
+		return dataResponse(status)
+
+	case "history":
+		records, err := d.db.Events(store.Filter{Limit: req.N})
+		if err != nil {
+			return control.Response{Error: err.Error()}
+		}
+		return dataResponse(records)
+
+	case "stop":
+		d.Stop()
+		return control.Response{}
+
+	default:
+		return control.Response{Error: fmt.Sprintf("unknown command %q", req.Cmd)}
+	}
+}
+
+// dataResponse wraps v as the payload of a response
+func dataResponse(v any) control.Response {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return control.Response{Error: err.Error()}
+	}
+	return control.Response{Data: data}
+}
+
+// subscribe streams messages to an attached client until it disconnects,
+// falls behind or the daemon stops
+func (d *Daemon) subscribe(req control.Request, send func(v any) error) error {
+	stats := d.watcher.Stats()
+	hello := Message{
+		Roots:     d.watcher.Roots(),
+		Recursive: d.watcher.IsRecursive(),
+		Stats:     &stats,
+	}
+
+	ch := make(chan Message, clientBuffer)
+	d.mu.Lock()
+	d.clients[ch] = struct{}{}
+	d.mu.Unlock()
+	defer d.removeClient(ch)
+
+	d.log.Info("client attached")
+	defer d.log.Info("client detached")
+
+	if err := send(hello); err != nil {
+		return err
+	}
+
+	for msg := range ch {
+		if err := send(msg); err != nil {
+			return err
+		}
+	}
+	return errors.New("client disconnected")
+}
+
+// broadcast queues msg for every client, disconnecting clients whose
+// queue is full
+func (d *Daemon) broadcast(msg Message) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for ch := range d.clients {
+		select {
+		case ch <- msg:
+		default:
+			d.log.Warn("client too slow, disconnecting")
+			delete(d.clients, ch)
+			close(ch)
+		}
+	}
+}
+
+// removeClient forgets a client whose stream ended
+func (d *Daemon) removeClient(ch chan Message) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.clients[ch]; ok {
+		delete(d.clients, ch)
+		close(ch)
+	}
+}
+
+// disconnectAll ends the streams of all clients
+func (d *Daemon) disconnectAll() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for ch := range d.clients {
+		delete(d.clients, ch)
+		close(ch)
+	}
+}
@@ -0,0 +1,220 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/deemkeen/diffwatch/internal/lang"
+)
+
+// Algorithm selects how lines are matched between two versions. The
+// empty algorithm picks one by the language of the file, see For.
+type Algorithm string
+
+const (
+	// Myers finds a shortest edit script, git's default
+	Myers Algorithm = "myers"
+	// Patience anchors the diff on lines that occur once in both versions,
+	// which keeps paragraphs and moved blocks readable
+	Patience Algorithm = "patience"
+	// Histogram anchors the diff on the rarest common lines, which keeps
+	// functions together in code with many braces and blank lines
+	Histogram Algorithm = "histogram"
+)
+
+// Algorithms lists the supported algorithms
+var Algorithms = []Algorithm{Myers, Patience, Histogram}
+
+// languageAlgorithms are the algorithms of languages that don't use Myers
+// by default, by language ID: histogram for code, patience for prose.
+// Data formats, where a shortest diff is best, keep Myers.
+var languageAlgorithms = map[string]Algorithm{
+	"go": Histogram, "javascript": Histogram, "typescript": Histogram, "python": Histogram,
+	"rust": Histogram, "java": Histogram, "kotlin": Histogram, "c": Histogram, "cpp": Histogram,
+	"shell": Histogram, "ruby": Histogram, "perl": Histogram, "php": Histogram, "lua": Histogram,
+	"sql": Histogram, "proto": Histogram, "terraform": Histogram, "css": Histogram,
+	"html": Histogram, "dockerfile": Histogram, "makefile": Histogram,
+
+	"markdown": Patience,
+}
+
+// ParseAlgorithm returns the algorithm called name, "" for an empty name
+func ParseAlgorithm(name string) (Algorithm, error) {
+	if name == "" {
+		return "", nil
+	}
+	for _, alg := range Algorithms {
+		if string(alg) == name {
+			return alg, nil
+		}
+	}
+
+	names := make([]string, len(Algorithms))
+	for i, alg := range Algorithms {
+		names[i] = string(alg)
+	}
+	return "", fmt.Errorf("unknown diff algorithm %q (want %s)", name, strings.Join(names, ", "))
+}
+
+// For returns the algorithm to diff a file of language l (nil if unknown)
+// with: a itself if set, otherwise the language's default or Myers
+func (a Algorithm) For(l *lang.Language) Algorithm {
+	if a != "" {
+		return a
+	}
+	if l != nil {
+		if alg, ok := languageAlgorithms[l.ID]; ok {
+			return alg
+		}
+	}
+	return Myers
+}
+
+// OpCode describes how to turn a[I1:I2] into b[J1:J2]: 'e' (equal), 'd'
+// (delete), 'i' (insert) or 'r' (replace)
+type OpCode struct {
+	Tag    byte
+	I1, I2 int
+	J1, J2 int
+}
+
+// OpCodes diffs two sequences of lines with alg (Myers for "") and returns
+// the operations turning a into b, covering both sequences in order
+func OpCodes(a, b []string, alg Algorithm) []OpCode {
+	d := newDiffer(a, b)
+	switch alg {
+	case Patience:
+		d.patience(0, len(d.a), 0, len(d.b))
+	case Histogram:
+		d.histogram(0, len(d.a), 0, len(d.b))
+	default:
+		d.myers(0, len(d.a), 0, len(d.b))
+	}
+	return d.opCodes()
+}
+
+// differ holds the lines of two versions as numbers, equal lines getting
+// the same number, and which lines are changed
+type differ struct {
+	a, b   []int
+	ca, cb []bool // Lines of a deleted and of b inserted
+	v      []int  // Scratch space of midSnake
+}
+
+// newDiffer numbers the lines of a and b
+func newDiffer(a, b []string) *differ {
+	ids := make(map[string]int, len(a))
+	number := func(lines []string) []int {
+		out := make([]int, len(lines))
+		for i, line := range lines {
+			id, ok := ids[line]
+			if !ok {
+				id = len(ids)
+				ids[line] = id
+			}
+			out[i] = id
+		}
+		return out
+	}
+	return newDifferIDs(number(a), number(b))
+}
+
+// newDifferIDs creates a differ for lines already numbered
+func newDifferIDs(a, b []int) *differ {
+	return &differ{a: a, b: b, ca: make([]bool, len(a)), cb: make([]bool, len(b))}
+}
+
+// trim narrows a range to leave out its common prefix and suffix
+func (d *differ) trim(aLo, aHi, bLo, bHi int) (int, int, int, int) {
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		aLo++
+		bLo++
+	}
+	for aLo < aHi && bLo < bHi && d.a[aHi-1] == d.b[bHi-1] {
+		aHi--
+		bHi--
+	}
+	return aLo, aHi, bLo, bHi
+}
+
+// markAll marks every line of a range as changed, reporting whether one
+// side of it is empty, which leaves nothing else to do
+func (d *differ) markAll(aLo, aHi, bLo, bHi int) bool {
+	if aLo < aHi && bLo < bHi {
+		return false
+	}
+	for i := aLo; i < aHi; i++ {
+		d.ca[i] = true
+	}
+	for j := bLo; j < bHi; j++ {
+		d.cb[j] = true
+	}
+	return true
+}
+
+// opCodes turns the changed lines into operations. The unchanged lines of
+// both versions are equal in order, as they form a common subsequence.
+func (d *differ) opCodes() []OpCode {
+	var codes []OpCode
+	i, j := 0, 0
+	for i < len(d.a) || j < len(d.b) {
+		i1, j1 := i, j
+		for i < len(d.a) && j < len(d.b) && !d.ca[i] && !d.cb[j] {
+			i++
+			j++
+		}
+		if i > i1 {
+			codes = append(codes, OpCode{'e', i1, i, j1, j})
+		}
+
+		i1, j1 = i, j
+		for i < len(d.a) && d.ca[i] {
+			i++
+		}
+		for j < len(d.b) && d.cb[j] {
+			j++
+		}
+		switch {
+		case i > i1 && j > j1:
+			codes = append(codes, OpCode{'r', i1, i, j1, j})
+		case i > i1:
+			codes = append(codes, OpCode{'d', i1, i, j1, j})
+		case j > j1:
+			codes = append(codes, OpCode{'i', i1, i, j1, j})
+		}
+	}
+	return codes
+}
+
+// groupOpCodes splits operations into hunks with up to n lines of context
+// around the changes. Returns no hunks if nothing changed.
+func groupOpCodes(codes []OpCode, n int) [][]OpCode {
+	if len(codes) == 0 {
+		return nil
+	}
+
+	// Leading and trailing context is cut to n lines
+	if c := &codes[0]; c.Tag == 'e' {
+		c.I1, c.J1 = max(c.I1, c.I2-n), max(c.J1, c.J2-n)
+	}
+	if c := &codes[len(codes)-1]; c.Tag == 'e' {
+		c.I2, c.J2 = min(c.I2, c.I1+n), min(c.J2, c.J1+n)
+	}
+
+	var groups [][]OpCode
+	var group []OpCode
+	for _, c := range codes {
+		// Unchanged runs longer than twice the context end a hunk
+		if c.Tag == 'e' && c.I2-c.I1 > 2*n {
+			group = append(group, OpCode{'e', c.I1, min(c.I2, c.I1+n), c.J1, min(c.J2, c.J1+n)})
+			groups = append(groups, group)
+			group = nil
+			c.I1, c.J1 = max(c.I1, c.I2-n), max(c.J1, c.J2-n)
+		}
+		group = append(group, c)
+	}
+	if len(group) > 0 && (len(group) > 1 || group[0].Tag != 'e') {
+		groups = append(groups, group)
+	}
+	return groups
+}
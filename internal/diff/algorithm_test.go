@@ -0,0 +1,211 @@
+package diff
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// algorithmCases are pairs of versions the algorithms must turn into each
+// other, from edge cases to the shapes of common edits
+var algorithmCases = []struct {
+	name string
+	a, b string
+}{
+	{"both empty", "", ""},
+	{"from empty", "", "a b c"},
+	{"to empty", "a b c", ""},
+	{"equal", "a b c", "a b c"},
+	{"insert", "a b c", "a x b c"},
+	{"delete", "a b c d", "a c d"},
+	{"replace", "a b c d", "a x y d"},
+	{"append", "a b", "a b c d"},
+	{"prepend", "c d", "a b c d"},
+	{"rewritten", "a b c", "x y z"},
+	{"moved block", "a b c d e f", "d e f a b c"},
+	{"swapped", "a b", "b a"},
+	{"repeated lines", "{ } { } { }", "{ } x { } { } }"},
+	{"blank lines", "f _ _ g _ h", "f _ g _ _ h _"},
+	{"function added", "func a { x } func b { y }", "func a { x } func c { z } func b { y }"},
+	{"scattered", "a b c d e f g h i j", "a B c d E f g H i j k"},
+}
+
+// words splits a case's version into lines
+func words(s string) []string {
+	return strings.Fields(s)
+}
+
+// apply turns a into b with the operations, failing the test if they don't
+// cover both sequences in order or keep lines that differ
+func apply(t *testing.T, a, b []string, codes []OpCode) []string {
+	t.Helper()
+	var out []string
+	i, j := 0, 0
+	for _, c := range codes {
+		if c.I1 != i || c.J1 != j || c.I2 < c.I1 || c.J2 < c.J1 {
+			t.Fatalf("operation %c %d:%d %d:%d doesn't continue at %d %d", c.Tag, c.I1, c.I2, c.J1, c.J2, i, j)
+		}
+		switch c.Tag {
+		case 'e':
+			if !slices.Equal(a[c.I1:c.I2], b[c.J1:c.J2]) {
+				t.Fatalf("equal operation %d:%d %d:%d covers different lines", c.I1, c.I2, c.J1, c.J2)
+			}
+			out = append(out, a[c.I1:c.I2]...)
+		case 'd', 'i', 'r':
+			if c.Tag == 'd' && c.J1 != c.J2 || c.Tag == 'i' && c.I1 != c.I2 ||
+				c.Tag == 'r' && (c.I1 == c.I2 || c.J1 == c.J2) {
+				t.Fatalf("operation %c %d:%d %d:%d has wrong ranges", c.Tag, c.I1, c.I2, c.J1, c.J2)
+			}
+			out = append(out, b[c.J1:c.J2]...)
+		default:
+			t.Fatalf("unknown operation %q", c.Tag)
+		}
+		i, j = c.I2, c.J2
+	}
+	if i != len(a) || j != len(b) {
+		t.Fatalf("operations end at %d %d, want %d %d", i, j, len(a), len(b))
+	}
+	return out
+}
+
+// kept returns the number of lines the operations keep unchanged
+func kept(codes []OpCode) int {
+	n := 0
+	for _, c := range codes {
+		if c.Tag == 'e' {
+			n += c.I2 - c.I1
+		}
+	}
+	return n
+}
+
+// lcs returns the length of a longest common subsequence of a and b
+func lcs(a, b []string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for i := range a {
+		for j := range b {
+			if a[i] == b[j] {
+				cur[j+1] = prev[j] + 1
+			} else {
+				cur[j+1] = max(prev[j+1], cur[j])
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// randomLines returns n lines drawn from an alphabet of size lines, small
+// alphabets repeating lines like code does with braces
+func randomLines(r *rand.Rand, n, size int) []string {
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = fmt.Sprint(r.IntN(size))
+	}
+	return lines
+}
+
+// edit changes about one in rate lines of lines: replaced, deleted or
+// followed by an inserted line
+func edit(r *rand.Rand, lines []string, rate, size int) []string {
+	var out []string
+	for _, line := range lines {
+		switch r.IntN(rate) {
+		case 0:
+			out = append(out, fmt.Sprint(r.IntN(size)))
+		case 1:
+		case 2:
+			out = append(out, line, fmt.Sprint(r.IntN(size)))
+		default:
+			out = append(out, line)
+		}
+	}
+	return out
+}
+
+func TestOpCodesRebuild(t *testing.T) {
+	for _, alg := range Algorithms {
+		for _, tc := range algorithmCases {
+			t.Run(string(alg)+"/"+tc.name, func(t *testing.T) {
+				a, b := words(tc.a), words(tc.b)
+				got := apply(t, a, b, OpCodes(a, b, alg))
+				if !slices.Equal(got, b) {
+					t.Errorf("rebuilt %q, want %q", got, b)
+				}
+			})
+		}
+	}
+}
+
+func TestOpCodesRebuildRandom(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	for _, alg := range Algorithms {
+		for n := range 200 {
+			a := randomLines(r, n, 2+n%10)
+			b := edit(r, a, 2+n%7, 2+n%10)
+			got := apply(t, a, b, OpCodes(a, b, alg))
+			if !slices.Equal(got, b) {
+				t.Fatalf("%s: rebuilt %q from %q, want %q", alg, got, a, b)
+			}
+		}
+	}
+}
+
+func TestMyersMinimal(t *testing.T) {
+	for _, tc := range algorithmCases {
+		t.Run(tc.name, func(t *testing.T) {
+			a, b := words(tc.a), words(tc.b)
+			if got, want := kept(OpCodes(a, b, Myers)), lcs(a, b); got != want {
+				t.Errorf("kept %d lines, want %d", got, want)
+			}
+		})
+	}
+
+	// Random pairs small enough to stay within costLimit
+	r := rand.New(rand.NewPCG(3, 4))
+	for n := range 300 {
+		a := randomLines(r, n, 2+n%10)
+		b := edit(r, a, 2+n%7, 2+n%10)
+		if got, want := kept(OpCodes(a, b, Myers)), lcs(a, b); got != want {
+			t.Fatalf("kept %d lines of %q and %q, want %d", got, a, b, want)
+		}
+	}
+}
+
+func TestOpCodesEmptyAlgorithmIsMyers(t *testing.T) {
+	a, b := words("a b c d e f"), words("a c b d f e")
+	if got, want := OpCodes(a, b, ""), OpCodes(a, b, Myers); !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func BenchmarkOpCodes(b *testing.B) {
+	r := rand.New(rand.NewPCG(5, 6))
+	for _, size := range []int{1000, 10000, 100000} {
+		// Source-like lines: mostly distinct, with repeated braces and
+		// blank lines, of which about one in 200 changes
+		old := make([]string, size)
+		for i := range old {
+			switch i % 5 {
+			case 0:
+				old[i] = "}"
+			case 1:
+				old[i] = ""
+			default:
+				old[i] = fmt.Sprintf("line %d", r.IntN(size))
+			}
+		}
+		changed := edit(r, old, 200, size)
+
+		for _, alg := range Algorithms {
+			b.Run(fmt.Sprintf("%s/%d", alg, size), func(b *testing.B) {
+				for b.Loop() {
+					OpCodes(old, changed, alg)
+				}
+			})
+		}
+	}
+}
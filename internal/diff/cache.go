@@ -0,0 +1,171 @@
+package diff
+
+import (
+	"container/list"
+	"slices"
+	"sync"
+
+	"github.com/deemkeen/diffwatch/internal/state"
+)
+
+// CacheLimits bounds the results an engine keeps. A MaxEntries of zero
+// disables the cache, a MaxBytes of zero leaves its size unlimited.
+type CacheLimits struct {
+	MaxEntries int   // Maximum number of cached results
+	MaxBytes   int64 // Maximum total size of cached lines and patches
+}
+
+// CacheStats counts how well the cache does
+type CacheStats struct {
+	Hits    int   `json:"hits"`    // Results served from the cache
+	Misses  int   `json:"misses"`  // Results computed
+	Entries int   `json:"entries"` // Results cached now
+	Bytes   int64 `json:"bytes"`   // Size of the cached results
+}
+
+// HitRate returns the share of lookups served from the cache in percent,
+// 0 before the first lookup
+func (s CacheStats) HitRate() int {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return s.Hits * 100 / (s.Hits + s.Misses)
+}
+
+// cacheKey identifies a transition: the same paths and contents always
+// diff to the same result
+type cacheKey struct {
+	oldPath, newPath string
+	oldHash, newHash string
+}
+
+// cacheEntry is a cached result and the size counted for it
+type cacheEntry struct {
+	key    cacheKey
+	result *Result
+	size   int64
+}
+
+// cache keeps the latest computed results by transition, so showing the
+// same change again, like flipping a file back and forth or diffing
+// against an unchanged baseline, doesn't diff large files again. Methods
+// are nil-safe, so a nil cache caches nothing.
+type cache struct {
+	limits CacheLimits
+	lru    *list.List // Entries, most recently used first
+	elems  map[cacheKey]*list.Element
+	bytes  int64
+	stats  CacheStats
+	mu     sync.Mutex
+}
+
+// newCache returns a cache within limits, nil if it's disabled
+func newCache(limits CacheLimits) *cache {
+	if limits.MaxEntries <= 0 {
+		return nil
+	}
+	return &cache{limits: limits, lru: list.New(), elems: make(map[cacheKey]*list.Element)}
+}
+
+// keyOf returns the key of a transition, false if a version that exists
+// has no hash to tell its content by
+func keyOf(oldState, newState *state.FileState) (cacheKey, bool) {
+	if oldState.Exists && oldState.Hash == "" || newState.Exists && newState.Hash == "" {
+		return cacheKey{}, false
+	}
+	return cacheKey{oldState.Path, newState.Path, oldState.Hash, newState.Hash}, true
+}
+
+// get returns a copy of the cached result of a transition for the given
+// states, nil if it isn't cached
+func (c *cache) get(key cacheKey, oldState, newState *state.FileState) *Result {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.elems[key]
+	if !ok {
+		c.stats.Misses++
+		return nil
+	}
+	c.stats.Hits++
+	c.lru.MoveToFront(elem)
+
+	result := elem.Value.(*cacheEntry).result.clone()
+	result.OldState, result.NewState = oldState, newState
+	return result
+}
+
+// put caches a copy of result, as callers change theirs (e.g. masking
+// secrets), evicting the least recently used results over the limits
+func (c *cache) put(key cacheKey, result *Result) {
+	if c == nil {
+		return
+	}
+	entry := &cacheEntry{key: key, result: result.clone(), size: resultSize(result)}
+	// The states are passed again on each hit, don't keep their contents
+	entry.result.OldState, entry.result.NewState = nil, nil
+	if c.limits.MaxBytes > 0 && entry.size > c.limits.MaxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.elems[key]; ok {
+		c.remove(elem)
+	}
+	c.elems[key] = c.lru.PushFront(entry)
+	c.bytes += entry.size
+	for c.lru.Len() > c.limits.MaxEntries || c.limits.MaxBytes > 0 && c.bytes > c.limits.MaxBytes {
+		c.remove(c.lru.Back())
+	}
+}
+
+// remove drops an entry. Must hold mu.
+func (c *cache) remove(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*cacheEntry)
+	delete(c.elems, entry.key)
+	c.bytes -= entry.size
+}
+
+// report returns the hits and misses so far and the current size
+func (c *cache) report() CacheStats {
+	if c == nil {
+		return CacheStats{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Entries = c.lru.Len()
+	stats.Bytes = c.bytes
+	return stats
+}
+
+// lineOverhead approximates the bytes a diff line holds besides its text
+const lineOverhead = 64
+
+// resultSize approximates the memory held by the lines, changes and patch
+// of a result
+func resultSize(r *Result) int64 {
+	size := int64(len(r.Unified))
+	for _, line := range r.Lines {
+		size += int64(len(line.Content)+len(line.OldContent)) + lineOverhead
+	}
+	for _, change := range r.Changes {
+		size += int64(len(change.Location)+len(change.Old)+len(change.New)) + lineOverhead
+	}
+	return size
+}
+
+// clone returns a copy of r whose lines and changes can be changed without
+// changing those of r
+func (r *Result) clone() *Result {
+	out := *r
+	out.Lines = append(make([]DiffLine, 0, len(r.Lines)), r.Lines...)
+	out.Changes = slices.Clone(r.Changes)
+	return &out
+}
@@ -0,0 +1,236 @@
+package diff
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/deemkeen/diffwatch/internal/state"
+)
+
+// diffCert replaces the line diff of a PEM or DER file, which is base64
+// or binary noise, by the fields of its certificates and keys that
+// changed: subject, issuer, names, validity, fingerprints. Files that
+// don't decode keep their line diff.
+func diffCert(r *Result) {
+	oldFields, err := certFields(r.OldState)
+	if err != nil {
+		return
+	}
+	newFields, err := certFields(r.NewState)
+	if err != nil {
+		return
+	}
+
+	r.Structure = "Certificate"
+	r.compareFields(oldFields, newFields)
+}
+
+// certFields decodes the PEM blocks of a file, or the file as one DER
+// certificate, into their fields. A missing file has none.
+func certFields(s *state.FileState) ([]field, error) {
+	if s == nil || !s.Exists {
+		return nil, nil
+	}
+
+	var blocks []*pem.Block
+	for rest := s.Content; ; {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		blocks = append(blocks, block)
+	}
+	if len(blocks) == 0 {
+		if _, err := x509.ParseCertificate(s.Content); err != nil {
+			return nil, errors.New("no certificates or keys")
+		}
+		blocks = append(blocks, &pem.Block{Type: "CERTIFICATE", Bytes: s.Content})
+	}
+
+	counts := make(map[string]int)
+	for _, block := range blocks {
+		counts[blockKind(block)]++
+	}
+
+	var fields []field
+	seen := make(map[string]int)
+	for _, block := range blocks {
+		kind := blockKind(block)
+		seen[kind]++
+		prefix := kind
+		if counts[kind] > 1 {
+			prefix += fmt.Sprintf("[%d]", seen[kind])
+		}
+		for _, f := range blockFields(block) {
+			fields = append(fields, field{location: prefix + "/" + f.location, value: f.value})
+		}
+	}
+	return fields, nil
+}
+
+// blockKind names what a PEM block holds
+func blockKind(block *pem.Block) string {
+	switch block.Type {
+	case "CERTIFICATE", "TRUSTED CERTIFICATE":
+		return "certificate"
+	case "CERTIFICATE REQUEST", "NEW CERTIFICATE REQUEST":
+		return "request"
+	case "PUBLIC KEY", "RSA PUBLIC KEY":
+		return "public key"
+	}
+	if strings.HasSuffix(block.Type, "PRIVATE KEY") {
+		return "private key"
+	}
+	return strings.ToLower(block.Type)
+}
+
+// blockFields decodes the fields of a PEM block. Blocks that don't decode
+// are only identified by their fingerprint. Private keys show their
+// public half, never the key itself.
+func blockFields(block *pem.Block) []field {
+	var fields []field
+	add := func(location, value string) {
+		if value != "" {
+			fields = append(fields, field{location: location, value: value})
+		}
+	}
+
+	switch blockKind(block) {
+	case "certificate":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			break
+		}
+		add("subject", cert.Subject.String())
+		add("issuer", cert.Issuer.String())
+		add("names", certNames(cert.DNSNames, cert.IPAddresses, cert.EmailAddresses, cert.URIs))
+		add("serial", fmt.Sprintf("%X", cert.SerialNumber))
+		add("not before", certTime(cert.NotBefore))
+		add("not after", certTime(cert.NotAfter))
+		add("key", keyDescription(cert.PublicKey))
+		add("signature", cert.SignatureAlgorithm.String())
+		if cert.IsCA {
+			add("ca", "yes")
+		}
+		add("sha256", fingerprint(block.Bytes))
+		return fields
+
+	case "request":
+		req, err := x509.ParseCertificateRequest(block.Bytes)
+		if err != nil {
+			break
+		}
+		add("subject", req.Subject.String())
+		add("names", certNames(req.DNSNames, req.IPAddresses, req.EmailAddresses, req.URIs))
+		add("key", keyDescription(req.PublicKey))
+		add("sha256", fingerprint(block.Bytes))
+		return fields
+
+	case "public key":
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			if pub, err = x509.ParsePKCS1PublicKey(block.Bytes); err != nil {
+				break
+			}
+		}
+		add("key", keyDescription(pub))
+		add("sha256", publicFingerprint(pub))
+		return fields
+
+	case "private key":
+		if strings.HasPrefix(block.Type, "ENCRYPTED") || block.Headers["Proc-Type"] != "" {
+			add("encrypted", "yes")
+			add("sha256", fingerprint(block.Bytes))
+			return fields
+		}
+		key, err := parsePrivateKey(block.Bytes)
+		if err != nil {
+			break
+		}
+		add("key", keyDescription(key.Public()))
+		add("public sha256", publicFingerprint(key.Public()))
+		return fields
+	}
+
+	add("sha256", fingerprint(block.Bytes))
+	return fields
+}
+
+// parsePrivateKey parses a PKCS #8, PKCS #1 or SEC 1 private key
+func parsePrivateKey(der []byte) (crypto.Signer, error) {
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		if signer, ok := key.(crypto.Signer); ok {
+			return signer, nil
+		}
+		return nil, fmt.Errorf("unsupported private key %T", key)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	return x509.ParseECPrivateKey(der)
+}
+
+// certNames joins the subject alternative names of a certificate
+func certNames(dns []string, ips []net.IP, emails []string, uris []*url.URL) string {
+	names := append([]string(nil), dns...)
+	for _, ip := range ips {
+		names = append(names, ip.String())
+	}
+	names = append(names, emails...)
+	for _, uri := range uris {
+		names = append(names, uri.String())
+	}
+	return strings.Join(names, ", ")
+}
+
+// certTime formats a validity bound in UTC
+func certTime(t time.Time) string {
+	return t.UTC().Format(time.DateTime) + " UTC"
+}
+
+// keyDescription names the algorithm and size of a public key
+func keyDescription(pub any) string {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA %d", k.N.BitLen())
+	case *ecdsa.PublicKey:
+		return "ECDSA " + k.Curve.Params().Name
+	case ed25519.PublicKey:
+		return "Ed25519"
+	}
+	return fmt.Sprintf("%T", pub)
+}
+
+// fingerprint returns the SHA-256 of DER bytes as colon separated hex, as
+// openssl shows it
+func fingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	hexSum := strings.ToUpper(hex.EncodeToString(sum[:]))
+	pairs := make([]string, 0, len(sum))
+	for i := 0; i < len(hexSum); i += 2 {
+		pairs = append(pairs, hexSum[i:i+2])
+	}
+	return strings.Join(pairs, ":")
+}
+
+// publicFingerprint returns the fingerprint of a public key, "" if it
+// can't be encoded
+func publicFingerprint(pub any) string {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return ""
+	}
+	return fingerprint(der)
+}
@@ -0,0 +1,104 @@
+package diff
+
+import "strings"
+
+// ConflictPart is the role of a line in a git conflict region
+type ConflictPart int
+
+const (
+	ConflictNone   ConflictPart = iota
+	ConflictMarker              // <<<<<<<, |||||||, ======= or >>>>>>>
+	ConflictOurs                // Between <<<<<<< and ||||||| or =======
+	ConflictBase                // Common ancestor in diff3 style, between ||||||| and =======
+	ConflictTheirs              // Between ======= and >>>>>>>
+)
+
+// conflictMarker returns the part that follows a conflict marker line
+// (ConflictNone after the closing marker), and whether the line is a
+// marker at all
+func conflictMarker(content string) (ConflictPart, bool) {
+	switch {
+	case isMarker(content, "<<<<<<<"):
+		return ConflictOurs, true
+	case isMarker(content, "|||||||"):
+		return ConflictBase, true
+	case content == "=======":
+		return ConflictTheirs, true
+	case isMarker(content, ">>>>>>>"):
+		return ConflictNone, true
+	}
+	return ConflictNone, false
+}
+
+// isMarker reports whether content is the marker, optionally followed by
+// a space and a label
+func isMarker(content, marker string) bool {
+	rest, ok := strings.CutPrefix(content, marker)
+	return ok && (rest == "" || rest[0] == ' ')
+}
+
+// markConflicts sets the Conflict part of the lines in the new content
+// that belong to conflict regions, returning the number of regions.
+// Unterminated regions are not marked.
+func markConflicts(lines []DiffLine) int {
+	regions := 0
+	start := -1 // Index of the opening marker of the current region
+	for i := range lines {
+		if lines[i].Type == LineDeleted || lines[i].Type == LineGap {
+			continue
+		}
+
+		part, ok := conflictMarker(lines[i].Content)
+		switch {
+		case !ok:
+		case part == ConflictOurs:
+			start = i
+		case part == ConflictNone && start >= 0:
+			regions++
+			markRegion(lines[start : i+1])
+			start = -1
+		}
+	}
+	return regions
+}
+
+// markRegion marks the lines of a complete conflict region, from its
+// opening to its closing marker
+func markRegion(lines []DiffLine) {
+	part := ConflictNone
+	for i := range lines {
+		if lines[i].Type == LineDeleted || lines[i].Type == LineGap {
+			continue
+		}
+		if next, ok := conflictMarker(lines[i].Content); ok {
+			lines[i].Conflict = ConflictMarker
+			part = next
+			continue
+		}
+		lines[i].Conflict = part
+	}
+}
+
+// countConflicts returns the number of conflict regions in content
+func countConflicts(content []byte) int {
+	regions := 0
+	open := false
+	for _, line := range SplitLines(content) {
+		line, _ = trimEnding(line)
+		part, ok := conflictMarker(line)
+		switch {
+		case ok && part == ConflictOurs:
+			open = true
+		case ok && part == ConflictNone && open:
+			regions++
+			open = false
+		}
+	}
+	return regions
+}
+
+// GainedConflicts reports whether the change introduced git conflict
+// markers, e.g. by a merge or rebase
+func (r *Result) GainedConflicts() bool {
+	return r.Conflicts > 0 && r.OldConflicts == 0
+}
@@ -0,0 +1,348 @@
+package diff
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/deemkeen/diffwatch/internal/state"
+)
+
+// maxDocumentPart is the most bytes read from a part of a document, so an
+// archive that unpacks to gigabytes doesn't exhaust memory
+const maxDocumentPart = 32 << 20
+
+// docText is the text of a document, or of one of its slides, as lines
+type docText struct {
+	location string // e.g. "text" or "slide 2"
+	lines    []string
+}
+
+// diffDocument replaces "binary file changed" for office documents, Office
+// Open XML (.docx, .xlsx, .pptx) and OpenDocument (.odt, .ods, .odp), by
+// the changes to their metadata: title, author, modification date, page
+// count and size. If the engine compares document text, the changed
+// paragraphs are listed too. Documents that don't unpack keep the binary
+// summary.
+func diffDocument(r *Result) {
+	oldFields, oldText, err := documentFields(r.OldState, r.documentText)
+	if err != nil {
+		return
+	}
+	newFields, newText, err := documentFields(r.NewState, r.documentText)
+	if err != nil {
+		return
+	}
+
+	r.Structure = "Document"
+	r.compareFields(oldFields, newFields)
+	r.compareTexts(oldText, newText)
+}
+
+// compareTexts records the changed lines of the texts of two versions of
+// a document, matching texts by location
+func (r *Result) compareTexts(a, b []docText) {
+	for _, t := range a {
+		i := slices.IndexFunc(b, func(u docText) bool { return u.location == t.location })
+		if i < 0 {
+			r.compareLines(t.location, t.lines, nil)
+			continue
+		}
+		r.compareLines(t.location, t.lines, b[i].lines)
+	}
+	for _, u := range b {
+		if !slices.ContainsFunc(a, func(t docText) bool { return t.location == u.location }) {
+			r.compareLines(u.location, nil, u.lines)
+		}
+	}
+}
+
+// documentFields reads the metadata of an office document and, with text,
+// its text. A missing file has none.
+func documentFields(s *state.FileState, text bool) ([]field, []docText, error) {
+	if s == nil || !s.Exists {
+		return nil, nil, nil
+	}
+	archive, err := zip.NewReader(bytes.NewReader(s.Content), int64(len(s.Content)))
+	if err != nil {
+		return nil, nil, err
+	}
+	parts := make(map[string]*zip.File, len(archive.File))
+	for _, f := range archive.File {
+		parts[f.Name] = f
+	}
+
+	var fields []field
+	var texts []docText
+	if _, ok := parts["meta.xml"]; ok {
+		fields, err = odfMeta(parts)
+		if err == nil && text {
+			texts, err = odfText(parts)
+		}
+	} else {
+		fields, err = ooxmlMeta(parts)
+		if err == nil && text {
+			texts, err = ooxmlText(parts)
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return append(fields, field{location: "size", value: fmt.Sprintf("%d bytes", len(s.Content))}), texts, nil
+}
+
+// ooxmlMeta reads the core and application properties of an Office Open
+// XML document, and the names of the sheets of a workbook
+func ooxmlMeta(parts map[string]*zip.File) ([]field, error) {
+	if parts["[Content_Types].xml"] == nil {
+		return nil, errors.New("not an office document")
+	}
+
+	var core struct {
+		Title          string `xml:"title"`
+		Subject        string `xml:"subject"`
+		Creator        string `xml:"creator"`
+		LastModifiedBy string `xml:"lastModifiedBy"`
+		Revision       string `xml:"revision"`
+		Created        string `xml:"created"`
+		Modified       string `xml:"modified"`
+	}
+	if err := decodePart(parts, "docProps/core.xml", &core); err != nil {
+		return nil, err
+	}
+	var app struct {
+		Application string `xml:"Application"`
+		Pages       string `xml:"Pages"`
+		Slides      string `xml:"Slides"`
+		Words       string `xml:"Words"`
+	}
+	if err := decodePart(parts, "docProps/app.xml", &app); err != nil {
+		return nil, err
+	}
+	var workbook struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := decodePart(parts, "xl/workbook.xml", &workbook); err != nil {
+		return nil, err
+	}
+	var sheets []string
+	for _, sheet := range workbook.Sheets {
+		sheets = append(sheets, sheet.Name)
+	}
+
+	return documentMeta([]field{
+		{"title", core.Title},
+		{"subject", core.Subject},
+		{"author", core.Creator},
+		{"modified by", core.LastModifiedBy},
+		{"created", core.Created},
+		{"modified", core.Modified},
+		{"revision", core.Revision},
+		{"application", app.Application},
+		{"pages", app.Pages},
+		{"slides", app.Slides},
+		{"words", app.Words},
+		{"sheets", strings.Join(sheets, ", ")},
+	}), nil
+}
+
+// odfMeta reads the metadata of an OpenDocument file
+func odfMeta(parts map[string]*zip.File) ([]field, error) {
+	var doc struct {
+		Title     string `xml:"meta>title"`
+		Subject   string `xml:"meta>subject"`
+		Author    string `xml:"meta>initial-creator"`
+		Creator   string `xml:"meta>creator"`
+		Created   string `xml:"meta>creation-date"`
+		Modified  string `xml:"meta>date"`
+		Revision  string `xml:"meta>editing-cycles"`
+		Generator string `xml:"meta>generator"`
+		Stats     struct {
+			Pages  string `xml:"page-count,attr"`
+			Words  string `xml:"word-count,attr"`
+			Tables string `xml:"table-count,attr"`
+		} `xml:"meta>document-statistic"`
+	}
+	if err := decodePart(parts, "meta.xml", &doc); err != nil {
+		return nil, err
+	}
+
+	return documentMeta([]field{
+		{"title", doc.Title},
+		{"subject", doc.Subject},
+		{"author", doc.Author},
+		{"modified by", doc.Creator},
+		{"created", doc.Created},
+		{"modified", doc.Modified},
+		{"revision", doc.Revision},
+		{"application", doc.Generator},
+		{"pages", doc.Stats.Pages},
+		{"words", doc.Stats.Words},
+		{"tables", doc.Stats.Tables},
+	}), nil
+}
+
+// documentMeta drops the fields without a value
+func documentMeta(fields []field) []field {
+	return slices.DeleteFunc(fields, func(f field) bool {
+		return strings.TrimSpace(f.value) == ""
+	})
+}
+
+// ooxmlText extracts the paragraphs of the body of a word processing
+// document, of each slide of a presentation or of the shared strings of a
+// workbook
+func ooxmlText(parts map[string]*zip.File) ([]docText, error) {
+	var slides []string
+	for name := range parts {
+		if path.Dir(name) == "ppt/slides" && strings.HasSuffix(name, ".xml") {
+			slides = append(slides, name)
+		}
+	}
+	if len(slides) > 0 {
+		slices.SortFunc(slides, func(a, b string) int { return slideNumber(a) - slideNumber(b) })
+		texts := make([]docText, 0, len(slides))
+		for _, name := range slides {
+			lines, err := partParagraphs(parts, name, "t")
+			if err != nil {
+				return nil, err
+			}
+			texts = append(texts, docText{location: fmt.Sprintf("slide %d", slideNumber(name)), lines: lines})
+		}
+		return texts, nil
+	}
+
+	for _, name := range []string{"word/document.xml", "xl/sharedStrings.xml"} {
+		if parts[name] == nil {
+			continue
+		}
+		lines, err := partParagraphs(parts, name, "t")
+		if err != nil {
+			return nil, err
+		}
+		return []docText{{location: "text", lines: lines}}, nil
+	}
+	return nil, nil
+}
+
+// slideNumber returns the number of a slide part, e.g. 12 for
+// ppt/slides/slide12.xml
+func slideNumber(name string) int {
+	n, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(path.Base(name), "slide"), ".xml"))
+	return n
+}
+
+// odfText extracts the paragraphs and headings of an OpenDocument file
+func odfText(parts map[string]*zip.File) ([]docText, error) {
+	lines, err := partParagraphs(parts, "content.xml", "")
+	if err != nil {
+		return nil, err
+	}
+	return []docText{{location: "text", lines: lines}}, nil
+}
+
+// partParagraphs returns the text of each non-empty paragraph of an XML
+// part, taken from the elements named textElement
+// within it, or from all of it for "". Tabs are kept, other elements
+// between runs of text are dropped.
+func partParagraphs(parts map[string]*zip.File, name, textElement string) ([]string, error) {
+	data, err := readPart(parts, name)
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	var lines []string
+	var line strings.Builder
+	depth, inText := 0, 0
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			return lines, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch local := t.Name.Local; {
+			case paragraph(local):
+				depth++
+			case depth > 0 && local == "tab":
+				line.WriteString("\t")
+			case depth > 0 && local == "s" && textElement == "":
+				line.WriteString(" ")
+			case local == textElement:
+				inText++
+			}
+		case xml.EndElement:
+			switch local := t.Name.Local; {
+			case local == textElement:
+				inText--
+			case paragraph(local) && depth > 0:
+				if depth--; depth == 0 {
+					if text := strings.TrimSpace(line.String()); text != "" {
+						lines = append(lines, text)
+					}
+					line.Reset()
+				}
+			}
+		case xml.CharData:
+			if depth > 0 && (textElement == "" || inText > 0) {
+				line.Write(t)
+			}
+		}
+	}
+}
+
+// paragraph reports whether an element is a paragraph: p in documents
+// and slides, h for OpenDocument headings, si for the strings of a
+// workbook
+func paragraph(local string) bool {
+	return local == "p" || local == "h" || local == "si"
+}
+
+// decodePart decodes an XML part of a document into v. Missing parts
+// leave v as it is.
+func decodePart(parts map[string]*zip.File, name string, v any) error {
+	data, err := readPart(parts, name)
+	if err != nil || data == nil {
+		return err
+	}
+	if err := xml.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// readPart reads a part of a document, nil if it has none of that name
+func readPart(parts map[string]*zip.File, name string) ([]byte, error) {
+	f := parts[name]
+	if f == nil {
+		return nil, nil
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, maxDocumentPart+1))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if len(data) > maxDocumentPart {
+		return nil, fmt.Errorf("%s: larger than %d bytes", name, maxDocumentPart)
+	}
+	return data, nil
+}
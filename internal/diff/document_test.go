@@ -0,0 +1,107 @@
+package diff
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/deemkeen/diffwatch/internal/state"
+)
+
+// document returns the state of the document under testdata called name
+// as if it were at path, or of a missing file for ""
+func document(t *testing.T, path, name string) *state.FileState {
+	t.Helper()
+	if name == "" {
+		return &state.FileState{Path: path}
+	}
+	content, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fileState(path, string(content))
+}
+
+func TestDiffDocuments(t *testing.T) {
+	pdfMetadata := []Change{
+		{Type: LineModified, Location: "title", Old: "Quarterly report", New: "Quarterly report (final)"},
+		{Type: LineModified, Location: "modified", Old: "2024-01-05 10:00:00 UTC", New: "2024-01-06 12:00:00 UTC"},
+		{Type: LineModified, Location: "pages", Old: "1", New: "2"},
+		{Type: LineModified, Location: "size", Old: "853 bytes", New: "1165 bytes"},
+	}
+	docxMetadata := []Change{
+		{Type: LineModified, Location: "modified", Old: "2024-03-01T09:30:00Z", New: "2024-03-02T14:00:00Z"},
+		{Type: LineModified, Location: "revision", Old: "1", New: "2"},
+		{Type: LineModified, Location: "words", Old: "9", New: "12"},
+		{Type: LineModified, Location: "size", Old: "1763 bytes", New: "1783 bytes"},
+	}
+
+	tests := []struct {
+		name      string
+		path      string
+		old, new  string // Files under testdata, "" for a missing one
+		text      bool   // Compare the text too
+		structure string
+		want      []Change
+	}{
+		{
+			name: "pdf metadata", path: "report.pdf", old: "report-v1.pdf", new: "report-v2.pdf",
+			structure: "PDF", want: pdfMetadata,
+		},
+		{
+			// The text comes after the metadata, by line
+			name: "pdf text", path: "report.pdf", old: "report-v1.pdf", new: "report-v2.pdf", text: true,
+			structure: "PDF", want: append(slices.Clone(pdfMetadata),
+				Change{Type: LineModified, Location: "text:1", Old: "Revenue grew by 4 percent.", New: "Revenue grew by 5 percent."},
+				Change{Type: LineAdded, Location: "text:3", New: "Outlook: steady."},
+			),
+		},
+		{
+			name: "pdf created", path: "report.pdf", new: "report-v1.pdf",
+			structure: "PDF", want: []Change{
+				{Type: LineAdded, Location: "version", New: "1.4"},
+				{Type: LineAdded, Location: "title", New: "Quarterly report"},
+				{Type: LineAdded, Location: "author", New: "Ada Lovelace"},
+				{Type: LineAdded, Location: "producer", New: "diffwatch tests"},
+				{Type: LineAdded, Location: "created", New: "2024-01-02 03:04:05 UTC"},
+				{Type: LineAdded, Location: "modified", New: "2024-01-05 10:00:00 UTC"},
+				{Type: LineAdded, Location: "pages", New: "1"},
+				{Type: LineAdded, Location: "size", New: "853 bytes"},
+			},
+		},
+		{
+			name: "docx metadata", path: "memo.docx", old: "memo-v1.docx", new: "memo-v2.docx",
+			structure: "Document", want: docxMetadata,
+		},
+		{
+			name: "docx text", path: "memo.docx", old: "memo-v1.docx", new: "memo-v2.docx", text: true,
+			structure: "Document", want: append(slices.Clone(docxMetadata),
+				Change{Type: LineModified, Location: "text:1", Old: "Meeting moved to Friday.", New: "Meeting moved to Thursday."},
+				Change{Type: LineAdded, Location: "text:3", New: "Lunch is provided."},
+			),
+		},
+		// Not a document despite the name: a binary change like any other
+		{name: "not a pdf", path: "report.pdf", old: "report-v1.pdf", new: "report-broken.pdf"},
+		{name: "truncated docx", path: "memo.docx", old: "memo-v1.docx", new: "memo-broken.docx"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := New("", "")
+			e.SetDocumentText(tt.text)
+			result, err := e.Compute(document(t, tt.path, tt.old), document(t, tt.path, tt.new))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !result.IsBinary {
+				t.Error("not a binary change")
+			}
+			if result.Structure != tt.structure {
+				t.Fatalf("structure %q, want %q", result.Structure, tt.structure)
+			}
+			if !slices.Equal(result.Changes, tt.want) {
+				t.Errorf("changes %+v, want %+v", result.Changes, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/deemkeen/diffwatch/internal/state"
+)
+
+// diffDotenv replaces the line diff of a .env file by the keys that were
+// added, removed or changed, so reordering keys or comments shows up as
+// "only formatting changed". Files with lines that aren't assignments
+// keep their line diff.
+func diffDotenv(r *Result) {
+	oldFields, err := dotenvFields(r.OldState)
+	if err != nil {
+		return
+	}
+	newFields, err := dotenvFields(r.NewState)
+	if err != nil {
+		return
+	}
+
+	r.Structure = "Environment"
+	r.compareFields(oldFields, newFields)
+}
+
+// dotenvFields parses the assignments of a .env file, in their order.
+// A key assigned twice has its last value, as loaders do. A missing file
+// has none.
+func dotenvFields(s *state.FileState) ([]field, error) {
+	if s == nil || !s.Exists {
+		return nil, nil
+	}
+
+	var fields []field
+	index := make(map[string]int)
+	lines := strings.Split(string(s.Content), "\n")
+	for n := 0; n < len(lines); n++ {
+		line := strings.TrimSpace(lines[n])
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := envAssignment(line)
+		if !ok {
+			return nil, fmt.Errorf("line %d: not an assignment", n+1)
+		}
+
+		// Double quoted values may span lines
+		for strings.HasPrefix(value, `"`) && !closedQuote(value) && n+1 < len(lines) {
+			n++
+			value += "\n" + strings.TrimRight(lines[n], " \t\r")
+		}
+		value = envValue(value)
+
+		if i, ok := index[key]; ok {
+			fields[i].value = value
+			continue
+		}
+		index[key] = len(fields)
+		fields = append(fields, field{location: key, value: value})
+	}
+	return fields, nil
+}
+
+// envAssignment splits a trimmed line of the form [export] KEY=value
+func envAssignment(line string) (key, value string, ok bool) {
+	line = strings.TrimPrefix(line, "export ")
+	key, value, ok = strings.Cut(line, "=")
+	key = strings.TrimSpace(key)
+	if !ok || key == "" || strings.ContainsAny(key, " \t\"'") {
+		return "", "", false
+	}
+	return key, strings.TrimSpace(value), true
+}
+
+// closedQuote reports whether a double quoted value has its closing quote
+func closedQuote(value string) bool {
+	return strings.IndexByte(value[1:], '"') >= 0
+}
+
+// envValue returns what is inside the quotes of a quoted value, or an
+// unquoted value without its trailing comment
+func envValue(value string) string {
+	if value != "" && (value[0] == '"' || value[0] == '\'') {
+		if end := strings.IndexByte(value[1:], value[0]); end >= 0 {
+			return value[1 : end+1]
+		}
+	}
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return value
+}
+
+// MaskEnvPatch masks the values in the hunks of a unified diff of a .env
+// file with MaskEnv, leaving its headers as they are
+func MaskEnvPatch(patch, mask string) string {
+	var b strings.Builder
+	inHunk := false
+	for _, line := range strings.SplitAfter(patch, "\n") {
+		if strings.HasPrefix(line, "@@") {
+			inHunk = true
+		} else if inHunk && line != "" && strings.ContainsRune("+- ", rune(line[0])) {
+			line = line[:1] + MaskEnv(line[1:], mask)
+		}
+		b.WriteString(line)
+	}
+	return b.String()
+}
+
+// MaskEnv replaces the value of a .env line with mask, keeping its key,
+// so the line shows which key changed but not to what. Empty values are
+// kept, lines that aren't assignments, like continued quoted values, are
+// masked whole. Commented out assignments are masked like others.
+func MaskEnv(line, mask string) string {
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" {
+		return line
+	}
+
+	body := trimmed
+	if strings.HasPrefix(trimmed, "#") {
+		body = strings.TrimSpace(strings.TrimPrefix(trimmed, "#"))
+		if _, _, ok := envAssignment(body); !ok {
+			return line
+		}
+	}
+
+	ending := line[len(strings.TrimRight(line, "\r\n")):]
+	_, value, ok := envAssignment(body)
+	if !ok {
+		return mask + ending
+	}
+	if envValue(value) == "" {
+		return line
+	}
+	return line[:strings.Index(line, "=")+1] + mask + ending
+}
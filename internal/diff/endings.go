@@ -0,0 +1,90 @@
+package diff
+
+import "strings"
+
+// LineEnding is how a line is terminated
+type LineEnding int
+
+const (
+	EndingLF   LineEnding = iota // "\n"
+	EndingCRLF                   // "\r\n"
+	EndingNone                   // Last line of a file without a final newline
+)
+
+// Line ending styles of a file, see EOLStyle
+const (
+	StyleLF    = "LF"
+	StyleCRLF  = "CRLF"
+	StyleMixed = "mixed"
+)
+
+// trimEnding strips the terminator from a line as returned by SplitLines
+func trimEnding(line string) (string, LineEnding) {
+	switch {
+	case strings.HasSuffix(line, "\r\n"):
+		return line[:len(line)-2], EndingCRLF
+	case strings.HasSuffix(line, "\n"):
+		return line[:len(line)-1], EndingLF
+	default:
+		return line, EndingNone
+	}
+}
+
+// EOLStyle returns the line ending style of content: StyleLF, StyleCRLF,
+// StyleMixed, or "" if it has no line breaks
+func EOLStyle(content []byte) string {
+	var lf, crlf int
+	for i, b := range content {
+		if b != '\n' {
+			continue
+		}
+		if i > 0 && content[i-1] == '\r' {
+			crlf++
+		} else {
+			lf++
+		}
+	}
+
+	switch {
+	case lf > 0 && crlf > 0:
+		return StyleMixed
+	case crlf > 0:
+		return StyleCRLF
+	case lf > 0:
+		return StyleLF
+	default:
+		return ""
+	}
+}
+
+// EndingsChanged reports whether the line ending style differs between
+// the two versions or the new version mixes styles, so individual line
+// endings are worth showing
+func (r *Result) EndingsChanged() bool {
+	if r.NewEOL == StyleMixed {
+		return true
+	}
+	return r.OldEOL != "" && r.NewEOL != "" && r.OldEOL != r.NewEOL
+}
+
+// withEnding moves the terminator of the line's content into Ending
+func (l DiffLine) withEnding() DiffLine {
+	l.Content, l.Ending = trimEnding(l.Content)
+	return l
+}
+
+// displayLines converts lines as returned by SplitLines into diff lines of
+// type t, numbered from 1
+func displayLines(lines []string, t LineType) []DiffLine {
+	result := make([]DiffLine, 0, len(lines))
+	for i, raw := range lines {
+		line := DiffLine{Type: t, Content: raw}
+		if t == LineDeleted {
+			line.OldLineNum = i + 1
+		} else {
+			line.NewLineNum = i + 1
+		}
+		result = append(result, line.withEnding())
+	}
+	return result
+}
@@ -1,11 +1,11 @@
 package diff
 
 import (
-	"fmt"
+	"path/filepath"
 	"strings"
 
+	"github.com/deemkeen/diffwatch/internal/lang"
 	"github.com/deemkeen/diffwatch/internal/state"
-	"github.com/pmezard/go-difflib/difflib"
 )
 
 // LineType represents the type of change in a line
@@ -16,40 +16,159 @@ const (
 	LineAdded
 	LineDeleted
 	LineModified
+	LineGap // Unchanged lines that were not read, between changed regions of a large file
 )
 
 // DiffLine represents a single line in the diff with metadata
 type DiffLine struct {
 	Type       LineType
-	OldLineNum int // 0 if not applicable
-	NewLineNum int // 0 if not applicable
-	Content    string
-	OldContent string // For modified lines, to show character-level diff
+	OldLineNum int          // 0 if not applicable
+	NewLineNum int          // 0 if not applicable
+	Content    string       // Line without its terminator
+	OldContent string       // For modified lines, to show character-level diff
+	Ending     LineEnding   // How the line is terminated
+	Conflict   ConflictPart // Role in a git conflict region of the new content
+	Scope      string       // Declaration the line belongs to and what happened to it, set by language handlers
 }
 
 // Result represents the result of a diff operation
 type Result struct {
 	Path      string
+	Language  *lang.Language // Detected file type, nil if unknown
 	OldState  *state.FileState
 	NewState  *state.FileState
-	Unified   string
+	Unified   string     // Standard unified diff, see Patch
 	Lines     []DiffLine // Structured diff lines for better rendering
 	HasDiff   bool
 	IsNew     bool // File was created
 	IsDeleted bool // File was deleted
 	IsBinary  bool // File is binary (don't show diff content)
+	TooLarge  bool // File is too large to diff (no lines)
+	Locked    bool // File is locked by another process and couldn't be read (no lines)
+	Streamed  bool // Large file: only changed regions were read and diffed
+	Omitted   int  // Changed regions of a streamed diff left out to bound memory and output
+
+	SummaryOnly string // Why the lines aren't shown, e.g. for a generated file; empty to show them
+	Dangerous   string // Why the change is dangerous, e.g. it modifies an applied migration; empty if it isn't
+
+	Structure string   // What Changes are made of, e.g. "XML"; empty if no handler understood the file
+	Changes   []Change // Changes to the elements of a structured file, found by the handler of its language
+
+	OldEOL, NewEOL string // Line ending style of each version, see EOLStyle
+
+	Conflicts    int // Git conflict regions in the new content
+	OldConflicts int // Git conflict regions in the old content
+
+	RenamedFrom string // Previous path if the file was renamed, otherwise empty
+	Similarity  int    // For renames, share of lines kept in percent
+
+	algorithm    Algorithm // Matched the lines, also used for Patch
+	documentText bool      // Handlers of PDF and office documents also compare their text
+}
+
+// Stats returns the number of added and deleted lines in the diff
+func (r *Result) Stats() (added, deleted int) {
+	for _, line := range r.Lines {
+		switch line.Type {
+		case LineAdded:
+			added++
+		case LineDeleted:
+			deleted++
+		}
+	}
+	return added, deleted
 }
 
 // Engine computes diffs between file states
-type Engine struct{}
+type Engine struct {
+	root      string // Directory patch file names are relative to
+	algorithm Algorithm
+	cache     *cache // Latest results by transition, nil if disabled
+
+	documentText bool // Compare the text of PDF and office documents, not only their metadata
+}
 
-// New creates a new diff engine
-func New() *Engine {
-	return &Engine{}
+// New creates a new diff engine matching lines with alg, or the default
+// algorithm of each file's language for "". Unified diffs name files
+// relative to root.
+func New(root string, alg Algorithm) *Engine {
+	return &Engine{root: root, algorithm: alg}
 }
 
-// Compute computes the diff between two file states
+// SetCacheLimits caches up to limits of the latest results, dropping the
+// results cached so far
+func (e *Engine) SetCacheLimits(limits CacheLimits) {
+	e.cache = newCache(limits)
+}
+
+// SetDocumentText makes the handlers of PDF and office documents compare
+// the text extracted from them besides their metadata
+func (e *Engine) SetDocumentText(on bool) {
+	e.documentText = on
+}
+
+// CacheStats returns how well the result cache does
+func (e *Engine) CacheStats() CacheStats {
+	return e.cache.report()
+}
+
+// patchName returns the file name used in unified diff headers for path:
+// relative to the engine's root if below it, otherwise the full path
+func (e *Engine) patchName(path string) string {
+	if e.root != "" {
+		if rel, err := filepath.Rel(e.root, path); err == nil && !strings.HasPrefix(rel, "..") {
+			path = rel
+		}
+	}
+	return strings.TrimPrefix(filepath.ToSlash(path), "/")
+}
+
+// handlers refine the results of file types with structure beyond lines,
+// by language ID. They run after the line diff and leave the result as it
+// is if they cannot make sense of the content.
+var handlers = map[string]func(*Result){
+	"document":   diffDocument,
+	"dotenv":     diffDotenv,
+	"go":         diffGo,
+	"ini":        diffINI,
+	"ipynb":      diffNotebook,
+	"json":       diffTerraformPlan,
+	"lockfile":   diffLockfile,
+	"pdf":        diffPDF,
+	"pem":        diffCert,
+	"properties": diffProperties,
+	"proto":      diffProto,
+	"tfstate":    diffTerraformState,
+	"xml":        diffXML,
+}
+
+// Compute computes the diff between two file states. Results of
+// transitions computed lately are taken from the cache if it's enabled.
 func (e *Engine) Compute(oldState, newState *state.FileState) (*Result, error) {
+	key, cacheable := keyOf(oldState, newState)
+	if cacheable {
+		if result := e.cache.get(key, oldState, newState); result != nil {
+			return result, nil
+		}
+	}
+
+	result, err := e.compute(oldState, newState)
+	if err != nil {
+		return nil, err
+	}
+	if result.Language != nil && result.HasDiff {
+		if handle, ok := handlers[result.Language.ID]; ok {
+			handle(result)
+		}
+	}
+	if cacheable {
+		e.cache.put(key, result)
+	}
+	return result, nil
+}
+
+// compute computes the line diff between two file states
+func (e *Engine) compute(oldState, newState *state.FileState) (*Result, error) {
 	result := &Result{
 		Path:     newState.Path,
 		OldState: oldState,
@@ -57,29 +176,38 @@ func (e *Engine) Compute(oldState, newState *state.FileState) (*Result, error) {
 		Lines:    make([]DiffLine, 0),
 	}
 
+	if newState.Exists {
+		result.Language = lang.Detect(newState.Path, newState.Content)
+	} else {
+		result.Language = lang.Detect(oldState.Path, oldState.Content)
+	}
+	result.algorithm = e.algorithm.For(result.Language)
+	result.documentText = e.documentText
+
+	if oldState.Exists && oldState.Path != newState.Path {
+		result.RenamedFrom = oldState.Path
+		result.Similarity = state.Similarity(oldState.Content, newState.Content)
+	}
+	if oldState.Exists {
+		result.OldEOL = EOLStyle(oldState.Content)
+	}
+	if newState.Exists {
+		result.NewEOL = EOLStyle(newState.Content)
+	}
+
 	// Handle file deletion
 	if !newState.Exists && oldState.Exists {
 		result.HasDiff = true
 		result.IsDeleted = true
 
 		// Check if deleted file was binary
-		if isBinary(oldState.Content) {
-			result.IsBinary = true
-			result.Unified = fmt.Sprintf("Binary file %s deleted\n", oldState.Path)
+		result.IsBinary = IsBinary(oldState.Content)
+		result.Unified = result.patch(e.patchName(result.Path))
+		if result.IsBinary {
 			return result, nil
 		}
 
-		result.Unified = fmt.Sprintf("--- %s\n+++ (deleted)\n", oldState.Path)
-
-		// Add deleted lines
-		oldLines := strings.Split(string(oldState.Content), "\n")
-		for i, line := range oldLines {
-			result.Lines = append(result.Lines, DiffLine{
-				Type:       LineDeleted,
-				OldLineNum: i + 1,
-				Content:    line,
-			})
-		}
+		result.Lines = displayLines(SplitLines(oldState.Content), LineDeleted)
 		return result, nil
 	}
 
@@ -89,68 +217,43 @@ func (e *Engine) Compute(oldState, newState *state.FileState) (*Result, error) {
 		result.IsNew = true
 
 		// Check if new file is binary
-		if isBinary(newState.Content) {
-			result.IsBinary = true
-			result.Unified = fmt.Sprintf("Binary file %s created\n", newState.Path)
+		result.IsBinary = IsBinary(newState.Content)
+		result.Unified = result.patch(e.patchName(result.Path))
+		if result.IsBinary {
 			return result, nil
 		}
 
-		result.Unified = fmt.Sprintf("--- (new file)\n+++ %s\n", newState.Path)
-
-		// Add new lines
-		newLines := strings.Split(string(newState.Content), "\n")
-		for i, line := range newLines {
-			result.Lines = append(result.Lines, DiffLine{
-				Type:       LineAdded,
-				NewLineNum: i + 1,
-				Content:    line,
-			})
-		}
+		result.Lines = displayLines(SplitLines(newState.Content), LineAdded)
+		result.Conflicts = markConflicts(result.Lines)
 		return result, nil
 	}
 
 	// Both exist, compute diff
 	if oldState.Exists && newState.Exists {
 		// Check if either version is binary
-		oldIsBinary := isBinary(oldState.Content)
-		newIsBinary := isBinary(newState.Content)
+		oldIsBinary := IsBinary(oldState.Content)
+		newIsBinary := IsBinary(newState.Content)
 
 		if oldIsBinary || newIsBinary {
 			result.IsBinary = true
 			result.HasDiff = true
-
-			if oldIsBinary && newIsBinary {
-				result.Unified = fmt.Sprintf("Binary file %s modified\n", newState.Path)
-			} else if newIsBinary {
-				result.Unified = fmt.Sprintf("File %s changed from text to binary\n", newState.Path)
-			} else {
-				result.Unified = fmt.Sprintf("File %s changed from binary to text\n", newState.Path)
-			}
+			result.Unified = result.patch(e.patchName(result.Path))
 			return result, nil
 		}
 
-		oldLines := strings.Split(string(oldState.Content), "\n")
-		newLines := strings.Split(string(newState.Content), "\n")
+		// Lines keep their terminators, so a changed line ending or final
+		// newline is a change
+		oldLines := SplitLines(oldState.Content)
+		newLines := SplitLines(newState.Content)
 
 		// Generate unified diff for the Unified field
-		diff := difflib.UnifiedDiff{
-			A:        oldLines,
-			B:        newLines,
-			FromFile: oldState.Path,
-			ToFile:   newState.Path,
-			Context:  3,
-		}
-
-		unified, err := difflib.GetUnifiedDiffString(diff)
-		if err != nil {
-			return nil, fmt.Errorf("computing diff: %w", err)
-		}
-
-		result.Unified = unified
-		result.HasDiff = len(unified) > 0
+		result.Unified = result.patch(e.patchName(result.Path))
+		result.HasDiff = result.Unified != ""
 
 		// Generate structured diff lines
-		result.Lines = e.computeStructuredDiff(oldLines, newLines)
+		result.Lines = structuredDiff(oldLines, newLines, result.algorithm)
+		result.Conflicts = markConflicts(result.Lines)
+		result.OldConflicts = countConflicts(oldState.Content)
 
 		return result, nil
 	}
@@ -159,15 +262,28 @@ func (e *Engine) Compute(oldState, newState *state.FileState) (*Result, error) {
 	return result, nil
 }
 
-// computeStructuredDiff creates a structured representation of the diff
-func (e *Engine) computeStructuredDiff(oldLines, newLines []string) []DiffLine {
-	// Use difflib's sequence matcher to get opcodes
-	matcher := difflib.NewMatcher(oldLines, newLines)
-	opcodes := matcher.GetOpCodes()
+// Lines diffs two sets of lines as returned by SplitLines with alg. Line
+// numbers start after oldStart and newStart, for diffing a region of a
+// file.
+func Lines(oldLines, newLines []string, oldStart, newStart int, alg Algorithm) []DiffLine {
+	lines := structuredDiff(oldLines, newLines, alg)
+	for i := range lines {
+		if lines[i].OldLineNum > 0 {
+			lines[i].OldLineNum += oldStart
+		}
+		if lines[i].NewLineNum > 0 {
+			lines[i].NewLineNum += newStart
+		}
+	}
+	return lines
+}
 
+// structuredDiff creates a structured representation of the diff
+// between lines as returned by SplitLines
+func structuredDiff(oldLines, newLines []string, alg Algorithm) []DiffLine {
 	var lines []DiffLine
 
-	for _, opcode := range opcodes {
+	for _, opcode := range OpCodes(oldLines, newLines, alg) {
 		tag := opcode.Tag
 		i1, i2, j1, j2 := opcode.I1, opcode.I2, opcode.J1, opcode.J2
 
@@ -179,7 +295,7 @@ func (e *Engine) computeStructuredDiff(oldLines, newLines []string) []DiffLine {
 					OldLineNum: i + 1,
 					NewLineNum: j1 + (i - i1) + 1,
 					Content:    oldLines[i],
-				})
+				}.withEnding())
 			}
 
 		case 'd': // delete
@@ -188,7 +304,7 @@ func (e *Engine) computeStructuredDiff(oldLines, newLines []string) []DiffLine {
 					Type:       LineDeleted,
 					OldLineNum: i + 1,
 					Content:    oldLines[i],
-				})
+				}.withEnding())
 			}
 
 		case 'i': // insert
@@ -197,7 +313,7 @@ func (e *Engine) computeStructuredDiff(oldLines, newLines []string) []DiffLine {
 					Type:       LineAdded,
 					NewLineNum: j + 1,
 					Content:    newLines[j],
-				})
+				}.withEnding())
 			}
 
 		case 'r': // replace (modification)
@@ -207,14 +323,14 @@ func (e *Engine) computeStructuredDiff(oldLines, newLines []string) []DiffLine {
 					Type:       LineDeleted,
 					OldLineNum: i + 1,
 					Content:    oldLines[i],
-				})
+				}.withEnding())
 			}
 			for j := j1; j < j2; j++ {
 				lines = append(lines, DiffLine{
 					Type:       LineAdded,
 					NewLineNum: j + 1,
 					Content:    newLines[j],
-				})
+				}.withEnding())
 			}
 		}
 	}
@@ -222,9 +338,9 @@ func (e *Engine) computeStructuredDiff(oldLines, newLines []string) []DiffLine {
 	return lines
 }
 
-// isBinary checks if content appears to be binary data
+// IsBinary checks if content appears to be binary data
 // It checks for null bytes and high ratio of non-printable characters
-func isBinary(content []byte) bool {
+func IsBinary(content []byte) bool {
 	if len(content) == 0 {
 		return false
 	}
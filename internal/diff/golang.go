@@ -0,0 +1,167 @@
+package diff
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"strings"
+)
+
+// goDecl is a top-level declaration of a Go file
+type goDecl struct {
+	key   string // Identifies the declaration across versions, e.g. "func (*Server).Start"
+	title string // How the declaration reads, e.g. "func (s *Server) Start(ctx context.Context) error"
+}
+
+// diffGo labels the changed lines of a Go file with the function, method,
+// type, variable or constant declaration they belong to, and whether the
+// declaration was added, removed or changed, so the diff can be grouped
+// by declaration. Files that don't parse, e.g. in the middle of an edit,
+// keep their plain diff.
+func diffGo(r *Result) {
+	if !r.bothVersions() {
+		return
+	}
+	oldDecls, err := goDecls(r.OldState.Content)
+	if err != nil {
+		return
+	}
+	newDecls, err := goDecls(r.NewState.Content)
+	if err != nil {
+		return
+	}
+
+	keys := func(decls []*goDecl) map[string]*goDecl {
+		out := make(map[string]*goDecl)
+		for _, d := range decls {
+			if d != nil {
+				out[d.key] = d
+			}
+		}
+		return out
+	}
+	oldKeys, newKeys := keys(oldDecls), keys(newDecls)
+
+	for i := range r.Lines {
+		line := &r.Lines[i]
+
+		var decl *goDecl
+		switch {
+		case line.Type == LineDeleted && line.OldLineNum < len(oldDecls):
+			decl = oldDecls[line.OldLineNum]
+		case line.Type != LineDeleted && line.NewLineNum < len(newDecls):
+			decl = newDecls[line.NewLineNum]
+		}
+		if decl == nil {
+			continue
+		}
+
+		// Changed declarations are titled as they read now
+		_, inOld := oldKeys[decl.key]
+		now, inNew := newKeys[decl.key]
+		switch {
+		case inOld && inNew:
+			line.Scope = now.title + " changed"
+		case inNew:
+			line.Scope = decl.title + " added"
+		default:
+			line.Scope = decl.title + " removed"
+		}
+	}
+}
+
+// goDecls parses a Go file and returns the top-level declaration each
+// line belongs to, by line number, nil for lines outside declarations.
+// Doc comments belong to their declaration.
+func goDecls(content []byte) ([]*goDecl, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", content, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := make([]*goDecl, fset.File(f.Pos()).LineCount()+2)
+	cover := func(d *goDecl, doc *ast.CommentGroup, from, to token.Pos) {
+		if doc != nil {
+			from = doc.Pos()
+		}
+		for l := fset.Position(from).Line; l <= fset.Position(to).Line && l < len(lines); l++ {
+			lines[l] = d
+		}
+	}
+
+	pkg := &goDecl{key: "package", title: "package " + f.Name.Name}
+	cover(pkg, f.Doc, f.Package, f.Name.End())
+
+	for _, decl := range f.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			cover(goFunc(fset, decl), decl.Doc, decl.Pos(), decl.End())
+
+		case *ast.GenDecl:
+			// The parentheses of a group belong to the group, its specs to
+			// themselves
+			kind := decl.Tok.String()
+			group := &goDecl{key: kind + " group", title: kind + " (…)"}
+			if decl.Tok == token.IMPORT {
+				group = &goDecl{key: "import", title: "imports"}
+			}
+			cover(group, decl.Doc, decl.Pos(), decl.End())
+			if decl.Tok == token.IMPORT {
+				continue
+			}
+
+			for _, spec := range decl.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					d := &goDecl{key: "type " + spec.Name.Name, title: "type " + spec.Name.Name + goTypeKind(spec.Type)}
+					cover(d, spec.Doc, spec.Pos(), spec.End())
+				case *ast.ValueSpec:
+					names := make([]string, len(spec.Names))
+					for i, name := range spec.Names {
+						names[i] = name.Name
+					}
+					title := kind + " " + strings.Join(names, ", ")
+					cover(&goDecl{key: title, title: title}, spec.Doc, spec.Pos(), spec.End())
+				}
+			}
+		}
+	}
+	return lines, nil
+}
+
+// goFunc describes a function or method by its signature
+func goFunc(fset *token.FileSet, decl *ast.FuncDecl) *goDecl {
+	key := "func " + decl.Name.Name
+	if decl.Recv != nil && len(decl.Recv.List) > 0 {
+		key = "func (" + goSource(fset, decl.Recv.List[0].Type) + ")." + decl.Name.Name
+	}
+	signature := &ast.FuncDecl{Recv: decl.Recv, Name: decl.Name, Type: decl.Type}
+	return &goDecl{key: key, title: goSource(fset, signature)}
+}
+
+// goTypeKind returns " struct" or " interface" for those types, "" for
+// others
+func goTypeKind(expr ast.Expr) string {
+	switch expr.(type) {
+	case *ast.StructType:
+		return " struct"
+	case *ast.InterfaceType:
+		return " interface"
+	}
+	return ""
+}
+
+// oneLine undoes the line breaks of a node printed over several lines
+var oneLine = strings.NewReplacer("( ", "(", ", )", ")")
+
+// goSource prints a node on one line
+func goSource(fset *token.FileSet, node any) string {
+	var b bytes.Buffer
+	if err := printer.Fprint(&b, fset, node); err != nil {
+		return ""
+	}
+	return oneLine.Replace(strings.Join(strings.Fields(b.String()), " "))
+}
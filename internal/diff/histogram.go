@@ -0,0 +1,74 @@
+package diff
+
+// histogramMaxCount is the most occurrences a line may have to anchor a
+// histogram diff. Ranges where all common lines are more frequent, like
+// runs of braces or blank lines, are left to Myers.
+const histogramMaxCount = 64
+
+// histogram marks the changed lines of a range with the histogram
+// algorithm, as git does: the longest run of equal lines around the
+// rarest line common to both sides is kept, and the ranges before and
+// after it are diffed the same way. Like patience it follows the
+// structure of code, but it also anchors on lines that aren't unique.
+func (d *differ) histogram(aLo, aHi, bLo, bHi int) {
+	aLo, aHi, bLo, bHi = d.trim(aLo, aHi, bLo, bHi)
+	if d.markAll(aLo, aHi, bLo, bHi) {
+		return
+	}
+
+	as, ae, bs, be, ok := d.rarestRun(aLo, aHi, bLo, bHi)
+	if !ok {
+		d.myers(aLo, aHi, bLo, bHi)
+		return
+	}
+
+	d.histogram(aLo, as, bLo, bs)
+	d.histogram(ae, aHi, be, bHi)
+}
+
+// rarestRun returns the run of equal lines a[as:ae] == b[bs:be] whose
+// rarest line occurs least often in a, the longest on ties. Reports false
+// if every common line occurs more than histogramMaxCount times.
+func (d *differ) rarestRun(aLo, aHi, bLo, bHi int) (as, ae, bs, be int, ok bool) {
+	positions := make(map[int][]int)
+	for i := aLo; i < aHi; i++ {
+		positions[d.a[i]] = append(positions[d.a[i]], i)
+	}
+
+	lowest := histogramMaxCount + 1
+	for j := bLo; j < bHi; {
+		next := j + 1
+		occurrences := positions[d.b[j]]
+		if len(occurrences) == 0 || len(occurrences) > lowest {
+			j = next
+			continue
+		}
+
+		for _, i := range occurrences {
+			s, t := i, j
+			for s > aLo && t > bLo && d.a[s-1] == d.b[t-1] {
+				s--
+				t--
+			}
+			e, f := i+1, j+1
+			rarest := len(occurrences)
+			for e < aHi && f < bHi && d.a[e] == d.b[f] {
+				rarest = min(rarest, len(positions[d.a[e]]))
+				e++
+				f++
+			}
+			for k := s; k < i; k++ {
+				rarest = min(rarest, len(positions[d.a[k]]))
+			}
+
+			if rarest < lowest || rarest == lowest && e-s > ae-as {
+				as, ae, bs, be, ok = s, e, t, f, true
+				lowest = rarest
+			}
+			// Lines inside the run can't start a longer one
+			next = max(next, f)
+		}
+		j = next
+	}
+	return as, ae, bs, be, ok
+}
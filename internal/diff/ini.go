@@ -0,0 +1,165 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/deemkeen/diffwatch/internal/state"
+)
+
+// diffINI replaces the line diff of an INI file by the keys that were
+// added, removed or changed, located as "[section] key", so moving keys
+// or sections and editing comments shows up as "only formatting changed".
+// Files that aren't INI, like .conf files of other syntaxes, keep their
+// line diff.
+func diffINI(r *Result) {
+	oldFields, err := iniFields(r.OldState)
+	if err != nil {
+		return
+	}
+	newFields, err := iniFields(r.NewState)
+	if err != nil {
+		return
+	}
+
+	r.Structure = "INI"
+	r.compareFields(oldFields, newFields)
+}
+
+// diffProperties replaces the line diff of a Java properties file by the
+// keys that were added, removed or changed
+func diffProperties(r *Result) {
+	r.Structure = "Properties"
+	r.compareFields(propertiesFields(r.OldState), propertiesFields(r.NewState))
+}
+
+// iniFields parses the keys of an INI file, in their order. Keys before
+// the first section have no section. A key assigned twice in a section
+// has its last value, and repeated sections are merged. A missing file
+// has none.
+func iniFields(s *state.FileState) ([]field, error) {
+	if s == nil || !s.Exists {
+		return nil, nil
+	}
+
+	var fields []field
+	index := make(map[string]int)
+	section, last := "", -1
+	for n, raw := range strings.Split(string(s.Content), "\n") {
+		line := strings.TrimSpace(raw)
+		switch {
+		case line == "" || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "#"):
+			continue
+
+		case strings.HasPrefix(line, "["):
+			name, ok := strings.CutSuffix(line, "]")
+			if !ok {
+				return nil, fmt.Errorf("line %d: unclosed section", n+1)
+			}
+			section, last = strings.TrimSpace(name[1:]), -1
+			continue
+		}
+
+		key, value, ok := iniAssignment(line)
+		if !ok {
+			// Indented lines may continue the value of the key above
+			if last >= 0 && (raw[0] == ' ' || raw[0] == '\t') {
+				fields[last].value += "\n" + line
+				continue
+			}
+			return nil, fmt.Errorf("line %d: not a key or section", n+1)
+		}
+		location := key
+		if section != "" {
+			location = "[" + section + "] " + key
+		}
+		if i, ok := index[location]; ok {
+			fields[i].value, last = value, i
+			continue
+		}
+		index[location] = len(fields)
+		last = len(fields)
+		fields = append(fields, field{location: location, value: value})
+	}
+	return fields, nil
+}
+
+// iniAssignment splits a trimmed line of the form key = value or
+// key: value. Keys separated by a colon can't contain spaces, so lines
+// like "ServerName example.com:80" of other syntaxes aren't taken for
+// keys.
+func iniAssignment(line string) (key, value string, ok bool) {
+	i := strings.IndexAny(line, "=:")
+	if i <= 0 {
+		return "", "", false
+	}
+	key = strings.TrimSpace(line[:i])
+	if line[i] == ':' && strings.ContainsAny(key, " \t") {
+		return "", "", false
+	}
+	return key, strings.TrimSpace(line[i+1:]), true
+}
+
+// propertiesFields parses the keys of a properties file, in their order:
+// key=value, key: value or key value, continued on the next line after a
+// trailing backslash. A missing file has none.
+func propertiesFields(s *state.FileState) []field {
+	if s == nil || !s.Exists {
+		return nil
+	}
+
+	var fields []field
+	index := make(map[string]int)
+	lines := strings.Split(string(s.Content), "\n")
+	for n := 0; n < len(lines); n++ {
+		line := strings.TrimLeft(strings.TrimRight(lines[n], "\r"), " \t\f")
+		if line == "" || line[0] == '#' || line[0] == '!' {
+			continue
+		}
+		for continued(line) && n+1 < len(lines) {
+			n++
+			line = line[:len(line)-1] + strings.TrimLeft(strings.TrimRight(lines[n], "\r"), " \t\f")
+		}
+
+		key, value := propertiesAssignment(line)
+		if i, ok := index[key]; ok {
+			fields[i].value = value
+			continue
+		}
+		index[key] = len(fields)
+		fields = append(fields, field{location: key, value: value})
+	}
+	return fields
+}
+
+// continued reports whether a properties line ends with an odd number of
+// backslashes, continuing on the next line
+func continued(line string) bool {
+	return (len(line)-len(strings.TrimRight(line, `\`)))%2 == 1
+}
+
+// propertiesAssignment splits a line into its key, which ends at the
+// first unescaped =, : or whitespace, and its value. Escapes in the key
+// are resolved.
+func propertiesAssignment(line string) (key, value string) {
+	var b strings.Builder
+	i := 0
+	for ; i < len(line); i++ {
+		c := line[i]
+		if c == '\\' && i+1 < len(line) {
+			i++
+			b.WriteByte(line[i])
+			continue
+		}
+		if c == '=' || c == ':' || c == ' ' || c == '\t' || c == '\f' {
+			break
+		}
+		b.WriteByte(c)
+	}
+
+	rest := strings.TrimLeft(line[i:], " \t\f")
+	if rest != "" && (rest[0] == '=' || rest[0] == ':') {
+		rest = strings.TrimLeft(rest[1:], " \t\f")
+	}
+	return b.String(), rest
+}
@@ -0,0 +1,165 @@
+package diff
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/deemkeen/diffwatch/internal/state"
+)
+
+// diffLockfile replaces the line diff of a lockfile, thousands of lines of
+// hashes for a single upgrade, by the packages that were added, removed or
+// changed version: go.sum, package-lock.json and Cargo.lock. A package
+// locked at several versions has them all as its value. Lockfiles that
+// don't parse keep their line diff.
+func diffLockfile(r *Result) {
+	oldFields, err := lockedPackages(r.OldState)
+	if err != nil {
+		return
+	}
+	newFields, err := lockedPackages(r.NewState)
+	if err != nil {
+		return
+	}
+
+	r.Structure = "Dependencies"
+	r.compareFields(oldFields, newFields)
+}
+
+// lockedPackages parses the packages of a lockfile and their versions,
+// sorted by name. A missing file has none.
+func lockedPackages(s *state.FileState) ([]field, error) {
+	if s == nil || !s.Exists {
+		return nil, nil
+	}
+
+	var versions map[string][]string
+	var err error
+	switch name := filepath.Base(s.Path); name {
+	case "go.sum":
+		versions, err = goSumVersions(string(s.Content))
+	case "package-lock.json":
+		versions, err = npmLockVersions(s.Content)
+	case "Cargo.lock":
+		versions, err = cargoLockVersions(string(s.Content))
+	default:
+		err = fmt.Errorf("unknown lockfile %s", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make([]field, 0, len(versions))
+	for name, vs := range versions {
+		slices.Sort(vs)
+		fields = append(fields, field{location: name, value: strings.Join(slices.Compact(vs), ", ")})
+	}
+	slices.SortFunc(fields, func(a, b field) int { return strings.Compare(a.location, b.location) })
+	return fields, nil
+}
+
+// goSumVersions parses the module versions of a go.sum file. Versions
+// listed only for their go.mod, which the build reads to resolve versions
+// but doesn't compile, are left out.
+func goSumVersions(content string) (map[string][]string, error) {
+	versions := make(map[string][]string)
+	for n, line := range strings.Split(content, "\n") {
+		parts := strings.Fields(line)
+		if len(parts) == 0 {
+			continue
+		}
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("line %d: not a module, version and hash", n+1)
+		}
+		if !strings.HasSuffix(parts[1], "/go.mod") {
+			versions[parts[0]] = append(versions[parts[0]], parts[1])
+		}
+	}
+	return versions, nil
+}
+
+// npmLockVersions parses the package versions of a package-lock.json file:
+// the packages map of lockfile versions 2 and 3, or the nested
+// dependencies of version 1
+func npmLockVersions(content []byte) (map[string][]string, error) {
+	type dependency struct {
+		Version      string                `json:"version"`
+		Dependencies map[string]dependency `json:"dependencies"`
+	}
+	var lock struct {
+		Packages map[string]struct {
+			Version string `json:"version"`
+		} `json:"packages"`
+		Dependencies map[string]dependency `json:"dependencies"`
+	}
+	if err := json.Unmarshal(content, &lock); err != nil {
+		return nil, err
+	}
+
+	versions := make(map[string][]string)
+	if lock.Packages != nil {
+		for location, pkg := range lock.Packages {
+			i := strings.LastIndex(location, "node_modules/")
+			if i < 0 || pkg.Version == "" {
+				// The root project and workspace links
+				continue
+			}
+			name := location[i+len("node_modules/"):]
+			versions[name] = append(versions[name], pkg.Version)
+		}
+		return versions, nil
+	}
+
+	var walk func(map[string]dependency)
+	walk = func(deps map[string]dependency) {
+		for name, dep := range deps {
+			if dep.Version != "" {
+				versions[name] = append(versions[name], dep.Version)
+			}
+			walk(dep.Dependencies)
+		}
+	}
+	walk(lock.Dependencies)
+	return versions, nil
+}
+
+// cargoLockVersions parses the package versions of a Cargo.lock file
+func cargoLockVersions(content string) (map[string][]string, error) {
+	versions := make(map[string][]string)
+	name, version, inPackage := "", "", false
+	flush := func() {
+		if inPackage && name != "" && version != "" {
+			versions[name] = append(versions[name], version)
+		}
+		name, version = "", ""
+	}
+
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") {
+			flush()
+			inPackage = line == "[[package]]"
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || !inPackage {
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "name":
+			name = strings.Trim(strings.TrimSpace(value), `"`)
+		case "version":
+			version = strings.Trim(strings.TrimSpace(value), `"`)
+		}
+	}
+	flush()
+
+	if len(versions) == 0 && strings.TrimSpace(content) != "" {
+		return nil, errors.New("no packages")
+	}
+	return versions, nil
+}
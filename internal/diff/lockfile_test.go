@@ -0,0 +1,139 @@
+package diff
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDiffLockfile(t *testing.T) {
+	// Each version removes left-pad, bumps react and adds loose-envify, in
+	// the packages of the format
+	npm := []Change{
+		{Type: LineDeleted, Location: "left-pad", Old: "1.3.0"},
+		{Type: LineModified, Location: "react", Old: "18.2.0", New: "18.3.1"},
+		{Type: LineAdded, Location: "loose-envify", New: "1.4.0"},
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		old, new string
+		want     []Change
+	}{
+		{
+			// Versions listed only for their go.mod aren't built
+			name: "go.sum",
+			path: "go.sum",
+			old: `github.com/fsnotify/fsnotify v1.7.0 h1:8JEhPFa5W2WU7YfeZzPNqzMP6Lwt7L2715Ggo0nosvA=
+github.com/fsnotify/fsnotify v1.7.0/go.mod h1:40Bi/Hjc2AVfZrqy+aj+yEI+/bRxZnMJyTJwOpGvigM=
+golang.org/x/sys v0.15.0 h1:h48lPFYpsTvQJZF4EKyI4aLHaev3CxivZmv7yZig9pc=
+golang.org/x/sys v0.15.0/go.mod h1:/VUhepiaJMQUp4+oa/7Zr1D23ma6VTLIYjOOTFZPUcA=
+`,
+			new: `github.com/mattn/go-runewidth v0.0.15 h1:UNAjwbU9l54TA3KzvqLGxwWjHmMgBUVhBiTjelZgg3U=
+github.com/mattn/go-runewidth v0.0.15/go.mod h1:Jdepj2loyihRzMpdS35Xk/zdY8IAYHsh153qUoGf23w=
+golang.org/x/sys v0.15.0/go.mod h1:/VUhepiaJMQUp4+oa/7Zr1D23ma6VTLIYjOOTFZPUcA=
+golang.org/x/sys v0.18.0 h1:DBdB3niSjOA/O0blCZBqDefyWNYveAYMNF1Wum0DYQ4=
+golang.org/x/sys v0.18.0/go.mod h1:/VUhepiaJMQUp4+oa/7Zr1D23ma6VTLIYjOOTFZPUcA=
+`,
+			want: []Change{
+				{Type: LineDeleted, Location: "github.com/fsnotify/fsnotify", Old: "v1.7.0"},
+				{Type: LineModified, Location: "golang.org/x/sys", Old: "v0.15.0", New: "v0.18.0"},
+				{Type: LineAdded, Location: "github.com/mattn/go-runewidth", New: "v0.0.15"},
+			},
+		},
+		{
+			name: "package-lock v1",
+			path: "package-lock.json",
+			old: `{"name": "app", "lockfileVersion": 1, "dependencies": {
+				"left-pad": {"version": "1.3.0"},
+				"react": {"version": "18.2.0"}}}`,
+			new: `{"name": "app", "lockfileVersion": 1, "dependencies": {
+				"react": {"version": "18.3.1", "dependencies": {"loose-envify": {"version": "1.4.0"}}}}}`,
+			want: npm,
+		},
+		{
+			// Version 2 keeps the dependencies of version 1 for older npm
+			// versions; the packages are what newer ones read
+			name: "package-lock v2",
+			path: "package-lock.json",
+			old: `{"name": "app", "lockfileVersion": 2, "packages": {
+				"": {"name": "app", "dependencies": {"left-pad": "^1.3.0", "react": "^18.2.0"}},
+				"node_modules/left-pad": {"version": "1.3.0"},
+				"node_modules/react": {"version": "18.2.0"}},
+				"dependencies": {"left-pad": {"version": "1.3.0"}, "react": {"version": "18.2.0"}}}`,
+			new: `{"name": "app", "lockfileVersion": 2, "packages": {
+				"": {"name": "app", "dependencies": {"react": "^18.3.1"}},
+				"node_modules/loose-envify": {"version": "1.4.0"},
+				"node_modules/react": {"version": "18.3.1"}},
+				"dependencies": {"loose-envify": {"version": "1.4.0"}, "react": {"version": "18.3.1"}}}`,
+			want: npm,
+		},
+		{
+			name: "package-lock v3",
+			path: "package-lock.json",
+			old: `{"name": "app", "lockfileVersion": 3, "packages": {
+				"": {"name": "app"},
+				"node_modules/left-pad": {"version": "1.3.0"},
+				"node_modules/react": {"version": "18.2.0"}}}`,
+			new: `{"name": "app", "lockfileVersion": 3, "packages": {
+				"": {"name": "app"},
+				"node_modules/react": {"version": "18.3.1"},
+				"node_modules/react/node_modules/loose-envify": {"version": "1.4.0"}}}`,
+			want: npm,
+		},
+		{
+			// A package locked at several versions has them all
+			name: "Cargo.lock",
+			path: "Cargo.lock",
+			old: `version = 3
+
+[[package]]
+name = "serde"
+version = "1.0.195"
+
+[[package]]
+name = "syn"
+version = "1.0.109"
+
+[[package]]
+name = "syn"
+version = "2.0.48"
+
+[[package]]
+name = "winapi"
+version = "0.3.9"
+`,
+			new: `version = 3
+
+[[package]]
+name = "serde"
+version = "1.0.197"
+
+[[package]]
+name = "syn"
+version = "2.0.52"
+
+[[package]]
+name = "windows-sys"
+version = "0.52.0"
+`,
+			want: []Change{
+				{Type: LineModified, Location: "serde", Old: "1.0.195", New: "1.0.197"},
+				{Type: LineModified, Location: "syn", Old: "1.0.109, 2.0.48", New: "2.0.52"},
+				{Type: LineDeleted, Location: "winapi", Old: "0.3.9"},
+				{Type: LineAdded, Location: "windows-sys", New: "0.52.0"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := compute(t, tt.path, tt.old, tt.new)
+			if result.Structure != "Dependencies" {
+				t.Fatalf("structure %q, want Dependencies", result.Structure)
+			}
+			if !slices.Equal(result.Changes, tt.want) {
+				t.Errorf("changes %+v, want %+v", result.Changes, tt.want)
+			}
+		})
+	}
+}
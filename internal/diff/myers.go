@@ -0,0 +1,169 @@
+package diff
+
+// myers marks the changed lines of a range with Myers' algorithm. Lines
+// that don't occur on the other side can't be part of the common
+// subsequence, so they are marked right away and left out of the search:
+// that keeps rewritten files, where most lines are new, fast.
+func (d *differ) myers(aLo, aHi, bLo, bHi int) {
+	aLo, aHi, bLo, bHi = d.trim(aLo, aHi, bLo, bHi)
+	if d.markAll(aLo, aHi, bLo, bHi) {
+		return
+	}
+
+	inA := make(map[int]bool, aHi-aLo)
+	for _, id := range d.a[aLo:aHi] {
+		inA[id] = true
+	}
+	inB := make(map[int]bool, bHi-bLo)
+	for _, id := range d.b[bLo:bHi] {
+		inB[id] = true
+	}
+
+	keptA := keep(d.a, d.ca, aLo, aHi, inB)
+	keptB := keep(d.b, d.cb, bLo, bHi, inA)
+	if len(keptA) == aHi-aLo && len(keptB) == bHi-bLo {
+		d.compare(aLo, aHi, bLo, bHi)
+		return
+	}
+
+	sub := newDifferIDs(ids(d.a, keptA), ids(d.b, keptB))
+	sub.compare(0, len(sub.a), 0, len(sub.b))
+	for k, i := range keptA {
+		d.ca[i] = sub.ca[k]
+	}
+	for k, j := range keptB {
+		d.cb[j] = sub.cb[k]
+	}
+}
+
+// keep returns the indexes of the lines of lines[lo:hi] whose IDs are in
+// other, marking the rest as changed
+func keep(lines []int, changed []bool, lo, hi int, other map[int]bool) []int {
+	kept := make([]int, 0, hi-lo)
+	for i := lo; i < hi; i++ {
+		if other[lines[i]] {
+			kept = append(kept, i)
+		} else {
+			changed[i] = true
+		}
+	}
+	return kept
+}
+
+// ids returns the IDs of lines at the given indexes
+func ids(lines []int, indexes []int) []int {
+	out := make([]int, len(indexes))
+	for k, i := range indexes {
+		out[k] = lines[i]
+	}
+	return out
+}
+
+// costLimit is the number of steps after which the search for the middle
+// snake gives up on a shortest edit script and splits the range where the
+// forward search got furthest. Keeps large files with many scattered
+// changes of common lines (like "}" or blank lines) from taking seconds.
+const costLimit = 1024
+
+// compare marks the changed lines of a range by splitting it at the middle
+// of a shortest edit script until one side is empty, in linear space
+func (d *differ) compare(aLo, aHi, bLo, bHi int) {
+	aLo, aHi, bLo, bHi = d.trim(aLo, aHi, bLo, bHi)
+	if d.markAll(aLo, aHi, bLo, bHi) {
+		return
+	}
+
+	x, y, u, v := d.midSnake(aLo, aHi, bLo, bHi)
+	d.compare(aLo, x, bLo, y)
+	d.compare(u, aHi, v, bHi)
+}
+
+// midSnake finds the middle snake of a shortest edit script of a range,
+// searching from both ends at once: the run of equal lines from (x, y) to
+// (u, v) that the forward and backward searches meet on. The range must
+// not start or end with equal lines. Past costLimit steps, a point the
+// forward search reached is returned instead.
+func (d *differ) midSnake(aLo, aHi, bLo, bHi int) (x, y, u, v int) {
+	n, m := aHi-aLo, bHi-bLo
+	delta := n - m
+	odd := delta%2 != 0
+	limit := (n + m + 1) / 2
+
+	// Furthest x reached on each diagonal k = x - y, forward in vf and
+	// backward (from the end, on reversed sequences) in vb
+	size := 2*limit + 3
+	if cap(d.v) < 2*size {
+		d.v = make([]int, 2*size)
+	}
+	vf, vb := d.v[:size], d.v[size:2*size]
+	offset := limit + 1
+	vf[offset+1], vb[offset+1] = 0, 0
+
+	for step := 0; step <= limit; step++ {
+		for k := -step; k <= step; k += 2 {
+			var fx int
+			if k == -step || k != step && vf[offset+k-1] < vf[offset+k+1] {
+				fx = vf[offset+k+1]
+			} else {
+				fx = vf[offset+k-1] + 1
+			}
+			fy := fx - k
+			sx, sy := fx, fy
+			for fx < n && fy < m && d.a[aLo+fx] == d.b[bLo+fy] {
+				fx++
+				fy++
+			}
+			vf[offset+k] = fx
+
+			// The backward search covers diagonal delta-k after step-1 steps
+			if r := delta - k; odd && r >= -(step-1) && r <= step-1 && fx+vb[offset+r] >= n {
+				return aLo + sx, bLo + sy, aLo + fx, bLo + fy
+			}
+		}
+
+		for k := -step; k <= step; k += 2 {
+			var bx int
+			if k == -step || k != step && vb[offset+k-1] < vb[offset+k+1] {
+				bx = vb[offset+k+1]
+			} else {
+				bx = vb[offset+k-1] + 1
+			}
+			by := bx - k
+			sx, sy := bx, by
+			for bx < n && by < m && d.a[aHi-1-bx] == d.b[bHi-1-by] {
+				bx++
+				by++
+			}
+			vb[offset+k] = bx
+
+			if r := delta - k; !odd && r >= -step && r <= step && bx+vf[offset+r] >= n {
+				return aHi - bx, bHi - by, aHi - sx, bHi - sy
+			}
+		}
+
+		if step >= costLimit {
+			x, y := furthest(vf, offset, step, n, m)
+			return aLo + x, bLo + y, aLo + x, bLo + y
+		}
+	}
+
+	// Not reached: the searches meet within limit steps
+	return aLo, bLo, aLo, bLo
+}
+
+// furthest returns the point inside the range, short of its end, that the
+// forward search reached furthest on after step steps
+func furthest(vf []int, offset, step, n, m int) (x, y int) {
+	best := -1
+	for k := -step; k <= step; k += 2 {
+		fx := vf[offset+k]
+		fy := fx - k
+		if fx < 0 || fx > n || fy < 0 || fy > m || fx == n && fy == m {
+			continue
+		}
+		if fx+fy > best {
+			best, x, y = fx+fy, fx, fy
+		}
+	}
+	return x, y
+}
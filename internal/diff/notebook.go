@@ -0,0 +1,255 @@
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/deemkeen/diffwatch/internal/state"
+)
+
+// notebookCell is a cell of a Jupyter notebook, reduced to what a reader
+// compares: its source and a summary of its outputs. Execution counts and
+// metadata, which change on every run, are left out.
+type notebookCell struct {
+	id      string
+	kind    string   // "code", "markdown" or "raw"
+	source  []string // Lines without terminators
+	outputs string   // Summary of the outputs, see outputSummary
+}
+
+// maxOutputText is the most runes of an output's text in its summary
+const maxOutputText = 60
+
+// diffNotebook replaces the line diff of a notebook, which is JSON with
+// escaped sources and base64 images, by the changed lines of its cells,
+// located as "cell 3:2" (line 2 of the third cell), and the changed
+// outputs of its cells in summary. Notebooks that don't parse keep their
+// line diff.
+func diffNotebook(r *Result) {
+	oldCells, err := notebookCells(r.OldState)
+	if err != nil {
+		return
+	}
+	newCells, err := notebookCells(r.NewState)
+	if err != nil {
+		return
+	}
+
+	r.Structure = "Notebook"
+
+	// Cells keep their ids across edits in newer notebooks; without ids,
+	// unchanged cells are matched first and the rest paired by content
+	byID := !slices.ContainsFunc(oldCells, func(c notebookCell) bool { return c.id == "" }) &&
+		!slices.ContainsFunc(newCells, func(c notebookCell) bool { return c.id == "" })
+	keys := func(cells []notebookCell) []string {
+		out := make([]string, len(cells))
+		for k, c := range cells {
+			out[k] = c.id
+			if !byID {
+				out[k] = c.kind + "\x00" + c.text() + "\x00" + c.outputs
+			}
+		}
+		return out
+	}
+
+	for _, c := range OpCodes(keys(oldCells), keys(newCells), Myers) {
+		if c.Tag != 'e' {
+			compareCellRuns(r, c.I1, c.J1, oldCells[c.I1:c.I2], newCells[c.J1:c.J2])
+			continue
+		}
+		if byID {
+			for k := range c.I2 - c.I1 {
+				compareCells(r, c.J1+k+1, oldCells[c.I1+k], newCells[c.J1+k])
+			}
+		}
+	}
+}
+
+// minCellSimilarity is the share of lines in percent two versions of a
+// cell have in common at least to be paired by content
+const minCellSimilarity = 50
+
+// compareCellRuns records the changes between runs of cells that replaced
+// each other, numbered from oldFrom+1 and newFrom+1. Cells of the same kind
+// are paired by content where it's similar enough, in order otherwise;
+// the cells left over were removed or added.
+func compareCellRuns(r *Result, oldFrom, newFrom int, a, b []notebookCell) {
+	pairs := make([]int, len(b)) // Index in a of the old version of each cell of b, or -1
+	used := make([]bool, len(a))
+	for j := range b {
+		pairs[j] = -1
+		best := minCellSimilarity - 1
+		for i := range a {
+			if used[i] || a[i].kind != b[j].kind {
+				continue
+			}
+			if sim := state.Similarity([]byte(a[i].text()), []byte(b[j].text())); sim > best {
+				pairs[j], best = i, sim
+			}
+		}
+		if pairs[j] >= 0 {
+			used[pairs[j]] = true
+		}
+	}
+	for j := range b {
+		if pairs[j] >= 0 {
+			continue
+		}
+		for i := range a {
+			if !used[i] && a[i].kind == b[j].kind {
+				pairs[j], used[i] = i, true
+				break
+			}
+		}
+	}
+
+	for i := range a {
+		if !used[i] {
+			compareCells(r, oldFrom+i+1, a[i], notebookCell{})
+		}
+	}
+	for j := range b {
+		old := notebookCell{}
+		if pairs[j] >= 0 {
+			old = a[pairs[j]]
+		}
+		compareCells(r, newFrom+j+1, old, b[j])
+	}
+}
+
+// compareCells records the changes between two versions of the cell
+// numbered n. An empty version stands for a cell that was added or
+// removed.
+func compareCells(r *Result, n int, a, b notebookCell) {
+	location := fmt.Sprintf("cell %d", n)
+	if a.kind != "" && b.kind != "" && a.kind != b.kind {
+		r.modified(location+" type", a.kind, b.kind)
+	}
+
+	r.compareLines(location, a.source, b.source)
+
+	switch {
+	case a.outputs == b.outputs:
+	case a.outputs == "":
+		r.added(location+" output", b.outputs)
+	case b.outputs == "":
+		r.deleted(location+" output", a.outputs)
+	default:
+		r.modified(location+" output", a.outputs, b.outputs)
+	}
+}
+
+// text returns the source of a cell
+func (c notebookCell) text() string {
+	return strings.Join(c.source, "\n")
+}
+
+// notebookCells parses the cells of a notebook. A missing file has none.
+func notebookCells(s *state.FileState) ([]notebookCell, error) {
+	if s == nil || !s.Exists {
+		return nil, nil
+	}
+
+	var nb struct {
+		Cells []struct {
+			ID       string            `json:"id"`
+			CellType string            `json:"cell_type"`
+			Source   json.RawMessage   `json:"source"`
+			Outputs  []json.RawMessage `json:"outputs"`
+		} `json:"cells"`
+	}
+	if err := json.Unmarshal(s.Content, &nb); err != nil {
+		return nil, err
+	}
+
+	cells := make([]notebookCell, len(nb.Cells))
+	for i, c := range nb.Cells {
+		source, err := multiline(c.Source)
+		if err != nil {
+			return nil, fmt.Errorf("cell %d: %w", i+1, err)
+		}
+		cells[i] = notebookCell{id: c.ID, kind: c.CellType, outputs: outputSummary(c.Outputs)}
+		if source != "" {
+			cells[i].source = strings.Split(strings.TrimSuffix(source, "\n"), "\n")
+		}
+	}
+	return cells, nil
+}
+
+// multiline decodes a notebook text, stored as a string or as a list of
+// lines
+func multiline(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", nil
+	}
+	var lines []string
+	if err := json.Unmarshal(raw, &lines); err == nil {
+		return strings.Join(lines, ""), nil
+	}
+	var text string
+	err := json.Unmarshal(raw, &text)
+	return text, err
+}
+
+// outputSummary describes the outputs of a cell in one line: the first
+// line of texts and results, the type of images and other data, and
+// errors by name, e.g. "stdout: loss 0.31; image/png <Figure size 640x480>".
+// Outputs that don't parse are left out.
+func outputSummary(outputs []json.RawMessage) string {
+	var parts []string
+	for _, raw := range outputs {
+		var out struct {
+			OutputType string                     `json:"output_type"`
+			Name       string                     `json:"name"`
+			Text       json.RawMessage            `json:"text"`
+			Data       map[string]json.RawMessage `json:"data"`
+			EName      string                     `json:"ename"`
+			EValue     string                     `json:"evalue"`
+		}
+		if json.Unmarshal(raw, &out) != nil {
+			continue
+		}
+
+		switch out.OutputType {
+		case "stream":
+			text, _ := multiline(out.Text)
+			parts = append(parts, out.Name+": "+outputLine(text))
+		case "error":
+			parts = append(parts, "error "+out.EName+": "+outputLine(out.EValue))
+		default:
+			var types []string
+			for mime := range out.Data {
+				if mime != "text/plain" {
+					types = append(types, mime)
+				}
+			}
+			slices.Sort(types)
+			desc := strings.Join(types, ", ")
+			if text, _ := multiline(out.Data["text/plain"]); text != "" {
+				if desc == "" {
+					desc = "result:"
+				}
+				desc += " " + outputLine(text)
+			}
+			parts = append(parts, desc)
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// outputLine returns the first non-blank line of text, cut to
+// maxOutputText runes, with an ellipsis if anything was left out
+func outputLine(text string) string {
+	text = strings.TrimSpace(text)
+	line, rest, _ := strings.Cut(text, "\n")
+	line = strings.TrimSpace(line)
+	if runes := []rune(line); len(runes) > maxOutputText {
+		return string(runes[:maxOutputText]) + "…"
+	}
+	if rest != "" {
+		return line + " …"
+	}
+	return line
+}
@@ -0,0 +1,50 @@
+package diff
+
+import (
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDiffNotebook(t *testing.T) {
+	base, err := os.ReadFile("testdata/analysis.ipynb")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		rerun  = []string{`"execution_count": 1`, `"execution_count": 7`}
+		output = []string{`"rows: 1200\n"`, `"rows: 1180\n"`}
+		source = []string{`"df = pd.read_csv(\"sales.csv\")\n"`, `"df = pd.read_csv(\"sales.csv\").dropna()\n"`}
+	)
+	sourceChange := Change{Type: LineModified, Location: "cell 2:2", Old: `df = pd.read_csv("sales.csv")`, New: `df = pd.read_csv("sales.csv").dropna()`}
+	outputChange := Change{Type: LineModified, Location: "cell 2 output", Old: "stdout: rows: 1200", New: "stdout: rows: 1180"}
+
+	tests := []struct {
+		name  string
+		edits [][]string // Replacements turning the notebook into its new version
+		want  []Change
+	}{
+		// Running a notebook again changes its execution counts only
+		{name: "rerun", edits: [][]string{rerun}},
+		{name: "output", edits: [][]string{rerun, output}, want: []Change{outputChange}},
+		{name: "source", edits: [][]string{source}, want: []Change{sourceChange}},
+		{name: "source and output", edits: [][]string{rerun, source, output}, want: []Change{sourceChange, outputChange}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			edited := string(base)
+			for _, edit := range tt.edits {
+				edited = strings.Replace(edited, edit[0], edit[1], 1)
+			}
+			result := compute(t, "analysis.ipynb", string(base), edited)
+			if result.Structure != "Notebook" {
+				t.Fatalf("structure %q, want Notebook", result.Structure)
+			}
+			if !slices.Equal(result.Changes, tt.want) {
+				t.Errorf("changes %+v, want %+v", result.Changes, tt.want)
+			}
+		})
+	}
+}
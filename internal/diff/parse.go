@@ -0,0 +1,133 @@
+package diff
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/deemkeen/diffwatch/internal/lang"
+)
+
+// ParsePatch turns a unified diff of path, as produced by Patch, back into
+// a result for display, e.g. a change recorded in a database. Unchanged
+// lines between hunks are not part of a patch and become gap lines.
+// Returns an error if the patch is malformed.
+func ParsePatch(path, patch string) (*Result, error) {
+	result := &Result{Path: path, Unified: patch, HasDiff: patch != ""}
+
+	oldLine, newLine := 0, 0 // Next line number on each side, 0 before the first hunk
+	for _, text := range strings.SplitAfter(patch, "\n") {
+		body := strings.TrimSuffix(text, "\n")
+		switch {
+		case body == "":
+			// End of the patch
+		case oldLine == 0 && strings.HasPrefix(body, "new file mode "):
+			result.IsNew = true
+		case oldLine == 0 && strings.HasPrefix(body, "deleted file mode "):
+			result.IsDeleted = true
+		case oldLine == 0 && gitHeader(body):
+			// Other extended headers, e.g. of a renamed file
+		case strings.HasPrefix(body, "Binary files "):
+			result.IsBinary = true
+			result.IsNew = strings.HasPrefix(body, "Binary files "+devNull)
+			result.IsDeleted = strings.HasSuffix(body, devNull+" differ")
+		case oldLine == 0 && strings.HasPrefix(body, "--- "):
+			result.IsNew = body == "--- "+devNull
+		case oldLine == 0 && strings.HasPrefix(body, "+++ "):
+			result.IsDeleted = body == "+++ "+devNull
+		case strings.HasPrefix(body, "@@"):
+			oldStart, newStart, err := parseHunkHeader(body)
+			if err != nil {
+				return nil, err
+			}
+			if skipped := max(oldStart-max(oldLine, 1), 0); skipped > 0 {
+				result.Lines = append(result.Lines, DiffLine{
+					Type:    LineGap,
+					Content: fmt.Sprintf("%d unchanged lines not recorded", skipped),
+				})
+			}
+			oldLine, newLine = oldStart, newStart
+		case strings.HasPrefix(body, `\`):
+			// "\ No newline at end of file" belongs to the line before
+			if n := len(result.Lines); n > 0 {
+				result.Lines[n-1].Ending = EndingNone
+			}
+		case oldLine == 0:
+			return nil, fmt.Errorf("parsing patch of %s: line outside of a hunk: %q", path, body)
+		default:
+			line := DiffLine{}
+			line.Content, line.Ending = trimEnding(text[1:])
+			switch body[0] {
+			case '+':
+				line.Type, line.NewLineNum = LineAdded, newLine
+				newLine++
+			case '-':
+				line.Type, line.OldLineNum = LineDeleted, oldLine
+				oldLine++
+			case ' ':
+				line.Type, line.OldLineNum, line.NewLineNum = LineUnchanged, oldLine, newLine
+				oldLine++
+				newLine++
+			default:
+				return nil, fmt.Errorf("parsing patch of %s: unexpected line %q", path, body)
+			}
+			result.Lines = append(result.Lines, line)
+		}
+	}
+
+	result.Conflicts = markConflicts(result.Lines)
+	result.Language = lang.Detect(path, firstLine(result.Lines))
+	return result, nil
+}
+
+// gitHeader reports whether a line before the first hunk is one of git's
+// extended headers, as Patch writes them or git diff does
+func gitHeader(line string) bool {
+	for _, prefix := range []string{"diff --git ", "similarity index ", "rename from ", "rename to ", "index "} {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// firstLine returns the first line of the file if the patch includes it,
+// for detecting the language of scripts by their shebang
+func firstLine(lines []DiffLine) []byte {
+	for _, line := range lines {
+		if line.NewLineNum == 1 || line.OldLineNum == 1 {
+			return []byte(line.Content)
+		}
+	}
+	return nil
+}
+
+// parseHunkHeader returns the first old and new line of a hunk header
+// like "@@ -1,3 +1,4 @@". Empty ranges name the line before the change, so
+// they start at the line after it.
+func parseHunkHeader(header string) (oldStart, newStart int, err error) {
+	fields := strings.Fields(header)
+	if len(fields) < 4 || !strings.HasPrefix(fields[1], "-") || !strings.HasPrefix(fields[2], "+") {
+		return 0, 0, fmt.Errorf("parsing patch: invalid hunk header %q", header)
+	}
+
+	parse := func(r string) (int, error) {
+		start, length, _ := strings.Cut(r[1:], ",")
+		n, err := strconv.Atoi(start)
+		if err != nil {
+			return 0, fmt.Errorf("parsing patch: invalid hunk header %q", header)
+		}
+		if length == "0" {
+			n++
+		}
+		return n, nil
+	}
+
+	if oldStart, err = parse(fields[1]); err != nil {
+		return 0, 0, err
+	}
+	if newStart, err = parse(fields[2]); err != nil {
+		return 0, 0, err
+	}
+	return oldStart, newStart, nil
+}
@@ -0,0 +1,184 @@
+package diff
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// devNull names the missing side of a created or deleted file
+const devNull = "/dev/null"
+
+// contextLines is the number of unchanged lines around each hunk
+const contextLines = 3
+
+// Patch returns the change as a standard unified diff for the file called
+// name (a slash-separated path relative to the directory the patch is
+// applied in). Headers use git's a/ and b/ prefixes and /dev/null for
+// created and deleted files, so the output can be applied with git apply
+// or patch -p1. Binary changes, empty created or deleted files and renamed
+// files get git's extended headers, the old side of a rename named as
+// before it, relative to name. Returns "" if nothing changed.
+func (r *Result) Patch(name string) string {
+	if !r.HasDiff {
+		return ""
+	}
+	return r.patch(name)
+}
+
+// patch formats the unified diff regardless of HasDiff
+func (r *Result) patch(name string) string {
+	oldName := r.oldName(name)
+	from, to := "a/"+oldName, "b/"+name
+	if r.IsNew {
+		from = devNull
+	}
+	if r.IsDeleted {
+		to = devNull
+	}
+	renamed := oldName != name && !r.IsNew && !r.IsDeleted
+
+	var body string
+	if r.IsBinary {
+		body = fmt.Sprintf("Binary files %s and %s differ\n", from, to)
+	} else {
+		var oldContent, newContent []byte
+		if r.OldState != nil && r.OldState.Exists {
+			oldContent = r.OldState.Content
+		}
+		if r.NewState != nil && r.NewState.Exists {
+			newContent = r.NewState.Content
+		}
+		if hunks := unifiedHunks(SplitLines(oldContent), SplitLines(newContent), r.algorithm); hunks != "" {
+			body = fmt.Sprintf("--- %s\n+++ %s\n%s", from, to, hunks)
+		}
+	}
+
+	// git apply only takes binary changes, empty files and renames with its
+	// extended headers, there being no hunks to tell them
+	if !r.IsBinary && !renamed && (body != "" || !r.IsNew && !r.IsDeleted) {
+		return body
+	}
+	header := fmt.Sprintf("diff --git a/%s b/%s\n", oldName, name)
+	switch {
+	case r.IsNew:
+		header += "new file mode 100644\n"
+	case r.IsDeleted:
+		header += "deleted file mode 100644\n"
+	case renamed:
+		header += fmt.Sprintf("similarity index %d%%\nrename from %s\nrename to %s\n", r.Similarity, oldName, name)
+	}
+	return header + body
+}
+
+// oldName returns the name of the old side of the patch of the file called
+// name: the name it had before a rename, found from RenamedFrom relative to
+// Path, otherwise name itself
+func (r *Result) oldName(name string) string {
+	if r.RenamedFrom == "" || r.Path == "" {
+		return name
+	}
+	rel, err := filepath.Rel(filepath.Dir(r.Path), r.RenamedFrom)
+	if err != nil {
+		return name
+	}
+	return path.Join(path.Dir(name), filepath.ToSlash(rel))
+}
+
+// SplitLines splits content into lines, keeping the line terminators so
+// that a missing final newline or changed line ending counts as a change
+func SplitLines(content []byte) []string {
+	if len(content) == 0 {
+		return nil
+	}
+	lines := strings.SplitAfter(string(content), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// unifiedHunks formats the hunks of a unified diff between two sets of
+// lines as returned by SplitLines
+func unifiedHunks(a, b []string, alg Algorithm) string {
+	var out strings.Builder
+
+	for _, group := range groupOpCodes(OpCodes(a, b, alg), contextLines) {
+		writeHunk(&out, a, b, group)
+	}
+
+	return out.String()
+}
+
+// HunkPatch returns a unified diff for the file called name (see Patch)
+// with only the hunk of the change from old to new that touches line, a
+// 1-based line of new. Changes right before or after line count, so a
+// deletion is found by the line preceding it. Returns "" if no hunk
+// touches line. Lines are matched with alg.
+func HunkPatch(name string, old, new []byte, line int, alg Algorithm) string {
+	a, b := SplitLines(old), SplitLines(new)
+	idx := line - 1
+
+	for _, group := range groupOpCodes(OpCodes(a, b, alg), contextLines) {
+		for _, op := range group {
+			if op.Tag != 'e' && idx >= op.J1-1 && idx <= op.J2 {
+				var out strings.Builder
+				fmt.Fprintf(&out, "--- a/%s\n+++ b/%s\n", name, name)
+				writeHunk(&out, a, b, group)
+				return out.String()
+			}
+		}
+	}
+	return ""
+}
+
+// writeHunk formats a single hunk of grouped opcodes
+func writeHunk(out *strings.Builder, a, b []string, group []OpCode) {
+	first, last := group[0], group[len(group)-1]
+	fmt.Fprintf(out, "@@ -%s +%s @@\n", hunkRange(first.I1, last.I2), hunkRange(first.J1, last.J2))
+
+	for _, op := range group {
+		if op.Tag == 'e' {
+			for _, line := range a[op.I1:op.I2] {
+				writePatchLine(out, ' ', line)
+			}
+			continue
+		}
+		if op.Tag == 'r' || op.Tag == 'd' {
+			for _, line := range a[op.I1:op.I2] {
+				writePatchLine(out, '-', line)
+			}
+		}
+		if op.Tag == 'r' || op.Tag == 'i' {
+			for _, line := range b[op.J1:op.J2] {
+				writePatchLine(out, '+', line)
+			}
+		}
+	}
+}
+
+// writePatchLine writes a single diff line, marking a missing final newline
+func writePatchLine(out *strings.Builder, prefix byte, line string) {
+	out.WriteByte(prefix)
+	out.WriteString(line)
+	if !strings.HasSuffix(line, "\n") {
+		out.WriteString("\n\\ No newline at end of file\n")
+	}
+}
+
+// hunkRange formats a line range of a hunk header: the 1-based first line
+// and the line count, which is omitted when it is 1. Empty ranges start at
+// the line before the change.
+func hunkRange(start, stop int) string {
+	length := stop - start
+	beginning := start + 1
+	if length == 0 {
+		beginning--
+	}
+	if length == 1 {
+		return strconv.Itoa(beginning)
+	}
+	return fmt.Sprintf("%d,%d", beginning, length)
+}
@@ -0,0 +1,150 @@
+package diff
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/deemkeen/diffwatch/internal/state"
+)
+
+func TestPatchRenamed(t *testing.T) {
+	root := filepath.FromSlash("/project")
+	from := filepath.Join(root, "src", "old.go")
+	to := filepath.Join(root, "pkg", "new.go")
+
+	result, err := New(root, "").Compute(fileState(from, "a\nb\nc\n"), fileState(to, "a\nb\nd\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.RenamedFrom != from {
+		t.Fatalf("renamed from %q, want %q", result.RenamedFrom, from)
+	}
+	want := fmt.Sprintf("diff --git a/src/old.go b/pkg/new.go\nsimilarity index %d%%\n"+
+		"rename from src/old.go\nrename to pkg/new.go\n"+
+		"--- a/src/old.go\n+++ b/pkg/new.go\n@@ -1,3 +1,3 @@\n a\n b\n-c\n+d\n", result.Similarity)
+	if result.Unified != want {
+		t.Errorf("unified diff %q, want %q", result.Unified, want)
+	}
+
+	// Relative to another directory, the old name moves along
+	want = "diff --git a/project/src/old.go b/project/pkg/new.go\n"
+	if got := result.Patch("project/pkg/new.go"); !strings.HasPrefix(got, want) {
+		t.Errorf("patch starts %q, want %q", got, want)
+	}
+
+	// Recorded patches read back without the headers
+	parsed, err := ParsePatch(to, result.Unified)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added, deleted := parsed.Stats(); added != 1 || deleted != 1 {
+		t.Errorf("parsed stats %d %d, want 1 1", added, deleted)
+	}
+}
+
+func TestPatchRenamedUnchanged(t *testing.T) {
+	root := filepath.FromSlash("/project")
+	from, to := filepath.Join(root, "old.txt"), filepath.Join(root, "new.txt")
+
+	result, err := New(root, "").Compute(fileState(from, "a\n"), fileState(to, "a\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.RenamedFrom != from || !result.HasDiff {
+		t.Fatalf("renamed from %q, changed %v, want a changed rename", result.RenamedFrom, result.HasDiff)
+	}
+	want := "diff --git a/old.txt b/new.txt\nsimilarity index 100%\nrename from old.txt\nrename to new.txt\n"
+	if result.Unified != want {
+		t.Errorf("unified diff %q, want %q", result.Unified, want)
+	}
+}
+
+func TestPatchEmptyFile(t *testing.T) {
+	path := filepath.FromSlash("/project/.keep")
+	missing := &state.FileState{Path: path}
+
+	tests := []struct {
+		name     string
+		old, new *state.FileState
+		want     string
+	}{
+		{"created", missing, fileState(path, ""), "diff --git a/.keep b/.keep\nnew file mode 100644\n"},
+		{"deleted", fileState(path, ""), missing, "diff --git a/.keep b/.keep\ndeleted file mode 100644\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := New(filepath.Dir(path), "").Compute(tt.old, tt.new)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Unified != tt.want {
+				t.Errorf("unified diff %q, want %q", result.Unified, tt.want)
+			}
+
+			parsed, err := ParsePatch(path, result.Unified)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parsed.IsNew != result.IsNew || parsed.IsDeleted != result.IsDeleted {
+				t.Errorf("parsed as new %v, deleted %v, want %v, %v", parsed.IsNew, parsed.IsDeleted, result.IsNew, result.IsDeleted)
+			}
+		})
+	}
+}
+
+func TestPatchBinary(t *testing.T) {
+	path := filepath.FromSlash("/project/logo.png")
+	missing := &state.FileState{Path: path}
+
+	tests := []struct {
+		name     string
+		old, new *state.FileState
+		want     string
+	}{
+		{
+			"modified", fileState(path, "\x89PNG\x00a"), fileState(path, "\x89PNG\x00b"),
+			"diff --git a/logo.png b/logo.png\nBinary files a/logo.png and b/logo.png differ\n",
+		},
+		{
+			"created", missing, fileState(path, "\x89PNG\x00a"),
+			"diff --git a/logo.png b/logo.png\nnew file mode 100644\nBinary files /dev/null and b/logo.png differ\n",
+		},
+		{
+			"deleted", fileState(path, "\x89PNG\x00a"), missing,
+			"diff --git a/logo.png b/logo.png\ndeleted file mode 100644\nBinary files a/logo.png and /dev/null differ\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := New(filepath.Dir(path), "").Compute(tt.old, tt.new)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Unified != tt.want {
+				t.Errorf("unified diff %q, want %q", result.Unified, tt.want)
+			}
+
+			parsed, err := ParsePatch(path, result.Unified)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !parsed.IsBinary || parsed.IsNew != result.IsNew || parsed.IsDeleted != result.IsDeleted {
+				t.Errorf("parsed as binary %v, new %v, deleted %v", parsed.IsBinary, parsed.IsNew, parsed.IsDeleted)
+			}
+		})
+	}
+}
+
+func TestPatchModified(t *testing.T) {
+	path := filepath.FromSlash("/project/main.go")
+	result, err := New(filepath.Dir(path), "").Compute(fileState(path, "a\n"), fileState(path, "b\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "--- a/main.go\n+++ b/main.go\n@@ -1 +1 @@\n-a\n+b\n"
+	if result.Unified != want {
+		t.Errorf("unified diff %q, want %q", result.Unified, want)
+	}
+}
@@ -0,0 +1,90 @@
+package diff
+
+import "sort"
+
+// patience marks the changed lines of a range with the patience algorithm:
+// lines occurring once in both versions are matched in their longest
+// common order, and the ranges between them are diffed the same way.
+// Ranges without such lines fall back to Myers.
+func (d *differ) patience(aLo, aHi, bLo, bHi int) {
+	aLo, aHi, bLo, bHi = d.trim(aLo, aHi, bLo, bHi)
+	if d.markAll(aLo, aHi, bLo, bHi) {
+		return
+	}
+
+	anchors := d.uniqueAnchors(aLo, aHi, bLo, bHi)
+	if len(anchors) == 0 {
+		d.myers(aLo, aHi, bLo, bHi)
+		return
+	}
+
+	i, j := aLo, bLo
+	for _, anchor := range anchors {
+		d.patience(i, anchor.i, j, anchor.j)
+		i, j = anchor.i+1, anchor.j+1
+	}
+	d.patience(i, aHi, j, bHi)
+}
+
+// anchor is a line occurring once in both versions, at a[i] and b[j]
+type anchor struct{ i, j int }
+
+// uniqueAnchors returns the longest sequence of lines of a range that
+// occur once on each side and in the same order on both
+func (d *differ) uniqueAnchors(aLo, aHi, bLo, bHi int) []anchor {
+	type count struct{ a, b, j int }
+	counts := make(map[int]*count)
+	for i := aLo; i < aHi; i++ {
+		c := counts[d.a[i]]
+		if c == nil {
+			c = &count{}
+			counts[d.a[i]] = c
+		}
+		c.a++
+	}
+	for j := bLo; j < bHi; j++ {
+		if c := counts[d.b[j]]; c != nil {
+			c.b++
+			c.j = j
+		}
+	}
+
+	var unique []anchor
+	for i := aLo; i < aHi; i++ {
+		if c := counts[d.a[i]]; c.a == 1 && c.b == 1 {
+			unique = append(unique, anchor{i, c.j})
+		}
+	}
+	return longestIncreasing(unique)
+}
+
+// longestIncreasing returns the longest subsequence of anchors (ordered by
+// i) whose j increases too, by patience sorting
+func longestIncreasing(anchors []anchor) []anchor {
+	if len(anchors) == 0 {
+		return nil
+	}
+
+	// tops[p] is the index of the anchor on top of pile p, prev the anchor
+	// on top of the previous pile when each anchor was placed
+	tops := make([]int, 0, len(anchors))
+	prev := make([]int, len(anchors))
+	for k, a := range anchors {
+		p := sort.Search(len(tops), func(p int) bool { return anchors[tops[p]].j > a.j })
+		prev[k] = -1
+		if p > 0 {
+			prev[k] = tops[p-1]
+		}
+		if p == len(tops) {
+			tops = append(tops, k)
+		} else {
+			tops[p] = k
+		}
+	}
+
+	out := make([]anchor, len(tops))
+	for k, p := tops[len(tops)-1], len(tops)-1; k >= 0; k, p = prev[k], p-1 {
+		out[p] = anchors[k]
+	}
+	return out
+}
@@ -0,0 +1,477 @@
+package diff
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+
+	"github.com/deemkeen/diffwatch/internal/state"
+)
+
+// maxPDFStream is the most bytes a stream of a PDF is inflated to
+const maxPDFStream = 16 << 20
+
+var (
+	pdfObject    = regexp.MustCompile(`(?m)(?:^|[^0-9])(\d+)\s+\d+\s+obj\b`)
+	pdfStream    = regexp.MustCompile(`stream\r?\n`)
+	pdfReference = regexp.MustCompile(`^(\d+)\s+\d+\s+R`)
+)
+
+// diffPDF replaces "binary file changed" for PDF files by the changes to
+// their metadata: title, author, producer, dates, page count and size. If
+// the engine compares document text, the changed lines of the text shown
+// on the pages are listed too, as far as it is stored as plain strings.
+// Files that don't look like PDF keep the binary summary.
+func diffPDF(r *Result) {
+	oldFields, oldText, err := pdfFields(r.OldState, r.documentText)
+	if err != nil {
+		return
+	}
+	newFields, newText, err := pdfFields(r.NewState, r.documentText)
+	if err != nil {
+		return
+	}
+
+	r.Structure = "PDF"
+	r.compareFields(oldFields, newFields)
+	r.compareTexts(oldText, newText)
+}
+
+// pdfFields reads the metadata of a PDF file and, with text, its text. A
+// missing file has none.
+func pdfFields(s *state.FileState, text bool) ([]field, []docText, error) {
+	if s == nil || !s.Exists {
+		return nil, nil, nil
+	}
+	content := s.Content
+	if !bytes.HasPrefix(content, []byte("%PDF-")) {
+		return nil, nil, errors.New("not a PDF file")
+	}
+	version, _, _ := bytes.Cut(content[len("%PDF-"):], []byte("\n"))
+
+	doc := parsePDF(content)
+	fields := []field{{location: "version", value: strings.TrimSpace(string(version))}}
+	if info := doc.dict(doc.trailer("Info")); info != "" {
+		for _, key := range []string{"Title", "Author", "Subject", "Creator", "Producer", "CreationDate", "ModDate"} {
+			value := doc.text(info, key)
+			if strings.HasSuffix(key, "Date") {
+				value = pdfDate(value)
+			}
+			location := map[string]string{"CreationDate": "created", "ModDate": "modified"}[key]
+			if location == "" {
+				location = strings.ToLower(key)
+			}
+			fields = append(fields, field{location: location, value: value})
+		}
+	}
+	if pages := doc.dict(doc.value(doc.dict(doc.trailer("Root")), "Pages")); pages != "" {
+		fields = append(fields, field{location: "pages", value: doc.value(pages, "Count")})
+	}
+	fields = append(documentMeta(fields), field{location: "size", value: fmt.Sprintf("%d bytes", len(content))})
+
+	if !text {
+		return fields, nil, nil
+	}
+	var lines []string
+	for _, stream := range doc.streams {
+		lines = append(lines, pdfTextLines(stream)...)
+	}
+	return fields, []docText{{location: "text", lines: lines}}, nil
+}
+
+// pdfDoc is what diffPDF reads of a PDF file: its objects, those in object
+// streams included, and its streams inflated. It is no full parser: a
+// dictionary is found by its text, and the last definition of an object,
+// which is the latest after incremental updates, wins.
+type pdfDoc struct {
+	raw     []byte
+	objects map[string]string // Object body by number
+	streams [][]byte          // Inflated streams, in the order of the file
+}
+
+// parsePDF finds the objects and streams of a PDF file
+func parsePDF(content []byte) *pdfDoc {
+	doc := &pdfDoc{raw: content, objects: make(map[string]string)}
+
+	for pos := 0; pos < len(content); {
+		m := pdfObject.FindSubmatchIndex(content[pos:])
+		if m == nil {
+			break
+		}
+		number := string(content[pos+m[2] : pos+m[3]])
+		body := content[pos+m[1]:]
+		pos += m[1]
+
+		// Streams are cut by their length, as their data may contain
+		// anything, endobj included
+		var stream []byte
+		var dict string
+		if loc := pdfStream.FindIndex(body); loc != nil && !bytes.Contains(body[:loc[0]], []byte("endobj")) {
+			dict = string(body[:loc[0]])
+			stream = body[loc[1]:]
+			if n, err := strconv.Atoi(doc.value(dict, "Length")); err == nil && n <= len(stream) {
+				stream = stream[:n]
+			} else if j := bytes.Index(stream, []byte("endstream")); j >= 0 {
+				stream = stream[:j]
+			}
+			body = body[:loc[1]+len(stream)]
+		}
+		if j := bytes.Index(body, []byte("endobj")); j >= 0 {
+			body = body[:j]
+		}
+		doc.objects[number] = string(body)
+		pos += len(body)
+
+		if stream == nil {
+			continue
+		}
+		if strings.Contains(dict, "/FlateDecode") {
+			inflated, err := inflate(stream)
+			if err != nil {
+				continue
+			}
+			stream = inflated
+		} else if strings.Contains(dict, "/Filter") {
+			continue
+		}
+		doc.streams = append(doc.streams, stream)
+		if strings.Contains(dict, "/ObjStm") {
+			doc.unpack(dict, stream)
+		}
+	}
+	return doc
+}
+
+// unpack adds the objects of an object stream with the dictionary dict
+func (d *pdfDoc) unpack(dict string, stream []byte) {
+	first, err := strconv.Atoi(d.value(dict, "First"))
+	if err != nil || first > len(stream) {
+		return
+	}
+	header := strings.Fields(string(stream[:first]))
+	for i := 0; i+1 < len(header); i += 2 {
+		from, err := strconv.Atoi(header[i+1])
+		if err != nil || first+from > len(stream) {
+			return
+		}
+		to := len(stream)
+		if i+3 < len(header) {
+			if next, err := strconv.Atoi(header[i+3]); err == nil && first+next <= len(stream) && next >= from {
+				to = first + next
+			}
+		}
+		if _, ok := d.objects[header[i]]; !ok {
+			d.objects[header[i]] = string(stream[first+from : to])
+		}
+	}
+}
+
+// trailer returns the value of key in the last trailer, which is a
+// cross-reference stream dictionary in newer files
+func (d *pdfDoc) trailer(key string) string {
+	i := bytes.LastIndex(d.raw, []byte("/"+key+" "))
+	if i < 0 {
+		return ""
+	}
+	return d.value(string(d.raw[i:]), key)
+}
+
+// dict resolves a reference "12 0 R" to the dictionary of its object, or
+// returns an inline dictionary as it is
+func (d *pdfDoc) dict(value string) string {
+	if m := pdfReference.FindStringSubmatch(value); m != nil {
+		return d.objects[m[1]]
+	}
+	if strings.HasPrefix(value, "<<") {
+		return value
+	}
+	return ""
+}
+
+// value returns the raw value of key in a dictionary: a number, name or
+// reference, a string with its delimiters, or the rest of the dictionary
+// for nested ones
+func (d *pdfDoc) value(dict, key string) string {
+	i := strings.Index(dict, "/"+key)
+	for i >= 0 {
+		rest := dict[i+len(key)+1:]
+		// The key must not be the start of a longer name
+		if rest != "" && (unicode.IsLetter(rune(rest[0])) || unicode.IsDigit(rune(rest[0]))) {
+			j := strings.Index(rest, "/"+key)
+			if j < 0 {
+				return ""
+			}
+			i += len(key) + 1 + j
+			continue
+		}
+		rest = strings.TrimLeft(rest, " \t\r\n")
+		if m := pdfReference.FindString(rest); m != "" {
+			return m
+		}
+		switch {
+		case strings.HasPrefix(rest, "("), strings.HasPrefix(rest, "<<"):
+			return rest
+		case strings.HasPrefix(rest, "<"):
+			end := strings.IndexByte(rest, '>')
+			if end < 0 {
+				return ""
+			}
+			return rest[:end+1]
+		}
+		end := strings.IndexAny(rest[min(1, len(rest)):], "/<>[]() \t\r\n")
+		if end < 0 {
+			return rest
+		}
+		return rest[:end+1]
+	}
+	return ""
+}
+
+// text returns the string value of key in a dictionary, following a
+// reference to it
+func (d *pdfDoc) text(dict, key string) string {
+	value := d.value(dict, key)
+	if m := pdfReference.FindStringSubmatch(value); m != nil {
+		value = strings.TrimSpace(d.objects[m[1]])
+	}
+	s, _ := pdfString(value)
+	return strings.TrimSpace(decodePDFText(s))
+}
+
+// pdfString decodes the literal "(...)" or hexadecimal "<...>" string at
+// the start of s, returning its bytes and the length of its source
+func pdfString(s string) ([]byte, int) {
+	if strings.HasPrefix(s, "<") && !strings.HasPrefix(s, "<<") {
+		end := strings.IndexByte(s, '>')
+		if end < 0 {
+			return nil, len(s)
+		}
+		digits := strings.Map(func(r rune) rune {
+			if unicode.IsSpace(r) {
+				return -1
+			}
+			return r
+		}, s[1:end])
+		if len(digits)%2 == 1 {
+			digits += "0"
+		}
+		var out []byte
+		for i := 0; i+1 < len(digits); i += 2 {
+			b, err := strconv.ParseUint(digits[i:i+2], 16, 8)
+			if err != nil {
+				return nil, end + 1
+			}
+			out = append(out, byte(b))
+		}
+		return out, end + 1
+	}
+	if !strings.HasPrefix(s, "(") {
+		return nil, 0
+	}
+
+	var out []byte
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s):
+			i++
+			switch e := s[i]; e {
+			case 'n':
+				out = append(out, '\n')
+			case 'r':
+				out = append(out, '\r')
+			case 't':
+				out = append(out, '\t')
+			case 'b':
+				out = append(out, '\b')
+			case 'f':
+				out = append(out, '\f')
+			case '\r', '\n':
+				// A line continuation
+			default:
+				if e >= '0' && e <= '7' {
+					j := i
+					for j < len(s) && j < i+3 && s[j] >= '0' && s[j] <= '7' {
+						j++
+					}
+					n, _ := strconv.ParseUint(s[i:j], 8, 8)
+					out = append(out, byte(n))
+					i = j - 1
+					continue
+				}
+				out = append(out, e)
+			}
+		case c == '(':
+			if depth > 0 {
+				out = append(out, c)
+			}
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return out, i + 1
+			}
+			out = append(out, c)
+		default:
+			out = append(out, c)
+		}
+	}
+	return out, len(s)
+}
+
+// decodePDFText decodes a text string, UTF-16 with a byte order mark or
+// PDFDocEncoding, which is close enough to Latin-1 for metadata
+func decodePDFText(b []byte) string {
+	if len(b) >= 2 && b[0] == 0xFE && b[1] == 0xFF {
+		units := make([]uint16, 0, len(b)/2)
+		for i := 2; i+1 < len(b); i += 2 {
+			units = append(units, uint16(b[i])<<8|uint16(b[i+1]))
+		}
+		return string(utf16.Decode(units))
+	}
+	if len(b) >= 3 && b[0] == 0xEF && b[1] == 0xBB && b[2] == 0xBF {
+		return string(b[3:])
+	}
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+// pdfDate formats a date like D:20240131142500+01'00' as
+// 2024-01-31 14:25:00 +01:00, or returns it as it is if it doesn't parse
+func pdfDate(s string) string {
+	digits := strings.TrimPrefix(s, "D:")
+	if len(digits) < 14 {
+		return s
+	}
+	if _, err := strconv.Atoi(digits[:14]); err != nil {
+		return s
+	}
+	out := fmt.Sprintf("%s-%s-%s %s:%s:%s", digits[:4], digits[4:6], digits[6:8], digits[8:10], digits[10:12], digits[12:14])
+	switch zone := strings.ReplaceAll(digits[14:], "'", ""); {
+	case zone == "Z" || zone == "":
+		return out + " UTC"
+	case len(zone) == 5:
+		return out + " " + zone[:3] + ":" + zone[3:]
+	default:
+		return out + " " + zone
+	}
+}
+
+// inflate decompresses a Flate encoded stream, up to maxPDFStream bytes
+func inflate(stream []byte) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(stream))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	out, err := io.ReadAll(io.LimitReader(zr, maxPDFStream))
+	if len(out) > 0 {
+		// Streams are often cut or padded; keep what inflated
+		return out, nil
+	}
+	return nil, err
+}
+
+// pdfTextLines returns the text a content stream shows with the Tj, TJ, '
+// and " operators, a line per text object or line move. Strings that are
+// glyph ids of embedded fonts rather than characters are skipped. Streams
+// that aren't content streams have no text.
+func pdfTextLines(stream []byte) []string {
+	if !bytes.Contains(stream, []byte("BT")) || !bytes.Contains(stream, []byte("ET")) {
+		return nil
+	}
+
+	var lines []string
+	var line strings.Builder
+	var strs [][]byte
+	var operands []string
+	newLine := func() {
+		if text := strings.TrimSpace(line.String()); text != "" {
+			lines = append(lines, text)
+		}
+		line.Reset()
+	}
+
+	s := string(stream)
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f' || c == '[' || c == ']':
+			i++
+		case c == '%':
+			for i < len(s) && s[i] != '\n' && s[i] != '\r' {
+				i++
+			}
+		case c == '(' || c == '<' && !strings.HasPrefix(s[i:], "<<"):
+			str, n := pdfString(s[i:])
+			strs = append(strs, str)
+			i += max(n, 1)
+		case c == '<' || c == '>':
+			// Dictionaries of inline images and marked content
+			i += 2
+		default:
+			j := i + 1
+			for j < len(s) && !strings.ContainsRune(" \t\r\n\f[]()<>/%", rune(s[j])) {
+				j++
+			}
+			tok := s[i:j]
+			i = j
+			if c == '/' || c == '-' || c == '.' || c >= '0' && c <= '9' {
+				// Wide gaps between the strings of a TJ array are spaces
+				if n, err := strconv.ParseFloat(tok, 64); err == nil && n < -200 && len(strs) > 0 {
+					strs = append(strs, []byte(" "))
+				}
+				operands = append(operands, tok)
+				continue
+			}
+
+			switch tok {
+			case "Tj", "TJ", "'", `"`:
+				if tok != "Tj" && tok != "TJ" {
+					newLine()
+				}
+				for _, str := range strs {
+					if printable(str) {
+						line.WriteString(decodePDFText(str))
+					}
+				}
+			case "T*", "ET":
+				newLine()
+			case "Td", "TD":
+				if len(operands) >= 2 && strings.Trim(operands[len(operands)-1], "-0.") != "" {
+					newLine()
+				}
+			case "BI":
+				// Skip inline image data
+				if end := strings.Index(s[i:], "EI"); end >= 0 {
+					i += end + 2
+				}
+			}
+			strs, operands = strs[:0], operands[:0]
+		}
+	}
+	newLine()
+	return lines
+}
+
+// printable reports whether a string shown on a page is text: no control
+// characters but whitespace
+func printable(b []byte) bool {
+	for _, c := range b {
+		if c < 0x20 && c != '\t' && c != '\n' && c != '\r' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,17 @@
+package diff
+
+import "testing"
+
+func TestPDFDate(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"D:20240105100000Z", "2024-01-05 10:00:00 UTC"},
+		{"D:20240105100000+02'00'", "2024-01-05 10:00:00 +02:00"},
+		{"D:2024", "D:2024"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := pdfDate(tt.in); got != tt.want {
+			t.Errorf("pdfDate(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
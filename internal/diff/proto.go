@@ -0,0 +1,572 @@
+package diff
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/deemkeen/diffwatch/internal/state"
+)
+
+// protoDecl is a message, enum or service of a .proto file
+type protoDecl struct {
+	kind     string // "message", "enum" or "service"
+	name     string // Full name within the file, e.g. "Outer.Inner"
+	members  []protoMember
+	reserved []string // Reserved names, and tags as ranges like "9 to 11"
+}
+
+// protoMember is a field of a message, a value of an enum or an RPC of a
+// service
+type protoMember struct {
+	name  string
+	tag   int    // Field tag or enum value; 0 for RPCs
+	label string // "repeated", "optional", "required" or "" for fields
+	typ   string // Field type, "" for enum values
+	text  string // How the member reads, e.g. "repeated string tags = 4"
+}
+
+// maxProtoBreaks is the most compatibility breaks named in the danger note
+const maxProtoBreaks = 3
+
+// diffProto replaces the line diff of a .proto file by the messages,
+// fields, enum values and RPCs that were added, removed or changed, and
+// marks the result dangerous if a change breaks compatibility with
+// existing data or clients: a field or enum value removed without being
+// reserved, a tag renumbered or reused, a field type or cardinality
+// changed incompatibly, an RPC removed or changed. Files that don't parse
+// keep their line diff.
+func diffProto(r *Result) {
+	oldDecls, err := protoDecls(r.OldState)
+	if err != nil {
+		return
+	}
+	newDecls, err := protoDecls(r.NewState)
+	if err != nil {
+		return
+	}
+
+	r.Structure = "Protobuf"
+	var breaks []string
+
+	newByName := make(map[string]*protoDecl, len(newDecls))
+	for _, d := range newDecls {
+		newByName[d.name] = d
+	}
+	oldByName := make(map[string]*protoDecl, len(oldDecls))
+	for _, d := range oldDecls {
+		oldByName[d.name] = d
+	}
+	renamed := make(map[string]bool)
+	for _, d := range oldDecls {
+		if n, ok := newByName[d.name]; ok && n.kind == d.kind {
+			breaks = append(breaks, compareProtoDecls(r, d, n)...)
+			continue
+		}
+		if n := d.renamedTo(newDecls, oldByName, renamed); n != nil {
+			r.modified(d.kind+" "+d.name, d.name, n.name)
+			renamed[n.name] = true
+			continue
+		}
+		r.deleted(d.kind+" "+d.name, d.summary())
+		if d.kind == "service" {
+			breaks = append(breaks, "service "+d.name+" removed")
+		}
+	}
+	for _, d := range newDecls {
+		if o, ok := oldByName[d.name]; (!ok || o.kind != d.kind) && !renamed[d.name] {
+			r.added(d.kind+" "+d.name, d.summary())
+		}
+	}
+
+	if len(breaks) > maxProtoBreaks {
+		breaks = append(breaks[:maxProtoBreaks], fmt.Sprintf("%d more", len(breaks)-maxProtoBreaks))
+	}
+	if len(breaks) > 0 {
+		r.Dangerous = "breaks compatibility: " + strings.Join(breaks, "; ")
+	}
+}
+
+// compareProtoDecls records the changes between two versions of a
+// declaration and returns the compatibility breaks among them. A field
+// that disappears while a new one of the same type takes its tag was
+// renamed, which old data survives.
+func compareProtoDecls(r *Result, a, b *protoDecl) []string {
+	var breaks []string
+	newByName, newByTag := make(map[string]protoMember), make(map[int]protoMember)
+	for _, m := range b.members {
+		newByName[m.name] = m
+		newByTag[m.tag] = m
+	}
+	oldByName, oldByTag := make(map[string]protoMember), make(map[int]protoMember)
+	for _, m := range a.members {
+		oldByName[m.name] = m
+		oldByTag[m.tag] = m
+	}
+	numbered := a.kind != "service"
+	renamed := make(map[string]bool)
+
+	for _, m := range a.members {
+		location := a.name + "." + m.name
+		if n, ok := newByName[m.name]; ok {
+			if n.text == m.text {
+				continue
+			}
+			r.modified(location, m.text, n.text)
+			switch {
+			case !numbered:
+				breaks = append(breaks, "rpc "+location+" changed")
+			case n.tag != m.tag:
+				breaks = append(breaks, fmt.Sprintf("%s renumbered from %d to %d", location, m.tag, n.tag))
+			case !compatibleTypes(m.typ, n.typ):
+				breaks = append(breaks, fmt.Sprintf("%s changed type from %s to %s", location, m.typ, n.typ))
+			case (m.label == "repeated") != (n.label == "repeated"):
+				breaks = append(breaks, location+" changed between repeated and singular")
+			}
+			continue
+		}
+
+		if n, ok := newByTag[m.tag]; numbered && ok && n.typ == m.typ && n.label == m.label {
+			if _, existed := oldByName[n.name]; !existed {
+				r.modified(location, m.text, n.text)
+				renamed[n.name] = true
+				continue
+			}
+		}
+
+		r.deleted(location, m.text)
+		switch {
+		case !numbered:
+			breaks = append(breaks, "rpc "+location+" removed")
+		case !b.reserves(m):
+			breaks = append(breaks, location+" removed without reserving it")
+		}
+	}
+
+	for _, n := range b.members {
+		if _, ok := oldByName[n.name]; ok || renamed[n.name] {
+			continue
+		}
+		r.added(b.name+"."+n.name, n.text)
+		if o, ok := oldByTag[n.tag]; numbered && ok && o.name != n.name {
+			breaks = append(breaks, fmt.Sprintf("tag %d of %s reused by %s", n.tag, b.name, n.name))
+		}
+	}
+	return breaks
+}
+
+// renamedTo returns the declaration among decls that the message or enum
+// d was renamed to: a new one of the same kind with the same members, not
+// taken by another rename. The wire format doesn't name messages and
+// enums, so data survives their renames; clients calling a service by its
+// name don't.
+func (d *protoDecl) renamedTo(decls []*protoDecl, old map[string]*protoDecl, taken map[string]bool) *protoDecl {
+	if d.kind == "service" || len(d.members) == 0 {
+		return nil
+	}
+	sameText := func(a, b protoMember) bool { return a.text == b.text }
+	for _, n := range decls {
+		if o, ok := old[n.name]; ok && o.kind == n.kind || taken[n.name] || n.kind != d.kind {
+			continue
+		}
+		if slices.EqualFunc(d.members, n.members, sameText) {
+			return n
+		}
+	}
+	return nil
+}
+
+// reserves reports whether the name or tag of a member is reserved
+func (d *protoDecl) reserves(m protoMember) bool {
+	for _, r := range d.reserved {
+		if r == m.name {
+			return true
+		}
+		from, to, isRange := strings.Cut(r, " to ")
+		low, err := strconv.Atoi(from)
+		if err != nil {
+			continue
+		}
+		high := low
+		switch {
+		case to == "max":
+			high = int(^uint(0) >> 1)
+		case isRange:
+			if high, err = strconv.Atoi(to); err != nil {
+				continue
+			}
+		}
+		if m.tag >= low && m.tag <= high {
+			return true
+		}
+	}
+	return false
+}
+
+// summary describes a declaration by the number of its members
+func (d *protoDecl) summary() string {
+	noun := map[string]string{"message": "field", "enum": "value", "service": "rpc"}[d.kind]
+	if len(d.members) != 1 {
+		noun += "s"
+	}
+	return fmt.Sprintf("%d %s", len(d.members), noun)
+}
+
+// wireGroups are the scalar types whose values read as each other on the
+// wire
+var wireGroups = [][]string{
+	{"int32", "uint32", "int64", "uint64", "bool"},
+	{"sint32", "sint64"},
+	{"fixed32", "sfixed32"},
+	{"fixed64", "sfixed64"},
+	{"string", "bytes"},
+}
+
+// compatibleTypes reports whether data written with field type a can be
+// read as type b
+func compatibleTypes(a, b string) bool {
+	if a == b {
+		return true
+	}
+	for _, group := range wireGroups {
+		if slices.Contains(group, a) && slices.Contains(group, b) {
+			return true
+		}
+	}
+	return false
+}
+
+// protoDecls parses the messages, enums and services of a .proto file,
+// nested ones included. A missing file has none.
+func protoDecls(s *state.FileState) ([]*protoDecl, error) {
+	if s == nil || !s.Exists {
+		return nil, nil
+	}
+	p := &protoParser{tokens: protoTokens(string(s.Content))}
+	if err := p.body("", nil); err != nil {
+		return nil, err
+	}
+	return p.decls, nil
+}
+
+// protoParser reads the declarations of a .proto file from its tokens
+type protoParser struct {
+	tokens []string
+	pos    int
+	decls  []*protoDecl
+}
+
+// next returns the next token, "" at the end
+func (p *protoParser) next() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	p.pos++
+	return p.tokens[p.pos-1]
+}
+
+// peek returns the next token without consuming it
+func (p *protoParser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+// expect consumes the next token, which must be want
+func (p *protoParser) expect(want string) error {
+	if got := p.next(); got != want {
+		return fmt.Errorf("expected %q, found %q", want, got)
+	}
+	return nil
+}
+
+// errUnexpectedEnd reports a file cut off in the middle of a declaration
+var errUnexpectedEnd = errors.New("unexpected end of file")
+
+// body parses statements until the closing brace of the declaration d, or
+// the end of the file at the top level (d nil). Declarations are named
+// within scope.
+func (p *protoParser) body(scope string, d *protoDecl) error {
+	for {
+		tok := p.next()
+		switch tok {
+		case "":
+			if d != nil {
+				return errUnexpectedEnd
+			}
+			return nil
+		case "}":
+			if d == nil {
+				return errors.New("unexpected }")
+			}
+			return nil
+		case ";":
+			continue
+		case "message", "enum", "service":
+			if err := p.decl(tok, scope); err != nil {
+				return err
+			}
+			continue
+		case "syntax", "edition", "package", "import", "option", "extensions":
+			if err := p.skip(); err != nil {
+				return err
+			}
+			continue
+		case "extend":
+			p.next()
+			if err := p.expect("{"); err != nil {
+				return err
+			}
+			if err := p.skipBlock(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if d == nil {
+			return fmt.Errorf("unexpected %q", tok)
+		}
+		var err error
+		switch {
+		case tok == "reserved":
+			err = p.reserved(d)
+		case tok == "oneof" && d.kind == "message":
+			p.next()
+			if err = p.expect("{"); err == nil {
+				err = p.body(scope, d)
+			}
+		case tok == "rpc" && d.kind == "service":
+			err = p.rpc(d)
+		case d.kind == "enum":
+			err = p.value(d, tok)
+		case d.kind == "message":
+			err = p.field(d, tok)
+		default:
+			err = p.skip()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// decl parses a message, enum or service after its keyword
+func (p *protoParser) decl(kind, scope string) error {
+	name := p.next()
+	if !protoIdent(name) {
+		return fmt.Errorf("bad %s name %q", kind, name)
+	}
+	if scope != "" {
+		name = scope + "." + name
+	}
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+	d := &protoDecl{kind: kind, name: name}
+	p.decls = append(p.decls, d)
+	return p.body(name, d)
+}
+
+// field parses a message field starting with tok: [label] type name = tag
+// [options];, map<key, value> name = tag; or a group
+func (p *protoParser) field(d *protoDecl, tok string) error {
+	m := protoMember{}
+	if tok == "repeated" || tok == "optional" || tok == "required" {
+		m.label, tok = tok, p.next()
+	}
+	m.typ = tok
+	if tok == "map" && p.peek() == "<" {
+		var b strings.Builder
+		b.WriteString("map")
+		for t := p.next(); t != ">"; t = p.next() {
+			if t == "" {
+				return errUnexpectedEnd
+			}
+			b.WriteString(t)
+			if t == "," {
+				b.WriteString(" ")
+			}
+		}
+		m.typ = b.String() + ">"
+	}
+	if !protoIdent(strings.TrimPrefix(m.typ, ".")) && !strings.HasPrefix(m.typ, "map<") {
+		return fmt.Errorf("bad field type %q", m.typ)
+	}
+
+	m.name = p.next()
+	if !protoIdent(m.name) {
+		return fmt.Errorf("bad field name %q", m.name)
+	}
+	if err := p.expect("="); err != nil {
+		return err
+	}
+	tag, err := strconv.Atoi(p.next())
+	if err != nil {
+		return fmt.Errorf("field %s: bad tag: %w", m.name, err)
+	}
+	m.tag = tag
+	m.text = strings.TrimSpace(fmt.Sprintf("%s %s %s = %d", m.label, m.typ, m.name, tag))
+	d.members = append(d.members, m)
+
+	// Groups have a body, like messages
+	if p.peek() == "{" {
+		p.next()
+		return p.body(d.name+"."+m.name, &protoDecl{kind: "message"})
+	}
+	return p.skip()
+}
+
+// value parses an enum value starting with its name: NAME = number
+// [options];
+func (p *protoParser) value(d *protoDecl, name string) error {
+	if !protoIdent(name) {
+		return fmt.Errorf("bad enum value %q", name)
+	}
+	if err := p.expect("="); err != nil {
+		return err
+	}
+	number, err := strconv.ParseInt(p.next(), 0, 64)
+	if err != nil {
+		return fmt.Errorf("enum value %s: %w", name, err)
+	}
+	d.members = append(d.members, protoMember{name: name, tag: int(number), text: fmt.Sprintf("%s = %d", name, number)})
+	return p.skip()
+}
+
+// rpc parses an RPC after its keyword: Name (Request) returns (Response)
+// followed by ; or a body of options
+func (p *protoParser) rpc(d *protoDecl) error {
+	name := p.next()
+	var signature []string
+	for t := p.peek(); t != ";" && t != "{"; t = p.peek() {
+		if t == "" {
+			return errUnexpectedEnd
+		}
+		signature = append(signature, p.next())
+	}
+	text := strings.Join(signature, " ")
+	text = strings.NewReplacer("( ", "(", " )", ")").Replace(text)
+	d.members = append(d.members, protoMember{name: name, text: "rpc " + name + text})
+	return p.skip()
+}
+
+// reserved parses the reserved names or tag ranges of a declaration
+func (p *protoParser) reserved(d *protoDecl) error {
+	var current []string
+	flush := func() {
+		if len(current) > 0 {
+			d.reserved = append(d.reserved, strings.Join(current, " "))
+			current = nil
+		}
+	}
+	for {
+		switch t := p.next(); t {
+		case "":
+			return errUnexpectedEnd
+		case ";":
+			flush()
+			return nil
+		case ",":
+			flush()
+		default:
+			current = append(current, strings.Trim(t, `"'`))
+		}
+	}
+}
+
+// skip consumes the rest of a statement: up to its semicolon, or its
+// block in braces
+func (p *protoParser) skip() error {
+	for {
+		switch p.next() {
+		case "":
+			return errUnexpectedEnd
+		case ";":
+			return nil
+		case "{":
+			return p.skipBlock()
+		}
+	}
+}
+
+// skipBlock consumes tokens up to the brace closing the one just read
+func (p *protoParser) skipBlock() error {
+	for depth := 1; depth > 0; {
+		switch p.next() {
+		case "":
+			return errUnexpectedEnd
+		case "{":
+			depth++
+		case "}":
+			depth--
+		}
+	}
+	return nil
+}
+
+// protoIdent reports whether s is a possibly qualified identifier
+func protoIdent(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, part := range strings.Split(s, ".") {
+		if part == "" || !(unicode.IsLetter(rune(part[0])) || part[0] == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// protoTokens splits a .proto file into identifiers, numbers, strings and
+// symbols, without comments
+func protoTokens(src string) []string {
+	var tokens []string
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			i++
+		case strings.HasPrefix(src[i:], "//"):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				return tokens
+			}
+			i += end + 4
+		case c == '"' || c == '\'':
+			j := i + 1
+			for j < len(src) && src[j] != c {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			j = min(j+1, len(src))
+			tokens = append(tokens, src[i:j])
+			i = j
+		case isProtoWord(c) || c == '-' && i+1 < len(src) && src[i+1] >= '0' && src[i+1] <= '9':
+			j := i + 1
+			for j < len(src) && isProtoWord(src[j]) {
+				j++
+			}
+			tokens = append(tokens, src[i:j])
+			i = j
+		default:
+			tokens = append(tokens, string(c))
+			i++
+		}
+	}
+	return tokens
+}
+
+// isProtoWord reports whether c can be part of an identifier or number
+func isProtoWord(c byte) bool {
+	return c == '_' || c == '.' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
@@ -0,0 +1,128 @@
+package diff
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDiffProto(t *testing.T) {
+	tests := []struct {
+		name      string
+		old, new  string
+		want      []Change
+		dangerous string
+	}{
+		{
+			name: "field renumbered",
+			old:  "message M { string a = 1; }",
+			new:  "message M { string a = 2; }",
+			want: []Change{
+				{Type: LineModified, Location: "M.a", Old: "string a = 1", New: "string a = 2"},
+			},
+			dangerous: "breaks compatibility: M.a renumbered from 1 to 2",
+		},
+		{
+			// Same tag and type: old data reads fine
+			name: "field renamed",
+			old:  "message M { string a = 1; }",
+			new:  "message M { string b = 1; }",
+			want: []Change{
+				{Type: LineModified, Location: "M.a", Old: "string a = 1", New: "string b = 1"},
+			},
+		},
+		{
+			name: "message renamed",
+			old:  "message User { string name = 1; int32 age = 2; }",
+			new:  "message Account { string name = 1; int32 age = 2; }",
+			want: []Change{
+				{Type: LineModified, Location: "message User", Old: "User", New: "Account"},
+			},
+		},
+		{
+			name: "nested message renamed with its parent",
+			old:  "message User { message Address { string city = 1; } Address home = 1; }",
+			new:  "message Account { message Address { string city = 1; } Address home = 1; }",
+			want: []Change{
+				{Type: LineModified, Location: "message User", Old: "User", New: "Account"},
+				{Type: LineModified, Location: "message User.Address", Old: "User.Address", New: "Account.Address"},
+			},
+		},
+		{
+			// Clients call services by name
+			name: "service renamed",
+			old:  "service Users { rpc Get(Req) returns (Res); }",
+			new:  "service Accounts { rpc Get(Req) returns (Res); }",
+			want: []Change{
+				{Type: LineDeleted, Location: "service Users", Old: "1 rpc"},
+				{Type: LineAdded, Location: "service Accounts", New: "1 rpc"},
+			},
+			dangerous: "breaks compatibility: service Users removed",
+		},
+		{
+			name: "field removed",
+			old:  "message M { string a = 1; string b = 2; }",
+			new:  "message M { string a = 1; }",
+			want: []Change{
+				{Type: LineDeleted, Location: "M.b", Old: "string b = 2"},
+			},
+			dangerous: "breaks compatibility: M.b removed without reserving it",
+		},
+		{
+			name: "field reserved",
+			old:  "message M { string a = 1; string b = 10; }",
+			new:  "message M { string a = 1; reserved 9 to 11; }",
+			want: []Change{
+				{Type: LineDeleted, Location: "M.b", Old: "string b = 10"},
+			},
+		},
+		{
+			name: "incompatible type",
+			old:  "message M { string a = 1; }",
+			new:  "message M { int32 a = 1; }",
+			want: []Change{
+				{Type: LineModified, Location: "M.a", Old: "string a = 1", New: "int32 a = 1"},
+			},
+			dangerous: "breaks compatibility: M.a changed type from string to int32",
+		},
+		{
+			name: "compatible type",
+			old:  "message M { int32 a = 1; }",
+			new:  "message M { int64 a = 1; }",
+			want: []Change{
+				{Type: LineModified, Location: "M.a", Old: "int32 a = 1", New: "int64 a = 1"},
+			},
+		},
+		{
+			name: "tag reused",
+			old:  "message M { string a = 1; }",
+			new:  "message M { int32 b = 1; }",
+			want: []Change{
+				{Type: LineDeleted, Location: "M.a", Old: "string a = 1"},
+				{Type: LineAdded, Location: "M.b", New: "int32 b = 1"},
+			},
+			dangerous: "breaks compatibility: M.a removed without reserving it; tag 1 of M reused by b",
+		},
+		{
+			name: "enum value added",
+			old:  "enum Role { ROLE_UNSPECIFIED = 0; ROLE_ADMIN = 1; }",
+			new:  "enum Role { ROLE_UNSPECIFIED = 0; ROLE_ADMIN = 1; ROLE_GUEST = 2; }",
+			want: []Change{
+				{Type: LineAdded, Location: "Role.ROLE_GUEST", New: "ROLE_GUEST = 2"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := compute(t, "user.proto", tt.old, tt.new)
+			if result.Structure != "Protobuf" {
+				t.Fatalf("structure %q, want Protobuf", result.Structure)
+			}
+			if !slices.Equal(result.Changes, tt.want) {
+				t.Errorf("changes %+v, want %+v", result.Changes, tt.want)
+			}
+			if result.Dangerous != tt.dangerous {
+				t.Errorf("dangerous %q, want %q", result.Dangerous, tt.dangerous)
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+package diff
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// filePatch is the part of a multi-file diff that changes one file
+type filePatch struct {
+	git              bool   // Started by a "diff --git" line
+	oldName, newName string // From the ---/+++ lines, "" if missing
+	gitOld, gitNew   string // From the "diff --git" and rename or copy lines
+	isNew, isDeleted bool   // From git's file mode lines
+	binary           bool   // Git binary patch, whose data isn't shown
+	headers          bool   // The ---/+++ lines were seen
+	body             strings.Builder
+}
+
+// ParseDiff parses the output of diff -u, git diff or git format-patch into
+// one result per changed file, for display. Text outside of the file
+// patches, like commit messages, is skipped. Renames, copies and mode
+// changes without content changes have results without a diff.
+func ParseDiff(text string) ([]*Result, error) {
+	var files []*filePatch
+	var cur *filePatch
+	start := func(git bool) {
+		cur = &filePatch{git: git}
+		files = append(files, cur)
+	}
+
+	lines := strings.SplitAfter(text, "\n")
+	oldLeft, newLeft := 0, 0 // Lines left in the current hunk on each side
+	for i, raw := range lines {
+		body := strings.TrimRight(raw, "\r\n")
+
+		if oldLeft > 0 || newLeft > 0 {
+			switch {
+			case strings.HasPrefix(body, `\`):
+			case strings.HasPrefix(body, "+"):
+				newLeft--
+			case strings.HasPrefix(body, "-"):
+				oldLeft--
+			case strings.HasPrefix(body, " "), body == "":
+				// Some tools and editors strip the space of empty context lines
+				if body == "" {
+					raw = " " + raw
+				}
+				oldLeft--
+				newLeft--
+			default:
+				return nil, fmt.Errorf("parsing diff: line %d: hunk ends early: %q", i+1, body)
+			}
+			cur.body.WriteString(raw)
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(body, "diff --git "):
+			start(true)
+			cur.gitOld, cur.gitNew = gitNames(strings.TrimPrefix(body, "diff --git "))
+		case strings.HasPrefix(body, "diff "):
+			start(false)
+		case strings.HasPrefix(body, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			if cur == nil || cur.headers {
+				start(false)
+			}
+			cur.headers = true
+			cur.oldName = headerName(body)
+		case strings.HasPrefix(body, "+++ ") && cur != nil && cur.headers && cur.newName == "" && cur.body.Len() == 0:
+			cur.newName = headerName(body)
+		case strings.HasPrefix(body, "@@"):
+			if cur == nil || !cur.headers {
+				return nil, fmt.Errorf("parsing diff: line %d: hunk without file names", i+1)
+			}
+			var err error
+			if oldLeft, newLeft, err = hunkLengths(body); err != nil {
+				return nil, fmt.Errorf("parsing diff: line %d: %w", i+1, err)
+			}
+			cur.body.WriteString(raw)
+		case strings.HasPrefix(body, `\`) && cur != nil && cur.body.Len() > 0:
+			// "\ No newline at end of file" follows the last line of a hunk
+			cur.body.WriteString(raw)
+		case strings.HasPrefix(body, "Binary files ") && strings.HasSuffix(body, " differ"):
+			if cur == nil || cur.headers || cur.body.Len() > 0 {
+				start(false)
+			}
+			cur.body.WriteString(body + "\n")
+			if cur.gitOld == "" {
+				names := strings.TrimSuffix(strings.TrimPrefix(body, "Binary files "), " differ")
+				cur.gitOld, cur.gitNew, _ = strings.Cut(names, " and ")
+			}
+		case cur == nil:
+			// Text before the first file, e.g. a commit message
+		case strings.HasPrefix(body, "rename from "), strings.HasPrefix(body, "copy from "):
+			_, cur.gitOld, _ = strings.Cut(body, " from ")
+		case strings.HasPrefix(body, "rename to "), strings.HasPrefix(body, "copy to "):
+			_, cur.gitNew, _ = strings.Cut(body, " to ")
+		case strings.HasPrefix(body, "new file mode "):
+			cur.isNew = true
+		case strings.HasPrefix(body, "deleted file mode "):
+			cur.isDeleted = true
+		case body == "GIT binary patch":
+			cur.binary = true
+		}
+	}
+	if oldLeft > 0 || newLeft > 0 {
+		return nil, fmt.Errorf("parsing diff: last hunk is cut short")
+	}
+
+	var results []*Result
+	for _, f := range files {
+		result, err := f.result()
+		if err != nil {
+			return nil, err
+		}
+		if result != nil {
+			results = append(results, result)
+		}
+	}
+	return results, nil
+}
+
+// result parses the patch of one file, or returns nil if the section
+// names no file, e.g. a "diff -r" line for identical files
+func (f *filePatch) result() (*Result, error) {
+	oldName, newName := f.gitOld, f.gitNew
+	if f.headers {
+		oldName, newName = f.oldName, f.newName
+		if f.git || strings.HasPrefix(oldName, "a/") && strings.HasPrefix(newName, "b/") {
+			oldName, newName = strings.TrimPrefix(oldName, "a/"), strings.TrimPrefix(newName, "b/")
+		}
+	} else if f.git {
+		oldName, newName = strings.TrimPrefix(oldName, "a/"), strings.TrimPrefix(newName, "b/")
+	}
+
+	path := newName
+	if path == "" || path == devNull {
+		path = oldName
+	}
+	if path == "" || path == devNull {
+		return nil, nil
+	}
+
+	patch := f.body.String()
+	if f.headers && patch != "" {
+		patch = "--- " + oldName + "\n+++ " + newName + "\n" + patch
+	}
+	if patch == "" && f.binary {
+		from, to := "a/"+oldName, "b/"+newName
+		if f.isNew {
+			from = devNull
+		}
+		if f.isDeleted {
+			to = devNull
+		}
+		patch = "Binary files " + from + " and " + to + " differ\n"
+	}
+
+	result, err := ParsePatch(path, patch)
+	if err != nil {
+		return nil, err
+	}
+	result.IsNew = result.IsNew || f.isNew || oldName == devNull
+	result.IsDeleted = result.IsDeleted || f.isDeleted || newName == devNull
+
+	// Plain diffs of two directories name each side differently, only git
+	// marks renames
+	if f.git && oldName != devNull && newName != devNull && oldName != path {
+		result.RenamedFrom = oldName
+	}
+	return result, nil
+}
+
+// headerName returns the file name of a ---/+++ line, without the
+// timestamp diff -u appends after a tab
+func headerName(line string) string {
+	name, _, _ := strings.Cut(line[4:], "\t")
+	return strings.TrimSpace(name)
+}
+
+// gitNames splits the "a/OLD b/NEW" names of a "diff --git" line. Names
+// containing " b/" are ambiguous; the rename lines or ---/+++ lines that
+// follow take precedence anyway.
+func gitNames(names string) (oldName, newName string) {
+	if i := strings.LastIndex(names, " b/"); i >= 0 {
+		return names[:i], names[i+1:]
+	}
+	return names, names
+}
+
+// hunkLengths returns the number of old and new lines of a hunk header
+// like "@@ -1,3 +1,4 @@". A range without a length has one line.
+func hunkLengths(header string) (oldLen, newLen int, err error) {
+	fields := strings.Fields(header)
+	if len(fields) < 4 || !strings.HasPrefix(fields[1], "-") || !strings.HasPrefix(fields[2], "+") {
+		return 0, 0, fmt.Errorf("invalid hunk header %q", header)
+	}
+
+	length := func(r string) (int, error) {
+		_, n, ok := strings.Cut(r[1:], ",")
+		if !ok {
+			return 1, nil
+		}
+		l, err := strconv.Atoi(n)
+		if err != nil || l < 0 {
+			return 0, fmt.Errorf("invalid hunk header %q", header)
+		}
+		return l, nil
+	}
+
+	if oldLen, err = length(fields[1]); err != nil {
+		return 0, 0, err
+	}
+	if newLen, err = length(fields[2]); err != nil {
+		return 0, 0, err
+	}
+	return oldLen, newLen, nil
+}
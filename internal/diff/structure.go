@@ -0,0 +1,86 @@
+package diff
+
+import "fmt"
+
+// Change is a change to an element of a structured file, like an
+// attribute of an XML element, found by the handler of its language
+type Change struct {
+	Type     LineType // LineAdded, LineDeleted or LineModified
+	Location string   // Where the element is, e.g. /project/version
+	Old, New string   // Value before and after, empty on the side the element is missing
+}
+
+// added, deleted and modified record changes found by a handler
+func (r *Result) added(location, value string) {
+	r.Changes = append(r.Changes, Change{Type: LineAdded, Location: location, New: value})
+}
+
+func (r *Result) deleted(location, value string) {
+	r.Changes = append(r.Changes, Change{Type: LineDeleted, Location: location, Old: value})
+}
+
+func (r *Result) modified(location, old, new string) {
+	r.Changes = append(r.Changes, Change{Type: LineModified, Location: location, Old: old, New: new})
+}
+
+// bothVersions reports whether a handler can compare the result's
+// versions: both exist and are text
+func (r *Result) bothVersions() bool {
+	return !r.IsNew && !r.IsDeleted && !r.IsBinary && r.OldState != nil && r.NewState != nil
+}
+
+// field is a named value of a structured file, like a key of a .env file
+type field struct {
+	location string // e.g. "certificate[2]/subject"
+	value    string
+}
+
+// compareFields records the fields that were removed or changed between
+// two versions, in the order of the old one, then those that were added
+func (r *Result) compareFields(oldFields, newFields []field) {
+	newValues := make(map[string]string, len(newFields))
+	for _, f := range newFields {
+		newValues[f.location] = f.value
+	}
+	oldValues := make(map[string]string, len(oldFields))
+	for _, f := range oldFields {
+		oldValues[f.location] = f.value
+		switch value, ok := newValues[f.location]; {
+		case !ok:
+			r.deleted(f.location, f.value)
+		case value != f.value:
+			r.modified(f.location, f.value, value)
+		}
+	}
+	for _, f := range newFields {
+		if _, ok := oldValues[f.location]; !ok {
+			r.added(f.location, f.value)
+		}
+	}
+}
+
+// compareLines records the lines that were removed, added or changed
+// between two versions of a text, located as "location:2" by their line
+// number on the side they are on
+func (r *Result) compareLines(location string, a, b []string) {
+	for _, c := range OpCodes(a, b, Myers) {
+		switch c.Tag {
+		case 'e':
+			continue
+		case 'r':
+			// Lines replaced one for one read as changed lines
+			if c.I2-c.I1 == c.J2-c.J1 {
+				for k := range c.I2 - c.I1 {
+					r.modified(fmt.Sprintf("%s:%d", location, c.J1+k+1), a[c.I1+k], b[c.J1+k])
+				}
+				continue
+			}
+		}
+		for i := c.I1; i < c.I2; i++ {
+			r.deleted(fmt.Sprintf("%s:%d", location, i+1), a[i])
+		}
+		for j := c.J1; j < c.J2; j++ {
+			r.added(fmt.Sprintf("%s:%d", location, j+1), b[j])
+		}
+	}
+}
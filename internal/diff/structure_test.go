@@ -0,0 +1,38 @@
+package diff
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/deemkeen/diffwatch/internal/state"
+)
+
+// fileState returns the state of a file at path with content
+func fileState(path, content string) *state.FileState {
+	return &state.FileState{Path: path, Content: []byte(content), Exists: true, Hash: state.HashContent([]byte(content))}
+}
+
+// compute diffs two versions of the file at path, whose name selects the
+// handler
+func compute(t *testing.T, path, old, new string) *Result {
+	t.Helper()
+	result, err := New("", "").Compute(fileState(path, old), fileState(path, new))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestCompareLines(t *testing.T) {
+	r := &Result{}
+	r.compareLines("text", []string{"a", "b", "c", "d"}, []string{"a", "B", "c", "e", "f"})
+	want := []Change{
+		{Type: LineModified, Location: "text:2", Old: "b", New: "B"},
+		{Type: LineDeleted, Location: "text:4", Old: "d"},
+		{Type: LineAdded, Location: "text:4", New: "e"},
+		{Type: LineAdded, Location: "text:5", New: "f"},
+	}
+	if !slices.Equal(r.Changes, want) {
+		t.Errorf("changes %+v, want %+v", r.Changes, want)
+	}
+}
@@ -0,0 +1,371 @@
+package diff
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/deemkeen/diffwatch/internal/state"
+)
+
+// Values shown in place of attributes Terraform hides or doesn't know yet
+const (
+	tfSensitive = "(sensitive)"
+	tfUnknown   = "(known after apply)"
+)
+
+// tfResource is a resource instance of a Terraform state or plan, with its
+// attributes flattened to paths like "tags.Name" or "ingress[0].port"
+type tfResource struct {
+	address string // e.g. module.vpc.aws_subnet.private["a"]
+	fields  []field
+}
+
+// diffTerraformState replaces the line diff of a Terraform state by the
+// resources that were created or destroyed and the attributes that changed
+// in the others, located as "aws_instance.web[0] tags.Name". Outputs are
+// compared too, the serial bumped on every write isn't. Sensitive values
+// are masked. States that don't parse keep their line diff.
+func diffTerraformState(r *Result) {
+	oldResources, err := tfStateResources(r.OldState)
+	if err != nil {
+		return
+	}
+	newResources, err := tfStateResources(r.NewState)
+	if err != nil {
+		return
+	}
+
+	r.Structure = "Terraform state"
+	compareTFResources(r, oldResources, newResources)
+}
+
+// diffTerraformPlan replaces the line diff of a JSON file that is a
+// Terraform plan, as written by "terraform show -json", by the changes the
+// plan makes: the resources it creates and destroys and the attributes it
+// updates, before and after. Other JSON files keep their line diff, and so
+// do deleted plans.
+func diffTerraformPlan(r *Result) {
+	if r.NewState == nil || !r.NewState.Exists {
+		return
+	}
+	var plan struct {
+		FormatVersion   string `json:"format_version"`
+		ResourceChanges []struct {
+			Address string `json:"address"`
+			Change  struct {
+				Actions         []string `json:"actions"`
+				Before          any      `json:"before"`
+				After           any      `json:"after"`
+				AfterUnknown    any      `json:"after_unknown"`
+				BeforeSensitive any      `json:"before_sensitive"`
+				AfterSensitive  any      `json:"after_sensitive"`
+			} `json:"change"`
+		} `json:"resource_changes"`
+	}
+	if err := json.Unmarshal(r.NewState.Content, &plan); err != nil || plan.FormatVersion == "" || plan.ResourceChanges == nil {
+		return
+	}
+
+	r.Structure = "Terraform plan"
+	for _, rc := range plan.ResourceChanges {
+		c := rc.Change
+		before := tfFields(c.Before, tfPaths(c.BeforeSensitive), nil)
+		after := tfFields(c.After, tfPaths(c.AfterSensitive), tfPaths(c.AfterUnknown))
+
+		switch strings.Join(c.Actions, ",") {
+		case "create":
+			r.added(rc.Address, tfSummary(after))
+		case "delete":
+			r.deleted(rc.Address, tfSummary(before))
+		case "update":
+			compareTFResources(r, []tfResource{{address: rc.Address, fields: before}}, []tfResource{{address: rc.Address, fields: after}})
+		case "delete,create", "create,delete":
+			// Replaced: the attributes that differ forced it
+			r.deleted(rc.Address, tfSummary(before))
+			r.added(rc.Address, tfSummary(after))
+			compareTFResources(r, []tfResource{{address: rc.Address, fields: before}}, []tfResource{{address: rc.Address, fields: after}})
+		}
+	}
+}
+
+// compareTFResources records the resources that were destroyed, the
+// attributes that changed in the resources on both sides, and the
+// resources that were created
+func compareTFResources(r *Result, a, b []tfResource) {
+	newByAddress := make(map[string]tfResource, len(b))
+	for _, res := range b {
+		newByAddress[res.address] = res
+	}
+	oldByAddress := make(map[string]tfResource, len(a))
+	for _, res := range a {
+		oldByAddress[res.address] = res
+		n, ok := newByAddress[res.address]
+		if !ok {
+			r.deleted(res.address, tfSummary(res.fields))
+			continue
+		}
+		r.compareFields(tfPrefixed(res), tfPrefixed(n))
+	}
+	for _, res := range b {
+		if _, ok := oldByAddress[res.address]; !ok {
+			r.added(res.address, tfSummary(res.fields))
+		}
+	}
+}
+
+// tfPrefixed locates the attributes of a resource by its address. The
+// value of an output has no path.
+func tfPrefixed(res tfResource) []field {
+	fields := make([]field, len(res.fields))
+	for i, f := range res.fields {
+		fields[i] = field{location: strings.TrimSpace(res.address + " " + f.location), value: f.value}
+	}
+	return fields
+}
+
+// tfSummary describes a resource by its id, or by its number of attributes
+// if it has none yet, and an output by its value
+func tfSummary(fields []field) string {
+	if len(fields) == 1 && fields[0].location == "" {
+		return fields[0].value
+	}
+	for _, f := range fields {
+		if f.location == "id" && f.value != "null" && f.value != tfUnknown {
+			return "id " + strings.Trim(f.value, `"`)
+		}
+	}
+	if len(fields) == 1 {
+		return "1 attribute"
+	}
+	return fmt.Sprintf("%d attributes", len(fields))
+}
+
+// tfStateResources parses the resource instances and outputs of a state,
+// format version 4. A missing file has none.
+func tfStateResources(s *state.FileState) ([]tfResource, error) {
+	if s == nil || !s.Exists {
+		return nil, nil
+	}
+	var st struct {
+		Version int `json:"version"`
+		Outputs map[string]struct {
+			Value     any  `json:"value"`
+			Sensitive bool `json:"sensitive"`
+		} `json:"outputs"`
+		Resources []struct {
+			Module    string `json:"module"`
+			Mode      string `json:"mode"`
+			Type      string `json:"type"`
+			Name      string `json:"name"`
+			Instances []struct {
+				IndexKey            any               `json:"index_key"`
+				Attributes          any               `json:"attributes"`
+				SensitiveAttributes []json.RawMessage `json:"sensitive_attributes"`
+			} `json:"instances"`
+		} `json:"resources"`
+	}
+	if err := json.Unmarshal(s.Content, &st); err != nil {
+		return nil, err
+	}
+	if st.Version != 4 {
+		return nil, fmt.Errorf("unsupported state version %d", st.Version)
+	}
+
+	var resources []tfResource
+	for _, res := range st.Resources {
+		address := res.Type + "." + res.Name
+		if res.Mode == "data" {
+			address = "data." + address
+		}
+		if res.Module != "" {
+			address = res.Module + "." + address
+		}
+		for _, inst := range res.Instances {
+			sensitive := make(map[string]bool)
+			for _, raw := range inst.SensitiveAttributes {
+				if path, err := tfStepPath(raw); err == nil {
+					sensitive[path] = true
+				}
+			}
+			resources = append(resources, tfResource{
+				address: address + tfIndex(inst.IndexKey),
+				fields:  tfFields(inst.Attributes, sensitive, nil),
+			})
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(st.Outputs)) {
+		out := st.Outputs[name]
+		value := tfValue(out.Value)
+		if out.Sensitive {
+			value = tfSensitive
+		}
+		resources = append(resources, tfResource{address: "output." + name, fields: []field{{value: value}}})
+	}
+	return resources, nil
+}
+
+// tfIndex formats the index key of a resource instance: [0] for count,
+// ["a"] for for_each
+func tfIndex(key any) string {
+	switch k := key.(type) {
+	case float64:
+		return fmt.Sprintf("[%d]", int(k))
+	case string:
+		return "[" + strconv.Quote(k) + "]"
+	}
+	return ""
+}
+
+// tfStepPath converts a sensitive attribute path of a state, a list of
+// steps like {"type": "get_attr", "value": "password"}, to a flattened path
+func tfStepPath(raw json.RawMessage) (string, error) {
+	var steps []struct {
+		Type  string          `json:"type"`
+		Value json.RawMessage `json:"value"`
+	}
+	if err := json.Unmarshal(raw, &steps); err != nil {
+		return "", err
+	}
+	var path strings.Builder
+	for _, step := range steps {
+		var name string
+		if step.Type == "get_attr" && json.Unmarshal(step.Value, &name) == nil {
+			tfAppendKey(&path, name)
+			continue
+		}
+		var index struct {
+			Value any `json:"value"`
+		}
+		if step.Type != "index" || json.Unmarshal(step.Value, &index) != nil {
+			return "", errors.New("unknown step " + step.Type)
+		}
+		switch v := index.Value.(type) {
+		case float64:
+			fmt.Fprintf(&path, "[%d]", int(v))
+		case string:
+			tfAppendKey(&path, v)
+		}
+	}
+	return path.String(), nil
+}
+
+// tfPaths returns the paths marked true in a structure shadowing
+// attributes, like the after_unknown or after_sensitive of a plan
+func tfPaths(marks any) map[string]bool {
+	paths := make(map[string]bool)
+	var walk func(path string, v any)
+	walk = func(path string, v any) {
+		switch m := v.(type) {
+		case bool:
+			if m {
+				paths[path] = true
+			}
+		case map[string]any:
+			for key, child := range m {
+				walk(tfJoin(path, key), child)
+			}
+		case []any:
+			for i, child := range m {
+				walk(fmt.Sprintf("%s[%d]", path, i), child)
+			}
+		}
+	}
+	walk("", marks)
+	return paths
+}
+
+// tfFields flattens the attributes of a resource into fields sorted by
+// path, masking the values below sensitive paths. Unknown paths, which a
+// plan doesn't have values for yet, are shown as such.
+func tfFields(attributes any, sensitive, unknown map[string]bool) []field {
+	var fields []field
+	masked := func(path string) bool {
+		for p := range sensitive {
+			if path == p || strings.HasPrefix(path, p+".") || strings.HasPrefix(path, p+"[") {
+				return true
+			}
+		}
+		return false
+	}
+
+	seen := make(map[string]bool)
+	add := func(path, value string) {
+		fields = append(fields, field{location: path, value: value})
+		seen[path] = true
+	}
+
+	var walk func(path string, v any)
+	walk = func(path string, v any) {
+		switch {
+		case path == "":
+		case masked(path):
+			add(path, tfSensitive)
+			return
+		case unknown[path]:
+			add(path, tfUnknown)
+			return
+		}
+		switch val := v.(type) {
+		case map[string]any:
+			if len(val) == 0 && path != "" {
+				add(path, "{}")
+			}
+			for key, child := range val {
+				walk(tfJoin(path, key), child)
+			}
+		case []any:
+			if len(val) == 0 && path != "" {
+				add(path, "[]")
+			}
+			for i, child := range val {
+				walk(fmt.Sprintf("%s[%d]", path, i), child)
+			}
+		default:
+			if path != "" {
+				add(path, tfValue(val))
+			}
+		}
+	}
+	walk("", attributes)
+
+	// Unknown values within lists and maps that don't have them yet
+	for path := range unknown {
+		if path != "" && !seen[path] && !masked(path) {
+			add(path, tfUnknown)
+		}
+	}
+
+	slices.SortFunc(fields, func(a, b field) int { return strings.Compare(a.location, b.location) })
+	return fields
+}
+
+// tfValue formats an attribute value as JSON, so strings read quoted
+func tfValue(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+// tfJoin appends an attribute or map key to a path
+func tfJoin(path, key string) string {
+	var b strings.Builder
+	b.WriteString(path)
+	tfAppendKey(&b, key)
+	return b.String()
+}
+
+// tfAppendKey appends an attribute or map key to a path being built
+func tfAppendKey(b *strings.Builder, key string) {
+	if b.Len() > 0 {
+		b.WriteByte('.')
+	}
+	b.WriteString(key)
+}
@@ -0,0 +1,114 @@
+package diff
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// tfState returns a state of version 4 written serial times, with the
+// resources, given as JSON
+func tfState(serial int, resources ...string) string {
+	return fmt.Sprintf(`{"version": 4, "serial": %d, "outputs": {}, "resources": [%s]}`, serial, strings.Join(resources, ", "))
+}
+
+func TestDiffTerraformState(t *testing.T) {
+	const (
+		web      = `{"mode": "managed", "type": "aws_instance", "name": "web", "instances": [{"index_key": 0, "attributes": {"id": "i-1", "instance_type": "t3.micro", "tags": {"Env": "staging"}}}]}`
+		webSmall = `{"mode": "managed", "type": "aws_instance", "name": "web", "instances": [{"index_key": 0, "attributes": {"id": "i-1", "instance_type": "t3.small", "tags": {"Env": "staging"}}}]}`
+		subnets  = `{"module": "module.vpc", "mode": "managed", "type": "aws_subnet", "name": "private", "instances": [{"index_key": "a", "attributes": {"id": "subnet-a"}}, {"index_key": "b", "attributes": {"id": "subnet-b"}}]}`
+		ami      = `{"mode": "data", "type": "aws_ami", "name": "ubuntu", "instances": [{"attributes": {"id": "ami-1"}}]}`
+		db       = `{"mode": "managed", "type": "aws_db_instance", "name": "main", "instances": [{"attributes": {"id": "db-main", "password": "hunter2"}, "sensitive_attributes": [[{"type": "get_attr", "value": "password"}]]}]}`
+		dbNew    = `{"mode": "managed", "type": "aws_db_instance", "name": "main", "instances": [{"attributes": {"id": "db-main", "password": "hunter3"}, "sensitive_attributes": [[{"type": "get_attr", "value": "password"}]]}]}`
+	)
+
+	tests := []struct {
+		name     string
+		old, new string
+		want     []Change
+	}{
+		{
+			// Instances of for_each resources in modules are addressed like
+			// Terraform does
+			name: "resources added",
+			old:  tfState(1, web),
+			new:  tfState(2, web, subnets),
+			want: []Change{
+				{Type: LineAdded, Location: `module.vpc.aws_subnet.private["a"]`, New: "id subnet-a"},
+				{Type: LineAdded, Location: `module.vpc.aws_subnet.private["b"]`, New: "id subnet-b"},
+			},
+		},
+		{
+			name: "resource removed",
+			old:  tfState(1, ami, web),
+			new:  tfState(2, web),
+			want: []Change{
+				{Type: LineDeleted, Location: "data.aws_ami.ubuntu", Old: "id ami-1"},
+			},
+		},
+		{
+			name: "attribute changed",
+			old:  tfState(1, web),
+			new:  tfState(2, webSmall),
+			want: []Change{
+				{Type: LineModified, Location: "aws_instance.web[0] instance_type", Old: `"t3.micro"`, New: `"t3.small"`},
+			},
+		},
+		// Every write bumps the serial
+		{name: "serial", old: tfState(1, web), new: tfState(2, web)},
+		// Sensitive values compare masked
+		{name: "sensitive attribute changed", old: tfState(1, db), new: tfState(2, dbNew)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := compute(t, "terraform.tfstate", tt.old, tt.new)
+			if result.Structure != "Terraform state" {
+				t.Fatalf("structure %q, want Terraform state", result.Structure)
+			}
+			if !slices.Equal(result.Changes, tt.want) {
+				t.Errorf("changes %+v, want %+v", result.Changes, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffTerraformPlan(t *testing.T) {
+	// Only the new plan counts: it's what applying would do
+	old := `{"format_version": "1.2", "resource_changes": []}`
+	plan := `{"format_version": "1.2", "resource_changes": [
+		{"address": "aws_instance.web[0]", "change": {"actions": ["update"],
+			"before": {"id": "i-1", "instance_type": "t3.micro"},
+			"after": {"id": "i-1", "instance_type": "t3.small"}, "after_unknown": {}}},
+		{"address": "aws_s3_bucket.assets", "change": {"actions": ["create"],
+			"before": null, "after": {"bucket": "acme-assets"}, "after_unknown": {"arn": true, "id": true}}},
+		{"address": "aws_eip.old", "change": {"actions": ["delete"],
+			"before": {"id": "eipalloc-1"}, "after": null}},
+		{"address": "aws_instance.db", "change": {"actions": ["delete", "create"],
+			"before": {"id": "i-2", "ami": "ami-1"}, "after": {"ami": "ami-2"}, "after_unknown": {"id": true}}}
+	]}`
+
+	result := compute(t, "plan.json", old, plan)
+	if result.Structure != "Terraform plan" {
+		t.Fatalf("structure %q, want Terraform plan", result.Structure)
+	}
+	want := []Change{
+		{Type: LineModified, Location: "aws_instance.web[0] instance_type", Old: `"t3.micro"`, New: `"t3.small"`},
+		{Type: LineAdded, Location: "aws_s3_bucket.assets", New: "3 attributes"},
+		{Type: LineDeleted, Location: "aws_eip.old", Old: "id eipalloc-1"},
+		// Replaced, with the attributes that forced it
+		{Type: LineDeleted, Location: "aws_instance.db", Old: "id i-2"},
+		{Type: LineAdded, Location: "aws_instance.db", New: "2 attributes"},
+		{Type: LineModified, Location: "aws_instance.db ami", Old: `"ami-1"`, New: `"ami-2"`},
+		{Type: LineModified, Location: "aws_instance.db id", Old: `"i-2"`, New: "(known after apply)"},
+	}
+	if !slices.Equal(result.Changes, want) {
+		t.Errorf("changes %+v, want %+v", result.Changes, want)
+	}
+
+	// Other JSON files keep their line diff
+	result = compute(t, "package.json", `{"version": "1.0.0"}`, `{"version": "1.1.0"}`)
+	if result.Structure != "" || result.Changes != nil {
+		t.Errorf("structure %q with changes %+v, want none", result.Structure, result.Changes)
+	}
+}
@@ -0,0 +1,266 @@
+package diff
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"slices"
+	"strings"
+)
+
+// xmlNode is an element of a parsed XML document. Comments, processing
+// instructions and whitespace between elements are left out, so a
+// reformatted document parses to the same tree.
+type xmlNode struct {
+	name     string
+	attrs    []xml.Attr // Sorted by name
+	text     string     // Character data directly inside, whitespace collapsed
+	children []*xmlNode
+	sig      string // Identifies the element with all its content
+}
+
+// diffXML replaces the line diff of an XML document by the elements,
+// attributes and texts that changed, located by XPath-like paths such as
+// /project/dependencies/dependency[2]/@scope. Documents that don't parse
+// keep their line diff.
+func diffXML(r *Result) {
+	if !r.bothVersions() {
+		return
+	}
+	oldRoot, err := parseXML(r.OldState.Content)
+	if err != nil {
+		return
+	}
+	newRoot, err := parseXML(r.NewState.Content)
+	if err != nil {
+		return
+	}
+
+	r.Structure = "XML"
+	if oldRoot.name != newRoot.name {
+		r.modified("/", oldRoot.summary(), newRoot.summary())
+		return
+	}
+	compareXML(r, "/"+newRoot.name, oldRoot, newRoot)
+}
+
+// parseXML parses a document into its root element
+func parseXML(content []byte) (*xmlNode, error) {
+	d := xml.NewDecoder(bytes.NewReader(content))
+	d.Entity = xml.HTMLEntity
+	// Documents in other encodings compare fine as bytes
+	d.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) { return input, nil }
+
+	var root *xmlNode
+	var stack []*xmlNode
+	for {
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &xmlNode{name: xmlName(t.Name), attrs: slices.Clone(t.Attr)}
+			slices.SortFunc(n.attrs, func(a, b xml.Attr) int { return strings.Compare(xmlName(a.Name), xmlName(b.Name)) })
+			switch {
+			case len(stack) > 0:
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, n)
+			case root != nil:
+				return nil, errors.New("more than one root element")
+			default:
+				root = n
+			}
+			stack = append(stack, n)
+
+		case xml.EndElement:
+			// Raw tokens aren't checked for nesting
+			if len(stack) == 0 || stack[len(stack)-1].name != xmlName(t.Name) {
+				return nil, fmt.Errorf("unexpected end element </%s>", xmlName(t.Name))
+			}
+			n := stack[len(stack)-1]
+			n.text = strings.Join(strings.Fields(n.text), " ")
+			n.sig = n.signature()
+			stack = stack[:len(stack)-1]
+
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text += string(t)
+			}
+		}
+	}
+
+	if root == nil || len(stack) > 0 {
+		return nil, errors.New("incomplete document")
+	}
+	return root, nil
+}
+
+// xmlName returns a name with its namespace prefix, if any
+func xmlName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}
+
+// signature hashes the element with its attributes, text and children
+func (n *xmlNode) signature() string {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s\x00%s\x00", n.name, n.text)
+	for _, a := range n.attrs {
+		fmt.Fprintf(h, "%s=%s\x00", xmlName(a.Name), a.Value)
+	}
+	for _, c := range n.children {
+		fmt.Fprintf(h, "%s\x00", c.sig)
+	}
+	return fmt.Sprintf("%x", h.Sum64())
+}
+
+// maxXMLValue is the most runes an element is shown with
+const maxXMLValue = 120
+
+// summary describes an element in one line, cut to maxXMLValue runes
+func (n *xmlNode) summary() string {
+	var b strings.Builder
+	n.write(&b)
+	if runes := []rune(b.String()); len(runes) > maxXMLValue {
+		return string(runes[:maxXMLValue]) + "…"
+	}
+	return b.String()
+}
+
+// write writes the element compactly, without whitespace between elements
+func (n *xmlNode) write(b *strings.Builder) {
+	b.WriteString("<" + n.name)
+	for _, a := range n.attrs {
+		fmt.Fprintf(b, " %s=%q", xmlName(a.Name), a.Value)
+	}
+	if n.text == "" && len(n.children) == 0 {
+		b.WriteString("/>")
+		return
+	}
+
+	b.WriteString(">" + n.text)
+	for _, c := range n.children {
+		// Long documents are cut anyway
+		if b.Len() > 4*maxXMLValue {
+			break
+		}
+		c.write(b)
+	}
+	b.WriteString("</" + n.name + ">")
+}
+
+// compareXML records the changes between two versions of the element at
+// location
+func compareXML(r *Result, location string, a, b *xmlNode) {
+	if a.sig == b.sig {
+		return
+	}
+
+	i, j := 0, 0
+	for i < len(a.attrs) || j < len(b.attrs) {
+		switch {
+		case j == len(b.attrs) || i < len(a.attrs) && xmlName(a.attrs[i].Name) < xmlName(b.attrs[j].Name):
+			r.deleted(location+"/@"+xmlName(a.attrs[i].Name), a.attrs[i].Value)
+			i++
+		case i == len(a.attrs) || xmlName(b.attrs[j].Name) < xmlName(a.attrs[i].Name):
+			r.added(location+"/@"+xmlName(b.attrs[j].Name), b.attrs[j].Value)
+			j++
+		default:
+			if a.attrs[i].Value != b.attrs[j].Value {
+				r.modified(location+"/@"+xmlName(a.attrs[i].Name), a.attrs[i].Value, b.attrs[j].Value)
+			}
+			i++
+			j++
+		}
+	}
+
+	switch {
+	case a.text == b.text:
+	case a.text == "":
+		r.added(location+"/text()", b.text)
+	case b.text == "":
+		r.deleted(location+"/text()", a.text)
+	default:
+		r.modified(location+"/text()", a.text, b.text)
+	}
+
+	compareXMLChildren(r, location, a.children, b.children)
+}
+
+// compareXMLChildren records the changes between two versions of the
+// children of the element at location. Unchanged children are matched
+// first, so an inserted element doesn't show as changes to all that
+// follow; the remaining ones are paired by name and compared in turn.
+func compareXMLChildren(r *Result, location string, a, b []*xmlNode) {
+	oldLocs, newLocs := childLocations(location, a, b)
+
+	keys := func(nodes []*xmlNode, sig bool) []string {
+		out := make([]string, len(nodes))
+		for k, n := range nodes {
+			out[k] = n.name
+			if sig {
+				out[k] += "\x00" + n.sig
+			}
+		}
+		return out
+	}
+
+	for _, c := range OpCodes(keys(a, true), keys(b, true), Myers) {
+		if c.Tag == 'e' {
+			continue
+		}
+		for _, p := range OpCodes(keys(a[c.I1:c.I2], false), keys(b[c.J1:c.J2], false), Myers) {
+			if p.Tag == 'e' {
+				for k := range p.I2 - p.I1 {
+					i, j := c.I1+p.I1+k, c.J1+p.J1+k
+					compareXML(r, newLocs[j], a[i], b[j])
+				}
+				continue
+			}
+			for i := c.I1 + p.I1; i < c.I1+p.I2; i++ {
+				r.deleted(oldLocs[i], a[i].summary())
+			}
+			for j := c.J1 + p.J1; j < c.J1+p.J2; j++ {
+				r.added(newLocs[j], b[j].summary())
+			}
+		}
+	}
+}
+
+// childLocations returns the locations of the children of the element at
+// location in both versions. Children whose name occurs more than once in
+// either version are numbered among their namesakes, from 1.
+func childLocations(location string, a, b []*xmlNode) (oldLocs, newLocs []string) {
+	count := func(nodes []*xmlNode) map[string]int {
+		counts := make(map[string]int)
+		for _, n := range nodes {
+			counts[n.name]++
+		}
+		return counts
+	}
+	oldCounts, newCounts := count(a), count(b)
+
+	locate := func(nodes []*xmlNode) []string {
+		seen := make(map[string]int)
+		out := make([]string, len(nodes))
+		for k, n := range nodes {
+			seen[n.name]++
+			out[k] = location + "/" + n.name
+			if oldCounts[n.name] > 1 || newCounts[n.name] > 1 {
+				out[k] += fmt.Sprintf("[%d]", seen[n.name])
+			}
+		}
+		return out
+	}
+	return locate(a), locate(b)
+}
@@ -0,0 +1,112 @@
+package diff
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDiffXML(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		want     []Change
+	}{
+		{
+			name: "text",
+			old:  `<project><version>1.4.0</version></project>`,
+			new:  `<project><version>1.5.0</version></project>`,
+			want: []Change{
+				{Type: LineModified, Location: "/project/version/text()", Old: "1.4.0", New: "1.5.0"},
+			},
+		},
+		{
+			name: "attributes",
+			old:  `<a x="1" y="2"/>`,
+			new:  `<a x="1" y="3" z="4"/>`,
+			want: []Change{
+				{Type: LineModified, Location: "/a/@y", Old: "2", New: "3"},
+				{Type: LineAdded, Location: "/a/@z", New: "4"},
+			},
+		},
+		{
+			// Attributes are compared by name, wherever they are
+			name: "attribute order",
+			old:  `<a x="1" y="2"/>`,
+			new:  `<a y="2" x="1"/>`,
+		},
+		{
+			// A reordered list shows as one element moving, not as every
+			// element changing
+			name: "reordered elements",
+			old:  `<list><item>a</item><item>b</item><item>c</item></list>`,
+			new:  `<list><item>c</item><item>a</item><item>b</item></list>`,
+			want: []Change{
+				{Type: LineAdded, Location: "/list/item[1]", New: "<item>c</item>"},
+				{Type: LineDeleted, Location: "/list/item[3]", Old: "<item>c</item>"},
+			},
+		},
+		{
+			name: "inserted element",
+			old:  `<list><item>a</item><item>b</item></list>`,
+			new:  `<list><item>a</item><item>new</item><item>b</item></list>`,
+			want: []Change{
+				{Type: LineAdded, Location: "/list/item[2]", New: "<item>new</item>"},
+			},
+		},
+		{
+			// Elements and attributes are named with their prefixes, which
+			// the namespace declarations map to URIs
+			name: "namespaces",
+			old:  `<r xmlns:m="urn:m:1"><m:v>1</m:v></r>`,
+			new:  `<r xmlns:m="urn:m:2"><m:v>2</m:v></r>`,
+			want: []Change{
+				{Type: LineModified, Location: "/r/@xmlns:m", Old: "urn:m:1", New: "urn:m:2"},
+				{Type: LineModified, Location: "/r/m:v/text()", Old: "1", New: "2"},
+			},
+		},
+		{
+			name: "prefix",
+			old:  `<r><a:v/></r>`,
+			new:  `<r><b:v/></r>`,
+			want: []Change{
+				{Type: LineDeleted, Location: "/r/a:v", Old: "<a:v/>"},
+				{Type: LineAdded, Location: "/r/b:v", New: "<b:v/>"},
+			},
+		},
+		{
+			name: "root renamed",
+			old:  `<a/>`,
+			new:  `<b/>`,
+			want: []Change{
+				{Type: LineModified, Location: "/", Old: "<a/>", New: "<b/>"},
+			},
+		},
+		{
+			name: "reformatted",
+			old:  `<a><b>1</b></a>`,
+			new:  "<a>\n  <!-- the only b -->\n  <b>1</b>\n</a>\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := compute(t, "doc.xml", tt.old, tt.new)
+			if result.Structure != "XML" {
+				t.Fatalf("structure %q, want XML", result.Structure)
+			}
+			if !slices.Equal(result.Changes, tt.want) {
+				t.Errorf("changes %+v, want %+v", result.Changes, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffXMLMalformed(t *testing.T) {
+	// Halfway through an edit: the line diff stays
+	result := compute(t, "pom.xml", "<project>\n<version>1.4.0</version>\n</project>\n", "<project>\n<version>1.5.0</version\n</project>\n")
+	if result.Structure != "" || result.Changes != nil {
+		t.Errorf("structure %q with changes %+v, want none", result.Structure, result.Changes)
+	}
+	if added, deleted := result.Stats(); added != 1 || deleted != 1 {
+		t.Errorf("stats %d %d, want 1 1", added, deleted)
+	}
+}
@@ -0,0 +1,73 @@
+package dirs
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// name is the directory of diffwatch's files in the base directories
+const name = "diffwatch"
+
+// Cache returns the directory for files that can be recreated, like
+// snapshots: $XDG_CACHE_HOME/diffwatch, by default ~/.cache/diffwatch
+// (~/Library/Caches on macOS, %LocalAppData% on Windows)
+func Cache() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, name)
+}
+
+// State returns the directory for files worth keeping between sessions,
+// like logs, change databases and saved patches: $XDG_STATE_HOME/diffwatch,
+// by default ~/.local/state/diffwatch (~/Library/Application Support on
+// macOS, %LocalAppData% on Windows)
+func State() string {
+	if dir := os.Getenv("XDG_STATE_HOME"); filepath.IsAbs(dir) {
+		return filepath.Join(dir, name)
+	}
+
+	switch runtime.GOOS {
+	case "windows":
+		return Cache()
+	case "darwin":
+		if dir, err := os.UserConfigDir(); err == nil {
+			return filepath.Join(dir, name)
+		}
+	default:
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, ".local", "state", name)
+		}
+	}
+	return filepath.Join(os.TempDir(), name)
+}
+
+// Snapshots returns the directory holding the snapshots of large files,
+// one subdirectory per running instance
+func Snapshots() string {
+	return filepath.Join(Cache(), "snapshots")
+}
+
+// Logs returns the directory of the -verbose and daemon logs
+func Logs() string {
+	return filepath.Join(State(), "logs")
+}
+
+// Databases returns the directory of change databases created without -db
+func Databases() string {
+	return filepath.Join(State(), "db")
+}
+
+// Patches returns the directory where reverted changes to protected paths
+// are saved
+func Patches() string {
+	return filepath.Join(State(), "patches")
+}
+
+// Crashes returns the directory of the reports written when diffwatch
+// crashes
+func Crashes() string {
+	return filepath.Join(State(), "crashes")
+}
@@ -0,0 +1,237 @@
+package doctor
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/deemkeen/diffwatch/internal/watcher"
+)
+
+// scanLimit caps the number of entries counted when estimating the size
+// of the watched tree
+const scanLimit = 1_000_000
+
+// Status is the outcome of a check
+type Status int
+
+const (
+	OK   Status = iota // Nothing to worry about
+	Info               // Couldn't be determined on this platform
+	Warn               // Likely to cause missed events or a failing start
+)
+
+// String returns the label of the status
+func (s Status) String() string {
+	switch s {
+	case OK:
+		return "ok"
+	case Info:
+		return "info"
+	default:
+		return "warn"
+	}
+}
+
+// Check is the result of a single health check
+type Check struct {
+	Name   string
+	Status Status
+	Value  string // What was found
+	Hint   string // How to avoid the problem, for warnings
+}
+
+// Options describes the session to check
+type Options struct {
+	Recursive bool
+	MaxDirs   int // Directory count the header warns about (0: never)
+}
+
+// tree is the estimated size of the watched tree
+type tree struct {
+	dirs, files int
+	complete    bool // Counted without reaching scanLimit
+	took        time.Duration
+}
+
+// Run checks whether watching path is likely to work: the event backend,
+// the size of the tree against the platform's watch and open file limits,
+// and whether path is on a network filesystem
+func Run(path string, opts Options) []Check {
+	backend := watcher.BackendName(opts.Recursive)
+	t := scan(path, opts.Recursive)
+
+	checks := []Check{
+		backendCheck(backend),
+		treeCheck(t, opts),
+	}
+	if backend == "inotify" {
+		checks = append(checks, inotifyCheck(t))
+	}
+	checks = append(checks, openFilesCheck(backend, t), filesystemCheck(path))
+	return checks
+}
+
+// backendCheck describes the event API and what one watch costs
+func backendCheck(backend string) Check {
+	c := Check{Name: "backend", Value: backend}
+	switch backend {
+	case "inotify":
+		c.Value += ": one watch per directory, counted against fs.inotify.max_user_watches"
+	case "kqueue":
+		c.Value += ": one open file descriptor per watched directory and file"
+	case "FSEvents":
+		c.Value += ": a single stream for the whole tree"
+	case "ReadDirectoryChangesW":
+		c.Value += ": one handle per directory"
+	}
+	return c
+}
+
+// treeCheck reports the size of the tree and warns if it exceeds the
+// directory count the header warns about
+func treeCheck(t tree, opts Options) Check {
+	c := Check{Name: "tree", Value: fmt.Sprintf("%d directories, %d files (scanned in %s)",
+		t.dirs, t.files, t.took.Round(time.Millisecond))}
+	if !t.complete {
+		c.Value = fmt.Sprintf("over %d directories and files, stopped counting (scanned in %s)",
+			scanLimit, t.took.Round(time.Millisecond))
+	}
+	if !opts.Recursive {
+		c.Value += ", not recursive"
+	}
+
+	if opts.MaxDirs > 0 && t.dirs > opts.MaxDirs {
+		c.Status = Warn
+		c.Hint = fmt.Sprintf("More than %d directories: setup is slow and the header will warn. "+
+			"Watch a subdirectory or raise -max-dirs.", opts.MaxDirs)
+	}
+	return c
+}
+
+// inotifyCheck compares the directories to watch with the inotify limits
+func inotifyCheck(t tree) Check {
+	c := Check{Name: "inotify"}
+	watches, instances, err := inotifyLimits()
+	if err != nil {
+		c.Status = Info
+		c.Value = fmt.Sprintf("limits unknown: %v", err)
+		return c
+	}
+
+	c.Value = fmt.Sprintf("%d watches needed, max_user_watches %d, max_user_instances %d",
+		t.dirs, watches, instances)
+	switch {
+	case t.dirs >= watches || !t.complete:
+		c.Status = Warn
+		c.Hint = "Not enough watches: starting the watch will fail. " +
+			"Raise the limit, e.g. sudo sysctl fs.inotify.max_user_watches=524288"
+	case t.dirs > watches*8/10:
+		c.Status = Warn
+		c.Hint = "Watches are shared with other programs (editors, IDEs, sync tools), so these may run out. " +
+			"Raise the limit, e.g. sudo sysctl fs.inotify.max_user_watches=524288"
+	}
+	return c
+}
+
+// openFilesCheck reports the open file limit. kqueue needs a descriptor
+// per watched directory and file, so it warns if the tree exceeds it.
+func openFilesCheck(backend string, t tree) Check {
+	c := Check{Name: "open files"}
+	soft, hard, err := openFileLimit()
+	if err != nil {
+		c.Status = Info
+		c.Value = fmt.Sprintf("limit unknown: %v", err)
+		return c
+	}
+
+	c.Value = fmt.Sprintf("limit %d (hard limit %d)", soft, hard)
+	if backend != "kqueue" {
+		return c
+	}
+
+	needed := t.dirs + t.files
+	c.Value = fmt.Sprintf("%d needed, %s", needed, c.Value)
+	if needed >= soft || !t.complete {
+		c.Status = Warn
+		c.Hint = "Not enough file descriptors: watching will fail with \"too many open files\". " +
+			"Raise the limit (ulimit -n) or watch a smaller tree."
+	}
+	return c
+}
+
+// filesystemCheck warns if path is on a network filesystem, where changes
+// made by other machines don't produce events
+func filesystemCheck(path string) Check {
+	c := Check{Name: "filesystem"}
+	name, network, err := filesystem(path)
+	if err != nil {
+		c.Status = Info
+		c.Value = fmt.Sprintf("unknown: %v", err)
+		return c
+	}
+
+	c.Value = name + ", local"
+	if network {
+		c.Value = name + ", network"
+		c.Status = Warn
+		c.Hint = "Changes made on other machines (or the host of a VM share) don't produce events, " +
+			"only changes made through this mount are seen. Watch with -backend poll to see them all."
+	}
+	return c
+}
+
+// scan counts the directories and files that a watch of path covers
+func scan(path string, recursive bool) (t tree) {
+	start := time.Now()
+	t.complete = true
+	defer func() { t.took = time.Since(start) }()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return t
+	}
+	if !info.IsDir() {
+		t.files = 1
+		return t
+	}
+
+	if !recursive {
+		t.dirs = 1
+		entries, _ := os.ReadDir(path)
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				t.files++
+			}
+		}
+		return t
+	}
+
+	errLimit := errors.New("scan limit reached")
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if t.dirs+t.files >= scanLimit {
+			return errLimit
+		}
+
+		if d.IsDir() {
+			if p != path && watcher.SkipsDir(d.Name()) {
+				return filepath.SkipDir
+			}
+			t.dirs++
+		} else {
+			t.files++
+		}
+		return nil
+	})
+	t.complete = err == nil
+	return t
+}
@@ -0,0 +1,34 @@
+package doctor
+
+import (
+	"errors"
+	"slices"
+	"syscall"
+)
+
+// networkFilesystems are the macOS filesystem types backed by a server
+var networkFilesystems = []string{"nfs", "smbfs", "afpfs", "webdav", "ftp", "macfuse", "osxfuse", "fusefs"}
+
+// filesystem returns the type of the filesystem path is on and whether
+// it is (or may be) a network filesystem
+func filesystem(path string) (name string, network bool, err error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return "", false, err
+	}
+
+	b := make([]byte, 0, len(st.Fstypename))
+	for _, c := range st.Fstypename {
+		if c == 0 {
+			break
+		}
+		b = append(b, byte(c))
+	}
+	name = string(b)
+	return name, slices.Contains(networkFilesystems, name), nil
+}
+
+// inotifyLimits is Linux only
+func inotifyLimits() (watches, instances int, err error) {
+	return 0, 0, errors.New("not available on this platform")
+}
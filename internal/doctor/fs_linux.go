@@ -0,0 +1,74 @@
+package doctor
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// fsMagic describes a filesystem by its statfs magic number
+type fsMagic struct {
+	name    string
+	network bool
+}
+
+// filesystems maps statfs magic numbers to filesystems, see statfs(2)
+var filesystems = map[uint32]fsMagic{
+	0xEF53:     {"ext4", false},
+	0x58465342: {"xfs", false},
+	0x9123683E: {"btrfs", false},
+	0x2FC12FC1: {"zfs", false},
+	0x01021994: {"tmpfs", false},
+	0x794C7630: {"overlayfs", false},
+	0x73717368: {"squashfs", false},
+	0x4D44:     {"vfat", false},
+	0x5346544E: {"ntfs", false},
+	0xF2F52010: {"f2fs", false},
+	0x6969:     {"nfs", true},
+	0xFF534D42: {"cifs", true},
+	0xFE534D42: {"smb2", true},
+	0x517B:     {"smb", true},
+	0x01021997: {"9p", true},
+	0x6B414653: {"afs", true},
+	0x00C36400: {"ceph", true},
+	0x47504653: {"gpfs", true},
+	0x0BD00BD0: {"lustre", true},
+	0x65735546: {"fuse (e.g. sshfs)", true},
+	0xBACBACBC: {"virtiofs", true},
+}
+
+// filesystem returns the type of the filesystem path is on and whether
+// it is (or may be) a network filesystem
+func filesystem(path string) (name string, network bool, err error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return "", false, err
+	}
+	magic := uint32(st.Type)
+	if fs, ok := filesystems[magic]; ok {
+		return fs.name, fs.network, nil
+	}
+	return fmt.Sprintf("type 0x%x", magic), false, nil
+}
+
+// inotifyLimits returns the inotify watch and instance limits per user
+func inotifyLimits() (watches, instances int, err error) {
+	if watches, err = readLimit("/proc/sys/fs/inotify/max_user_watches"); err != nil {
+		return 0, 0, err
+	}
+	if instances, err = readLimit("/proc/sys/fs/inotify/max_user_instances"); err != nil {
+		return 0, 0, err
+	}
+	return watches, instances, nil
+}
+
+// readLimit reads a number from a file in /proc
+func readLimit(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
@@ -0,0 +1,15 @@
+//go:build !linux && !darwin && !windows
+
+package doctor
+
+import "errors"
+
+// filesystem is not available on this platform
+func filesystem(path string) (name string, network bool, err error) {
+	return "", false, errors.New("not available on this platform")
+}
+
+// inotifyLimits is Linux only
+func inotifyLimits() (watches, instances int, err error) {
+	return 0, 0, errors.New("not available on this platform")
+}
@@ -0,0 +1,58 @@
+package doctor
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// Drive types, see GetDriveTypeW
+const (
+	driveRemovable = 2
+	driveFixed     = 3
+	driveRemote    = 4
+	driveCDROM     = 5
+	driveRAMDisk   = 6
+)
+
+var procGetDriveType = syscall.NewLazyDLL("kernel32.dll").NewProc("GetDriveTypeW")
+
+// filesystem returns the type of the drive path is on and whether it is
+// a network drive
+func filesystem(path string) (name string, network bool, err error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", false, err
+	}
+	volume := filepath.VolumeName(abs)
+	if strings.HasPrefix(volume, `\\`) {
+		return "network share", true, nil
+	}
+
+	root, err := syscall.UTF16PtrFromString(volume + `\`)
+	if err != nil {
+		return "", false, err
+	}
+	r, _, _ := procGetDriveType.Call(uintptr(unsafe.Pointer(root)))
+	switch r {
+	case driveRemovable:
+		return "removable drive", false, nil
+	case driveFixed:
+		return "fixed drive", false, nil
+	case driveRemote:
+		return "network drive", true, nil
+	case driveCDROM:
+		return "CD-ROM drive", false, nil
+	case driveRAMDisk:
+		return "RAM disk", false, nil
+	default:
+		return "", false, errors.New("unknown drive type")
+	}
+}
+
+// inotifyLimits is Linux only
+func inotifyLimits() (watches, instances int, err error) {
+	return 0, 0, errors.New("not available on this platform")
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package doctor
+
+import "errors"
+
+// openFileLimit is not available on this platform
+func openFileLimit() (soft, hard int, err error) {
+	return 0, 0, errors.New("not available on this platform")
+}
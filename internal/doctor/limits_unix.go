@@ -0,0 +1,26 @@
+//go:build unix
+
+package doctor
+
+import "syscall"
+
+// openFileLimit returns the soft and hard limit of open file descriptors
+func openFileLimit() (soft, hard int, err error) {
+	var lim syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &lim); err != nil {
+		return 0, 0, err
+	}
+	return clampLimit(lim.Cur), clampLimit(lim.Max), nil
+}
+
+// clampLimit converts an rlimit (signed on some platforms) to int, mapping
+// "unlimited" to the largest int
+func clampLimit[T int64 | uint64](v T) int {
+	if uint64(v) > uint64(maxInt) {
+		return maxInt
+	}
+	return int(v)
+}
+
+// maxInt is the largest int
+const maxInt = int(^uint(0) >> 1)
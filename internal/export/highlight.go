@@ -0,0 +1,41 @@
+package export
+
+import (
+	"html"
+	"html/template"
+	"strings"
+
+	"github.com/deemkeen/diffwatch/internal/lang"
+)
+
+// Token classes, used as CSS class names
+const (
+	classComment = "c"
+	classString  = "s"
+	classNumber  = "n"
+	classKeyword = "k"
+)
+
+// classes maps token classes to CSS class names
+var classes = map[lang.Class]string{
+	lang.Comment: classComment,
+	lang.String:  classString,
+	lang.Number:  classNumber,
+	lang.Keyword: classKeyword,
+}
+
+// highlight returns a line of source as HTML with its tokens wrapped in
+// spans of their class. Lines of unknown languages are only escaped.
+func highlight(line string, l *lang.Language) template.HTML {
+	var b strings.Builder
+	last := 0
+	for _, t := range l.Tokens(line) {
+		b.WriteString(html.EscapeString(line[last:t.Start]))
+		b.WriteString(`<span class="` + classes[t.Class] + `">`)
+		b.WriteString(html.EscapeString(line[t.Start:t.End]))
+		b.WriteString(`</span>`)
+		last = t.End
+	}
+	b.WriteString(html.EscapeString(line[last:]))
+	return template.HTML(b.String())
+}
@@ -0,0 +1,226 @@
+package export
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/deemkeen/diffwatch/internal/diff"
+	"github.com/deemkeen/diffwatch/internal/lang"
+	"github.com/deemkeen/diffwatch/internal/store"
+)
+
+// valueMask replaces the values of .env files in reports, as in the diff
+// pane
+const valueMask = "••••••"
+
+// Options describes the exported session
+type Options struct {
+	Title string    // Report title (default: "diffwatch session")
+	Since time.Time // Start of the exported window (zero: first record)
+	Until time.Time // End of the exported window (zero: last record)
+
+	RevealValues bool // Show the values of .env files instead of masking them
+}
+
+// report is the data rendered by reportTemplate
+type report struct {
+	Title     string
+	Generated string
+	Since     string
+	Until     string
+	Changes   int
+	Timeline  []change
+	Files     []file
+}
+
+// file is the section of a single file in the report
+type file struct {
+	ID      string
+	Path    string
+	Added   int
+	Deleted int
+	Changes []change
+}
+
+// change is a single recorded event
+type change struct {
+	FileID  string
+	Time    string
+	Path    string
+	Op      string
+	Level   string
+	Added   int
+	Deleted int
+	Binary  bool
+	Note    string // Note attached while watching, if any
+	Lines   []line // Diff lines, empty if no diff was recorded
+}
+
+// line is a single line of a unified diff
+type line struct {
+	Class string // CSS class: hdr, hunk, add, del, ctx or note
+	HTML  template.HTML
+}
+
+// HTML writes a self-contained HTML report of the records, oldest first:
+// a timeline of all changes followed by the diffs of each file
+func HTML(w io.Writer, records []store.Record, opts Options) error {
+	r := report{
+		Title:     opts.Title,
+		Generated: time.Now().Format("2006-01-02 15:04:05"),
+		Changes:   len(records),
+	}
+	if r.Title == "" {
+		r.Title = "diffwatch session"
+	}
+
+	since, until := opts.Since, opts.Until
+	if len(records) > 0 {
+		if since.IsZero() {
+			since = records[0].Time
+		}
+		if until.IsZero() {
+			until = records[len(records)-1].Time
+		}
+	}
+	if !since.IsZero() {
+		r.Since = since.Format("2006-01-02 15:04:05")
+	}
+	if !until.IsZero() {
+		r.Until = until.Format("2006-01-02 15:04:05")
+	}
+
+	// Files in order of their first change
+	byPath := make(map[string]*file)
+	var files []*file
+	for _, rec := range records {
+		f := byPath[rec.Path]
+		if f == nil {
+			f = &file{ID: fmt.Sprintf("file-%d", len(files)+1), Path: rec.Path}
+			byPath[rec.Path] = f
+			files = append(files, f)
+		}
+
+		c := change{
+			FileID:  f.ID,
+			Time:    rec.Time.Format("2006-01-02 15:04:05"),
+			Path:    rec.Path,
+			Op:      rec.Op,
+			Level:   rec.Level,
+			Added:   rec.Added,
+			Deleted: rec.Deleted,
+			Binary:  rec.Binary,
+			Note:    rec.Note,
+		}
+		r.Timeline = append(r.Timeline, c)
+
+		c.Lines = diffLines(rec.Patch, lang.Detect(rec.Path, nil), opts.RevealValues)
+		f.Changes = append(f.Changes, c)
+		f.Added += rec.Added
+		f.Deleted += rec.Deleted
+	}
+	for _, f := range files {
+		r.Files = append(r.Files, *f)
+	}
+
+	if err := reportTemplate.Execute(w, r); err != nil {
+		return fmt.Errorf("rendering report: %w", err)
+	}
+	return nil
+}
+
+// diffLines classifies the lines of a unified diff, highlighting the
+// source of added, deleted and context lines. The values of .env files are
+// masked unless reveal is set.
+func diffLines(patch string, l *lang.Language, reveal bool) []line {
+	if patch == "" {
+		return nil
+	}
+	if l == lang.Dotenv && !reveal {
+		patch = diff.MaskEnvPatch(patch, valueMask)
+	}
+	inHunk := false
+
+	var lines []line
+	for _, text := range strings.Split(strings.TrimSuffix(patch, "\n"), "\n") {
+		if strings.HasPrefix(text, "@@") {
+			inHunk = true
+		}
+
+		switch {
+		case !inHunk && !strings.HasPrefix(text, "Binary files "):
+			// git's extended headers and the ---/+++ lines
+			lines = append(lines, line{Class: "hdr", HTML: highlight(text, nil)})
+		case strings.HasPrefix(text, "@@"):
+			lines = append(lines, line{Class: "hunk", HTML: highlight(text, nil)})
+		case strings.HasPrefix(text, "+"):
+			lines = append(lines, line{Class: "add", HTML: "+" + highlight(text[1:], l)})
+		case strings.HasPrefix(text, "-"):
+			lines = append(lines, line{Class: "del", HTML: "-" + highlight(text[1:], l)})
+		case strings.HasPrefix(text, " "):
+			lines = append(lines, line{Class: "ctx", HTML: " " + highlight(text[1:], l)})
+		default:
+			// "\ No newline at end of file" and binary file notes
+			lines = append(lines, line{Class: "note", HTML: highlight(text, nil)})
+		}
+	}
+	return lines
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+:root { --bg: #fff; --fg: #1f2328; --muted: #656d76; --border: #d0d7de; --panel: #f6f8fa;
+  --add: #e6ffec; --del: #ffebe9; --hunk: #ddf4ff; --k: #cf222e; --s: #0a3069; --c: #6e7781; --n: #0550ae;
+  --warn: #9a6700; --critical: #cf222e; }
+@media (prefers-color-scheme: dark) {
+  :root { --bg: #0d1117; --fg: #e6edf3; --muted: #8d96a0; --border: #30363d; --panel: #161b22;
+    --add: #12261e; --del: #25171c; --hunk: #121d2f; --k: #ff7b72; --s: #a5d6ff; --c: #8b949e; --n: #79c0ff;
+    --warn: #d29922; --critical: #f85149; }
+}
+body { background: var(--bg); color: var(--fg); font: 14px/1.5 system-ui, sans-serif; margin: 2em auto; max-width: 1100px; padding: 0 1em; }
+h1 { margin-bottom: 0; }
+h2 { font-family: ui-monospace, monospace; font-size: 1.05em; border-bottom: 1px solid var(--border); padding-bottom: .3em; margin-top: 2.5em; }
+h3 { font-size: .95em; font-weight: normal; color: var(--muted); margin: 1.2em 0 .4em; }
+a { color: inherit; }
+.meta { color: var(--muted); }
+table { border-collapse: collapse; width: 100%; font-size: .9em; }
+th, td { text-align: left; padding: .2em .6em; border-bottom: 1px solid var(--border); }
+td.path { font-family: ui-monospace, monospace; word-break: break-all; }
+.stat-add { color: #1a7f37; } .stat-del { color: #cf222e; }
+.level-warn { color: var(--warn); } .level-critical { color: var(--critical); font-weight: bold; }
+pre { background: var(--panel); border: 1px solid var(--border); border-radius: 6px; margin: 0; overflow-x: auto; font: 12px/1.45 ui-monospace, monospace; }
+pre span.line { display: block; padding: 0 .8em; white-space: pre; }
+.hdr { color: var(--muted); font-weight: bold; } .hunk { background: var(--hunk); color: var(--muted); }
+.add { background: var(--add); } .del { background: var(--del); } .note { color: var(--muted); font-style: italic; }
+.k { color: var(--k); } .s { color: var(--s); } .c { color: var(--c); font-style: italic; } .n { color: var(--n); }
+.empty { color: var(--muted); font-style: italic; }
+.annotation { border-left: 3px solid var(--warn); padding: .1em .6em; margin: .3em 0; white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p class="meta">{{if .Since}}{{.Since}} to {{.Until}} · {{end}}{{.Changes}} changes in {{len .Files}} files · generated {{.Generated}}</p>
+
+<h2 id="timeline">Timeline</h2>
+{{if .Timeline}}<table>
+<tr><th>Time</th><th>Op</th><th>Lines</th><th>Level</th><th>Path</th></tr>
+{{range .Timeline}}<tr><td>{{.Time}}</td><td>{{.Op}}</td><td>{{if .Binary}}binary{{else}}<span class="stat-add">+{{.Added}}</span> <span class="stat-del">-{{.Deleted}}</span>{{end}}</td><td class="level-{{.Level}}">{{.Level}}</td><td class="path"><a href="#{{.FileID}}">{{.Path}}</a>{{if .Note}}<div class="annotation">{{.Note}}</div>{{end}}</td></tr>
+{{end}}</table>{{else}}<p class="empty">No changes recorded.</p>{{end}}
+
+{{range .Files}}<h2 id="{{.ID}}">{{.Path}}</h2>
+<p class="meta">{{len .Changes}} changes · <span class="stat-add">+{{.Added}}</span> <span class="stat-del">-{{.Deleted}}</span></p>
+{{range .Changes}}<h3>{{.Time}} · {{.Op}}{{if not .Binary}} · <span class="stat-add">+{{.Added}}</span> <span class="stat-del">-{{.Deleted}}</span>{{end}}</h3>
+{{if .Note}}<p class="annotation">{{.Note}}</p>
+{{end}}{{if .Lines}}<pre>{{range .Lines}}<span class="line {{.Class}}">{{.HTML}}</span>{{end}}</pre>{{else}}<p class="empty">No diff recorded.</p>{{end}}
+{{end}}{{end}}
+</body>
+</html>
+`))
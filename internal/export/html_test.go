@@ -0,0 +1,59 @@
+package export
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/deemkeen/diffwatch/internal/store"
+)
+
+// envPatch is a recorded change of a .env file
+const envPatch = `--- a/.env
++++ b/.env
+@@ -1,3 +1,3 @@
+ DB_HOST=localhost
+-SECRET=abc
++SECRET=xyz
+ EMPTY=
+`
+
+func exportHTML(t *testing.T, records []store.Record, opts Options) string {
+	t.Helper()
+	var b bytes.Buffer
+	if err := HTML(&b, records, opts); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func TestHTMLMasksEnvValues(t *testing.T) {
+	records := []store.Record{{Time: time.Now(), Path: "/srv/app/.env", Op: "write", Added: 1, Deleted: 1, Patch: envPatch}}
+
+	out := exportHTML(t, records, Options{})
+	for _, secret := range []string{"abc", "xyz", "localhost"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("report shows the value %q", secret)
+		}
+	}
+	if !strings.Contains(out, valueMask) {
+		t.Error("report has no masked values")
+	}
+
+	out = exportHTML(t, records, Options{RevealValues: true})
+	for _, secret := range []string{"abc", "xyz", "localhost"} {
+		if !strings.Contains(out, secret) {
+			t.Errorf("report with revealed values misses %q", secret)
+		}
+	}
+}
+
+func TestHTMLKeepsOtherValues(t *testing.T) {
+	patch := strings.ReplaceAll(envPatch, ".env", "settings.conf")
+	records := []store.Record{{Time: time.Now(), Path: "/srv/app/settings.conf", Op: "write", Added: 1, Deleted: 1, Patch: patch}}
+
+	if out := exportHTML(t, records, Options{}); !strings.Contains(out, "abc") || strings.Contains(out, valueMask) {
+		t.Error("values of a file that isn't a .env file are masked")
+	}
+}
@@ -0,0 +1,166 @@
+package extdiff
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/deemkeen/diffwatch/internal/config"
+	"github.com/deemkeen/diffwatch/internal/match"
+)
+
+// DefaultTimeout bounds a differ run without a configured timeout
+const DefaultTimeout = 10 * time.Second
+
+// maxOutput is the most bytes of a differ's output kept
+const maxOutput = 512 * 1024
+
+// Output is what an external differ made of a change
+type Output struct {
+	Differ    string // Name of the differ
+	Text      string // Its standard output, cut to maxOutput bytes
+	Truncated bool   // Output was cut
+	Err       error  // The differ failed: couldn't start, timed out or printed nothing but failed
+}
+
+// differ is a configured external differ
+type differ struct {
+	name    string
+	pattern string
+	command []string
+	timeout time.Duration
+}
+
+// Runner runs the configured external differs on changes
+type Runner struct {
+	differs []differ
+}
+
+// New checks the configured differs
+func New(differs []config.Differ) (*Runner, error) {
+	r := &Runner{}
+	for i, d := range differs {
+		if len(d.Command) == 0 || d.Command[0] == "" {
+			return nil, fmt.Errorf("differ %d: no command", i+1)
+		}
+		if d.Pattern == "" {
+			return nil, fmt.Errorf("differ %d: no pattern", i+1)
+		}
+		if _, err := path.Match(d.Pattern, ""); err != nil {
+			return nil, fmt.Errorf("differ %d: pattern %q: %w", i+1, d.Pattern, err)
+		}
+
+		compiled := differ{
+			name:    d.Name,
+			pattern: d.Pattern,
+			command: d.Command,
+			timeout: DefaultTimeout,
+		}
+		if compiled.name == "" {
+			compiled.name = filepath.Base(d.Command[0])
+		}
+		if d.Timeout != "" {
+			t, err := time.ParseDuration(d.Timeout)
+			if err != nil || t <= 0 {
+				return nil, fmt.Errorf("differ %s: invalid timeout %q", compiled.name, d.Timeout)
+			}
+			compiled.timeout = t
+		}
+		r.differs = append(r.differs, compiled)
+	}
+	return r, nil
+}
+
+// find returns the first differ whose pattern matches relPath, or nil
+func (r *Runner) find(relPath string) *differ {
+	if r == nil {
+		return nil
+	}
+	for i := range r.differs {
+		if match.Glob(r.differs[i].pattern, relPath) {
+			return &r.differs[i]
+		}
+	}
+	return nil
+}
+
+// Applies reports whether a differ handles changes of relPath
+func (r *Runner) Applies(relPath string) bool {
+	return r.find(relPath) != nil
+}
+
+// Run runs the differ handling relPath, relative to the watch root dir,
+// on the old and new contents of a change. Both are written to temporary
+// files named like the changed file, which replace {old} and {new} in the
+// command, and {path} is replaced by relPath. A missing version is an
+// empty file, as /dev/null is for diff. Differs may exit non-zero, as diff
+// does when files differ, as long as they print something.
+func (r *Runner) Run(ctx context.Context, dir, relPath string, old, new []byte) Output {
+	d := r.find(relPath)
+	if d == nil {
+		return Output{Err: errors.New("no differ")}
+	}
+	out := Output{Differ: d.name}
+
+	tmp, err := os.MkdirTemp("", "diffwatch-differ-")
+	if err != nil {
+		out.Err = err
+		return out
+	}
+	defer os.RemoveAll(tmp)
+
+	base := filepath.Base(filepath.FromSlash(relPath))
+	oldPath, newPath := filepath.Join(tmp, "old-"+base), filepath.Join(tmp, "new-"+base)
+	if err := os.WriteFile(oldPath, old, 0o600); err != nil {
+		out.Err = err
+		return out
+	}
+	if err := os.WriteFile(newPath, new, 0o600); err != nil {
+		out.Err = err
+		return out
+	}
+
+	args := make([]string, len(d.command))
+	replacer := strings.NewReplacer("{old}", oldPath, "{new}", newPath, "{path}", relPath)
+	for i, arg := range d.command {
+		args[i] = replacer.Replace(arg)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	runErr := cmd.Run()
+
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		out.Err = fmt.Errorf("timed out after %s", d.timeout)
+		return out
+	case len(bytes.TrimSpace(stdout.Bytes())) == 0 && runErr != nil:
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			msg, _, _ = strings.Cut(msg, "\n")
+			out.Err = fmt.Errorf("%w: %s", runErr, msg)
+		} else {
+			out.Err = runErr
+		}
+		return out
+	}
+
+	text := stdout.Bytes()
+	if len(text) > maxOutput {
+		text, out.Truncated = text[:maxOutput], true
+	}
+	out.Text = string(text)
+	return out
+}
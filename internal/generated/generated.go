@@ -0,0 +1,108 @@
+package generated
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+
+	"github.com/deemkeen/diffwatch/internal/config"
+	"github.com/deemkeen/diffwatch/internal/diff"
+	"github.com/deemkeen/diffwatch/internal/match"
+)
+
+// markerLines and markerBytes bound the head of a file searched for
+// generated markers
+const (
+	markerLines = 5
+	markerBytes = 4096
+)
+
+// markerRe matches the headers generators put in their output: Go's
+// convention and the "@generated" tag used by many other tools
+var markerRe = regexp.MustCompile(`Code generated .* DO NOT EDIT|@generated\b`)
+
+// Detector recognizes generated and huge files, whose changes are only
+// summarized
+type Detector struct {
+	cfg config.Generated
+}
+
+// New checks the patterns of cfg and returns a detector applying it
+func New(cfg config.Generated) (*Detector, error) {
+	for _, pattern := range cfg.Patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("generated pattern %q: %w", pattern, err)
+		}
+	}
+	return &Detector{cfg: cfg}, nil
+}
+
+// Mark sets result.SummaryOnly if the file at relPath (relative to the
+// watch root) looks generated or is too big to show line by line
+func (d *Detector) Mark(relPath string, result *diff.Result) {
+	if d == nil || result == nil || !result.HasDiff || result.IsBinary {
+		return
+	}
+	result.SummaryOnly = d.reason(relPath, result)
+}
+
+// reason returns why the diff of result should only be summarized, or ""
+func (d *Detector) reason(relPath string, result *diff.Result) string {
+	if match.Any(d.cfg.Patterns, relPath) {
+		return "generated file"
+	}
+
+	content := latest(result)
+	if d.cfg.Markers && markerRe.Match(leadingLines(content[:min(len(content), markerBytes)], markerLines)) {
+		return "marked as generated"
+	}
+
+	if d.cfg.MaxSize > 0 {
+		size := int64(len(content))
+		if result.Streamed {
+			// Only the changed regions of large files are read
+			if info, err := os.Stat(result.Path); err == nil {
+				size = info.Size()
+			}
+		}
+		if size > d.cfg.MaxSize {
+			return fmt.Sprintf("larger than %d bytes", d.cfg.MaxSize)
+		}
+	}
+
+	if d.cfg.MaxLineLength > 0 {
+		for _, line := range result.Lines {
+			if len(line.Content) > d.cfg.MaxLineLength || len(line.OldContent) > d.cfg.MaxLineLength {
+				return fmt.Sprintf("lines longer than %d bytes, likely minified", d.cfg.MaxLineLength)
+			}
+		}
+	}
+	return ""
+}
+
+// latest returns the newest content of result: the new content, or the
+// old one for a deleted file. Nil for streamed diffs.
+func latest(result *diff.Result) []byte {
+	switch {
+	case result.NewState != nil && result.NewState.Exists:
+		return result.NewState.Content
+	case result.OldState != nil:
+		return result.OldState.Content
+	}
+	return nil
+}
+
+// leadingLines returns the first n lines of content
+func leadingLines(content []byte, n int) []byte {
+	end := 0
+	for range n {
+		i := bytes.IndexByte(content[end:], '\n')
+		if i < 0 {
+			return content
+		}
+		end += i + 1
+	}
+	return content[:end]
+}
@@ -0,0 +1,206 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// notCommitted is the hash git blame reports for uncommitted lines
+const notCommitted = "0000000000000000000000000000000000000000"
+
+// BlameLine describes who last changed a line
+type BlameLine struct {
+	Hash   string // Short commit hash, empty if not committed yet
+	Author string
+}
+
+// Blame maps 1-based line numbers to blame information
+type Blame map[int]BlameLine
+
+// Root returns the top-level directory of the git repository containing dir
+func Root(dir string) (string, error) {
+	out, err := run(dir, nil, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", fmt.Errorf("%s is not in a git repository: %w", dir, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// BlameContent blames content as if it were the contents of path in the
+// working tree of the repository at root. Lines that are not committed yet
+// have an empty hash.
+func BlameContent(root, path string, content []byte) (Blame, error) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return nil, fmt.Errorf("resolving %s in repository: %w", path, err)
+	}
+
+	out, err := run(root, content, "blame", "--porcelain", "--contents", "-", "--", filepath.ToSlash(rel))
+	if err != nil {
+		// Files unknown to git have no history: every line is uncommitted
+		if strings.Contains(err.Error(), "no such path") {
+			return uncommitted(content), nil
+		}
+		return nil, fmt.Errorf("blaming %s: %w", rel, err)
+	}
+
+	return parsePorcelain(out), nil
+}
+
+// Commit stages the current state of path (including deletion) and commits
+// only that path with the given message. Paths ignored by git and paths
+// without changes are skipped without error.
+func Commit(root, path, message string) error {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return fmt.Errorf("resolving %s in repository: %w", path, err)
+	}
+	rel = filepath.ToSlash(rel)
+
+	// check-ignore exits with status 0 if the path is ignored
+	if _, err := run(root, nil, "check-ignore", "-q", "--", rel); err == nil {
+		return nil
+	}
+
+	if _, err := run(root, nil, "add", "-A", "--", rel); err != nil {
+		return fmt.Errorf("staging %s: %w", rel, err)
+	}
+
+	// Nothing staged for this path means there is nothing to commit
+	if _, err := run(root, nil, "diff", "--cached", "--quiet", "--", rel); err == nil {
+		return nil
+	}
+
+	if _, err := run(root, nil, "commit", "-q", "-m", message, "--", rel); err != nil {
+		return fmt.Errorf("committing %s: %w", rel, err)
+	}
+	return nil
+}
+
+// IndexContent returns the staged content of path. ok is false if path is
+// not in the index.
+func IndexContent(root, path string) (content []byte, ok bool, err error) {
+	rel, err := relPath(root, path)
+	if err != nil {
+		return nil, false, err
+	}
+
+	out, err := run(root, nil, "ls-files", "--cached", "--", rel)
+	if err != nil {
+		return nil, false, fmt.Errorf("looking up %s in the index: %w", rel, err)
+	}
+	if len(bytes.TrimSpace(out)) == 0 {
+		return nil, false, nil
+	}
+
+	content, err = run(root, nil, "show", ":"+rel)
+	if err != nil {
+		return nil, false, fmt.Errorf("reading %s from the index: %w", rel, err)
+	}
+	return content, true, nil
+}
+
+// Stage stages the current state of path, including deletion
+func Stage(root, path string) error {
+	rel, err := relPath(root, path)
+	if err != nil {
+		return err
+	}
+	if _, err := run(root, nil, "add", "-A", "--", rel); err != nil {
+		return fmt.Errorf("staging %s: %w", rel, err)
+	}
+	return nil
+}
+
+// ApplyCached applies a patch with paths relative to root to the index
+// only, leaving the working tree alone
+func ApplyCached(root, patch string) error {
+	if _, err := run(root, []byte(patch), "apply", "--cached", "-"); err != nil {
+		return fmt.Errorf("staging patch: %w", err)
+	}
+	return nil
+}
+
+// relPath returns path relative to the repository root, slash-separated
+func relPath(root, path string) (string, error) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return "", fmt.Errorf("resolving %s in repository: %w", path, err)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// uncommitted returns a blame marking every line of content as uncommitted
+func uncommitted(content []byte) Blame {
+	blame := make(Blame)
+	lines := bytes.Count(content, []byte("\n")) + 1
+	for i := 1; i <= lines; i++ {
+		blame[i] = BlameLine{}
+	}
+	return blame
+}
+
+// parsePorcelain parses the output of git blame --porcelain
+func parsePorcelain(out []byte) Blame {
+	blame := make(Blame)
+	authors := make(map[string]string)
+
+	var hash string
+	var line int
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	for scanner.Scan() {
+		text := scanner.Text()
+
+		switch {
+		case strings.HasPrefix(text, "\t"):
+			// Content line ends an entry
+			entry := BlameLine{Author: authors[hash]}
+			if hash != notCommitted && len(hash) >= 7 {
+				entry.Hash = hash[:7]
+			}
+			blame[line] = entry
+
+		case strings.HasPrefix(text, "author "):
+			authors[hash] = strings.TrimPrefix(text, "author ")
+
+		default:
+			// Header line: <hash> <orig line> <final line> [<group size>]
+			fields := strings.Fields(text)
+			if len(fields) >= 3 && len(fields[0]) == 40 {
+				hash = fields[0]
+				line, _ = strconv.Atoi(fields[2])
+			}
+		}
+	}
+
+	return blame
+}
+
+// run runs a git command in dir, optionally feeding stdin
+func run(dir string, stdin []byte, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return nil, fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return out, nil
+}
@@ -0,0 +1,480 @@
+package kube
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/deemkeen/diffwatch/internal/mirror"
+	"github.com/deemkeen/diffwatch/internal/state"
+	"github.com/deemkeen/diffwatch/internal/watcher"
+)
+
+// Kinds of resources that can be watched
+const (
+	ConfigMap = "configmap"
+	Secret    = "secret"
+)
+
+// retryDelay is the wait before restarting a failed watch
+const retryDelay = 5 * time.Second
+
+// commandTimeout bounds a single kubectl get
+const commandTimeout = 30 * time.Second
+
+// Resource is a watched ConfigMap or Secret
+type Resource struct {
+	Kind string
+	Name string
+}
+
+// String returns the resource as KIND/NAME
+func (r Resource) String() string {
+	return r.Kind + "/" + r.Name
+}
+
+// ParseResource parses a resource of the form KIND/NAME. Kinds are
+// accepted in kubectl's spellings: configmap, configmaps, cm, secret and
+// secrets.
+func ParseResource(s string) (Resource, error) {
+	kind, name, ok := strings.Cut(s, "/")
+	if !ok || name == "" || strings.Contains(name, "/") {
+		return Resource{}, fmt.Errorf("invalid resource %q, want KIND/NAME", s)
+	}
+	switch strings.ToLower(kind) {
+	case "configmap", "configmaps", "cm":
+		kind = ConfigMap
+	case "secret", "secrets":
+		kind = Secret
+	default:
+		return Resource{}, fmt.Errorf("unsupported kind %q, want configmap or secret", kind)
+	}
+	return Resource{Kind: kind, Name: name}, nil
+}
+
+// Options configures a cluster watcher
+type Options struct {
+	Namespace     string       // Namespace of the resources (default: the context's)
+	Context       string       // kubeconfig context (default: the current one)
+	RevealSecrets bool         // Show Secret values instead of their digests
+	Ops           []string     // Operations to report (see watcher.ParseOps); empty reports all
+	Logger        *slog.Logger // Receives watcher internals (nil: discard)
+}
+
+// object is the part of a ConfigMap or Secret that is diffed
+type object struct {
+	Data       map[string]string `json:"data"`
+	BinaryData map[string]string `json:"binaryData"`
+}
+
+// watchEvent is a line of kubectl's --output-watch-events
+type watchEvent struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+// Watcher watches ConfigMaps and Secrets through kubectl and delivers the
+// changes of their keys like a local watcher delivers file changes. Each
+// key is a file KIND/NAME/KEY, reported as k8s:NAMESPACE/KIND/NAME/KEY;
+// a created or deleted resource creates or removes all of its keys.
+//
+// Secret values are shown as their size and digest, so changes are seen
+// without printing them, unless RevealSecrets is set.
+type Watcher struct {
+	namespace string
+	resources []Resource
+	opts      Options
+	log       *slog.Logger
+	states    *mirror.Files
+	errors    chan error
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+
+	mu     sync.Mutex
+	values map[Resource]map[string][]byte // Keys of the existing resources
+}
+
+// Watch starts watching resources. They are read before Watch returns, so
+// the first change to any key shows a proper diff. Resources that don't
+// exist yet are watched for their creation.
+func Watch(resources []Resource, opts Options) (*Watcher, error) {
+	log := opts.Logger
+	if log == nil {
+		log = slog.New(slog.DiscardHandler)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &Watcher{
+		resources: resources,
+		opts:      opts,
+		log:       log,
+		states:    mirror.New(opts.Ops, log),
+		errors:    make(chan error, 10),
+		ctx:       ctx,
+		cancel:    cancel,
+		values:    make(map[Resource]map[string][]byte),
+	}
+
+	w.namespace = opts.Namespace
+	if w.namespace == "" {
+		out, err := w.kubectl("config", "view", "--minify", "-o", "jsonpath={..namespace}")
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("reading the current namespace: %w", err)
+		}
+		w.namespace = strings.TrimSpace(string(out))
+		if w.namespace == "" {
+			w.namespace = "default"
+		}
+	}
+
+	for _, r := range resources {
+		obj, err := w.get(r)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		w.seed(r, obj)
+	}
+
+	for _, r := range resources {
+		w.wg.Add(1)
+		go w.follow(r)
+	}
+	return w, nil
+}
+
+// args returns the arguments of a kubectl command selecting the context
+// and, once known, the namespace
+func (w *Watcher) args(args ...string) []string {
+	var prefix []string
+	if w.opts.Context != "" {
+		prefix = append(prefix, "--context", w.opts.Context)
+	}
+	if w.namespace != "" {
+		prefix = append(prefix, "--namespace", w.namespace)
+	}
+	return append(prefix, args...)
+}
+
+// kubectl runs a kubectl command and returns its stdout
+func (w *Watcher) kubectl(args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(w.ctx, commandTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "kubectl", w.args(args...)...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, errors.New(msg)
+		}
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
+
+// selector returns the arguments selecting a resource by name. Listing
+// with a field selector, unlike getting by name, works for resources that
+// don't exist.
+func selector(r Resource) []string {
+	return []string{r.Kind + "s", "--field-selector", "metadata.name=" + r.Name}
+}
+
+// get reads a resource, nil if it doesn't exist
+func (w *Watcher) get(r Resource) (*object, error) {
+	out, err := w.kubectl(append(selector(r), "-o", "json")...)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", r, err)
+	}
+
+	var list struct {
+		Items []object `json:"items"`
+	}
+	if err := json.Unmarshal(out, &list); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", r, err)
+	}
+	if len(list.Items) == 0 {
+		return nil, nil
+	}
+	return &list.Items[0], nil
+}
+
+// follow watches a resource until the watcher is closed. A watch ending,
+// as the API server does periodically, is restarted after reading the
+// resource again, so changes in between aren't lost.
+func (w *Watcher) follow(r Resource) {
+	defer w.wg.Done()
+
+	for {
+		err := w.stream(r)
+		if w.ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			watcher.SendError(w.errors, fmt.Errorf("watching %s: %w", r, err), w.log)
+			select {
+			case <-w.ctx.Done():
+				return
+			case <-time.After(retryDelay):
+			}
+		} else {
+			w.log.Debug("watch ended, restarting", "resource", r.String())
+		}
+
+		obj, err := w.get(r)
+		if err != nil {
+			if w.ctx.Err() != nil {
+				return
+			}
+			watcher.SendError(w.errors, err, w.log)
+			continue
+		}
+		w.apply(r, obj)
+	}
+}
+
+// stream runs kubectl's watch of a resource and applies its events until
+// it ends
+func (w *Watcher) stream(r Resource) error {
+	args := append(selector(r), "-o", "json", "--watch", "--output-watch-events")
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(w.ctx, "kubectl", w.args(args...)...)
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = time.Second
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(stdout)
+	var decodeErr error
+	for {
+		var event watchEvent
+		if err := dec.Decode(&event); err != nil {
+			if err != io.EOF {
+				decodeErr = err
+			}
+			break
+		}
+
+		switch event.Type {
+		case "ADDED", "MODIFIED":
+			var obj object
+			if err := json.Unmarshal(event.Object, &obj); err != nil {
+				decodeErr = err
+				break
+			}
+			w.apply(r, &obj)
+		case "DELETED":
+			w.apply(r, nil)
+		case "ERROR":
+			watcher.SendError(w.errors, fmt.Errorf("watching %s: %s", r, event.Object), w.log)
+		}
+		if decodeErr != nil {
+			break
+		}
+	}
+
+	if decodeErr != nil {
+		cmd.Process.Kill()
+	}
+	if err := cmd.Wait(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return errors.New(msg)
+		}
+		return err
+	}
+	return decodeErr
+}
+
+// decode returns the values of an object's keys, nil if it doesn't exist.
+// Keys with invalid base64 are skipped.
+func (w *Watcher) decode(r Resource, obj *object) map[string][]byte {
+	if obj == nil {
+		return nil
+	}
+
+	values := make(map[string][]byte)
+	for key, v := range obj.Data {
+		if r.Kind == ConfigMap {
+			values[key] = []byte(v)
+			continue
+		}
+		if b, err := base64.StdEncoding.DecodeString(v); err == nil {
+			values[key] = b
+		} else {
+			w.log.Warn("invalid secret value", "resource", r.String(), "key", key, "error", err)
+		}
+	}
+	for key, v := range obj.BinaryData {
+		if b, err := base64.StdEncoding.DecodeString(v); err == nil {
+			values[key] = b
+		} else {
+			w.log.Warn("invalid binary value", "resource", r.String(), "key", key, "error", err)
+		}
+	}
+	return values
+}
+
+// path returns the reported path of a key of a resource
+func (w *Watcher) path(r Resource, key string) string {
+	return w.WatchPath() + "/" + r.Kind + "/" + r.Name + "/" + key
+}
+
+// fileState returns the state of a key as shown in the UI: its value, or
+// the size and digest of a hidden Secret value
+func (w *Watcher) fileState(r Resource, key string, value []byte) *state.FileState {
+	if r.Kind == Secret && !w.opts.RevealSecrets {
+		value = fmt.Appendf(nil, "(hidden, %d bytes, sha256:%x)\n", len(value), sha256.Sum256(value))
+	}
+	return &state.FileState{Path: w.path(r, key), Content: value, Exists: true, Hash: state.HashContent(value)}
+}
+
+// seed records the keys of a resource as read at startup
+func (w *Watcher) seed(r Resource, obj *object) {
+	values := w.decode(r, obj)
+
+	w.mu.Lock()
+	if values != nil {
+		w.values[r] = values
+	}
+	w.mu.Unlock()
+
+	for key, v := range values {
+		w.states.Seed(w.fileState(r, key, v))
+	}
+}
+
+// apply compares the keys of a resource with the previous ones and
+// reports the created, changed and removed keys. A nil object means the
+// resource was deleted.
+func (w *Watcher) apply(r Resource, obj *object) {
+	values := w.decode(r, obj)
+
+	w.mu.Lock()
+	old := w.values[r]
+	if values != nil {
+		w.values[r] = values
+	} else {
+		delete(w.values, r)
+	}
+	w.mu.Unlock()
+
+	var keys []string
+	for key := range values {
+		keys = append(keys, key)
+	}
+	for key := range old {
+		if _, ok := values[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		value, exists := values[key]
+		before, existed := old[key]
+
+		switch {
+		case exists && !existed:
+			w.states.Update(w.path(r, key), "create", w.fileState(r, key, value))
+		case !exists:
+			w.states.Update(w.path(r, key), "remove", &state.FileState{Path: w.path(r, key)})
+		case !bytes.Equal(value, before):
+			w.states.Update(w.path(r, key), "write", w.fileState(r, key, value))
+		}
+	}
+}
+
+// Events returns the channel of key events
+func (w *Watcher) Events() <-chan watcher.Event {
+	return w.states.Events()
+}
+
+// Errors returns the channel of errors
+func (w *Watcher) Errors() <-chan error {
+	return w.errors
+}
+
+// Stats returns the existing resources as directories and their keys as
+// files
+func (w *Watcher) Stats() watcher.Stats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	stats := watcher.Stats{Dirs: len(w.values)}
+	for _, values := range w.values {
+		stats.Files += len(values)
+	}
+	return stats
+}
+
+// WatchPath returns the watched namespace as k8s:NAMESPACE
+func (w *Watcher) WatchPath() string {
+	return "k8s:" + w.namespace
+}
+
+// Roots returns the watched namespace
+func (w *Watcher) Roots() []string {
+	return []string{w.WatchPath()}
+}
+
+// IsRecursive returns true: keys are below their resources
+func (w *Watcher) IsRecursive() bool {
+	return true
+}
+
+// AddRoot is not supported: the resources are fixed at startup
+func (w *Watcher) AddRoot(path string) (string, error) {
+	return "", errors.New("a cluster watch can't add roots")
+}
+
+// RemoveRoot is not supported: the resources are fixed at startup
+func (w *Watcher) RemoveRoot(path string) (string, error) {
+	return "", errors.New("a cluster watch can't remove roots")
+}
+
+// WalkFiles is not supported: the resources are read at startup instead
+func (w *Watcher) WalkFiles(fn func(path string) error) error {
+	return errors.New("prescan is not available for a cluster; resources are read at startup")
+}
+
+// PriorState returns the baseline and the state before the first
+// unclaimed event of path, and forgets the latter
+func (w *Watcher) PriorState(p string) (baseline, previous *state.FileState, ok bool) {
+	return w.states.PriorState(p)
+}
+
+// CurrentState returns the state of path after its latest event
+func (w *Watcher) CurrentState(p string) (*state.FileState, bool) {
+	return w.states.CurrentState(p)
+}
+
+// Close stops watching
+func (w *Watcher) Close() error {
+	if !w.states.Stop() {
+		return nil
+	}
+	w.cancel()
+	w.wg.Wait()
+	w.states.Close()
+	close(w.errors)
+	return nil
+}
@@ -0,0 +1,397 @@
+package lang
+
+import (
+	"bytes"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Language describes a file type: how it is shown and how its source is
+// highlighted
+type Language struct {
+	ID   string // Stable identifier selecting type specific handling, e.g. "go"
+	Name string // Display name, e.g. "Go"
+	Icon string // Shown before file names
+
+	comment  string   // Line comment prefix, if any
+	block    bool     // Has /* */ comments
+	keywords []string // Reserved words
+
+	once    sync.Once
+	pattern *regexp.Regexp
+}
+
+// Class is the kind of a highlighted token
+type Class int
+
+const (
+	Comment Class = iota
+	String
+	Number
+	Keyword
+)
+
+// Token is a highlighted span of a line, by byte offsets
+type Token struct {
+	Start, End int
+	Class      Class
+}
+
+var (
+	keywordsJS = []string{
+		"async", "await", "break", "case", "catch", "class", "const", "continue",
+		"default", "delete", "do", "else", "export", "extends", "finally", "for",
+		"from", "function", "if", "import", "in", "instanceof", "interface", "let",
+		"new", "null", "of", "return", "static", "super", "switch", "this", "throw",
+		"try", "type", "typeof", "undefined", "var", "void", "while", "yield", "true", "false",
+	}
+
+	keywordsJava = []string{
+		"abstract", "boolean", "break", "byte", "case", "catch", "char", "class",
+		"const", "continue", "default", "do", "double", "else", "enum", "extends",
+		"final", "finally", "float", "for", "if", "implements", "import", "instanceof",
+		"int", "interface", "long", "new", "package", "private", "protected", "public",
+		"return", "short", "static", "super", "switch", "this", "throw", "throws",
+		"try", "void", "while", "null", "true", "false", "fun", "val", "var",
+	}
+
+	keywordsC = []string{
+		"auto", "break", "case", "char", "const", "continue", "default", "do", "double",
+		"else", "enum", "extern", "float", "for", "goto", "if", "include", "define",
+		"int", "long", "return", "short", "signed", "sizeof", "static", "struct",
+		"switch", "typedef", "union", "unsigned", "void", "while", "class", "public",
+		"private", "protected", "namespace", "template", "new", "delete", "true", "false",
+		"nullptr", "NULL",
+	}
+
+	keywordsConfig = []string{"true", "false", "null", "yes", "no"}
+)
+
+var (
+	Go = &Language{ID: "go", Name: "Go", Icon: "🐹", comment: "//", block: true, keywords: []string{
+		"break", "case", "chan", "const", "continue", "default", "defer", "else",
+		"fallthrough", "for", "func", "go", "goto", "if", "import", "interface", "map",
+		"package", "range", "return", "select", "struct", "switch", "type", "var",
+		"nil", "true", "false", "iota",
+	}}
+
+	JavaScript = &Language{ID: "javascript", Name: "JavaScript", Icon: "📜", comment: "//", block: true, keywords: keywordsJS}
+	TypeScript = &Language{ID: "typescript", Name: "TypeScript", Icon: "📘", comment: "//", block: true, keywords: keywordsJS}
+
+	Python = &Language{ID: "python", Name: "Python", Icon: "🐍", comment: "#", keywords: []string{
+		"and", "as", "assert", "async", "await", "break", "class", "continue", "def",
+		"del", "elif", "else", "except", "finally", "for", "from", "global", "if",
+		"import", "in", "is", "lambda", "nonlocal", "not", "or", "pass", "raise",
+		"return", "try", "while", "with", "yield", "None", "True", "False", "self",
+	}}
+
+	Rust = &Language{ID: "rust", Name: "Rust", Icon: "🦀", comment: "//", block: true, keywords: []string{
+		"as", "async", "await", "break", "const", "continue", "crate", "else", "enum",
+		"extern", "fn", "for", "if", "impl", "in", "let", "loop", "match", "mod", "move",
+		"mut", "pub", "ref", "return", "self", "Self", "static", "struct", "super",
+		"trait", "type", "unsafe", "use", "where", "while", "true", "false",
+	}}
+
+	Java   = &Language{ID: "java", Name: "Java", Icon: "☕", comment: "//", block: true, keywords: keywordsJava}
+	Kotlin = &Language{ID: "kotlin", Name: "Kotlin", Icon: "🧩", comment: "//", block: true, keywords: keywordsJava}
+	C      = &Language{ID: "c", Name: "C", Icon: "🔧", comment: "//", block: true, keywords: keywordsC}
+	CPP    = &Language{ID: "cpp", Name: "C++", Icon: "🔧", comment: "//", block: true, keywords: keywordsC}
+
+	Shell = &Language{ID: "shell", Name: "Shell", Icon: "🐚", comment: "#", keywords: []string{
+		"if", "then", "else", "elif", "fi", "for", "while", "until", "do", "done",
+		"case", "esac", "in", "function", "return", "local", "export", "readonly",
+		"set", "unset", "echo", "exit",
+	}}
+
+	Ruby = &Language{ID: "ruby", Name: "Ruby", Icon: "💎", comment: "#", keywords: []string{
+		"alias", "and", "begin", "break", "case", "class", "def", "do",
+		"else", "elsif", "end", "ensure", "false", "for", "if", "in", "module", "next",
+		"nil", "not", "or", "redo", "rescue", "retry", "return", "self", "super",
+		"then", "true", "undef", "unless", "until", "when", "while", "yield", "require",
+	}}
+
+	Perl = &Language{ID: "perl", Name: "Perl", Icon: "🐪", comment: "#", keywords: []string{
+		"my", "our", "local", "sub", "if", "elsif", "else", "unless", "while", "until",
+		"for", "foreach", "last", "next", "return", "use", "require", "package",
+	}}
+
+	PHP = &Language{ID: "php", Name: "PHP", Icon: "🐘", comment: "//", block: true, keywords: []string{
+		"abstract", "array", "as", "break", "case", "catch", "class", "const", "continue",
+		"default", "do", "echo", "else", "elseif", "extends", "final", "finally", "for",
+		"foreach", "function", "if", "implements", "interface", "namespace", "new",
+		"null", "private", "protected", "public", "return", "static", "switch", "throw",
+		"trait", "try", "use", "while", "true", "false",
+	}}
+
+	Lua = &Language{ID: "lua", Name: "Lua", Icon: "🌙", comment: "--", keywords: []string{
+		"and", "break", "do", "else", "elseif", "end", "false", "for", "function",
+		"if", "in", "local", "nil", "not", "or", "repeat", "return", "then", "true",
+		"until", "while",
+	}}
+
+	SQL = &Language{ID: "sql", Name: "SQL", Icon: "💾", comment: "--", block: true, keywords: []string{
+		"select", "from", "where", "insert", "into", "values", "update", "set",
+		"delete", "create", "table", "index", "drop", "alter", "add", "column",
+		"primary", "key", "foreign", "references", "not", "null", "and", "or",
+		"join", "left", "right", "inner", "outer", "on", "group", "by", "order",
+		"limit", "as", "default", "unique", "begin", "commit", "rollback",
+		"SELECT", "FROM", "WHERE", "INSERT", "INTO", "VALUES", "UPDATE", "SET",
+		"DELETE", "CREATE", "TABLE", "INDEX", "DROP", "ALTER", "ADD", "COLUMN",
+		"PRIMARY", "KEY", "FOREIGN", "REFERENCES", "NOT", "NULL", "AND", "OR",
+		"JOIN", "LEFT", "RIGHT", "INNER", "OUTER", "ON", "GROUP", "BY", "ORDER",
+		"LIMIT", "AS", "DEFAULT", "UNIQUE", "BEGIN", "COMMIT", "ROLLBACK",
+	}}
+
+	Proto = &Language{ID: "proto", Name: "Protocol Buffers", Icon: "📡", comment: "//", block: true, keywords: []string{
+		"syntax", "package", "import", "option", "message", "enum", "service", "rpc",
+		"returns", "repeated", "optional", "required", "reserved", "oneof", "map",
+		"stream", "true", "false",
+	}}
+
+	Terraform = &Language{ID: "terraform", Name: "Terraform", Icon: "🌍", comment: "#", block: true, keywords: []string{
+		"resource", "data", "variable", "output", "locals", "module", "provider",
+		"terraform", "for_each", "count", "depends_on", "true", "false", "null",
+	}}
+
+	JSON       = &Language{ID: "json", Name: "JSON", Icon: "🔣", keywords: keywordsConfig}
+	YAML       = &Language{ID: "yaml", Name: "YAML", Icon: "🧾", comment: "#", keywords: keywordsConfig}
+	TOML       = &Language{ID: "toml", Name: "TOML", Icon: "🧾", comment: "#", keywords: keywordsConfig}
+	INI        = &Language{ID: "ini", Name: "INI", Icon: "🔩", comment: ";", keywords: keywordsConfig}
+	Properties = &Language{ID: "properties", Name: "Properties", Icon: "🔩", comment: "#", keywords: keywordsConfig}
+	Dotenv     = &Language{ID: "dotenv", Name: "dotenv", Icon: "🔑", comment: "#", keywords: []string{"export"}}
+	Dockerfile = &Language{ID: "dockerfile", Name: "Dockerfile", Icon: "🐳", comment: "#", keywords: []string{
+		"FROM", "AS", "RUN", "CMD", "LABEL", "EXPOSE", "ENV", "ADD", "COPY", "ENTRYPOINT",
+		"VOLUME", "USER", "WORKDIR", "ARG", "ONBUILD", "STOPSIGNAL", "HEALTHCHECK", "SHELL",
+	}}
+	Makefile = &Language{ID: "makefile", Name: "Makefile", Icon: "🔨", comment: "#", keywords: []string{
+		"include", "define", "endef", "ifeq", "ifneq", "ifdef", "ifndef", "else", "endif",
+		"export", "override",
+	}}
+
+	// Markup and data formats without highlighting
+	Markdown    = &Language{ID: "markdown", Name: "Markdown", Icon: "📝"}
+	HTML        = &Language{ID: "html", Name: "HTML", Icon: "🌐"}
+	CSS         = &Language{ID: "css", Name: "CSS", Icon: "🎨", block: true}
+	XML         = &Language{ID: "xml", Name: "XML", Icon: "📰"}
+	Notebook    = &Language{ID: "ipynb", Name: "Jupyter Notebook", Icon: "📓"}
+	Certificate = &Language{ID: "pem", Name: "PEM", Icon: "🔐"}
+	PDF         = &Language{ID: "pdf", Name: "PDF", Icon: "📕"}
+	Document    = &Language{ID: "document", Name: "Office document", Icon: "📄"}
+	Lockfile    = &Language{ID: "lockfile", Name: "Lockfile", Icon: "📦"}
+	TFState     = &Language{ID: "tfstate", Name: "Terraform state", Icon: "🌍", keywords: keywordsConfig}
+)
+
+// extensions maps lower case file extensions to languages
+var extensions = map[string]*Language{
+	".go":         Go,
+	".js":         JavaScript,
+	".jsx":        JavaScript,
+	".mjs":        JavaScript,
+	".cjs":        JavaScript,
+	".ts":         TypeScript,
+	".tsx":        TypeScript,
+	".mts":        TypeScript,
+	".py":         Python,
+	".pyw":        Python,
+	".rs":         Rust,
+	".java":       Java,
+	".kt":         Kotlin,
+	".kts":        Kotlin,
+	".c":          C,
+	".h":          C,
+	".cc":         CPP,
+	".cpp":        CPP,
+	".cxx":        CPP,
+	".hh":         CPP,
+	".hpp":        CPP,
+	".sh":         Shell,
+	".bash":       Shell,
+	".zsh":        Shell,
+	".rb":         Ruby,
+	".pl":         Perl,
+	".pm":         Perl,
+	".php":        PHP,
+	".lua":        Lua,
+	".sql":        SQL,
+	".proto":      Proto,
+	".tf":         Terraform,
+	".tfvars":     Terraform,
+	".tfstate":    TFState,
+	".json":       JSON,
+	".yaml":       YAML,
+	".yml":        YAML,
+	".toml":       TOML,
+	".ini":        INI,
+	".cfg":        INI,
+	".conf":       INI,
+	".properties": Properties,
+	".env":        Dotenv,
+	".dockerfile": Dockerfile,
+	".mk":         Makefile,
+	".md":         Markdown,
+	".markdown":   Markdown,
+	".html":       HTML,
+	".htm":        HTML,
+	".css":        CSS,
+	".scss":       CSS,
+	".xml":        XML,
+	".xsd":        XML,
+	".xsl":        XML,
+	".ipynb":      Notebook,
+	".pem":        Certificate,
+	".crt":        Certificate,
+	".cer":        Certificate,
+	".pdf":        PDF,
+	".docx":       Document,
+	".xlsx":       Document,
+	".pptx":       Document,
+	".odt":        Document,
+	".ods":        Document,
+	".odp":        Document,
+}
+
+// filenames maps file names without a telling extension to languages
+var filenames = map[string]*Language{
+	"Dockerfile":    Dockerfile,
+	"Containerfile": Dockerfile,
+	"Makefile":      Makefile,
+	"GNUmakefile":   Makefile,
+	"makefile":      Makefile,
+	"Gemfile":       Ruby,
+	"Rakefile":      Ruby,
+	".bashrc":       Shell,
+	".bash_profile": Shell,
+	".zshrc":        Shell,
+	".profile":      Shell,
+
+	"terraform.tfstate.backup": TFState,
+
+	// Lockfiles, diffed by package
+	"go.sum":            Lockfile,
+	"package-lock.json": Lockfile,
+	"Cargo.lock":        Lockfile,
+}
+
+// interpreters maps shebang interpreters, without version suffixes, to
+// languages
+var interpreters = map[string]*Language{
+	"sh":      Shell,
+	"bash":    Shell,
+	"zsh":     Shell,
+	"dash":    Shell,
+	"ksh":     Shell,
+	"ash":     Shell,
+	"python":  Python,
+	"node":    JavaScript,
+	"nodejs":  JavaScript,
+	"deno":    TypeScript,
+	"ts-node": TypeScript,
+	"ruby":    Ruby,
+	"perl":    Perl,
+	"php":     PHP,
+	"lua":     Lua,
+}
+
+// Detect returns the language of a file from its name, or for scripts
+// without a known name from the shebang line of content, which may be nil.
+// Returns nil if the language is unknown.
+func Detect(path string, content []byte) *Language {
+	base := filepath.Base(path)
+	if l, ok := filenames[base]; ok {
+		return l
+	}
+	switch {
+	case strings.HasPrefix(base, "Dockerfile."):
+		return Dockerfile
+	case strings.HasPrefix(base, ".env."):
+		return Dotenv
+	}
+	if l, ok := extensions[strings.ToLower(filepath.Ext(base))]; ok {
+		return l
+	}
+	return fromShebang(content)
+}
+
+// fromShebang returns the language of the interpreter named in a "#!" first
+// line, e.g. "#!/usr/bin/env python3", or nil
+func fromShebang(content []byte) *Language {
+	if !bytes.HasPrefix(content, []byte("#!")) {
+		return nil
+	}
+	line, _, _ := bytes.Cut(content[2:], []byte("\n"))
+	fields := strings.Fields(string(line))
+	if len(fields) == 0 {
+		return nil
+	}
+
+	name := filepath.Base(fields[0])
+	if name == "env" {
+		// Skip env's options and variable assignments
+		name = ""
+		for _, f := range fields[1:] {
+			if !strings.HasPrefix(f, "-") && !strings.Contains(f, "=") {
+				name = filepath.Base(f)
+				break
+			}
+		}
+	}
+	return interpreters[strings.TrimRight(name, "0123456789.")]
+}
+
+// Highlighted reports whether lines of the language get tokens
+func (l *Language) Highlighted() bool {
+	return l != nil && (l.comment != "" || l.block || len(l.keywords) > 0)
+}
+
+// compile builds the token pattern of the language. Groups in order:
+// comment, string, number, word.
+func (l *Language) compile() *regexp.Regexp {
+	l.once.Do(func() {
+		var comments []string
+		if l.block {
+			comments = append(comments, `/\*.*?(?:\*/|$)`)
+		}
+		if l.comment != "" {
+			comments = append(comments, regexp.QuoteMeta(l.comment)+`.*`)
+		}
+		comment := `[^\x00-\x{10FFFF}]` // Matches nothing
+		if len(comments) > 0 {
+			comment = strings.Join(comments, "|")
+		}
+		l.pattern = regexp.MustCompile(`(` + comment + `)` +
+			`|("(?:[^"\\]|\\.)*"?|'(?:[^'\\]|\\.)*'?|` + "`[^`]*`?" + `)` +
+			`|(\b\d[\w.]*)` +
+			`|([A-Za-z_]\w*)`)
+	})
+	return l.pattern
+}
+
+// Tokens returns the comments, strings, numbers and keywords of a line of
+// source, in order. Lines of languages without highlighting have none.
+func (l *Language) Tokens(line string) []Token {
+	if !l.Highlighted() {
+		return nil
+	}
+
+	var tokens []Token
+	for _, m := range l.compile().FindAllStringSubmatchIndex(line, -1) {
+		var class Class
+		switch {
+		case m[2] >= 0:
+			class = Comment
+		case m[4] >= 0:
+			class = String
+		case m[6] >= 0:
+			class = Number
+		case slices.Contains(l.keywords, line[m[8]:m[9]]):
+			class = Keyword
+		default:
+			continue
+		}
+		tokens = append(tokens, Token{Start: m[0], End: m[1], Class: class})
+	}
+	return tokens
+}
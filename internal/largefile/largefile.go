@@ -0,0 +1,580 @@
+package largefile
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"io"
+	"os"
+	"runtime/debug"
+	"sync"
+
+	"github.com/deemkeen/diffwatch/internal/diff"
+	"github.com/deemkeen/diffwatch/internal/dirs"
+	"github.com/deemkeen/diffwatch/internal/lang"
+)
+
+// Block boundaries are content-defined: a block ends after a line whose
+// hash is divisible by boundaryModulus, so an insertion only changes the
+// blocks around it instead of shifting all following boundaries
+const (
+	boundaryModulus = 32
+	minBlockLines   = 4
+	maxBlockLines   = 512
+	maxBlockBytes   = 64 * 1024
+)
+
+// sniffSize is the amount of content inspected to detect binary files
+const sniffSize = 8192
+
+// Limits bounds the work and output of a streamed diff. Zero values use
+// the defaults.
+type Limits struct {
+	MaxFileSize   int64 // Largest file tracked (default: 256MB)
+	MaxLines      int   // Diff lines produced (default: 2000)
+	MaxRegions    int   // Changed regions diffed (default: 50)
+	MaxRegionSize int64 // Bytes read from each version of a changed region (default: 1MB)
+}
+
+// withDefaults fills in zero limits
+func (l Limits) withDefaults() Limits {
+	if l.MaxFileSize <= 0 {
+		l.MaxFileSize = 256 * 1024 * 1024
+	}
+	if l.MaxLines <= 0 {
+		l.MaxLines = 2000
+	}
+	if l.MaxRegions <= 0 {
+		l.MaxRegions = 50
+	}
+	if l.MaxRegionSize <= 0 {
+		l.MaxRegionSize = 1024 * 1024
+	}
+	return l
+}
+
+// Tracker keeps snapshots of files too large to hold in memory: a copy on
+// disk plus an index of content blocks, so that a change is diffed by
+// reading only the blocks that differ
+type Tracker struct {
+	dir       string // Holds the snapshot copies
+	limits    Limits
+	algorithm diff.Algorithm // Matches blocks and the lines of changed regions ("": by language)
+	mu        sync.Mutex
+	files     map[string]*snapshot
+}
+
+// snapshot is the indexed state of a large file
+type snapshot struct {
+	spool  string // Copy of the content
+	size   int64
+	lines  int
+	hash   string // Hex SHA-256 of the content
+	binary bool
+	eol    string // Line ending style, see diff.EOLStyle
+	blocks []block
+}
+
+// block is a run of whole lines
+type block struct {
+	hash   uint64
+	offset int64
+	size   int64
+	line   int // Lines before the block
+	lines  int
+}
+
+// key identifies the block's content for alignment
+func (b block) key() string {
+	return fmt.Sprintf("%016x:%d", b.hash, b.size)
+}
+
+// NewTracker creates a tracker keeping its snapshots in a new directory
+// below dirs.Snapshots, named after the process so "diffwatch clean" spares
+// it while the process runs. Close removes it. Changes are diffed with alg
+// (see diff.Algorithm.For).
+func NewTracker(limits Limits, alg diff.Algorithm) (*Tracker, error) {
+	parent := dirs.Snapshots()
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		// Without a cache directory, e.g. without a home directory
+		parent = os.TempDir()
+	}
+	dir, err := os.MkdirTemp(parent, fmt.Sprintf("%d-", os.Getpid()))
+	if err != nil {
+		return nil, fmt.Errorf("creating snapshot directory: %w", err)
+	}
+
+	return &Tracker{
+		dir:       dir,
+		limits:    limits.withDefaults(),
+		algorithm: alg,
+		files:     make(map[string]*snapshot),
+	}, nil
+}
+
+// MaxFileSize returns the size of the largest file the tracker diffs
+func (t *Tracker) MaxFileSize() int64 {
+	return t.limits.MaxFileSize
+}
+
+// Tracks reports whether path has a snapshot. A nil tracker tracks
+// nothing.
+func (t *Tracker) Tracks(path string) bool {
+	if t == nil {
+		return false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, ok := t.files[path]
+	return ok
+}
+
+// Update snapshots the file at path and diffs it against the previous
+// snapshot. A missing file is reported as deleted if it was tracked.
+func (t *Tracker) Update(path string) (*diff.Result, error) {
+	t.mu.Lock()
+	old := t.files[path]
+	t.mu.Unlock()
+
+	cur, err := t.snapshot(path, old)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	if cur != nil {
+		t.files[path] = cur
+	} else {
+		delete(t.files, path)
+	}
+	t.mu.Unlock()
+
+	// An unchanged file keeps its snapshot
+	if old != nil && old != cur {
+		defer os.Remove(old.spool)
+	}
+
+	return t.diff(path, old, cur)
+}
+
+// Remove drops the snapshot of path, e.g. because it became small enough
+// to track in memory
+func (t *Tracker) Remove(path string) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if s, ok := t.files[path]; ok {
+		os.Remove(s.spool)
+		delete(t.files, path)
+	}
+}
+
+// Close removes all snapshots
+func (t *Tracker) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.files = make(map[string]*snapshot)
+	return os.RemoveAll(t.dir)
+}
+
+// snapshot copies the file at path into the snapshot directory, indexing
+// its blocks on the way. Files are memory mapped where possible, so their
+// content doesn't pass through the heap, and hashed before they are
+// copied: if the content is that of old, old is returned and nothing is
+// copied. Files that can't be mapped are streamed.
+func (t *Tracker) snapshot(path string, old *snapshot) (*snapshot, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	if info, err := in.Stat(); err == nil && info.Size() > 0 {
+		if data, err := mapFile(in, info.Size()); err == nil {
+			s, err := t.snapshotMapped(data, old)
+			unmapFile(data)
+			if err == nil {
+				return s, nil
+			}
+			if _, err := in.Seek(0, io.SeekStart); err != nil {
+				return nil, fmt.Errorf("snapshotting %s: %w", path, err)
+			}
+		}
+	}
+
+	out, err := os.CreateTemp(t.dir, "snapshot-*")
+	if err != nil {
+		return nil, fmt.Errorf("creating snapshot: %w", err)
+	}
+
+	s, err := index(in, out)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(out.Name())
+		return nil, fmt.Errorf("snapshotting %s: %w", path, err)
+	}
+
+	s.spool = out.Name()
+	return s, nil
+}
+
+// snapshotMapped indexes mapped content and copies it into the snapshot
+// directory, unless it is the content of old
+func (t *Tracker) snapshotMapped(data []byte, old *snapshot) (*snapshot, error) {
+	s, err := indexMapped(data)
+	if err != nil {
+		return nil, err
+	}
+	if old != nil && old.hash == s.hash {
+		return old, nil
+	}
+
+	out, err := os.CreateTemp(t.dir, "snapshot-*")
+	if err != nil {
+		return nil, fmt.Errorf("creating snapshot: %w", err)
+	}
+	// Shrinking files fail the write with EFAULT rather than faulting
+	_, err = out.Write(data)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(out.Name())
+		return nil, err
+	}
+
+	s.spool = out.Name()
+	return s, nil
+}
+
+// indexer splits content into blocks as it is fed
+type indexer struct {
+	s         *snapshot
+	full      hash.Hash
+	sample    []byte
+	blockHash hash.Hash64
+	lineHash  hash.Hash32
+	cur       block
+	lf, crlf  int
+	last      byte
+}
+
+// newIndexer creates an indexer for content from its start
+func newIndexer() *indexer {
+	return &indexer{
+		s:         &snapshot{},
+		full:      sha256.New(),
+		sample:    make([]byte, 0, sniffSize),
+		blockHash: fnv.New64a(),
+		lineHash:  fnv.New32a(),
+	}
+}
+
+// endBlock adds the current block, if it has content
+func (ix *indexer) endBlock() {
+	if ix.cur.size == 0 {
+		return
+	}
+	ix.cur.hash = ix.blockHash.Sum64()
+	ix.s.blocks = append(ix.s.blocks, ix.cur)
+	ix.blockHash.Reset()
+	ix.cur = block{offset: ix.s.size, line: ix.s.lines}
+}
+
+// add feeds the next chunk of content: a line with its newline, or part
+// of a line that continues in the next chunk
+func (ix *indexer) add(chunk []byte) {
+	if len(chunk) == 0 {
+		return
+	}
+	ix.full.Write(chunk)
+	ix.blockHash.Write(chunk)
+	ix.lineHash.Write(chunk)
+	if room := sniffSize - len(ix.sample); room > 0 {
+		ix.sample = append(ix.sample, chunk[:min(room, len(chunk))]...)
+	}
+	ix.s.size += int64(len(chunk))
+	ix.cur.size += int64(len(chunk))
+
+	if chunk[len(chunk)-1] == '\n' {
+		if len(chunk) > 1 && chunk[len(chunk)-2] == '\r' || len(chunk) == 1 && ix.last == '\r' {
+			ix.crlf++
+		} else {
+			ix.lf++
+		}
+
+		ix.s.lines++
+		ix.cur.lines++
+		boundary := ix.lineHash.Sum32()%boundaryModulus == 0 && ix.cur.lines >= minBlockLines
+		ix.lineHash.Reset()
+		if boundary || ix.cur.lines >= maxBlockLines || ix.cur.size >= maxBlockBytes {
+			ix.endBlock()
+		}
+	}
+	ix.last = chunk[len(chunk)-1]
+}
+
+// finish ends the last block and returns the snapshot, without spool
+func (ix *indexer) finish() *snapshot {
+	s := ix.s
+
+	// A last line without a final newline
+	if ix.cur.size > 0 && ix.last != '\n' {
+		s.lines++
+		ix.cur.lines++
+	}
+	ix.endBlock()
+
+	s.hash = hex.EncodeToString(ix.full.Sum(nil))
+	s.binary = diff.IsBinary(ix.sample)
+	switch {
+	case ix.lf > 0 && ix.crlf > 0:
+		s.eol = diff.StyleMixed
+	case ix.crlf > 0:
+		s.eol = diff.StyleCRLF
+	case ix.lf > 0:
+		s.eol = diff.StyleLF
+	}
+	return s
+}
+
+// index copies r to w and splits the content into blocks
+func index(r io.Reader, w io.Writer) (*snapshot, error) {
+	ix := newIndexer()
+	reader := bufio.NewReaderSize(r, 64*1024)
+	writer := bufio.NewWriterSize(w, 64*1024)
+
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if len(chunk) > 0 {
+			writer.Write(chunk)
+			ix.add(chunk)
+		}
+
+		if errors.Is(err, bufio.ErrBufferFull) {
+			// The line continues in the next chunk
+			continue
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		return nil, err
+	}
+	return ix.finish(), nil
+}
+
+// indexMapped splits mapped content into blocks like index. A file
+// truncated while it is read faults on the pages past its end; the fault
+// is returned as an error instead of crashing.
+func indexMapped(data []byte) (s *snapshot, err error) {
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("file shrank while read: %v", r)
+		}
+	}()
+
+	ix := newIndexer()
+	for len(data) > 0 {
+		end := bytes.IndexByte(data, '\n') + 1
+		if end == 0 {
+			end = len(data)
+		}
+		ix.add(data[:end])
+		data = data[end:]
+	}
+	return ix.finish(), nil
+}
+
+// diff compares two snapshots, either of which may be nil
+func (t *Tracker) diff(path string, old, cur *snapshot) (*diff.Result, error) {
+	result := &diff.Result{Path: path, Language: lang.Detect(path, nil), Streamed: true, Lines: []diff.DiffLine{}}
+
+	switch {
+	case old == nil && cur == nil:
+		return result, nil
+
+	case cur == nil:
+		result.HasDiff = true
+		result.IsDeleted = true
+		result.IsBinary = old.binary
+		result.OldEOL = old.eol
+		return result, t.leadingLines(result, old, diff.LineDeleted)
+
+	case old == nil:
+		result.HasDiff = true
+		result.IsNew = true
+		result.IsBinary = cur.binary
+		result.NewEOL = cur.eol
+		return result, t.leadingLines(result, cur, diff.LineAdded)
+	}
+
+	result.OldEOL, result.NewEOL = old.eol, cur.eol
+	if old.hash == cur.hash {
+		return result, nil
+	}
+
+	result.HasDiff = true
+	if old.binary || cur.binary {
+		result.IsBinary = true
+		return result, nil
+	}
+
+	return result, t.diffRegions(result, old, cur)
+}
+
+// leadingLines fills the diff of a created or deleted file with its first
+// lines, as many as the limits allow
+func (t *Tracker) leadingLines(result *diff.Result, s *snapshot, lineType diff.LineType) error {
+	if result.IsBinary {
+		return nil
+	}
+
+	var end int64
+	lines := 0
+	for _, b := range s.blocks {
+		if lines+b.lines > t.limits.MaxLines || end+b.size > t.limits.MaxRegionSize {
+			break
+		}
+		end += b.size
+		lines += b.lines
+	}
+
+	content, err := readRange(s.spool, 0, end)
+	if err != nil {
+		return err
+	}
+
+	if lineType == diff.LineAdded {
+		result.Lines = diff.Lines(nil, diff.SplitLines(content), 0, 0, t.algorithm.For(result.Language))
+	} else {
+		result.Lines = diff.Lines(diff.SplitLines(content), nil, 0, 0, t.algorithm.For(result.Language))
+	}
+
+	if rest := s.lines - lines; rest > 0 {
+		result.Lines = append(result.Lines, gapLine(rest))
+		result.Omitted = 1
+	}
+	return nil
+}
+
+// diffRegions aligns the blocks of both snapshots and diffs the lines of
+// the blocks that differ, within the limits
+func (t *Tracker) diffRegions(result *diff.Result, old, cur *snapshot) error {
+	oldKeys := make([]string, len(old.blocks))
+	for i, b := range old.blocks {
+		oldKeys[i] = b.key()
+	}
+	newKeys := make([]string, len(cur.blocks))
+	for i, b := range cur.blocks {
+		newKeys[i] = b.key()
+	}
+
+	regions := 0
+	oldLine := 0 // Old lines accounted for, shown or in gaps
+	for _, op := range diff.OpCodes(oldKeys, newKeys, t.algorithm.For(result.Language)) {
+		if op.Tag == 'e' {
+			continue
+		}
+
+		oldStart, oldEnd := span(old, op.I1, op.I2)
+		newStart, newEnd := span(cur, op.J1, op.J2)
+		firstOld := lineAt(old, op.I1)
+		firstNew := lineAt(cur, op.J1)
+
+		if regions >= t.limits.MaxRegions || len(result.Lines) >= t.limits.MaxLines ||
+			oldEnd-oldStart > t.limits.MaxRegionSize || newEnd-newStart > t.limits.MaxRegionSize {
+			result.Omitted++
+			continue
+		}
+
+		oldContent, err := readRange(old.spool, oldStart, oldEnd)
+		if err != nil {
+			return err
+		}
+		newContent, err := readRange(cur.spool, newStart, newEnd)
+		if err != nil {
+			return err
+		}
+
+		if firstOld > oldLine {
+			result.Lines = append(result.Lines, gapLine(firstOld-oldLine))
+		}
+		lines := diff.Lines(diff.SplitLines(oldContent), diff.SplitLines(newContent), firstOld, firstNew, t.algorithm.For(result.Language))
+		if room := t.limits.MaxLines - len(result.Lines); len(lines) > room {
+			lines = lines[:room]
+			result.Omitted++
+		}
+		result.Lines = append(result.Lines, lines...)
+		oldLine = lineAt(old, op.I2)
+		regions++
+	}
+
+	if oldLine < old.lines && len(result.Lines) > 0 {
+		result.Lines = append(result.Lines, gapLine(old.lines-oldLine))
+	}
+	return nil
+}
+
+// span returns the byte range of blocks [i, j), which is empty at the
+// position of block i for insertions
+func span(s *snapshot, i, j int) (start, end int64) {
+	if i < len(s.blocks) {
+		start = s.blocks[i].offset
+	} else {
+		start = s.size
+	}
+	end = start
+	if j > i {
+		last := s.blocks[j-1]
+		end = last.offset + last.size
+	}
+	return start, end
+}
+
+// lineAt returns the number of lines before block i
+func lineAt(s *snapshot, i int) int {
+	if i < len(s.blocks) {
+		return s.blocks[i].line
+	}
+	return s.lines
+}
+
+// gapLine stands for n unchanged lines that were not read
+func gapLine(n int) diff.DiffLine {
+	return diff.DiffLine{Type: diff.LineGap, Content: fmt.Sprintf("%d lines not shown", n)}
+}
+
+// readRange reads bytes [start, end) of the file at path
+func readRange(path string, start, end int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, end-start)
+	if _, err := f.ReadAt(buf, start); err != nil && !(err == io.EOF && len(buf) == 0) {
+		return nil, fmt.Errorf("reading snapshot: %w", err)
+	}
+	return buf, nil
+}
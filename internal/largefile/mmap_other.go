@@ -0,0 +1,18 @@
+//go:build !unix
+
+package largefile
+
+import (
+	"errors"
+	"os"
+)
+
+// mapFile fails: files are streamed on this platform
+func mapFile(f *os.File, size int64) ([]byte, error) {
+	return nil, errors.New("memory mapping not supported on this platform")
+}
+
+// unmapFile does nothing, mapFile never maps
+func unmapFile(data []byte) error {
+	return nil
+}
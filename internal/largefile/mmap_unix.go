@@ -0,0 +1,19 @@
+//go:build unix
+
+package largefile
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// mapFile maps the first size bytes of f into memory, read-only
+func mapFile(f *os.File, size int64) ([]byte, error) {
+	return unix.Mmap(int(f.Fd()), 0, int(size), unix.PROT_READ, unix.MAP_SHARED)
+}
+
+// unmapFile releases a mapping of mapFile
+func unmapFile(data []byte) error {
+	return unix.Munmap(data)
+}
@@ -0,0 +1,70 @@
+package match
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Glob reports whether name matches the glob pattern.
+// Patterns without a slash are matched against the base name only
+// (e.g. "*.sql"), patterns with a slash are matched against the whole
+// slash-separated path and may use "**" to match any number of directories
+// (e.g. "config/prod/**").
+func Glob(pattern, name string) bool {
+	// Compare composed forms, so decomposed (NFD) names match too
+	pattern = norm.NFC.String(filepath.ToSlash(pattern))
+	name = norm.NFC.String(filepath.ToSlash(name))
+
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(name))
+		return ok
+	}
+
+	pattern = strings.TrimPrefix(pattern, "./")
+	name = strings.TrimPrefix(name, "./")
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+// Any reports whether name matches any of the given patterns
+func Any(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if Glob(p, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSegments matches path segments, expanding "**" to zero or more segments
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// Collapse consecutive "**" segments
+			for len(pattern) > 0 && pattern[0] == "**" {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern = pattern[1:]
+		name = name[1:]
+	}
+	return len(name) == 0
+}
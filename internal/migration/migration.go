@@ -0,0 +1,155 @@
+package migration
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/deemkeen/diffwatch/internal/config"
+	"github.com/deemkeen/diffwatch/internal/diff"
+	"github.com/deemkeen/diffwatch/internal/match"
+)
+
+// Checker recognizes changes to database migrations that were already
+// applied: editing them doesn't change the databases they ran on, so the
+// schema silently drifts between environments
+type Checker struct {
+	root string
+	cfg  config.Migrations
+}
+
+// New checks the patterns of cfg and returns a checker for the migrations
+// under root
+func New(root string, cfg config.Migrations) (*Checker, error) {
+	for _, pattern := range cfg.Patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("migration pattern %q: %w", pattern, err)
+		}
+	}
+	if abs, err := filepath.Abs(root); err == nil {
+		root = abs
+	}
+	return &Checker{root: root, cfg: cfg}, nil
+}
+
+// Mark sets result.Dangerous if the file at relPath (relative to the watch
+// root) is an applied migration that was changed, removed or renamed
+func (c *Checker) Mark(relPath string, result *diff.Result) {
+	if c == nil || result == nil || !result.HasDiff || result.IsNew && result.RenamedFrom == "" {
+		return
+	}
+
+	dir, what := filepath.Dir(result.Path), "modifies"
+	switch {
+	case result.RenamedFrom != "":
+		rel, err := filepath.Rel(c.root, result.RenamedFrom)
+		if err != nil {
+			return
+		}
+		relPath, dir, what = rel, filepath.Dir(result.RenamedFrom), "renames"
+	case result.IsDeleted:
+		what = "removes"
+	}
+
+	if !match.Any(c.cfg.Patterns, relPath) {
+		return
+	}
+	if why := c.applied(relPath, dir); why != "" {
+		result.Dangerous = fmt.Sprintf("%s an applied migration (%s)", what, why)
+	}
+}
+
+// applied returns why the migration at relPath, in directory dir, counts as
+// applied, or "" if it doesn't. Migrations listed in the applied file are,
+// otherwise migrations followed by a newer version in their directory:
+// only the newest one may still be unapplied.
+func (c *Checker) applied(relPath, dir string) string {
+	name := filepath.Base(relPath)
+	if repeatable(name) {
+		return ""
+	}
+
+	if c.cfg.Applied != "" {
+		list, err := os.ReadFile(filepath.Join(c.root, c.cfg.Applied))
+		if err == nil {
+			if listed(list, name) {
+				return "listed in " + c.cfg.Applied
+			}
+			return ""
+		}
+	}
+
+	v := version(name)
+	if v == "" {
+		return ""
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	for _, e := range entries {
+		other := e.Name()
+		if e.IsDir() || repeatable(other) || !match.Any(c.cfg.Patterns, filepath.Join(filepath.Dir(relPath), other)) {
+			continue
+		}
+		if w := version(other); w != "" && newer(w, v) {
+			return "followed by " + other
+		}
+	}
+	return ""
+}
+
+// listed reports whether the applied list, a name per line, names the
+// migration: by file name, name without extension or version. Blank lines
+// and lines starting with # are skipped.
+func listed(list []byte, name string) bool {
+	v := version(name)
+	s := bufio.NewScanner(bytes.NewReader(list))
+	for s.Scan() {
+		entry := strings.TrimSpace(s.Text())
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		if entry == name || entry == strings.TrimSuffix(name, filepath.Ext(name)) || v != "" && version(entry) == v && strings.Trim(entry, "0123456789Vv") == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// version returns the version a migration name starts with, without
+// leading zeros: "20240101120000" for "20240101120000_add_users.sql", "3"
+// for Flyway's "V3__add_users.sql" or "003_add_users.up.sql". Empty if the
+// name doesn't start with one.
+func version(name string) string {
+	name = strings.TrimPrefix(strings.TrimPrefix(name, "V"), "v")
+	end := strings.IndexFunc(name, func(r rune) bool { return r < '0' || r > '9' })
+	if end < 0 {
+		end = len(name)
+	}
+	if end == 0 {
+		return ""
+	}
+	if v := strings.TrimLeft(name[:end], "0"); v != "" {
+		return v
+	}
+	return "0"
+}
+
+// newer reports whether version a is greater than version b
+func newer(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) > len(b)
+	}
+	return a > b
+}
+
+// repeatable reports whether a migration is meant to be changed and
+// rerun, like Flyway's R__ migrations
+func repeatable(name string) bool {
+	return strings.HasPrefix(name, "R__")
+}
@@ -0,0 +1,155 @@
+package mirror
+
+import (
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/deemkeen/diffwatch/internal/state"
+	"github.com/deemkeen/diffwatch/internal/watcher"
+)
+
+// Files keeps the states of files a source reads itself, because the UI
+// can't read them locally (a container, a cluster), and delivers their
+// changes as events. The source reports the state of a file with its
+// change; the UI claims it with CurrentState and PriorState.
+type Files struct {
+	ops    []string
+	log    *slog.Logger
+	events chan watcher.Event
+	done   chan struct{}
+
+	sendMu sync.Mutex // Keeps events in sequence order
+	seq    uint64     // Sequence number of the last event
+
+	mu        sync.Mutex
+	known     map[string]*state.FileState // Latest content by path
+	baselines map[string]*state.FileState // First content by path
+	priors    map[string]*state.FileState // State before the first unclaimed event by path
+	current   map[string]*state.FileState // State after the latest event by path
+}
+
+// New creates the file states of a source reporting the operations in ops
+// (see watcher.ParseOps; empty reports all)
+func New(ops []string, log *slog.Logger) *Files {
+	if log == nil {
+		log = slog.New(slog.DiscardHandler)
+	}
+	return &Files{
+		ops:       ops,
+		log:       log,
+		events:    make(chan watcher.Event, 100),
+		done:      make(chan struct{}),
+		known:     make(map[string]*state.FileState),
+		baselines: make(map[string]*state.FileState),
+		priors:    make(map[string]*state.FileState),
+		current:   make(map[string]*state.FileState),
+	}
+}
+
+// Seed records the content of a file seen before any change, as its
+// baseline
+func (f *Files) Seed(s *state.FileState) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.known[s.Path] = s
+	if _, ok := f.baselines[s.Path]; !ok {
+		f.baselines[s.Path] = s
+	}
+}
+
+// Update records the state of a file after a change and reports the
+// change unless its operation is filtered out. A nil state means the
+// content is unknown, e.g. too large. Blocks until the event is taken or
+// the files are stopped.
+func (f *Files) Update(path, op string, next *state.FileState) {
+	f.sendMu.Lock()
+	defer f.sendMu.Unlock()
+
+	f.mu.Lock()
+	prev := f.known[path]
+	if next != nil && next.Exists {
+		f.known[path] = next
+		if _, ok := f.baselines[path]; !ok {
+			f.baselines[path] = next
+		}
+	} else {
+		delete(f.known, path)
+	}
+
+	// The UI only reads the state of reported events
+	report := len(f.ops) == 0 || slices.Contains(f.ops, op)
+	if report {
+		if _, ok := f.priors[path]; !ok && prev != nil {
+			f.priors[path] = prev
+		}
+		if next != nil {
+			f.current[path] = next
+		} else {
+			delete(f.current, path)
+		}
+	}
+	f.mu.Unlock()
+
+	if !report {
+		return
+	}
+	f.seq++
+	event := watcher.Event{Seq: f.seq, Path: path, Op: op, Timestamp: time.Now()}
+	select {
+	case f.events <- event:
+		f.log.Debug("event sent", "path", path, "op", op, "seq", event.Seq)
+	case <-f.done:
+	}
+}
+
+// Events returns the channel of file events
+func (f *Files) Events() <-chan watcher.Event {
+	return f.events
+}
+
+// PriorState returns the baseline and the state before the first
+// unclaimed event of path, and forgets the latter
+func (f *Files) PriorState(path string) (baseline, previous *state.FileState, ok bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	previous, ok = f.priors[path]
+	delete(f.priors, path)
+	return f.baselines[path], previous, ok
+}
+
+// CurrentState returns the state of path after its latest event. ok is
+// false if the content is unknown, e.g. for files too large to diff.
+func (f *Files) CurrentState(path string) (*state.FileState, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	s, ok := f.current[path]
+	delete(f.current, path)
+	return s, ok
+}
+
+// Done returns a channel closed by Stop, for the source's goroutines
+func (f *Files) Done() <-chan struct{} {
+	return f.done
+}
+
+// Stop unblocks pending updates and signals the source's goroutines to
+// exit. Returns false if already stopped.
+func (f *Files) Stop() bool {
+	select {
+	case <-f.done:
+		return false
+	default:
+	}
+	close(f.done)
+	return true
+}
+
+// Close closes the event channel once the source's goroutines have exited
+func (f *Files) Close() {
+	close(f.events)
+}
@@ -0,0 +1,77 @@
+package mirror
+
+import (
+	"slices"
+
+	"github.com/deemkeen/diffwatch/internal/state"
+)
+
+// Source tells Scan how to compare and read the files of a source that
+// lists them as entries of type T, e.g. their sizes and modification times
+type Source[T any] struct {
+	Path    func(name string) string                                            // Path a listed file's events are reported at
+	Changed func(before, now T) bool                                            // Whether a file changed between two listings
+	Read    func(name string, entry T) (s *state.FileState, ok bool, err error) // Content of a file; ok is false if unknown, e.g. too large
+}
+
+// Scan compares a new listing of files, by the names the source reads them
+// with, with the previous one and updates f with the created, changed and
+// removed files in name order. A file that fails to read, likely removed
+// since it was listed, keeps its previous entry, so a change that couldn't
+// be read is reported once it can. Returns the listing to compare the next
+// one with, or nil if f was stopped while reading.
+func Scan[T any](f *Files, old, listing map[string]T, src Source[T]) map[string]T {
+	var names []string
+	for name := range listing {
+		names = append(names, name)
+	}
+	for name := range old {
+		if _, ok := listing[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		now, exists := listing[name]
+		before, existed := old[name]
+
+		var op string
+		switch {
+		case exists && !existed:
+			op = "create"
+		case !exists:
+			op = "remove"
+		case src.Changed(before, now):
+			op = "write"
+		default:
+			continue
+		}
+
+		next := &state.FileState{Path: src.Path(name)}
+		if exists {
+			s, ok, err := src.Read(name, now)
+			if err != nil {
+				select {
+				case <-f.Done():
+					return nil
+				default:
+				}
+				f.log.Warn("reading file failed", "path", src.Path(name), "error", err)
+				if existed {
+					listing[name] = before
+				} else {
+					delete(listing, name)
+				}
+				continue
+			}
+			if ok {
+				next = s
+			} else {
+				next = nil
+			}
+		}
+		f.Update(src.Path(name), op, next)
+	}
+	return listing
+}
@@ -0,0 +1,67 @@
+package mirror
+
+import (
+	"errors"
+	"maps"
+	"testing"
+
+	"github.com/deemkeen/diffwatch/internal/state"
+)
+
+// source reads files as their names, except the ones in failing
+func source(failing ...string) Source[int] {
+	return Source[int]{
+		Path:    func(name string) string { return "box:" + name },
+		Changed: func(before, now int) bool { return before != now },
+		Read: func(name string, now int) (*state.FileState, bool, error) {
+			for _, f := range failing {
+				if name == f {
+					return nil, false, errors.New("gone")
+				}
+			}
+			content := []byte(name)
+			return &state.FileState{Path: "box:" + name, Content: content, Exists: true, Hash: state.HashContent(content)}, true, nil
+		},
+	}
+}
+
+func TestScan(t *testing.T) {
+	f := New(nil, nil)
+	old := map[string]int{"a": 1, "b": 1, "c": 1, "f": 1}
+	listing := map[string]int{"a": 1, "b": 2, "d": 1, "e": 1, "f": 2}
+
+	// e and f fail to read: e is left for the next listing to create, f
+	// keeps its old entry to be written then
+	next := Scan(f, old, listing, source("e", "f"))
+	if want := map[string]int{"a": 1, "b": 2, "d": 1, "f": 1}; !maps.Equal(next, want) {
+		t.Errorf("listing %v, want %v", next, want)
+	}
+
+	want := []struct{ path, op string }{{"box:b", "write"}, {"box:c", "remove"}, {"box:d", "create"}}
+	for _, w := range want {
+		event := <-f.Events()
+		if event.Path != w.path || event.Op != w.op {
+			t.Errorf("event %s %s, want %s %s", event.Op, event.Path, w.op, w.path)
+		}
+	}
+	select {
+	case event := <-f.Events():
+		t.Errorf("unexpected event %s %s", event.Op, event.Path)
+	default:
+	}
+
+	if s, ok := f.CurrentState("box:d"); !ok || string(s.Content) != "d" {
+		t.Errorf("state of box:d %+v, want its content", s)
+	}
+	if s, ok := f.CurrentState("box:c"); !ok || s.Exists {
+		t.Errorf("state of box:c %+v, want a removed file", s)
+	}
+}
+
+func TestScanStopped(t *testing.T) {
+	f := New(nil, nil)
+	f.Stop()
+	if next := Scan(f, nil, map[string]int{"a": 1}, source("a")); next != nil {
+		t.Errorf("listing %v, want nil once stopped", next)
+	}
+}
@@ -0,0 +1,74 @@
+package notify
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Bell rings the terminal bell
+func Bell() {
+	fmt.Fprint(os.Stdout, "\a")
+}
+
+// Desktop sends a desktop notification using the platform's native tool.
+// The notification is sent asynchronously; only failures to start the
+// notifier are reported.
+func Desktop(title, message string) error {
+	var cmd *exec.Cmd
+
+	switch runtime.GOOS {
+	case "linux", "freebsd", "openbsd", "netbsd":
+		cmd = exec.Command("notify-send", title, message)
+	case "darwin":
+		script := fmt.Sprintf("display notification %q with title %q", message, title)
+		cmd = exec.Command("osascript", "-e", script)
+	default:
+		return fmt.Errorf("desktop notifications not supported on %s", runtime.GOOS)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("starting notifier: %w", err)
+	}
+
+	// Reap the process in background
+	go cmd.Wait()
+
+	return nil
+}
+
+// Play plays a sound file with the platform's audio player, like Desktop
+// without waiting for it to finish
+func Play(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("sound file: %w", err)
+	}
+
+	var cmd *exec.Cmd
+
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("afplay", path)
+	case "windows":
+		script := fmt.Sprintf("(New-Object Media.SoundPlayer '%s').PlaySync()", strings.ReplaceAll(path, "'", "''"))
+		cmd = exec.Command("powershell", "-NoProfile", "-Command", script)
+	default:
+		// PulseAudio (or PipeWire) first, plain ALSA otherwise
+		player := "paplay"
+		if _, err := exec.LookPath(player); err != nil {
+			player = "aplay"
+		}
+		cmd = exec.Command(player, path)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("starting sound player: %w", err)
+	}
+
+	// Reap the process in background
+	go cmd.Wait()
+
+	return nil
+}
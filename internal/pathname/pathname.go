@@ -0,0 +1,128 @@
+package pathname
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/x/ansi"
+	"golang.org/x/text/unicode/norm"
+)
+
+// resolved caches the normalized form of paths that are not in NFC, so
+// that removed files keep the key they had while they existed
+var resolved sync.Map
+
+// Normalize returns the form of path used to identify a file. Paths that
+// are not in Unicode NFC (e.g. decomposed NFD names from macOS or FUSE and
+// SFTP mounts) are converted to NFC if the NFC path names the same file,
+// so both spellings of a name map to one file on normalization-insensitive
+// filesystems. On filesystems where they are different files (most Linux
+// filesystems) path is returned unchanged.
+func Normalize(path string) string {
+	if norm.NFC.IsNormalString(path) {
+		return path
+	}
+	if key, ok := resolved.Load(path); ok {
+		return key.(string)
+	}
+
+	nfc := norm.NFC.String(path)
+	info, err := os.Lstat(path)
+	if err != nil {
+		// Gone before it was seen: nothing to compare with
+		return path
+	}
+	key := path
+	if nfcInfo, err := os.Lstat(nfc); err == nil && os.SameFile(info, nfcInfo) {
+		key = nfc
+	}
+	resolved.Store(path, key)
+	return key
+}
+
+// Display returns path in a form that is safe to show in a terminal: NFC
+// normalized, with bytes that are not valid UTF-8 escaped as \xNN and
+// non-printable characters (including unusual whitespace) as escaped
+// codepoints. Plain spaces are kept.
+func Display(path string) string {
+	if isPlain(path) {
+		return path
+	}
+
+	var b strings.Builder
+	for len(path) > 0 {
+		r, size := utf8.DecodeRuneInString(path)
+		switch {
+		case r == utf8.RuneError && size == 1:
+			fmt.Fprintf(&b, `\x%02x`, path[0])
+		case !unicode.IsPrint(r):
+			b.WriteString(EscapeRune(r))
+		default:
+			b.WriteRune(r)
+		}
+		path = path[size:]
+	}
+	return norm.NFC.String(b.String())
+}
+
+// isPlain reports whether path is printable ASCII
+func isPlain(path string) bool {
+	for i := 0; i < len(path); i++ {
+		if path[i] < ' ' || path[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// EscapeRune formats a non-printable character as an escaped codepoint,
+// as Display shows it in paths: \x00, \u200b or \U000e0001
+func EscapeRune(r rune) string {
+	switch {
+	case r < 0x100:
+		return fmt.Sprintf(`\x%02x`, r)
+	case r < 0x10000:
+		return fmt.Sprintf(`\u%04x`, r)
+	default:
+		return fmt.Sprintf(`\U%08x`, r)
+	}
+}
+
+// Truncate shortens a displayed path to at most width terminal cells by
+// replacing the middle of its directory with "…", so the file name stays
+// visible. A file name too long by itself keeps its end, with the
+// extension. Paths that fit, and widths below 1, leave path unchanged.
+func Truncate(path string, width int) string {
+	return TruncateWith(path, width, "…")
+}
+
+// TruncateWith is like Truncate, with ellipsis standing for the part
+// left out, e.g. "..." on terminals without Unicode
+func TruncateWith(path string, width int, ellipsis string) string {
+	if width < 1 || ansi.StringWidth(path) <= width {
+		return path
+	}
+	ew := ansi.StringWidth(ellipsis)
+
+	dir, base := "", path
+	if i := strings.LastIndexAny(path, `/`+string(filepath.Separator)); i >= 0 {
+		dir, base = path[:i+1], path[i+1:]
+	}
+	baseWidth := ansi.StringWidth(base)
+	if baseWidth+ew >= width {
+		return ellipsis + ansi.TruncateLeft(base, baseWidth-max(width-ew, 0), "")
+	}
+
+	// Keep the start of the directory, e.g. the root, and its end, the
+	// parent of the file
+	keep := width - baseWidth - ew
+	head := keep / 2
+	tail := keep - head
+	dirWidth := ansi.StringWidth(dir)
+	return ansi.Truncate(dir, head, "") + ellipsis + ansi.TruncateLeft(dir, dirWidth-tail, "") + base
+}
@@ -0,0 +1,218 @@
+// Package pipeline turns file events into diffs. The UI and the daemon
+// both process events through it, so a change shown live and the same
+// change recorded by a daemon are diffed alike.
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/deemkeen/diffwatch/internal/diff"
+	"github.com/deemkeen/diffwatch/internal/lang"
+	"github.com/deemkeen/diffwatch/internal/largefile"
+	"github.com/deemkeen/diffwatch/internal/state"
+	"github.com/deemkeen/diffwatch/internal/watcher"
+)
+
+// MaxDiffSize is the largest file size kept in memory for diffing. Larger
+// files are snapshotted on disk and only their changed regions are diffed.
+const MaxDiffSize = 1 * 1024 * 1024 // 1MB
+
+// Stage is a step of processing an event, see Options.Measure
+type Stage int
+
+const (
+	Read Stage = iota // Reading the file
+	Diff              // Computing the diff; large files are read while diffed
+)
+
+// Options configures a Processor
+type Options struct {
+	LargeFiles *largefile.Tracker // Diffs files over MaxDiffSize from snapshots (nil: they aren't diffed)
+	Logger     *slog.Logger       // Receives processing details (nil: discard)
+
+	Seed    func(path string)                  // Called before a file is read, e.g. to take its prior state from a daemon (nil: none)
+	Measure func(stage Stage, start time.Time) // Called at the end of each stage with its start (nil: not measured)
+}
+
+// Processor updates the state of the file of each event and diffs it
+// against the previous state
+type Processor struct {
+	states *state.Manager
+	engine *diff.Engine
+	opts   Options
+	log    *slog.Logger
+}
+
+// New creates a processor tracking file contents in states and diffing
+// them with engine
+func New(states *state.Manager, engine *diff.Engine, opts Options) *Processor {
+	log := opts.Logger
+	if log == nil {
+		log = slog.New(slog.DiscardHandler)
+	}
+	return &Processor{states: states, engine: engine, opts: opts, log: log}
+}
+
+// Prescan snapshots the files walk produces, as many at once as there are
+// CPUs, so that the first change to any of them is diffed against its
+// content now. Files too large to diff are skipped. Errors reading single
+// files are ignored, errors of walk returned.
+func (p *Processor) Prescan(walk func(fn func(path string) error) error, progress *state.Progress) error {
+	return p.states.Prescan(walk, runtime.NumCPU(), MaxDiffSize, progress)
+}
+
+// Canonical moves an event of a file reachable by several watched paths,
+// through hardlinks or bind mounts, to the path tracking the file, so a
+// write shows up once, under it. Returns the path the event happened at
+// if it was moved, otherwise "".
+func (p *Processor) Canonical(event *watcher.Event) string {
+	if event.Op == "remove" {
+		return ""
+	}
+	owner := p.states.Canonical(event.Path)
+	if owner == event.Path {
+		return ""
+	}
+	alias := event.Path
+	event.Path = owner
+	return alias
+}
+
+// Process updates the state of the file of an event and diffs it against
+// the previous state. A file that reappeared under a new name makes the
+// event a rename. Returns nil for directories, files too large to diff get
+// a result marked TooLarge along with an error saying so, and locked files
+// one marked Locked: their event is still worth reporting.
+func (p *Processor) Process(event *watcher.Event) (*diff.Result, error) {
+	result, err := p.process(*event)
+	if result != nil && result.RenamedFrom != "" {
+		event.Op = "rename"
+		p.log.Info("rename detected", "from", result.RenamedFrom, "to", event.Path)
+	}
+	return result, err
+}
+
+// process diffs the file of an event, see Process
+func (p *Processor) process(event watcher.Event) (*diff.Result, error) {
+	// For remove events, we can't stat the file (it's gone)
+	// but we can still process it to show deletion diff
+	if event.Op == "remove" {
+		// A deleted directory takes the state of its files along, so trees
+		// rebuilt over and over (dist/) don't accumulate it
+		if n := p.states.RemoveTree(event.Path); n > 0 {
+			p.log.Debug("directory removed, files forgotten", "path", event.Path, "files", n)
+			return nil, nil
+		}
+		return p.update(event.Path)
+	}
+
+	info, err := state.Stat(event.Path)
+	if err != nil {
+		// A file renamed away is gone from this path, like a removal
+		if os.IsNotExist(err) && event.Op == "rename" {
+			return p.update(event.Path)
+		}
+
+		// File might have been deleted or is inaccessible
+		p.log.Warn("stat failed", "path", event.Path, "error", err)
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("file not found: %s", event.Path)
+		}
+		return nil, err
+	}
+
+	if info.IsDir() {
+		return nil, nil
+	}
+
+	if info.Size() > MaxDiffSize {
+		// Diff large files from their snapshots on disk
+		if p.opts.LargeFiles != nil && info.Size() <= p.opts.LargeFiles.MaxFileSize() {
+			p.states.Remove(event.Path)
+			return p.updateLarge(event.Path)
+		}
+
+		// Skip files too large even for that
+		p.log.Info("file too large for diff", "path", event.Path, "size", info.Size())
+		return &diff.Result{
+			Path:     event.Path,
+			Language: lang.Detect(event.Path, nil),
+			HasDiff:  true,
+			TooLarge: true,
+			Lines:    []diff.DiffLine{},
+		}, fmt.Errorf("file too large for diff (%d bytes, max %d bytes)",
+			info.Size(), MaxDiffSize)
+	}
+
+	p.opts.LargeFiles.Remove(event.Path)
+	return p.updateSmall(event.Path)
+}
+
+// update diffs a file that may be gone, from its snapshot if it was large
+func (p *Processor) update(path string) (*diff.Result, error) {
+	if p.opts.LargeFiles.Tracks(path) {
+		return p.updateLarge(path)
+	}
+	return p.updateSmall(path)
+}
+
+// updateLarge snapshots a large file and diffs its changed regions
+func (p *Processor) updateLarge(path string) (*diff.Result, error) {
+	// Reading and diffing happen in one pass, timed as the diff
+	defer p.measure(Diff, time.Now())
+
+	result, err := p.opts.LargeFiles.Update(path)
+	if err != nil {
+		p.log.Warn("diffing large file failed", "path", path, "error", err)
+		return nil, err
+	}
+	return result, nil
+}
+
+// updateSmall updates the state of a file kept in memory and diffs it
+// against the previous state
+func (p *Processor) updateSmall(path string) (*diff.Result, error) {
+	if p.opts.Seed != nil {
+		p.opts.Seed(path)
+	}
+
+	start := time.Now()
+	oldState, newState, err := p.states.Update(path)
+	p.measure(Read, start)
+	if errors.Is(err, state.ErrLocked) {
+		// Keep the event; the diff shows on the next change once readable
+		p.log.Warn("file locked", "path", path, "error", err)
+		return &diff.Result{
+			Path:     path,
+			Language: lang.Detect(path, nil),
+			HasDiff:  true,
+			Locked:   true,
+			Lines:    []diff.DiffLine{},
+		}, nil
+	}
+	if err != nil {
+		p.log.Warn("reading file failed", "path", path, "error", err)
+		return nil, err
+	}
+
+	start = time.Now()
+	result, err := p.engine.Compute(oldState, newState)
+	p.measure(Diff, start)
+	if err != nil {
+		p.log.Error("computing diff failed", "path", path, "error", err)
+		return nil, err
+	}
+	return result, nil
+}
+
+// measure reports the duration of a stage that began at start
+func (p *Processor) measure(stage Stage, start time.Time) {
+	if p.opts.Measure != nil {
+		p.opts.Measure(stage, start)
+	}
+}
@@ -0,0 +1,171 @@
+package pipeline
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/deemkeen/diffwatch/internal/diff"
+	"github.com/deemkeen/diffwatch/internal/largefile"
+	"github.com/deemkeen/diffwatch/internal/state"
+	"github.com/deemkeen/diffwatch/internal/watcher"
+)
+
+// newProcessor returns a processor for files under a new directory, and
+// that directory
+func newProcessor(t *testing.T, opts Options) (*Processor, string) {
+	t.Helper()
+	dir := t.TempDir()
+	return New(state.New(), diff.New(dir, ""), opts), dir
+}
+
+// write creates or replaces the file name under dir
+func write(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// process processes an event, failing the test on errors
+func process(t *testing.T, p *Processor, event *watcher.Event) *diff.Result {
+	t.Helper()
+	result, err := p.Process(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestProcessWrites(t *testing.T) {
+	p, dir := newProcessor(t, Options{})
+	path := write(t, dir, "a.txt", "one\n")
+
+	result := process(t, p, &watcher.Event{Path: path, Op: "create"})
+	if result == nil || !result.IsNew {
+		t.Fatalf("first read: got %+v, want a new file", result)
+	}
+
+	write(t, dir, "a.txt", "one\ntwo\n")
+	result = process(t, p, &watcher.Event{Path: path, Op: "write"})
+	if added, deleted := result.Stats(); added != 1 || deleted != 0 {
+		t.Errorf("stats %d %d, want 1 0", added, deleted)
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	result = process(t, p, &watcher.Event{Path: path, Op: "remove"})
+	if !result.IsDeleted {
+		t.Errorf("remove: got %+v, want a deleted file", result)
+	}
+}
+
+func TestProcessRename(t *testing.T) {
+	p, dir := newProcessor(t, Options{})
+	from := write(t, dir, "old.txt", "content\n")
+	process(t, p, &watcher.Event{Path: from, Op: "create"})
+
+	to := filepath.Join(dir, "new.txt")
+	if err := os.Rename(from, to); err != nil {
+		t.Fatal(err)
+	}
+	process(t, p, &watcher.Event{Path: from, Op: "rename"})
+	event := &watcher.Event{Path: to, Op: "create"}
+	result := process(t, p, event)
+	if result.RenamedFrom != from || event.Op != "rename" {
+		t.Errorf("renamed from %q as %q, want from %q as rename", result.RenamedFrom, event.Op, from)
+	}
+}
+
+func TestProcessDirectory(t *testing.T) {
+	p, dir := newProcessor(t, Options{})
+	if result := process(t, p, &watcher.Event{Path: dir, Op: "create"}); result != nil {
+		t.Errorf("got %+v, want nil", result)
+	}
+}
+
+func TestProcessTooLarge(t *testing.T) {
+	p, dir := newProcessor(t, Options{})
+	path := write(t, dir, "big.log", strings.Repeat("x", MaxDiffSize+1))
+
+	result, err := p.Process(&watcher.Event{Path: path, Op: "create"})
+	if err == nil || !strings.Contains(err.Error(), "file too large") {
+		t.Errorf("error %v, want file too large", err)
+	}
+	if result == nil || !result.TooLarge || result.Path != path {
+		t.Errorf("got %+v, want a placeholder marked too large", result)
+	}
+}
+
+func TestProcessLargeFile(t *testing.T) {
+	// Snapshots go to the cache directory
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	tracker, err := largefile.NewTracker(largefile.Limits{}, "")
+	if err != nil {
+		t.Skip("large file diffs unavailable:", err)
+	}
+	defer tracker.Close()
+	p, dir := newProcessor(t, Options{LargeFiles: tracker})
+
+	line := strings.Repeat("x", 99) + "\n"
+	content := strings.Repeat(line, MaxDiffSize/len(line)+1)
+	path := write(t, dir, "big.log", content)
+	process(t, p, &watcher.Event{Path: path, Op: "create"})
+
+	write(t, dir, "big.log", content+"appended\n")
+	result := process(t, p, &watcher.Event{Path: path, Op: "write"})
+	if result == nil || result.TooLarge {
+		t.Fatalf("got %+v, want a diff", result)
+	}
+	if added, _ := result.Stats(); added != 1 {
+		t.Errorf("%d lines added, want 1", added)
+	}
+}
+
+func TestCanonical(t *testing.T) {
+	p, dir := newProcessor(t, Options{})
+	path := write(t, dir, "a.txt", "one\n")
+	link := filepath.Join(dir, "link.txt")
+	if err := os.Link(path, link); err != nil {
+		t.Skip("hardlinks unsupported:", err)
+	}
+	process(t, p, &watcher.Event{Path: path, Op: "create"})
+
+	event := &watcher.Event{Path: link, Op: "write"}
+	if alias := p.Canonical(event); alias != link || event.Path != path {
+		t.Errorf("alias %q, path %q, want %q, %q", alias, event.Path, link, path)
+	}
+
+	event = &watcher.Event{Path: link, Op: "remove"}
+	if alias := p.Canonical(event); alias != "" || event.Path != link {
+		t.Errorf("remove: alias %q, path %q, want the event unchanged", alias, event.Path)
+	}
+}
+
+func TestPrescan(t *testing.T) {
+	p, dir := newProcessor(t, Options{})
+	path := write(t, dir, "a.txt", "one\n")
+
+	progress := &state.Progress{}
+	walk := func(fn func(path string) error) error { return fn(path) }
+	if err := p.Prescan(walk, progress); err != nil {
+		t.Fatal(err)
+	}
+	if n := progress.Scanned.Load(); n != 1 {
+		t.Errorf("%d files scanned, want 1", n)
+	}
+
+	// The first change is diffed against the prescanned content
+	write(t, dir, "a.txt", "one\ntwo\n")
+	result := process(t, p, &watcher.Event{Path: path, Op: "write"})
+	if result.IsNew {
+		t.Fatal("prescanned file diffed as new")
+	}
+	if added, deleted := result.Stats(); added != 1 || deleted != 0 {
+		t.Errorf("stats %d %d, want 1 0", added, deleted)
+	}
+}
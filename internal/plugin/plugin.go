@@ -0,0 +1,215 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/deemkeen/diffwatch/internal/config"
+	"github.com/deemkeen/diffwatch/internal/match"
+)
+
+// Version is the protocol version sent to plugins in every request
+const Version = 1
+
+// DefaultTimeout bounds a plugin run without a configured timeout
+const DefaultTimeout = 10 * time.Second
+
+// Verdicts a plugin can return
+const (
+	Pass  = "pass"
+	Warn  = "warn"
+	Fail  = "fail"
+	Error = "error" // The plugin itself failed: crashed, timed out or wrote invalid output
+)
+
+// Request is the change a plugin reads from its stdin as JSON
+type Request struct {
+	Version  int     `json:"version"`
+	Root     string  `json:"root"`     // Watch root, also the plugin's working directory
+	Path     string  `json:"path"`     // Changed file, relative to Root
+	Op       string  `json:"op"`       // create, write, remove, rename or chmod
+	Language string  `json:"language"` // Detected language ID, empty if unknown
+	Old      *string `json:"old"`      // Previous content, null if the file didn't exist or is binary
+	New      *string `json:"new"`      // Current content, null if the file was deleted or is binary
+	Binary   bool    `json:"binary"`   // Contents are binary and left out
+	Patch    string  `json:"patch"`    // Unified diff of the change
+}
+
+// Report is what a plugin writes to its stdout as JSON
+type Report struct {
+	Plugin      string       `json:"-"`           // Name of the plugin, filled in by Run
+	Verdict     string       `json:"verdict"`     // Pass, Warn or Fail (empty: Pass)
+	Message     string       `json:"message"`     // Summary shown with the verdict
+	Annotations []Annotation `json:"annotations"` // Findings in the new content
+}
+
+// Annotation is a finding of a plugin
+type Annotation struct {
+	Line    int    `json:"line"`    // Line of the new content, 0 for the whole file
+	Message string `json:"message"` // Shown next to the line
+}
+
+// plugin is a configured plugin
+type plugin struct {
+	name     string
+	command  []string
+	pattern  string
+	language string
+	timeout  time.Duration
+}
+
+// Runner runs the configured plugins on changes
+type Runner struct {
+	plugins []plugin
+}
+
+// New checks the configured plugins
+func New(plugins []config.Plugin) (*Runner, error) {
+	r := &Runner{}
+	for i, p := range plugins {
+		if len(p.Command) == 0 || p.Command[0] == "" {
+			return nil, fmt.Errorf("plugin %d: no command", i+1)
+		}
+
+		compiled := plugin{
+			name:     p.Name,
+			command:  p.Command,
+			pattern:  p.Pattern,
+			language: p.Language,
+			timeout:  DefaultTimeout,
+		}
+		if compiled.name == "" {
+			compiled.name = filepath.Base(p.Command[0])
+		}
+		if p.Timeout != "" {
+			d, err := time.ParseDuration(p.Timeout)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("plugin %s: invalid timeout %q", compiled.name, p.Timeout)
+			}
+			compiled.timeout = d
+		}
+		r.plugins = append(r.plugins, compiled)
+	}
+
+	return r, nil
+}
+
+// applies reports whether the plugin handles changes of relPath in language
+func (p *plugin) applies(relPath, language string) bool {
+	return (p.pattern == "" || match.Glob(p.pattern, relPath)) &&
+		(p.language == "" || p.language == language)
+}
+
+// Applies reports whether any plugin handles changes of relPath in language
+func (r *Runner) Applies(relPath, language string) bool {
+	if r == nil {
+		return false
+	}
+	for i := range r.plugins {
+		if r.plugins[i].applies(relPath, language) {
+			return true
+		}
+	}
+	return false
+}
+
+// Run runs the plugins handling the change in parallel and returns their
+// reports in configuration order. A plugin that fails to deliver a report
+// gets one with the Error verdict.
+func (r *Runner) Run(ctx context.Context, req Request) []Report {
+	if r == nil {
+		return nil
+	}
+	req.Version = Version
+
+	input, err := json.Marshal(req)
+	if err != nil {
+		return []Report{{Plugin: "diffwatch", Verdict: Error, Message: fmt.Sprintf("encoding request: %v", err)}}
+	}
+
+	var run []*plugin
+	for i := range r.plugins {
+		if r.plugins[i].applies(req.Path, req.Language) {
+			run = append(run, &r.plugins[i])
+		}
+	}
+
+	reports := make([]Report, len(run))
+	var wg sync.WaitGroup
+	for i, p := range run {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reports[i] = p.run(ctx, req.Root, input)
+		}()
+	}
+	wg.Wait()
+
+	return reports
+}
+
+// run runs the plugin with input on its stdin and parses its report.
+// Plugins may exit non-zero (as linters do on findings) as long as they
+// print a report.
+func (p *plugin) run(ctx context.Context, dir string, input []byte) Report {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, p.command[0], p.command[1:]...)
+	cmd.Dir = dir
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	runErr := cmd.Run()
+
+	failed := func(format string, args ...any) Report {
+		return Report{Plugin: p.name, Verdict: Error, Message: fmt.Sprintf(format, args...)}
+	}
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return failed("timed out after %s", p.timeout)
+	}
+	if len(bytes.TrimSpace(stdout.Bytes())) == 0 {
+		if runErr != nil {
+			if msg := firstLine(stderr.String()); msg != "" {
+				return failed("%v: %s", runErr, msg)
+			}
+			return failed("%v", runErr)
+		}
+		return failed("no report")
+	}
+
+	var report Report
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+		return failed("invalid report: %v", err)
+	}
+	report.Plugin = p.name
+
+	switch report.Verdict {
+	case "":
+		report.Verdict = Pass
+	case Pass, Warn, Fail:
+	default:
+		return failed("unknown verdict %q", report.Verdict)
+	}
+	return report
+}
+
+// firstLine returns the first non-empty line of s, trimmed
+func firstLine(s string) string {
+	for line := range strings.Lines(s) {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
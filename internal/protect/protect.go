@@ -0,0 +1,86 @@
+package protect
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/deemkeen/diffwatch/internal/diff"
+	"github.com/deemkeen/diffwatch/internal/match"
+)
+
+// Guard detects changes to protected paths and optionally reverts them
+type Guard struct {
+	patterns []string
+	restore  bool
+	patchDir string
+}
+
+// New creates a guard for the given glob patterns. If restore is true,
+// changes are reverted to the previous snapshot and saved as patches in
+// patchDir.
+func New(patterns []string, restore bool, patchDir string) *Guard {
+	return &Guard{
+		patterns: patterns,
+		restore:  restore,
+		patchDir: patchDir,
+	}
+}
+
+// Enabled reports whether any paths are protected
+func (g *Guard) Enabled() bool {
+	return g != nil && len(g.patterns) > 0
+}
+
+// Protected reports whether relPath (relative to the watch root) is protected
+func (g *Guard) Protected(relPath string) bool {
+	return g.Enabled() && match.Any(g.patterns, relPath)
+}
+
+// ShouldRestore reports whether a change can and should be reverted.
+// Only changes with known previous content are reverted, so files we
+// never saw before are never deleted.
+func (g *Guard) ShouldRestore(result *diff.Result) bool {
+	return g.restore && result != nil && result.HasDiff &&
+		result.OldState != nil && result.OldState.Exists
+}
+
+// Restore saves the change as a patch and writes the previous content back.
+// Returns the path of the saved patch.
+func (g *Guard) Restore(result *diff.Result) (string, error) {
+	patchPath, err := g.savePatch(result)
+	if err != nil {
+		return "", err
+	}
+
+	perm := os.FileMode(0644)
+	if info, err := os.Stat(result.Path); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	if err := os.WriteFile(result.Path, result.OldState.Content, perm); err != nil {
+		return patchPath, fmt.Errorf("restoring %s: %w", result.Path, err)
+	}
+
+	return patchPath, nil
+}
+
+// savePatch writes the unified diff of a change to the patch directory
+func (g *Guard) savePatch(result *diff.Result) (string, error) {
+	if err := os.MkdirAll(g.patchDir, 0755); err != nil {
+		return "", fmt.Errorf("creating patch directory: %w", err)
+	}
+
+	name := fmt.Sprintf("%s-%s.patch",
+		time.Now().Format("20060102-150405.000"),
+		strings.ReplaceAll(filepath.Base(result.Path), string(filepath.Separator), "_"))
+	patchPath := filepath.Join(g.patchDir, name)
+
+	if err := os.WriteFile(patchPath, []byte(result.Unified), 0644); err != nil {
+		return "", fmt.Errorf("saving patch: %w", err)
+	}
+
+	return patchPath, nil
+}
@@ -0,0 +1,155 @@
+package rate
+
+import (
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/deemkeen/diffwatch/internal/config"
+	"github.com/deemkeen/diffwatch/internal/match"
+	"github.com/deemkeen/diffwatch/internal/severity"
+)
+
+// DefaultWindow is the window of alarms that don't set one
+const DefaultWindow = time.Minute
+
+// Alarm is raised when files change faster than a rule allows
+type Alarm struct {
+	Level   severity.Level
+	Path    string // File changing too often, relative to the watch root; "" for too many files
+	Message string // What exceeded the rule, e.g. "142 files changed within 10s (more than 100)"
+}
+
+// change is a change counted by a rule
+type change struct {
+	path string
+	at   time.Time
+}
+
+// rule is a compiled rate alarm with the changes within its window
+type rule struct {
+	pattern string
+	files   int
+	changes int
+	window  time.Duration
+	span    string // The window as configured, for messages
+	level   severity.Level
+
+	recent []change        // Changes within the window, oldest first
+	counts map[string]int  // Changes within the window by path
+	firing bool            // The files limit is exceeded
+	hot    map[string]bool // Paths exceeding the changes limit
+}
+
+// Monitor counts changes and raises alarms for the rules they exceed
+type Monitor struct {
+	rules []*rule
+}
+
+// New compiles the given rate alarms. Returns nil if there are none.
+func New(alarms []config.RateAlarm) (*Monitor, error) {
+	if len(alarms) == 0 {
+		return nil, nil
+	}
+
+	m := &Monitor{}
+	for i, a := range alarms {
+		if a.Files < 0 || a.Changes < 0 || a.Files == 0 && a.Changes == 0 {
+			return nil, fmt.Errorf("rate alarm %d: set files or changes to a positive limit", i+1)
+		}
+
+		r := &rule{
+			pattern: a.Pattern,
+			files:   a.Files,
+			changes: a.Changes,
+			window:  DefaultWindow,
+			span:    "1m",
+			level:   severity.Warn,
+			counts:  make(map[string]int),
+			hot:     make(map[string]bool),
+		}
+		if _, err := path.Match(a.Pattern, ""); err != nil {
+			return nil, fmt.Errorf("rate alarm %d: pattern %q: %w", i+1, a.Pattern, err)
+		}
+		if a.Window != "" {
+			window, err := time.ParseDuration(a.Window)
+			if err != nil || window <= 0 {
+				return nil, fmt.Errorf("rate alarm %d: invalid window %q", i+1, a.Window)
+			}
+			r.window, r.span = window, a.Window
+		}
+		if a.Level != "" {
+			level, err := severity.ParseLevel(a.Level)
+			if err != nil {
+				return nil, fmt.Errorf("rate alarm %d: %w", i+1, err)
+			}
+			r.level = level
+		}
+		m.rules = append(m.rules, r)
+	}
+	return m, nil
+}
+
+// Observe counts a change of relPath (relative to the watch root) at t and
+// returns the alarms it raises. A rule raises its alarm once when its limit
+// is exceeded, and again only after the rate has dropped to the limit.
+func (m *Monitor) Observe(relPath string, t time.Time) []Alarm {
+	if m == nil {
+		return nil
+	}
+
+	var alarms []Alarm
+	for _, r := range m.rules {
+		if r.pattern != "" && !match.Glob(r.pattern, relPath) {
+			continue
+		}
+		r.add(relPath, t)
+
+		if r.files > 0 {
+			exceeded := len(r.counts) > r.files
+			if exceeded && !r.firing {
+				alarms = append(alarms, Alarm{
+					Level:   r.level,
+					Message: fmt.Sprintf("%d files changed within %s (more than %d)", len(r.counts), r.span, r.files),
+				})
+			}
+			r.firing = exceeded
+		}
+
+		if r.changes > 0 {
+			exceeded := r.counts[relPath] > r.changes
+			if exceeded && !r.hot[relPath] {
+				alarms = append(alarms, Alarm{
+					Level:   r.level,
+					Path:    relPath,
+					Message: fmt.Sprintf("changed %d times within %s (more than %d)", r.counts[relPath], r.span, r.changes),
+				})
+			}
+			if exceeded {
+				r.hot[relPath] = true
+			} else {
+				delete(r.hot, relPath)
+			}
+		}
+	}
+	return alarms
+}
+
+// add counts a change and forgets the changes that left the window
+func (r *rule) add(relPath string, t time.Time) {
+	r.recent = append(r.recent, change{path: relPath, at: t})
+	r.counts[relPath]++
+
+	expired := 0
+	for _, c := range r.recent {
+		if t.Sub(c.at) < r.window {
+			break
+		}
+		expired++
+		if r.counts[c.path]--; r.counts[c.path] <= 0 {
+			delete(r.counts, c.path)
+			delete(r.hot, c.path)
+		}
+	}
+	r.recent = r.recent[expired:]
+}
@@ -0,0 +1,165 @@
+package redact
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/deemkeen/diffwatch/internal/config"
+	"github.com/deemkeen/diffwatch/internal/diff"
+	"github.com/deemkeen/diffwatch/internal/match"
+	"github.com/deemkeen/diffwatch/internal/state"
+)
+
+// rule is a compiled redaction rule
+type rule struct {
+	pattern string
+	re      *regexp.Regexp
+	mask    string
+}
+
+// Redactor masks secrets in diff content. Lines are redacted one at a
+// time, so expressions never match across lines.
+type Redactor struct {
+	rules []rule
+}
+
+// New compiles the given redaction rules
+func New(rules []config.RedactRule) (*Redactor, error) {
+	r := &Redactor{}
+
+	for i, c := range rules {
+		if c.Match == "" {
+			return nil, fmt.Errorf("redact rule %d: match is required", i+1)
+		}
+		re, err := regexp.Compile(c.Match)
+		if err != nil {
+			return nil, fmt.Errorf("redact rule %d: compiling %q: %w", i+1, c.Match, err)
+		}
+		mask := c.Mask
+		if mask == "" {
+			mask = config.DefaultMask
+		}
+		r.rules = append(r.rules, rule{pattern: c.Pattern, re: re, mask: mask})
+	}
+
+	return r, nil
+}
+
+// applying returns the rules applying to relPath (relative to the watch
+// root)
+func (r *Redactor) applying(relPath string) []rule {
+	if r == nil {
+		return nil
+	}
+
+	var rules []rule
+	for _, c := range r.rules {
+		if c.pattern == "" || match.Glob(c.pattern, relPath) {
+			rules = append(rules, c)
+		}
+	}
+	return rules
+}
+
+// Result masks secrets in the lines and unified diff of result in place.
+// Its file states are left alone, as the UI still needs the real content
+// to stage and commit changes.
+func (r *Redactor) Result(relPath string, result *diff.Result) {
+	if result == nil {
+		return
+	}
+	rules := r.applying(relPath)
+	if len(rules) == 0 {
+		return
+	}
+
+	for i := range result.Lines {
+		line := &result.Lines[i]
+		line.Content = redactLine(rules, line.Content)
+		if line.OldContent != "" {
+			line.OldContent = redactLine(rules, line.OldContent)
+		}
+	}
+	for i := range result.Changes {
+		change := &result.Changes[i]
+		change.Old = redactLine(rules, change.Old)
+		change.New = redactLine(rules, change.New)
+	}
+	result.Unified = redactPatch(rules, result.Unified)
+}
+
+// Patch returns a unified diff of the file at relPath with secrets masked
+func (r *Redactor) Patch(relPath, patch string) string {
+	rules := r.applying(relPath)
+	if len(rules) == 0 {
+		return patch
+	}
+	return redactPatch(rules, patch)
+}
+
+// State returns a copy of s with secrets in its content masked, or s itself
+// if no rule applies. The hash still identifies the real content.
+func (r *Redactor) State(relPath string, s *state.FileState) *state.FileState {
+	if s == nil || !s.Exists {
+		return s
+	}
+	rules := r.applying(relPath)
+	if len(rules) == 0 {
+		return s
+	}
+
+	var content bytes.Buffer
+	for _, line := range diff.SplitLines(s.Content) {
+		body, ending := splitEnding(line)
+		content.WriteString(redactLine(rules, body))
+		content.WriteString(ending)
+	}
+
+	redacted := *s
+	redacted.Content = content.Bytes()
+	return &redacted
+}
+
+// redactPatch masks secrets in the added, deleted and context lines of a
+// unified diff, leaving its headers alone
+func redactPatch(rules []rule, patch string) string {
+	if patch == "" {
+		return patch
+	}
+
+	var b strings.Builder
+	inHunk := false
+	for _, line := range strings.SplitAfter(patch, "\n") {
+		if strings.HasPrefix(line, "@@") {
+			inHunk = true
+		}
+		if !inHunk || line == "" || !strings.ContainsRune(" +-", rune(line[0])) {
+			b.WriteString(line)
+			continue
+		}
+
+		body, ending := splitEnding(line[1:])
+		b.WriteString(line[:1])
+		b.WriteString(redactLine(rules, body))
+		b.WriteString(ending)
+	}
+	return b.String()
+}
+
+// redactLine replaces every match of the rules in a line
+func redactLine(rules []rule, line string) string {
+	for _, c := range rules {
+		line = c.re.ReplaceAllString(line, c.mask)
+	}
+	return line
+}
+
+// splitEnding splits a line into its body and terminator, so that
+// expressions like "secret=.*" keep the line ending
+func splitEnding(line string) (body, ending string) {
+	body = strings.TrimSuffix(line, "\n")
+	body = strings.TrimSuffix(body, "\r")
+	return body, line[len(body):]
+}
@@ -0,0 +1,210 @@
+package s3
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// emptyHash is the SHA-256 of an empty request body
+const emptyHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// client makes signed GET requests to an S3-compatible API
+type client struct {
+	endpoint  *url.URL // Custom endpoint (path-style), nil for AWS (virtual-hosted)
+	region    string
+	accessKey string
+	secretKey string
+	token     string
+	http      *http.Client
+}
+
+// object is an entry of a bucket listing
+type object struct {
+	Key  string `xml:"Key"`
+	ETag string `xml:"ETag"`
+	Size int64  `xml:"Size"`
+}
+
+// listResult is the response of ListObjectsV2
+type listResult struct {
+	Contents              []object `xml:"Contents"`
+	IsTruncated           bool     `xml:"IsTruncated"`
+	NextContinuationToken string   `xml:"NextContinuationToken"`
+}
+
+// apiError is the error body of a failed request
+type apiError struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// escape encodes s as AWS Signature Version 4 requires: everything but
+// unreserved characters, and slashes in paths
+func escape(s string, path bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '.' || c == '_' || c == '~' || path && c == '/' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data with key
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// sign signs a GET request with AWS Signature Version 4, rawPath and
+// rawQuery being its escaped path and canonical query
+func (c *client) sign(req *http.Request, rawPath, rawQuery string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", emptyHash)
+	headers := "host:" + req.URL.Host + "\nx-amz-content-sha256:" + emptyHash + "\nx-amz-date:" + amzDate + "\n"
+	signed := "host;x-amz-content-sha256;x-amz-date"
+	if c.token != "" {
+		req.Header.Set("X-Amz-Security-Token", c.token)
+		headers += "x-amz-security-token:" + c.token + "\n"
+		signed += ";x-amz-security-token"
+	}
+
+	canonical := strings.Join([]string{http.MethodGet, rawPath, rawQuery, headers, signed, emptyHash}, "\n")
+	sum := sha256.Sum256([]byte(canonical))
+	scope := day + "/" + c.region + "/s3/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+
+	key := hmacSHA256([]byte("AWS4"+c.secretKey), day)
+	key = hmacSHA256(key, c.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+c.accessKey+"/"+scope+
+		", SignedHeaders="+signed+", Signature="+signature)
+}
+
+// get sends a GET request for a key of a bucket (empty: the bucket) with
+// query, signed with the credentials if there are any
+func (c *client) get(ctx context.Context, bucket, key string, query url.Values) (*http.Response, error) {
+	var scheme, host, path string
+	if c.endpoint != nil {
+		scheme, host = c.endpoint.Scheme, c.endpoint.Host
+		path = strings.TrimSuffix(c.endpoint.Path, "/") + "/" + bucket + "/" + key
+	} else {
+		scheme, host = "https", bucket+".s3."+c.region+".amazonaws.com"
+		path = "/" + key
+	}
+
+	// Canonical query: sorted keys, both keys and values escaped
+	var params []string
+	for k, vs := range query {
+		for _, v := range vs {
+			params = append(params, escape(k, false)+"="+escape(v, false))
+		}
+	}
+	slices.Sort(params)
+	rawQuery := strings.Join(params, "&")
+	rawPath := escape(path, true)
+
+	u := scheme + "://" + host + rawPath
+	if rawQuery != "" {
+		u += "?" + rawQuery
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.accessKey != "" {
+		c.sign(req, rawPath, rawQuery, time.Now().UTC())
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		var e apiError
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		if xml.Unmarshal(body, &e) == nil && e.Code != "" {
+			if e.Message != "" {
+				return nil, fmt.Errorf("%s: %s", e.Code, e.Message)
+			}
+			return nil, errors.New(e.Code)
+		}
+		return nil, errors.New(resp.Status)
+	}
+	return resp, nil
+}
+
+// list lists the objects of a bucket below prefix. With a delimiter,
+// objects in "subdirectories" are left out.
+func (c *client) list(ctx context.Context, bucket, prefix, delimiter string) ([]object, error) {
+	var objects []object
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if delimiter != "" {
+			query.Set("delimiter", delimiter)
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		resp, err := c.get(ctx, bucket, "", query)
+		if err != nil {
+			return nil, err
+		}
+		var result listResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("reading listing: %w", err)
+		}
+
+		objects = append(objects, result.Contents...)
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// download reads an object. ok is false if it is larger than limit.
+func (c *client) download(ctx context.Context, bucket, key string, limit int64) (content []byte, ok bool, err error) {
+	resp, err := c.get(ctx, bucket, key, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+
+	content, err = io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, false, err
+	}
+	if int64(len(content)) > limit {
+		return nil, false, nil
+	}
+	return content, true, nil
+}
@@ -0,0 +1,378 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/deemkeen/diffwatch/internal/mirror"
+	"github.com/deemkeen/diffwatch/internal/state"
+	"github.com/deemkeen/diffwatch/internal/watcher"
+)
+
+// DefaultInterval is how often a bucket is listed
+const DefaultInterval = 10 * time.Second
+
+// maxContent is the largest object downloaded for diffing
+const maxContent = 1024 * 1024
+
+// requestTimeout bounds a single listing or download
+const requestTimeout = 30 * time.Second
+
+// snapshotWorkers is the number of objects downloaded at once at startup
+const snapshotWorkers = 8
+
+// Options configures a bucket watcher. Credentials are read from the
+// environment like the AWS CLI does: AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN. Without them, requests are
+// anonymous, which is enough for public buckets.
+type Options struct {
+	Endpoint    string        // S3-compatible endpoint, e.g. http://localhost:9000 for MinIO (default: AWS)
+	Region      string        // Signing region (default: $AWS_REGION, $AWS_DEFAULT_REGION or us-east-1)
+	Interval    time.Duration // Between listings (default: DefaultInterval)
+	Ops         []string      // Operations to report (see watcher.ParseOps); empty reports all
+	IgnoreFiles []string      // Globs of object base names to ignore
+	Logger      *slog.Logger  // Receives watcher internals (nil: discard)
+}
+
+// ParseURL splits a bucket watch of the form s3://BUCKET/PREFIX
+func ParseURL(s string) (bucket, prefix string, err error) {
+	rest, ok := strings.CutPrefix(s, "s3://")
+	bucket, prefix, _ = strings.Cut(rest, "/")
+	if !ok || bucket == "" {
+		return "", "", fmt.Errorf("invalid bucket %q, want s3://BUCKET/PREFIX", s)
+	}
+	return bucket, strings.Trim(prefix, "/"), nil
+}
+
+// The s3 backend watches paths of the form s3://BUCKET/PREFIX
+func init() {
+	watcher.Register("s3", "s3://", func(u string, recursive bool, opts watcher.Options) (watcher.Backend, error) {
+		bucket, prefix, err := ParseURL(u)
+		if err != nil {
+			return nil, err
+		}
+		w, err := Watch(bucket, prefix, recursive, Options{
+			Endpoint:    opts.Endpoint,
+			Interval:    opts.Interval,
+			Ops:         opts.Ops,
+			IgnoreFiles: opts.IgnoreFiles,
+			Logger:      opts.Logger,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return w, nil
+	})
+}
+
+// info is an object as listed
+type info struct {
+	etag string
+	size int64
+}
+
+// Watcher polls the objects below a prefix of an S3 or S3-compatible
+// bucket and delivers their changes like a local watcher: objects are
+// compared by ETag and changed ones are downloaded. The prefix is treated
+// as a directory.
+//
+// Paths are reported as s3://BUCKET/KEY. The UI can't read them, so the
+// watcher supplies the state of an object after its event.
+type Watcher struct {
+	bucket    string
+	prefix    string
+	recursive bool
+	opts      Options
+	log       *slog.Logger
+	client    *client
+	states    *mirror.Files
+	errors    chan error
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+
+	mu      sync.Mutex
+	objects map[string]info // Last listing by key
+}
+
+// Watch starts polling prefix in bucket. The first listing and snapshot
+// are taken before Watch returns, so the first change to any object shows
+// a proper diff.
+func Watch(bucket, prefix string, recursive bool, opts Options) (*Watcher, error) {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultInterval
+	}
+	log := opts.Logger
+	if log == nil {
+		log = slog.New(slog.DiscardHandler)
+	}
+
+	c := &client{
+		region:    opts.Region,
+		accessKey: os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		token:     os.Getenv("AWS_SESSION_TOKEN"),
+		http:      &http.Client{Timeout: requestTimeout},
+	}
+	for _, env := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+		if c.region == "" {
+			c.region = os.Getenv(env)
+		}
+	}
+	if c.region == "" {
+		c.region = "us-east-1"
+	}
+	if opts.Endpoint != "" {
+		u, err := url.Parse(opts.Endpoint)
+		if err != nil || u.Host == "" || u.Scheme != "http" && u.Scheme != "https" {
+			return nil, fmt.Errorf("invalid endpoint %q, want http(s)://HOST[:PORT]", opts.Endpoint)
+		}
+		c.endpoint = u
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &Watcher{
+		bucket:    bucket,
+		prefix:    prefix,
+		recursive: recursive,
+		opts:      opts,
+		log:       log,
+		client:    c,
+		states:    mirror.New(opts.Ops, log),
+		errors:    make(chan error, 10),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+
+	objects, err := w.list()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	w.objects = objects
+	w.snapshot()
+
+	w.wg.Add(1)
+	go w.poll()
+	return w, nil
+}
+
+// path returns the reported path of an object
+func (w *Watcher) path(key string) string {
+	return "s3://" + w.bucket + "/" + key
+}
+
+// ignored reports whether an object's base name matches an ignore pattern
+func (w *Watcher) ignored(key string) bool {
+	base := path.Base(key)
+	for _, pattern := range w.opts.IgnoreFiles {
+		if ok, _ := path.Match(pattern, base); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// list lists the objects below the prefix. Without recursion, objects in
+// "subdirectories" of the prefix are left out.
+func (w *Watcher) list() (map[string]info, error) {
+	prefix := w.prefix
+	if prefix != "" {
+		prefix += "/"
+	}
+	delimiter := ""
+	if !w.recursive {
+		delimiter = "/"
+	}
+
+	listed, err := w.client.list(w.ctx, w.bucket, prefix, delimiter)
+	if err != nil {
+		return nil, fmt.Errorf("listing s3://%s/%s: %w", w.bucket, prefix, err)
+	}
+
+	objects := make(map[string]info)
+	for _, o := range listed {
+		// Folder markers created by consoles aren't objects to diff
+		if strings.HasSuffix(o.Key, "/") || w.ignored(o.Key) {
+			continue
+		}
+		objects[o.Key] = info{etag: o.ETag, size: o.Size}
+	}
+	return objects, nil
+}
+
+// read downloads an object. ok is false for objects too large to diff.
+func (w *Watcher) read(key string, size int64) (s *state.FileState, ok bool, err error) {
+	if size > maxContent {
+		return nil, false, nil
+	}
+
+	content, ok, err := w.client.download(w.ctx, w.bucket, key, maxContent)
+	if err != nil {
+		return nil, false, fmt.Errorf("downloading %s: %w", w.path(key), err)
+	}
+	if !ok {
+		return nil, false, nil
+	}
+	return &state.FileState{Path: w.path(key), Content: content, Exists: true, Hash: state.HashContent(content)}, true, nil
+}
+
+// snapshot downloads the listed objects as the baseline of the session
+func (w *Watcher) snapshot() {
+	keys := make(chan string)
+	var wg sync.WaitGroup
+	for range snapshotWorkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range keys {
+				s, ok, err := w.read(key, w.objects[key].size)
+				if err != nil {
+					// Without it, the object's first change shows it as new
+					w.log.Warn("s3 snapshot failed", "path", w.path(key), "error", err)
+				} else if ok {
+					w.states.Seed(s)
+				}
+			}
+		}()
+	}
+	for key := range w.objects {
+		keys <- key
+	}
+	close(keys)
+	wg.Wait()
+}
+
+// poll lists the objects every interval until the watcher is closed
+func (w *Watcher) poll() {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(w.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-ticker.C:
+			w.scan()
+		}
+	}
+}
+
+// scan compares a new listing with the previous one and reports the
+// created, changed and removed objects. Objects that fail to download
+// keep their previous listing, so they are retried with the next one.
+func (w *Watcher) scan() {
+	objects, err := w.list()
+	if err != nil {
+		if w.ctx.Err() == nil {
+			watcher.SendError(w.errors, err, w.log)
+		}
+		return
+	}
+
+	w.mu.Lock()
+	old := w.objects
+	w.mu.Unlock()
+
+	objects = mirror.Scan(w.states, old, objects, mirror.Source[info]{
+		Path:    w.path,
+		Changed: func(before, now info) bool { return before != now },
+		Read: func(key string, now info) (*state.FileState, bool, error) {
+			return w.read(key, now.size)
+		},
+	})
+	if objects == nil {
+		return
+	}
+
+	w.mu.Lock()
+	w.objects = objects
+	w.mu.Unlock()
+}
+
+// Events returns the channel of object events
+func (w *Watcher) Events() <-chan watcher.Event {
+	return w.states.Events()
+}
+
+// Errors returns the channel of errors
+func (w *Watcher) Errors() <-chan error {
+	return w.errors
+}
+
+// Stats returns the "directories" and objects of the last listing
+func (w *Watcher) Stats() watcher.Stats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	dirs := make(map[string]bool)
+	for key := range w.objects {
+		dirs[path.Dir(key)] = true
+	}
+	return watcher.Stats{Dirs: len(dirs), Files: len(w.objects)}
+}
+
+// WatchPath returns the watched prefix as s3://BUCKET/PREFIX
+func (w *Watcher) WatchPath() string {
+	return strings.TrimSuffix(w.path(w.prefix), "/")
+}
+
+// Roots returns the watched prefix
+func (w *Watcher) Roots() []string {
+	return []string{w.WatchPath()}
+}
+
+// IsRecursive returns whether objects below "subdirectories" are watched
+func (w *Watcher) IsRecursive() bool {
+	return w.recursive
+}
+
+// AddRoot is not supported: a bucket watch has a single root
+func (w *Watcher) AddRoot(path string) (string, error) {
+	return "", errors.New("a bucket watch can't add roots")
+}
+
+// RemoveRoot is not supported: a bucket watch has a single root
+func (w *Watcher) RemoveRoot(path string) (string, error) {
+	return "", errors.New("a bucket watch can't remove roots")
+}
+
+// WalkFiles is not supported: the objects are snapshotted at startup instead
+func (w *Watcher) WalkFiles(fn func(path string) error) error {
+	return errors.New("prescan is not available for a bucket; objects are snapshotted at startup")
+}
+
+// PriorState returns the baseline and the state before the first
+// unclaimed event of path, and forgets the latter
+func (w *Watcher) PriorState(p string) (baseline, previous *state.FileState, ok bool) {
+	return w.states.PriorState(p)
+}
+
+// CurrentState returns the state of path after its latest event. ok is
+// false if the content is unknown, e.g. for objects too large to diff.
+func (w *Watcher) CurrentState(p string) (*state.FileState, bool) {
+	return w.states.CurrentState(p)
+}
+
+// Close stops polling
+func (w *Watcher) Close() error {
+	if !w.states.Stop() {
+		return nil
+	}
+	w.cancel()
+	w.wg.Wait()
+	w.states.Close()
+	close(w.errors)
+	return nil
+}
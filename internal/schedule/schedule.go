@@ -0,0 +1,174 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// field is one of the five fields of an expression, with its range and
+// the names its values may be given by
+type field struct {
+	name     string
+	min, max int
+	names    []string // Names of min, min+1, ...
+}
+
+var fields = [5]field{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	// 7 is Sunday too
+	{name: "day of week", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+// spec is a single parsed expression: the values each field matches, as
+// bit sets
+type spec struct {
+	sets       [5]uint64
+	anyDay     bool // Day of month is "*"
+	anyWeekday bool // Day of week is "*"
+}
+
+// Schedule is the minutes something is active, given by cron-like
+// expressions: "minute hour day-of-month month day-of-week", e.g.
+// "* 9-17 * * mon-fri" for business hours. Several expressions separated
+// by ";" are active when any of them is. A nil Schedule is always active.
+type Schedule struct {
+	expr  string
+	specs []spec
+}
+
+// Parse parses a schedule. An empty expression returns nil, which is
+// always active.
+func Parse(expr string) (*Schedule, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, nil
+	}
+
+	s := &Schedule{expr: strings.TrimSpace(expr)}
+	for _, part := range strings.Split(expr, ";") {
+		values := strings.Fields(part)
+		if len(values) != len(fields) {
+			return nil, fmt.Errorf("schedule %q: want 5 fields (minute hour day-of-month month day-of-week), got %d", strings.TrimSpace(part), len(values))
+		}
+
+		var sp spec
+		for i, value := range values {
+			set, err := fields[i].parse(value)
+			if err != nil {
+				return nil, fmt.Errorf("schedule %q: %s: %w", strings.TrimSpace(part), fields[i].name, err)
+			}
+			sp.sets[i] = set
+		}
+		// Sunday is 0 or 7
+		if sp.sets[4]&(1<<7) != 0 {
+			sp.sets[4] |= 1
+		}
+		sp.anyDay = values[2] == "*"
+		sp.anyWeekday = values[4] == "*"
+		s.specs = append(s.specs, sp)
+	}
+	return s, nil
+}
+
+// parse parses a field: "*", a value, a range "a-b", each optionally with
+// a step "/n", or a comma-separated list of these
+func (f field) parse(s string) (uint64, error) {
+	var set uint64
+	for _, item := range strings.Split(s, ",") {
+		rng, stepText, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepText)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepText)
+			}
+			step = n
+		}
+
+		lo, hi := f.min, f.max
+		if rng != "*" {
+			from, to, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = f.value(from); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if isRange {
+				if hi, err = f.value(to); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				// "a/n" steps from a to the end
+				hi = f.max
+			}
+			if hi < lo {
+				return 0, fmt.Errorf("invalid range %q", rng)
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+// value parses a number or name within the field's range
+func (f field) value(s string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(s, name) {
+			return f.min + i, nil
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < f.min || n > f.max {
+		return 0, fmt.Errorf("invalid value %q (%d-%d)", s, f.min, f.max)
+	}
+	return n, nil
+}
+
+// Active reports whether t falls within a minute the schedule matches
+func (s *Schedule) Active(t time.Time) bool {
+	if s == nil {
+		return true
+	}
+	for _, sp := range s.specs {
+		if sp.matches(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether t falls within a minute of the expression. As in
+// cron, when both days are restricted, either may match.
+func (sp spec) matches(t time.Time) bool {
+	has := func(i, v int) bool { return sp.sets[i]&(1<<v) != 0 }
+	if !has(0, t.Minute()) || !has(1, t.Hour()) || !has(3, int(t.Month())) {
+		return false
+	}
+
+	day, weekday := has(2, t.Day()), has(4, int(t.Weekday()))
+	switch {
+	case sp.anyDay && sp.anyWeekday:
+		return true
+	case sp.anyDay:
+		return weekday
+	case sp.anyWeekday:
+		return day
+	default:
+		return day || weekday
+	}
+}
+
+// String returns the expression the schedule was parsed from, "" for nil
+func (s *Schedule) String() string {
+	if s == nil {
+		return ""
+	}
+	return s.expr
+}
@@ -0,0 +1,147 @@
+package severity
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/deemkeen/diffwatch/internal/config"
+	"github.com/deemkeen/diffwatch/internal/diff"
+	"github.com/deemkeen/diffwatch/internal/match"
+)
+
+// Level represents the severity of an event
+type Level int
+
+const (
+	Info Level = iota
+	Warn
+	Critical
+)
+
+// String returns the lowercase name of the level
+func (l Level) String() string {
+	switch l {
+	case Warn:
+		return "warn"
+	case Critical:
+		return "critical"
+	default:
+		return "info"
+	}
+}
+
+// ParseLevel parses a level name
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(s) {
+	case "", "info":
+		return Info, nil
+	case "warn", "warning":
+		return Warn, nil
+	case "critical", "crit":
+		return Critical, nil
+	default:
+		return Info, fmt.Errorf("unknown level %q", s)
+	}
+}
+
+// rule is a compiled classification rule
+type rule struct {
+	pattern  string
+	contains *regexp.Regexp
+	level    Level
+	action   config.LevelAction // Bell and sound of the rule
+}
+
+// Classifier assigns severity levels to changes based on rules
+type Classifier struct {
+	rules []rule
+}
+
+// New compiles the given rules into a classifier
+func New(rules []config.Rule) (*Classifier, error) {
+	c := &Classifier{}
+
+	for i, r := range rules {
+		level, err := ParseLevel(r.Level)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i+1, err)
+		}
+
+		compiled := rule{
+			pattern: r.Pattern,
+			level:   level,
+			action:  config.LevelAction{Bell: r.Bell, Sound: r.Sound},
+		}
+
+		if r.Contains != "" {
+			re, err := regexp.Compile(r.Contains)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: compiling contains: %w", i+1, err)
+			}
+			compiled.contains = re
+		}
+
+		c.rules = append(c.rules, compiled)
+	}
+
+	return c, nil
+}
+
+// Classify returns the highest level of all rules matching the change.
+// relPath is the path relative to the watch root.
+func (c *Classifier) Classify(relPath string, result *diff.Result) Level {
+	level := Info
+
+	for _, r := range c.rules {
+		if r.level <= level || !r.matches(relPath, result) {
+			continue
+		}
+		level = r.level
+	}
+
+	return level
+}
+
+// Action returns the bell and sound of the rules matching the change,
+// whatever the level they assign. The first matching sound wins.
+func (c *Classifier) Action(relPath string, result *diff.Result) config.LevelAction {
+	var action config.LevelAction
+
+	for _, r := range c.rules {
+		if !r.action.Bell && r.action.Sound == "" || !r.matches(relPath, result) {
+			continue
+		}
+		action.Bell = action.Bell || r.action.Bell
+		if action.Sound == "" {
+			action.Sound = r.action.Sound
+		}
+	}
+
+	return action
+}
+
+// matches reports whether the rule applies to the change
+func (r rule) matches(relPath string, result *diff.Result) bool {
+	if r.pattern != "" && !match.Glob(r.pattern, relPath) {
+		return false
+	}
+	return r.contains == nil || changedLinesMatch(r.contains, result)
+}
+
+// changedLinesMatch reports whether any added or deleted line matches re
+func changedLinesMatch(re *regexp.Regexp, result *diff.Result) bool {
+	if result == nil {
+		return false
+	}
+
+	for _, line := range result.Lines {
+		if line.Type != diff.LineAdded && line.Type != diff.LineDeleted {
+			continue
+		}
+		if re.MatchString(line.Content) {
+			return true
+		}
+	}
+	return false
+}
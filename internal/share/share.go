@@ -0,0 +1,407 @@
+package share
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/deemkeen/diffwatch/internal/state"
+	"github.com/deemkeen/diffwatch/internal/watcher"
+)
+
+// joinTimeout bounds how long a viewer may take to send its join request
+// and how long viewers wait for the session to answer
+const joinTimeout = 5 * time.Second
+
+// viewerBuffer is the number of messages queued for a viewer before it
+// is considered too slow and disconnected
+const viewerBuffer = 256
+
+// Join is the first line a viewer sends
+type Join struct {
+	Token string `json:"token,omitempty"`
+}
+
+// Message is sent to viewers: first a hello with the watched roots and
+// stats, then one message per processed event. Events carry the states
+// of their file so viewers can diff without access to the files. Focus
+// messages tell viewers what the session shows whenever that changes.
+type Message struct {
+	Event     *watcher.Event   `json:"event,omitempty"`
+	Baseline  *state.FileState `json:"baseline,omitempty"` // State of the event's file at session start
+	Previous  *state.FileState `json:"previous,omitempty"` // State of the event's file before the event
+	Current   *state.FileState `json:"current,omitempty"`  // State of the event's file after the event
+	Error     string           `json:"error,omitempty"`
+	Stats     *watcher.Stats   `json:"stats,omitempty"`
+	Roots     []string         `json:"roots,omitempty"`
+	Recursive bool             `json:"recursive,omitempty"`
+	Focus     *Focus           `json:"focus,omitempty"`
+}
+
+// Focus is the diff the shared session shows and how, for viewers that
+// follow its presenter through the changes
+type Focus struct {
+	Path   string    `json:"path"`
+	Time   time.Time `json:"time"`   // Timestamp of the event whose diff is shown
+	Mode   int       `json:"mode"`   // Diff view: since the last change, since the baseline or both
+	Offset int       `json:"offset"` // First diff line shown, -1 for centered on the changes
+}
+
+// Server streams a session's events to read-only viewers over TCP
+type Server struct {
+	listener net.Listener
+	token    string
+	hello    func() Message
+
+	mu      sync.Mutex
+	viewers map[chan Message]struct{}
+	closed  bool
+}
+
+// Listen accepts viewers on addr (e.g. ":9000") in the background until
+// Close is called. Viewers must present token unless it is empty. hello
+// returns the first message for a new viewer.
+func Listen(addr, token string, hello func() Message) (*Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("sharing session: %w", err)
+	}
+
+	s := &Server{
+		listener: listener,
+		token:    token,
+		hello:    hello,
+		viewers:  make(map[chan Message]struct{}),
+	}
+	go s.serve()
+	return s, nil
+}
+
+// Addr returns the address viewers connect to
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Viewers returns the number of connected viewers
+func (s *Server) Viewers() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.viewers)
+}
+
+// Publish sends msg to all viewers. Viewers that fall too far behind are
+// disconnected rather than slowing down the session.
+func (s *Server) Publish(msg Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for ch := range s.viewers {
+		select {
+		case ch <- msg:
+		default:
+			delete(s.viewers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Close stops accepting viewers and disconnects the connected ones
+func (s *Server) Close() error {
+	err := s.listener.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for ch := range s.viewers {
+		delete(s.viewers, ch)
+		close(ch)
+	}
+	return err
+}
+
+// serve accepts viewers until the listener is closed
+func (s *Server) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handleViewer(conn)
+	}
+}
+
+// handleViewer checks a viewer's token and streams messages to it until
+// either side goes away
+func (s *Server) handleViewer(conn net.Conn) {
+	defer conn.Close()
+
+	enc := json.NewEncoder(conn)
+	reader := bufio.NewReader(conn)
+
+	conn.SetReadDeadline(time.Now().Add(joinTimeout))
+	var join Join
+	if err := json.NewDecoder(reader).Decode(&join); err != nil {
+		enc.Encode(Message{Error: fmt.Sprintf("invalid join request: %v", err)})
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(join.Token), []byte(s.token)) != 1 {
+		enc.Encode(Message{Error: "invalid share token"})
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	ch := make(chan Message, viewerBuffer)
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.viewers[ch] = struct{}{}
+	s.mu.Unlock()
+	defer s.remove(ch)
+
+	// Viewers only read: the connection ends when they hang up
+	go func() {
+		io.Copy(io.Discard, reader)
+		conn.Close()
+	}()
+
+	if err := enc.Encode(s.hello()); err != nil {
+		return
+	}
+	for msg := range ch {
+		if err := enc.Encode(msg); err != nil {
+			return
+		}
+	}
+}
+
+// remove forgets a viewer whose connection ended
+func (s *Server) remove(ch chan Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.viewers[ch]; ok {
+		delete(s.viewers, ch)
+		close(ch)
+	}
+}
+
+// prior is the state of a file before an event, as known by the session
+type prior struct {
+	baseline *state.FileState
+	previous *state.FileState
+}
+
+// Client mirrors a shared session and delivers its events like a local
+// watcher. It is read-only: the watched roots can't be changed.
+type Client struct {
+	addr   string
+	conn   net.Conn
+	events chan watcher.Event
+	errors chan error
+	focus  chan Focus
+
+	mu        sync.RWMutex
+	roots     []string
+	recursive bool
+	stats     watcher.Stats
+	priors    map[string]prior            // First unclaimed prior state per path
+	current   map[string]*state.FileState // Latest state per path
+}
+
+// Connect joins the session shared at addr (host:port)
+func Connect(addr, token string) (*Client, error) {
+	conn, err := net.DialTimeout("tcp", addr, joinTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to %s: %w", addr, err)
+	}
+
+	if err := json.NewEncoder(conn).Encode(Join{Token: token}); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("joining session: %w", err)
+	}
+
+	dec := json.NewDecoder(conn)
+	conn.SetReadDeadline(time.Now().Add(joinTimeout))
+	var hello Message
+	if err := dec.Decode(&hello); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("joining session: %w", err)
+	}
+	conn.SetReadDeadline(time.Time{})
+	if hello.Error != "" {
+		conn.Close()
+		return nil, fmt.Errorf("joining session: %s", hello.Error)
+	}
+	if len(hello.Roots) == 0 {
+		conn.Close()
+		return nil, errors.New("joining session: no watched roots")
+	}
+
+	c := &Client{
+		addr:      addr,
+		conn:      conn,
+		events:    make(chan watcher.Event, 100),
+		errors:    make(chan error, 10),
+		focus:     make(chan Focus, 1),
+		roots:     hello.Roots,
+		recursive: hello.Recursive,
+		priors:    make(map[string]prior),
+		current:   make(map[string]*state.FileState),
+	}
+	if hello.Stats != nil {
+		c.stats = *hello.Stats
+	}
+
+	go c.receive(dec)
+	return c, nil
+}
+
+// receive reads messages from the session until the connection ends
+func (c *Client) receive(dec *json.Decoder) {
+	defer close(c.events)
+	defer close(c.errors)
+	defer close(c.focus)
+
+	for {
+		var msg Message
+		if err := dec.Decode(&msg); err != nil {
+			watcher.SendError(c.errors, fmt.Errorf("lost connection to %s: %w", c.addr, err), nil)
+			return
+		}
+
+		c.mu.Lock()
+		if msg.Stats != nil {
+			c.stats = *msg.Stats
+		}
+		if msg.Roots != nil {
+			c.roots = msg.Roots
+		}
+		if msg.Event != nil {
+			path := msg.Event.Path
+			// Coalesced events need the state before the first of them
+			if _, ok := c.priors[path]; !ok {
+				c.priors[path] = prior{baseline: msg.Baseline, previous: msg.Previous}
+			}
+			if msg.Current != nil {
+				c.current[path] = msg.Current
+			} else {
+				delete(c.current, path)
+			}
+		}
+		c.mu.Unlock()
+
+		if msg.Error != "" {
+			watcher.SendError(c.errors, errors.New(msg.Error), nil)
+		}
+		if msg.Event != nil {
+			c.events <- *msg.Event
+		}
+		if msg.Focus != nil {
+			c.sendFocus(*msg.Focus)
+		}
+	}
+}
+
+// sendFocus forwards the session's focus, replacing one not taken yet:
+// only the latest matters
+func (c *Client) sendFocus(f Focus) {
+	select {
+	case <-c.focus:
+	default:
+	}
+	c.focus <- f
+}
+
+// Events returns the channel of file events
+func (c *Client) Events() <-chan watcher.Event {
+	return c.events
+}
+
+// Errors returns the channel of errors, including losing the connection
+func (c *Client) Errors() <-chan error {
+	return c.errors
+}
+
+// Focus returns the channel of the diffs the session shows
+func (c *Client) Focus() <-chan Focus {
+	return c.focus
+}
+
+// Stats returns the session's latest watcher counters
+func (c *Client) Stats() watcher.Stats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.stats
+}
+
+// WatchPath returns the session's primary watch root
+func (c *Client) WatchPath() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.roots[0]
+}
+
+// Roots returns the roots watched by the session
+func (c *Client) Roots() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return slices.Clone(c.roots)
+}
+
+// IsRecursive returns whether the session watches recursively
+func (c *Client) IsRecursive() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.recursive
+}
+
+// AddRoot is not supported: viewers are read-only
+func (c *Client) AddRoot(path string) (string, error) {
+	return "", errors.New("a shared session is read-only")
+}
+
+// RemoveRoot is not supported: viewers are read-only
+func (c *Client) RemoveRoot(path string) (string, error) {
+	return "", errors.New("a shared session is read-only")
+}
+
+// WalkFiles is not supported: the files are on another machine
+func (c *Client) WalkFiles(fn func(path string) error) error {
+	return errors.New("prescan is not available in a shared session")
+}
+
+// PriorState returns the session's baseline and previous state of path
+// from before its first unclaimed event, and forgets them
+func (c *Client) PriorState(path string) (baseline, previous *state.FileState, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p, ok := c.priors[path]
+	delete(c.priors, path)
+	return p.baseline, p.previous, ok
+}
+
+// CurrentState returns the latest state of path sent by the session. ok
+// is false if none was sent, e.g. for files too large to share.
+func (c *Client) CurrentState(path string) (*state.FileState, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, ok := c.current[path]
+	delete(c.current, path)
+	return s, ok
+}
+
+// Close leaves the session
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
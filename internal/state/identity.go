@@ -0,0 +1,64 @@
+package state
+
+import "github.com/deemkeen/diffwatch/internal/pathname"
+
+// fileID identifies a file on its device, whichever path it is reached
+// by: hardlinks and bind mounts share it
+type fileID struct {
+	dev, ino uint64
+}
+
+// Canonical returns the tracked path of the file at path: another path
+// reaching the same file, through a hardlink or bind mount, if one was
+// tracked first and still reaches it, otherwise path itself. Events of
+// both paths are then one change of one file, diffed and logged once.
+func (m *Manager) Canonical(path string) string {
+	path = pathname.Normalize(path)
+	id, ok := identify(path)
+	if !ok {
+		return path
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if owner := m.owner(id); owner != "" {
+		return owner
+	}
+	return path
+}
+
+// owner returns the path tracking the file id, or "" if there is none:
+// the path it was first read by, as long as that still exists and was
+// last read as the same file (not replaced by an atomic save)
+func (m *Manager) owner(id fileID) string {
+	owner, ok := m.owners[id]
+	if !ok {
+		return ""
+	}
+	if s := m.states[owner]; s == nil || !s.Exists || m.ids[owner] != id {
+		return ""
+	}
+	return owner
+}
+
+// identified notes that path was read as the file id, making path its
+// owner unless another path is
+func (m *Manager) identified(path string, id fileID) {
+	if old, ok := m.ids[path]; ok && old != id && m.owners[old] == path {
+		delete(m.owners, old)
+	}
+	m.ids[path] = id
+	if m.owner(id) == "" {
+		m.owners[id] = path
+	}
+}
+
+// unidentify forgets the file path was read as
+func (m *Manager) unidentify(path string) {
+	if id, ok := m.ids[path]; ok {
+		if m.owners[id] == path {
+			delete(m.owners, id)
+		}
+		delete(m.ids, path)
+	}
+}
@@ -0,0 +1,24 @@
+//go:build windows
+
+package state
+
+import "syscall"
+
+// identify returns the volume serial number and file index of the file at
+// path, which NTFS hardlinks share
+func identify(path string) (fileID, bool) {
+	f, err := openShared(path)
+	if err != nil {
+		return fileID{}, false
+	}
+	defer f.Close()
+
+	var d syscall.ByHandleFileInformation
+	if err := syscall.GetFileInformationByHandle(syscall.Handle(f.Fd()), &d); err != nil {
+		return fileID{}, false
+	}
+	return fileID{
+		dev: uint64(d.VolumeSerialNumber),
+		ino: uint64(d.FileIndexHigh)<<32 | uint64(d.FileIndexLow),
+	}, true
+}
@@ -0,0 +1,111 @@
+package state
+
+// Limits bounds the memory used for tracked files. Zero values mean
+// unlimited.
+type Limits struct {
+	MaxFiles int   // Maximum number of tracked files
+	MaxBytes int64 // Maximum total size of tracked contents and baselines
+}
+
+// Evictions counts the files dropped to stay within the limits
+type Evictions struct {
+	Files int   // Files evicted
+	Bytes int64 // Bytes freed by evicting them
+}
+
+// SetLimits sets the limits, evicting files right away if needed
+func (m *Manager) SetLimits(limits Limits) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.limits = limits
+	m.enforce("")
+}
+
+// Evictions returns how many files were evicted so far
+func (m *Manager) Evictions() Evictions {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.evictions
+}
+
+// Memory returns the bytes held for all tracked files, contents and
+// baselines, as counted against MaxBytes
+func (m *Manager) Memory() int64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.bytes
+}
+
+// Limits returns the limits in effect
+func (m *Manager) Limits() Limits {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.limits
+}
+
+// size returns the bytes held for path: its current content plus its
+// baseline if that is a different version
+func (m *Manager) size(path string) int64 {
+	var n int64
+	state := m.states[path]
+	if state != nil {
+		n += int64(len(state.Content))
+	}
+	if baseline := m.baselines[path]; baseline != nil && baseline != state {
+		n += int64(len(baseline.Content))
+	}
+	return n
+}
+
+// touch marks path as the most recently used file
+func (m *Manager) touch(path string) {
+	if elem, ok := m.elems[path]; ok {
+		m.lru.MoveToFront(elem)
+		return
+	}
+	m.elems[path] = m.lru.PushFront(path)
+}
+
+// forget drops path from the usage order
+func (m *Manager) forget(path string) {
+	if elem, ok := m.elems[path]; ok {
+		m.lru.Remove(elem)
+		delete(m.elems, path)
+	}
+}
+
+// enforce evicts the least recently used files until the limits are met.
+// The file keep, which was just updated, is never evicted.
+func (m *Manager) enforce(keep string) {
+	over := func() bool {
+		return (m.limits.MaxFiles > 0 && m.lru.Len() > m.limits.MaxFiles) ||
+			(m.limits.MaxBytes > 0 && m.bytes > m.limits.MaxBytes)
+	}
+
+	for over() {
+		elem := m.lru.Back()
+		if elem == nil {
+			return
+		}
+		path := elem.Value.(string)
+		if path == keep {
+			if m.lru.Len() == 1 {
+				return
+			}
+			// Everything else is gone already or keep is the oldest entry
+			m.lru.MoveToFront(elem)
+			continue
+		}
+
+		size := m.size(path)
+		m.bytes -= size
+		m.evictions.Files++
+		m.evictions.Bytes += size
+
+		delete(m.states, path)
+		delete(m.baselines, path)
+		m.unidentify(path)
+		m.forget(path)
+	}
+}
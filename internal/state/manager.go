@@ -1,9 +1,16 @@
 package state
 
 import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 	"sync"
+
+	"github.com/deemkeen/diffwatch/internal/pathname"
 )
 
 // FileState represents the state of a file
@@ -11,23 +18,40 @@ type FileState struct {
 	Path    string
 	Content []byte
 	Exists  bool
+	Hash    string // Hex SHA-256 of Content, empty if the file doesn't exist
 }
 
 // Manager manages file states for diffing
 type Manager struct {
-	states map[string]*FileState
-	mu     sync.RWMutex
+	states    map[string]*FileState
+	baselines map[string]*FileState // State of each file when first seen this session
+	vanished  map[string]vanished   // Recently deleted or renamed files, for rename detection
+	ids       map[string]fileID     // File each path was last read as
+	owners    map[fileID]string     // Path tracking each file, see Canonical
+	limits    Limits
+	lru       *list.List               // Tracked paths, most recently used first
+	elems     map[string]*list.Element // Position of each path in lru
+	bytes     int64                    // Total size of tracked contents and baselines
+	evictions Evictions
+	mu        sync.RWMutex
 }
 
 // New creates a new state manager
 func New() *Manager {
 	return &Manager{
-		states: make(map[string]*FileState),
+		states:    make(map[string]*FileState),
+		baselines: make(map[string]*FileState),
+		vanished:  make(map[string]vanished),
+		ids:       make(map[string]fileID),
+		owners:    make(map[fileID]string),
+		lru:       list.New(),
+		elems:     make(map[string]*list.Element),
 	}
 }
 
 // Get retrieves the current state of a file
 func (m *Manager) Get(path string) (*FileState, bool) {
+	path = pathname.Normalize(path)
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
@@ -35,11 +59,69 @@ func (m *Manager) Get(path string) (*FileState, bool) {
 	return state, ok
 }
 
-// Update reads the file and updates its state, returning the old state
+// Baseline retrieves the state of a file when it was first seen this session
+func (m *Manager) Baseline(path string) (*FileState, bool) {
+	path = pathname.Normalize(path)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	state, ok := m.baselines[path]
+	return state, ok
+}
+
+// Rebaseline makes the current state of a file its baseline, so that
+// diffs since the baseline only show later changes. It reports whether
+// the file is tracked.
+func (m *Manager) Rebaseline(path string) bool {
+	path = pathname.Normalize(path)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state, ok := m.states[path]
+	if !ok {
+		return false
+	}
+	m.bytes -= m.size(path)
+	m.baselines[path] = state
+	m.bytes += m.size(path)
+	return true
+}
+
+// RebaselineAll makes the current state of every tracked file its
+// baseline and returns how many files there are
+func (m *Manager) RebaselineAll() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for path, state := range m.states {
+		m.bytes -= m.size(path)
+		m.baselines[path] = state
+		m.bytes += m.size(path)
+	}
+	return len(m.states)
+}
+
+// Update reads the file and updates its state, returning the old state.
+// A new path whose content is identical or similar to a file that just
+// disappeared is treated as a rename: it takes over that file's state and
+// baseline, and the returned old state keeps the previous path.
 func (m *Manager) Update(path string) (*FileState, *FileState, error) {
+	path = pathname.Normalize(path)
+
+	// Read before locking, retries may take a while
+	content, readErr := readFile(path)
+	id, identified := identify(path)
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	m.bytes -= m.size(path)
+	defer func() {
+		m.bytes += m.size(path)
+		m.touch(path)
+		m.enforce(path)
+	}()
+
 	// Get old state
 	oldState := m.states[path]
 	if oldState == nil {
@@ -55,15 +137,35 @@ func (m *Manager) Update(path string) (*FileState, *FileState, error) {
 		Exists: true,
 	}
 
-	content, err := os.ReadFile(path)
-	if err != nil {
-		if os.IsNotExist(err) {
+	if readErr != nil {
+		if os.IsNotExist(readErr) {
 			newState.Exists = false
 		} else {
-			return oldState, newState, fmt.Errorf("reading file: %w", err)
+			return oldState, newState, fmt.Errorf("reading file: %w", readErr)
 		}
 	} else {
 		newState.Content = content
+		newState.Hash = HashContent(content)
+	}
+	if newState.Exists && identified {
+		m.identified(path, id)
+	} else {
+		m.unidentify(path)
+	}
+
+	switch {
+	case oldState.Exists && !newState.Exists:
+		m.noteVanished(oldState)
+	case !oldState.Exists && len(newState.Content) > 0 && m.states[path] == nil:
+		// Empty files all look alike, so they are never matched
+		if from := m.findMoved(newState); from != "" {
+			oldState = m.migrate(from, path)
+		}
+	}
+
+	// Remember the first known state as the session baseline
+	if _, ok := m.baselines[path]; !ok {
+		m.baselines[path] = oldState
 	}
 
 	// Update stored state
@@ -72,12 +174,118 @@ func (m *Manager) Update(path string) (*FileState, *FileState, error) {
 	return oldState, newState, nil
 }
 
+// Apply stores a state read elsewhere, e.g. by the instance a session is
+// shared from, as the current state of its file, and returns the previous
+// state. Like Update, the first known state becomes the session baseline.
+func (m *Manager) Apply(newState *FileState) *FileState {
+	path := pathname.Normalize(newState.Path)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.bytes -= m.size(path)
+	defer func() {
+		m.bytes += m.size(path)
+		m.touch(path)
+		m.enforce(path)
+	}()
+
+	oldState := m.states[path]
+	if oldState == nil {
+		oldState = &FileState{Path: path}
+	}
+	if _, ok := m.baselines[path]; !ok {
+		m.baselines[path] = oldState
+	}
+	m.states[path] = newState
+	return oldState
+}
+
+// Set replaces the stored state of a file, e.g. after it was restored
+func (m *Manager) Set(state *FileState) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.bytes -= m.size(state.Path)
+	m.states[state.Path] = state
+	m.bytes += m.size(state.Path)
+	m.touch(state.Path)
+	m.enforce(state.Path)
+}
+
+// Seed sets the current state and session baseline of a file that is not
+// tracked yet, e.g. as known by another process. Tracked files are left
+// untouched. A nil baseline defaults to the current state on the next
+// Update.
+func (m *Manager) Seed(path string, baseline, current *FileState) {
+	path = pathname.Normalize(path)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.states[path]; ok {
+		return
+	}
+
+	m.bytes -= m.size(path)
+	m.states[path] = current
+	if baseline != nil {
+		m.baselines[path] = baseline
+	}
+	m.bytes += m.size(path)
+	m.touch(path)
+	m.enforce(path)
+}
+
+// Stats returns the number of tracked files and the total size of their
+// current content in bytes
+func (m *Manager) Stats() (files int, bytes int64) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, state := range m.states {
+		if state.Exists {
+			files++
+			bytes += int64(len(state.Content))
+		}
+	}
+	return files, bytes
+}
+
 // Remove removes a file from state tracking
 func (m *Manager) Remove(path string) {
+	path = pathname.Normalize(path)
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	m.bytes -= m.size(path)
 	delete(m.states, path)
+	delete(m.baselines, path)
+	delete(m.vanished, path)
+	m.unidentify(path)
+	m.forget(path)
+}
+
+// RemoveTree removes the files below a directory from state tracking,
+// e.g. after the directory was deleted, and returns how many there were
+func (m *Manager) RemoveTree(dir string) int {
+	dir = pathname.Normalize(dir)
+	prefix := dir + string(filepath.Separator)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	removed := 0
+	for path := range m.states {
+		if !strings.HasPrefix(path, prefix) {
+			continue
+		}
+		m.bytes -= m.size(path)
+		delete(m.states, path)
+		delete(m.baselines, path)
+		m.unidentify(path)
+		m.forget(path)
+		removed++
+	}
+	return removed
 }
 
 // Clear removes all tracked states
@@ -86,4 +294,17 @@ func (m *Manager) Clear() {
 	defer m.mu.Unlock()
 
 	m.states = make(map[string]*FileState)
+	m.baselines = make(map[string]*FileState)
+	m.vanished = make(map[string]vanished)
+	m.ids = make(map[string]fileID)
+	m.owners = make(map[fileID]string)
+	m.lru = list.New()
+	m.elems = make(map[string]*list.Element)
+	m.bytes = 0
+}
+
+// HashContent returns the hex SHA-256 digest of content
+func HashContent(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
 }
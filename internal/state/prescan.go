@@ -0,0 +1,91 @@
+package state
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/deemkeen/diffwatch/internal/pathname"
+)
+
+// Progress reports the progress of a prescan. It is safe to read while
+// the prescan is running.
+type Progress struct {
+	Found   atomic.Int64 // Files found so far
+	Scanned atomic.Int64 // Files read and hashed so far
+	Done    atomic.Bool  // The prescan has finished
+}
+
+// Load reads a file and stores its content as the current state and the
+// session baseline, without computing a diff. Files that are already
+// tracked (e.g. because an event arrived first) are left untouched.
+func (m *Manager) Load(path string) error {
+	path = pathname.Normalize(path)
+	content, err := readFile(path)
+	if err != nil {
+		return fmt.Errorf("reading file: %w", err)
+	}
+	id, identified := identify(path)
+
+	state := &FileState{
+		Path:    path,
+		Content: content,
+		Exists:  true,
+		Hash:    HashContent(content),
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.states[path]; ok {
+		return nil
+	}
+	m.bytes -= m.size(path)
+	m.states[path] = state
+	if _, ok := m.baselines[path]; !ok {
+		m.baselines[path] = state
+	}
+	if identified {
+		m.identified(path, id)
+	}
+	m.bytes += m.size(path)
+	m.touch(path)
+	m.enforce(path)
+
+	return nil
+}
+
+// Prescan loads every file produced by walk using a bounded number of
+// workers. Files larger than maxSize are skipped. Read errors for single
+// files are ignored; only errors from walk are returned.
+func (m *Manager) Prescan(walk func(fn func(path string) error) error, workers int, maxSize int64, progress *Progress) error {
+	defer progress.Done.Store(true)
+
+	paths := make(chan string, 100)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range paths {
+				if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() && info.Size() <= maxSize {
+					m.Load(path)
+				}
+				progress.Scanned.Add(1)
+			}
+		}()
+	}
+
+	err := walk(func(path string) error {
+		progress.Found.Add(1)
+		paths <- path
+		return nil
+	})
+
+	close(paths)
+	wg.Wait()
+
+	return err
+}
@@ -0,0 +1,65 @@
+package state
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ErrLocked is returned for files another process keeps locked against
+// reading (Windows only)
+var ErrLocked = errors.New("file locked by another process")
+
+// readFile reads path like os.ReadFile, retrying failures that may be
+// transient. A missing file is reported right away: it was deleted. Files
+// still locked after the retries fail with ErrLocked.
+func readFile(path string) ([]byte, error) {
+	content, err := retry(func() ([]byte, error) {
+		return readShared(path)
+	}, func(err error) bool {
+		return !os.IsNotExist(err)
+	})
+	if err != nil && isLocked(err) {
+		return nil, fmt.Errorf("%w: %w", ErrLocked, err)
+	}
+	return content, err
+}
+
+// readShared reads a whole file, opened so that other processes writing
+// it don't keep it from being read
+func readShared(path string) ([]byte, error) {
+	f, err := openShared(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// HashFile returns the hex SHA-256 digest of a file's content, like
+// HashContent of what readFile returns, without keeping the content in
+// memory. Failures are retried and reported like readFile's.
+func HashFile(path string) (string, error) {
+	hash, err := retry(func() (string, error) {
+		f, err := openShared(path)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+
+		h := sha256.New()
+		if _, err := io.Copy(h, f); err != nil {
+			return "", err
+		}
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}, func(err error) bool {
+		return !os.IsNotExist(err)
+	})
+	if err != nil && isLocked(err) {
+		return "", fmt.Errorf("%w: %w", ErrLocked, err)
+	}
+	return hash, err
+}
@@ -0,0 +1,39 @@
+//go:build windows
+
+package state
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// Errors for files opened without read sharing or with a locked byte range
+const (
+	errorSharingViolation syscall.Errno = 32
+	errorLockViolation    syscall.Errno = 33
+)
+
+// openShared opens path for reading with backup semantics, sharing it
+// with writers and deleters. Unlike os.Open this also reads files that
+// other processes have open for writing or deletion (e.g. logs, Office
+// documents, files being replaced by an atomic save).
+func openShared(path string) (*os.File, error) {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	h, err := syscall.CreateFile(p, syscall.GENERIC_READ,
+		syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE,
+		nil, syscall.OPEN_EXISTING, syscall.FILE_ATTRIBUTE_NORMAL|syscall.FILE_FLAG_BACKUP_SEMANTICS, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	return os.NewFile(uintptr(h), path), nil
+}
+
+// isLocked reports whether err means another process denied sharing the
+// file or locked the part being read
+func isLocked(err error) bool {
+	return errors.Is(err, errorSharingViolation) || errors.Is(err, errorLockViolation)
+}
@@ -0,0 +1,121 @@
+package state
+
+import (
+	"bytes"
+	"os"
+	"time"
+)
+
+// renameWindow is how long a vanished file can still be matched with a
+// file appearing under a new name
+const renameWindow = 2 * time.Second
+
+// vanished is the last known state of a file that disappeared
+type vanished struct {
+	state *FileState
+	at    time.Time
+}
+
+// noteVanished remembers the last state of a file that disappeared so it
+// can be matched with a rename target, and forgets expired entries
+func (m *Manager) noteVanished(state *FileState) {
+	now := time.Now()
+	for path, v := range m.vanished {
+		if now.Sub(v.at) > renameWindow {
+			delete(m.vanished, path)
+		}
+	}
+	m.vanished[state.Path] = vanished{state: state, at: now}
+}
+
+// minSimilarity is the share of lines, in percent, a new file must have in
+// common with a file that just disappeared to be taken for its rename
+const minSimilarity = 50
+
+// findMoved returns the path the new state was renamed from: a file that
+// vanished recently, or a tracked file that no longer exists (the rename
+// event may not have been processed yet). Identical content wins,
+// otherwise the most similar file of at least minSimilarity. Returns "" if
+// there is no match.
+func (m *Manager) findMoved(state *FileState) string {
+	now := time.Now()
+	var candidates []*FileState
+	for _, v := range m.vanished {
+		if now.Sub(v.at) <= renameWindow {
+			candidates = append(candidates, v.state)
+		}
+	}
+	for path, old := range m.states {
+		if path == state.Path || !old.Exists {
+			continue
+		}
+		if _, err := os.Lstat(path); os.IsNotExist(err) {
+			candidates = append(candidates, old)
+		}
+	}
+
+	best, bestScore := "", minSimilarity-1
+	for _, old := range candidates {
+		if old.Hash == state.Hash {
+			return old.Path
+		}
+		if score := Similarity(old.Content, state.Content); score > bestScore {
+			best, bestScore = old.Path, score
+		}
+	}
+	return best
+}
+
+// Similarity returns the share of lines two contents have in common, in
+// percent. Line order is ignored, so it is cheap enough to compare a new
+// file with every file that just disappeared.
+func Similarity(a, b []byte) int {
+	if bytes.Equal(a, b) {
+		return 100
+	}
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	// Contents of very different size are never taken for a rename
+	if len(a) > 3*len(b) || len(b) > 3*len(a) {
+		return 0
+	}
+
+	counts := make(map[string]int)
+	total := 0
+	for line := range bytes.Lines(a) {
+		counts[string(line)]++
+		total++
+	}
+	common := 0
+	for line := range bytes.Lines(b) {
+		if counts[string(line)] > 0 {
+			counts[string(line)]--
+			common++
+		}
+		total++
+	}
+	return common * 200 / total
+}
+
+// migrate moves the tracking of from to the path to, returning the last
+// existing state of from
+func (m *Manager) migrate(from, to string) *FileState {
+	old := m.states[from]
+	if v, ok := m.vanished[from]; ok {
+		old = v.state
+	}
+
+	// The caller accounts for the size of to
+	m.bytes -= m.size(from)
+	if baseline, ok := m.baselines[from]; ok {
+		m.baselines[to] = baseline
+	}
+
+	delete(m.states, from)
+	delete(m.baselines, from)
+	delete(m.vanished, from)
+	m.unidentify(from)
+	m.forget(from)
+	return old
+}
@@ -0,0 +1,41 @@
+package state
+
+import (
+	"os"
+	"time"
+)
+
+// retryDelays are the waits between attempts to read a file. An editor in
+// the middle of an atomic save may briefly hold a file open exclusively
+// (Windows) or have it deleted before the new version is renamed in place.
+var retryDelays = []time.Duration{
+	10 * time.Millisecond,
+	20 * time.Millisecond,
+	40 * time.Millisecond,
+	80 * time.Millisecond,
+}
+
+// Stat returns the file info of path like os.Stat, retrying failures that
+// may be transient, including a missing file that may be about to be
+// replaced. Only errors that persist are returned.
+func Stat(path string) (os.FileInfo, error) {
+	return retry(func() (os.FileInfo, error) {
+		return os.Stat(path)
+	}, func(error) bool {
+		return true
+	})
+}
+
+// retry calls fn until it succeeds, fails with an error that is not
+// transient, or retryDelays are used up
+func retry[T any](fn func() (T, error), transient func(error) bool) (T, error) {
+	v, err := fn()
+	for _, delay := range retryDelays {
+		if err == nil || !transient(err) {
+			break
+		}
+		time.Sleep(delay)
+		v, err = fn()
+	}
+	return v, err
+}
@@ -0,0 +1,244 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite" // Pure Go SQLite driver
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS events (
+	id       INTEGER PRIMARY KEY AUTOINCREMENT,
+	time     INTEGER NOT NULL,
+	path     TEXT    NOT NULL,
+	op       TEXT    NOT NULL,
+	old_hash TEXT    NOT NULL DEFAULT '',
+	new_hash TEXT    NOT NULL DEFAULT '',
+	added    INTEGER NOT NULL DEFAULT 0,
+	deleted  INTEGER NOT NULL DEFAULT 0,
+	binary   INTEGER NOT NULL DEFAULT 0,
+	level    TEXT    NOT NULL DEFAULT 'info',
+	patch    TEXT    NOT NULL DEFAULT '',
+	seq      INTEGER NOT NULL DEFAULT 0,
+	note     TEXT    NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS events_time ON events(time);
+CREATE INDEX IF NOT EXISTS events_path ON events(path);
+`
+
+// Record is a single recorded change event
+type Record struct {
+	Time    time.Time
+	Path    string
+	Op      string
+	OldHash string
+	NewHash string
+	Added   int
+	Deleted int
+	Binary  bool
+	Level   string
+	Patch   string // Unified diff of the change, if recorded
+	Seq     uint64 // Sequence number of the event in its session (0: not recorded)
+	Note    string // Free-text note attached to the change, see Annotate
+}
+
+// FileSummary aggregates the records of a single file
+type FileSummary struct {
+	Path    string
+	Changes int
+	Added   int
+	Deleted int
+	First   time.Time
+	Last    time.Time
+	LastOp  string // Operation of the most recent record
+}
+
+// Filter restricts which records a query returns. Zero values are ignored.
+type Filter struct {
+	Since time.Time
+	Until time.Time
+	Path  string // Substring of the path
+	Op    string
+	Limit int // Only the most recent records (Events only)
+}
+
+// DB is a SQLite-backed change database
+type DB struct {
+	db *sql.DB
+}
+
+// Open opens (creating if necessary) the change database at path
+func Open(path string) (*DB, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("opening database %s: %w", path, err)
+	}
+
+	// SQLite only supports a single writer
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("initializing database %s: %w", path, err)
+	}
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("upgrading database %s: %w", path, err)
+	}
+
+	return &DB{db: db}, nil
+}
+
+// migrate adds columns missing from databases created by older versions
+func migrate(db *sql.DB) error {
+	columns := []struct{ name, def string }{
+		{"patch", "TEXT NOT NULL DEFAULT ''"},
+		{"seq", "INTEGER NOT NULL DEFAULT 0"},
+		{"note", "TEXT NOT NULL DEFAULT ''"},
+	}
+
+	for _, c := range columns {
+		var n int
+		err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('events') WHERE name = ?`, c.name).Scan(&n)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			continue
+		}
+		if _, err := db.Exec(`ALTER TABLE events ADD COLUMN ` + c.name + ` ` + c.def); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the database
+func (d *DB) Close() error {
+	return d.db.Close()
+}
+
+// Record stores a change event
+func (d *DB) Record(r Record) error {
+	_, err := d.db.Exec(
+		`INSERT INTO events (time, path, op, old_hash, new_hash, added, deleted, binary, level, patch, seq, note)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.Time.UnixMilli(), r.Path, r.Op, r.OldHash, r.NewHash,
+		r.Added, r.Deleted, r.Binary, r.Level, r.Patch, int64(r.Seq), r.Note,
+	)
+	if err != nil {
+		return fmt.Errorf("recording event: %w", err)
+	}
+	return nil
+}
+
+// Annotate sets the note of the newest record of path at time t, e.g. an
+// observation made while watching the change. An empty note removes it.
+func (d *DB) Annotate(path string, t time.Time, note string) error {
+	res, err := d.db.Exec(
+		`UPDATE events SET note = ? WHERE id = (SELECT MAX(id) FROM events WHERE path = ? AND time = ?)`,
+		note, path, t.UnixMilli(),
+	)
+	if err != nil {
+		return fmt.Errorf("annotating event: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("annotating event: no change of %s recorded at %s", path, t.Format("15:04:05"))
+	}
+	return nil
+}
+
+// Events returns all records matching the filter, oldest first
+func (d *DB) Events(f Filter) ([]Record, error) {
+	where, args := f.where()
+
+	query := `SELECT time, path, op, old_hash, new_hash, added, deleted, binary, level, patch, seq, note, id
+		 FROM events` + where
+	if f.Limit > 0 {
+		query += ` ORDER BY time DESC, id DESC LIMIT ?`
+		args = append(args, f.Limit)
+	}
+
+	rows, err := d.db.Query(`SELECT time, path, op, old_hash, new_hash, added, deleted, binary, level, patch, seq, note
+		 FROM (`+query+`) ORDER BY time, id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying events: %w", err)
+	}
+	defer rows.Close()
+
+	var records []Record
+	for rows.Next() {
+		var r Record
+		var millis, seq int64
+		if err := rows.Scan(&millis, &r.Path, &r.Op, &r.OldHash, &r.NewHash,
+			&r.Added, &r.Deleted, &r.Binary, &r.Level, &r.Patch, &seq, &r.Note); err != nil {
+			return nil, fmt.Errorf("reading event: %w", err)
+		}
+		r.Time = time.UnixMilli(millis)
+		r.Seq = uint64(seq)
+		records = append(records, r)
+	}
+
+	return records, rows.Err()
+}
+
+// Files returns per-file summaries of the records matching the filter,
+// ordered by most recent change first
+func (d *DB) Files(f Filter) ([]FileSummary, error) {
+	where, args := f.where()
+
+	// With MAX(), SQLite takes the bare op column from the most recent row
+	rows, err := d.db.Query(
+		`SELECT path, COUNT(*), SUM(added), SUM(deleted), MIN(time), MAX(time), op
+		 FROM events`+where+` GROUP BY path ORDER BY MAX(time) DESC`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying files: %w", err)
+	}
+	defer rows.Close()
+
+	var summaries []FileSummary
+	for rows.Next() {
+		var s FileSummary
+		var first, last int64
+		if err := rows.Scan(&s.Path, &s.Changes, &s.Added, &s.Deleted, &first, &last, &s.LastOp); err != nil {
+			return nil, fmt.Errorf("reading file summary: %w", err)
+		}
+		s.First = time.UnixMilli(first)
+		s.Last = time.UnixMilli(last)
+		summaries = append(summaries, s)
+	}
+
+	return summaries, rows.Err()
+}
+
+// where builds the WHERE clause for a filter
+func (f Filter) where() (string, []any) {
+	var clauses []string
+	var args []any
+
+	if !f.Since.IsZero() {
+		clauses = append(clauses, "time >= ?")
+		args = append(args, f.Since.UnixMilli())
+	}
+	if !f.Until.IsZero() {
+		clauses = append(clauses, "time <= ?")
+		args = append(args, f.Until.UnixMilli())
+	}
+	if f.Path != "" {
+		clauses = append(clauses, "instr(path, ?) > 0")
+		args = append(args, f.Path)
+	}
+	if f.Op != "" {
+		clauses = append(clauses, "op = ?")
+		args = append(args, f.Op)
+	}
+
+	if len(clauses) == 0 {
+		return "", nil
+	}
+
+	return " WHERE " + strings.Join(clauses, " AND "), args
+}
@@ -0,0 +1,83 @@
+package suppress
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/deemkeen/diffwatch/internal/config"
+	"github.com/deemkeen/diffwatch/internal/diff"
+	"github.com/deemkeen/diffwatch/internal/match"
+)
+
+// rule is a compiled suppression rule
+type rule struct {
+	pattern string
+	ignore  []*regexp.Regexp
+}
+
+// Suppressor detects changes that only touch noise lines
+type Suppressor struct {
+	rules []rule
+}
+
+// New compiles the given suppression rules
+func New(rules []config.SuppressRule) (*Suppressor, error) {
+	s := &Suppressor{}
+
+	for i, r := range rules {
+		compiled := rule{pattern: r.Pattern}
+		for _, expr := range r.Ignore {
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return nil, fmt.Errorf("suppress rule %d: compiling %q: %w", i+1, expr, err)
+			}
+			compiled.ignore = append(compiled.ignore, re)
+		}
+		s.rules = append(s.rules, compiled)
+	}
+
+	return s, nil
+}
+
+// Noise reports whether every changed line of the diff matches an ignore
+// expression of a rule applying to relPath (relative to the watch root).
+// Creations, deletions and binary changes are never noise.
+func (s *Suppressor) Noise(relPath string, result *diff.Result) bool {
+	if s == nil || result == nil || !result.HasDiff ||
+		result.IsNew || result.IsDeleted || result.IsBinary {
+		return false
+	}
+
+	var ignore []*regexp.Regexp
+	for _, r := range s.rules {
+		if r.pattern == "" || match.Glob(r.pattern, relPath) {
+			ignore = append(ignore, r.ignore...)
+		}
+	}
+	if len(ignore) == 0 {
+		return false
+	}
+
+	changed := 0
+	for _, line := range result.Lines {
+		if line.Type != diff.LineAdded && line.Type != diff.LineDeleted {
+			continue
+		}
+		changed++
+		if !matchesAny(ignore, line.Content) {
+			return false
+		}
+	}
+
+	return changed > 0
+}
+
+// matchesAny reports whether s matches any of the expressions
+func matchesAny(exprs []*regexp.Regexp, s string) bool {
+	for _, re := range exprs {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,195 @@
+package ui
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+
+	"github.com/charmbracelet/x/ansi"
+
+	"github.com/deemkeen/diffwatch/internal/diff"
+	"github.com/deemkeen/diffwatch/internal/lang"
+	"github.com/deemkeen/diffwatch/internal/severity"
+)
+
+// a11yMaxLines is the number of changed lines printed per diff in
+// accessible mode
+const a11yMaxLines = 100
+
+// a11yState tracks what accessible mode (Options.A11y) has printed. The
+// session is printed as plain lines instead of drawing the screen: each
+// event log entry once, followed by the changed lines of its diff, with
+// words where the screen uses colors, icons and symbols.
+type a11yState struct {
+	started bool   // The watched paths were printed
+	printed int    // Event log entries printed, compared to Model.logged
+	err     string // Last error printed
+
+	external []externalDiffMsg // External differ outputs not printed yet
+}
+
+// printLinear prints what happened since the last call in accessible mode
+func (m *Model) printLinear() {
+	w := m.opts.Output
+
+	if !m.a11y.started {
+		m.a11y.started = true
+		recursive := "not recursively"
+		if m.watcher.IsRecursive() {
+			recursive = "recursively"
+		}
+		fmt.Fprintf(w, "Watching %s, %s. Press Control-C to quit.\n", strings.Join(m.watcher.Roots(), ", "), recursive)
+	}
+
+	// Entries appended since the last call, unless already evicted
+	if n := m.logged - m.a11y.printed; n > 0 {
+		for _, entry := range m.events[max(len(m.events)-n, 0):] {
+			fmt.Fprintln(w, m.spokenEntry(entry))
+			if entry.result != nil && !entry.noise {
+				printSpokenDiff(w, entry.result)
+			}
+		}
+		m.a11y.printed = m.logged
+	}
+
+	m.printSpokenExternalDiffs(w)
+
+	// Protected path alerts need no acknowledgement without keys
+	for _, alert := range m.protectAlerts {
+		text := fmt.Sprintf("critical: protected path changed: %s: %s.", alert.op, m.displayPath(alert.path))
+		switch {
+		case alert.restored:
+			text += " The previous version was restored, the change was saved as patch " + alert.patchPath
+		case alert.err != nil:
+			text += fmt.Sprintf(" Restore failed: %v", alert.err)
+		default:
+			text += " The change was not reverted."
+		}
+		fmt.Fprintln(w, text)
+	}
+	m.protectAlerts = nil
+
+	if m.err != nil && m.err.Error() != m.a11y.err {
+		m.a11y.err = m.err.Error()
+		fmt.Fprintf(w, "error: %s\n", m.a11y.err)
+	}
+}
+
+// spokenEntry returns an event log entry as plain words: its level unless
+// info, its text without icons, and its line counts
+func (m *Model) spokenEntry(entry logEntry) string {
+	text := plainText(ansi.Strip(m.entryText(entry, 0)))
+
+	switch entry.level {
+	case severity.Warn:
+		text = "warning: " + text
+	case severity.Critical:
+		text = "critical: " + text
+	}
+
+	if result := entry.result; result != nil && result.HasDiff && !result.IsBinary {
+		added, deleted := result.Stats()
+		text += fmt.Sprintf(", %s added, %s removed", countLines(added), countLines(deleted))
+	}
+	if entry.noise {
+		text += ", only noise lines changed"
+	}
+	return text
+}
+
+// printSpokenDiff prints the changed lines of a diff, each introduced by
+// what happened to it
+func printSpokenDiff(w io.Writer, result *diff.Result) {
+	if result.Dangerous != "" {
+		fmt.Fprintf(w, "  danger: this change %s\n", result.Dangerous)
+	}
+
+	switch {
+	case result.IsBinary && result.Structure != "":
+		printSpokenChanges(w, result)
+		return
+	case result.IsBinary:
+		fmt.Fprintln(w, "  binary file, no line diff")
+		return
+	case result.TooLarge:
+		fmt.Fprintln(w, "  file too large to diff")
+		return
+	case result.Structure != "":
+		printSpokenChanges(w, result)
+		return
+	case result.SummaryOnly != "":
+		fmt.Fprintf(w, "  changed lines not shown: %s\n", result.SummaryOnly)
+		return
+	}
+
+	printed := 0
+	headers := scopeHeaders(result.Lines)
+	for i, line := range result.Lines {
+		if scope, ok := headers[i]; ok {
+			fmt.Fprintf(w, "  in %s:\n", scope)
+		}
+
+		content, oldContent := line.Content, line.OldContent
+		if result.Language == lang.Dotenv {
+			content, oldContent = diff.MaskEnv(content, "masked value"), diff.MaskEnv(oldContent, "masked value")
+		}
+
+		var text string
+		switch line.Type {
+		case diff.LineAdded:
+			text = fmt.Sprintf("added line %d: %s", line.NewLineNum, spokenLine(content))
+		case diff.LineDeleted:
+			text = fmt.Sprintf("removed line %d: %s", line.OldLineNum, spokenLine(content))
+		case diff.LineModified:
+			text = fmt.Sprintf("changed line %d: %s, was: %s", line.NewLineNum, spokenLine(content), spokenLine(oldContent))
+		default:
+			continue
+		}
+
+		if printed == a11yMaxLines {
+			fmt.Fprintln(w, "  more changed lines left out")
+			return
+		}
+		fmt.Fprintln(w, "  "+text)
+		printed++
+	}
+}
+
+// spokenLine returns the content of a diff line, naming blank lines
+func spokenLine(content string) string {
+	if strings.TrimSpace(content) == "" {
+		return "blank"
+	}
+	return ansi.Strip(content)
+}
+
+// countLines returns n with "line" or "lines"
+func countLines(n int) string {
+	if n == 1 {
+		return "1 line"
+	}
+	return fmt.Sprintf("%d lines", n)
+}
+
+// plainText removes the icons and emoji of s, with the space after them,
+// and spells out arrows
+func plainText(s string) string {
+	s = strings.ReplaceAll(s, " → ", " to ")
+
+	var b strings.Builder
+	skipSpace := false
+	for _, r := range s {
+		switch {
+		case unicode.Is(unicode.So, r), r == '\uFE0F':
+			skipSpace = true
+			continue
+		case r == ' ' && skipSpace:
+			skipSpace = false
+			continue
+		}
+		skipSpace = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,101 @@
+package ui
+
+import (
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/deemkeen/diffwatch/internal/attrib"
+	"github.com/deemkeen/diffwatch/internal/pathname"
+	"github.com/deemkeen/diffwatch/internal/watcher"
+)
+
+// attribMsg delivers the process that made a change
+type attribMsg struct {
+	path    string
+	process string
+}
+
+// filteredMsg delivers a batch of changes with the processes that made
+// them, in the order the source sent them
+type filteredMsg struct {
+	events    []watcher.Event
+	processes []attrib.Process
+	found     []bool
+}
+
+// attribCmd returns a command looking up the process that made a change,
+// or nil if changes aren't attributed. Removed files have no writer to
+// find. With a process filter, changes were attributed before they were
+// processed.
+func (m *Model) attribCmd(event watcher.Event) tea.Cmd {
+	a := m.opts.Attributor
+	if a == nil || event.Op == "remove" || m.opts.ProcessFilter != nil {
+		return nil
+	}
+	return func() tea.Msg {
+		p, ok := a.Lookup(event.Path)
+		if !ok {
+			return nil
+		}
+		// Process names are chosen by the process, so they are escaped like
+		// file names
+		return attribMsg{path: event.Path, process: pathname.Display(p.String())}
+	}
+}
+
+// handleAttrib shows the process that made a change with the latest
+// event log entry of the file
+func (m *Model) handleAttrib(msg attribMsg) {
+	m.log.Debug("change attributed", "path", msg.path, "process", msg.process)
+	for i := len(m.events) - 1; i >= 0; i-- {
+		if m.events[i].path == msg.path {
+			m.events[i].process = msg.process
+			return
+		}
+	}
+}
+
+// filterCmd returns a command attributing a batch of changes for the
+// process filter. Further changes wait until the batch is handled, so
+// they keep their order.
+func (m *Model) filterCmd(events []watcher.Event) tea.Cmd {
+	if len(events) == 0 {
+		return nil
+	}
+	m.filtering = true
+	a := m.opts.Attributor
+	return func() tea.Msg {
+		msg := filteredMsg{
+			events:    events,
+			processes: make([]attrib.Process, len(events)),
+			found:     make([]bool, len(events)),
+		}
+		for i, event := range events {
+			if event.Op != "remove" {
+				msg.processes[i], msg.found[i] = a.Lookup(event.Path)
+			}
+		}
+		return msg
+	}
+}
+
+// handleFiltered shows the changes of a batch that pass the process
+// filter. The others still update the tracked contents, so the next shown
+// change of a file diffs against what the filtered process left behind.
+func (m *Model) handleFiltered(msg filteredMsg) tea.Cmd {
+	m.filtering = false
+
+	var cmds []tea.Cmd
+	for i, event := range msg.events {
+		p, ok := msg.processes[i], msg.found[i]
+		if !m.opts.ProcessFilter.Match(p, ok) {
+			m.log.Debug("change filtered by process", "path", event.Path, "op", event.Op, "process", p.String(), "attributed", ok)
+			m.processEvent(&event)
+			delete(m.viaTemp, event.Path)
+			continue
+		}
+		cmds = append(cmds, m.handleFileEvent(event))
+		if ok {
+			m.handleAttrib(attribMsg{path: event.Path, process: pathname.Display(p.String())})
+		}
+	}
+	return tea.Batch(cmds...)
+}
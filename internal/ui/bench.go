@@ -0,0 +1,187 @@
+package ui
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/deemkeen/diffwatch/internal/watcher"
+)
+
+// benchSamples is the number of latest events latency is reported over
+const benchSamples = 1000
+
+// Latency stages of an event, in the order they happen
+const (
+	stageDebounce = iota // Raw event until the UI receives it
+	stageCoalesce        // Received until processing starts
+	stageRead            // Reading the file
+	stageDiff            // Computing the diff
+	stageRender          // Processed until the next frame is rendered
+	stageTotal           // Raw event until rendered
+	numStages
+)
+
+var stageNames = [numStages]string{"debounce", "coalesce", "read", "diff", "render", "total"}
+
+// timing is the latency of an event being processed, by stage
+type timing struct {
+	event     time.Time // Raw event
+	processed time.Time
+	stages    [numStages]time.Duration
+	measured  [numStages]bool
+}
+
+// bench measures the latency of events from the raw file system event to
+// the rendered diff. Methods are nil-safe, so a nil bench measures
+// nothing.
+type bench struct {
+	received   map[string]time.Time // When the UI received the pending event of each file
+	current    *timing              // Event being processed
+	unrendered []*timing            // Processed events waiting for the next frame
+	samples    [numStages][]time.Duration
+	events     int // Events measured this session
+}
+
+// newBench returns a bench if enabled, nil otherwise
+func newBench(enabled bool) *bench {
+	if !enabled {
+		return nil
+	}
+	return &bench{received: make(map[string]time.Time)}
+}
+
+// receive notes that the UI received an event. A later event for the
+// same file replaces it while coalescing.
+func (b *bench) receive(event watcher.Event) {
+	if b == nil {
+		return
+	}
+	b.received[event.Path] = time.Now()
+}
+
+// begin starts measuring the processing of an event
+func (b *bench) begin(event watcher.Event) {
+	if b == nil {
+		return
+	}
+	now := time.Now()
+	t := &timing{event: event.Timestamp}
+	if received, ok := b.received[event.Path]; ok {
+		t.set(stageDebounce, received.Sub(event.Timestamp))
+		t.set(stageCoalesce, now.Sub(received))
+		delete(b.received, event.Path)
+	}
+	b.current = t
+}
+
+// measure adds the time since start to a stage of the event being
+// processed
+func (b *bench) measure(stage int, start time.Time) {
+	if b == nil || b.current == nil {
+		return
+	}
+	b.current.set(stage, b.current.stages[stage]+time.Since(start))
+}
+
+// end finishes processing the current event; its render stage ends with
+// the next frame
+func (b *bench) end() {
+	if b == nil || b.current == nil {
+		return
+	}
+	b.current.processed = time.Now()
+	b.unrendered = append(b.unrendered, b.current)
+	b.current = nil
+}
+
+// rendered completes the events processed before a frame was rendered
+func (b *bench) rendered() {
+	if b == nil || len(b.unrendered) == 0 {
+		return
+	}
+	now := time.Now()
+	for _, t := range b.unrendered {
+		t.set(stageRender, now.Sub(t.processed))
+		t.set(stageTotal, now.Sub(t.event))
+		for stage := range numStages {
+			if t.measured[stage] {
+				b.samples[stage] = append(b.samples[stage], t.stages[stage])
+				if n := len(b.samples[stage]); n > benchSamples {
+					b.samples[stage] = b.samples[stage][n-benchSamples:]
+				}
+			}
+		}
+		b.events++
+	}
+	b.unrendered = b.unrendered[:0]
+}
+
+// set records the duration of a stage
+func (t *timing) set(stage int, d time.Duration) {
+	t.stages[stage] = max(d, 0)
+	t.measured[stage] = true
+}
+
+// percentiles returns the median, 95th percentile and maximum of a
+// stage's samples; ok is false without samples
+func (b *bench) percentiles(stage int) (p50, p95, worst time.Duration, ok bool) {
+	samples := slices.Clone(b.samples[stage])
+	if len(samples) == 0 {
+		return 0, 0, 0, false
+	}
+	slices.Sort(samples)
+	at := func(p int) time.Duration {
+		return samples[(len(samples)-1)*p/100]
+	}
+	return at(50), at(95), samples[len(samples)-1], true
+}
+
+// formatLatency formats a duration in milliseconds
+func formatLatency(d time.Duration) string {
+	return fmt.Sprintf("%.1fms", float64(d)/float64(time.Millisecond))
+}
+
+// renderBench renders the median and 95th percentile latency of each
+// stage on one line
+func (m *Model) renderBench() string {
+	style := lipgloss.NewStyle().Foreground(m.theme.muted)
+	if m.bench.events == 0 {
+		return style.Render("latency: waiting for events")
+	}
+
+	var fields []string
+	for stage := range numStages {
+		if p50, p95, _, ok := m.bench.percentiles(stage); ok {
+			fields = append(fields, fmt.Sprintf("%s %s/%s", stageNames[stage], formatLatency(p50), formatLatency(p95)))
+		}
+	}
+	return style.Render("latency p50/p95: " + strings.Join(fields, m.glyphs.dot))
+}
+
+// BenchReport returns a table of the latency of each stage over the
+// latest events, or "" if latency isn't measured
+func (m *Model) BenchReport() string {
+	if m.bench == nil {
+		return ""
+	}
+	if m.bench.events == 0 {
+		return "No events measured.\n"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Latency of the last %d events:\n", min(m.bench.events, benchSamples))
+	fmt.Fprintf(&b, "  %-10s %10s %10s %10s\n", "stage", "p50", "p95", "max")
+	for stage := range numStages {
+		if p50, p95, worst, ok := m.bench.percentiles(stage); ok {
+			fmt.Fprintf(&b, "  %-10s %10s %10s %10s\n", stageNames[stage], formatLatency(p50), formatLatency(p95), formatLatency(worst))
+		}
+	}
+	if cache := m.diffEngine.CacheStats(); cache.Hits+cache.Misses > 0 {
+		fmt.Fprintf(&b, "Diff cache: %d hits, %d misses (%d%%), %d diffs kept (%s)\n",
+			cache.Hits, cache.Misses, cache.HitRate(), cache.Entries, formatBytes(cache.Bytes))
+	}
+	return b.String()
+}
@@ -0,0 +1,186 @@
+package ui
+
+import (
+	"container/list"
+	"errors"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/deemkeen/diffwatch/internal/diff"
+	"github.com/deemkeen/diffwatch/internal/git"
+)
+
+// blameMsg delivers the result of an asynchronous git blame
+type blameMsg struct {
+	key   string
+	path  string
+	blame git.Blame
+	err   error
+}
+
+// blameKey identifies the blame of a diff's old content
+func blameKey(result *diff.Result) string {
+	if result == nil || result.OldState == nil || !result.OldState.Exists {
+		return ""
+	}
+	return result.Path + "@" + result.OldState.Hash
+}
+
+// maxBlames is the number of blamed contents kept for showing again
+const maxBlames = 32
+
+// blameEntry is the blame of one old content, nil while it's running
+type blameEntry struct {
+	key, path string
+	blame     git.Blame
+}
+
+// blameCache keeps the latest blames by blameKey, evicting the least
+// recently used beyond maxBlames. The zero value is empty.
+type blameCache struct {
+	lru   list.List // Entries, most recently used first
+	elems map[string]*list.Element
+}
+
+// get returns the blame of key, false if it isn't kept or started
+func (c *blameCache) get(key string) (git.Blame, bool) {
+	elem, ok := c.elems[key]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	return elem.Value.(*blameEntry).blame, true
+}
+
+// put keeps the blame of key for the file at path; a nil blame reserves
+// the key while it runs
+func (c *blameCache) put(key, path string, blame git.Blame) {
+	if c.elems == nil {
+		c.elems = make(map[string]*list.Element)
+	}
+	if elem, ok := c.elems[key]; ok {
+		elem.Value.(*blameEntry).blame = blame
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.elems[key] = c.lru.PushFront(&blameEntry{key: key, path: path, blame: blame})
+	for c.lru.Len() > maxBlames {
+		c.remove(c.lru.Back())
+	}
+}
+
+// forget drops the blames of the file at path, e.g. once it changed
+func (c *blameCache) forget(path string) {
+	for elem := c.lru.Front(); elem != nil; {
+		next := elem.Next()
+		if elem.Value.(*blameEntry).path == path {
+			c.remove(elem)
+		}
+		elem = next
+	}
+}
+
+// remove drops an entry
+func (c *blameCache) remove(elem *list.Element) {
+	delete(c.elems, c.lru.Remove(elem).(*blameEntry).key)
+}
+
+// toggleBlame turns blame annotations on or off, detecting the git
+// repository on first use
+func (m *Model) toggleBlame() tea.Cmd {
+	if m.showBlame {
+		m.showBlame = false
+		return nil
+	}
+
+	if _, err := m.repoRoot(); err != nil {
+		m.err = err
+		return nil
+	}
+
+	m.showBlame = true
+	return m.blameCmd()
+}
+
+// repoRoot returns the git repository root, detecting it on first use
+func (m *Model) repoRoot() (string, error) {
+	if m.mirrored() {
+		return "", errors.New("git is not available for files that can't be read locally")
+	}
+	if m.gitRoot == "" {
+		root, err := git.Root(m.watcher.WatchPath())
+		if err != nil {
+			return "", err
+		}
+		m.gitRoot = root
+	}
+	return m.gitRoot, nil
+}
+
+// blameCmd returns a command blaming the old content of the displayed
+// diffs that haven't been blamed yet, or nil if there is nothing to do
+func (m *Model) blameCmd() tea.Cmd {
+	if !m.showBlame {
+		return nil
+	}
+
+	current, baseline := m.shownDiffs()
+
+	var cmds []tea.Cmd
+	for _, result := range []*diff.Result{current, baseline} {
+		key := blameKey(result)
+		if key == "" || result.IsBinary {
+			continue
+		}
+		if _, ok := m.blames.get(key); ok {
+			continue
+		}
+
+		// Reserve the key so the blame isn't started twice
+		m.blames.put(key, result.Path, nil)
+
+		root := m.gitRoot
+		path := result.Path
+		content := result.OldState.Content
+		cmds = append(cmds, func() tea.Msg {
+			blame, err := git.BlameContent(root, path, content)
+			return blameMsg{key: key, path: path, blame: blame, err: err}
+		})
+	}
+
+	return tea.Batch(cmds...)
+}
+
+// handleBlame stores the result of a blame, unless its file changed
+// while it ran
+func (m *Model) handleBlame(msg blameMsg) {
+	if msg.err != nil {
+		m.err = msg.err
+		return
+	}
+	if _, ok := m.blames.get(msg.key); ok {
+		m.blames.put(msg.key, msg.path, msg.blame)
+	}
+}
+
+// blameAnnotation returns the rendered blame annotation for a deleted line
+func (m *Model) blameAnnotation(result *diff.Result, line diff.DiffLine) string {
+	if !m.showBlame || line.Type != diff.LineDeleted {
+		return ""
+	}
+
+	blame, _ := m.blames.get(blameKey(result))
+	entry, ok := blame[line.OldLineNum]
+	if !ok {
+		return ""
+	}
+
+	blameStyle := lipgloss.NewStyle().
+		Foreground(m.theme.muted).
+		Italic(true)
+
+	if entry.Hash == "" {
+		return blameStyle.Render("  " + m.glyphs.blame + " uncommitted")
+	}
+	return blameStyle.Render("  " + m.glyphs.blame + " " + entry.Hash + " " + entry.Author)
+}
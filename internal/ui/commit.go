@@ -0,0 +1,37 @@
+package ui
+
+import (
+	"fmt"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/deemkeen/diffwatch/internal/diff"
+	"github.com/deemkeen/diffwatch/internal/git"
+	"github.com/deemkeen/diffwatch/internal/watcher"
+)
+
+// commitMsg reports the outcome of an automatic commit
+type commitMsg struct {
+	err error
+}
+
+// commitCmd returns a command committing the change to git if auto-commit
+// is enabled and the change produced a diff of a readable file
+func (m *Model) commitCmd(event watcher.Event, result *diff.Result) tea.Cmd {
+	if !m.opts.AutoCommit || result == nil || !result.HasDiff || result.Locked {
+		return nil
+	}
+
+	added, deleted := result.Stats()
+	message := fmt.Sprintf("diffwatch: %s %s (+%d -%d)",
+		event.Op, m.relPath(event.Path), added, deleted)
+
+	root := m.opts.GitRoot
+	path := event.Path
+	return func() tea.Msg {
+		// Commits touch the shared index, so they must not run concurrently
+		m.commitMu.Lock()
+		defer m.commitMu.Unlock()
+
+		return commitMsg{err: git.Commit(root, path, message)}
+	}
+}
@@ -0,0 +1,25 @@
+package ui
+
+import (
+	"github.com/charmbracelet/lipgloss"
+	"github.com/deemkeen/diffwatch/internal/diff"
+)
+
+// conflictGutter renders the gutter of a diff line in a file with git
+// conflict markers: a bar colored by the side of the conflict the line
+// belongs to, blank outside conflict regions
+func (m *Model) conflictGutter(part diff.ConflictPart) string {
+	style := lipgloss.NewStyle()
+	switch part {
+	case diff.ConflictMarker:
+		return style.Foreground(m.theme.critical).Bold(true).Render(m.glyphs.conflict)
+	case diff.ConflictOurs:
+		return style.Foreground(m.theme.info).Render(m.glyphs.side)
+	case diff.ConflictBase:
+		return style.Foreground(m.theme.muted).Render(m.glyphs.side)
+	case diff.ConflictTheirs:
+		return style.Foreground(m.theme.highlight).Render(m.glyphs.side)
+	default:
+		return " "
+	}
+}
@@ -0,0 +1,166 @@
+package ui
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/ansi"
+
+	"github.com/deemkeen/diffwatch/internal/crash"
+)
+
+// crashEvents is the number of recent event log entries in crash reports
+const crashEvents = 50
+
+// guard runs a model so that a panic in it, in one of its commands or in
+// a background goroutine (delivered as an errMsg) quits the program like
+// 'q' does, which restores the terminal, instead of killing the process
+type guard struct {
+	model tea.Model
+	quit  func()       // Quits the program from outside its event loop
+	panic *crash.Panic // First panic, ending the program
+}
+
+// panicMsg reports a panic in a command
+type panicMsg struct{ panic *crash.Panic }
+
+// Init initializes the guarded model
+func (g *guard) Init() (cmd tea.Cmd) {
+	defer g.recover(&cmd)
+	return g.wrap(g.model.Init())
+}
+
+// Update passes msg to the guarded model until it panics
+func (g *guard) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if g.panic != nil {
+		return g, tea.Quit
+	}
+	if msg, ok := msg.(panicMsg); ok {
+		g.panic = msg.panic
+		return g, tea.Quit
+	}
+	return g, g.update(msg)
+}
+
+// update passes msg to the guarded model, quitting if it panics
+func (g *guard) update(msg tea.Msg) (cmd tea.Cmd) {
+	defer g.recover(&cmd)
+	_, cmd = g.model.Update(msg)
+	return g.wrap(cmd)
+}
+
+// View renders the guarded model, or nothing once it panicked
+func (g *guard) View() string {
+	if g.panic != nil {
+		return ""
+	}
+	defer g.recover(nil)
+	return g.model.View()
+}
+
+// recover records a panic of the guarded model and makes cmd (if any, or
+// else the program) quit. Must be deferred.
+func (g *guard) recover(cmd *tea.Cmd) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	if g.panic == nil {
+		g.panic = crash.New(r)
+	}
+	if cmd != nil {
+		*cmd = tea.Quit
+	} else {
+		// View runs in the event loop, which must not block on quitting
+		go g.quit()
+	}
+}
+
+// wrap turns panics in cmd and in the commands of batches it returns into
+// panic messages
+func (g *guard) wrap(cmd tea.Cmd) tea.Cmd {
+	if cmd == nil {
+		return nil
+	}
+	return func() (msg tea.Msg) {
+		defer func() {
+			if r := recover(); r != nil {
+				msg = panicMsg{panic: crash.New(r)}
+			}
+		}()
+
+		msg = cmd()
+		if batch, ok := msg.(tea.BatchMsg); ok {
+			for i := range batch {
+				batch[i] = g.wrap(batch[i])
+			}
+		}
+		return msg
+	}
+}
+
+// recoverPanic delivers a panic in a background goroutine of the model to
+// the program, which panics with it in Update. Must be deferred.
+func (m *Model) recoverPanic() {
+	if r := recover(); r != nil {
+		m.send(errMsg(crash.New(r)))
+	}
+}
+
+// rethrow panics with err if it reports a panic in a background goroutine,
+// so that it ends the program with a crash report like a panic in Update
+func rethrow(err error) {
+	var p *crash.Panic
+	if errors.As(err, &p) {
+		panic(p)
+	}
+}
+
+// crashError writes the crash report of p with the given sections and
+// returns the error reported for it
+func crashError(p *crash.Panic, sections []crash.Section) error {
+	path, err := crash.Write(p, sections...)
+	if err != nil {
+		return fmt.Errorf("%w\n\n%s\n%v", p, p.Stack, err)
+	}
+	return fmt.Errorf("%w (crash report: %s)", p, path)
+}
+
+// crashSections returns the state of the session for crash reports,
+// with the session's title suffixed by name if it isn't empty
+func (m *Model) crashSections(name string) []crash.Section {
+	title := "Session"
+	if name != "" {
+		title += " " + name
+	}
+	session := crash.Section{Title: title, Lines: []string{
+		"Watching: " + strings.Join(m.watcher.Roots(), ", "),
+		fmt.Sprintf("Recursive: %v", m.watcher.IsRecursive()),
+		fmt.Sprintf("Events: %d (%d kept)", m.logged, len(m.events)),
+	}}
+	if m.err != nil {
+		session.Lines = append(session.Lines, "Last error: "+m.err.Error())
+	}
+
+	events := crash.Section{Title: title + " events"}
+	for _, entry := range m.events[max(len(m.events)-crashEvents, 0):] {
+		events.Lines = append(events.Lines, ansi.Strip(m.entryText(entry, 0)))
+	}
+	return []crash.Section{session, events}
+}
+
+// configSections returns the settings of a session for crash reports,
+// if they are known
+func (m *Model) configSections() []crash.Section {
+	if m.opts.Config == nil {
+		return nil
+	}
+	data, err := json.MarshalIndent(m.opts.Config, "", "  ")
+	if err != nil {
+		return nil
+	}
+	return []crash.Section{{Title: "Config", Lines: strings.Split(string(data), "\n")}}
+}
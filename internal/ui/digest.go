@@ -0,0 +1,192 @@
+package ui
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/deemkeen/diffwatch/internal/diff"
+	"github.com/deemkeen/diffwatch/internal/store"
+)
+
+// defaultDigestWindow is how far back the digest pane looks by default
+const defaultDigestWindow = 15 * time.Minute
+
+// Sparklines show the changes of each file over the last sparkSpan (or
+// the digest window if shorter) in sparkBuckets steps of time, so files
+// rewritten periodically stand out from files edited once
+const (
+	sparkSpan    = 5 * time.Minute
+	sparkBuckets = 20
+)
+
+// maxDigestChanges bounds the changes kept for the digest, however busy
+// the window
+const maxDigestChanges = 10000
+
+// digestChange is a single change counted by the digest
+type digestChange struct {
+	time    time.Time
+	path    string
+	op      string
+	added   int
+	deleted int
+}
+
+// digestFile summarizes the changes to a file within the window
+type digestFile struct {
+	path    string
+	changes int
+	added   int
+	deleted int
+	lastOp  string
+	last    time.Time
+	recent  [sparkBuckets]int // Changes per step of the sparkline, oldest first
+}
+
+// digest keeps the changes of a rolling time window
+type digest struct {
+	window  time.Duration
+	changes []digestChange
+}
+
+// add counts a change
+func (d *digest) add(c digestChange) {
+	d.changes = append(d.changes, c)
+	if over := len(d.changes) - maxDigestChanges; over > 0 {
+		d.changes = slices.Delete(d.changes, 0, over)
+	}
+}
+
+// addResult counts an event and its diff
+func (d *digest) addResult(t time.Time, path, op string, result *diff.Result) {
+	c := digestChange{time: t, path: path, op: op}
+	if result != nil {
+		c.added, c.deleted = result.Stats()
+	}
+	d.add(c)
+}
+
+// addRecords counts recorded events, e.g. from a daemon's history
+func (d *digest) addRecords(records []store.Record) {
+	for _, r := range records {
+		d.add(digestChange{time: r.Time, path: r.Path, op: r.Op, added: r.Added, deleted: r.Deleted})
+	}
+}
+
+// files drops changes that left the window and summarizes the rest per
+// file, busiest files first
+func (d *digest) files(now time.Time) []digestFile {
+	cutoff := now.Add(-d.window)
+	d.changes = slices.DeleteFunc(d.changes, func(c digestChange) bool {
+		return c.time.Before(cutoff)
+	})
+
+	span := min(sparkSpan, d.window)
+	step := span / sparkBuckets
+	start := now.Add(-span)
+
+	byPath := make(map[string]*digestFile)
+	var files []*digestFile
+	for _, c := range d.changes {
+		f, ok := byPath[c.path]
+		if !ok {
+			f = &digestFile{path: c.path}
+			byPath[c.path] = f
+			files = append(files, f)
+		}
+		f.changes++
+		f.added += c.added
+		f.deleted += c.deleted
+		if !c.time.Before(f.last) {
+			f.lastOp = c.op
+			f.last = c.time
+		}
+		if step > 0 && !c.time.Before(start) {
+			f.recent[min(int(c.time.Sub(start)/step), sparkBuckets-1)]++
+		}
+	}
+
+	result := make([]digestFile, len(files))
+	for i, f := range files {
+		result[i] = *f
+	}
+	slices.SortStableFunc(result, func(a, b digestFile) int {
+		if a.changes != b.changes {
+			return b.changes - a.changes
+		}
+		return b.last.Compare(a.last)
+	})
+	return result
+}
+
+// renderDigest renders the per-file activity of the window in at most
+// height lines
+func (m *Model) renderDigest(height int) string {
+	titleStyle := lipgloss.NewStyle().
+		Foreground(m.theme.title).
+		Bold(true)
+
+	headStyle := lipgloss.NewStyle().
+		Foreground(m.theme.muted)
+
+	rowStyle := lipgloss.NewStyle().
+		Foreground(m.theme.context)
+
+	files := m.digest.files(time.Now())
+
+	var changes int
+	for _, f := range files {
+		changes += f.changes
+	}
+
+	var b strings.Builder
+	b.WriteString(titleStyle.Render(fmt.Sprintf("Digest: last %s%s%d changes in %d files",
+		m.digest.window, m.glyphs.dot, changes, len(files))))
+
+	if len(files) == 0 {
+		b.WriteString("\n\n" + headStyle.Render("No changes in this window"))
+		return b.String()
+	}
+
+	b.WriteString("\n\n" + headStyle.Render(fmt.Sprintf("%7s  %6s  %-13s  %-*s  %-7s  %-8s  %s",
+		"CHANGES", "NET", "LINES", sparkBuckets, "LAST "+min(sparkSpan, m.digest.window).String(), "LAST OP", "LAST", "PATH")))
+
+	// Paths get the width left by the other columns inside the pane
+	const columns = 53 + sparkBuckets
+	shown := min(len(files), max(height-3, 1))
+
+	// Sparklines share a scale, so busier files look busier
+	peak := 0
+	for _, f := range files[:shown] {
+		peak = max(peak, slices.Max(f.recent[:]))
+	}
+
+	for _, f := range files[:shown] {
+		b.WriteString("\n" + rowStyle.Render(fmt.Sprintf("%7d  %+6d  %-13s  %s  %-7s  %-8s  %s",
+			f.changes, f.added-f.deleted, fmt.Sprintf("+%d -%d", f.added, f.deleted),
+			m.sparkline(f.recent[:], peak), f.lastOp, f.last.Format("15:04:05"), m.showPath(f.path, m.width-8-columns))))
+	}
+	if shown < len(files) {
+		b.WriteString("\n" + headStyle.Render(fmt.Sprintf("%s %d more files", m.glyphs.ellipsis, len(files)-shown)))
+	}
+
+	return b.String()
+}
+
+// sparkline draws counts as one bar each, scaled so that peak gets the
+// highest bar: blank for none, at least the lowest bar for any change
+func (m *Model) sparkline(counts []int, peak int) string {
+	steps := []rune(m.glyphs.spark)
+	var b strings.Builder
+	for _, n := range counts {
+		level := 0
+		if n > 0 {
+			level = (n*(len(steps)-1) + peak - 1) / peak
+		}
+		b.WriteRune(steps[level])
+	}
+	return b.String()
+}
@@ -0,0 +1,136 @@
+package ui
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/deemkeen/diffwatch/internal/diff"
+	"github.com/deemkeen/diffwatch/internal/extdiff"
+	"github.com/deemkeen/diffwatch/internal/pathname"
+	"github.com/deemkeen/diffwatch/internal/state"
+	"github.com/deemkeen/diffwatch/internal/watcher"
+)
+
+// externalDiffMsg delivers the output of the external differ run on a
+// change
+type externalDiffMsg struct {
+	result *diff.Result
+	output extdiff.Output
+}
+
+// externalDiffCmd returns a command running the external differ matching
+// a change, or nil if there is none. Like plugins, differs get the real
+// contents, so the command is built before redaction.
+func (m *Model) externalDiffCmd(event watcher.Event, result *diff.Result) tea.Cmd {
+	if result == nil || !result.HasDiff {
+		return nil
+	}
+	rel := filepath.ToSlash(m.relPath(event.Path))
+	if !m.opts.Differs.Applies(rel) {
+		return nil
+	}
+
+	old, cur := stateContent(result.OldState), stateContent(result.NewState)
+	runner, root := m.opts.Differs, m.watcher.WatchPath()
+	return func() tea.Msg {
+		return externalDiffMsg{result: result, output: runner.Run(context.Background(), root, rel, old, cur)}
+	}
+}
+
+// stateContent returns a copy of the content of a file state, nil if the
+// file doesn't exist
+func stateContent(s *state.FileState) []byte {
+	if s == nil || !s.Exists {
+		return nil
+	}
+	return []byte(string(s.Content))
+}
+
+// handleExternalDiff stores the output of an external differ for display
+func (m *Model) handleExternalDiff(msg externalDiffMsg) {
+	if msg.output.Err != nil {
+		m.log.Warn("external differ failed", "differ", msg.output.Differ, "path", msg.result.Path, "error", msg.output.Err)
+	}
+	m.externalDiffs[msg.result] = msg.output
+	if m.opts.A11y {
+		m.a11y.external = append(m.a11y.external, msg)
+	}
+}
+
+// showsExternalDiff reports whether the output of an external differ is
+// shown in place of the diff, which 'r' toggles
+func (m *Model) showsExternalDiff(result *diff.Result) bool {
+	_, ok := m.externalDiffs[result]
+	return ok && !m.rawLines
+}
+
+// externalLines returns the lines of an external differ's output, without
+// escape sequences and with tabs expanded, safe to show in a terminal
+func externalLines(text string) []string {
+	text = strings.ReplaceAll(ansi.Strip(strings.TrimRight(text, "\n")), "\t", "    ")
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = pathname.Display(strings.TrimSuffix(line, "\r"))
+	}
+	return lines
+}
+
+// renderExternalDiff renders the output of the external differ run on a
+// change in at most maxDisplayLines lines
+func (m *Model) renderExternalDiff(result *diff.Result, maxDisplayLines int) string {
+	out := m.externalDiffs[result]
+
+	noteStyle := lipgloss.NewStyle().
+		Foreground(m.theme.lineNum).
+		Italic(true)
+
+	var b strings.Builder
+	header := m.glyphs.with(m.glyphs.plugin, pathname.Display(out.Differ))
+	if out.Err != nil {
+		b.WriteString(header + ": " + lipgloss.NewStyle().Foreground(m.theme.critical).Render("ERROR ") + pathname.Display(out.Err.Error()) + "\n\n")
+		b.WriteString(noteStyle.Render("press 'r' for the built-in diff"))
+		return b.String()
+	}
+	b.WriteString(header + noteStyle.Render(" - press 'r' for the built-in diff") + "\n\n")
+
+	lines := externalLines(out.Text)
+	shown := lines[:min(len(lines), max(maxDisplayLines-1, 1))]
+	for _, line := range shown {
+		b.WriteString(ansi.Truncate(line, max(m.width-6, 20), m.glyphs.ellipsis) + "\n")
+	}
+	if more := len(lines) - len(shown); more > 0 || out.Truncated {
+		note := fmt.Sprintf("%d more lines", more)
+		if out.Truncated {
+			note = "output cut at 512 KB"
+		}
+		b.WriteString(noteStyle.Render(note))
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// printSpokenExternalDiffs prints the outputs of external differs that
+// arrived since the last call in accessible mode
+func (m *Model) printSpokenExternalDiffs(w io.Writer) {
+	for _, msg := range m.a11y.external {
+		path := m.displayPath(msg.result.Path)
+		if msg.output.Err != nil {
+			fmt.Fprintf(w, "external differ %s failed on %s: %v\n", pathname.Display(msg.output.Differ), path, msg.output.Err)
+			continue
+		}
+		fmt.Fprintf(w, "external differ %s on %s:\n", pathname.Display(msg.output.Differ), path)
+		lines := externalLines(msg.output.Text)
+		for _, line := range lines[:min(len(lines), a11yMaxLines)] {
+			fmt.Fprintf(w, "  %s\n", line)
+		}
+		if more := len(lines) - a11yMaxLines; more > 0 {
+			fmt.Fprintf(w, "  and %d more lines\n", more)
+		}
+	}
+	m.a11y.external = nil
+}
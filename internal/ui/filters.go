@@ -0,0 +1,327 @@
+package ui
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/deemkeen/diffwatch/internal/config"
+	"github.com/deemkeen/diffwatch/internal/match"
+	"github.com/deemkeen/diffwatch/internal/pathname"
+	"github.com/deemkeen/diffwatch/internal/watcher"
+)
+
+// skipDirSource is implemented by sources that leave the directories of
+// watcher.SkipDirs out of recursive watches and can watch them anyway
+type skipDirSource interface {
+	SkipsDir(name string) bool
+	SetSkipDir(name string, skip bool) error
+}
+
+// filterEditor is the selection of the filter editor pane, opened with 'I'
+type filterEditor struct {
+	cursor int    // Selected row of filterRows
+	adding string // "include" or "exclude" while a glob is entered, whose matches are previewed
+}
+
+// filterRow is a selectable line of the filter editor: an include or
+// exclude glob, or a skipped directory
+type filterRow struct {
+	kind  string // "include", "exclude" or "dir"
+	value string
+}
+
+// passesFilters reports whether the changes of path pass the include and
+// exclude globs, matched against the path relative to the watch path
+func (m *Model) passesFilters(path string) bool {
+	rel := filepath.ToSlash(m.relPath(path))
+	if len(m.include) > 0 && !match.Any(m.include, rel) {
+		return false
+	}
+	return !match.Any(m.exclude, rel)
+}
+
+// skipDirs returns the source able to watch skipped directories, or nil
+// if it can't or doesn't watch recursively
+func (m *Model) skipDirs() skipDirSource {
+	src, ok := m.watcher.(skipDirSource)
+	if !ok || !m.watcher.IsRecursive() {
+		return nil
+	}
+	return src
+}
+
+// filterRows returns the lines of the filter editor that can be selected
+func (m *Model) filterRows() []filterRow {
+	var rows []filterRow
+	for _, glob := range m.include {
+		rows = append(rows, filterRow{kind: "include", value: glob})
+	}
+	for _, glob := range m.exclude {
+		rows = append(rows, filterRow{kind: "exclude", value: glob})
+	}
+	if m.skipDirs() != nil {
+		for _, name := range watcher.SkipDirs() {
+			rows = append(rows, filterRow{kind: "dir", value: name})
+		}
+	}
+	return rows
+}
+
+// filterConfigPath returns the config file the filters are saved to: the
+// one in use, or a new one in the watch path
+func (m *Model) filterConfigPath() string {
+	if m.opts.ConfigPath != "" {
+		return m.opts.ConfigPath
+	}
+	return filepath.Join(m.watcher.WatchPath(), config.FileName)
+}
+
+// handleFilterKey edits the filters while the filter editor is shown.
+// Returns false for keys it doesn't handle.
+func (m *Model) handleFilterKey(key string) (tea.Cmd, bool) {
+	rows := m.filterRows()
+	var selected filterRow
+	if m.filterEditor.cursor < len(rows) {
+		selected = rows[m.filterEditor.cursor]
+	}
+
+	switch key {
+	case "j", "down":
+		m.filterEditor.cursor = min(m.filterEditor.cursor+1, max(len(rows)-1, 0))
+	case "k", "up":
+		m.filterEditor.cursor = max(m.filterEditor.cursor-1, 0)
+	case "i":
+		m.promptFilterGlob("include")
+	case "e":
+		m.promptFilterGlob("exclude")
+	case "d", "x", "delete":
+		switch selected.kind {
+		case "include":
+			m.include = slices.DeleteFunc(m.include, func(glob string) bool { return glob == selected.value })
+		case "exclude":
+			m.exclude = slices.DeleteFunc(m.exclude, func(glob string) bool { return glob == selected.value })
+		}
+		m.filterEditor.cursor = min(m.filterEditor.cursor, max(len(m.filterRows())-1, 0))
+	case " ", "enter":
+		if selected.kind == "dir" {
+			return m.toggleSkipDir(selected.value), true
+		}
+	case "s":
+		m.saveFilters()
+	case "esc", "I":
+		m.showFilters = false
+	default:
+		return nil, false
+	}
+	return nil, true
+}
+
+// promptFilterGlob asks for an include or exclude glob, previewing the
+// recent events it matches while it is typed
+func (m *Model) promptFilterGlob(kind string) {
+	label := "Show only paths matching (glob)"
+	if kind == "exclude" {
+		label = "Hide paths matching (glob)"
+	}
+	m.filterEditor.adding = kind
+	m.prompt = newPrompt(label, "", func(value string) tea.Cmd {
+		m.filterEditor.adding = ""
+		glob := strings.TrimSpace(value)
+		if glob == "" {
+			return nil
+		}
+		if _, err := path.Match(glob, ""); err != nil {
+			m.err = fmt.Errorf("glob %q: %w", glob, err)
+			return nil
+		}
+
+		globs := &m.include
+		if kind == "exclude" {
+			globs = &m.exclude
+		}
+		if !slices.Contains(*globs, glob) {
+			*globs = append(*globs, glob)
+		}
+		m.filterEditor.cursor = slices.Index(m.filterRows(), filterRow{kind: kind, value: glob})
+		return nil
+	})
+}
+
+// toggleSkipDir returns a command starting or stopping to skip the
+// directories called name. Watching them walks the tree, so it runs in
+// the background.
+func (m *Model) toggleSkipDir(name string) tea.Cmd {
+	src := m.skipDirs()
+	skip := !src.SkipsDir(name)
+
+	text := fmt.Sprintf("[%s] watching %s directories", time.Now().Format("15:04:05"), name)
+	if skip {
+		text = fmt.Sprintf("[%s] skipping %s directories", time.Now().Format("15:04:05"), name)
+	}
+	m.appendLog(logEntry{text: text})
+
+	return func() tea.Msg {
+		if err := src.SetSkipDir(name, skip); err != nil {
+			return errMsg(err)
+		}
+		return nil
+	}
+}
+
+// saveFilters writes the include and exclude globs and the skipped
+// directories that are watched to the config file
+func (m *Model) saveFilters() {
+	var watchDirs []string
+	if src := m.skipDirs(); src != nil {
+		for _, name := range watcher.SkipDirs() {
+			if !src.SkipsDir(name) {
+				watchDirs = append(watchDirs, name)
+			}
+		}
+	} else {
+		watchDirs = m.opts.WatchDirs
+	}
+
+	file := m.filterConfigPath()
+	if err := config.SaveFilters(file, m.include, m.exclude, watchDirs); err != nil {
+		m.err = err
+		return
+	}
+	m.appendLog(logEntry{
+		text: fmt.Sprintf("[%s] filters saved to %s", time.Now().Format("15:04:05"), pathname.Display(file)),
+	})
+}
+
+// renderFilters renders the filter editor: the include and exclude globs,
+// the skipped directories, and while a glob is entered the recent events
+// it matches
+func (m *Model) renderFilters(height int) string {
+	if m.prompt != nil && m.filterEditor.adding != "" {
+		return m.renderFilterPreview(height)
+	}
+
+	titleStyle := lipgloss.NewStyle().
+		Foreground(m.theme.title).
+		Bold(true)
+
+	headStyle := lipgloss.NewStyle().
+		Foreground(m.theme.muted)
+
+	rowStyle := lipgloss.NewStyle().
+		Foreground(m.theme.context)
+
+	selectedStyle := lipgloss.NewStyle().
+		Foreground(m.theme.highlight).
+		Bold(true)
+
+	// Lines of the pane, with the index of the selected one
+	var lines []string
+	cursorLine := 0
+	row := 0
+	addRow := func(text string) {
+		if row == m.filterEditor.cursor {
+			cursorLine = len(lines)
+			lines = append(lines, selectedStyle.Render(m.glyphs.selected+" "+text))
+		} else {
+			lines = append(lines, rowStyle.Render("  "+text))
+		}
+		row++
+	}
+
+	lines = append(lines, headStyle.Render("Include (only changes of matching paths are shown)"))
+	if len(m.include) == 0 {
+		lines = append(lines, headStyle.Render("  all paths"))
+	}
+	for _, glob := range m.include {
+		addRow(pathname.Display(glob))
+	}
+
+	lines = append(lines, "", headStyle.Render("Exclude (changes of matching paths are hidden)"))
+	if len(m.exclude) == 0 {
+		lines = append(lines, headStyle.Render("  none"))
+	}
+	for _, glob := range m.exclude {
+		addRow(pathname.Display(glob))
+	}
+
+	if src := m.skipDirs(); src != nil {
+		lines = append(lines, "", headStyle.Render("Skipped directories (space toggles)"))
+		for _, name := range watcher.SkipDirs() {
+			mark := "[ ] watched  "
+			if src.SkipsDir(name) {
+				mark = "[x] skipped  "
+			}
+			addRow(mark + name)
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(titleStyle.Render("Filters"))
+	b.WriteString(headStyle.Render(fmt.Sprintf("%s'i' include, 'e' exclude, 'd' delete, 's' save to %s, 'esc' close",
+		m.glyphs.dot, pathname.Display(m.filterConfigPath()))))
+	b.WriteString("\n")
+
+	rows := max(height-2, 1)
+	start := min(max(cursorLine-rows/2, 0), max(len(lines)-rows, 0))
+	for _, line := range lines[start:min(start+rows, len(lines))] {
+		b.WriteString("\n" + line)
+	}
+	return b.String()
+}
+
+// renderFilterPreview renders the recent events matching the glob being
+// entered, newest first
+func (m *Model) renderFilterPreview(height int) string {
+	titleStyle := lipgloss.NewStyle().
+		Foreground(m.theme.title).
+		Bold(true)
+
+	headStyle := lipgloss.NewStyle().
+		Foreground(m.theme.muted)
+
+	glob := strings.TrimSpace(string(m.prompt.value))
+	effect := "shown"
+	if m.filterEditor.adding == "exclude" {
+		effect = "hidden"
+	}
+
+	var b strings.Builder
+	if glob == "" {
+		b.WriteString(titleStyle.Render("Type a glob to see the recent events it matches"))
+		return b.String()
+	}
+	if _, err := path.Match(glob, ""); err != nil {
+		b.WriteString(titleStyle.Render(fmt.Sprintf("Invalid glob %q: %v", glob, err)))
+		return b.String()
+	}
+
+	var matching []logEntry
+	total := 0
+	for i := len(m.events) - 1; i >= 0; i-- {
+		entry := m.events[i]
+		if entry.path == "" {
+			continue
+		}
+		total++
+		if match.Glob(glob, filepath.ToSlash(m.relPath(entry.path))) {
+			matching = append(matching, entry)
+		}
+	}
+
+	b.WriteString(titleStyle.Render(fmt.Sprintf("%d of %d recent events match %q and would be %s", len(matching), total, glob, effect)))
+	b.WriteString("\n")
+	if len(matching) == 0 {
+		b.WriteString("\n" + headStyle.Render("No matching events"))
+		return b.String()
+	}
+	for _, entry := range matching[:min(len(matching), max(height-2, 1))] {
+		b.WriteString("\n" + m.levelStyle(entry.level).Render("  "+m.entryText(entry, m.width-10)))
+	}
+	return b.String()
+}
@@ -0,0 +1,168 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/deemkeen/diffwatch/internal/diff"
+)
+
+// fullLog is the scroll position and filter of the full event log pane
+type fullLog struct {
+	offset int    // First entry shown; -1 follows the newest entries
+	filter string // Substring entries must contain, matched case-insensitively
+}
+
+// changeStats describes the lines a change added and deleted for the
+// event log, or "" without a diff
+func changeStats(result *diff.Result) string {
+	if result == nil {
+		return ""
+	}
+	if result.IsBinary {
+		return "binary"
+	}
+	added, deleted := result.Stats()
+	return fmt.Sprintf("+%d -%d", added, deleted)
+}
+
+// fullLogEntries returns the event log entries matching the filter and
+// the live filter, oldest first
+func (m *Model) fullLogEntries() []logEntry {
+	events := m.visibleEvents()
+	if m.fullLog.filter == "" {
+		return events
+	}
+
+	var entries []logEntry
+	for _, entry := range events {
+		if containsFold(m.entryText(entry, 0), m.fullLog.filter) || containsFold(entry.process, m.fullLog.filter) || containsFold(entry.note, m.fullLog.filter) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// fullLogRows returns the number of entries the full log pane shows
+func (m *Model) fullLogRows() int {
+	return max(m.paneHeight()-2, 1)
+}
+
+// handleFullLogKey scrolls and filters the full event log pane while it
+// is shown. Returns false for keys it doesn't handle.
+func (m *Model) handleFullLogKey(key string) bool {
+	rows := m.fullLogRows()
+	n := len(m.fullLogEntries())
+
+	// Scrolling starts from the newest entries while following them
+	offset := m.fullLog.offset
+	if offset < 0 {
+		offset = max(n-rows, 0)
+	}
+
+	switch key {
+	case "j", "down":
+		offset++
+	case "k", "up":
+		offset--
+	case "ctrl+d", "pgdown":
+		offset += rows
+	case "ctrl+u", "pgup":
+		offset -= rows
+	case "g", "home":
+		offset = 0
+	case "G", "end":
+		m.fullLog.offset = -1
+		return true
+	case "/":
+		m.prompt = newPrompt("Filter event log", m.fullLog.filter, func(value string) tea.Cmd {
+			m.fullLog = fullLog{offset: -1, filter: value}
+			return nil
+		})
+		return true
+	case "esc":
+		if m.fullLog.filter == "" {
+			m.showFullLog = false
+		}
+		m.fullLog = fullLog{offset: -1}
+		return true
+	default:
+		return false
+	}
+
+	// Reaching the bottom follows new entries again
+	m.fullLog.offset = min(max(offset, 0), max(n-rows, 0))
+	if m.fullLog.offset == max(n-rows, 0) {
+		m.fullLog.offset = -1
+	}
+	return true
+}
+
+// renderFullLog renders every event log entry kept, with its diff stats
+// and process, scrolled and filtered
+func (m *Model) renderFullLog(height int) string {
+	titleStyle := lipgloss.NewStyle().
+		Foreground(m.theme.title).
+		Bold(true)
+
+	headStyle := lipgloss.NewStyle().
+		Foreground(m.theme.muted)
+
+	noiseStyle := lipgloss.NewStyle().
+		Foreground(m.theme.faint).
+		Italic(true)
+
+	entries := m.fullLogEntries()
+	rows := max(height-2, 1)
+	start := m.fullLog.offset
+	if start < 0 || start > max(len(entries)-rows, 0) {
+		start = max(len(entries)-rows, 0)
+	}
+	end := min(start+rows, len(entries))
+
+	var b strings.Builder
+	title := fmt.Sprintf("Event log: %d entries", len(m.events))
+	if m.fullLog.filter != "" {
+		title = fmt.Sprintf("Event log: %d of %d entries matching %q", len(entries), len(m.events), m.fullLog.filter)
+	} else if m.liveFilter != "" {
+		title = fmt.Sprintf("Event log: %d of %d entries", len(entries), len(m.events))
+	}
+	if len(entries) > rows {
+		title += fmt.Sprintf("%s%d-%d", m.glyphs.dot, start+1, end)
+	}
+	b.WriteString(titleStyle.Render(title))
+	b.WriteString("\n")
+
+	if len(entries) == 0 {
+		b.WriteString("\n" + headStyle.Render("No matching events"))
+		return b.String()
+	}
+
+	for _, entry := range entries[start:end] {
+		// Inside the pane's border and padding, next to the seen mark and
+		// the stats
+		width := m.width - 10
+		if entry.stats != "" {
+			width -= len("  " + entry.stats)
+		}
+
+		b.WriteString("\n")
+		if entry.noise {
+			b.WriteString(noiseStyle.Render("  " + m.entryText(entry, width-len(" (suppressed)")) + " (suppressed)"))
+		} else {
+			b.WriteString(m.levelStyle(entry.level).Render(m.seenMark(entry) + m.entryText(entry, width)))
+		}
+		if entry.stats != "" {
+			b.WriteString(headStyle.Render("  " + entry.stats))
+		}
+		if entry.process != "" {
+			b.WriteString(noiseStyle.Render("  modified by: " + entry.process))
+		}
+		if entry.note != "" {
+			b.WriteString(noiseStyle.Render("  note: " + entry.note))
+		}
+	}
+	return b.String()
+}
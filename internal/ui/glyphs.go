@@ -0,0 +1,136 @@
+package ui
+
+import "github.com/charmbracelet/lipgloss"
+
+// glyphs holds the icons, symbols and borders drawn by the UI
+type glyphs struct {
+	icons     bool   // Show the icons of languages
+	file      string // Icon of files of unknown language
+	added     string // Marks added lines, with a space
+	deleted   string // Marks deleted lines, with a space
+	gap       string // Stands for unread unchanged lines in the line number column, with a space
+	arrow     string // Between an old and a new name or value
+	blame     string // Introduces blame annotations
+	note      string // Introduces plugin annotations
+	selected  string // Marks the selected item of lists
+	unseen    string // Marks event log entries whose diff wasn't marked as seen, with a space
+	dot       string // Separates fields, with spaces
+	bar       string // Separates status bar fields, with spaces
+	ellipsis  string // Stands for text left out
+	warning   string // Introduces warnings
+	locked    string // Marks files locked by other processes
+	binary    string // Marks binary files
+	plugin    string // Introduces plugin verdicts
+	alarm     string // Introduces rate alarms
+	paused    string // Paused badge icon
+	recording string // Recording badge icon
+	rule      string // Repeated for horizontal separators
+	cursor    string // Text input cursor
+	cr        string // Marks CRLF line endings
+	tab       string // Replaces tabs when whitespace is shown, padded to a tab width of 4
+	space     string // Replaces trailing spaces when whitespace is shown
+	mask      string // Replaces masked values
+	heatOn    string // Filled step of heat bars
+	heatOff   string // Empty step of heat bars
+	spark     string // Steps of sparkline bars, from none to most changes
+	conflict  string // Gutter of conflict marker lines
+	side      string // Gutter of the lines of a conflict side
+	switchTab string // Keys that switch tabs besides 1-9
+
+	border  lipgloss.Border // Headers and panes
+	rounded lipgloss.Border // Diff pane and lists
+	double  lipgloss.Border // Alerts
+}
+
+// unicodeGlyphs are drawn by default
+var unicodeGlyphs = glyphs{
+	icons:     true,
+	file:      "📄",
+	added:     "✓ ",
+	deleted:   "✗ ",
+	gap:       "⋯ ",
+	arrow:     "→",
+	blame:     "←",
+	note:      "◀",
+	selected:  "▶",
+	unseen:    "● ",
+	dot:       " · ",
+	bar:       " │ ",
+	ellipsis:  "…",
+	warning:   "⚠",
+	locked:    "🔒",
+	binary:    "📦",
+	plugin:    "🔌",
+	alarm:     "⏰",
+	paused:    "⏸",
+	recording: "●",
+	rule:      "─",
+	cursor:    "█",
+	cr:        "␍",
+	tab:       "→   ",
+	mask:      "••••••",
+	space:     "·",
+	heatOn:    "▮",
+	heatOff:   "▯",
+	spark:     " ▁▂▃▄▅▆▇█",
+	conflict:  "▶",
+	side:      "▌",
+	switchTab: "ctrl+←/→",
+
+	border:  lipgloss.NormalBorder(),
+	rounded: lipgloss.RoundedBorder(),
+	double:  lipgloss.DoubleBorder(),
+}
+
+// asciiGlyphs are drawn with -ascii, for terminals and fonts without
+// emoji or box drawing characters. Icons that only decorate text are left
+// out.
+var asciiGlyphs = glyphs{
+	added:     "+ ",
+	deleted:   "- ",
+	gap:       "~ ",
+	arrow:     "->",
+	blame:     "<-",
+	note:      "<",
+	selected:  ">",
+	unseen:    "* ",
+	dot:       " - ",
+	bar:       " | ",
+	ellipsis:  "...",
+	warning:   "!",
+	paused:    "||",
+	recording: "*",
+	rule:      "-",
+	cursor:    "_",
+	cr:        "^M",
+	tab:       ">   ",
+	mask:      "******",
+	space:     ".",
+	heatOn:    "#",
+	heatOff:   ".",
+	spark:     " .:-=+*#@",
+	conflict:  ">",
+	side:      "|",
+	switchTab: "ctrl+left/right",
+
+	border:  lipgloss.ASCIIBorder(),
+	rounded: lipgloss.ASCIIBorder(),
+	double:  lipgloss.ASCIIBorder(),
+}
+
+// newGlyphs returns the glyphs to draw, ASCII only if ascii is set
+func newGlyphs(ascii bool) glyphs {
+	if ascii {
+		return asciiGlyphs
+	}
+	return unicodeGlyphs
+}
+
+// with prefixes text with an icon and a space, or returns text alone if
+// the icon is left out
+func (g glyphs) with(icon, text string) string {
+	if icon == "" {
+		return text
+	}
+	return icon + " " + text
+}
@@ -0,0 +1,199 @@
+package ui
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/deemkeen/diffwatch/internal/store"
+)
+
+// heatHalfLife is how long it takes the heat of a path to halve without
+// further changes
+const heatHalfLife = 10 * time.Minute
+
+// minHeat is the heat below which a file has cooled down and is dropped
+const minHeat = 0.05
+
+// heatEntry is the decaying change count of a file
+type heatEntry struct {
+	heat float64
+	at   time.Time // Time heat was computed for
+}
+
+// heatAt returns the heat decayed to t
+func (e heatEntry) heatAt(t time.Time) float64 {
+	return e.heat * math.Exp2(-float64(t.Sub(e.at))/float64(heatHalfLife))
+}
+
+// heatmap tracks how often each file changed recently, every change
+// adding 1 to a heat that halves every heatHalfLife
+type heatmap struct {
+	files map[string]heatEntry
+}
+
+// add counts a change of path at t
+func (h *heatmap) add(path string, t time.Time) {
+	if h.files == nil {
+		h.files = make(map[string]heatEntry)
+	}
+
+	e, ok := h.files[path]
+	switch {
+	case !ok:
+		e = heatEntry{heat: 1, at: t}
+	case t.Before(e.at):
+		// Changes may arrive out of order: decay the late one instead
+		e.heat += heatEntry{heat: 1, at: t}.heatAt(e.at)
+	default:
+		e = heatEntry{heat: e.heatAt(t) + 1, at: t}
+	}
+	h.files[path] = e
+}
+
+// addRecords counts recorded events, e.g. from a daemon's history
+func (h *heatmap) addRecords(records []store.Record) {
+	for _, r := range records {
+		h.add(r.Path, r.Time)
+	}
+}
+
+// heatNode is a directory or file in the heatmap tree
+type heatNode struct {
+	name     string
+	heat     float64 // Sum of the heat of all files below
+	children []*heatNode
+}
+
+// child returns the child called name, creating it if needed
+func (n *heatNode) child(name string) *heatNode {
+	for _, c := range n.children {
+		if c.name == name {
+			return c
+		}
+	}
+	c := &heatNode{name: name}
+	n.children = append(n.children, c)
+	return c
+}
+
+// tree drops files that cooled down and arranges the rest in a tree of
+// their paths as given by rel
+func (h *heatmap) tree(now time.Time, rel func(string) string) *heatNode {
+	root := &heatNode{name: "."}
+	for path, e := range h.files {
+		heat := e.heatAt(now)
+		if heat < minHeat {
+			delete(h.files, path)
+			continue
+		}
+
+		node := root
+		node.heat += heat
+		for _, part := range strings.Split(filepath.ToSlash(rel(path)), "/") {
+			if part == "" {
+				continue
+			}
+			node = node.child(part)
+			node.heat += heat
+		}
+	}
+	return root
+}
+
+// renderHeatmap renders the tree of recently changed files in at most
+// height lines, colored by how hot each path is
+func (m *Model) renderHeatmap(height int) string {
+	titleStyle := lipgloss.NewStyle().
+		Foreground(m.theme.title).
+		Bold(true)
+
+	mutedStyle := lipgloss.NewStyle().
+		Foreground(m.theme.muted)
+
+	root := m.heat.tree(time.Now(), m.displayPath)
+
+	var b strings.Builder
+	b.WriteString(titleStyle.Render(fmt.Sprintf("Heatmap: changes decaying by half every %s", heatHalfLife)))
+
+	if len(root.children) == 0 {
+		b.WriteString("\n\n" + mutedStyle.Render("No recent changes"))
+		return b.String()
+	}
+
+	var lines []string
+	m.heatLines(root, "", &lines)
+
+	shown := min(len(lines), max(height-2, 1))
+	b.WriteString("\n")
+	for _, line := range lines[:shown] {
+		b.WriteString("\n" + line)
+	}
+	if shown < len(lines) {
+		b.WriteString("\n" + mutedStyle.Render(fmt.Sprintf("%s %d more", m.glyphs.ellipsis, len(lines)-shown)))
+	}
+	return b.String()
+}
+
+// heatLines appends the rendered lines of the children of n, directories
+// first, each level sorted by name. Directories with a single child are
+// joined with it.
+func (m *Model) heatLines(n *heatNode, indent string, lines *[]string) {
+	children := slices.Clone(n.children)
+	slices.SortFunc(children, func(a, b *heatNode) int {
+		if (len(a.children) > 0) != (len(b.children) > 0) {
+			if len(a.children) > 0 {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a.name, b.name)
+	})
+
+	for _, c := range children {
+		name := c.name
+		for len(c.children) == 1 && len(c.children[0].children) > 0 {
+			c = c.children[0]
+			name += "/" + c.name
+		}
+		if len(c.children) > 0 {
+			name += "/"
+		}
+
+		style := m.heatStyle(c.heat)
+		*lines = append(*lines, indent+style.Render(fmt.Sprintf("%s %s (%.1f)", m.heatBar(c.heat), name, c.heat)))
+		m.heatLines(c, indent+"  ", lines)
+	}
+}
+
+// heatStyle colors a path by its heat
+func (m *Model) heatStyle(heat float64) lipgloss.Style {
+	style := lipgloss.NewStyle()
+	switch {
+	case heat >= 8:
+		return style.Foreground(m.theme.critical).Bold(true)
+	case heat >= 4:
+		return style.Foreground(m.theme.highlight)
+	case heat >= 2:
+		return style.Foreground(m.theme.warn)
+	case heat >= 0.5:
+		return style.Foreground(m.theme.context)
+	default:
+		return style.Foreground(m.theme.faint)
+	}
+}
+
+// heatBar renders heat as a five-step bar
+func (m *Model) heatBar(heat float64) string {
+	steps := 1
+	for _, threshold := range []float64{0.5, 2, 4, 8} {
+		if heat >= threshold {
+			steps++
+		}
+	}
+	return strings.Repeat(m.glyphs.heatOn, steps) + strings.Repeat(m.glyphs.heatOff, 5-steps)
+}
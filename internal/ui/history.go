@@ -0,0 +1,361 @@
+package ui
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/deemkeen/diffwatch/internal/diff"
+	"github.com/deemkeen/diffwatch/internal/lang"
+	"github.com/deemkeen/diffwatch/internal/pathname"
+	"github.com/deemkeen/diffwatch/internal/severity"
+	"github.com/deemkeen/diffwatch/internal/store"
+)
+
+// HistoryOptions configures the history browser
+type HistoryOptions struct {
+	Path   string // File or directory whose changes are browsed
+	Source string // Where the records come from, shown in the header
+	Light  bool   // Use colors for light terminal backgrounds
+	ASCII  bool   // Draw only ASCII: no emoji, symbols or box drawing borders
+}
+
+// History browses recorded changes offline: no files are watched or read,
+// the diffs are the patches stored in the change database
+type History struct {
+	view    *Model // Renders and scrolls the selected diff
+	opts    HistoryOptions
+	records []store.Record       // Oldest first
+	diffs   map[int]*diff.Result // Parsed patches by record index
+	cursor  int                  // Selected record
+	query   string               // Search term, matched case-insensitively
+	matches []int                // Records matching query, in order
+	program *tea.Program         // Running program, for Quit
+}
+
+// NewHistory creates a browser for records, which must be sorted oldest
+// first. The newest change is selected.
+func NewHistory(records []store.Record, opts HistoryOptions) *History {
+	t := darkTheme
+	if opts.Light {
+		t = lightTheme
+	}
+
+	return &History{
+		view: &Model{
+			theme:    t,
+			glyphs:   newGlyphs(opts.ASCII),
+			log:      slog.New(slog.DiscardHandler),
+			pinIndex: -1,
+			width:    80,
+			height:   24,
+		},
+		opts:    opts,
+		records: records,
+		diffs:   make(map[int]*diff.Result),
+		cursor:  max(len(records)-1, 0),
+	}
+}
+
+// Start runs the browser until it is quit
+func (h *History) Start() error {
+	h.program = tea.NewProgram(h, tea.WithAltScreen())
+	_, err := h.program.Run()
+	return err
+}
+
+// Quit signals the browser to quit
+func (h *History) Quit() {
+	if h.program != nil {
+		h.program.Quit()
+	}
+}
+
+// Init initializes the browser
+func (h *History) Init() tea.Cmd {
+	h.show()
+	return nil
+}
+
+// Update handles key presses and resizes
+func (h *History) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		if h.view.prompt != nil {
+			return h, h.view.handlePromptKey(msg)
+		}
+		if h.view.handleNavKey(msg.String()) {
+			return h, nil
+		}
+
+		switch msg.String() {
+		case "q", "ctrl+c":
+			h.view.quitting = true
+			return h, tea.Quit
+		case "J", "shift+down":
+			h.selectRecord(h.cursor + 1)
+		case "K", "shift+up":
+			h.selectRecord(h.cursor - 1)
+		case "home":
+			h.selectRecord(0)
+		case "end":
+			h.selectRecord(len(h.records) - 1)
+		case "/":
+			h.view.prompt = newPrompt("Search changes", h.query, func(value string) tea.Cmd {
+				h.search(value)
+				return nil
+			})
+		case "n":
+			h.nextMatch(1)
+		case "N":
+			h.nextMatch(-1)
+		case "w":
+			h.view.showWhitespace = !h.view.showWhitespace
+		case "R":
+			h.view.revealValues = !h.view.revealValues
+		case "esc":
+			h.search("")
+		}
+
+	case tea.WindowSizeMsg:
+		h.view.width = msg.Width
+		h.view.height = msg.Height
+	}
+
+	return h, nil
+}
+
+// selectRecord selects the record at index i, clamped to the records
+func (h *History) selectRecord(i int) {
+	if len(h.records) == 0 {
+		return
+	}
+	h.cursor = min(max(i, 0), len(h.records)-1)
+	h.show()
+}
+
+// show displays the diff of the selected record, scrolled to the first
+// line matching the search term
+func (h *History) show() {
+	h.view.currentDiff = nil
+	h.view.err = nil
+	if len(h.records) == 0 {
+		return
+	}
+
+	result, ok := h.diffs[h.cursor]
+	if !ok {
+		r := h.records[h.cursor]
+		var err error
+		result, err = diff.ParsePatch(r.Path, r.Patch)
+		if err != nil {
+			h.view.err = err
+			return
+		}
+		result.IsBinary = result.IsBinary || r.Binary
+		h.diffs[h.cursor] = result
+	}
+	h.view.currentDiff = result
+
+	if h.query == "" {
+		return
+	}
+	for i, line := range result.Lines {
+		if containsFold(line.Content, h.query) {
+			h.view.nav = navState{target: result, offset: -1}
+			h.view.scrollTo(i - h.view.diffPageSize()/2)
+			return
+		}
+	}
+}
+
+// search selects the first record at or after the selected one whose
+// path or diff contains query. An empty query ends the search.
+func (h *History) search(query string) {
+	h.query = query
+	h.matches = nil
+	if query == "" {
+		h.show()
+		return
+	}
+
+	for i, r := range h.records {
+		if containsFold(r.Path, query) || containsFold(r.Patch, query) || containsFold(r.Note, query) {
+			h.matches = append(h.matches, i)
+		}
+	}
+	if len(h.matches) == 0 {
+		h.view.err = fmt.Errorf("no recorded change contains %q", query)
+		return
+	}
+
+	for _, i := range h.matches {
+		if i >= h.cursor {
+			h.selectRecord(i)
+			return
+		}
+	}
+	h.selectRecord(h.matches[0])
+}
+
+// nextMatch selects the next (delta 1) or previous (delta -1) record
+// matching the search, wrapping around
+func (h *History) nextMatch(delta int) {
+	if len(h.matches) == 0 {
+		return
+	}
+
+	if delta > 0 {
+		for _, i := range h.matches {
+			if i > h.cursor {
+				h.selectRecord(i)
+				return
+			}
+		}
+		h.selectRecord(h.matches[0])
+		return
+	}
+	for j := len(h.matches) - 1; j >= 0; j-- {
+		if h.matches[j] < h.cursor {
+			h.selectRecord(h.matches[j])
+			return
+		}
+	}
+	h.selectRecord(h.matches[len(h.matches)-1])
+}
+
+// matchIndex returns the position of the selected record among the
+// matches, or -1
+func (h *History) matchIndex() int {
+	for j, i := range h.matches {
+		if i == h.cursor {
+			return j
+		}
+	}
+	return -1
+}
+
+// View renders the browser
+func (h *History) View() string {
+	m := h.view
+	if m.quitting {
+		return "Goodbye!\n"
+	}
+
+	var b strings.Builder
+
+	headerStyle := lipgloss.NewStyle().
+		Bold(true).
+		Foreground(m.theme.title).
+		BorderStyle(m.glyphs.border).
+		BorderBottom(true).
+		Width(m.width)
+
+	mutedStyle := lipgloss.NewStyle().
+		Foreground(m.theme.muted)
+
+	headerText := "DiffWatch - History Browser\n" +
+		mutedStyle.Italic(true).Render(fmt.Sprintf("History of: %s (offline, nothing is watched)", pathname.Display(h.opts.Path))) +
+		"\n" + mutedStyle.Render(fmt.Sprintf("%d recorded changes from %s", len(h.records), h.opts.Source))
+	b.WriteString(headerStyle.Render(headerText))
+	b.WriteString("\n\n")
+
+	// Recorded changes around the selected one
+	eventStyle := lipgloss.NewStyle().
+		Foreground(m.theme.subtle)
+
+	selectedStyle := lipgloss.NewStyle().
+		Foreground(m.theme.highlight).
+		Bold(true)
+
+	title := fmt.Sprintf("Recorded Changes (%d/%d):", min(h.cursor+1, len(h.records)), len(h.records))
+	if h.query != "" {
+		title += fmt.Sprintf(" %d matching %q", len(h.matches), h.query)
+		if j := h.matchIndex(); j >= 0 {
+			title += fmt.Sprintf(", match %d", j+1)
+		}
+	}
+	b.WriteString(eventStyle.Render(title))
+	b.WriteString("\n")
+
+	if len(h.records) == 0 {
+		b.WriteString(eventStyle.Render("  No changes recorded for this path"))
+		b.WriteString("\n")
+	} else {
+		start := min(max(h.cursor-visibleEvents/2, 0), max(len(h.records)-visibleEvents, 0))
+		for i := start; i < min(start+visibleEvents, len(h.records)); i++ {
+			text := h.recordText(h.records[i])
+			if i == h.cursor {
+				b.WriteString(selectedStyle.Render(m.glyphs.selected + " " + text))
+			} else {
+				level, _ := severity.ParseLevel(h.records[i].Level)
+				b.WriteString(m.levelStyle(level).Render("  " + text))
+			}
+			b.WriteString("\n")
+		}
+	}
+	b.WriteString("\n")
+
+	diffStyle := lipgloss.NewStyle().
+		BorderStyle(m.glyphs.rounded).
+		BorderForeground(m.theme.border).
+		Padding(1).
+		Width(m.width - 4)
+
+	switch {
+	case m.currentDiff == nil:
+		b.WriteString(diffStyle.Render("No change selected"))
+	case !m.currentDiff.HasDiff:
+		b.WriteString(diffStyle.Render(fmt.Sprintf("%s: no diff recorded for this change",
+			pathname.Display(m.currentDiff.Path))))
+	default:
+		b.WriteString(diffStyle.Render(m.renderModernDiff(m.currentDiff, max(m.height-19, 10))))
+	}
+
+	if m.err != nil {
+		errorStyle := lipgloss.NewStyle().
+			Foreground(m.theme.critical).
+			Bold(true)
+		b.WriteString("\n" + errorStyle.Render(fmt.Sprintf("Error: %v", m.err)))
+	}
+
+	b.WriteString("\n")
+	footerStyle := lipgloss.NewStyle().
+		Foreground(m.theme.subtle).
+		Italic(true)
+	if m.prompt != nil {
+		b.WriteString(m.renderPrompt())
+	} else if m.nav.pending != "" {
+		b.WriteString(footerStyle.Render(m.nav.pending + "-"))
+	} else {
+		b.WriteString(footerStyle.Render("Press 'J'/'K' for the next/previous change, '/' to search, 'n'/'N' for the next/previous match, 'j'/'k'/'gg'/'G'/'{'/'}' to scroll, 'w' for whitespace, 'R' to reveal .env values, 'q' to quit"))
+	}
+
+	return b.String()
+}
+
+// recordText describes a recorded change for the list
+func (h *History) recordText(r store.Record) string {
+	path := r.Path
+	if rel, err := filepath.Rel(h.opts.Path, r.Path); err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+		path = rel
+	}
+
+	lines := fmt.Sprintf("+%d -%d", r.Added, r.Deleted)
+	if r.Binary {
+		lines = "binary"
+	}
+	text := fmt.Sprintf("[%s] %s: %s (%s)", r.Time.Local().Format("2006-01-02 15:04:05"), r.Op, h.view.glyphs.withIcon(pathname.Display(path), lang.Detect(r.Path, nil)), lines)
+	if r.Note != "" {
+		text += " note: " + pathname.Display(r.Note)
+	}
+	return text
+}
+
+// containsFold reports whether s contains substr, ignoring case
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
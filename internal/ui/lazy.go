@@ -0,0 +1,166 @@
+package ui
+
+import (
+	"strings"
+	"time"
+
+	"github.com/deemkeen/diffwatch/internal/config"
+	"github.com/deemkeen/diffwatch/internal/diff"
+	"github.com/deemkeen/diffwatch/internal/lang"
+	"github.com/deemkeen/diffwatch/internal/severity"
+	"github.com/deemkeen/diffwatch/internal/state"
+	"github.com/deemkeen/diffwatch/internal/watcher"
+)
+
+// unreadDetail marks event log entries whose change was only hashed
+const unreadDetail = " (not read yet)"
+
+// diffHidden reports whether a change of path would not be displayed
+// right away: another pane covers the diff, or it stays on another file
+func (m *Model) diffHidden(path string) bool {
+	return m.showDigest || m.showHeatmap || m.showFullLog || m.showFilters ||
+		m.stay && m.currentDiff != nil && m.currentDiff.Path != path
+}
+
+// defersRead reports whether the file of an event is only hashed for now
+// and read once its diff is shown, see Options.Lazy. Protection, plugins,
+// external differs, commits, -until and sharing need every change itself.
+func (m *Model) defersRead(event watcher.Event) bool {
+	if !m.opts.Lazy || event.Op == "remove" || !m.diffHidden(event.Path) {
+		return false
+	}
+	if m.mirrored() || m.opts.Share != nil || m.opts.AutoCommit || m.opts.Until != "" {
+		return false
+	}
+
+	rel := m.relPath(event.Path)
+	var language string
+	if l := lang.Detect(event.Path, nil); l != nil {
+		language = l.ID
+	}
+	return !m.opts.Guard.Protected(rel) && !m.opts.Plugins.Applies(rel, language) && !m.opts.Differs.Applies(rel)
+}
+
+// hashOnly logs the change of an event from the hash of its file, without
+// reading it into memory or diffing it. A file whose hash didn't change
+// since it was last read or hashed isn't logged at all. Returns false if
+// the file can't be hashed, e.g. is gone or a directory: the event is
+// processed as usual then.
+func (m *Model) hashOnly(event watcher.Event) bool {
+	info, err := state.Stat(event.Path)
+	if err != nil || info.IsDir() {
+		return false
+	}
+	start := time.Now()
+	hash, err := state.HashFile(event.Path)
+	m.bench.measure(stageRead, start)
+	if err != nil {
+		return false
+	}
+
+	stored, tracked := m.stateManager.Get(event.Path)
+	unchanged := tracked && stored.Exists && stored.Hash == hash
+	if unchanged {
+		// Back to the content last read
+		delete(m.deferred, event.Path)
+		m.markRead(event.Path)
+	}
+	if unchanged || m.deferred[event.Path] == hash {
+		m.log.Debug("event dropped, content unchanged", "path", event.Path, "hash", hash)
+		return true
+	}
+	m.deferred[event.Path] = hash
+
+	level := severity.Info
+	var action config.LevelAction
+	if m.opts.Classifier != nil {
+		level = m.opts.Classifier.Classify(m.relPath(event.Path), nil)
+		action = m.opts.Classifier.Action(m.relPath(event.Path), nil)
+	}
+	m.log.Debug("event hashed, file read once shown", "path", event.Path, "op", event.Op, "hash", hash)
+
+	m.logEvent(event, nil, level, false)
+	if last := &m.events[len(m.events)-1]; last.path == event.Path {
+		last.unread = true
+		last.unseen = true
+		if !strings.HasSuffix(last.detail, unreadDetail) {
+			last.detail += unreadDetail
+		}
+	}
+	if m.stay {
+		m.held++
+	}
+
+	m.activity.processed(event.Timestamp)
+	m.digest.addResult(event.Timestamp, event.Path, event.Op, nil)
+	m.heat.add(event.Path, event.Timestamp)
+	m.alert(event, level, action)
+	m.checkRates(event)
+	m.record(event, nil, level)
+	return true
+}
+
+// readEntry reads and diffs the file of an event log entry whose change
+// was only hashed and returns the diff, which covers all changes of the
+// file since it was last read. Entries that were read return their diff.
+func (m *Model) readEntry(i int) *diff.Result {
+	entry := &m.events[i]
+	if !entry.unread {
+		return entry.result
+	}
+
+	path := entry.path
+	rel := m.relPath(path)
+	delete(m.deferred, path)
+	m.markRead(path)
+	m.render.invalidate()
+
+	result := m.processEvent(&watcher.Event{Path: path, Op: "write", Timestamp: entry.at})
+	if result == nil {
+		return nil
+	}
+	m.opts.Generated.Mark(rel, result)
+	m.opts.Migrations.Mark(rel, result)
+	noise := m.opts.Suppressor.Noise(rel, result)
+	m.opts.Redactor.Result(rel, result)
+	m.log.Debug("deferred change read", "path", path, "changed", result.HasDiff, "suppressed", noise)
+
+	entry.result = result
+	entry.stats = changeStats(result)
+	entry.noise = noise
+	entry.unseen = reviewable(*entry)
+	return result
+}
+
+// markRead clears the marks of the entries of a file whose change was only
+// hashed, once a diff covers them
+func (m *Model) markRead(path string) {
+	for i := range m.events {
+		if entry := &m.events[i]; entry.unread && entry.path == path {
+			entry.unread = false
+			entry.unseen = false
+			entry.detail = strings.TrimSuffix(entry.detail, unreadDetail)
+		}
+	}
+}
+
+// readShown reads the newest change with a diff to show if it was only
+// hashed and the diff pane follows the changes again, e.g. after the
+// digest was closed
+func (m *Model) readShown() {
+	if len(m.deferred) == 0 || m.stay || m.diffHidden("") {
+		return
+	}
+	for i := len(m.events) - 1; i >= 0; i-- {
+		entry := m.events[i]
+		if !entry.unread && !reviewable(entry) || !m.matchesLiveFilter(entry.path) {
+			continue
+		}
+		if entry.unread {
+			if result := m.readEntry(i); result != nil && result.HasDiff && !m.events[i].noise {
+				m.showChange(result)
+			}
+		}
+		return
+	}
+}
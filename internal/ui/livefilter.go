@@ -0,0 +1,67 @@
+package ui
+
+import (
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/deemkeen/diffwatch/internal/match"
+)
+
+// promptLiveFilter asks for the live filter: a substring or glob that
+// paths must match for their events to be listed and their diffs shown.
+// An empty value shows everything again.
+func (m *Model) promptLiveFilter() {
+	m.prompt = newPrompt("Show paths matching (substring or glob)", m.liveFilter, func(value string) tea.Cmd {
+		m.setLiveFilter(strings.TrimSpace(value))
+		return nil
+	})
+}
+
+// setLiveFilter changes the live filter. A displayed diff the filter hides
+// is replaced by the newest matching change in the event log, if any.
+func (m *Model) setLiveFilter(filter string) {
+	m.liveFilter = filter
+	m.fullLog.offset = -1
+	if m.currentDiff == nil || m.matchesLiveFilter(m.currentDiff.Path) {
+		return
+	}
+
+	m.currentDiff, m.baselineDiff = nil, nil
+	events := m.visibleEvents()
+	for i := len(events) - 1; i >= 0; i-- {
+		if entry := events[i]; entry.result != nil && entry.result.HasDiff && !entry.noise {
+			m.showDiff(entry.result)
+			return
+		}
+	}
+}
+
+// matchesLiveFilter reports whether the events of path pass the live
+// filter. Filters with glob characters are matched as globs against the
+// path relative to the watch path, others as case-insensitive substrings.
+func (m *Model) matchesLiveFilter(path string) bool {
+	if m.liveFilter == "" {
+		return true
+	}
+	rel := m.relPath(path)
+	if strings.ContainsAny(m.liveFilter, "*?[") {
+		return match.Glob(m.liveFilter, rel)
+	}
+	return containsFold(rel, m.liveFilter)
+}
+
+// visibleEvents returns the event log entries passing the live filter,
+// oldest first. Entries without a path, like alarms, always pass.
+func (m *Model) visibleEvents() []logEntry {
+	if m.liveFilter == "" {
+		return m.events
+	}
+
+	var entries []logEntry
+	for _, entry := range m.events {
+		if entry.path == "" || m.matchesLiveFilter(entry.path) || entry.from != "" && m.matchesLiveFilter(entry.from) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
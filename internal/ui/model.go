@@ -1,32 +1,213 @@
 package ui
 
 import (
+	"cmp"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/deemkeen/diffwatch/internal/attrib"
+	"github.com/deemkeen/diffwatch/internal/config"
+	"github.com/deemkeen/diffwatch/internal/control"
 	"github.com/deemkeen/diffwatch/internal/diff"
+	"github.com/deemkeen/diffwatch/internal/extdiff"
+	"github.com/deemkeen/diffwatch/internal/generated"
+	"github.com/deemkeen/diffwatch/internal/lang"
+	"github.com/deemkeen/diffwatch/internal/largefile"
+	"github.com/deemkeen/diffwatch/internal/migration"
+	"github.com/deemkeen/diffwatch/internal/notify"
+	"github.com/deemkeen/diffwatch/internal/pathname"
+	"github.com/deemkeen/diffwatch/internal/pipeline"
+	"github.com/deemkeen/diffwatch/internal/plugin"
+	"github.com/deemkeen/diffwatch/internal/protect"
+	"github.com/deemkeen/diffwatch/internal/rate"
+	"github.com/deemkeen/diffwatch/internal/redact"
+	"github.com/deemkeen/diffwatch/internal/schedule"
+	"github.com/deemkeen/diffwatch/internal/severity"
+	"github.com/deemkeen/diffwatch/internal/share"
 	"github.com/deemkeen/diffwatch/internal/state"
+	"github.com/deemkeen/diffwatch/internal/store"
+	"github.com/deemkeen/diffwatch/internal/suppress"
 	"github.com/deemkeen/diffwatch/internal/watcher"
 )
 
+// Options configures optional UI behavior
+type Options struct {
+	Classifier    *severity.Classifier          // Assigns severity levels to events (nil: everything is info)
+	Levels        map[string]config.LevelAction // Bell/notification actions per level name
+	Store         *store.DB                     // Records every event (nil: no recording)
+	MaxDirs       int                           // Warn when more directories are watched (0: never)
+	MaxHistory    int                           // Event log entries kept with their diffs (0: default)
+	LogLines      int                           // Event log entries shown above the diff (0: default)
+	Limits        state.Limits                  // Bounds the memory used for tracked file contents
+	DiffCache     diff.CacheLimits              // Bounds the computed diffs kept for reuse (zero: no cache)
+	Algorithm     diff.Algorithm                // Matches the lines of old and new versions ("": by language)
+	DocumentText  bool                          // Compares the text of PDF and office documents besides their metadata
+	AutoCommit    bool                          // Commit every coalesced change to git
+	GitRoot       string                        // Git repository root (required for AutoCommit)
+	Guard         *protect.Guard                // Alerts on (and optionally reverts) protected path changes
+	Suppressor    *suppress.Suppressor          // Hides changes that only touch noise lines
+	Generated     *generated.Detector           // Summarizes the changes of generated and huge files (nil: none)
+	Migrations    *migration.Checker            // Flags changes to applied database migrations (nil: none)
+	Ops           []string                      // Operations the source reports, shown as the active filter (empty: all)
+	Redactor      *redact.Redactor              // Masks secrets in diffs before they are shown, recorded or shared
+	Plugins       *plugin.Runner                // Analyzes changes with external programs (nil: none)
+	Differs       *extdiff.Runner               // Shows changes of matching files with external diff programs (nil: none)
+	Attributor    *attrib.Attributor            // Finds the processes that make changes (nil: not shown)
+	ProcessFilter *attrib.Filter                // Only shows changes made by these processes (nil: all; needs Attributor)
+	Prescan       bool                          // Snapshot all files at startup as the baseline
+	Lazy          bool                          // Only hash the files of changes whose diff isn't shown, reading them once it is
+	Light         bool                          // Use colors suited to light terminal backgrounds
+	Logger        *slog.Logger                  // Receives processing details (nil: discard)
+	History       []store.Record                // Earlier events shown in the event log, oldest first
+	NoControl     bool                          // Don't serve "diffwatch ctl" requests
+	Digest        time.Duration                 // Window of the digest pane (0: default)
+	Share         *share.Server                 // Streams processed events to viewers (nil: not shared)
+	Follow        bool                          // Show what the presenter of the mirrored shared session shows, see share.Focus
+	Bench         bool                          // Measure and show the latency of each processing stage
+	Until         string                        // Quit once a file matching the glob changes, see Matched ("": never)
+	Timeout       time.Duration                 // Quit once this much time has passed, see TimedOut (0: never)
+	Output        io.Writer                     // Where the screen is drawn (nil: stdout)
+	RateAlarms    *rate.Monitor                 // Raises alarms when files change too often (nil: none)
+	NotifyHours   *schedule.Schedule            // When bells, sounds and desktop notifications fire (nil: always)
+	RecordHours   *schedule.Schedule            // When changes are recorded to Store (nil: always)
+	Config        *config.Config                // Settings included in crash reports (nil: left out)
+	ConfigPath    string                        // Config file the filter editor saves to ("": .diffwatch.json in the watch path)
+	Include       []string                      // Globs of the paths whose changes are shown, edited with 'I' (empty: all)
+	Exclude       []string                      // Globs of the paths whose changes are hidden, edited with 'I'
+	WatchDirs     []string                      // Directories of watcher.SkipDirs the source watches anyway, saved with the filters
+	A11y          bool                          // Print changes as plain lines for screen readers instead of drawing the screen
+	ASCII         bool                          // Draw only ASCII: no emoji, symbols or box drawing borders
+}
+
 // Model represents the UI state
 type Model struct {
-	watcher      *watcher.FileWatcher
+	watcher      Source
 	stateManager *state.Manager
+	largeFiles   *largefile.Tracker  // Snapshots of files over pipeline.MaxDiffSize (nil: unavailable)
+	processor    *pipeline.Processor // Reads and diffs the files of events
+	bench        *bench              // Measures event latency (nil: off)
+	matched      *untilMatch         // Change that matched Options.Until, ending the session
+	a11y         a11yState           // What Options.A11y printed so far
+	render       renderCache         // Sections of the last frame, reused while nothing they show changed
+	timedOut     bool                // Options.Timeout ended the session
 	diffEngine   *diff.Engine
-
-	events         []string     // Recent events log
-	currentDiff    *diff.Result // Current diff to display
+	opts         Options
+	theme        theme
+	glyphs       glyphs
+	log          *slog.Logger
+
+	events         []logEntry                       // Event log history, oldest first
+	historyDropped int                              // Event log entries evicted to stay within MaxHistory
+	logged         int                              // Event log entries appended so far
+	evictions      state.Evictions                  // Tracked files evicted so far, as last reported
+	currentDiff    *diff.Result                     // Current diff to display
+	baselineDiff   *diff.Result                     // Diff of the current file since its baseline: session start, or when accepted
+	accepted       map[string]time.Time             // When files were accepted as their new baseline with 'B', by path
+	acceptedAll    time.Time                        // When all files were accepted with 'alt+b' (zero: never)
+	pinned         []pinnedDiff                     // Diffs pinned with 'P'
+	pinIndex       int                              // Pinned diff being displayed, -1 for the live diff
+	diffMode       diffMode                         // Which diff(s) to display
+	showBlame      bool                             // Annotate deleted lines with git blame
+	showDigest     bool                             // Show the per-file activity digest instead of the diff
+	showHeatmap    bool                             // Show the change heatmap of the tree instead of the diff
+	showFullLog    bool                             // Show every kept event log entry instead of the diff
+	showFilters    bool                             // Show the filter editor instead of the diff
+	filterEditor   filterEditor                     // Selection of the filter editor
+	include        []string                         // Globs of the paths whose changes are shown (empty: all)
+	exclude        []string                         // Globs of the paths whose changes are hidden
+	fullLog        fullLog                          // Scroll position and filter of the full event log
+	liveFilter     string                           // Substring or glob of the paths whose events are shown, set with 'f' (empty: all)
+	showWhitespace bool                             // Make tabs, trailing whitespace and control characters visible
+	rawLines       bool                             // Show the lines of structured files instead of their element changes, and the built-in diff instead of external differ output
+	showPreview    bool                             // Show Markdown files rendered next to their diff
+	revealValues   bool                             // Show the values of .env files instead of masking them
+	preview        preview                          // Last rendered Markdown preview
+	absPaths       bool                             // Show absolute paths instead of paths relative to the watch path
+	showHelp       bool                             // Show the key help instead of the status bar
+	paused         bool                             // Hold events back until resumed
+	stay           bool                             // Keep the displayed file in the diff pane instead of jumping to the newest change, toggled with 'l'
+	held           int                              // Changes to other files not displayed while staying
+	filtering      bool                             // Events are being attributed for ProcessFilter
+	activity       activity                         // Event counters for the status bar
+	nav            navState                         // Vim-style scroll position in the diff pane
+	follow         follow                           // Following the presenter of a shared session
+	goneRoots      []watcher.GoneRoot               // Watched roots that were deleted or unmounted, as last checked
+	rebuilds       map[string]int                   // Watch rebuilds after stale watch errors already logged, by root
+	digest         digest                           // Changes within the digest window
+	heat           heatmap                          // Decaying change frequency by file
+	gitRoot        string                           // Git repository root, detected on first use
+	blames         blameCache                       // Blame of old diff contents by blameKey
+	pluginReports  map[*diff.Result][]plugin.Report // Plugin verdicts and findings by change
+	externalDiffs  map[*diff.Result]extdiff.Output  // Output of external differs by change
+	commitMu       sync.Mutex                       // Serializes automatic commits
+	protectAlerts  []protectAlert                   // Unacknowledged protected path changes
+	prompt         *prompt                          // Active text input (nil: none)
+	send           func(tea.Msg)                    // Delivers messages from other goroutines to the running program
+	prescan        *state.Progress                  // Startup scan progress (nil: no prescan)
 	width          int
 	height         int
 	err            error
 	quitting       bool
 	lastRenderTime time.Time              // Track last render for throttling
 	pendingEvents  map[string]eventUpdate // Coalesce rapid events for same file
+	viaTemp        map[string]string      // Temporary file the next logged change of a file was renamed from, by path
+	deferred       map[string]string      // Hash of the files changed but not read yet, by path, see Options.Lazy
+}
+
+// diffMode selects which comparison is shown in the diff pane
+type diffMode int
+
+const (
+	modeLastChange diffMode = iota // Previous state vs current state
+	modeBaseline                   // Session start vs current state
+	modeBoth                       // Both diffs stacked
+)
+
+// String returns a human readable label for the mode
+func (d diffMode) String() string {
+	switch d {
+	case modeBaseline:
+		return "since session start"
+	case modeBoth:
+		return "last change + since session start"
+	default:
+		return "since last change"
+	}
+}
+
+// defaultMaxHistory is the number of event log entries kept by default
+const defaultMaxHistory = 100
+
+// visibleEvents is the number of event log entries shown by default
+const visibleEvents = 5
+
+// logEntry is a single line in the event log
+type logEntry struct {
+	text    string // Up to the paths, if the entry shows any, see entryText
+	path    string // File the entry is about, shown after text
+	from    string // Previous path of a renamed file, shown before path
+	detail  string // After the paths
+	level   severity.Level
+	noise   bool         // Change only touched lines matching suppression rules
+	result  *diff.Result // Diff of the change, if any
+	stats   string       // Lines added and deleted, see changeStats
+	process string       // Process that made the change, if attributed
+	unseen  bool         // Diff of the change not marked as seen with 's' yet
+	at      time.Time    // When the newest change of the entry happened, as recorded
+	note    string       // Free-text note attached with ','
+	unread  bool         // Change only hashed so far, see Options.Lazy
 }
 
 // eventUpdate tracks the most recent event for a file
@@ -41,53 +222,200 @@ type fileEventMsg watcher.Event
 // processCoalescedMsg triggers processing of coalesced events
 type processCoalescedMsg struct{}
 
+// prescanDoneMsg signals that the startup scan finished
+type prescanDoneMsg struct {
+	err error
+}
+
 // errMsg wraps an error for the tea runtime
 type errMsg error
 
 // New creates a new UI model
-func New(fw *watcher.FileWatcher) *Model {
-	return &Model{
-		watcher:       fw,
-		stateManager:  state.New(),
-		diffEngine:    diff.New(),
-		events:        make([]string, 0),
+func New(src Source, opts Options) *Model {
+	t := darkTheme
+	if opts.Light {
+		t = lightTheme
+	}
+
+	log := opts.Logger
+	if log == nil {
+		log = slog.New(slog.DiscardHandler)
+	}
+
+	if opts.MaxHistory <= 0 {
+		opts.MaxHistory = defaultMaxHistory
+	}
+	if opts.LogLines <= 0 {
+		opts.LogLines = visibleEvents
+	}
+	if opts.Output == nil {
+		opts.Output = os.Stdout
+	}
+
+	stateManager := state.New()
+	stateManager.SetLimits(opts.Limits)
+	diffEngine := diff.New(src.WatchPath(), opts.Algorithm)
+	diffEngine.SetCacheLimits(opts.DiffCache)
+	diffEngine.SetDocumentText(opts.DocumentText)
+
+	if opts.Digest <= 0 {
+		opts.Digest = defaultDigestWindow
+	}
+
+	g := newGlyphs(opts.ASCII)
+	events := historyEntries(opts.History, g)
+	if len(events) > opts.MaxHistory {
+		events = events[len(events)-opts.MaxHistory:]
+	}
+
+	d := digest{window: opts.Digest}
+	d.addRecords(opts.History)
+
+	var h heatmap
+	h.addRecords(opts.History)
+
+	largeFiles, err := largefile.NewTracker(largefile.Limits{}, opts.Algorithm)
+	if err != nil {
+		log.Warn("large file diffs unavailable", "error", err)
+	}
+
+	m := &Model{
+		theme:         t,
+		glyphs:        g,
+		log:           log,
+		watcher:       src,
+		stateManager:  stateManager,
+		largeFiles:    largeFiles,
+		bench:         newBench(opts.Bench),
+		diffEngine:    diffEngine,
+		opts:          opts,
+		events:        events,
 		pendingEvents: make(map[string]eventUpdate),
+		viaTemp:       make(map[string]string),
+		deferred:      make(map[string]string),
+		include:       slices.Clone(opts.Include),
+		exclude:       slices.Clone(opts.Exclude),
+		pluginReports: make(map[*diff.Result][]plugin.Report),
+		externalDiffs: make(map[*diff.Result]extdiff.Output),
+		accepted:      make(map[string]time.Time),
+		rebuilds:      make(map[string]int),
+		gitRoot:       opts.GitRoot,
+		pinIndex:      -1,
+		follow:        follow{on: opts.Follow},
+		fullLog:       fullLog{offset: -1},
+		digest:        d,
+		heat:          h,
 		width:         80,
 		height:        24,
 	}
+	m.processor = pipeline.New(stateManager, diffEngine, pipeline.Options{
+		LargeFiles: largeFiles,
+		Logger:     log,
+		Seed:       m.seedState,
+		Measure: func(stage pipeline.Stage, start time.Time) {
+			if stage == pipeline.Read {
+				m.bench.measure(stageRead, start)
+			} else {
+				m.bench.measure(stageDiff, start)
+			}
+		},
+	})
+	return m
 }
 
-// Start starts the bubbletea program
+// Start starts the bubbletea program. A panic ends it with an error
+// naming the crash report written for it.
 func (m *Model) Start() error {
-	p := tea.NewProgram(m, tea.WithAltScreen())
+	screen := []tea.ProgramOption{tea.WithAltScreen(), tea.WithOutput(m.opts.Output)}
+	if m.opts.A11y {
+		// Lines are printed as they come, and Control-C interrupts
+		screen = []tea.ProgramOption{tea.WithoutRenderer(), tea.WithInput(nil)}
+	}
 
-	// Start listening for file events in background
-	go m.listenForEvents(p)
+	g := &guard{model: m}
+	p := tea.NewProgram(g, screen...)
+	g.quit = p.Quit
+	defer m.start(p.Send)()
 
 	_, err := p.Run()
+	if g.panic != nil {
+		return crashError(g.panic, append(m.crashSections(""), m.configSections()...))
+	}
+	if m.opts.A11y && errors.Is(err, tea.ErrInterrupted) {
+		return nil
+	}
 	return err
 }
 
+// start starts the background work of the model, which delivers its
+// messages with send, and returns a function that stops it
+func (m *Model) start(send func(tea.Msg)) (stop func()) {
+	m.send = send
+
+	// Accept watch set changes from "diffwatch ctl"
+	var srv *control.Server
+	if !m.opts.NoControl {
+		var err error
+		if srv, err = m.listenControl(); err != nil {
+			m.err = err
+		}
+	}
+
+	// Start listening for file events in background
+	go m.listenForEvents()
+	if src, ok := m.watcher.(focusSource); ok {
+		go m.listenForFocus(src)
+	}
+
+	if m.opts.Prescan {
+		m.prescan = &state.Progress{}
+		go m.runPrescan()
+	}
+
+	return func() {
+		if srv != nil {
+			srv.Close()
+		}
+		if m.largeFiles != nil {
+			m.largeFiles.Close()
+		}
+	}
+}
+
+// runPrescan prescans the watched files in the background, its progress
+// shown in the status bar until it reports that it's done
+func (m *Model) runPrescan() {
+	defer m.recoverPanic()
+	m.send(prescanDoneMsg{err: m.processor.Prescan(m.watcher.WalkFiles, m.prescan)})
+}
+
 // Quit signals the program to quit
 func (m *Model) Quit() {
 	m.quitting = true
 }
 
+// capturesKeys reports whether a modal alert, prompt or unfinished
+// two-key command takes all key presses
+func (m *Model) capturesKeys() bool {
+	return len(m.protectAlerts) > 0 || m.prompt != nil || m.nav.pending != ""
+}
+
 // listenForEvents listens for file system events and sends them to the tea program
-func (m *Model) listenForEvents(p *tea.Program) {
+func (m *Model) listenForEvents() {
+	defer m.recoverPanic()
 	for {
 		select {
 		case event, ok := <-m.watcher.Events():
 			if !ok {
 				return
 			}
-			p.Send(fileEventMsg(event))
+			m.send(fileEventMsg(event))
 
 		case err, ok := <-m.watcher.Errors():
 			if !ok {
 				return
 			}
-			p.Send(errMsg(err))
+			m.send(errMsg(err))
 		}
 	}
 }
@@ -95,19 +423,121 @@ func (m *Model) listenForEvents(p *tea.Program) {
 // Init initializes the model
 func (m *Model) Init() tea.Cmd {
 	// Start a ticker to process coalesced events periodically
-	return tea.Tick(250*time.Millisecond, func(t time.Time) tea.Msg {
+	return tea.Batch(tea.Tick(250*time.Millisecond, func(t time.Time) tea.Msg {
 		return processCoalescedMsg{}
-	})
+	}), m.timeoutCmd())
 }
 
 // Update handles messages and updates the model
 func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	defer m.syncFocus()
+	defer m.readShown()
+
+	// Idle ticks change nothing shown, the others may
+	if _, tick := msg.(processCoalescedMsg); !tick {
+		m.render.invalidate()
+	}
+
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		// A protected path alert is modal until acknowledged
+		if len(m.protectAlerts) > 0 {
+			switch msg.String() {
+			case "ctrl+c":
+				m.quitting = true
+				return m, tea.Quit
+			case "enter", "esc":
+				m.dismissProtectAlert()
+			}
+			return m, nil
+		}
+
+		if m.prompt != nil {
+			return m, m.handlePromptKey(msg)
+		}
+
+		if m.showFullLog && m.handleFullLogKey(msg.String()) {
+			return m, nil
+		}
+		if m.showFilters {
+			if cmd, ok := m.handleFilterKey(msg.String()); ok {
+				return m, cmd
+			}
+		}
+		if m.handleNavKey(msg.String()) {
+			return m, nil
+		}
+
 		switch msg.String() {
 		case "q", "ctrl+c":
 			m.quitting = true
 			return m, tea.Quit
+		case "tab":
+			m.diffMode = (m.diffMode + 1) % 3
+		case "b":
+			return m, m.toggleBlame()
+		case "S":
+			return m, m.stageHunk()
+		case "s":
+			m.toggleSeen()
+		case "n":
+			m.showNextUnseen()
+			return m, m.blameCmd()
+		case ",":
+			m.promptNote()
+		case "l":
+			m.toggleStay()
+		case "F":
+			m.toggleFollow()
+		case "B":
+			m.acceptShown()
+		case "alt+b":
+			m.acceptAll()
+		case "D":
+			m.showDigest = !m.showDigest
+			m.showHeatmap, m.showFullLog, m.showFilters = false, false, false
+		case "H":
+			m.showHeatmap = !m.showHeatmap
+			m.showDigest, m.showFullLog, m.showFilters = false, false, false
+		case "L":
+			m.showFullLog = !m.showFullLog
+			m.showDigest, m.showHeatmap, m.showFilters = false, false, false
+		case "I":
+			m.showFilters = !m.showFilters
+			m.showDigest, m.showHeatmap, m.showFullLog = false, false, false
+		case "f":
+			m.promptLiveFilter()
+		case "w":
+			m.showWhitespace = !m.showWhitespace
+		case "r":
+			m.rawLines = !m.rawLines
+		case "v":
+			m.showPreview = !m.showPreview
+		case "R":
+			m.revealValues = !m.revealValues
+		case "A":
+			m.absPaths = !m.absPaths
+		case " ":
+			m.paused = !m.paused
+		case "?":
+			m.showHelp = !m.showHelp
+		case "a":
+			m.promptAddRoot()
+		case "d":
+			m.promptRemoveRoot()
+		case "P":
+			m.togglePin()
+			return m, m.blameCmd()
+		case "[":
+			m.cyclePins(-1)
+			return m, m.blameCmd()
+		case "]":
+			m.cyclePins(1)
+			return m, m.blameCmd()
+		case "esc":
+			m.pinIndex = -1
+			m.nav.offset = -1
+			return m, m.blameCmd()
 		}
 
 	case tea.WindowSizeMsg:
@@ -117,6 +547,12 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case fileEventMsg:
 		// Coalesce events - store only the latest event for each file
 		event := watcher.Event(msg)
+		if !m.passesFilters(event.Path) {
+			m.log.Debug("event hidden", "path", event.Path, "reason", "include/exclude globs")
+			return m, nil
+		}
+		m.activity.received(event)
+		m.bench.receive(event)
 		m.pendingEvents[event.Path] = eventUpdate{
 			event:     event,
 			timestamp: time.Now(),
@@ -127,147 +563,478 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case processCoalescedMsg:
 		// Process all pending events that haven't been updated in a while
 		now := time.Now()
+		logged := m.logged
 		processThreshold := 200 * time.Millisecond
 
+		// While paused, events wait coalesced by file
+		var ready []watcher.Event
 		for path, update := range m.pendingEvents {
-			if now.Sub(update.timestamp) >= processThreshold {
-				m.handleFileEvent(update.event)
+			threshold := processThreshold
+			if _, ok := tempStem(path); ok {
+				threshold = tempHold
+			}
+			if !m.paused && !m.filtering && now.Sub(update.timestamp) >= threshold {
+				ready = append(ready, update.event)
 				delete(m.pendingEvents, path)
 			}
 		}
+		ready = m.correlateTemps(ready)
+
+		// Keep the order the source sent them in, e.g. for rename detection
+		slices.SortFunc(ready, func(a, b watcher.Event) int {
+			return cmp.Compare(a.Seq, b.Seq)
+		})
+
+		var cmds []tea.Cmd
+		if m.opts.ProcessFilter != nil {
+			// Changes are attributed before they're shown or dropped
+			cmds = append(cmds, m.filterCmd(ready))
+		} else {
+			for _, event := range ready {
+				cmds = append(cmds, m.handleFileEvent(event))
+			}
+		}
+
+		m.checkGoneRoots()
+		m.checkRebuilds()
+		if len(ready) > 0 || m.logged != logged {
+			m.render.invalidate()
+		}
 
 		// Schedule next coalescing tick
-		return m, tea.Tick(250*time.Millisecond, func(t time.Time) tea.Msg {
+		cmds = append(cmds, m.blameCmd(), tea.Tick(250*time.Millisecond, func(t time.Time) tea.Msg {
 			return processCoalescedMsg{}
-		})
+		}))
+		return m, tea.Batch(cmds...)
+
+	case commitMsg:
+		if msg.err != nil {
+			m.log.Error("auto-commit failed", "error", msg.err)
+			m.err = msg.err
+		}
+
+	case blameMsg:
+		m.handleBlame(msg)
+
+	case pluginMsg:
+		m.handlePlugins(msg)
+
+	case externalDiffMsg:
+		m.handleExternalDiff(msg)
+
+	case focusMsg:
+		f := share.Focus(msg)
+		m.follow.focus = &f
+
+	case attribMsg:
+		m.handleAttrib(msg)
+
+	case filteredMsg:
+		return m, m.handleFiltered(msg)
+
+	case stagedMsg:
+		m.handleStaged(msg)
+
+	case prescanDoneMsg:
+		if msg.err != nil {
+			m.err = fmt.Errorf("prescan: %w", msg.err)
+		}
+
+	case rootsChangedMsg:
+		m.handleRootsChanged(msg)
+
+	case timeoutMsg:
+		return m, m.handleTimeout()
 
 	case errMsg:
+		rethrow(msg)
+		m.log.Error("watcher error", "error", error(msg))
 		m.err = msg
 	}
 
 	return m, nil
 }
 
-// handleFileEvent processes a file event and updates the diff
-func (m *Model) handleFileEvent(event watcher.Event) {
-	// Throttle event log updates - don't add same file multiple times in quick succession
-	shouldAddToLog := true
-	if len(m.events) > 0 {
-		// Check if last event was for the same file within last second
-		lastEvent := m.events[len(m.events)-1]
-		if strings.Contains(lastEvent, event.Path) {
-			timeSinceLastRender := time.Since(m.lastRenderTime)
-			if timeSinceLastRender < 500*time.Millisecond {
-				shouldAddToLog = false
-			}
+// handleFileEvent processes a file event, updates the diff and logs the event.
+// Returns a command for follow-up work, if any.
+func (m *Model) handleFileEvent(event watcher.Event) tea.Cmd {
+	m.bench.begin(event)
+	defer m.bench.end()
+	defer delete(m.viaTemp, event.Path)
+
+	var alias string
+	if !m.mirrored() {
+		alias = m.processor.Canonical(&event)
+	}
+
+	if m.defersRead(event) && m.hashOnly(event) {
+		return nil
+	}
+	// A diff read now covers the changes only hashed before
+	if _, ok := m.deferred[event.Path]; ok {
+		delete(m.deferred, event.Path)
+		m.markRead(event.Path)
+	}
+
+	result := m.processEvent(&event)
+	// Blames of the file are stale once it changed or was removed
+	m.blames.forget(event.Path)
+	if alias != "" {
+		if result == nil || !result.HasDiff {
+			m.log.Debug("event of a linked path dropped, its file is unchanged", "path", alias, "file", event.Path)
+			return nil
 		}
+		m.log.Debug("event of a linked path reported for its file", "path", alias, "file", event.Path)
+	}
+
+	renamed := result != nil && result.RenamedFrom != ""
+	m.opts.Generated.Mark(m.relPath(event.Path), result)
+	m.opts.Migrations.Mark(m.relPath(event.Path), result)
+
+	// Changes that only touch noise lines don't replace the displayed diff
+	noise := m.opts.Suppressor.Noise(m.relPath(event.Path), result)
+	if result != nil && (result.HasDiff || renamed) && !noise && m.matchesLiveFilter(event.Path) {
+		m.showChange(result)
+	}
+
+	m.checkProtected(event, result)
+
+	level := severity.Info
+	var action config.LevelAction
+	if m.opts.Classifier != nil && !noise {
+		level = m.opts.Classifier.Classify(m.relPath(event.Path), result)
+		action = m.opts.Classifier.Action(m.relPath(event.Path), result)
+	}
+
+	// A merge or rebase left conflicts behind: hard to miss
+	if result != nil && result.GainedConflicts() {
+		m.log.Info("conflict markers detected", "path", event.Path, "regions", result.Conflicts)
+		level = max(level, severity.Warn)
 	}
 
-	if shouldAddToLog {
-		// Add to event log
-		eventStr := fmt.Sprintf("[%s] %s: %s",
-			event.Timestamp.Format("15:04:05"),
-			event.Op,
-			event.Path)
+	// Databases an edited migration already ran on won't see the edit
+	if result != nil && result.Dangerous != "" {
+		m.log.Warn("dangerous change", "path", event.Path, "reason", result.Dangerous)
+		level = severity.Critical
+	}
+
+	plugins := m.pluginCmd(event, result)
+	external := m.externalDiffCmd(event, result)
+
+	// Rules, protection and plugins saw the real content, everything after
+	// only the masked one
+	m.opts.Redactor.Result(m.relPath(event.Path), result)
+
+	if result != nil {
+		added, deleted := result.Stats()
+		m.log.Debug("event processed", "path", event.Path, "op", event.Op,
+			"changed", result.HasDiff, "added", added, "deleted", deleted,
+			"level", level.String(), "suppressed", noise)
+	}
 
-		m.events = append(m.events, eventStr)
-		if len(m.events) > 5 {
-			m.events = m.events[1:]
+	m.logEvent(event, result, level, noise)
+	m.activity.processed(event.Timestamp)
+	m.digest.addResult(event.Timestamp, event.Path, event.Op, result)
+	m.heat.add(event.Path, event.Timestamp)
+	m.reportEvictions()
+	m.alert(event, level, action)
+	m.checkRates(event)
+	m.record(event, result, level)
+	m.share(event, result)
+
+	return tea.Batch(m.commitCmd(event, result), plugins, external, m.attribCmd(event), m.checkUntil(event, result, noise))
+}
+
+// record stores the event in the change database if one is configured
+func (m *Model) record(event watcher.Event, result *diff.Result, level severity.Level) {
+	if m.opts.Store == nil {
+		return
+	}
+	if !m.opts.RecordHours.Active(time.Now()) {
+		m.log.Debug("event not recorded", "path", event.Path, "reason", "outside the record schedule")
+		return
+	}
+
+	r := store.Record{
+		Time:  event.Timestamp,
+		Path:  event.Path,
+		Op:    event.Op,
+		Level: level.String(),
+		Seq:   event.Seq,
+	}
+	if result != nil {
+		if result.OldState != nil {
+			r.OldHash = result.OldState.Hash
 		}
-		m.lastRenderTime = time.Now()
+		if result.NewState != nil {
+			r.NewHash = result.NewState.Hash
+		}
+		r.Added, r.Deleted = result.Stats()
+		r.Binary = result.IsBinary
+		r.Patch = result.Unified
 	}
 
-	// For remove events, we can't stat the file (it's gone)
-	// but we can still process it to show deletion diff
-	if event.Op == "remove" {
-		// Update state and compute deletion diff
-		oldState, newState, err := m.stateManager.Update(event.Path)
-		if err != nil {
-			m.err = err
+	if err := m.opts.Store.Record(r); err != nil {
+		m.log.Error("recording event failed", "path", event.Path, "error", err)
+		m.err = err
+	}
+}
+
+// logEvent adds an event to the event log. Suppressed (noise) events are
+// logged dimmed. Renames show the previous path.
+func (m *Model) logEvent(event watcher.Event, result *diff.Result, level severity.Level, noise bool) {
+	// Throttle event log updates - don't add same file multiple times in quick
+	// succession, unless every change is printed
+	if len(m.events) > 0 && !m.opts.A11y {
+		// Check if last event was for the same file within last second
+		last := &m.events[len(m.events)-1]
+		if last.path == event.Path && time.Since(m.lastRenderTime) < 500*time.Millisecond {
+			// Keep the most severe level of the coalesced entries
+			if level > last.level {
+				last.level = level
+			}
+			last.noise = last.noise && noise
+			if result != nil {
+				last.result = result
+				last.stats = changeStats(result)
+				last.unseen = reviewable(*last)
+			}
+			last.at = event.Timestamp
 			return
 		}
+	}
 
-		result, err := m.diffEngine.Compute(oldState, newState)
-		if err != nil {
+	// Add to event log
+	var language *lang.Language
+	if result != nil {
+		language = result.Language
+	}
+	entry := logEntry{
+		text:   fmt.Sprintf("[%s] %s: %s", event.Timestamp.Format("15:04:05"), event.Op, m.glyphs.withIcon("", language)),
+		path:   event.Path,
+		level:  level,
+		noise:  noise,
+		result: result,
+		stats:  changeStats(result),
+		at:     event.Timestamp,
+	}
+	entry.unseen = reviewable(entry)
+	if result != nil && result.RenamedFrom != "" {
+		entry.from = result.RenamedFrom
+		entry.detail = fmt.Sprintf(" (%d%% similar)", result.Similarity)
+	}
+	if tmp, ok := m.viaTemp[event.Path]; ok {
+		entry.detail += " (via " + pathname.Display(filepath.Base(tmp)) + ")"
+	}
+	if result != nil && result.Conflicts > 0 {
+		entry.detail += " " + m.glyphs.with(m.glyphs.warning, fmt.Sprintf("%d conflicts", result.Conflicts))
+	}
+	if result != nil && result.Locked {
+		entry.detail += " " + m.glyphs.with(m.glyphs.locked, "locked")
+	}
+	if result != nil && result.Dangerous != "" {
+		entry.detail += " " + m.glyphs.with(m.glyphs.warning, "dangerous")
+	}
+
+	m.appendLog(entry)
+	m.lastRenderTime = time.Now()
+}
+
+// alert rings the bell, plays a sound and/or sends a desktop notification
+// if configured for the event's level or by the rules matching it
+func (m *Model) alert(event watcher.Event, level severity.Level, rules config.LevelAction) {
+	m.notify(level, rules, fmt.Sprintf("diffwatch: %s", level), fmt.Sprintf("%s: %s", event.Op, m.displayPath(event.Path)))
+}
+
+// notify performs the actions configured for a level plus the bell and
+// sound of extra: playing the sound or ringing the bell, and/or sending a
+// desktop notification with title and message
+func (m *Model) notify(level severity.Level, extra config.LevelAction, title, message string) {
+	if !m.opts.NotifyHours.Active(time.Now()) {
+		m.log.Debug("notification held back", "message", message, "reason", "outside the notify schedule")
+		return
+	}
+
+	action := m.opts.Levels[level.String()]
+	action.Bell = action.Bell || extra.Bell
+	if extra.Sound != "" {
+		action.Sound = extra.Sound
+	}
+
+	switch {
+	case action.Sound != "":
+		if err := notify.Play(action.Sound); err != nil {
 			m.err = err
-			return
+			notify.Bell()
 		}
+	case action.Bell:
+		notify.Bell()
+	}
 
-		if result.HasDiff {
-			m.currentDiff = result
+	if action.Notify {
+		if err := notify.Desktop(title, message); err != nil {
+			m.err = err
 		}
-		return
 	}
+}
 
-	// For non-remove events, stat the file to get info
-	info, err := os.Stat(event.Path)
-	if err != nil {
-		// File might have been deleted or is inaccessible
-		if os.IsNotExist(err) {
-			m.err = fmt.Errorf("file not found: %s", event.Path)
+// appendLog adds an entry to the event log, evicting the oldest entries
+// beyond MaxHistory
+func (m *Model) appendLog(entry logEntry) {
+	m.events = append(m.events, entry)
+	m.logged++
+	if over := len(m.events) - m.opts.MaxHistory; over > 0 {
+		for _, evicted := range m.events[:over] {
+			delete(m.pluginReports, evicted.result)
+			delete(m.externalDiffs, evicted.result)
 		}
-		return
+		m.events = slices.Delete(m.events, 0, over)
+		m.historyDropped += over
 	}
+}
 
-	if info.IsDir() {
+// reportEvictions logs files evicted from the state manager since the
+// last call
+func (m *Model) reportEvictions() {
+	evictions := m.stateManager.Evictions()
+	if evictions.Files == m.evictions.Files {
 		return
 	}
 
-	// Skip files larger than 1MB for diff computation
-	const maxDiffSize = 1 * 1024 * 1024 // 1MB
-	if info.Size() > maxDiffSize {
-		m.currentDiff = &diff.Result{
-			Path:     event.Path,
-			HasDiff:  true,
-			IsBinary: false,
-			Lines:    []diff.DiffLine{},
-		}
-		m.err = fmt.Errorf("file too large for diff (%d bytes, max %d bytes)",
-			info.Size(), maxDiffSize)
-		return
+	m.log.Info("evicted tracked files to stay within limits",
+		"files", evictions.Files-m.evictions.Files,
+		"bytes", evictions.Bytes-m.evictions.Bytes,
+		"total_files", evictions.Files)
+	m.evictions = evictions
+}
+
+// relPath returns path relative to the watch root, or path itself if it
+// is outside the root
+func (m *Model) relPath(path string) string {
+	rel, err := filepath.Rel(m.watcher.WatchPath(), path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return path
 	}
+	return rel
+}
 
-	// Clear any previous "file too large" errors
-	if m.err != nil && strings.Contains(m.err.Error(), "file too large") {
-		m.err = nil
+// displayPath returns path relative to the watch path in a form that is
+// safe to show in the terminal
+func (m *Model) displayPath(path string) string {
+	return pathname.Display(m.relPath(path))
+}
+
+// showPath returns path as shown in the event log, panes and diff
+// header: relative to the watch path unless absolute paths are toggled on,
+// and truncated in the middle to width cells (no limit below 1)
+func (m *Model) showPath(path string, width int) string {
+	if !m.absPaths && m.watcher != nil {
+		path = m.relPath(path)
 	}
+	return pathname.TruncateWith(pathname.Display(path), width, m.glyphs.ellipsis)
+}
 
-	// Update state and compute diff
-	oldState, newState, err := m.stateManager.Update(event.Path)
-	if err != nil {
-		m.err = err
-		return
+// entryText returns the text of an event log entry with its paths, which
+// are truncated to fit the entry in width cells (no limit below 1)
+func (m *Model) entryText(entry logEntry, width int) string {
+	if entry.path == "" {
+		return entry.text + entry.detail
 	}
 
-	result, err := m.diffEngine.Compute(oldState, newState)
-	if err != nil {
+	// Paths share the width left by the rest of the entry, but are never
+	// cut to less than a readable minimum
+	const minPathWidth = 16
+	if width > 0 {
+		width = max(width-ansi.StringWidth(entry.text+entry.detail), minPathWidth)
+	}
+	if entry.from == "" {
+		return entry.text + m.showPath(entry.path, width) + entry.detail
+	}
+	arrow := " " + m.glyphs.arrow + " "
+	if width > 0 {
+		width = max((width-ansi.StringWidth(arrow))/2, minPathWidth)
+	}
+	return entry.text + m.showPath(entry.from, width) + arrow + m.showPath(entry.path, width) + entry.detail
+}
+
+// processEvent updates the state for an event and computes the diff, see
+// pipeline.Processor.Process. Returns the computed diff, or nil if no
+// diff could be computed.
+func (m *Model) processEvent(event *watcher.Event) *diff.Result {
+	// Files of a shared session or a container can't be read locally
+	if src, ok := m.watcher.(mirrorSource); ok {
+		return m.mirrorDiff(src, event.Path)
+	}
+
+	result, err := m.processor.Process(event)
+	switch {
+	case err != nil:
 		m.err = err
-		return
+	case m.err != nil && strings.Contains(m.err.Error(), "file too large"):
+		// Clear any previous "file too large" errors
+		m.err = nil
+	}
+	return result
+}
+
+// showDiff makes result the displayed diff
+func (m *Model) showDiff(result *diff.Result) {
+	m.currentDiff = result
+	m.baselineDiff = m.computeBaselineDiff(result)
+}
+
+// computeBaselineDiff computes the diff between the session baseline and
+// the new state of a diff result
+func (m *Model) computeBaselineDiff(current *diff.Result) *diff.Result {
+	if current.NewState == nil {
+		return nil
+	}
+
+	baseline, ok := m.stateManager.Baseline(current.Path)
+	if !ok {
+		return nil
 	}
 
-	if result.HasDiff {
-		m.currentDiff = result
+	result, err := m.diffEngine.Compute(baseline, current.NewState)
+	if err != nil {
+		m.err = err
+		return nil
 	}
+	m.opts.Generated.Mark(m.relPath(result.Path), result)
+	m.opts.Migrations.Mark(m.relPath(result.Path), result)
+	return result
 }
 
 // View renders the UI
 func (m *Model) View() string {
+	// A frame completes the latency of the events processed before it
+	defer m.bench.rendered()
+
+	if m.opts.A11y {
+		m.printLinear()
+		return ""
+	}
+
 	if m.quitting {
 		return "Goodbye!\n"
 	}
 
+	if len(m.protectAlerts) > 0 {
+		return m.renderProtectAlert()
+	}
+
 	var b strings.Builder
 
 	// Header
 	headerStyle := lipgloss.NewStyle().
 		Bold(true).
-		Foreground(lipgloss.Color("86")).
-		BorderStyle(lipgloss.NormalBorder()).
+		Foreground(m.theme.title).
+		BorderStyle(m.glyphs.border).
 		BorderBottom(true).
 		Width(m.width)
 
 	watchPathStyle := lipgloss.NewStyle().
-		Foreground(lipgloss.Color("243")).
+		Foreground(m.theme.muted).
 		Italic(true)
 
 	recursiveMode := "non-recursively"
@@ -276,72 +1043,288 @@ func (m *Model) View() string {
 	}
 
 	headerText := "DiffWatch - Real-time File Diff Viewer\n" +
-		watchPathStyle.Render(fmt.Sprintf("Watching: %s (%s)", m.watcher.WatchPath(), recursiveMode))
+		watchPathStyle.Render(fmt.Sprintf("Watching: %s (%s)", strings.Join(m.watcher.Roots(), ", "), recursiveMode)) +
+		"\n" + m.renderStats()
+	if m.bench != nil {
+		headerText += "\n" + m.renderBench()
+	}
+	if len(m.goneRoots) > 0 {
+		headerText += "\n" + m.renderGoneRoots()
+	}
 
 	b.WriteString(headerStyle.Render(headerText))
 	b.WriteString("\n\n")
 
-	// Event log
+	// Event log and diff view, redrawn only when changed
+	b.WriteString(m.render.cached(&m.render.log, m.width, 0, m.renderEventLog))
+	b.WriteString("\n")
+	if m.showDigest || m.showHeatmap {
+		// Their time windows move on without messages
+		b.WriteString(m.renderPane())
+	} else {
+		b.WriteString(m.render.cached(&m.render.pane, m.width, m.paneHeight(), m.renderPane))
+	}
+
+	// Error display (but don't show "file too large" as error - it's already shown in diff)
+	if m.err != nil {
+		errMsg := m.err.Error()
+		if !strings.Contains(errMsg, "file too large") {
+			b.WriteString("\n")
+			errorStyle := lipgloss.NewStyle().
+				Foreground(m.theme.critical).
+				Bold(true)
+			b.WriteString(errorStyle.Render(fmt.Sprintf("Error: %v", m.err)))
+		}
+	}
+
+	// Footer
+	b.WriteString("\n")
+	footerStyle := lipgloss.NewStyle().
+		Foreground(m.theme.subtle).
+		Italic(true)
+	if m.prompt != nil {
+		b.WriteString(m.renderPrompt())
+	} else if m.nav.pending != "" {
+		b.WriteString(footerStyle.Render(m.nav.pending + "-"))
+	} else if m.showHelp {
+		b.WriteString(footerStyle.Render("Press 'tab' to switch diff view, 'b' to toggle blame, 'w' for whitespace, 'r' for the lines of structured files, 'v' to preview Markdown, 'R' to reveal .env values, 'D' for digest, 'H' for heatmap, 'L' for the full event log ('/' filters), 'f' to filter events by path, 'I' to edit the include/exclude globs and skipped directories, 'A' for absolute paths, 'j'/'k'/'gg'/'G'/'{'/'}' to scroll, 'S' to stage a hunk, 'B'/'alt+b' to accept the file/all files as the new baseline, 's' to mark the diff seen, 'n' for the next unseen diff, ',' to note the diff, 'l' to stay on the file or jump to new changes, 'P' to pin, 'F' to follow the presenter of a shared session, 'a'/'d' to add/remove a watch path, 'space' to pause, '?' to close help, 'q' to quit"))
+	} else {
+		b.WriteString(m.renderStatusBar())
+	}
+
+	return b.String()
+}
+
+// renderEventLog renders the most recent event log entries passing the
+// live filter, one line each
+func (m *Model) renderEventLog() string {
 	eventStyle := lipgloss.NewStyle().
-		Foreground(lipgloss.Color("241"))
+		Foreground(m.theme.subtle)
 
+	noiseStyle := lipgloss.NewStyle().
+		Foreground(m.theme.faint).
+		Italic(true)
+
+	var b strings.Builder
 	b.WriteString(eventStyle.Render("Recent Events:"))
 	b.WriteString("\n")
 
-	if len(m.events) == 0 {
+	events := m.visibleEvents()
+	switch {
+	case len(m.events) == 0:
 		b.WriteString(eventStyle.Render("  Waiting for file changes..."))
 		b.WriteString("\n")
-	} else {
-		for _, event := range m.events {
-			b.WriteString(eventStyle.Render("  " + event))
+	case len(events) == 0:
+		b.WriteString(eventStyle.Render(fmt.Sprintf("  No events matching %q yet", m.liveFilter)))
+		b.WriteString("\n")
+	default:
+		for _, entry := range events[max(len(events)-m.opts.LogLines, 0):] {
+			if entry.noise {
+				b.WriteString(noiseStyle.Render("  " + m.entryText(entry, m.width-2-len(" (suppressed)")) + " (suppressed)"))
+			} else {
+				b.WriteString(m.levelStyle(entry.level).Render(m.seenMark(entry) + m.entryText(entry, m.width-2)))
+			}
+			if entry.process != "" {
+				b.WriteString(noiseStyle.Render("  modified by: " + entry.process))
+			}
+			if entry.note != "" {
+				b.WriteString(noiseStyle.Render("  note: " + entry.note))
+			}
 			b.WriteString("\n")
 		}
 	}
+	return b.String()
+}
 
-	b.WriteString("\n")
-
-	// Diff view
+// renderPane renders the bordered pane below the event log: the diff, or
+// the filter editor, full event log, digest or heatmap in its place
+func (m *Model) renderPane() string {
 	diffStyle := lipgloss.NewStyle().
-		BorderStyle(lipgloss.RoundedBorder()).
-		BorderForeground(lipgloss.Color("62")).
+		BorderStyle(m.glyphs.rounded).
+		BorderForeground(m.theme.border).
 		Padding(1).
 		Width(m.width - 4)
 
-	if m.currentDiff != nil {
-		// Calculate available height for diff (leaving room for header, events, footer, borders)
-		// Header: 4 lines, Events: ~7 lines (title + 5 events), Footer: 1 line, margins/borders: ~6 lines
-		availableHeight := m.height - 18
-		if availableHeight < 10 {
-			availableHeight = 10 // Minimum height
+	if m.showFilters {
+		return diffStyle.Render(m.renderFilters(m.paneHeight()))
+	} else if m.showFullLog {
+		return diffStyle.Render(m.renderFullLog(m.paneHeight()))
+	} else if m.showDigest {
+		return diffStyle.Render(m.renderDigest(m.paneHeight()))
+	} else if m.showHeatmap {
+		return diffStyle.Render(m.renderHeatmap(m.paneHeight()))
+	} else if current, _ := m.shownDiffs(); current != nil {
+		// Render modern diff view with height constraint
+		pane := m.renderDiffPane(m.paneHeight())
+		if m.showsPreview(current) {
+			pane = m.withPreview(pane, current)
 		}
+		return diffStyle.Render(pane)
+	}
+	return diffStyle.Render("No changes yet")
+}
 
-		// Render modern diff view with height constraint
-		renderedDiff := m.renderModernDiff(m.currentDiff, availableHeight)
-		b.WriteString(diffStyle.Render(renderedDiff))
-	} else {
-		b.WriteString(diffStyle.Render("No changes yet"))
+// paneHeight returns the lines available to the diff pane, leaving room
+// for the header (5 lines, one more each for the latency line and gone
+// roots), the event log (title, entries and a blank line), the footer
+// (1 line) and margins and borders (~6 lines), but at least 10
+func (m *Model) paneHeight() int {
+	entries := m.opts.LogLines
+	if entries <= 0 {
+		entries = visibleEvents
+	}
+	reserved := 14 + entries
+	if m.bench != nil {
+		reserved++
 	}
+	if len(m.goneRoots) > 0 {
+		reserved++
+	}
+	return max(m.height-reserved, 10)
+}
 
-	// Error display (but don't show "file too large" as error - it's already shown in diff)
-	if m.err != nil {
-		errMsg := m.err.Error()
-		if !strings.Contains(errMsg, "file too large") {
-			b.WriteString("\n")
-			errorStyle := lipgloss.NewStyle().
-				Foreground(lipgloss.Color("196")).
-				Bold(true)
-			b.WriteString(errorStyle.Render(fmt.Sprintf("Error: %v", m.err)))
-		}
+// renderStats renders live counters about the watched tree
+func (m *Model) renderStats() string {
+	statsStyle := lipgloss.NewStyle().
+		Foreground(m.theme.muted)
+
+	stats := m.watcher.Stats()
+	touched, touchedBytes := m.stateManager.Stats()
+
+	dot := m.glyphs.dot
+	text := statsStyle.Render(fmt.Sprintf("%d dirs%s%d files watched%s%d touched (%s)",
+		stats.Dirs, dot, stats.Files, dot, touched, formatBytes(touchedBytes)))
+	if cache := m.diffEngine.CacheStats(); cache.Hits+cache.Misses > 0 {
+		text += statsStyle.Render(fmt.Sprintf("%sdiff cache %d%% hits (%d diffs, %s)",
+			dot, cache.HitRate(), cache.Entries, formatBytes(cache.Bytes)))
 	}
 
-	// Footer
-	b.WriteString("\n")
-	footerStyle := lipgloss.NewStyle().
-		Foreground(lipgloss.Color("241")).
+	if stats.SetupDirs > 0 {
+		text += statsStyle.Render(fmt.Sprintf("%sadding watches: %s dirs (%d%%)",
+			dot, formatCount(stats.SetupDirs), stats.SetupPercent))
+	}
+	if stats.Deferred > 0 {
+		text += statsStyle.Render(fmt.Sprintf("%s%s deeper dirs not watched yet", dot, formatCount(stats.Deferred)))
+	}
+	if m.prescan != nil && !m.prescan.Done.Load() {
+		text += statsStyle.Render(fmt.Sprintf("%sprescanning %d/%d files",
+			dot, m.prescan.Scanned.Load(), m.prescan.Found.Load()))
+	}
+
+	warnStyle := lipgloss.NewStyle().
+		Foreground(m.theme.warn).
+		Bold(true)
+
+	if m.opts.MaxDirs > 0 && stats.Dirs > m.opts.MaxDirs {
+		text += "  " + warnStyle.Render(m.glyphs.with(m.glyphs.warning, fmt.Sprintf("watched tree exceeds %d directories", m.opts.MaxDirs)))
+	}
+
+	// Evicted files show their next change as a new file, so say so
+	if evictions := m.stateManager.Evictions(); evictions.Files > 0 {
+		text += "  " + warnStyle.Render(m.glyphs.with(m.glyphs.warning, fmt.Sprintf("evicted %d files (%s) over limits",
+			evictions.Files, formatBytes(evictions.Bytes))))
+	}
+	if m.historyDropped > 0 {
+		text += statsStyle.Render(fmt.Sprintf("%s%d old log entries dropped", dot, m.historyDropped))
+	}
+	text += statsStyle.Render(m.shareStatus())
+
+	return text
+}
+
+// formatCount formats a count with thousands separators, e.g. 12,345
+func formatCount(n int) string {
+	s := strconv.Itoa(n)
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
+
+// formatBytes formats a byte count in human readable units
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// renderDiffPane renders the diff(s) selected by the current diff mode
+func (m *Model) renderDiffPane(maxDisplayLines int) string {
+	modeStyle := lipgloss.NewStyle().
+		Foreground(m.theme.muted).
 		Italic(true)
-	b.WriteString(footerStyle.Render("Press 'q' to quit"))
 
-	return b.String()
+	current, baseline := m.shownDiffs()
+	since := m.shownBaselineSince()
+
+	var pins string
+	if len(m.pinned) > 0 {
+		pins = m.renderPins() + "\n"
+		maxDisplayLines--
+	}
+	if note := m.shownNote(); note != "" {
+		pins += m.renderNote(note) + "\n"
+		maxDisplayLines--
+	}
+
+	switch m.diffMode {
+	case modeBaseline:
+		return pins + modeStyle.Render("Showing: since "+since) + "\n" +
+			m.renderBaselineDiff(baseline, since, maxDisplayLines)
+
+	case modeBoth:
+		// Split the available height between both diffs
+		half := maxDisplayLines / 2
+		separator := lipgloss.NewStyle().
+			Foreground(m.theme.border).
+			Render(strings.Repeat(m.glyphs.rule, max(m.width-10, 10)))
+
+		return pins + modeStyle.Render("Last change:") + "\n" +
+			m.renderModernDiff(current, half) + "\n" +
+			separator + "\n" +
+			modeStyle.Render("Since "+since+":") + "\n" +
+			m.renderBaselineDiff(baseline, since, maxDisplayLines-half)
+
+	default:
+		return pins + modeStyle.Render("Showing: "+modeLastChange.String()) + "\n" +
+			m.renderModernDiff(current, maxDisplayLines)
+	}
+}
+
+// renderBaselineDiff renders the diff since the baseline of a file, which
+// since describes
+func (m *Model) renderBaselineDiff(baseline *diff.Result, since string, maxDisplayLines int) string {
+	if baseline == nil {
+		return "No baseline available for this file"
+	}
+	if !baseline.HasDiff {
+		return fmt.Sprintf("%s: no changes since %s", m.showPath(baseline.Path, m.width-8), since)
+	}
+	return m.renderModernDiff(baseline, maxDisplayLines)
+}
+
+// levelStyle returns the event log style for a severity level
+func (m *Model) levelStyle(level severity.Level) lipgloss.Style {
+	switch level {
+	case severity.Critical:
+		return lipgloss.NewStyle().
+			Foreground(m.theme.critical).
+			Bold(true)
+	case severity.Warn:
+		return lipgloss.NewStyle().
+			Foreground(m.theme.warn)
+	default:
+		return lipgloss.NewStyle().
+			Foreground(m.theme.subtle)
+	}
 }
 
 // selectLinesToDisplay intelligently selects which lines to show from a diff,
@@ -432,40 +1415,68 @@ func (m *Model) renderModernDiff(result *diff.Result, maxDisplayLines int) strin
 	// File header with status
 	headerStyle := lipgloss.NewStyle().
 		Bold(true).
-		Foreground(lipgloss.Color("14"))
+		Foreground(m.theme.info)
 
 	statusStyle := lipgloss.NewStyle().
 		Bold(true)
 
+	// Paths get the width the icon, the longest status and the language
+	// leave inside the diff pane
+	pathWidth := max(m.width-8-lipgloss.Width(m.glyphs.with(m.glyphs.binary, "[MODIFIED BINARY FILE] ")+m.languageLabel(result)), 16)
+	path := m.showPath(result.Path, pathWidth)
+
 	// Handle binary files specially
 	if result.IsBinary {
+		binaryIcon := headerStyle.Render(m.glyphs.with(m.glyphs.binary, ""))
 		binaryStyle := lipgloss.NewStyle().
-			Foreground(lipgloss.Color("11")). // Yellow
+			Foreground(m.theme.warn).
 			Bold(true)
 
 		if result.IsNew {
-			statusStyle = statusStyle.Foreground(lipgloss.Color("10")) // Green
-			b.WriteString(headerStyle.Render("📦 ") + statusStyle.Render("[NEW BINARY FILE] ") + result.Path + "\n\n")
+			statusStyle = statusStyle.Foreground(m.theme.added)
+			b.WriteString(binaryIcon + statusStyle.Render("[NEW BINARY FILE] ") + path + "\n\n")
 		} else if result.IsDeleted {
-			statusStyle = statusStyle.Foreground(lipgloss.Color("9")) // Red
-			b.WriteString(headerStyle.Render("📦 ") + statusStyle.Render("[DELETED BINARY FILE] ") + result.Path + "\n\n")
+			statusStyle = statusStyle.Foreground(m.theme.deleted)
+			b.WriteString(binaryIcon + statusStyle.Render("[DELETED BINARY FILE] ") + path + "\n\n")
 		} else {
-			statusStyle = statusStyle.Foreground(lipgloss.Color("11")) // Yellow
-			b.WriteString(headerStyle.Render("📦 ") + statusStyle.Render("[MODIFIED BINARY FILE] ") + result.Path + "\n\n")
+			statusStyle = statusStyle.Foreground(m.theme.warn)
+			b.WriteString(binaryIcon + statusStyle.Render("[MODIFIED BINARY FILE] ") + path + "\n\n")
 		}
 
+		// Binary files with an external differ show its output, those with
+		// structure, like DER certificates, what changed in their elements
+		if m.showsExternalDiff(result) {
+			b.WriteString(m.renderExternalDiff(result, maxDisplayLines))
+			return b.String()
+		}
+		if m.showsChanges(result) {
+			b.WriteString(m.renderChanges(result, maxDisplayLines))
+			return b.String()
+		}
 		b.WriteString(binaryStyle.Render("Binary file detected - diff content not shown"))
 		return b.String()
 	}
 
-	// Handle files with no lines (e.g., too large files)
-	if len(result.Lines) == 0 && result.HasDiff {
+	// Handle files locked by another process
+	if result.Locked {
+		lockedStyle := lipgloss.NewStyle().
+			Foreground(m.theme.warn).
+			Bold(true)
+
+		statusStyle = statusStyle.Foreground(m.theme.warn)
+		b.WriteString(headerStyle.Render(m.glyphs.with(m.glyphs.locked, "")) + statusStyle.Render("[FILE LOCKED] ") + path + "\n\n")
+		b.WriteString(lockedStyle.Render("File is locked by another process and could not be read - the diff will show after its next change"))
+		return b.String()
+	}
+
+	// Handle files too large to diff
+	if result.TooLarge {
 		largeFileStyle := lipgloss.NewStyle().
-			Foreground(lipgloss.Color("11")). // Yellow
+			Foreground(m.theme.warn).
 			Bold(true)
 
-		statusStyle = statusStyle.Foreground(lipgloss.Color("11")) // Yellow
-		b.WriteString(headerStyle.Render("📄 ") + statusStyle.Render("[FILE TOO LARGE] ") + result.Path + "\n\n")
+		statusStyle = statusStyle.Foreground(m.theme.warn)
+		b.WriteString(headerStyle.Render(m.glyphs.with(m.glyphs.fileIcon(result.Language), "")) + statusStyle.Render("[FILE TOO LARGE] ") + path + m.languageLabel(result) + "\n\n")
 
 		if m.err != nil && strings.Contains(m.err.Error(), "file too large") {
 			b.WriteString(largeFileStyle.Render(m.err.Error()))
@@ -475,69 +1486,175 @@ func (m *Model) renderModernDiff(result *diff.Result, maxDisplayLines int) strin
 		return b.String()
 	}
 
-	if result.IsNew {
-		statusStyle = statusStyle.Foreground(lipgloss.Color("10")) // Green
-		b.WriteString(headerStyle.Render("📄 ") + statusStyle.Render("[NEW FILE] ") + result.Path + "\n\n")
+	// Handle generated and huge files, whose lines would take too long to draw,
+	// unless their changes are understood, like the packages of lockfiles,
+	// whose lines 'r' still shows on demand
+	if result.SummaryOnly != "" && result.Structure == "" {
+		summaryStyle := lipgloss.NewStyle().
+			Foreground(m.theme.muted).
+			Italic(true)
+
+		statusStyle = statusStyle.Foreground(m.theme.warn)
+		added, deleted := result.Stats()
+		b.WriteString(headerStyle.Render(m.glyphs.with(m.glyphs.fileIcon(result.Language), "")) + statusStyle.Render("[SUMMARY ONLY] ") + path + m.languageLabel(result) + "\n\n")
+		b.WriteString(summaryStyle.Render(fmt.Sprintf("%d lines added, %d removed - diff not shown: %s", added, deleted, result.SummaryOnly)))
+		return b.String()
+	}
+
+	icon := headerStyle.Render(m.glyphs.with(m.glyphs.fileIcon(result.Language), ""))
+	if result.RenamedFrom != "" {
+		statusStyle = statusStyle.Foreground(m.theme.warn)
+		renameWidth := max((pathWidth-len(" -> (100% similar)"))/2, 16)
+		b.WriteString(icon + statusStyle.Render("[MOVED] ") +
+			fmt.Sprintf("%s %s %s (%d%% similar)", m.showPath(result.RenamedFrom, renameWidth), m.glyphs.arrow, m.showPath(result.Path, renameWidth), result.Similarity) + m.languageLabel(result) + "\n\n")
+	} else if result.IsNew {
+		statusStyle = statusStyle.Foreground(m.theme.added)
+		b.WriteString(icon + statusStyle.Render("[NEW FILE] ") + path + m.languageLabel(result) + "\n\n")
 	} else if result.IsDeleted {
-		statusStyle = statusStyle.Foreground(lipgloss.Color("9")) // Red
-		b.WriteString(headerStyle.Render("📄 ") + statusStyle.Render("[DELETED] ") + result.Path + "\n\n")
+		statusStyle = statusStyle.Foreground(m.theme.deleted)
+		b.WriteString(icon + statusStyle.Render("[DELETED] ") + path + m.languageLabel(result) + "\n\n")
 	} else {
-		statusStyle = statusStyle.Foreground(lipgloss.Color("11")) // Yellow
-		b.WriteString(headerStyle.Render("📄 ") + statusStyle.Render("[MODIFIED] ") + result.Path + "\n\n")
+		statusStyle = statusStyle.Foreground(m.theme.warn)
+		b.WriteString(icon + statusStyle.Render("[MODIFIED] ") + path + m.languageLabel(result) + "\n\n")
+	}
+
+	// Unresolved merge conflicts and dangerous changes get a badge
+	badgeStyle := lipgloss.NewStyle().
+		Foreground(m.theme.alertText).
+		Background(m.theme.critical).
+		Bold(true)
+	if result.Conflicts > 0 {
+		b.WriteString(badgeStyle.Render(" "+m.glyphs.with(m.glyphs.warning, fmt.Sprintf("CONFLICT: %d unresolved regions ", result.Conflicts))) + "\n\n")
+	}
+	if result.Dangerous != "" {
+		b.WriteString(badgeStyle.Render(" "+m.glyphs.with(m.glyphs.warning, "DANGER: "+result.Dangerous+" ")) + "\n\n")
+	}
+
+	b.WriteString(m.renderPluginReports(result))
+
+	markerStyle := lipgloss.NewStyle().
+		Foreground(m.theme.lineNum).
+		Italic(true)
+
+	// Large files only show the regions that changed
+	if result.Streamed {
+		note := "Large file: only changed regions were read"
+		if result.Omitted > 0 {
+			note += fmt.Sprintf(", %d more not shown", result.Omitted)
+		}
+		b.WriteString(markerStyle.Render(note) + "\n\n")
+	}
+
+	// Line ending changes are invisible in the lines themselves
+	if result.EndingsChanged() {
+		note := fmt.Sprintf("Line endings changed: %s %s %s", result.OldEOL, m.glyphs.arrow, result.NewEOL)
+		if result.NewEOL == diff.StyleMixed {
+			note = "Mixed line endings (LF and CRLF)"
+		}
+		b.WriteString(statusStyle.Foreground(m.theme.warn).Render(m.glyphs.with(m.glyphs.warning, note+", CRLF lines marked "+m.glyphs.cr)) + "\n\n")
+	}
+
+	// Files with an external differ show its output
+	if m.showsExternalDiff(result) {
+		b.WriteString(m.renderExternalDiff(result, maxDisplayLines))
+		return b.String()
+	}
+
+	// Structured files show what changed in their elements
+	if m.showsChanges(result) {
+		b.WriteString(m.renderChanges(result, maxDisplayLines))
+		return b.String()
 	}
 
 	// Styles for different line types
 	addedStyle := lipgloss.NewStyle().
-		Foreground(lipgloss.Color("10")). // Bright green
-		Background(lipgloss.Color("22"))  // Dark green background
+		Foreground(m.theme.added).
+		Background(m.theme.addedBg)
 
 	deletedStyle := lipgloss.NewStyle().
-		Foreground(lipgloss.Color("9")). // Bright red
-		Background(lipgloss.Color("52")) // Dark red background
+		Foreground(m.theme.deleted).
+		Background(m.theme.deletedBg)
 
 	unchangedStyle := lipgloss.NewStyle().
-		Foreground(lipgloss.Color("250")) // Light gray
+		Foreground(m.theme.context)
 
 	lineNumStyle := lipgloss.NewStyle().
-		Foreground(lipgloss.Color("240")).
+		Foreground(m.theme.lineNum).
 		Width(5).
 		Align(lipgloss.Right)
 
 	// Render lines with smart selection: center on changes
-	displayLines, truncatedBefore, truncatedAfter := m.selectLinesToDisplay(result.Lines, maxDisplayLines)
+	displayLines, truncatedBefore, truncatedAfter := m.linesToDisplay(result, maxDisplayLines)
+
+	// Changes are grouped under the declarations they belong to, whose
+	// headers take room from the lines
+	if headers := len(scopeHeaders(displayLines)); headers > 0 {
+		displayLines, truncatedBefore, truncatedAfter = m.linesToDisplay(result, max(maxDisplayLines-headers, 1))
+	}
+	headers := scopeHeaders(displayLines)
+	scopeStyle := lipgloss.NewStyle().
+		Foreground(m.theme.info).
+		Bold(true)
 
-	for _, line := range displayLines {
+	for i, line := range displayLines {
 		var lineNumStr, iconStr, content string
 
+		if scope, ok := headers[i]; ok {
+			b.WriteString(lineNumStyle.Render("") + scopeStyle.Render("  "+scope) + "\n")
+		}
+
 		switch line.Type {
 		case diff.LineAdded:
-			iconStr = "✓ "
+			iconStr = m.glyphs.added
 			lineNumStr = lineNumStyle.Render(fmt.Sprintf("%4d ", line.NewLineNum))
-			content = addedStyle.Render(iconStr + line.Content)
+			content = m.renderLineContent(iconStr, line.Content, addedStyle, result.Language, false) + m.pluginAnnotation(result, line)
 
 		case diff.LineDeleted:
-			iconStr = "✗ "
+			iconStr = m.glyphs.deleted
 			lineNumStr = lineNumStyle.Render(fmt.Sprintf("%4d ", line.OldLineNum))
-			content = deletedStyle.Render(iconStr + line.Content)
+			content = m.renderLineContent(iconStr, line.Content, deletedStyle, result.Language, false) + m.blameAnnotation(result, line)
 
 		case diff.LineUnchanged:
 			iconStr = "  "
 			lineNumStr = lineNumStyle.Render(fmt.Sprintf("%4d ", line.NewLineNum))
-			content = unchangedStyle.Render(iconStr + line.Content)
+			content = m.renderLineContent(iconStr, line.Content, unchangedStyle, result.Language, true) + m.pluginAnnotation(result, line)
+
+		case diff.LineGap:
+			lineNumStr = lineNumStyle.Render(m.glyphs.gap)
+			content = markerStyle.Render("  " + line.Content)
 
 		default:
 			continue
 		}
 
+		if line.Ending == diff.EndingCRLF && result.EndingsChanged() {
+			content += markerStyle.Render(m.glyphs.cr)
+		}
+		if result.Conflicts > 0 {
+			lineNumStr += m.conflictGutter(line.Conflict)
+			if line.Conflict == diff.ConflictMarker {
+				content = lipgloss.NewStyle().
+					Foreground(m.theme.critical).
+					Bold(true).
+					Render(iconStr + line.Content)
+			}
+		}
 		b.WriteString(lineNumStr + content + "\n")
+
+		if line.Ending == diff.EndingNone {
+			b.WriteString(lineNumStyle.Render("") + markerStyle.Render("  \\ No newline at end of file") + "\n")
+		}
 	}
 
 	// Show truncation info
 	moreStyle := lipgloss.NewStyle().
-		Foreground(lipgloss.Color("240")).
+		Foreground(m.theme.lineNum).
 		Italic(true)
 
-	if truncatedBefore > 0 && truncatedAfter > 0 {
+	if truncatedBefore > 0 && truncatedAfter > 0 && m.scrolled(result) {
+		b.WriteString("\n" + moreStyle.Render(fmt.Sprintf("... %d lines hidden before, %d lines hidden after",
+			truncatedBefore, truncatedAfter)))
+	} else if truncatedBefore > 0 && truncatedAfter > 0 {
 		b.WriteString("\n" + moreStyle.Render(fmt.Sprintf("... %d lines hidden before, %d lines hidden after (centered on changes)",
 			truncatedBefore, truncatedAfter)))
 	} else if truncatedBefore > 0 {
@@ -550,13 +1667,13 @@ func (m *Model) renderModernDiff(result *diff.Result, maxDisplayLines int) strin
 }
 
 // colorizeDiff adds color to diff output (legacy, keeping for backward compatibility)
-func colorizeDiff(diff string) string {
+func (m *Model) colorizeDiff(diff string) string {
 	lines := strings.Split(diff, "\n")
 	var colored []string
 
-	addStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("10"))    // Green
-	delStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("9"))     // Red
-	headerStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("14")) // Cyan
+	addStyle := lipgloss.NewStyle().Foreground(m.theme.added)
+	delStyle := lipgloss.NewStyle().Foreground(m.theme.deleted)
+	headerStyle := lipgloss.NewStyle().Foreground(m.theme.info)
 
 	for _, line := range lines {
 		switch {
@@ -0,0 +1,239 @@
+package ui
+
+import "github.com/deemkeen/diffwatch/internal/diff"
+
+// navState is the vim-style scroll position in the diff pane. It applies
+// to one diff and resets when another diff is displayed.
+type navState struct {
+	target  *diff.Result // Diff the position belongs to
+	offset  int          // First line shown; -1 centers on the changes
+	pending string       // First key of a two-key command: g, z, m or '
+	marks   map[rune]int // Hunk start lines by mark letter
+}
+
+// hunk is a run of added and deleted lines
+type hunk struct {
+	start, end int // Line indices, end exclusive
+}
+
+// scrollTarget returns the diff that navigation keys move through: the
+// baseline diff in baseline mode, otherwise the last change
+func (m *Model) scrollTarget() *diff.Result {
+	current, baseline := m.shownDiffs()
+	if m.diffMode == modeBaseline {
+		return baseline
+	}
+	return current
+}
+
+// diffPageSize returns the number of diff lines shown for the scroll
+// target, matching the layout of renderDiffPane
+func (m *Model) diffPageSize() int {
+	page := m.paneHeight()
+	if len(m.pinned) > 0 {
+		page--
+	}
+	if m.diffMode == modeBoth {
+		page /= 2
+	}
+	return page
+}
+
+// handleNavKey handles a vim-style navigation key, reporting whether key
+// was one. Two-key commands (gg, zz, m{a-z}, '{a-z}) wait for their
+// second key.
+func (m *Model) handleNavKey(key string) bool {
+	target := m.scrollTarget()
+	if target == nil || m.showDigest || m.showHeatmap {
+		m.nav.pending = ""
+		return false
+	}
+	if m.nav.target != target {
+		m.nav = navState{target: target, offset: -1}
+	}
+
+	if pending := m.nav.pending; pending != "" {
+		m.nav.pending = ""
+		switch key {
+		case "ctrl+c":
+			return false
+		case "esc":
+			return true
+		}
+		m.navSequence(pending, key)
+		return true
+	}
+
+	page := m.diffPageSize()
+	switch key {
+	case "g", "z", "m", "'":
+		m.nav.pending = key
+	case "j", "ctrl+e", "down":
+		m.scrollBy(1)
+	case "k", "ctrl+y", "up":
+		m.scrollBy(-1)
+	case "ctrl+d":
+		m.scrollBy(page / 2)
+	case "ctrl+u":
+		m.scrollBy(-page / 2)
+	case "ctrl+f", "pgdown":
+		m.scrollBy(page)
+	case "ctrl+b", "pgup":
+		m.scrollBy(-page)
+	case "G":
+		m.scrollTo(len(target.Lines))
+	case "}":
+		m.jumpHunk(1)
+	case "{":
+		m.jumpHunk(-1)
+	default:
+		return false
+	}
+	return true
+}
+
+// navSequence completes a two-key command
+func (m *Model) navSequence(first, key string) {
+	switch first {
+	case "g":
+		if key == "g" {
+			m.scrollTo(0)
+		}
+	case "z":
+		if key == "z" {
+			if h, ok := m.hunkNearCenter(); ok {
+				m.centerOn(h)
+			}
+		}
+	case "m":
+		if r := []rune(key); len(r) == 1 && r[0] >= 'a' && r[0] <= 'z' {
+			if h, ok := m.hunkNearCenter(); ok {
+				if m.nav.marks == nil {
+					m.nav.marks = make(map[rune]int)
+				}
+				m.nav.marks[r[0]] = h.start
+			}
+		}
+	case "'":
+		if r := []rune(key); len(r) == 1 {
+			if start, ok := m.nav.marks[r[0]]; ok {
+				for _, h := range hunks(m.nav.target.Lines) {
+					if h.start == start {
+						m.centerOn(h)
+					}
+				}
+			}
+		}
+	}
+}
+
+// position returns the first line shown of the scroll target
+func (m *Model) position() int {
+	if m.nav.offset >= 0 {
+		return m.nav.offset
+	}
+	_, start, _ := m.selectLinesToDisplay(m.nav.target.Lines, m.diffPageSize())
+	return start
+}
+
+// scrollBy moves the view by delta lines
+func (m *Model) scrollBy(delta int) {
+	m.scrollTo(m.position() + delta)
+}
+
+// scrollTo shows the scroll target from line, clamped to the diff
+func (m *Model) scrollTo(line int) {
+	last := max(len(m.nav.target.Lines)-m.diffPageSize(), 0)
+	m.nav.offset = min(max(line, 0), last)
+}
+
+// centerOn scrolls so that a hunk is in the middle of the view
+func (m *Model) centerOn(h hunk) {
+	m.scrollTo((h.start+h.end)/2 - m.diffPageSize()/2)
+}
+
+// jumpHunk centers the next (delta 1) or previous (delta -1) hunk after
+// the one nearest to the middle of the view
+func (m *Model) jumpHunk(delta int) {
+	all := hunks(m.nav.target.Lines)
+	if len(all) == 0 {
+		return
+	}
+	center := m.position() + m.diffPageSize()/2
+	if delta > 0 {
+		for _, h := range all {
+			if (h.start+h.end)/2 > center {
+				m.centerOn(h)
+				return
+			}
+		}
+		return
+	}
+	for i := len(all) - 1; i >= 0; i-- {
+		if (all[i].start+all[i].end)/2 < center {
+			m.centerOn(all[i])
+			return
+		}
+	}
+}
+
+// hunkNearCenter returns the hunk nearest to the middle of the view
+func (m *Model) hunkNearCenter() (hunk, bool) {
+	center := m.position() + m.diffPageSize()/2
+
+	var best hunk
+	found := false
+	bestDist := 0
+	for _, h := range hunks(m.nav.target.Lines) {
+		dist := 0
+		switch {
+		case center < h.start:
+			dist = h.start - center
+		case center >= h.end:
+			dist = center - h.end + 1
+		}
+		if !found || dist < bestDist {
+			best, bestDist, found = h, dist, true
+		}
+	}
+	return best, found
+}
+
+// scrolled reports whether the user moved through result, so it is shown
+// from the scroll position rather than centered on the changes
+func (m *Model) scrolled(result *diff.Result) bool {
+	return result != nil && m.nav.target == result && m.nav.offset >= 0
+}
+
+// linesToDisplay selects the lines of result that fit in maxLines, from
+// the scroll position if the user navigated in it. Returns the lines and
+// the number of lines hidden before and after.
+func (m *Model) linesToDisplay(result *diff.Result, maxLines int) ([]diff.DiffLine, int, int) {
+	lines := result.Lines
+	if !m.scrolled(result) || len(lines) <= maxLines {
+		return m.selectLinesToDisplay(lines, maxLines)
+	}
+	start := min(m.nav.offset, len(lines)-maxLines)
+	return lines[start : start+maxLines], start, len(lines) - start - maxLines
+}
+
+// hunks returns the runs of added and deleted lines
+func hunks(lines []diff.DiffLine) []hunk {
+	var result []hunk
+	for i := 0; i < len(lines); i++ {
+		if !isChange(lines[i]) {
+			continue
+		}
+		start := i
+		for i < len(lines) && isChange(lines[i]) {
+			i++
+		}
+		result = append(result, hunk{start: start, end: i})
+	}
+	return result
+}
+
+// isChange reports whether a diff line was added or deleted
+func isChange(line diff.DiffLine) bool {
+	return line.Type == diff.LineAdded || line.Type == diff.LineDeleted
+}
@@ -0,0 +1,69 @@
+package ui
+
+import (
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/deemkeen/diffwatch/internal/pathname"
+)
+
+// promptNote asks for a note on the displayed diff, e.g. what was observed
+// when it happened, to build a timeline of an incident. The note is shown
+// in the event log and with the diff, and stored with the change in the
+// change database. An empty value removes it.
+func (m *Model) promptNote() {
+	if m.showDigest || m.showHeatmap || m.showFullLog || m.showFilters {
+		return
+	}
+	i := m.shownEntry()
+	if i < 0 {
+		return
+	}
+
+	entry := m.events[i]
+	label := "Note on " + pathname.Display(m.relPath(entry.path))
+	m.prompt = newPrompt(label, entry.note, func(value string) tea.Cmd {
+		// Pasted text may carry control characters
+		m.setNote(entry, pathname.Display(strings.TrimSpace(value)))
+		return nil
+	})
+}
+
+// setNote attaches a note to an event log entry and its recorded change.
+// The entry is looked up again, as others may have been appended or
+// evicted while the note was typed.
+func (m *Model) setNote(entry logEntry, note string) {
+	for i := len(m.events) - 1; i >= 0; i-- {
+		if m.events[i].result == entry.result && m.events[i].at.Equal(entry.at) {
+			m.events[i].note = note
+			break
+		}
+	}
+
+	if m.opts.Store == nil {
+		return
+	}
+	if err := m.opts.Store.Annotate(entry.path, entry.at, note); err != nil {
+		m.log.Error("recording note failed", "path", entry.path, "error", err)
+		m.err = err
+	}
+}
+
+// shownNote returns the note on the displayed diff, if any
+func (m *Model) shownNote() string {
+	if i := m.shownEntry(); i >= 0 {
+		return m.events[i].note
+	}
+	return ""
+}
+
+// renderNote renders the note on the displayed diff above it
+func (m *Model) renderNote(note string) string {
+	labelStyle := lipgloss.NewStyle().
+		Foreground(m.theme.title).
+		Bold(true)
+
+	return labelStyle.Render("Note: ") + ansi.Truncate(note, max(m.width-16, 20), m.glyphs.ellipsis)
+}
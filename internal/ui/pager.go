@@ -0,0 +1,232 @@
+package ui
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/deemkeen/diffwatch/internal/diff"
+	"github.com/deemkeen/diffwatch/internal/pathname"
+)
+
+// PagerOptions configures the patch viewer
+type PagerOptions struct {
+	Source   string // Where the patch comes from, shown in the header
+	Light    bool   // Use colors for light terminal backgrounds
+	ASCII    bool   // Draw only ASCII: no emoji, symbols or box drawing borders
+	InputTTY bool   // Read keys from the terminal, e.g. when the patch is piped to stdin
+}
+
+// Pager shows an existing diff file by file, like a diff pager: nothing
+// is watched or read, the diffs are parsed from the patch
+type Pager struct {
+	view    *Model // Renders and scrolls the selected diff
+	opts    PagerOptions
+	files   []*diff.Result // In patch order
+	cursor  int            // Selected file
+	program *tea.Program   // Running program, for Quit
+}
+
+// NewPager creates a viewer for the files of a parsed patch. The first
+// file is selected.
+func NewPager(files []*diff.Result, opts PagerOptions) *Pager {
+	t := darkTheme
+	if opts.Light {
+		t = lightTheme
+	}
+
+	return &Pager{
+		view: &Model{
+			theme:    t,
+			glyphs:   newGlyphs(opts.ASCII),
+			log:      slog.New(slog.DiscardHandler),
+			pinIndex: -1,
+			width:    80,
+			height:   24,
+		},
+		opts:  opts,
+		files: files,
+	}
+}
+
+// Start runs the viewer until it is quit
+func (p *Pager) Start() error {
+	options := []tea.ProgramOption{tea.WithAltScreen()}
+	if p.opts.InputTTY {
+		options = append(options, tea.WithInputTTY())
+	}
+	p.program = tea.NewProgram(p, options...)
+	_, err := p.program.Run()
+	return err
+}
+
+// Quit signals the viewer to quit
+func (p *Pager) Quit() {
+	if p.program != nil {
+		p.program.Quit()
+	}
+}
+
+// Init initializes the viewer
+func (p *Pager) Init() tea.Cmd {
+	p.show()
+	return nil
+}
+
+// Update handles key presses and resizes
+func (p *Pager) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		if p.view.handleNavKey(msg.String()) {
+			return p, nil
+		}
+
+		switch msg.String() {
+		case "q", "ctrl+c":
+			p.view.quitting = true
+			return p, tea.Quit
+		case "J", "shift+down":
+			p.selectFile(p.cursor + 1)
+		case "K", "shift+up":
+			p.selectFile(p.cursor - 1)
+		case "home":
+			p.selectFile(0)
+		case "end":
+			p.selectFile(len(p.files) - 1)
+		case "w":
+			p.view.showWhitespace = !p.view.showWhitespace
+		case "R":
+			p.view.revealValues = !p.view.revealValues
+		}
+
+	case tea.WindowSizeMsg:
+		p.view.width = msg.Width
+		p.view.height = msg.Height
+	}
+
+	return p, nil
+}
+
+// selectFile selects the file at index i, clamped to the files
+func (p *Pager) selectFile(i int) {
+	if len(p.files) == 0 {
+		return
+	}
+	p.cursor = min(max(i, 0), len(p.files)-1)
+	p.show()
+}
+
+// show displays the diff of the selected file
+func (p *Pager) show() {
+	p.view.currentDiff = nil
+	if len(p.files) > 0 {
+		p.view.currentDiff = p.files[p.cursor]
+	}
+}
+
+// View renders the viewer
+func (p *Pager) View() string {
+	m := p.view
+	if m.quitting {
+		return "Goodbye!\n"
+	}
+
+	var b strings.Builder
+
+	headerStyle := lipgloss.NewStyle().
+		Bold(true).
+		Foreground(m.theme.title).
+		BorderStyle(m.glyphs.border).
+		BorderBottom(true).
+		Width(m.width)
+
+	mutedStyle := lipgloss.NewStyle().
+		Foreground(m.theme.muted)
+
+	added, deleted := 0, 0
+	for _, f := range p.files {
+		a, d := f.Stats()
+		added += a
+		deleted += d
+	}
+	headerText := "DiffWatch - Patch Viewer\n" +
+		mutedStyle.Italic(true).Render(fmt.Sprintf("Viewing: %s (nothing is watched)", pathname.Display(p.opts.Source))) +
+		"\n" + mutedStyle.Render(fmt.Sprintf("%d files changed, %d insertions(+), %d deletions(-)", len(p.files), added, deleted))
+	b.WriteString(headerStyle.Render(headerText))
+	b.WriteString("\n\n")
+
+	// Files around the selected one
+	eventStyle := lipgloss.NewStyle().
+		Foreground(m.theme.subtle)
+
+	selectedStyle := lipgloss.NewStyle().
+		Foreground(m.theme.highlight).
+		Bold(true)
+
+	b.WriteString(eventStyle.Render(fmt.Sprintf("Files (%d/%d):", min(p.cursor+1, len(p.files)), len(p.files))))
+	b.WriteString("\n")
+
+	start := min(max(p.cursor-visibleEvents/2, 0), max(len(p.files)-visibleEvents, 0))
+	for i := start; i < min(start+visibleEvents, len(p.files)); i++ {
+		text := p.fileText(p.files[i])
+		if i == p.cursor {
+			b.WriteString(selectedStyle.Render(p.view.glyphs.selected + " " + text))
+		} else {
+			b.WriteString(eventStyle.Render("  " + text))
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
+
+	diffStyle := lipgloss.NewStyle().
+		BorderStyle(m.glyphs.rounded).
+		BorderForeground(m.theme.border).
+		Padding(1).
+		Width(m.width - 4)
+
+	switch {
+	case m.currentDiff == nil:
+		b.WriteString(diffStyle.Render("No file selected"))
+	case !m.currentDiff.HasDiff:
+		b.WriteString(diffStyle.Render(fmt.Sprintf("%s: no content changes", pathname.Display(m.currentDiff.Path))))
+	default:
+		b.WriteString(diffStyle.Render(m.renderModernDiff(m.currentDiff, m.paneHeight())))
+	}
+
+	b.WriteString("\n")
+	footerStyle := lipgloss.NewStyle().
+		Foreground(m.theme.subtle).
+		Italic(true)
+	if m.nav.pending != "" {
+		b.WriteString(footerStyle.Render(m.nav.pending + "-"))
+	} else {
+		b.WriteString(footerStyle.Render("Press 'J'/'K' for the next/previous file, 'j'/'k'/'gg'/'G'/'{'/'}' to scroll, 'w' for whitespace, 'R' to reveal .env values, 'q' to quit"))
+	}
+
+	return b.String()
+}
+
+// fileText describes a file of the patch for the list
+func (p *Pager) fileText(r *diff.Result) string {
+	op, name := "modified", p.view.glyphs.withIcon(pathname.Display(r.Path), r.Language)
+	switch {
+	case r.IsNew:
+		op = "new"
+	case r.IsDeleted:
+		op = "deleted"
+	case r.RenamedFrom != "":
+		op, name = "renamed", pathname.Display(r.RenamedFrom)+" "+p.view.glyphs.arrow+" "+name
+	}
+
+	added, deleted := r.Stats()
+	lines := fmt.Sprintf("+%d -%d", added, deleted)
+	switch {
+	case r.IsBinary:
+		lines = "binary"
+	case !r.HasDiff, r.RenamedFrom != "" && added == 0 && deleted == 0:
+		lines = "no content changes"
+	}
+	return fmt.Sprintf("%s: %s (%s)", op, name, lines)
+}
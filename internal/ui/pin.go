@@ -0,0 +1,111 @@
+package ui
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/deemkeen/diffwatch/internal/diff"
+	"github.com/deemkeen/diffwatch/internal/pathname"
+)
+
+// pinnedDiff is a diff kept visible while new events arrive
+type pinnedDiff struct {
+	current  *diff.Result
+	baseline *diff.Result
+	since    string // Baseline the baseline diff is compared to, see baselineSince
+	pinnedAt time.Time
+}
+
+// shownDiffs returns the diffs displayed in the diff pane: the selected
+// pinned diff, or the live diffs
+func (m *Model) shownDiffs() (current, baseline *diff.Result) {
+	if m.pinIndex >= 0 {
+		pin := m.pinned[m.pinIndex]
+		return pin.current, pin.baseline
+	}
+	return m.currentDiff, m.baselineDiff
+}
+
+// shownBaselineSince describes the baseline of the displayed baseline diff
+func (m *Model) shownBaselineSince() string {
+	if m.pinIndex >= 0 {
+		return m.pinned[m.pinIndex].since
+	}
+	if m.currentDiff == nil {
+		return "session start"
+	}
+	return m.baselineSince(m.currentDiff.Path)
+}
+
+// togglePin pins the live diff, or unpins the displayed pinned diff
+func (m *Model) togglePin() {
+	if m.pinIndex >= 0 {
+		m.pinned = slices.Delete(m.pinned, m.pinIndex, m.pinIndex+1)
+		m.pinIndex = -1
+		return
+	}
+
+	if m.currentDiff == nil {
+		return
+	}
+
+	m.pinned = append(m.pinned, pinnedDiff{
+		current:  m.currentDiff,
+		baseline: m.baselineDiff,
+		since:    m.shownBaselineSince(),
+		pinnedAt: time.Now(),
+	})
+	m.pinIndex = len(m.pinned) - 1
+}
+
+// cyclePins moves through the pinned diffs and the live diff by delta
+func (m *Model) cyclePins(delta int) {
+	if len(m.pinned) == 0 {
+		return
+	}
+
+	// Position len(m.pinned) stands for the live diff
+	n := len(m.pinned) + 1
+	pos := m.pinIndex
+	if pos < 0 {
+		pos = len(m.pinned)
+	}
+	pos = ((pos+delta)%n + n) % n
+
+	if pos == len(m.pinned) {
+		m.pinIndex = -1
+	} else {
+		m.pinIndex = pos
+	}
+}
+
+// renderPins renders the list of pinned diffs, highlighting the displayed one
+func (m *Model) renderPins() string {
+	pinStyle := lipgloss.NewStyle().
+		Foreground(m.theme.muted)
+
+	activeStyle := lipgloss.NewStyle().
+		Foreground(m.theme.highlight).
+		Bold(true)
+
+	text := pinStyle.Render("Pinned:")
+	for i, pin := range m.pinned {
+		label := fmt.Sprintf(" %d %s@%s", i+1, pathname.Display(filepath.Base(pin.current.Path)), pin.pinnedAt.Format("15:04:05"))
+		if i == m.pinIndex {
+			text += activeStyle.Render(label)
+		} else {
+			text += pinStyle.Render(label)
+		}
+	}
+
+	label := " live"
+	if m.pinIndex < 0 {
+		text += activeStyle.Render(label)
+	} else {
+		text += pinStyle.Render(label)
+	}
+	return text
+}
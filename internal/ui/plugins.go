@@ -0,0 +1,167 @@
+package ui
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/deemkeen/diffwatch/internal/diff"
+	"github.com/deemkeen/diffwatch/internal/pathname"
+	"github.com/deemkeen/diffwatch/internal/plugin"
+	"github.com/deemkeen/diffwatch/internal/severity"
+	"github.com/deemkeen/diffwatch/internal/state"
+	"github.com/deemkeen/diffwatch/internal/watcher"
+)
+
+// pluginMsg delivers the reports of the plugins run on a change
+type pluginMsg struct {
+	result  *diff.Result
+	reports []plugin.Report
+}
+
+// pluginCmd returns a command running the plugins handling a change, or
+// nil if there are none. Plugins get the real contents, so the request is
+// built before redaction.
+func (m *Model) pluginCmd(event watcher.Event, result *diff.Result) tea.Cmd {
+	if result == nil || !result.HasDiff {
+		return nil
+	}
+
+	rel := filepath.ToSlash(m.relPath(event.Path))
+	var language string
+	if result.Language != nil {
+		language = result.Language.ID
+	}
+	if !m.opts.Plugins.Applies(rel, language) {
+		return nil
+	}
+
+	req := plugin.Request{
+		Root:     m.watcher.WatchPath(),
+		Path:     rel,
+		Op:       event.Op,
+		Language: language,
+		Binary:   result.IsBinary,
+		Patch:    result.Unified,
+	}
+	if !result.IsBinary {
+		req.Old = content(result.OldState)
+		req.New = content(result.NewState)
+	}
+
+	runner := m.opts.Plugins
+	return func() tea.Msg {
+		return pluginMsg{result: result, reports: runner.Run(context.Background(), req)}
+	}
+}
+
+// content returns the content of a file state for a plugin request, nil
+// if the file doesn't exist
+func content(s *state.FileState) *string {
+	if s == nil || !s.Exists {
+		return nil
+	}
+	text := string(s.Content)
+	return &text
+}
+
+// handlePlugins stores plugin reports for display and raises the level of
+// the change in the event log by their verdicts
+func (m *Model) handlePlugins(msg pluginMsg) {
+	if len(msg.reports) == 0 {
+		return
+	}
+
+	level := severity.Info
+	for _, r := range msg.reports {
+		switch r.Verdict {
+		case plugin.Warn:
+			level = max(level, severity.Warn)
+		case plugin.Fail:
+			level = max(level, severity.Critical)
+		case plugin.Error:
+			m.log.Warn("plugin failed", "plugin", r.Plugin, "path", msg.result.Path, "error", r.Message)
+		}
+	}
+
+	m.pluginReports[msg.result] = msg.reports
+	for i := range m.events {
+		if m.events[i].result == msg.result {
+			m.events[i].level = max(m.events[i].level, level)
+		}
+	}
+}
+
+// renderPluginReports renders the verdicts of the plugins run on a change
+// and their findings not tied to a line
+func (m *Model) renderPluginReports(result *diff.Result) string {
+	reports := m.pluginReports[result]
+	if len(reports) == 0 {
+		return ""
+	}
+
+	noteStyle := lipgloss.NewStyle().
+		Foreground(m.theme.muted).
+		Italic(true)
+
+	var b strings.Builder
+	for _, r := range reports {
+		verdictStyle := lipgloss.NewStyle().Bold(true)
+		switch r.Verdict {
+		case plugin.Pass:
+			verdictStyle = verdictStyle.Foreground(m.theme.added)
+		case plugin.Warn:
+			verdictStyle = verdictStyle.Foreground(m.theme.warn)
+		case plugin.Fail:
+			verdictStyle = verdictStyle.Foreground(m.theme.critical)
+		default:
+			verdictStyle = verdictStyle.Foreground(m.theme.muted)
+		}
+
+		// Plugin output is escaped like file names, so it can't garble the
+		// terminal
+		line := m.glyphs.with(m.glyphs.plugin, pathname.Display(r.Plugin)) + ": " + verdictStyle.Render(strings.ToUpper(r.Verdict))
+		if r.Message != "" {
+			line += " " + pathname.Display(r.Message)
+		}
+		if n := len(r.Annotations); n > 0 {
+			line += noteStyle.Render(fmt.Sprintf(" (%d findings)", n))
+		}
+		b.WriteString(line + "\n")
+
+		for _, a := range r.Annotations {
+			if a.Line == 0 {
+				b.WriteString(noteStyle.Render("   "+pathname.Display(a.Message)) + "\n")
+			}
+		}
+	}
+	return b.String() + "\n"
+}
+
+// pluginAnnotation returns the rendered plugin findings for a line of the
+// new content
+func (m *Model) pluginAnnotation(result *diff.Result, line diff.DiffLine) string {
+	if line.NewLineNum == 0 {
+		return ""
+	}
+
+	var notes []string
+	for _, r := range m.pluginReports[result] {
+		for _, a := range r.Annotations {
+			if a.Line == line.NewLineNum {
+				notes = append(notes, pathname.Display(r.Plugin+": "+a.Message))
+			}
+		}
+	}
+	if len(notes) == 0 {
+		return ""
+	}
+
+	return lipgloss.NewStyle().
+		Foreground(m.theme.warn).
+		Italic(true).
+		Render("  " + m.glyphs.note + " " + strings.Join(notes, "; "))
+}
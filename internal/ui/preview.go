@@ -0,0 +1,89 @@
+package ui
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/glamour"
+	"github.com/charmbracelet/glamour/styles"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/deemkeen/diffwatch/internal/diff"
+	"github.com/deemkeen/diffwatch/internal/lang"
+)
+
+// preview is the last rendered Markdown preview, reused while the same
+// diff is shown at the same width
+type preview struct {
+	result *diff.Result
+	width  int
+	text   string
+}
+
+// showsPreview reports whether the new version of a diff is shown
+// rendered next to it, which 'v' toggles for Markdown files
+func (m *Model) showsPreview(result *diff.Result) bool {
+	return m.showPreview && result != nil && result.Language == lang.Markdown &&
+		!result.IsBinary && !result.IsDeleted && !result.TooLarge && !result.Locked && !result.Streamed &&
+		result.NewState != nil && result.NewState.Exists
+}
+
+// withPreview puts the diff pane content on the left and the rendered new
+// version of result on the right, both cut to the height of the pane
+func (m *Model) withPreview(content string, result *diff.Result) string {
+	// The diff pane is padded by one column on each side
+	inner := max(m.width-6, 40)
+	right := inner / 2
+	left := inner - right
+
+	height := max(strings.Count(content, "\n")+1, m.paneHeight())
+	diffColumn := lipgloss.NewStyle().
+		Width(left).
+		MaxHeight(height).
+		Render(content)
+
+	previewColumn := lipgloss.NewStyle().
+		Border(m.glyphs.rounded, false, false, false, true).
+		BorderForeground(m.theme.border).
+		PaddingLeft(1).
+		Width(right - 1).
+		Height(height).
+		MaxHeight(height).
+		Render(m.renderPreview(result, right-2))
+
+	return lipgloss.JoinHorizontal(lipgloss.Top, diffColumn, previewColumn)
+}
+
+// renderPreview renders the new version of a Markdown file wrapped to
+// width, in the style matching the theme. Secrets are masked as in diffs.
+func (m *Model) renderPreview(result *diff.Result, width int) string {
+	if m.preview.result == result && m.preview.width == width {
+		return m.preview.text
+	}
+
+	style := styles.DarkStyle
+	switch {
+	case m.opts.ASCII:
+		style = styles.AsciiStyle
+	case m.opts.Light:
+		style = styles.LightStyle
+	}
+
+	text := "Preview unavailable"
+	renderer, err := glamour.NewTermRenderer(
+		glamour.WithStandardStyle(style),
+		glamour.WithColorProfile(lipgloss.ColorProfile()),
+		glamour.WithWordWrap(width),
+	)
+	if err == nil {
+		var out string
+		source := m.opts.Redactor.State(m.relPath(result.Path), result.NewState)
+		if out, err = renderer.Render(string(source.Content)); err == nil {
+			text = strings.Trim(out, "\n")
+		}
+	}
+	if err != nil {
+		m.log.Debug("markdown preview failed", "path", result.Path, "error", err)
+	}
+
+	m.preview = preview{result: result, width: width, text: text}
+	return text
+}
@@ -0,0 +1,60 @@
+package ui
+
+import (
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// prompt is a single-line text input shown in place of the footer
+type prompt struct {
+	label    string
+	value    []rune
+	onSubmit func(value string) tea.Cmd
+}
+
+// newPrompt creates a prompt with an initial value
+func newPrompt(label, value string, onSubmit func(value string) tea.Cmd) *prompt {
+	return &prompt{
+		label:    label,
+		value:    []rune(value),
+		onSubmit: onSubmit,
+	}
+}
+
+// handlePromptKey edits the active prompt. Enter submits, esc cancels.
+func (m *Model) handlePromptKey(msg tea.KeyMsg) tea.Cmd {
+	p := m.prompt
+
+	switch msg.Type {
+	case tea.KeyEnter:
+		m.prompt = nil
+		return p.onSubmit(string(p.value))
+	case tea.KeyEsc, tea.KeyCtrlC:
+		m.prompt = nil
+	case tea.KeyBackspace:
+		if len(p.value) > 0 {
+			p.value = p.value[:len(p.value)-1]
+		}
+	case tea.KeyCtrlU:
+		p.value = p.value[:0]
+	case tea.KeySpace:
+		p.value = append(p.value, ' ')
+	case tea.KeyRunes:
+		p.value = append(p.value, msg.Runes...)
+	}
+	return nil
+}
+
+// renderPrompt renders the active prompt with a cursor
+func (m *Model) renderPrompt() string {
+	labelStyle := lipgloss.NewStyle().
+		Foreground(m.theme.title).
+		Bold(true)
+
+	hintStyle := lipgloss.NewStyle().
+		Foreground(m.theme.subtle).
+		Italic(true)
+
+	return labelStyle.Render(m.prompt.label+": ") + string(m.prompt.value) + m.glyphs.cursor + "  " +
+		hintStyle.Render("(enter to confirm, esc to cancel)")
+}
@@ -0,0 +1,104 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/deemkeen/diffwatch/internal/diff"
+	"github.com/deemkeen/diffwatch/internal/watcher"
+)
+
+// protectAlert describes a change to a protected path awaiting acknowledgement
+type protectAlert struct {
+	path      string
+	op        string
+	timestamp time.Time
+	restored  bool
+	patchPath string
+	err       error
+}
+
+// checkProtected raises an alert if the change touched a protected path,
+// reverting it if configured
+func (m *Model) checkProtected(event watcher.Event, result *diff.Result) {
+	if result == nil || !result.HasDiff || !m.opts.Guard.Protected(m.relPath(event.Path)) {
+		return
+	}
+
+	alert := protectAlert{
+		path:      event.Path,
+		op:        event.Op,
+		timestamp: event.Timestamp,
+	}
+
+	if m.opts.Guard.ShouldRestore(result) {
+		alert.patchPath, alert.err = m.opts.Guard.Restore(result)
+		if alert.err == nil {
+			alert.restored = true
+			// Track the restored content so the restore itself isn't reported as a change
+			m.stateManager.Set(result.OldState)
+		}
+	}
+
+	m.protectAlerts = append(m.protectAlerts, alert)
+}
+
+// dismissProtectAlert acknowledges the oldest pending alert
+func (m *Model) dismissProtectAlert() {
+	if len(m.protectAlerts) > 0 {
+		m.protectAlerts = m.protectAlerts[1:]
+	}
+}
+
+// renderProtectAlert renders the oldest pending alert as a modal
+func (m *Model) renderProtectAlert() string {
+	alert := m.protectAlerts[0]
+
+	titleStyle := lipgloss.NewStyle().
+		Bold(true).
+		Foreground(m.theme.alertText).
+		Background(m.theme.critical).
+		Padding(0, 1)
+
+	textStyle := lipgloss.NewStyle().
+		Foreground(m.theme.alertText)
+
+	hintStyle := lipgloss.NewStyle().
+		Foreground(m.theme.muted).
+		Italic(true)
+
+	var b strings.Builder
+	b.WriteString(titleStyle.Render(m.glyphs.with(m.glyphs.warning, "PROTECTED PATH CHANGED")))
+	b.WriteString("\n\n")
+	b.WriteString(textStyle.Render(fmt.Sprintf("[%s] %s: %s",
+		alert.timestamp.Format("15:04:05"), alert.op, m.displayPath(alert.path))))
+	b.WriteString("\n\n")
+
+	switch {
+	case alert.restored:
+		b.WriteString(textStyle.Render("The previous version was restored."))
+		b.WriteString("\n")
+		b.WriteString(textStyle.Render("Change saved as patch: " + alert.patchPath))
+	case alert.err != nil:
+		b.WriteString(textStyle.Render(fmt.Sprintf("Restore failed: %v", alert.err)))
+	default:
+		b.WriteString(textStyle.Render("The change was not reverted."))
+	}
+
+	b.WriteString("\n\n")
+	hint := "Press 'enter' to acknowledge"
+	if len(m.protectAlerts) > 1 {
+		hint += fmt.Sprintf(" (%d more)", len(m.protectAlerts)-1)
+	}
+	b.WriteString(hintStyle.Render(hint))
+
+	boxStyle := lipgloss.NewStyle().
+		BorderStyle(m.glyphs.double).
+		BorderForeground(m.theme.critical).
+		Padding(1, 2)
+
+	return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center,
+		boxStyle.Render(b.String()))
+}
@@ -0,0 +1,27 @@
+package ui
+
+import (
+	"fmt"
+
+	"github.com/deemkeen/diffwatch/internal/config"
+	"github.com/deemkeen/diffwatch/internal/watcher"
+)
+
+// checkRates counts a processed event for the rate alarms, and logs and
+// notifies the alarms it raises
+func (m *Model) checkRates(event watcher.Event) {
+	for _, alarm := range m.opts.RateAlarms.Observe(m.relPath(event.Path), event.Timestamp) {
+		m.log.Warn("rate alarm", "path", alarm.Path, "alarm", alarm.Message)
+
+		// Without a path, so changes of the file are never coalesced into it
+		message := alarm.Message
+		if alarm.Path != "" {
+			message = m.displayPath(event.Path) + " " + alarm.Message
+		}
+		m.appendLog(logEntry{
+			text:  fmt.Sprintf("[%s] %s: %s", event.Timestamp.Format("15:04:05"), m.glyphs.with(m.glyphs.alarm, "rate alarm"), message),
+			level: alarm.Level,
+		})
+		m.notify(alarm.Level, config.LevelAction{}, "diffwatch: rate alarm", message)
+	}
+}
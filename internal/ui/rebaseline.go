@@ -0,0 +1,67 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// acceptShown makes the current content of the displayed file its
+// baseline, so that the diff since the baseline only shows later edits
+func (m *Model) acceptShown() {
+	current, _ := m.shownDiffs()
+	if current == nil || m.showDigest || m.showHeatmap {
+		return
+	}
+	if current.Streamed {
+		m.err = errors.New("large files are diffed by change only and have no baseline")
+		return
+	}
+	if !m.stateManager.Rebaseline(current.Path) {
+		m.err = errors.New("no content to accept: the file is no longer tracked")
+		return
+	}
+
+	now := time.Now()
+	m.accepted[current.Path] = now
+	m.refreshBaselineDiff()
+	m.appendLog(logEntry{
+		text:   fmt.Sprintf("[%s] accepted: ", now.Format("15:04:05")),
+		path:   current.Path,
+		detail: " (new baseline)",
+	})
+}
+
+// acceptAll makes the current content of every tracked file its baseline
+func (m *Model) acceptAll() {
+	now := time.Now()
+	n := m.stateManager.RebaselineAll()
+	m.acceptedAll = now
+	clear(m.accepted)
+	m.refreshBaselineDiff()
+	m.appendLog(logEntry{
+		text: fmt.Sprintf("[%s] accepted %d files as the new baseline", now.Format("15:04:05"), n),
+	})
+}
+
+// refreshBaselineDiff recomputes the live diff since the baseline after
+// the baseline changed. Pinned diffs keep the baseline diff they were
+// pinned with.
+func (m *Model) refreshBaselineDiff() {
+	if m.currentDiff != nil {
+		m.baselineDiff = m.computeBaselineDiff(m.currentDiff)
+	}
+}
+
+// baselineSince describes the baseline of path: the session start, or
+// when its content was last accepted
+func (m *Model) baselineSince(path string) string {
+	at, ok := m.accepted[path]
+	if !ok || m.acceptedAll.After(at) {
+		at = m.acceptedAll
+	}
+	if at.IsZero() {
+		return "session start"
+	}
+	return "accepted at " + at.Format("15:04:05")
+}
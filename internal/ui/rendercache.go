@@ -0,0 +1,32 @@
+package ui
+
+// renderCache keeps the sections of the last frame that are costly to
+// draw and only change with messages: the event log and the pane below
+// it. Idle coalescing ticks, four a second, then only redraw the header
+// counters and the status bar.
+type renderCache struct {
+	gen  uint64  // Bumped whenever a message may change what the sections show
+	log  section // Event log
+	pane section // Diff pane, or what is shown in its place
+}
+
+// section is a rendered part of the frame and what it was rendered for
+type section struct {
+	gen           uint64
+	width, height int
+	text          string
+}
+
+// invalidate has the sections rendered again for the next frame
+func (c *renderCache) invalidate() {
+	c.gen++
+}
+
+// cached returns the text of s if it was rendered since the last
+// invalidation for the same size, otherwise renders and keeps it
+func (c *renderCache) cached(s *section, width, height int, render func() string) string {
+	if s.text == "" || s.gen != c.gen || s.width != width || s.height != height {
+		*s = section{gen: c.gen, width: width, height: height, text: render()}
+	}
+	return s.text
+}
@@ -0,0 +1,76 @@
+package ui
+
+// reviewable reports whether an event log entry has a diff to review:
+// a change that wasn't suppressed
+func reviewable(entry logEntry) bool {
+	return entry.result != nil && entry.result.HasDiff && !entry.noise
+}
+
+// seenMark returns the mark of an event log entry: the unseen glyph if its
+// diff wasn't marked as seen, otherwise blank of the same width
+func (m *Model) seenMark(entry logEntry) string {
+	if entry.unseen {
+		return m.glyphs.unseen
+	}
+	return "  "
+}
+
+// unseenCount returns the number of unseen diffs passing the live filter
+func (m *Model) unseenCount() int {
+	n := 0
+	for _, entry := range m.visibleEvents() {
+		if entry.unseen {
+			n++
+		}
+	}
+	return n
+}
+
+// shownEntry returns the index in the event log of the newest entry of
+// the displayed diff, or -1 if it has none, e.g. was evicted
+func (m *Model) shownEntry() int {
+	current, _ := m.shownDiffs()
+	if current == nil {
+		return -1
+	}
+	for i := len(m.events) - 1; i >= 0; i-- {
+		if m.events[i].result == current {
+			return i
+		}
+	}
+	return -1
+}
+
+// toggleSeen marks the displayed diff as seen, or as unseen again
+func (m *Model) toggleSeen() {
+	if m.showDigest || m.showHeatmap || m.showFullLog || m.showFilters {
+		return
+	}
+	if i := m.shownEntry(); i >= 0 && reviewable(m.events[i]) {
+		m.events[i].unseen = !m.events[i].unseen
+	}
+}
+
+// showNextUnseen displays the next unseen diff after the displayed one
+// in the event log, wrapping around to the oldest, so that pressing 's'
+// and 'n' in turn works through the changes like a review queue. Diffs
+// hidden by the live filter are skipped.
+func (m *Model) showNextUnseen() {
+	start := m.shownEntry()
+	for k := 1; k <= len(m.events); k++ {
+		i := (start + k) % len(m.events)
+		entry := m.events[i]
+		if !entry.unseen || !m.matchesLiveFilter(entry.path) {
+			continue
+		}
+		result := m.readEntry(i)
+		if result == nil {
+			continue
+		}
+		m.pinIndex = -1
+		m.nav.offset = -1
+		m.showDigest, m.showHeatmap, m.showFullLog, m.showFilters = false, false, false, false
+		m.showDiff(result)
+		return
+	}
+}
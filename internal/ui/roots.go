@@ -0,0 +1,192 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/deemkeen/diffwatch/internal/control"
+	"github.com/deemkeen/diffwatch/internal/pathname"
+	"github.com/deemkeen/diffwatch/internal/severity"
+	"github.com/deemkeen/diffwatch/internal/watcher"
+)
+
+// rootsChangedMsg reports a change to the set of watched roots
+type rootsChangedMsg struct {
+	text string
+}
+
+// promptAddRoot asks for a path to start watching
+func (m *Model) promptAddRoot() {
+	m.prompt = newPrompt("Watch path", "", func(value string) tea.Cmd {
+		return m.rootCmd("add", value)
+	})
+}
+
+// promptRemoveRoot asks for a root to stop watching, suggesting the most
+// recently added one
+func (m *Model) promptRemoveRoot() {
+	roots := m.watcher.Roots()
+	m.prompt = newPrompt("Stop watching", roots[len(roots)-1], func(value string) tea.Cmd {
+		return m.rootCmd("remove", value)
+	})
+}
+
+// rootCmd adds or removes a root entered in the prompt
+func (m *Model) rootCmd(cmd, value string) tea.Cmd {
+	path := expandHome(strings.TrimSpace(value))
+	if path == "" {
+		return nil
+	}
+
+	return func() tea.Msg {
+		resp := m.changeRoots(control.Request{Cmd: cmd, Path: path})
+		if resp.Error != "" {
+			return errMsg(fmt.Errorf("%s", resp.Error))
+		}
+		return nil
+	}
+}
+
+// changeRoots executes a root change requested from the prompt or over the
+// control socket. Safe to call from any goroutine.
+func (m *Model) changeRoots(req control.Request) control.Response {
+	var text string
+
+	switch req.Cmd {
+	case "add":
+		root, err := m.watcher.AddRoot(req.Path)
+		if err != nil {
+			return control.Response{Error: err.Error()}
+		}
+		text = "watching: " + root
+	case "remove":
+		root, err := m.watcher.RemoveRoot(req.Path)
+		if err != nil {
+			return control.Response{Error: err.Error()}
+		}
+		text = "stopped watching: " + root
+	case "list":
+		return control.Response{Roots: m.watcher.Roots()}
+	default:
+		return control.Response{Error: fmt.Sprintf("unknown command %q", req.Cmd)}
+	}
+
+	if m.send != nil {
+		m.send(rootsChangedMsg{text: text})
+	}
+	return control.Response{Roots: m.watcher.Roots()}
+}
+
+// handleRootsChanged logs a change to the watched roots
+func (m *Model) handleRootsChanged(msg rootsChangedMsg) {
+	m.appendLog(logEntry{
+		text: fmt.Sprintf("[%s] %s", time.Now().Format("15:04:05"), msg.text),
+	})
+}
+
+// goneRootsSource is implemented by sources that notice watched roots
+// being deleted or unmounted
+type goneRootsSource interface {
+	GoneRoots() []watcher.GoneRoot
+}
+
+// checkGoneRoots logs the roots that went away or came back since the
+// last check
+func (m *Model) checkGoneRoots() {
+	src, ok := m.watcher.(goneRootsSource)
+	if !ok {
+		return
+	}
+
+	gone := src.GoneRoots()
+	for _, g := range gone {
+		if !slices.ContainsFunc(m.goneRoots, func(old watcher.GoneRoot) bool { return old.Path == g.Path }) {
+			// What was read below it is stale, and a file system mounted
+			// again may reuse its file identities
+			m.stateManager.Remove(g.Path)
+			m.stateManager.RemoveTree(g.Path)
+			m.appendLog(logEntry{
+				text:  fmt.Sprintf("[%s] watch root gone: %s (%s)", g.Since.Format("15:04:05"), pathname.Display(g.Path), g.Reason),
+				level: severity.Critical,
+			})
+		}
+	}
+	roots := m.watcher.Roots()
+	for _, old := range m.goneRoots {
+		back := !slices.ContainsFunc(gone, func(g watcher.GoneRoot) bool { return g.Path == old.Path })
+		if back && slices.Contains(roots, old.Path) {
+			m.appendLog(logEntry{
+				text: fmt.Sprintf("[%s] watch root back, watching again: %s", time.Now().Format("15:04:05"), pathname.Display(old.Path)),
+			})
+		}
+	}
+	m.goneRoots = gone
+}
+
+// rebuildsSource is implemented by sources that rebuild their watches
+// after stale watch errors
+type rebuildsSource interface {
+	Rebuilds() []watcher.Rebuild
+}
+
+// checkRebuilds logs the watches rebuilt since the last check
+func (m *Model) checkRebuilds() {
+	src, ok := m.watcher.(rebuildsSource)
+	if !ok {
+		return
+	}
+
+	for _, r := range src.Rebuilds() {
+		if r.Count == m.rebuilds[r.Path] {
+			continue
+		}
+		m.rebuilds[r.Path] = r.Count
+		m.appendLog(logEntry{
+			text:  fmt.Sprintf("[%s] watches rebuilt after a stale watch error: %s (%s)", r.At.Format("15:04:05"), pathname.Display(r.Path), pathname.Display(r.Cause)),
+			level: severity.Warn,
+		})
+	}
+}
+
+// renderGoneRoots renders the banner shown while watched roots are gone
+func (m *Model) renderGoneRoots() string {
+	paths := make([]string, len(m.goneRoots))
+	for i, g := range m.goneRoots {
+		paths[i] = fmt.Sprintf("%s (%s)", pathname.Display(g.Path), g.Reason)
+	}
+	text := "WATCH ROOT GONE: " + strings.Join(paths, ", ")
+	if m.goneRoots[0].Waiting {
+		text += " - waiting for it to reappear"
+	} else {
+		text += " - no longer watched (-wait-root watches it again once back)"
+	}
+
+	return lipgloss.NewStyle().
+		Foreground(m.theme.critical).
+		Bold(true).
+		Render(ansi.Truncate(m.glyphs.with(m.glyphs.warning, text), max(m.width-2, 20), m.glyphs.ellipsis))
+}
+
+// listenControl serves "diffwatch ctl" requests for this instance
+func (m *Model) listenControl() (*control.Server, error) {
+	return control.Listen(control.SocketPath(os.Getpid()), m.changeRoots)
+}
+
+// expandHome replaces a leading ~ with the home directory
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~"+string(filepath.Separator)) && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
@@ -0,0 +1,176 @@
+package ui
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/deemkeen/diffwatch/internal/diff"
+	"github.com/deemkeen/diffwatch/internal/share"
+	"github.com/deemkeen/diffwatch/internal/state"
+	"github.com/deemkeen/diffwatch/internal/watcher"
+)
+
+// mirrorSource is implemented by sources of files that can't be read
+// locally, like a session shared from another machine or a container: the
+// source supplies the state of a file after its event
+type mirrorSource interface {
+	CurrentState(path string) (*state.FileState, bool)
+}
+
+// mirrored reports whether the UI shows files it can't read locally
+func (m *Model) mirrored() bool {
+	_, ok := m.watcher.(mirrorSource)
+	return ok
+}
+
+// mirrorDiff diffs the state of path sent by the shared session against
+// the previous one. Returns nil if the session sent no state, e.g. for
+// files too large to share.
+func (m *Model) mirrorDiff(src mirrorSource, path string) *diff.Result {
+	m.seedState(path)
+
+	start := time.Now()
+	newState, ok := src.CurrentState(path)
+	m.bench.measure(stageRead, start)
+	if !ok {
+		return nil
+	}
+	oldState := m.stateManager.Apply(newState)
+
+	start = time.Now()
+	result, err := m.diffEngine.Compute(oldState, newState)
+	m.bench.measure(stageDiff, start)
+	if err != nil {
+		m.log.Error("computing diff failed", "path", path, "error", err)
+		m.err = err
+		return nil
+	}
+	return result
+}
+
+// share sends a processed event with the states of its file to the
+// viewers of the session, with secrets masked. Large files, only diffed
+// in regions, and unreadable files are sent without states.
+func (m *Model) share(event watcher.Event, result *diff.Result) {
+	if m.opts.Share == nil {
+		return
+	}
+
+	stats := m.watcher.Stats()
+	msg := share.Message{Event: &event, Stats: &stats, Roots: m.watcher.Roots()}
+	if result != nil && !result.Streamed && !result.TooLarge && !result.Locked {
+		rel := m.relPath(event.Path)
+		baseline, _ := m.stateManager.Baseline(event.Path)
+		msg.Baseline = m.opts.Redactor.State(rel, baseline)
+		msg.Previous = m.opts.Redactor.State(rel, result.OldState)
+		msg.Current = m.opts.Redactor.State(rel, result.NewState)
+	}
+	m.opts.Share.Publish(msg)
+}
+
+// shareStatus describes the shared session for the stats line
+func (m *Model) shareStatus() string {
+	if m.opts.Share == nil {
+		return ""
+	}
+	return fmt.Sprintf("%ssharing on %s (%d viewers)", m.glyphs.dot, m.opts.Share.Addr(), m.opts.Share.Viewers())
+}
+
+// focusSource is implemented by shared sessions that tell what their
+// presenter shows
+type focusSource interface {
+	Focus() <-chan share.Focus
+}
+
+// focusMsg delivers what the presenter of a shared session shows
+type focusMsg share.Focus
+
+// follow is the state of following the presenter of a shared session
+type follow struct {
+	on        bool         // Show what the presenter shows, toggled with 'F'
+	focus     *share.Focus // Latest focus of the presenter (nil: none yet)
+	published share.Focus  // Focus last sent to viewers, when sharing
+}
+
+// listenForFocus delivers the presenter's focus to the program
+func (m *Model) listenForFocus(src focusSource) {
+	defer m.recoverPanic()
+	for f := range src.Focus() {
+		m.send(focusMsg(f))
+	}
+}
+
+// toggleFollow starts or stops following the presenter of the shared
+// session the UI mirrors
+func (m *Model) toggleFollow() {
+	if _, ok := m.watcher.(focusSource); !ok {
+		return
+	}
+	m.follow.on = !m.follow.on
+	m.applyFocus()
+}
+
+// syncFocus tells viewers what the UI shows if that changed, when
+// sharing, and shows what the presenter shows, when following. It runs
+// after every update, as keys and new changes both move the focus.
+func (m *Model) syncFocus() {
+	m.applyFocus()
+	if m.opts.Share == nil {
+		return
+	}
+
+	i := m.shownEntry()
+	if i < 0 {
+		return
+	}
+	f := share.Focus{
+		Path:   m.events[i].path,
+		Time:   m.events[i].at,
+		Mode:   int(m.diffMode),
+		Offset: -1,
+	}
+	if m.nav.target == m.scrollTarget() {
+		f.Offset = m.nav.offset
+	}
+	if f == m.follow.published {
+		return
+	}
+	m.follow.published = f
+	m.opts.Share.Publish(share.Message{Focus: &f})
+}
+
+// applyFocus shows the diff the presenter shows, scrolled like theirs,
+// when following. The presenter's change may not have arrived yet, or
+// have been coalesced with later ones of the file: the newest change of
+// the file up to the presenter's is shown, or its oldest after it.
+func (m *Model) applyFocus() {
+	f := m.follow.focus
+	if !m.follow.on || f == nil {
+		return
+	}
+
+	var result *diff.Result
+	for i := len(m.events) - 1; i >= 0; i-- {
+		entry := m.events[i]
+		if entry.path != f.Path || entry.result == nil {
+			continue
+		}
+		result = entry.result
+		if !entry.at.After(f.Time) {
+			break
+		}
+	}
+	if result == nil {
+		return
+	}
+
+	m.pinIndex = -1
+	m.showDigest, m.showHeatmap, m.showFullLog, m.showFilters = false, false, false, false
+	if m.currentDiff != result {
+		m.showDiff(result)
+	}
+	if mode := diffMode(f.Mode); mode >= modeLastChange && mode <= modeBoth {
+		m.diffMode = mode
+	}
+	m.nav = navState{target: m.scrollTarget(), offset: f.Offset}
+}
@@ -0,0 +1,68 @@
+package ui
+
+import (
+	"fmt"
+
+	"github.com/deemkeen/diffwatch/internal/lang"
+	"github.com/deemkeen/diffwatch/internal/severity"
+	"github.com/deemkeen/diffwatch/internal/state"
+	"github.com/deemkeen/diffwatch/internal/store"
+	"github.com/deemkeen/diffwatch/internal/watcher"
+)
+
+// Source delivers file events to the UI: a local watcher, or a daemon the
+// UI is attached to
+type Source interface {
+	Events() <-chan watcher.Event
+	Errors() <-chan error
+	Stats() watcher.Stats
+	WatchPath() string
+	Roots() []string
+	IsRecursive() bool
+	AddRoot(path string) (string, error)
+	RemoveRoot(path string) (string, error)
+	WalkFiles(fn func(path string) error) error
+}
+
+// priorSource is implemented by sources that know the state of a file
+// from before its event, e.g. a daemon that has been watching for longer
+// than the UI
+type priorSource interface {
+	PriorState(path string) (baseline, previous *state.FileState, ok bool)
+}
+
+// seedState hands the source's knowledge of a file to the state manager
+// before its first event is processed, so the diff doesn't show the whole
+// file as new
+func (m *Model) seedState(path string) {
+	src, ok := m.watcher.(priorSource)
+	if !ok {
+		return
+	}
+
+	baseline, previous, ok := src.PriorState(path)
+	if !ok || previous == nil {
+		return
+	}
+	m.stateManager.Seed(path, baseline, previous)
+}
+
+// historyEntries converts recorded events into event log entries drawn
+// with g
+func historyEntries(records []store.Record, g glyphs) []logEntry {
+	entries := make([]logEntry, 0, len(records))
+	for _, r := range records {
+		level, _ := severity.ParseLevel(r.Level)
+		stats := fmt.Sprintf("+%d -%d", r.Added, r.Deleted)
+		if r.Binary {
+			stats = "binary"
+		}
+		entries = append(entries, logEntry{
+			text:  fmt.Sprintf("[%s] %s: %s", r.Time.Local().Format("15:04:05"), r.Op, g.withIcon("", lang.Detect(r.Path, nil))),
+			path:  r.Path,
+			level: level,
+			stats: stats,
+		})
+	}
+	return entries
+}
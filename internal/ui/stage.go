@@ -0,0 +1,139 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/deemkeen/diffwatch/internal/diff"
+	"github.com/deemkeen/diffwatch/internal/git"
+)
+
+// stagedMsg delivers the result of staging a hunk
+type stagedMsg struct {
+	path           string
+	whole          bool // The whole file was staged
+	added, deleted int
+	err            error
+}
+
+// stageHunk returns a command staging the hunk nearest to the middle of
+// the diff view in the git index, or nil if there is nothing to stage.
+// Files that are new to git or deleted are staged as a whole.
+func (m *Model) stageHunk() tea.Cmd {
+	target := m.scrollTarget()
+	if target == nil || m.showDigest || m.showHeatmap || !target.HasDiff {
+		return nil
+	}
+	if target.IsBinary || target.Streamed || target.TooLarge {
+		m.err = errors.New("staging hunks needs a text diff")
+		return nil
+	}
+
+	root, err := m.repoRoot()
+	if err != nil {
+		m.err = err
+		return nil
+	}
+
+	if m.nav.target != target {
+		m.nav = navState{target: target, offset: -1}
+	}
+	h, ok := m.hunkNearCenter()
+	if !ok {
+		return nil
+	}
+	line := anchorLine(target.Lines, h)
+
+	path := target.Path
+	content := target.NewState.Content
+	exists := target.NewState.Exists
+	alg := m.opts.Algorithm.For(target.Language)
+	return func() tea.Msg {
+		return stage(root, path, content, exists, line, alg)
+	}
+}
+
+// stage stages the hunk of the change from the index to content that
+// touches line, matching lines with alg
+func stage(root, path string, content []byte, exists bool, line int, alg diff.Algorithm) stagedMsg {
+	msg := stagedMsg{path: path}
+
+	index, tracked, err := git.IndexContent(root, path)
+	if err != nil {
+		msg.err = err
+		return msg
+	}
+	if !exists || !tracked {
+		msg.whole = true
+		msg.err = git.Stage(root, path)
+		return msg
+	}
+
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		msg.err = fmt.Errorf("resolving %s in repository: %w", path, err)
+		return msg
+	}
+
+	patch := diff.HunkPatch(filepath.ToSlash(rel), index, content, line, alg)
+	if patch == "" {
+		msg.err = fmt.Errorf("%s: hunk is already staged", rel)
+		return msg
+	}
+	msg.added, msg.deleted = patchStats(patch)
+	msg.err = git.ApplyCached(root, patch)
+	return msg
+}
+
+// handleStaged logs a staged hunk
+func (m *Model) handleStaged(msg stagedMsg) {
+	if msg.err != nil {
+		m.err = msg.err
+		return
+	}
+
+	entry := logEntry{
+		text:   fmt.Sprintf("[%s] staged hunk: ", time.Now().Format("15:04:05")),
+		path:   msg.path,
+		detail: fmt.Sprintf(" (+%d -%d)", msg.added, msg.deleted),
+	}
+	if msg.whole {
+		entry.text, entry.detail = fmt.Sprintf("[%s] staged: ", time.Now().Format("15:04:05")), ""
+	}
+	m.appendLog(entry)
+}
+
+// anchorLine returns the line of the new content a hunk of the displayed
+// diff is at: its first added or unchanged line, or for a deletion the
+// line before it
+func anchorLine(lines []diff.DiffLine, h hunk) int {
+	for i := h.start; i < h.end; i++ {
+		if lines[i].NewLineNum > 0 {
+			return lines[i].NewLineNum
+		}
+	}
+	for i := h.start - 1; i >= 0; i-- {
+		if lines[i].NewLineNum > 0 {
+			return lines[i].NewLineNum
+		}
+	}
+	return 0
+}
+
+// patchStats counts the added and deleted lines of a unified diff
+func patchStats(patch string) (added, deleted int) {
+	for _, line := range strings.Split(patch, "\n") {
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+		case strings.HasPrefix(line, "+"):
+			added++
+		case strings.HasPrefix(line, "-"):
+			deleted++
+		}
+	}
+	return added, deleted
+}
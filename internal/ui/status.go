@@ -0,0 +1,136 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/deemkeen/diffwatch/internal/watcher"
+)
+
+// rateWindow is the period the status bar counts events over
+const rateWindow = time.Minute
+
+// activity counts events for the status bar
+type activity struct {
+	recent  []time.Time // Times of events processed within rateWindow, oldest first
+	lastSeq uint64      // Sequence number of the last event received
+	dropped uint64      // Events missing from the sequence
+}
+
+// received notes an event from the source, counting the events skipped in
+// its sequence as dropped. Sources without sequence numbers send 0.
+func (a *activity) received(event watcher.Event) {
+	if event.Seq == 0 {
+		return
+	}
+	if a.lastSeq > 0 && event.Seq > a.lastSeq+1 {
+		a.dropped += event.Seq - a.lastSeq - 1
+	}
+	a.lastSeq = max(a.lastSeq, event.Seq)
+}
+
+// processed notes an event shown in the log at t
+func (a *activity) processed(t time.Time) {
+	a.recent = append(a.recent, t)
+	a.expire(t)
+}
+
+// perMinute returns the number of events processed within rateWindow
+// before now
+func (a *activity) perMinute(now time.Time) int {
+	a.expire(now)
+	return len(a.recent)
+}
+
+// expire forgets events older than rateWindow
+func (a *activity) expire(now time.Time) {
+	i := 0
+	for i < len(a.recent) && now.Sub(a.recent[i]) > rateWindow {
+		i++
+	}
+	a.recent = a.recent[i:]
+}
+
+// renderStatusBar renders the status bar: live counters, indicators and
+// the active filter, with a hint for the key help
+func (m *Model) renderStatusBar() string {
+	barStyle := lipgloss.NewStyle().
+		Foreground(m.theme.alertText).
+		Background(m.theme.border)
+
+	alertStyle := lipgloss.NewStyle().
+		Foreground(m.theme.alertText).
+		Background(m.theme.critical).
+		Bold(true)
+
+	now := time.Now()
+	var badges []string
+	if m.paused {
+		badges = append(badges, alertStyle.Render(" "+m.glyphs.with(m.glyphs.paused, "PAUSED ")))
+	}
+	if m.opts.Store != nil && m.opts.RecordHours.Active(now) {
+		badges = append(badges, alertStyle.Render(" "+m.glyphs.with(m.glyphs.recording, "REC ")))
+	}
+
+	stats := m.watcher.Stats()
+	fields := []string{
+		fmt.Sprintf("%d files", stats.Files),
+		fmt.Sprintf("%d events/min", m.activity.perMinute(now)),
+		fmt.Sprintf("%d dropped", m.activity.dropped),
+		"mem " + m.memoryStatus(),
+	}
+	if m.paused {
+		fields = append(fields, fmt.Sprintf("%d queued", len(m.pendingEvents)))
+	}
+	if n := m.unseenCount(); n > 0 {
+		fields = append(fields, fmt.Sprintf("%d unseen", n))
+	}
+	if m.stay {
+		fields = append(fields, fmt.Sprintf("staying on file, %d newer changes (l to follow)", m.held))
+	}
+	if m.follow.on {
+		fields = append(fields, "following presenter (F to stop)")
+	}
+	if !m.opts.NotifyHours.Active(now) {
+		fields = append(fields, "quiet hours")
+	}
+	if m.opts.Store != nil && !m.opts.RecordHours.Active(now) {
+		fields = append(fields, "not recording (schedule)")
+	}
+	if filter := m.filterStatus(); filter != "" {
+		fields = append(fields, "filter: "+filter)
+	}
+	fields = append(fields, "? help")
+
+	badge := strings.Join(badges, "")
+	return badge + barStyle.Width(max(m.width-lipgloss.Width(badge), 0)).Render(" "+strings.Join(fields, m.glyphs.bar))
+}
+
+// memoryStatus describes the memory held for diffing against its limit
+func (m *Model) memoryStatus() string {
+	used := formatBytes(m.stateManager.Memory())
+	if limit := m.stateManager.Limits().MaxBytes; limit > 0 {
+		return used + " / " + formatBytes(limit)
+	}
+	return used
+}
+
+// filterStatus describes the filters events pass before being shown
+func (m *Model) filterStatus() string {
+	var filters []string
+	if len(m.opts.Ops) > 0 {
+		filters = append(filters, "ops="+strings.Join(m.opts.Ops, ","))
+	}
+	if len(m.include) > 0 {
+		filters = append(filters, "include="+strings.Join(m.include, ","))
+	}
+	if len(m.exclude) > 0 {
+		filters = append(filters, "exclude="+strings.Join(m.exclude, ","))
+	}
+	if m.liveFilter != "" {
+		filters = append(filters, "paths="+m.liveFilter)
+	}
+	return strings.Join(filters, " ")
+}
@@ -0,0 +1,33 @@
+package ui
+
+import "github.com/deemkeen/diffwatch/internal/diff"
+
+// showChange displays the diff of a new change, unless the diff pane stays
+// on another file: then the change is only logged and counted
+func (m *Model) showChange(result *diff.Result) {
+	if m.stay && m.currentDiff != nil && m.currentDiff.Path != result.Path {
+		m.held++
+		return
+	}
+	m.showDiff(result)
+}
+
+// toggleStay switches between keeping the displayed file in the diff pane
+// and jumping to the newest change, which is shown right away
+func (m *Model) toggleStay() {
+	m.stay = !m.stay
+	held := m.held
+	m.held = 0
+	if m.stay || held == 0 {
+		return
+	}
+
+	events := m.visibleEvents()
+	for i := len(events) - 1; i >= 0; i-- {
+		if reviewable(events[i]) {
+			m.pinIndex = -1
+			m.showDiff(events[i].result)
+			return
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package ui
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/deemkeen/diffwatch/internal/diff"
+	"github.com/deemkeen/diffwatch/internal/lang"
+)
+
+// showsChanges reports whether the element changes of a structured file
+// are shown in place of its lines, which 'r' toggles
+func (m *Model) showsChanges(result *diff.Result) bool {
+	return result.Structure != "" && !m.rawLines
+}
+
+// renderChanges renders the element changes of a structured file in at
+// most maxDisplayLines lines, a change per line
+func (m *Model) renderChanges(result *diff.Result, maxDisplayLines int) string {
+	noteStyle := lipgloss.NewStyle().
+		Foreground(m.theme.lineNum).
+		Italic(true)
+
+	locationStyle := lipgloss.NewStyle().
+		Foreground(m.theme.info)
+
+	addedStyle := lipgloss.NewStyle().
+		Foreground(m.theme.added).
+		Background(m.theme.addedBg)
+
+	deletedStyle := lipgloss.NewStyle().
+		Foreground(m.theme.deleted).
+		Background(m.theme.deletedBg)
+
+	hint := "press 'r' for the lines"
+	if m.masksValues(result) {
+		hint += ", 'R' to reveal values"
+	}
+
+	var b strings.Builder
+	if len(result.Changes) == 0 {
+		b.WriteString(noteStyle.Render(fmt.Sprintf("%s: only formatting changed, %s", result.Structure, hint)))
+		return b.String()
+	}
+	b.WriteString(noteStyle.Render(fmt.Sprintf("%s: %s, %s", result.Structure, countChanges(len(result.Changes)), hint)) + "\n\n")
+
+	shown := min(len(result.Changes), max(maxDisplayLines, 1))
+	for _, c := range result.Changes[:shown] {
+		location := locationStyle.Render(c.Location) + " "
+		old, new := m.changeValue(result, c.Old), m.changeValue(result, c.New)
+		switch c.Type {
+		case diff.LineAdded:
+			b.WriteString(addedStyle.Render(m.glyphs.added) + location + addedStyle.Render(new))
+		case diff.LineDeleted:
+			b.WriteString(deletedStyle.Render(m.glyphs.deleted) + location + deletedStyle.Render(old))
+		default:
+			b.WriteString("  " + location + deletedStyle.Render(old) + " " + m.glyphs.arrow + " " + addedStyle.Render(new))
+		}
+		b.WriteString("\n")
+	}
+	if shown < len(result.Changes) {
+		b.WriteString("\n" + noteStyle.Render(fmt.Sprintf("... %d more changes", len(result.Changes)-shown)))
+	}
+	return b.String()
+}
+
+// masksValues reports whether the values of a file are masked: those of
+// .env files are, unless revealed with 'R'
+func (m *Model) masksValues(result *diff.Result) bool {
+	return result.Language == lang.Dotenv && !m.revealValues
+}
+
+// changeValue returns a value of an element change as it is shown
+func (m *Model) changeValue(result *diff.Result, value string) string {
+	if value != "" && m.masksValues(result) {
+		return m.glyphs.mask
+	}
+	return value
+}
+
+// scopeHeaders returns the declarations that group the changed lines of
+// a diff, by the index of the line they are shown above: the first changed
+// line of each run of changes in the same declaration
+func scopeHeaders(lines []diff.DiffLine) map[int]string {
+	headers := make(map[int]string)
+	last := ""
+	for i, line := range lines {
+		if line.Type == diff.LineUnchanged || line.Type == diff.LineGap || line.Scope == "" || line.Scope == last {
+			continue
+		}
+		headers[i] = line.Scope
+		last = line.Scope
+	}
+	return headers
+}
+
+// printSpokenChanges prints the element changes of a structured file,
+// each introduced by what happened to the element
+func printSpokenChanges(w io.Writer, result *diff.Result) {
+	if len(result.Changes) == 0 {
+		fmt.Fprintf(w, "  %s: only formatting changed\n", result.Structure)
+		return
+	}
+
+	// Without keys to reveal them, values of .env files stay masked
+	spoken := func(value string) string {
+		if value != "" && result.Language == lang.Dotenv {
+			return "masked value"
+		}
+		return spokenLine(value)
+	}
+
+	for i, c := range result.Changes {
+		if i == a11yMaxLines {
+			fmt.Fprintln(w, "  more changes left out")
+			return
+		}
+		switch c.Type {
+		case diff.LineAdded:
+			fmt.Fprintf(w, "  added %s: %s\n", c.Location, spoken(c.New))
+		case diff.LineDeleted:
+			fmt.Fprintf(w, "  removed %s: %s\n", c.Location, spoken(c.Old))
+		default:
+			fmt.Fprintf(w, "  changed %s: %s, was: %s\n", c.Location, spoken(c.New), spoken(c.Old))
+		}
+	}
+}
+
+// countChanges returns n with "change" or "changes"
+func countChanges(n int) string {
+	if n == 1 {
+		return "1 change"
+	}
+	return fmt.Sprintf("%d changes", n)
+}
@@ -0,0 +1,85 @@
+package ui
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/deemkeen/diffwatch/internal/diff"
+	"github.com/deemkeen/diffwatch/internal/lang"
+)
+
+// fileIcon returns the icon shown before files of a language, a generic
+// document for unknown languages, and nothing without icons
+func (g glyphs) fileIcon(l *lang.Language) string {
+	switch {
+	case !g.icons:
+		return ""
+	case l == nil:
+		return g.file
+	}
+	return l.Icon
+}
+
+// withIcon prefixes a displayed path with the icon of its language, if known
+func (g glyphs) withIcon(path string, l *lang.Language) string {
+	if l == nil || !g.icons {
+		return path
+	}
+	return l.Icon + " " + path
+}
+
+// languageLabel renders the name of a result's language for its header,
+// or nothing if unknown
+func (m *Model) languageLabel(result *diff.Result) string {
+	if result.Language == nil {
+		return ""
+	}
+	return lipgloss.NewStyle().
+		Foreground(m.theme.muted).
+		Render("  " + result.Language.Name)
+}
+
+// renderCode renders a line of source in base with its tokens
+// highlighted. Unchanged lines (colors true) get syntax colors; on added
+// and deleted lines, whose colors mark the change, keywords are only made
+// bold and comments italic.
+func (m *Model) renderCode(content string, base lipgloss.Style, l *lang.Language, colors bool) string {
+	var b strings.Builder
+	last := 0
+	for _, t := range l.Tokens(content) {
+		if t.Start > last {
+			b.WriteString(base.Render(content[last:t.Start]))
+		}
+		b.WriteString(m.tokenStyle(base, t.Class, colors).Render(content[t.Start:t.End]))
+		last = t.End
+	}
+	if last < len(content) {
+		b.WriteString(base.Render(content[last:]))
+	}
+	return b.String()
+}
+
+// tokenStyle returns the style of a token class based on base
+func (m *Model) tokenStyle(base lipgloss.Style, class lang.Class, colors bool) lipgloss.Style {
+	switch class {
+	case lang.Comment:
+		if colors {
+			base = base.Foreground(m.theme.synComment)
+		}
+		return base.Italic(true)
+	case lang.Keyword:
+		if colors {
+			base = base.Foreground(m.theme.synKeyword)
+		}
+		return base.Bold(true)
+	case lang.String:
+		if colors {
+			return base.Foreground(m.theme.synString)
+		}
+	case lang.Number:
+		if colors {
+			return base.Foreground(m.theme.synNumber)
+		}
+	}
+	return base
+}
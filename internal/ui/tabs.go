@@ -0,0 +1,190 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/deemkeen/diffwatch/internal/crash"
+)
+
+// Tabs shows several independent watch sessions as top-level tabs, each
+// with its own watcher, event log and diff state
+type Tabs struct {
+	names  []string
+	models []*Model
+	active int   // Index of the displayed tab
+	seen   []int // Event log entries of each tab when it was last displayed
+	width  int
+}
+
+// tabMsg routes a message to the session of one tab
+type tabMsg struct {
+	tab int
+	msg tea.Msg
+}
+
+// NewTabs creates a tabbed UI with one session per model, labeled by names
+func NewTabs(names []string, models []*Model) *Tabs {
+	return &Tabs{
+		names:  names,
+		models: models,
+		seen:   make([]int, len(models)),
+		width:  80,
+	}
+}
+
+// Start starts the bubbletea program
+func (t *Tabs) Start() error {
+	g := &guard{model: t}
+	p := tea.NewProgram(g, tea.WithAltScreen(), tea.WithOutput(t.models[0].opts.Output))
+	g.quit = p.Quit
+
+	for i, m := range t.models {
+		defer m.start(func(msg tea.Msg) {
+			p.Send(tabMsg{tab: i, msg: msg})
+		})()
+	}
+
+	_, err := p.Run()
+	if g.panic != nil {
+		var sections []crash.Section
+		for i, m := range t.models {
+			sections = append(sections, m.crashSections(t.names[i])...)
+		}
+		return crashError(g.panic, append(sections, t.models[0].configSections()...))
+	}
+	return err
+}
+
+// Quit signals the program to quit
+func (t *Tabs) Quit() {
+	for _, m := range t.models {
+		m.Quit()
+	}
+}
+
+// Init initializes the sessions of all tabs
+func (t *Tabs) Init() tea.Cmd {
+	cmds := make([]tea.Cmd, len(t.models))
+	for i, m := range t.models {
+		cmds[i] = routeCmd(i, m.Init())
+	}
+	return tea.Batch(cmds...)
+}
+
+// Update handles tab switching and passes other messages to the session
+// they belong to
+func (t *Tabs) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tabMsg:
+		return t, t.updateTab(msg.tab, msg.msg)
+
+	case tea.WindowSizeMsg:
+		t.width = msg.Width
+
+		// The tab bar takes the first line
+		msg.Height--
+		cmds := make([]tea.Cmd, len(t.models))
+		for i := range t.models {
+			cmds[i] = t.updateTab(i, msg)
+		}
+		return t, tea.Batch(cmds...)
+
+	case tea.KeyMsg:
+		if !t.models[t.active].capturesKeys() {
+			switch key := msg.String(); key {
+			case "ctrl+right":
+				t.switchTo((t.active + 1) % len(t.models))
+				return t, nil
+			case "ctrl+left":
+				t.switchTo((t.active + len(t.models) - 1) % len(t.models))
+				return t, nil
+			case "1", "2", "3", "4", "5", "6", "7", "8", "9":
+				if i := int(key[0] - '1'); i < len(t.models) {
+					t.switchTo(i)
+				}
+				return t, nil
+			}
+		}
+		return t, t.updateTab(t.active, msg)
+	}
+
+	return t, t.updateTab(t.active, msg)
+}
+
+// updateTab passes msg to the session of tab i
+func (t *Tabs) updateTab(i int, msg tea.Msg) tea.Cmd {
+	_, cmd := t.models[i].Update(msg)
+	return routeCmd(i, cmd)
+}
+
+// switchTo displays tab i
+func (t *Tabs) switchTo(i int) {
+	t.seen[t.active] = t.models[t.active].logged
+	t.active = i
+}
+
+// routeCmd wraps the messages produced by a session's command so that
+// they are routed back to tab i. Batches and quitting are left to the
+// program.
+func routeCmd(i int, cmd tea.Cmd) tea.Cmd {
+	if cmd == nil {
+		return nil
+	}
+	return func() tea.Msg {
+		switch msg := cmd().(type) {
+		case nil:
+			return nil
+		case tea.BatchMsg:
+			for j := range msg {
+				msg[j] = routeCmd(i, msg[j])
+			}
+			return msg
+		case tea.QuitMsg:
+			return msg
+		default:
+			return tabMsg{tab: i, msg: msg}
+		}
+	}
+}
+
+// View renders the tab bar above the active session
+func (t *Tabs) View() string {
+	active := t.models[t.active]
+	if active.quitting {
+		return active.View()
+	}
+	t.seen[t.active] = active.logged
+
+	activeStyle := lipgloss.NewStyle().
+		Bold(true).
+		Reverse(true).
+		Foreground(active.theme.title)
+
+	tabStyle := lipgloss.NewStyle().
+		Foreground(active.theme.muted)
+
+	newStyle := lipgloss.NewStyle().
+		Foreground(active.theme.highlight)
+
+	var b strings.Builder
+	for i, name := range t.names {
+		label := fmt.Sprintf(" %d:%s ", i+1, name)
+		if i == t.active {
+			b.WriteString(activeStyle.Render(label))
+			continue
+		}
+		b.WriteString(tabStyle.Render(label))
+		// Entries logged since the tab was last displayed
+		if n := t.models[i].logged - t.seen[i]; n > 0 {
+			b.WriteString(newStyle.Render(fmt.Sprintf("(%d) ", n)))
+		}
+	}
+	b.WriteString(tabStyle.Render("  1-9 or " + active.glyphs.switchTab + " to switch"))
+
+	bar := lipgloss.NewStyle().MaxWidth(t.width).Render(b.String())
+	return bar + "\n" + active.View()
+}
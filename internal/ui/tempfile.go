@@ -0,0 +1,114 @@
+package ui
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/deemkeen/diffwatch/internal/watcher"
+)
+
+// tempHold is how long changes to a file with a temporary name wait for
+// it to be renamed over its real file, instead of the usual coalescing
+// delay
+const tempHold = time.Second
+
+// tempNames match the names build tools and atomic writers give the file
+// they write before renaming it over the real one, capturing the name it
+// was made from: foo.tmp, foo.tmp123, foo.tmp.4567, foo.123.temp, and
+// rsync's .foo.Ab3xYz. Names like page.tmpl or foo.template aren't
+// temporary.
+var tempNames = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)^(.+?)\.te?mp(?:[^a-z].*)?$`),
+	regexp.MustCompile(`^\.(.+)\.[[:alnum:]]{6}$`),
+}
+
+// tempStem returns the name a temporary file name was made from, and
+// whether path has a temporary name at all
+func tempStem(path string) (string, bool) {
+	name := filepath.Base(path)
+	for _, re := range tempNames {
+		if m := re.FindStringSubmatch(name); m != nil {
+			return m[1], true
+		}
+	}
+	return "", false
+}
+
+// tempFor reports whether tmp is named like a temporary file written in
+// place of target: in the same directory, and named after it
+func tempFor(tmp, target string) bool {
+	if filepath.Dir(tmp) != filepath.Dir(target) || tmp == target {
+		return false
+	}
+	stem, ok := tempStem(tmp)
+	name := filepath.Base(target)
+	return ok && (stem == name || strings.HasPrefix(stem, name+"."))
+}
+
+// correlateTemps drops the events of temporary files that were renamed
+// over the files of ready events, so that the rename shows as a single
+// change of the real file, diffed against its content before the rename.
+// The temporary files may still be waiting (see tempHold) or be ready
+// themselves, and their events may come in either order: the watcher
+// debounces every path on its own. Returns the ready events left.
+func (m *Model) correlateTemps(ready []watcher.Event) []watcher.Event {
+	// Files of a mirrored session can't be looked up locally
+	if m.mirrored() {
+		return ready
+	}
+
+	var gone []watcher.Event
+	for _, update := range m.pendingEvents {
+		if goneTemp(update.event) {
+			gone = append(gone, update.event)
+		}
+	}
+	for _, event := range ready {
+		if goneTemp(event) {
+			gone = append(gone, event)
+		}
+	}
+	if len(gone) == 0 {
+		return ready
+	}
+
+	dropped := make(map[string]bool)
+	for i := range ready {
+		target := &ready[i]
+		if _, ok := tempStem(target.Path); ok || target.Op == "remove" {
+			continue
+		}
+		for _, tmp := range gone {
+			if dropped[tmp.Path] || !tempFor(tmp.Path, target.Path) {
+				continue
+			}
+			dropped[tmp.Path] = true
+			// Tracked if it waited longer than tempHold and was shown
+			m.stateManager.Remove(tmp.Path)
+			if old, ok := m.stateManager.Get(target.Path); ok && old.Exists {
+				target.Op = "write"
+			}
+			m.viaTemp[target.Path] = tmp.Path
+			m.log.Debug("temporary file renamed over its file", "path", target.Path, "temp", tmp.Path)
+		}
+	}
+
+	for path := range dropped {
+		delete(m.pendingEvents, path)
+	}
+	return slices.DeleteFunc(ready, func(event watcher.Event) bool { return dropped[event.Path] })
+}
+
+// goneTemp reports whether event is about a file with a temporary name
+// that no longer exists
+func goneTemp(event watcher.Event) bool {
+	if _, ok := tempStem(event.Path); !ok {
+		return false
+	}
+	_, err := os.Lstat(event.Path)
+	return os.IsNotExist(err)
+}
@@ -0,0 +1,79 @@
+package ui
+
+import "github.com/charmbracelet/lipgloss"
+
+// theme holds the colors used by the UI
+type theme struct {
+	title     lipgloss.Color // Application title
+	muted     lipgloss.Color // Secondary information (watch path, stats, hints)
+	subtle    lipgloss.Color // Event log and footer text
+	faint     lipgloss.Color // Suppressed events
+	border    lipgloss.Color // Diff pane border and separators
+	critical  lipgloss.Color // Errors, critical events and alerts
+	warn      lipgloss.Color // Warnings and modified files
+	info      lipgloss.Color // File headers
+	added     lipgloss.Color // Added lines and new files
+	deleted   lipgloss.Color // Deleted lines and deleted files
+	addedBg   lipgloss.Color // Background of added lines
+	deletedBg lipgloss.Color // Background of deleted lines
+	context   lipgloss.Color // Unchanged lines
+	lineNum   lipgloss.Color // Line numbers and truncation notes
+	highlight lipgloss.Color // Selected item in lists
+	alertText lipgloss.Color // Text on alert backgrounds
+
+	synKeyword lipgloss.Color // Keywords in unchanged source lines
+	synString  lipgloss.Color // String literals in unchanged source lines
+	synNumber  lipgloss.Color // Number literals in unchanged source lines
+	synComment lipgloss.Color // Comments in unchanged source lines
+}
+
+// darkTheme is designed for dark terminal backgrounds
+var darkTheme = theme{
+	title:     "86",
+	muted:     "243",
+	subtle:    "241",
+	faint:     "238",
+	border:    "62",
+	critical:  "196",
+	warn:      "11",
+	info:      "14",
+	added:     "10",
+	deleted:   "9",
+	addedBg:   "22",
+	deletedBg: "52",
+	context:   "250",
+	lineNum:   "240",
+	highlight: "214",
+	alertText: "231",
+
+	synKeyword: "141",
+	synString:  "180",
+	synNumber:  "173",
+	synComment: "245",
+}
+
+// lightTheme is designed for light terminal backgrounds: darker
+// foregrounds and pale line backgrounds
+var lightTheme = theme{
+	title:     "30",
+	muted:     "242",
+	subtle:    "243",
+	faint:     "250",
+	border:    "62",
+	critical:  "160",
+	warn:      "130",
+	info:      "25",
+	added:     "22",
+	deleted:   "124",
+	addedBg:   "194",
+	deletedBg: "224",
+	context:   "238",
+	lineNum:   "245",
+	highlight: "166",
+	alertText: "231",
+
+	synKeyword: "91",
+	synString:  "94",
+	synNumber:  "130",
+	synComment: "246",
+}
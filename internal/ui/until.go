@@ -0,0 +1,68 @@
+package ui
+
+import (
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/deemkeen/diffwatch/internal/diff"
+	"github.com/deemkeen/diffwatch/internal/match"
+	"github.com/deemkeen/diffwatch/internal/watcher"
+)
+
+// timeoutMsg is sent when Options.Timeout has passed
+type timeoutMsg struct{}
+
+// untilMatch is the change that ended a session with Options.Until
+type untilMatch struct {
+	event  watcher.Event
+	result *diff.Result
+}
+
+// timeoutCmd ends the session once Options.Timeout has passed
+func (m *Model) timeoutCmd() tea.Cmd {
+	if m.opts.Timeout <= 0 {
+		return nil
+	}
+	return tea.Tick(m.opts.Timeout, func(time.Time) tea.Msg {
+		return timeoutMsg{}
+	})
+}
+
+// handleTimeout ends the session when its deadline has passed
+func (m *Model) handleTimeout() tea.Cmd {
+	m.log.Info("timeout reached", "timeout", m.opts.Timeout)
+	m.timedOut = true
+	m.quitting = true
+	return tea.Quit
+}
+
+// checkUntil ends the session if a processed change is to a file matching
+// Options.Until. Suppressed changes and writes that left the content as
+// it was don't count.
+func (m *Model) checkUntil(event watcher.Event, result *diff.Result, noise bool) tea.Cmd {
+	if m.opts.Until == "" || m.matched != nil || noise || !match.Glob(m.opts.Until, m.relPath(event.Path)) {
+		return nil
+	}
+	if event.Op == "write" && result != nil && !result.HasDiff {
+		return nil
+	}
+
+	m.log.Info("until pattern matched", "path", event.Path, "op", event.Op)
+	m.matched = &untilMatch{event: event, result: result}
+	m.quitting = true
+	return tea.Quit
+}
+
+// Matched returns the change that ended a session with Options.Until, if
+// one did
+func (m *Model) Matched() (watcher.Event, *diff.Result, bool) {
+	if m.matched == nil {
+		return watcher.Event{}, nil, false
+	}
+	return m.matched.event, m.matched.result, true
+}
+
+// TimedOut reports whether Options.Timeout ended the session
+func (m *Model) TimedOut() bool {
+	return m.timedOut
+}
@@ -0,0 +1,72 @@
+package ui
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/deemkeen/diffwatch/internal/diff"
+	"github.com/deemkeen/diffwatch/internal/lang"
+	"github.com/deemkeen/diffwatch/internal/pathname"
+)
+
+// renderLineContent renders a diff line's icon and content in style,
+// making invisible characters visible if toggled with 'w', and otherwise
+// highlighting the syntax of l (in colors on unchanged lines, see
+// renderCode). Values of .env files are masked unless revealed with 'R'.
+func (m *Model) renderLineContent(icon, content string, style lipgloss.Style, l *lang.Language, colors bool) string {
+	if l == lang.Dotenv && !m.revealValues {
+		content = diff.MaskEnv(content, m.glyphs.mask)
+	}
+	if m.showWhitespace {
+		return style.Render(icon) + m.renderVisible(content, style)
+	}
+	if l.Highlighted() {
+		return style.Render(icon) + m.renderCode(content, style, l, colors)
+	}
+	return style.Render(icon + content)
+}
+
+// renderVisible renders diff line content with invisible characters made
+// visible: tabs as arrows, trailing whitespace highlighted and
+// non-printable characters as escaped codepoints. Visible text uses base.
+func (m *Model) renderVisible(content string, base lipgloss.Style) string {
+	markerStyle := base.
+		Foreground(m.theme.muted)
+
+	trailingStyle := lipgloss.NewStyle().
+		Foreground(m.theme.alertText).
+		Background(m.theme.critical)
+
+	body := strings.TrimRight(content, " \t")
+	trailing := content[len(body):]
+
+	var b, run strings.Builder
+	flush := func() {
+		if run.Len() > 0 {
+			b.WriteString(base.Render(run.String()))
+			run.Reset()
+		}
+	}
+
+	for _, r := range body {
+		switch {
+		case r == '\t':
+			flush()
+			b.WriteString(markerStyle.Render(m.glyphs.tab))
+		case r != ' ' && !unicode.IsPrint(r):
+			flush()
+			b.WriteString(markerStyle.Render(pathname.EscapeRune(r)))
+		default:
+			run.WriteRune(r)
+		}
+	}
+	flush()
+
+	if trailing != "" {
+		visible := strings.NewReplacer("\t", m.glyphs.tab, " ", m.glyphs.space).Replace(trailing)
+		b.WriteString(trailingStyle.Render(visible))
+	}
+
+	return b.String()
+}
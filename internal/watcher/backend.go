@@ -0,0 +1,82 @@
+package watcher
+
+import (
+	"errors"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// notifier delivers raw file system events for watched paths, through
+// the event API of a local backend
+type notifier interface {
+	// Add starts watching path. Recursive notifiers watch the whole tree
+	// below path, others only its direct entries.
+	Add(path string) error
+	// Remove stops watching a path previously passed to Add
+	Remove(path string) error
+	// Events returns the channel of raw events
+	Events() <-chan fsnotify.Event
+	// Errors returns the channel of notifier errors
+	Errors() <-chan error
+	// Recursive reports whether a single Add covers all subdirectories
+	Recursive() bool
+	// Close stops watching and closes the channels
+	Close() error
+}
+
+// localBackends create the notifiers of the local backends by name. The
+// platform's default is used for an empty name.
+var localBackends = map[string]func(recursive bool, opts Options) (notifier, error){
+	"":         func(recursive bool, opts Options) (notifier, error) { return newNotifier(recursive) },
+	"fsnotify": func(recursive bool, opts Options) (notifier, error) { return newFSNotifyBackend() },
+	"poll":     func(recursive bool, opts Options) (notifier, error) { return newPollBackend(opts.Interval), nil },
+}
+
+// fsnotifyBackend watches paths with fsnotify (inotify, kqueue,
+// ReadDirectoryChangesW), one watch per directory
+type fsnotifyBackend struct {
+	watcher *fsnotify.Watcher
+}
+
+// newFSNotifyBackend creates a backend using fsnotify
+func newFSNotifyBackend() (*fsnotifyBackend, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	return &fsnotifyBackend{watcher: watcher}, nil
+}
+
+// Add watches a single directory (or file)
+func (b *fsnotifyBackend) Add(path string) error {
+	return b.watcher.AddWith(longPath(path), fsnotify.WithBufferSize(bufferSize(path)))
+}
+
+// Remove stops watching a single directory (or file)
+func (b *fsnotifyBackend) Remove(path string) error {
+	err := b.watcher.Remove(longPath(path))
+	if errors.Is(err, fsnotify.ErrNonExistentWatch) {
+		return nil
+	}
+	return err
+}
+
+// Events returns the channel of raw events
+func (b *fsnotifyBackend) Events() <-chan fsnotify.Event {
+	return b.watcher.Events
+}
+
+// Errors returns the channel of backend errors
+func (b *fsnotifyBackend) Errors() <-chan error {
+	return b.watcher.Errors
+}
+
+// Recursive returns false: every directory needs its own watch
+func (b *fsnotifyBackend) Recursive() bool {
+	return false
+}
+
+// Close stops watching
+func (b *fsnotifyBackend) Close() error {
+	return b.watcher.Close()
+}
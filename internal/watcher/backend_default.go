@@ -0,0 +1,27 @@
+//go:build !(darwin && cgo)
+
+package watcher
+
+import "runtime"
+
+// newNotifier creates the platform's notifier
+func newNotifier(recursive bool) (notifier, error) {
+	return newFSNotifyBackend()
+}
+
+// BackendName returns the name of the event API used for a watch: inotify,
+// kqueue, ReadDirectoryChangesW, FEN or, on other platforms, fsnotify
+func BackendName(recursive bool) string {
+	switch runtime.GOOS {
+	case "linux", "android":
+		return "inotify"
+	case "darwin", "freebsd", "openbsd", "netbsd", "dragonfly":
+		return "kqueue"
+	case "windows":
+		return "ReadDirectoryChangesW"
+	case "illumos", "solaris":
+		return "FEN"
+	default:
+		return "fsnotify"
+	}
+}
@@ -0,0 +1,293 @@
+//go:build darwin && cgo
+
+package watcher
+
+/*
+#cgo LDFLAGS: -framework CoreServices
+#include <stdlib.h>
+#include <CoreServices/CoreServices.h>
+#include <dispatch/dispatch.h>
+
+extern void fseventsCallback(void *stream, void *info, size_t numEvents, void *eventPaths,
+	FSEventStreamEventFlags *eventFlags, FSEventStreamEventId *eventIds);
+
+static void *fseventsCreate(const char *path, uintptr_t handle, double latency) {
+	CFStringRef cfPath = CFStringCreateWithCString(NULL, path, kCFStringEncodingUTF8);
+	CFArrayRef paths = CFArrayCreate(NULL, (const void **)&cfPath, 1, &kCFTypeArrayCallBacks);
+	FSEventStreamContext ctx = {0, (void *)handle, NULL, NULL, NULL};
+
+	FSEventStreamRef stream = FSEventStreamCreate(NULL, (FSEventStreamCallback)fseventsCallback,
+		&ctx, paths, kFSEventStreamEventIdSinceNow, latency,
+		kFSEventStreamCreateFlagFileEvents | kFSEventStreamCreateFlagNoDefer |
+		kFSEventStreamCreateFlagWatchRoot);
+
+	CFRelease(paths);
+	CFRelease(cfPath);
+	return stream;
+}
+
+static void *fseventsStart(void *stream) {
+	dispatch_queue_t queue = dispatch_queue_create("diffwatch.fsevents", DISPATCH_QUEUE_SERIAL);
+	FSEventStreamSetDispatchQueue((FSEventStreamRef)stream, queue);
+	if (!FSEventStreamStart((FSEventStreamRef)stream)) {
+		FSEventStreamInvalidate((FSEventStreamRef)stream);
+		FSEventStreamRelease((FSEventStreamRef)stream);
+		dispatch_release(queue);
+		return NULL;
+	}
+	return queue;
+}
+
+static void fseventsNoop(void *ctx) {}
+
+static void fseventsStop(void *stream, void *queue) {
+	FSEventStreamStop((FSEventStreamRef)stream);
+	FSEventStreamInvalidate((FSEventStreamRef)stream);
+	FSEventStreamRelease((FSEventStreamRef)stream);
+	// Wait for callbacks already queued to finish
+	dispatch_sync_f((dispatch_queue_t)queue, NULL, fseventsNoop);
+	dispatch_release((dispatch_queue_t)queue);
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/cgo"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// fseventsLatency is how long FSEvents may buffer events, in seconds
+const fseventsLatency = 0.05
+
+// newNotifier creates the platform's notifier. Recursive watches use
+// FSEvents, which subscribes to a whole tree with a single stream instead
+// of opening a kqueue file descriptor per directory.
+func newNotifier(recursive bool) (notifier, error) {
+	if recursive {
+		return newFSEventsBackend(), nil
+	}
+	return newFSNotifyBackend()
+}
+
+func init() {
+	localBackends["fsevents"] = func(recursive bool, opts Options) (notifier, error) {
+		return newFSEventsBackend(), nil
+	}
+}
+
+// BackendName returns the name of the event API used for a watch: FSEvents
+// for recursive watches, kqueue otherwise
+func BackendName(recursive bool) string {
+	if recursive {
+		return "FSEvents"
+	}
+	return "kqueue"
+}
+
+// fseventsStream is a single FSEvents subscription
+type fseventsStream struct {
+	backend  *fseventsBackend
+	root     string // Path as given to Add
+	realRoot string // Root with symlinks resolved, as reported by FSEvents
+	stream   unsafe.Pointer
+	queue    unsafe.Pointer
+	handle   cgo.Handle
+}
+
+// fseventsBackend watches directory trees with macOS FSEvents
+type fseventsBackend struct {
+	events  chan fsnotify.Event
+	errors  chan error
+	mu      sync.Mutex
+	streams map[string]*fseventsStream
+	closed  bool
+}
+
+// newFSEventsBackend creates a backend using FSEvents
+func newFSEventsBackend() *fseventsBackend {
+	return &fseventsBackend{
+		events:  make(chan fsnotify.Event, 100),
+		errors:  make(chan error, 10),
+		streams: make(map[string]*fseventsStream),
+	}
+}
+
+// Add subscribes to all changes below path
+func (b *fseventsBackend) Add(path string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return errors.New("watcher closed")
+	}
+	if _, ok := b.streams[path]; ok {
+		return nil
+	}
+
+	// FSEvents reports paths with symlinks resolved (e.g. /private/tmp)
+	realRoot, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return err
+	}
+
+	s := &fseventsStream{
+		backend:  b,
+		root:     path,
+		realRoot: realRoot,
+	}
+	s.handle = cgo.NewHandle(s)
+
+	cpath := C.CString(realRoot)
+	defer C.free(unsafe.Pointer(cpath))
+
+	s.stream = C.fseventsCreate(cpath, C.uintptr_t(s.handle), C.double(fseventsLatency))
+	if s.stream == nil {
+		s.handle.Delete()
+		return fmt.Errorf("creating FSEvents stream for %s", path)
+	}
+
+	s.queue = C.fseventsStart(s.stream)
+	if s.queue == nil {
+		s.handle.Delete()
+		return fmt.Errorf("starting FSEvents stream for %s", path)
+	}
+
+	b.streams[path] = s
+	return nil
+}
+
+// Remove stops the stream for path. Paths below a watched root have no
+// stream of their own and are ignored.
+func (b *fseventsBackend) Remove(path string) error {
+	b.mu.Lock()
+	s, ok := b.streams[path]
+	if ok {
+		delete(b.streams, path)
+	}
+	b.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	C.fseventsStop(s.stream, s.queue)
+	s.handle.Delete()
+	return nil
+}
+
+// Events returns the channel of raw events
+func (b *fseventsBackend) Events() <-chan fsnotify.Event {
+	return b.events
+}
+
+// Errors returns the channel of backend errors
+func (b *fseventsBackend) Errors() <-chan error {
+	return b.errors
+}
+
+// Recursive returns true: a stream covers the whole tree
+func (b *fseventsBackend) Recursive() bool {
+	return true
+}
+
+// Close stops all streams and closes the channels
+func (b *fseventsBackend) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	streams := b.streams
+	b.streams = nil
+	b.mu.Unlock()
+
+	for _, s := range streams {
+		C.fseventsStop(s.stream, s.queue)
+		s.handle.Delete()
+	}
+
+	close(b.events)
+	close(b.errors)
+	return nil
+}
+
+// handleEvent translates a single FSEvents event
+func (s *fseventsStream) handleEvent(path string, flags uint32) {
+	b := s.backend
+
+	if flags&(fseUserDropped|fseKernelDropped|fseMustScanSubDirs) != 0 {
+		b.sendError(fmt.Errorf("FSEvents dropped events below %s, some changes were missed", s.root))
+	}
+	if flags&fseRootChanged != 0 {
+		b.sendError(fmt.Errorf("watch root %s was moved or deleted", s.root))
+		return
+	}
+
+	// Map the resolved path back below the root as given
+	if rel, ok := strings.CutPrefix(path, s.realRoot); ok {
+		path = s.root + rel
+	}
+
+	_, err := os.Lstat(path)
+	op := fseventsOp(flags, err == nil)
+	if op == 0 {
+		return
+	}
+
+	b.sendEvent(fsnotify.Event{Name: path, Op: op})
+}
+
+// sendEvent delivers an event unless the backend is closed
+func (b *fseventsBackend) sendEvent(event fsnotify.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+
+	select {
+	case b.events <- event:
+	default:
+		// Channel full, report like fsnotify does
+		select {
+		case b.errors <- fsnotify.ErrEventOverflow:
+		default:
+		}
+	}
+}
+
+// sendError delivers an error unless the backend is closed
+func (b *fseventsBackend) sendError(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+
+	SendError(b.errors, err, nil)
+}
+
+//export fseventsCallback
+func fseventsCallback(stream unsafe.Pointer, info unsafe.Pointer, numEvents C.size_t,
+	eventPaths unsafe.Pointer, eventFlags *C.FSEventStreamEventFlags, eventIds *C.FSEventStreamEventId) {
+	s := cgo.Handle(uintptr(info)).Value().(*fseventsStream)
+
+	n := int(numEvents)
+	paths := unsafe.Slice((**C.char)(eventPaths), n)
+	flags := unsafe.Slice(eventFlags, n)
+
+	for i := 0; i < n; i++ {
+		s.handleEvent(C.GoString(paths[i]), uint32(flags[i]))
+	}
+}
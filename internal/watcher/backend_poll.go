@@ -0,0 +1,226 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/deemkeen/diffwatch/internal/crash"
+	"github.com/fsnotify/fsnotify"
+)
+
+// DefaultPollInterval is how often the poll backend lists watched paths
+const DefaultPollInterval = 2 * time.Second
+
+// pollEntry is a file or directory as last listed
+type pollEntry struct {
+	modTime time.Time
+	size    int64
+	mode    os.FileMode
+}
+
+// pollBackend watches paths by listing them periodically, for file systems
+// that deliver no change notifications: network shares, some FUSE and VM
+// mounts. Like fsnotify, a watch covers the direct entries of a directory.
+type pollBackend struct {
+	interval time.Duration
+	events   chan fsnotify.Event
+	errors   chan error
+	done     chan struct{}
+	wg       sync.WaitGroup
+
+	mu    sync.Mutex
+	paths map[string]map[string]pollEntry // Last listing of each watched path
+}
+
+// newPollBackend creates a backend listing watched paths every interval
+func newPollBackend(interval time.Duration) *pollBackend {
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	b := &pollBackend{
+		interval: interval,
+		events:   make(chan fsnotify.Event, 100),
+		errors:   make(chan error, 10),
+		done:     make(chan struct{}),
+		paths:    make(map[string]map[string]pollEntry),
+	}
+	b.wg.Add(1)
+	go b.poll()
+	return b
+}
+
+// listPath returns the entries of a directory, or a file itself
+func listPath(path string) (map[string]pollEntry, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return map[string]pollEntry{path: {info.ModTime(), info.Size(), info.Mode()}}, nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	listing := make(map[string]pollEntry, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			// Removed since reading the directory
+			continue
+		}
+		listing[filepath.Join(path, entry.Name())] = pollEntry{info.ModTime(), info.Size(), info.Mode()}
+	}
+	return listing, nil
+}
+
+// Add takes the first listing of a directory (or file)
+func (b *pollBackend) Add(path string) error {
+	listing, err := listPath(path)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.paths[path]; !ok {
+		b.paths[path] = listing
+	}
+	return nil
+}
+
+// Remove stops listing a directory (or file)
+func (b *pollBackend) Remove(path string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.paths, path)
+	return nil
+}
+
+// poll lists the watched paths every interval until the backend is closed
+func (b *pollBackend) poll() {
+	defer b.wg.Done()
+	defer func() {
+		if r := recover(); r != nil {
+			SendError(b.errors, crash.New(r), nil)
+		}
+	}()
+
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-ticker.C:
+			b.mu.Lock()
+			paths := make([]string, 0, len(b.paths))
+			for path := range b.paths {
+				paths = append(paths, path)
+			}
+			b.mu.Unlock()
+
+			slices.Sort(paths)
+			for _, path := range paths {
+				b.scan(path)
+			}
+		}
+	}
+}
+
+// scan compares a new listing of a watched path with the previous one and
+// reports the differences. A path that is gone reports its entries as
+// removed and is no longer listed, as fsnotify drops the watch.
+func (b *pollBackend) scan(path string) {
+	listing, err := listPath(path)
+	gone := os.IsNotExist(err)
+	if err != nil && !gone {
+		SendError(b.errors, err, nil)
+		return
+	}
+
+	b.mu.Lock()
+	old, ok := b.paths[path]
+	if ok {
+		if gone {
+			delete(b.paths, path)
+		} else {
+			b.paths[path] = listing
+		}
+	}
+	b.mu.Unlock()
+	if !ok {
+		// Removed while listing
+		return
+	}
+
+	var names []string
+	for name := range listing {
+		names = append(names, name)
+	}
+	for name := range old {
+		if _, ok := listing[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		now, exists := listing[name]
+		before, existed := old[name]
+
+		var op fsnotify.Op
+		switch {
+		case exists && !existed:
+			op = fsnotify.Create
+		case !exists:
+			op = fsnotify.Remove
+		case !now.modTime.Equal(before.modTime) || now.size != before.size:
+			op = fsnotify.Write
+		case now.mode != before.mode:
+			op = fsnotify.Chmod
+		default:
+			continue
+		}
+
+		select {
+		case b.events <- fsnotify.Event{Name: name, Op: op}:
+		case <-b.done:
+			return
+		}
+	}
+}
+
+// Events returns the channel of raw events
+func (b *pollBackend) Events() <-chan fsnotify.Event {
+	return b.events
+}
+
+// Errors returns the channel of backend errors
+func (b *pollBackend) Errors() <-chan error {
+	return b.errors
+}
+
+// Recursive returns false: every directory is listed on its own
+func (b *pollBackend) Recursive() bool {
+	return false
+}
+
+// Close stops polling and closes the channels
+func (b *pollBackend) Close() error {
+	select {
+	case <-b.done:
+		return nil
+	default:
+	}
+	close(b.done)
+	b.wg.Wait()
+	close(b.events)
+	close(b.errors)
+	return nil
+}
@@ -1,46 +1,134 @@
 package watcher
 
 import (
+	"cmp"
+	"fmt"
+	"slices"
 	"sync"
 	"time"
+
+	"github.com/deemkeen/diffwatch/internal/match"
 )
 
-// Debouncer batches rapid successive events for the same file
+// DefaultDebounce is the delay for files no debounce rule matches
+const DefaultDebounce = 100 * time.Millisecond
+
+// DebounceRule overrides the debounce delay for matching files, e.g. a
+// long one for logs that are appended to constantly
+type DebounceRule struct {
+	Pattern string        // Glob matched against the path relative to the watch root
+	Delay   time.Duration // Quiet time before the event is reported
+}
+
+// ParseDebounce parses debounce delays by glob, as in the config. Rules
+// are ordered most specific (longest pattern) first, so that is the one
+// that applies to a file matching several.
+func ParseDebounce(delays map[string]string) ([]DebounceRule, error) {
+	var rules []DebounceRule
+	for pattern, s := range delays {
+		delay, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("debounce %q: %w", pattern, err)
+		}
+		if delay < 0 {
+			return nil, fmt.Errorf("debounce %q: negative delay %s", pattern, s)
+		}
+		rules = append(rules, DebounceRule{Pattern: pattern, Delay: delay})
+	}
+
+	slices.SortFunc(rules, func(a, b DebounceRule) int {
+		if c := cmp.Compare(len(b.Pattern), len(a.Pattern)); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Pattern, b.Pattern)
+	})
+	return rules, nil
+}
+
+// Debouncer batches rapid successive events for the same file. Callbacks
+// run one at a time in the order their delays expired, so events for a
+// file are never reported out of order, whatever the delays.
 type Debouncer struct {
 	delay    time.Duration
+	rules    []DebounceRule
 	timers   map[string]*time.Timer
+	ready    []func() // Callbacks whose delay expired, in order
+	draining bool     // A goroutine is running the ready callbacks
 	mu       sync.Mutex
 	stopChan chan struct{}
 }
 
-// NewDebouncer creates a new debouncer with the given delay
-func NewDebouncer(delay time.Duration) *Debouncer {
+// NewDebouncer creates a new debouncer with the given delay, overridden
+// for files matching one of the rules
+func NewDebouncer(delay time.Duration, rules ...DebounceRule) *Debouncer {
 	return &Debouncer{
 		delay:    delay,
+		rules:    rules,
 		timers:   make(map[string]*time.Timer),
 		stopChan: make(chan struct{}),
 	}
 }
 
+// Delay returns the delay for a file at relPath (relative to its watch
+// root): that of the first matching rule, or the default
+func (d *Debouncer) Delay(relPath string) time.Duration {
+	for _, r := range d.rules {
+		if match.Glob(r.Pattern, relPath) {
+			return r.Delay
+		}
+	}
+	return d.delay
+}
+
 // Add adds an event for debouncing. The callback will be called after
-// the delay period if no new events for the same key arrive
-func (d *Debouncer) Add(key string, callback func()) {
+// the delay for relPath if no new events for the same key arrive. Returns
+// true if a pending event for the key was replaced.
+func (d *Debouncer) Add(key, relPath string, callback func()) bool {
+	delay := d.Delay(relPath)
+
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
 	// Cancel existing timer if present
-	if timer, exists := d.timers[key]; exists {
+	timer, exists := d.timers[key]
+	if exists {
 		timer.Stop()
 	}
 
 	// Create new timer
-	d.timers[key] = time.AfterFunc(d.delay, func() {
+	var next *time.Timer
+	next = time.AfterFunc(delay, func() {
 		d.mu.Lock()
+		// Replaced by a later event while firing
+		if d.timers[key] != next {
+			d.mu.Unlock()
+			return
+		}
 		delete(d.timers, key)
-		d.mu.Unlock()
+		d.ready = append(d.ready, callback)
+		d.drain()
+	})
+	d.timers[key] = next
+	return exists
+}
 
+// drain runs the ready callbacks in order unless another goroutine is
+// already doing so. It is called with d.mu held and releases it.
+func (d *Debouncer) drain() {
+	if d.draining {
+		d.mu.Unlock()
+		return
+	}
+	d.draining = true
+	for len(d.ready) > 0 {
+		callback := d.ready[0]
+		d.ready = d.ready[1:]
+		d.mu.Unlock()
 		callback()
-	})
+		d.mu.Lock()
+	}
+	d.draining = false
+	d.mu.Unlock()
 }
 
 // Stop stops all timers and cleans up
@@ -54,4 +142,5 @@ func (d *Debouncer) Stop() {
 		timer.Stop()
 	}
 	d.timers = make(map[string]*time.Timer)
+	d.ready = nil
 }
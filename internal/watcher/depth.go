@@ -0,0 +1,161 @@
+package watcher
+
+import (
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// fillDelay is how long after its setup a tree limited by
+// Options.WatchDepth starts to be watched deeper in the background, and
+// fillPause the pause between the deferred directories watched then, so
+// that watching a monorepo fully doesn't compete with the first changes
+const (
+	fillDelay = 2 * time.Second
+	fillPause = 10 * time.Millisecond
+)
+
+// deferredDirs are the directories that setups limited by
+// Options.WatchDepth left unwatched, with the trees below them
+type deferredDirs struct {
+	mu       sync.Mutex
+	byParent map[string][]string
+	count    int
+}
+
+// add defers the subdirectories of a watched directory
+func (d *deferredDirs) add(parent string, dirs []string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.byParent == nil {
+		d.byParent = make(map[string][]string)
+	}
+	d.byParent[parent] = append(d.byParent[parent], dirs...)
+	d.count += len(dirs)
+}
+
+// take removes and returns the deferred subdirectories of parent
+func (d *deferredDirs) take(parent string) []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	dirs := d.byParent[parent]
+	delete(d.byParent, parent)
+	d.count -= len(dirs)
+	return dirs
+}
+
+// next removes and returns any deferred directory
+func (d *deferredDirs) next() (string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for parent, dirs := range d.byParent {
+		dir := dirs[len(dirs)-1]
+		if len(dirs) == 1 {
+			delete(d.byParent, parent)
+		} else {
+			d.byParent[parent] = dirs[:len(dirs)-1]
+		}
+		d.count--
+		return dir, true
+	}
+	return "", false
+}
+
+// forget drops the deferred directories below dir, e.g. a root that is no
+// longer watched
+func (d *deferredDirs) forget(dir string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for parent, dirs := range d.byParent {
+		if parent == dir || isBelow(dir, parent) {
+			delete(d.byParent, parent)
+			d.count -= len(dirs)
+		}
+	}
+}
+
+// len returns the number of deferred directories
+func (d *deferredDirs) len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.count
+}
+
+// deferDirs leaves the subdirectories of a directory at the depth limit
+// unwatched for now: they are watched once something changes next to
+// them, or by fillDeferred
+func (fw *FileWatcher) deferDirs(parent string, subdirs []string) {
+	var dirs []string
+	for _, dir := range subdirs {
+		if !fw.SkipsDir(filepath.Base(dir)) {
+			dirs = append(dirs, dir)
+		}
+	}
+	if len(dirs) > 0 {
+		fw.deferred.add(parent, dirs)
+	}
+}
+
+// wakeDeferred watches the deferred subdirectories of dir, in which
+// something just changed: work there is likely to touch them too
+func (fw *FileWatcher) wakeDeferred(dir string) {
+	dirs := fw.deferred.take(dir)
+	if len(dirs) == 0 {
+		return
+	}
+	fw.log.Info("activity next to deferred directories, watching them", "path", dir, "dirs", len(dirs))
+
+	go func() {
+		defer fw.recoverPanic()
+		for _, dir := range dirs {
+			fw.watchDeferred(dir)
+		}
+	}()
+}
+
+// fillDeferred watches the deferred directories one after the other in
+// the background, until none is left. Only one fill runs at a time.
+func (fw *FileWatcher) fillDeferred() {
+	if !fw.filling.CompareAndSwap(false, true) {
+		return
+	}
+	defer fw.filling.Store(false)
+
+	select {
+	case <-fw.done:
+		return
+	case <-time.After(fillDelay):
+	}
+
+	start := time.Now()
+	filled := 0
+	for {
+		dir, ok := fw.deferred.next()
+		if !ok {
+			break
+		}
+		fw.watchDeferred(dir)
+		filled++
+
+		select {
+		case <-fw.done:
+			return
+		case <-time.After(fillPause):
+		}
+	}
+	if filled > 0 {
+		fw.log.Info("deferred directories watched", "dirs", filled, "took", time.Since(start).Round(time.Millisecond))
+	}
+}
+
+// watchDeferred watches a deferred directory and the tree below it,
+// unless its root is no longer watched
+func (fw *FileWatcher) watchDeferred(dir string) {
+	if fw.rootOf(dir) == "" {
+		return
+	}
+	if err := fw.walk(dir, 0, nil); err != nil {
+		// Deferred directories may be gone by now
+		fw.log.Info("watching deferred directory failed", "path", dir, "error", err)
+	}
+}
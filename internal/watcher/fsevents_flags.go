@@ -0,0 +1,52 @@
+//go:build darwin
+
+package watcher
+
+import "github.com/fsnotify/fsnotify"
+
+// FSEvents event flags (FSEventStreamEventFlags)
+const (
+	fseMustScanSubDirs = 0x00000001
+	fseUserDropped     = 0x00000002
+	fseKernelDropped   = 0x00000004
+	fseRootChanged     = 0x00000020
+	fseItemCreated     = 0x00000100
+	fseItemRemoved     = 0x00000200
+	fseInodeMetaMod    = 0x00000400
+	fseItemRenamed     = 0x00000800
+	fseItemModified    = 0x00001000
+	fseFinderInfoMod   = 0x00002000
+	fseItemChangeOwner = 0x00004000
+	fseItemXattrMod    = 0x00008000
+)
+
+// fseventsOp translates FSEvents item flags into fsnotify operations.
+// FSEvents coalesces flags, so whether the item still exists decides
+// between creation and removal.
+func fseventsOp(flags uint32, exists bool) fsnotify.Op {
+	var op fsnotify.Op
+
+	switch {
+	case flags&fseItemRemoved != 0 && !exists:
+		return fsnotify.Remove
+	case flags&fseItemRenamed != 0 && !exists:
+		// Renamed away from this path
+		return fsnotify.Rename
+	case flags&(fseItemCreated|fseItemRenamed) != 0 && exists:
+		// Created or renamed into place
+		op |= fsnotify.Create
+	}
+
+	if !exists {
+		return op
+	}
+
+	if flags&fseItemModified != 0 {
+		op |= fsnotify.Write
+	}
+	if flags&(fseInodeMetaMod|fseFinderInfoMod|fseItemChangeOwner|fseItemXattrMod) != 0 {
+		op |= fsnotify.Chmod
+	}
+
+	return op
+}
@@ -0,0 +1,203 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// rootCheckInterval is how often the roots are checked for having been
+// deleted or unmounted. inotify drops the watches of an unmounted tree
+// without an event, so only checking notices it.
+const rootCheckInterval = 2 * time.Second
+
+// GoneRoot is a watched root that was deleted or unmounted. Its watches
+// are dropped and set up again once it reappears: always for a root that
+// was unmounted or went stale, which is usually mounted again, and with
+// Options.WaitRoot for the others.
+type GoneRoot struct {
+	Path    string
+	Reason  string // "deleted or moved", "unmounted", "replaced", "stale: ..." or why it can't be reached
+	Since   time.Time
+	Waiting bool // Watched again once it reappears
+}
+
+// goneRoot is a gone root and what was left at its path
+type goneRoot struct {
+	GoneRoot
+	hole    os.FileInfo // The directory an unmounted root was mounted on, nil otherwise
+	remount bool        // Unmounted or stale, watched again once back even without WaitRoot
+}
+
+// GoneRoots returns the roots that are gone, in the order of Roots
+func (fw *FileWatcher) GoneRoots() []GoneRoot {
+	fw.mu.RLock()
+	defer fw.mu.RUnlock()
+
+	var gone []GoneRoot
+	for _, root := range fw.roots {
+		if g := fw.gone[root]; g != nil {
+			gone = append(gone, g.GoneRoot)
+		}
+	}
+	return gone
+}
+
+// rememberRoot records what a root looks like once watched, so that the
+// root checks notice it being replaced or unmounted
+func (fw *FileWatcher) rememberRoot(root string) {
+	if info, err := os.Stat(fw.basePath(root)); err == nil {
+		fw.rootInfos.Store(root, info)
+	}
+}
+
+// checkRootsLoop checks the roots every rootCheckInterval, or sooner when
+// an event or error hints that one is gone, until the watcher is closed
+func (fw *FileWatcher) checkRootsLoop() {
+	defer fw.recoverPanic()
+	ticker := time.NewTicker(rootCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-fw.done:
+			return
+		case <-ticker.C:
+		case <-fw.recheck:
+		}
+		for _, root := range fw.Roots() {
+			fw.checkRoot(root)
+		}
+	}
+}
+
+// recheckRoots has the roots checked without waiting for the next tick
+func (fw *FileWatcher) recheckRoots() {
+	select {
+	case fw.recheck <- struct{}{}:
+	default:
+	}
+}
+
+// checkRoot notices a root, or the directory of a file root, that is gone,
+// and watches a gone root again once it is back if it waits for that
+func (fw *FileWatcher) checkRoot(root string) {
+	dir := fw.basePath(root)
+	info, err := os.Stat(dir)
+
+	if first, ok := fw.rootInfos.Load(root); ok {
+		first := first.(os.FileInfo)
+		switch {
+		case os.IsNotExist(err):
+			fw.lose(root, "deleted or moved", nil, false)
+		case isStale(err):
+			fw.lose(root, "stale: "+err.Error(), nil, true)
+		case err != nil:
+			fw.lose(root, err.Error(), nil, false)
+		case unmounted(dir, first, info):
+			fw.lose(root, "unmounted", info, true)
+		case !os.SameFile(first, info):
+			// Deleted and created again between two checks
+			fw.lose(root, "replaced", nil, false)
+		}
+	}
+
+	fw.mu.RLock()
+	g := fw.gone[root]
+	fw.mu.RUnlock()
+	if g == nil || !g.Waiting || err != nil || !info.IsDir() {
+		return
+	}
+	if g.hole != nil && os.SameFile(g.hole, info) {
+		// Still unmounted
+		return
+	}
+	fw.rewatch(root)
+}
+
+// unmounted reports whether dir was a mount point when first seen and now
+// is the directory it was mounted on
+func unmounted(dir string, first, now os.FileInfo) bool {
+	parent, err := os.Stat(filepath.Dir(dir))
+	if err != nil {
+		return false
+	}
+	was, ok := device(first)
+	if !ok {
+		return false
+	}
+	is, _ := device(now)
+	below, _ := device(parent)
+	return was != below && is == below
+}
+
+// lose records a root as gone and drops its watches. A remount is waited
+// for even without WaitRoot.
+func (fw *FileWatcher) lose(root, reason string, hole os.FileInfo, remount bool) {
+	fw.mu.Lock()
+	if fw.closed || fw.gone[root] != nil || !slices.Contains(fw.roots, root) {
+		fw.mu.Unlock()
+		return
+	}
+	fw.gone[root] = &goneRoot{
+		GoneRoot: GoneRoot{Path: root, Reason: reason, Since: time.Now(), Waiting: fw.waitRoot || remount},
+		hole:     hole,
+		remount:  remount,
+	}
+	fw.mu.Unlock()
+
+	fw.unwatchRoot(root)
+	fw.log.Warn("watch root gone", "path", root, "reason", reason, "waiting", fw.waitRoot || remount)
+}
+
+// unwatchRoot drops the watches of a root that is gone or rebuilt and
+// forgets its directories and files. It stays a root.
+func (fw *FileWatcher) unwatchRoot(root string) {
+	fw.rootInfos.Delete(root)
+	fw.deferred.forget(fw.basePath(root))
+
+	// The watches usually went away with the directories
+	dir := fw.basePath(root)
+	fw.notifier.Remove(dir)
+	fw.watchedDirs.Range(func(key, _ any) bool {
+		path := key.(string)
+		if path != dir && !fw.covers(root, path) {
+			return true
+		}
+		if path != dir {
+			fw.notifier.Remove(path)
+		}
+		if _, loaded := fw.watchedDirs.LoadAndDelete(path); loaded {
+			fw.dirCount.Add(-1)
+		}
+		return true
+	})
+	fw.knownFiles.Range(func(key, _ any) bool {
+		if file := key.(string); fw.covers(root, file) {
+			fw.untrackFile(file)
+		}
+		return true
+	})
+}
+
+// rewatch sets up the watches of a gone root that is back
+func (fw *FileWatcher) rewatch(root string) {
+	if err := fw.watchAgain(root); err != nil {
+		fw.log.Debug("watch root not back yet", "path", root, "error", err)
+		return
+	}
+
+	fw.mu.Lock()
+	delete(fw.gone, root)
+	fw.mu.Unlock()
+	fw.log.Info("watch root back, watching again", "path", root)
+}
+
+// watchAgain sets up the watches of a root whose watches were dropped
+func (fw *FileWatcher) watchAgain(root string) error {
+	if fw.isFileRoot(root) {
+		return fw.watchFile(root)
+	}
+	return fw.watchRoot(root)
+}
@@ -0,0 +1,42 @@
+//go:build !windows
+
+package watcher
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// longPath returns path unchanged; only Windows limits path length
+func longPath(path string) string {
+	return path
+}
+
+// cleanEventPath returns the cleaned path reported by the backend
+func cleanEventPath(path string) string {
+	return filepath.Clean(path)
+}
+
+// bufferSize returns the event buffer size to use for path (Windows only)
+func bufferSize(path string) int {
+	return 64 * 1024
+}
+
+// device returns the device of a file, telling mount points from the
+// directories they are mounted on
+func device(info os.FileInfo) (uint64, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(st.Dev), true
+}
+
+// isStale reports whether err means that a watch or the file system under
+// it went stale, e.g. a network share or FUSE mount that was remounted or
+// lost its server
+func isStale(err error) bool {
+	return errors.Is(err, syscall.ESTALE) || errors.Is(err, syscall.EBADF) || errors.Is(err, syscall.ENOTCONN)
+}
@@ -0,0 +1,70 @@
+//go:build windows
+
+package watcher
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// Windows limits regular paths to MAX_PATH (260) characters
+const maxPath = 260
+
+// longPathPrefix makes Windows APIs accept paths longer than MAX_PATH
+const longPathPrefix = `\\?\`
+
+// watchBufferSize is the ReadDirectoryChangesW buffer size for local drives.
+// The default of 64K overflows easily during bursts (e.g. checkouts), but
+// network shares don't support more, so UNC paths keep the default.
+const watchBufferSize = 256 * 1024
+
+// longPath prefixes long absolute paths with \\?\ so they can be watched
+func longPath(path string) string {
+	if len(path) < maxPath || strings.HasPrefix(path, longPathPrefix) || !filepath.IsAbs(path) {
+		return path
+	}
+	if strings.HasPrefix(path, `\\`) {
+		// UNC path: \\server\share -> \\?\UNC\server\share
+		return longPathPrefix + `UNC\` + path[2:]
+	}
+	return longPathPrefix + path
+}
+
+// cleanEventPath strips the \\?\ prefix from paths reported by the backend
+// so they match the paths used everywhere else
+func cleanEventPath(path string) string {
+	if strings.HasPrefix(path, longPathPrefix+`UNC\`) {
+		return `\\` + path[len(longPathPrefix)+4:]
+	}
+	return filepath.Clean(strings.TrimPrefix(path, longPathPrefix))
+}
+
+// bufferSize returns the event buffer size to use for path
+func bufferSize(path string) int {
+	if strings.HasPrefix(path, `\\`) {
+		return 64 * 1024
+	}
+	return watchBufferSize
+}
+
+// device returns false: unmounting isn't told apart from deleting on
+// Windows
+func device(info os.FileInfo) (uint64, bool) {
+	return 0, false
+}
+
+// Errors of a handle or network share that went away or was reconnected
+const (
+	errorInvalidHandle  syscall.Errno = 6
+	errorUnexpNetErr    syscall.Errno = 59
+	errorNetnameDeleted syscall.Errno = 64
+)
+
+// isStale reports whether err means that a watch or the share under it
+// went stale, e.g. a network share that was reconnected
+func isStale(err error) bool {
+	return errors.Is(err, errorNetnameDeleted) || errors.Is(err, errorUnexpNetErr) || errors.Is(err, errorInvalidHandle)
+}
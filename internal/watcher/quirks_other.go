@@ -0,0 +1,15 @@
+//go:build !windows
+
+package watcher
+
+import "github.com/fsnotify/fsnotify"
+
+// quirks drops events of the platform's notifier that aren't changes.
+// inotify, kqueue and FSEvents report what changed, so nothing is dropped;
+// see quirks_windows.go for ReadDirectoryChangesW.
+type quirks struct{}
+
+// ignore returns why an event is to be dropped, or "" to report it
+func (q *quirks) ignore(event fsnotify.Event) string {
+	return ""
+}
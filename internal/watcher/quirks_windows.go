@@ -0,0 +1,66 @@
+//go:build windows
+
+package watcher
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// quirks drops the modifications ReadDirectoryChangesW reports that aren't
+// changes of a file's content:
+//
+//   - Directories are modified whenever an entry in them changes, so every
+//     write of a file comes with a write of its directory.
+//   - A save is reported once when it writes and again when the handle is
+//     closed and the last write time flushed, often later than the
+//     debounce delay. The second one would diff to nothing.
+//
+// Renames need no help: the old name is reported as renamed and the new one
+// as created, and moves across directories, reported as a removal and a
+// creation, are paired by content like on other platforms.
+type quirks struct {
+	mu     sync.Mutex
+	stamps map[string]stamp // Files by their size and last write time at their last reported write
+}
+
+// stamp is what a write changes of a file
+type stamp struct {
+	size int64
+	mod  time.Time
+}
+
+// ignore returns why an event is to be dropped, or "" to report it
+func (q *quirks) ignore(event fsnotify.Event) string {
+	if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+		q.mu.Lock()
+		delete(q.stamps, event.Name)
+		q.mu.Unlock()
+	}
+	if event.Op&(fsnotify.Write|fsnotify.Chmod) == 0 || event.Op&fsnotify.Create != 0 {
+		return ""
+	}
+
+	info, err := os.Stat(event.Name)
+	if err != nil {
+		return ""
+	}
+	if info.IsDir() {
+		return "directory write"
+	}
+
+	s := stamp{size: info.Size(), mod: info.ModTime()}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.stamps == nil {
+		q.stamps = make(map[string]stamp)
+	}
+	if last, ok := q.stamps[event.Name]; ok && last == s {
+		return "write already reported"
+	}
+	q.stamps[event.Name] = s
+	return ""
+}
@@ -0,0 +1,119 @@
+package watcher
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Backend is a source of change events for a watch session: the local
+// file system, or files polled elsewhere such as a container or a bucket.
+// The UI, daemon and diff engine only see this interface, so new event
+// sources are added by registering a backend.
+type Backend interface {
+	Events() <-chan Event
+	Errors() <-chan error
+	Stats() Stats
+	WatchPath() string
+	Roots() []string
+	IsRecursive() bool
+	AddRoot(path string) (string, error)
+	RemoveRoot(path string) (string, error)
+	WalkFiles(fn func(path string) error) error
+	Close() error
+}
+
+// Factory opens a backend watching path, given in the backend's syntax
+type Factory func(path string, recursive bool, opts Options) (Backend, error)
+
+// registration is a registered backend
+type registration struct {
+	scheme string
+	open   Factory
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]registration)
+)
+
+// Register makes a backend available to Open by name. Paths starting with
+// scheme (e.g. "s3://"), if not empty, select the backend without a name.
+// Register panics if the name is taken, so backends register in init.
+func Register(name, scheme string, open Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, ok := localBackends[name]; ok {
+		panic("watcher: backend " + name + " registered twice")
+	}
+	if _, ok := registry[name]; ok {
+		panic("watcher: backend " + name + " registered twice")
+	}
+	registry[name] = registration{scheme: scheme, open: open}
+}
+
+// Backends returns the names of the available backends, sorted
+func Backends() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	var names []string
+	for name := range localBackends {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	names = append(names, slices.Collect(maps.Keys(registry))...)
+	slices.Sort(names)
+	return names
+}
+
+// resolve returns the backend to use for path: the named one, or the one
+// whose scheme path starts with
+func resolve(name, path string) string {
+	if name != "" {
+		return name
+	}
+
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	for n, r := range registry {
+		if r.scheme != "" && strings.HasPrefix(path, r.scheme) {
+			return n
+		}
+	}
+	return ""
+}
+
+// IsLocal reports whether Open watches the local file system for name and
+// path, so the files can be read, committed and restored
+func IsLocal(name, path string) bool {
+	_, ok := localBackends[resolve(name, path)]
+	return ok
+}
+
+// Open watches path with the named backend. Without a name, the backend
+// is chosen by the scheme of path, and local paths are watched with the
+// platform's event API.
+func Open(name, path string, recursive bool, opts Options) (Backend, error) {
+	name = resolve(name, path)
+	if _, ok := localBackends[name]; ok {
+		opts.Backend = name
+		fw, err := New(path, recursive, opts)
+		if err != nil {
+			return nil, err
+		}
+		return fw, nil
+	}
+
+	registryMu.RLock()
+	r, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown backend %q (available: %s)", name, strings.Join(Backends(), ", "))
+	}
+	return r.open(path, recursive, opts)
+}
@@ -0,0 +1,245 @@
+package watcher
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/deemkeen/diffwatch/internal/crash"
+	"github.com/deemkeen/diffwatch/internal/pathname"
+)
+
+// setupWorkers is the number of directories a recursive watch setup lists
+// at once. Listing is mostly waiting for the file system, so this helps
+// beyond the number of CPUs, most on network and cold caches.
+const setupWorkers = 8
+
+// setupProgress counts the directories of the recursive watch setups
+// under way, for Stats. How much of a tree is done is estimated without
+// knowing its size: each directory stands for a share of its tree, the
+// root for all of it, which is split evenly among its subdirectories. A
+// directory without subdirectories completes its share.
+type setupProgress struct {
+	mu      sync.Mutex
+	running int     // Setups under way; the counts restart once none is
+	trees   int     // Setups begun since the counts restarted
+	found   int     // Directories found, including the roots
+	done    float64 // Shares of the trees completed
+}
+
+// begin starts counting a setup of a tree
+func (p *setupProgress) begin() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.running++
+	p.trees++
+	p.found++
+}
+
+// end finishes counting a setup
+func (p *setupProgress) end() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.running--
+	if p.running == 0 {
+		p.trees, p.found, p.done = 0, 0, 0
+	}
+}
+
+// listed counts the subdirectories found in a directory, which completes
+// its share of the tree if there are none
+func (p *setupProgress) listed(subdirs int, share float64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.found += subdirs
+	if subdirs == 0 {
+		p.done += share
+	}
+}
+
+// counts returns the directories found by the setups under way and the
+// estimated percentage of their trees done
+func (p *setupProgress) counts() (found, percent int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.trees == 0 {
+		return 0, 0
+	}
+	return p.found, min(int(p.done*100/float64(p.trees)), 99)
+}
+
+// queued is a directory found by a setup and not listed yet
+type queued struct {
+	dir   string
+	depth int     // Levels below the root of the setup
+	share float64 // Of the tree, see setupProgress
+}
+
+// setupWalk watches a tree with a pool of workers, each listing one
+// directory at a time and queueing the subdirectories it finds
+type setupWalk struct {
+	fw         *FileWatcher
+	root       string
+	addWatches bool           // The notifier needs a watch per directory
+	maxDepth   int            // Levels below root watched, the next deferred (0: all)
+	progress   *setupProgress // Counts the directories (nil: not counted)
+	mu         sync.Mutex
+	cond       *sync.Cond
+	queue      []queued
+	busy       int   // Workers listing a directory
+	err        error // First error, which ends the setup
+}
+
+// addRecursive adds a directory and all its subdirectories to the watcher.
+// Recursive notifiers already cover subdirectories, so for them the tree is
+// only walked to keep the stats up to date.
+func (fw *FileWatcher) addRecursive(root string) error {
+	return fw.walk(root, 0, &fw.setup)
+}
+
+// walk adds a directory and its subdirectories down to maxDepth levels
+// below it (0: all) to the watcher, deferring the deeper ones, and counts
+// them in progress (nil: not counted)
+func (fw *FileWatcher) walk(root string, maxDepth int, progress *setupProgress) error {
+	info, err := os.Lstat(root)
+	if err != nil {
+		if os.IsPermission(err) || isStale(err) {
+			fw.log.Info("skipping directory", "path", root, "error", err)
+			return nil
+		}
+		return err
+	}
+	if !info.IsDir() {
+		if !fw.skipFile(root) {
+			fw.trackFile(root)
+		}
+		return nil
+	}
+
+	w := &setupWalk{
+		fw:         fw,
+		root:       root,
+		addWatches: !fw.notifier.Recursive(),
+		maxDepth:   maxDepth,
+		progress:   progress,
+		queue:      []queued{{dir: root, share: 1}},
+	}
+	w.cond = sync.NewCond(&w.mu)
+	progress.begin()
+	defer progress.end()
+
+	var wg sync.WaitGroup
+	for range setupWorkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.work()
+		}()
+	}
+	wg.Wait()
+	return w.err
+}
+
+// work lists queued directories until the tree is done or the setup
+// failed
+func (w *setupWalk) work() {
+	for {
+		w.mu.Lock()
+		for len(w.queue) == 0 && w.busy > 0 && w.err == nil {
+			w.cond.Wait()
+		}
+		if len(w.queue) == 0 || w.err != nil {
+			w.mu.Unlock()
+			w.cond.Broadcast()
+			return
+		}
+		// Depth first, which keeps the queue short
+		next := w.queue[len(w.queue)-1]
+		w.queue = w.queue[:len(w.queue)-1]
+		w.busy++
+		w.mu.Unlock()
+
+		subdirs, err := w.list(next.dir)
+		if w.maxDepth > 0 && next.depth >= w.maxDepth {
+			w.fw.deferDirs(next.dir, subdirs)
+			subdirs = nil
+		}
+		w.progress.listed(len(subdirs), next.share)
+
+		w.mu.Lock()
+		w.busy--
+		for _, dir := range subdirs {
+			w.queue = append(w.queue, queued{dir: dir, depth: next.depth + 1, share: next.share / float64(len(subdirs))})
+		}
+		if err != nil && w.err == nil {
+			w.err = err
+		}
+		w.mu.Unlock()
+		w.cond.Broadcast()
+	}
+}
+
+// list watches a directory, tracks its files and returns its
+// subdirectories to watch. A panic fails the setup rather than leaving
+// the other workers waiting for this one.
+func (w *setupWalk) list(dir string) (subdirs []string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = crash.New(r)
+		}
+	}()
+	fw := w.fw
+
+	// Skip common directories that shouldn't be watched
+	if fw.SkipsDir(filepath.Base(dir)) {
+		return nil, nil
+	}
+
+	// Skip if already watched, but don't skip the root itself (we need
+	// to walk into root's subdirectories)
+	if _, watched := fw.watchedDirs.Load(dir); watched && dir != w.root {
+		return nil, nil
+	}
+
+	if w.addWatches {
+		if err := fw.notifier.Add(dir); err != nil {
+			// Skip if permission denied or stale
+			if os.IsPermission(err) || isStale(err) {
+				fw.log.Info("skipping directory", "path", dir, "error", err)
+				return nil, nil
+			}
+			return nil, fmt.Errorf("adding path to watcher: %w", err)
+		}
+	}
+	fw.markDirWatched(dir)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		// Skip directories with permission errors, and stale mounts,
+		// which the root checks and rebuilds take care of
+		if os.IsPermission(err) || isStale(err) {
+			fw.log.Info("skipping directory", "path", dir, "error", err)
+			return nil, nil
+		}
+		return nil, err
+	}
+	for _, entry := range entries {
+		path := pathname.Normalize(filepath.Join(dir, entry.Name()))
+		if entry.IsDir() {
+			subdirs = append(subdirs, path)
+		} else if !fw.skipFile(path) {
+			fw.trackFile(path)
+		}
+	}
+	return subdirs, nil
+}
@@ -0,0 +1,86 @@
+package watcher
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/deemkeen/diffwatch/internal/pathname"
+)
+
+// SkipsDir reports whether this watcher leaves directories called name out
+// of recursive watches: one of SkipDirs not watched anyway
+func (fw *FileWatcher) SkipsDir(name string) bool {
+	if !skipDirs[name] {
+		return false
+	}
+	_, watched := fw.watchDirs.Load(name)
+	return !watched
+}
+
+// SetSkipDir changes whether directories called name, one of SkipDirs, are
+// left out of recursive watches. Directories no longer skipped are watched
+// right away, and the watches of directories skipped again are dropped.
+func (fw *FileWatcher) SetSkipDir(name string, skip bool) error {
+	if !skipDirs[name] {
+		return fmt.Errorf("%q is not a skipped directory (skipped: %s)", name, strings.Join(SkipDirs(), ", "))
+	}
+	if skip == fw.SkipsDir(name) {
+		return nil
+	}
+
+	if skip {
+		fw.watchDirs.Delete(name)
+		fw.watchedDirs.Range(func(key, _ any) bool {
+			if path := key.(string); filepath.Base(path) == name {
+				dirs, files := fw.forgetTree(path)
+				fw.log.Debug("skipped directory, watches removed", "path", path, "dirs", dirs, "files", files)
+			}
+			return true
+		})
+		fw.log.Info("skipping directories", "name", name)
+		return nil
+	}
+
+	fw.watchDirs.Store(name, true)
+	fw.log.Info("watching skipped directories", "name", name)
+	if !fw.recursive {
+		return nil
+	}
+	for _, root := range fw.Roots() {
+		if fw.isFileRoot(root) {
+			continue
+		}
+		if err := fw.watchNamed(root, name); err != nil {
+			return fmt.Errorf("watching %s directories in %s: %w", name, root, err)
+		}
+	}
+	return nil
+}
+
+// watchNamed watches the directories called name below root, and what's
+// inside them
+func (fw *FileWatcher) watchNamed(root, name string) error {
+	return filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsPermission(err) || isStale(err) || os.IsNotExist(err) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !d.IsDir() || path == root {
+			return nil
+		}
+		if d.Name() == name {
+			if err := fw.addRecursive(pathname.Normalize(path)); err != nil {
+				return err
+			}
+			return filepath.SkipDir
+		}
+		if fw.SkipsDir(d.Name()) {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+}
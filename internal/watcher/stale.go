@@ -0,0 +1,79 @@
+package watcher
+
+import (
+	"errors"
+	"io/fs"
+	"time"
+
+	"github.com/deemkeen/diffwatch/internal/pathname"
+)
+
+// Rebuild records the watches of a root being set up again after a stale
+// watch error, as network mounts and Docker volumes give once remounted
+type Rebuild struct {
+	Path  string
+	Cause string // The error that set it off
+	At    time.Time
+	Count int // Rebuilds of the root so far
+}
+
+// Rebuilds returns the last rebuild of every root that was rebuilt, in
+// the order of Roots
+func (fw *FileWatcher) Rebuilds() []Rebuild {
+	fw.mu.RLock()
+	defer fw.mu.RUnlock()
+
+	var rebuilds []Rebuild
+	for _, root := range fw.roots {
+		if r := fw.rebuilds[root]; r != nil {
+			rebuilds = append(rebuilds, *r)
+		}
+	}
+	return rebuilds
+}
+
+// rebuildFor rebuilds the watches of the root a stale watch error is
+// about, or of every root if the error doesn't say
+func (fw *FileWatcher) rebuildFor(cause error) {
+	roots := fw.Roots()
+	var pathErr *fs.PathError
+	if errors.As(cause, &pathErr) {
+		if root := fw.rootOf(pathname.Normalize(pathErr.Path)); root != "" {
+			roots = []string{root}
+		}
+	}
+	for _, root := range roots {
+		fw.rebuild(root, cause)
+	}
+}
+
+// rebuild tears down the watches of a root and sets them up again. A root
+// that can't be watched again yet is gone until it is back, like an
+// unmounted one. Rebuilds of a root are at least rootCheckInterval apart,
+// so an error repeated for every watched directory rebuilds it once.
+func (fw *FileWatcher) rebuild(root string, cause error) {
+	fw.mu.Lock()
+	last := fw.rebuilds[root]
+	if fw.closed || fw.gone[root] != nil || last != nil && time.Since(last.At) < rootCheckInterval {
+		fw.mu.Unlock()
+		return
+	}
+	fw.mu.Unlock()
+
+	fw.unwatchRoot(root)
+	if err := fw.watchAgain(root); err != nil {
+		fw.lose(root, "stale: "+cause.Error(), nil, true)
+		return
+	}
+
+	fw.mu.Lock()
+	r := fw.rebuilds[root]
+	if r == nil {
+		r = &Rebuild{Path: root}
+		fw.rebuilds[root] = r
+	}
+	r.Cause, r.At = cause.Error(), time.Now()
+	r.Count++
+	fw.mu.Unlock()
+	fw.log.Info("watches rebuilt after stale watch error", "path", root, "error", cause)
+}
@@ -1,22 +1,75 @@
 package watcher
 
 import (
+	"errors"
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/deemkeen/diffwatch/internal/crash"
+	"github.com/deemkeen/diffwatch/internal/pathname"
 	"github.com/fsnotify/fsnotify"
 )
 
 // Event represents a file system change event
 type Event struct {
+	Seq       uint64 // Increases by one with every event of a watcher; gaps are dropped events
 	Path      string
 	Op        string // "create", "write", "remove", "rename", "chmod"
 	Timestamp time.Time
 }
 
+// allOps lists the operation names events can carry
+var allOps = []string{"create", "write", "remove", "rename", "chmod"}
+
+// ParseOps parses a comma-separated list of operation names
+func ParseOps(s string) ([]string, error) {
+	var ops []string
+	for _, op := range strings.Split(s, ",") {
+		op = strings.ToLower(strings.TrimSpace(op))
+		if op == "" {
+			continue
+		}
+		if !slices.Contains(allOps, op) {
+			return nil, fmt.Errorf("unknown operation %q (valid: %s)", op, strings.Join(allOps, ", "))
+		}
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
+
+// SendError delivers err on ch without blocking; the error is dropped
+// if ch is full, and logged to log unless it's nil
+func SendError(ch chan<- error, err error, log *slog.Logger) {
+	select {
+	case ch <- err:
+	default:
+		if log != nil {
+			log.Warn("error dropped, channel full", "error", err)
+		}
+	}
+}
+
+// Options configures optional watcher behavior
+type Options struct {
+	Ops         []string       // Operations to report (see ParseOps); empty reports all
+	IgnoreFiles []string       // Globs of file names to ignore, e.g. editor swap files
+	Debounce    []DebounceRule // Delays overriding DefaultDebounce, most specific first (see ParseDebounce)
+	Logger      *slog.Logger   // Receives watcher internals (nil: discard)
+	Backend     string         // Local backend: fsnotify, poll or fsevents (macOS); empty: the platform's
+	Interval    time.Duration  // Polling backends: time between listings (0: the backend's default)
+	Endpoint    string         // Object storage backends: endpoint of the service (empty: the provider's)
+	WaitRoot    bool           // Watch a deleted root again once it reappears (unmounted ones always are)
+	WatchDirs   []string       // Directories of SkipDirs to watch anyway, e.g. "build"
+	WatchDepth  int            // Directory levels below a root watched right away, deeper ones later (0: all)
+}
+
 // Common directories to skip when watching recursively
 var skipDirs = map[string]bool{
 	".git":          true,
@@ -42,12 +95,23 @@ var skipDirs = map[string]bool{
 	".vscode":       true,
 }
 
+// packageLocks are the lockfiles of package managers ending in .lock,
+// which are watched unlike lock files held by running programs
+var packageLocks = map[string]bool{
+	"Cargo.lock":    true,
+	"yarn.lock":     true,
+	"poetry.lock":   true,
+	"Pipfile.lock":  true,
+	"Gemfile.lock":  true,
+	"composer.lock": true,
+}
+
 // shouldSkipFile returns true if a file should be ignored
 func shouldSkipFile(path string) bool {
 	base := filepath.Base(path)
 
-	// Skip lock files
-	if filepath.Ext(base) == ".LOCK" || filepath.Ext(base) == ".lock" {
+	// Skip lock files, but not the lockfiles of package managers
+	if (filepath.Ext(base) == ".LOCK" || filepath.Ext(base) == ".lock") && !packageLocks[base] {
 		return true
 	}
 
@@ -64,14 +128,7 @@ func shouldSkipFile(path string) bool {
 	}
 
 	// Skip common temp file patterns
-	if len(base) > 0 && base[0] == '.' && (filepath.Ext(base) == ".swp" ||
-		filepath.Ext(base) == ".swo" ||
-		filepath.Ext(base) == ".tmp") {
-		return true
-	}
-
-	// Skip vim swap files
-	if len(base) > 0 && base[0] == '.' && len(base) > 4 && base[len(base)-4:] == ".swp" {
+	if len(base) > 0 && base[0] == '.' && filepath.Ext(base) == ".tmp" {
 		return true
 	}
 
@@ -80,81 +137,469 @@ func shouldSkipFile(path string) bool {
 		return true
 	}
 
-	// Skip tilde backup files
-	if len(base) > 0 && base[len(base)-1] == '~' {
+	return false
+}
+
+// skipFile returns true if a file should be ignored: built-in filters and
+// the IgnoreFiles globs
+func (fw *FileWatcher) skipFile(path string) bool {
+	if shouldSkipFile(path) {
 		return true
 	}
-
+	base := filepath.Base(path)
+	for _, pattern := range fw.ignoreFiles {
+		if ok, _ := filepath.Match(pattern, base); ok {
+			return true
+		}
+	}
 	return false
 }
 
 // FileWatcher watches files for changes and emits debounced events
 type FileWatcher struct {
-	watcher     *fsnotify.Watcher
+	notifier    notifier
 	events      chan Event
 	errors      chan error
 	debouncer   *Debouncer
 	mu          sync.RWMutex
 	closed      bool
 	recursive   bool
-	watchPath   string
+	ops         map[string]bool // Operations to report, nil for all
+	ignoreFiles []string        // Globs of file names to ignore
+	log         *slog.Logger
+	watchPath   string   // Primary root (its directory for a file), relative paths are based on it
+	roots       []string // All watched roots, primary first
+	fileRoots   sync.Map // Roots that are files, watched through their directory
 	watchedDirs sync.Map // Track watched directories to avoid duplicates
+	knownFiles  sync.Map // Track files in watched directories for stats
+	dirCount    atomic.Int64
+	fileCount   atomic.Int64
+	seq         atomic.Uint64 // Sequence number of the last event sent
+
+	waitRoot  bool                 // Watch deleted roots again once they reappear
+	rootInfos sync.Map             // Roots (the directory of a file root) as first watched
+	gone      map[string]*goneRoot // Roots that were deleted or unmounted, guarded by mu
+	rebuilds  map[string]*Rebuild  // Last rebuild of roots after stale watch errors, guarded by mu
+	recheck   chan struct{}        // Asks for the roots to be checked now
+	done      chan struct{}        // Closed by Close
+
+	watchDirs sync.Map // Names of SkipDirs watched anyway
+
+	setup      setupProgress // Directories of the recursive watch setups under way
+	watchDepth int           // See Options.WatchDepth
+	deferred   deferredDirs  // Directories below watchDepth not watched yet
+	filling    atomic.Bool   // fillDeferred is running
+
+	quirks quirks // Drops events of the notifier that aren't changes
+}
+
+// Stats holds live counters about the watched tree
+type Stats struct {
+	Dirs  int // Directories being watched
+	Files int // Files known in watched directories
+
+	// Recursive watch setups under way, e.g. of a huge tree at startup
+	SetupDirs    int // Directories found so far (0: no setup under way)
+	SetupPercent int // Estimated share of the trees set up, see setupProgress
+
+	Deferred int // Directories below Options.WatchDepth not watched yet, each with its tree
 }
 
 // New creates a new FileWatcher for the given path
-func New(path string, recursive bool) (*FileWatcher, error) {
-	watcher, err := fsnotify.NewWatcher()
+func New(path string, recursive bool, opts Options) (*FileWatcher, error) {
+	for _, pattern := range opts.IgnoreFiles {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid ignore pattern %q: %w", pattern, err)
+		}
+	}
+
+	for _, name := range opts.WatchDirs {
+		if !skipDirs[name] {
+			return nil, fmt.Errorf("%q is not a skipped directory (skipped: %s)", name, strings.Join(SkipDirs(), ", "))
+		}
+	}
+
+	newNotifier, ok := localBackends[opts.Backend]
+	if !ok {
+		return nil, fmt.Errorf("unknown local backend %q", opts.Backend)
+	}
+	b, err := newNotifier(recursive, opts)
 	if err != nil {
 		return nil, fmt.Errorf("creating watcher: %w", err)
 	}
 
 	// Add the path to watch
-	absPath, err := filepath.Abs(path)
+	absPath, err := resolvePath(path)
 	if err != nil {
-		watcher.Close()
+		b.Close()
 		return nil, fmt.Errorf("resolving path: %w", err)
 	}
 
 	fw := &FileWatcher{
-		watcher:   watcher,
-		events:    make(chan Event, 100),
-		errors:    make(chan error, 10),
-		debouncer: NewDebouncer(100 * time.Millisecond),
-		recursive: recursive,
-		watchPath: absPath,
+		notifier:    b,
+		events:      make(chan Event, 100),
+		errors:      make(chan error, 10),
+		debouncer:   NewDebouncer(DefaultDebounce, opts.Debounce...),
+		recursive:   recursive,
+		watchPath:   absPath,
+		roots:       []string{absPath},
+		ignoreFiles: opts.IgnoreFiles,
+		log:         opts.Logger,
+		waitRoot:    opts.WaitRoot,
+		watchDepth:  opts.WatchDepth,
+		gone:        make(map[string]*goneRoot),
+		rebuilds:    make(map[string]*Rebuild),
+		recheck:     make(chan struct{}, 1),
+		done:        make(chan struct{}),
+	}
+	if fw.log == nil {
+		fw.log = slog.New(slog.DiscardHandler)
+	}
+
+	for _, name := range opts.WatchDirs {
+		fw.watchDirs.Store(name, true)
+	}
+
+	if len(opts.Ops) > 0 {
+		fw.ops = make(map[string]bool)
+		for _, op := range opts.Ops {
+			fw.ops[op] = true
+		}
 	}
 
 	// Start watching in background
 	go fw.watch()
 
-	// Add paths to watch (asynchronously for recursive mode)
-	if recursive {
-		// Add root directory first so we get immediate events
-		if err := watcher.Add(absPath); err != nil {
-			watcher.Close()
-			return nil, fmt.Errorf("adding root path to watcher: %w", err)
+	if err := fw.watchRoot(absPath); err != nil {
+		b.Close()
+		return nil, err
+	}
+	fw.mu.Lock()
+	fw.watchPath = fw.basePath(absPath)
+	fw.mu.Unlock()
+	go fw.checkRootsLoop()
+
+	return fw, nil
+}
+
+// watchRoot adds the watches for a root path (asynchronously for
+// recursive mode)
+func (fw *FileWatcher) watchRoot(path string) error {
+	if info, err := os.Stat(path); err == nil && !info.IsDir() {
+		return fw.watchFile(path)
+	}
+
+	if !fw.recursive {
+		if err := fw.notifier.Add(path); err != nil {
+			return fmt.Errorf("adding path to watcher: %w", err)
 		}
-		fw.watchedDirs.Store(absPath, true)
+		fw.countEntries(path)
+		fw.rememberRoot(path)
+		return nil
+	}
 
-		// Start recursive watching in background to avoid blocking
-		go func() {
-			if err := fw.addRecursive(absPath); err != nil {
-				fw.sendError(fmt.Errorf("recursive watch setup: %w", err))
+	// Add root directory first so we get immediate events
+	if err := fw.notifier.Add(path); err != nil {
+		return fmt.Errorf("adding root path to watcher: %w", err)
+	}
+	fw.markDirWatched(path)
+	fw.rememberRoot(path)
+
+	// Start recursive watching in background to avoid blocking. Recursive
+	// notifiers cover the whole tree anyway, so they aren't limited.
+	depth := fw.watchDepth
+	if fw.notifier.Recursive() {
+		depth = 0
+	}
+	go func() {
+		defer fw.recoverPanic()
+		if err := fw.walk(path, depth, &fw.setup); err != nil {
+			if _, statErr := os.Stat(path); statErr != nil {
+				// The root went away meanwhile, which its check reports
+				fw.recheckRoots()
+				return
 			}
-		}()
-	} else {
-		if err := watcher.Add(absPath); err != nil {
-			watcher.Close()
-			return nil, fmt.Errorf("adding path to watcher: %w", err)
+			fw.sendError(fmt.Errorf("recursive watch setup: %w", err))
+			return
 		}
+		fw.fillDeferred()
+	}()
+	return nil
+}
+
+// watchFile watches a root that is a file through its directory, so that
+// the file stays watched when it is replaced by a rename, like editors
+// saving atomically do. Events for the other files of the directory don't
+// belong to the root (see covers).
+func (fw *FileWatcher) watchFile(path string) error {
+	fw.fileRoots.Store(path, true)
+	if err := fw.notifier.Add(filepath.Dir(path)); err != nil {
+		fw.fileRoots.Delete(path)
+		return fmt.Errorf("adding path to watcher: %w", err)
 	}
+	fw.trackFile(path)
+	fw.rememberRoot(path)
+	return nil
+}
 
-	return fw, nil
+// isFileRoot reports whether root is a file watched through its directory
+func (fw *FileWatcher) isFileRoot(root string) bool {
+	_, ok := fw.fileRoots.Load(root)
+	return ok
+}
+
+// basePath returns the path that paths below root are made relative to:
+// root itself, or its directory if it is a file
+func (fw *FileWatcher) basePath(root string) string {
+	if fw.isFileRoot(root) {
+		return filepath.Dir(root)
+	}
+	return root
 }
 
-// addRecursive adds a directory and all its subdirectories to the watcher
-func (fw *FileWatcher) addRecursive(root string) error {
-	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+// AddRoot starts watching another directory or file while running.
+// Returns the absolute path of the new root.
+func (fw *FileWatcher) AddRoot(path string) (string, error) {
+	absPath, err := resolvePath(path)
+	if err != nil {
+		return "", fmt.Errorf("resolving path: %w", err)
+	}
+	if _, err := os.Stat(absPath); err != nil {
+		return "", err
+	}
+
+	fw.mu.Lock()
+	if fw.closed {
+		fw.mu.Unlock()
+		return "", errors.New("watcher closed")
+	}
+	for _, root := range fw.roots {
+		if absPath == root || (fw.recursive && isBelow(root, absPath)) {
+			fw.mu.Unlock()
+			return "", fmt.Errorf("%s is already watched", absPath)
+		}
+	}
+	fw.roots = append(fw.roots, absPath)
+	fw.mu.Unlock()
+
+	if err := fw.watchRoot(absPath); err != nil {
+		fw.mu.Lock()
+		fw.roots = slices.DeleteFunc(fw.roots, func(root string) bool { return root == absPath })
+		fw.mu.Unlock()
+		return "", err
+	}
+
+	fw.log.Info("root added", "path", absPath)
+	return absPath, nil
+}
+
+// RemoveRoot stops watching a root added at startup or with AddRoot.
+// Watches still needed by another root are kept. The last root can't be
+// removed. Returns the absolute path of the removed root.
+func (fw *FileWatcher) RemoveRoot(path string) (string, error) {
+	absPath, err := resolvePath(path)
+	if err != nil {
+		return "", fmt.Errorf("resolving path: %w", err)
+	}
+
+	fw.mu.Lock()
+	if !slices.Contains(fw.roots, absPath) {
+		fw.mu.Unlock()
+		return "", fmt.Errorf("%s is not a watched root", absPath)
+	}
+	if len(fw.roots) == 1 {
+		fw.mu.Unlock()
+		return "", errors.New("can't stop watching the last root")
+	}
+	fw.roots = slices.DeleteFunc(fw.roots, func(root string) bool { return root == absPath })
+	fw.watchPath = fw.basePath(fw.roots[0])
+	_, gone := fw.gone[absPath]
+	delete(fw.gone, absPath)
+	delete(fw.rebuilds, absPath)
+	fw.mu.Unlock()
+	fw.rootInfos.Delete(absPath)
+	fw.deferred.forget(absPath)
+
+	if gone {
+		// Its watches were dropped when it went away
+		fw.fileRoots.Delete(absPath)
+		fw.log.Info("root removed", "path", absPath)
+		return absPath, nil
+	}
+
+	if fw.isFileRoot(absPath) {
+		if err := fw.removeFile(absPath); err != nil {
+			return "", err
+		}
+		fw.log.Info("root removed", "path", absPath)
+		return absPath, nil
+	}
+
+	if !fw.hasFileRootIn(absPath) {
+		if err := fw.notifier.Remove(absPath); err != nil {
+			return "", fmt.Errorf("removing %s from watcher: %w", absPath, err)
+		}
+	}
+
+	fw.watchedDirs.Range(func(key, _ any) bool {
+		dir := key.(string)
+		if fw.covers(absPath, dir) && fw.rootOf(dir) == "" {
+			if dir != absPath {
+				// The directory may be gone already
+				fw.notifier.Remove(dir)
+			}
+			if _, loaded := fw.watchedDirs.LoadAndDelete(dir); loaded {
+				fw.dirCount.Add(-1)
+			}
+		}
+		return true
+	})
+	fw.knownFiles.Range(func(key, _ any) bool {
+		file := key.(string)
+		if fw.covers(absPath, file) && fw.rootOf(file) == "" {
+			fw.untrackFile(file)
+		}
+		return true
+	})
+
+	fw.log.Info("root removed", "path", absPath)
+	return absPath, nil
+}
+
+// removeFile stops watching a file root removed with RemoveRoot, and its
+// directory unless another root watches it too
+func (fw *FileWatcher) removeFile(path string) error {
+	fw.fileRoots.Delete(path)
+	if fw.rootOf(path) == "" {
+		fw.untrackFile(path)
+	}
+
+	dir := filepath.Dir(path)
+	if _, watched := fw.watchedDirs.Load(dir); watched || fw.hasFileRootIn(dir) {
+		return nil
+	}
+	if err := fw.notifier.Remove(dir); err != nil {
+		return fmt.Errorf("removing %s from watcher: %w", dir, err)
+	}
+	return nil
+}
+
+// hasFileRootIn reports whether one of the roots is a file in dir
+func (fw *FileWatcher) hasFileRootIn(dir string) bool {
+	for _, root := range fw.Roots() {
+		if fw.isFileRoot(root) && filepath.Dir(root) == dir {
+			return true
+		}
+	}
+	return false
+}
+
+// Roots returns the watched root paths, the primary root first
+func (fw *FileWatcher) Roots() []string {
+	fw.mu.RLock()
+	defer fw.mu.RUnlock()
+	return slices.Clone(fw.roots)
+}
+
+// covers reports whether events for path belong to root
+func (fw *FileWatcher) covers(root, path string) bool {
+	if path == root {
+		return true
+	}
+	if fw.isFileRoot(root) {
+		// Not the other files of its directory
+		return false
+	}
+	if fw.recursive {
+		return isBelow(root, path)
+	}
+	return filepath.Dir(path) == root
+}
+
+// rootOf returns the root that path belongs to, or "" if it isn't watched
+func (fw *FileWatcher) rootOf(path string) string {
+	fw.mu.RLock()
+	defer fw.mu.RUnlock()
+
+	for _, root := range fw.roots {
+		if fw.covers(root, path) {
+			return root
+		}
+	}
+	return ""
+}
+
+// isBelow reports whether path lies inside the directory dir
+func isBelow(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// SkipsDir reports whether directories called name are left out of
+// recursive watches by default
+func SkipsDir(name string) bool {
+	return skipDirs[name]
+}
+
+// SkipDirs returns the names of the directories left out of recursive
+// watches, sorted
+func SkipDirs() []string {
+	names := make([]string, 0, len(skipDirs))
+	for name := range skipDirs {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// resolvePath returns the absolute, normalized form of a path given by
+// the user
+func resolvePath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return pathname.Normalize(abs), nil
+}
+
+// WalkFiles calls fn for every file in the watched roots, applying the
+// same rules as watching: subdirectories only in recursive mode, skipping
+// ignored directories and files
+func (fw *FileWatcher) WalkFiles(fn func(path string) error) error {
+	for _, root := range fw.Roots() {
+		if err := fw.walkRoot(root, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkRoot calls fn for every file in a single root
+func (fw *FileWatcher) walkRoot(root string, fn func(path string) error) error {
+	info, err := os.Stat(root)
+	if err != nil {
+		return fmt.Errorf("walking %s: %w", root, err)
+	}
+	if !info.IsDir() {
+		return fn(root)
+	}
+
+	if !fw.IsRecursive() {
+		entries, err := os.ReadDir(root)
+		if err != nil {
+			return fmt.Errorf("walking %s: %w", root, err)
+		}
+		for _, entry := range entries {
+			if entry.Type().IsRegular() && !fw.skipFile(entry.Name()) {
+				if err := fn(pathname.Normalize(filepath.Join(root, entry.Name()))); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	return filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
 		if err != nil {
 			// Skip directories/files with permission errors
 			if os.IsPermission(err) {
@@ -163,32 +608,123 @@ func (fw *FileWatcher) addRecursive(root string) error {
 			return err
 		}
 
-		if info.IsDir() {
-			// Skip common directories that shouldn't be watched
-			dirName := filepath.Base(path)
-			if skipDirs[dirName] {
-				return filepath.SkipDir
-			}
-
-			// Skip if already watched, but don't skip the root itself
-			// (we need to walk into root's subdirectories)
-			if _, watched := fw.watchedDirs.Load(path); watched && path != root {
+		if d.IsDir() {
+			if path != root && fw.SkipsDir(d.Name()) {
 				return filepath.SkipDir
 			}
+			return nil
+		}
 
-			if err := fw.watcher.Add(path); err != nil {
-				// Skip if permission denied
-				if os.IsPermission(err) {
-					return filepath.SkipDir
-				}
-				return fmt.Errorf("adding path to watcher: %w", err)
-			}
-			fw.watchedDirs.Store(path, true)
+		if d.Type().IsRegular() && !fw.skipFile(path) {
+			return fn(pathname.Normalize(path))
 		}
 		return nil
 	})
 }
 
+// countEntries registers the files of a single watched path for stats
+func (fw *FileWatcher) countEntries(path string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+
+	if !info.IsDir() {
+		fw.trackFile(path)
+		return
+	}
+
+	fw.markDirWatched(path)
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() && !fw.skipFile(entry.Name()) {
+			fw.trackFile(pathname.Normalize(filepath.Join(path, entry.Name())))
+		}
+	}
+}
+
+// forgetDir stops watching a directory that was deleted or moved away and
+// the directories below it, and forgets their files, so trees that are
+// recreated over and over don't leak watches. A recreated directory is
+// watched anew when its create event arrives. Roots stay watched.
+func (fw *FileWatcher) forgetDir(dir string) {
+	if _, watched := fw.watchedDirs.Load(dir); !watched || slices.Contains(fw.Roots(), dir) {
+		return
+	}
+
+	dirs, files := fw.forgetTree(dir)
+	fw.log.Debug("directory gone, watches removed", "path", dir, "dirs", dirs, "files", files)
+}
+
+// forgetTree stops watching a directory and the directories below it,
+// except roots, and forgets their files. Returns how many were forgotten.
+func (fw *FileWatcher) forgetTree(dir string) (dirs, files int) {
+	roots := fw.Roots()
+	fw.deferred.forget(dir)
+	fw.watchedDirs.Range(func(key, _ any) bool {
+		path := key.(string)
+		if path != dir && !isBelow(dir, path) || slices.Contains(roots, path) {
+			return true
+		}
+		if !fw.notifier.Recursive() {
+			// Deleted directories usually took their watch along,
+			// skipped ones still have it
+			fw.notifier.Remove(path)
+		}
+		if _, loaded := fw.watchedDirs.LoadAndDelete(path); loaded {
+			fw.dirCount.Add(-1)
+			dirs++
+		}
+		return true
+	})
+	fw.knownFiles.Range(func(key, _ any) bool {
+		if file := key.(string); isBelow(dir, file) {
+			fw.untrackFile(file)
+			files++
+		}
+		return true
+	})
+	return dirs, files
+}
+
+// markDirWatched records a directory as watched
+func (fw *FileWatcher) markDirWatched(path string) {
+	if _, loaded := fw.watchedDirs.LoadOrStore(path, true); !loaded {
+		fw.dirCount.Add(1)
+		fw.log.Debug("watching directory", "path", path)
+	}
+}
+
+// trackFile records a file as present in the watched tree
+func (fw *FileWatcher) trackFile(path string) {
+	if _, loaded := fw.knownFiles.LoadOrStore(path, true); !loaded {
+		fw.fileCount.Add(1)
+	}
+}
+
+// untrackFile records a file as gone from the watched tree
+func (fw *FileWatcher) untrackFile(path string) {
+	if _, loaded := fw.knownFiles.LoadAndDelete(path); loaded {
+		fw.fileCount.Add(-1)
+	}
+}
+
+// Stats returns live counters about the watched tree
+func (fw *FileWatcher) Stats() Stats {
+	found, percent := fw.setup.counts()
+	return Stats{
+		Dirs:         int(fw.dirCount.Load()),
+		Files:        int(fw.fileCount.Load()),
+		SetupDirs:    found,
+		SetupPercent: percent,
+		Deferred:     fw.deferred.len(),
+	}
+}
+
 // Events returns the channel of debounced file events
 func (fw *FileWatcher) Events() <-chan Event {
 	return fw.events
@@ -199,7 +735,8 @@ func (fw *FileWatcher) Errors() <-chan error {
 	return fw.errors
 }
 
-// WatchPath returns the absolute path being watched
+// WatchPath returns the absolute path of the primary root, or of its
+// directory if it is a file
 func (fw *FileWatcher) WatchPath() string {
 	fw.mu.RLock()
 	defer fw.mu.RUnlock()
@@ -223,26 +760,40 @@ func (fw *FileWatcher) Close() error {
 	}
 
 	fw.closed = true
+	close(fw.done)
 	fw.debouncer.Stop()
 	close(fw.events)
 	close(fw.errors)
-	return fw.watcher.Close()
+	return fw.notifier.Close()
 }
 
 // watch runs in a goroutine and processes file system events
 func (fw *FileWatcher) watch() {
+	defer fw.recoverPanic()
 	for {
 		select {
-		case event, ok := <-fw.watcher.Events:
+		case event, ok := <-fw.notifier.Events():
 			if !ok {
 				return
 			}
 			fw.handleEvent(event)
 
-		case err, ok := <-fw.watcher.Errors:
+		case err, ok := <-fw.notifier.Errors():
 			if !ok {
 				return
 			}
+			fw.log.Error("notifier error", "error", err)
+			if isStale(err) {
+				// Handled without bothering the user: the watches are
+				// rebuilt, or the root is gone until it is mounted again
+				fw.rebuildFor(err)
+				continue
+			}
+			// Errors often mean that a root went away
+			fw.recheckRoots()
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				err = fmt.Errorf("too many changes at once, some events were missed: %w", err)
+			}
 			fw.sendError(err)
 		}
 	}
@@ -250,42 +801,124 @@ func (fw *FileWatcher) watch() {
 
 // handleEvent processes a raw fsnotify event
 func (fw *FileWatcher) handleEvent(event fsnotify.Event) {
-	// Skip filtered files early
-	if shouldSkipFile(event.Name) {
+	event.Name = pathname.Normalize(cleanEventPath(event.Name))
+	fw.log.Debug("raw event", "path", event.Name, "op", event.Op.String())
+
+	// Skip filtered files early, unless given as a root
+	if fw.skipFile(event.Name) && !fw.isFileRoot(event.Name) {
+		fw.log.Debug("event ignored", "path", event.Name, "reason", "filtered file")
+		return
+	}
+
+	// Drop late events for roots that were removed
+	root := fw.rootOf(event.Name)
+	if root == "" {
+		fw.log.Debug("event ignored", "path", event.Name, "reason", "not below a watched root")
+		return
+	}
+
+	// Recursive notifiers report events below skipped directories too
+	if fw.notifier.Recursive() && fw.inSkippedDir(root, event.Name) {
+		fw.log.Debug("event ignored", "path", event.Name, "reason", "skipped directory")
+		return
+	}
+
+	// Work next to directories left unwatched by Options.WatchDepth is
+	// likely to touch them too
+	fw.wakeDeferred(filepath.Dir(event.Name))
+
+	// Events of the notifier that don't change a file, e.g. writes of
+	// directories on Windows
+	if reason := fw.quirks.ignore(event); reason != "" {
+		fw.log.Debug("event ignored", "path", event.Name, "reason", reason)
 		return
 	}
 
 	op := opToString(event.Op)
 
-	// If recursive mode and a directory was created, add it to the watcher
-	if fw.recursive && event.Op&fsnotify.Create == fsnotify.Create {
-		if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
-			// Check if we should skip this directory
-			dirName := filepath.Base(event.Name)
-			if !skipDirs[dirName] {
-				// Add recursively in background to avoid blocking
-				go func(path string) {
-					if err := fw.addRecursive(path); err != nil {
-						// Only send error if it's not a permission error
-						if !os.IsPermission(err) {
-							fw.sendError(fmt.Errorf("adding new directory to watcher: %w", err))
-						}
+	switch {
+	case event.Op&fsnotify.Create == fsnotify.Create:
+		info, err := os.Stat(event.Name)
+		if err != nil {
+			break
+		}
+
+		if !info.IsDir() {
+			fw.trackFile(event.Name)
+			break
+		}
+
+		// If recursive mode and a directory was created, add it to the watcher
+		// unless it's a directory we should skip
+		if fw.recursive && !fw.SkipsDir(filepath.Base(event.Name)) {
+			// Add recursively in background to avoid blocking
+			go func(path string) {
+				defer fw.recoverPanic()
+				if err := fw.addRecursive(path); err != nil {
+					// Only send error if it's not a permission error
+					if !os.IsPermission(err) {
+						fw.sendError(fmt.Errorf("adding new directory to watcher: %w", err))
 					}
-				}(event.Name)
-			}
+				}
+			}(event.Name)
+		}
+
+	case event.Op&(fsnotify.Remove|fsnotify.Rename) != 0:
+		fw.untrackFile(event.Name)
+		fw.forgetDir(event.Name)
+		if event.Name == fw.basePath(root) {
+			// Reported as a gone root rather than as a change
+			fw.recheckRoots()
+			fw.log.Debug("event ignored", "path", event.Name, "reason", "watch root itself")
+			return
 		}
 	}
 
+	// Drop operations the user isn't interested in, after the bookkeeping
+	// above which needs to see every event
+	if fw.ops != nil && !fw.ops[op] {
+		fw.log.Debug("event ignored", "path", event.Name, "reason", "operation not reported", "op", op)
+		return
+	}
+
 	ev := Event{
 		Path:      event.Name,
 		Op:        op,
 		Timestamp: time.Now(),
 	}
 
-	// Debounce the event
-	fw.debouncer.Add(event.Name, func() {
+	// Debounce the event, for as long as the rules say for this file
+	rel, err := filepath.Rel(root, event.Name)
+	if err != nil {
+		rel = event.Name
+	} else if rel == "." {
+		// A file root
+		rel = filepath.Base(event.Name)
+	}
+	if fw.debouncer.Add(event.Name, rel, func() {
+		defer fw.recoverPanic()
 		fw.sendEvent(ev)
-	})
+	}) {
+		fw.log.Debug("event debounced, replacing pending event", "path", event.Name, "op", op,
+			"delay", fw.debouncer.Delay(rel))
+	}
+}
+
+// inSkippedDir reports whether path lies below a directory inside root
+// that is skipped when watching recursively
+func (fw *FileWatcher) inSkippedDir(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+
+	dirs := strings.Split(filepath.Dir(rel), string(filepath.Separator))
+	for _, dir := range dirs {
+		if fw.SkipsDir(dir) {
+			return true
+		}
+	}
+	return false
 }
 
 // sendEvent safely sends an event to the events channel
@@ -297,10 +930,16 @@ func (fw *FileWatcher) sendEvent(event Event) {
 		return
 	}
 
+	// Events are sent one at a time by the debouncer, so numbers follow
+	// the order of the channel
+	event.Seq = fw.seq.Add(1)
+
 	select {
 	case fw.events <- event:
+		fw.log.Debug("event sent", "path", event.Path, "op", event.Op, "seq", event.Seq)
 	default:
 		// Channel full, drop event (backpressure)
+		fw.log.Warn("event dropped, channel full", "path", event.Path, "op", event.Op, "seq", event.Seq)
 	}
 }
 
@@ -313,11 +952,7 @@ func (fw *FileWatcher) sendError(err error) {
 		return
 	}
 
-	select {
-	case fw.errors <- err:
-	default:
-		// Channel full, drop error
-	}
+	SendError(fw.errors, err, fw.log)
 }
 
 // opToString converts fsnotify.Op to a string
@@ -337,3 +972,14 @@ func opToString(op fsnotify.Op) string {
 		return "unknown"
 	}
 }
+
+// recoverPanic reports a panic in one of the watcher's goroutines as a
+// *crash.Panic error instead of letting it kill the process, so the UI can
+// restore the terminal and write a crash report. Must be deferred.
+func (fw *FileWatcher) recoverPanic() {
+	if r := recover(); r != nil {
+		p := crash.New(r)
+		fw.log.Error("watcher panic", "error", p.Value)
+		fw.sendError(p)
+	}
+}